@@ -0,0 +1,122 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"tunn/internal/tunnel"
+	"tunn/pkg/bench"
+	"tunn/pkg/redact"
+	"tunn/pkg/utils"
+
+	"github.com/spf13/cobra"
+)
+
+// benchCmd represents the bench command.
+// It connects to the SSH server once and measures the throughput of the server
+// path alone and, unless --server-only is given, of a destination download.
+// With --crypto it instead measures the local cost of the SSH ciphers and MACs
+// without connecting anywhere.
+var benchCmd = &cobra.Command{
+	Use:   "bench",
+	Short: "Measure tunnel throughput",
+	Run:   runBench,
+}
+
+// benchFlags holds the command-line flags for the bench command.
+var benchFlags struct {
+	serverOnly bool
+	crypto     bool
+	duration   time.Duration
+	url        string
+}
+
+// init registers the bench command and its flags.
+func init() {
+	rootCmd.AddCommand(benchCmd)
+
+	benchCmd.Flags().BoolVar(&benchFlags.serverOnly, "server-only", false, "only measure the SSH server path (exec session to the server's loopback)")
+	benchCmd.Flags().BoolVar(&benchFlags.crypto, "crypto", false, "measure local SSH cipher/MAC throughput on this CPU and recommend algorithms")
+	benchCmd.Flags().DurationVar(&benchFlags.duration, "duration", 10*time.Second, "duration of each measurement")
+	benchCmd.Flags().StringVar(&benchFlags.url, "url", "https://speed.cloudflare.com/__down?bytes=1000000000", "large file downloaded for the destination measurement")
+}
+
+// runBench connects to the SSH server and runs the throughput measurements.
+func runBench(cmd *cobra.Command, args []string) {
+	if benchFlags.crypto {
+		duration := time.Second
+		if cmd.Flags().Changed("duration") {
+			duration = benchFlags.duration
+		}
+		runCryptoBench(duration)
+		return
+	}
+
+	cfg, err := loadConfig(configFile)
+	if err != nil {
+		fmt.Printf("Error: Failed to load config: %v\n", err)
+		os.Exit(1)
+	}
+
+	client, err := tunnel.Connect(cfg)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	defer client.Close()
+
+	fmt.Printf("\n→ Measuring server → client throughput (%s)\n", benchFlags.duration)
+	down, err := bench.ServerDownload(client, benchFlags.duration)
+	printBenchResult("Server download", down, err)
+
+	fmt.Printf("→ Measuring client → server throughput (%s)\n", benchFlags.duration)
+	up, err := bench.ServerUpload(client, benchFlags.duration)
+	printBenchResult("Server upload", up, err)
+
+	if benchFlags.serverOnly {
+		return
+	}
+
+	fmt.Printf("→ Measuring destination download from %s (%s)\n", redact.URL(benchFlags.url), benchFlags.duration)
+	dest, err := bench.Destination(client, benchFlags.url, benchFlags.duration)
+	printBenchResult("Destination download", dest, err)
+}
+
+// printBenchResult prints the outcome of a single measurement.
+func printBenchResult(name string, result bench.Result, err error) {
+	if err != nil {
+		fmt.Printf("✗ %s: %s\n", name, redact.Text(err.Error()))
+		return
+	}
+	fmt.Printf("✓ %s: %s/s (%s in %s)\n", name,
+		utils.FormatBytes(int64(result.Rate())), utils.FormatBytes(result.Bytes), result.Duration.Round(time.Millisecond))
+}
+
+// runCryptoBench measures every cipher and MAC combination locally and prints
+// the fastest as an "ssh" configuration snippet.
+func runCryptoBench(duration time.Duration) {
+	fmt.Printf("→ Measuring SSH cipher/MAC throughput on this CPU (%s each)\n", duration)
+
+	var best bench.Algorithm
+	var bestRate float64
+	for _, algorithm := range bench.Algorithms() {
+		result, err := bench.Crypto(algorithm, duration)
+		printBenchResult(algorithm.String(), result, err)
+		if err == nil && result.Rate() > bestRate {
+			best, bestRate = algorithm, result.Rate()
+		}
+	}
+	if bestRate == 0 {
+		fmt.Println("✗ No algorithm could be measured")
+		os.Exit(1)
+	}
+
+	fmt.Printf("\n✓ Fastest on this CPU: %s (%s/s)\n", best, utils.FormatBytes(int64(bestRate)))
+	fmt.Println("  Recommended configuration (the server must support these algorithms):")
+	fmt.Printf("  \"ssh\": {\"ciphers\": [%q]", best.Cipher)
+	if best.MAC != "" {
+		fmt.Printf(", \"macs\": [%q]", best.MAC)
+	}
+	fmt.Println("}")
+}
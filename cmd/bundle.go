@@ -0,0 +1,298 @@
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"tunn/pkg/bundle"
+	"tunn/pkg/config"
+	"tunn/pkg/presets"
+	"tunn/pkg/state"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+)
+
+// passphraseEnv names the environment variable that supplies the bundle
+// passphrase non-interactively.
+const passphraseEnv = "TUNN_BUNDLE_PASSPHRASE"
+
+// bundleCmd represents the bundle command and its subcommands.
+// It moves a working setup to another machine as one encrypted file.
+var bundleCmd = &cobra.Command{
+	Use:   "bundle",
+	Short: "Export or import an encrypted bundle of the setup",
+	Long: `Export the configuration, its includes and referenced files, the user
+preset catalog and the saved connection state into one passphrase-protected
+file, and import it on another machine such as a router or second laptop.
+
+The passphrase is prompted for, or read from $` + passphraseEnv + `.`,
+}
+
+// bundleExportCmd represents the bundle export command.
+var bundleExportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "Write the setup to an encrypted bundle",
+	Run:   runBundleExport,
+}
+
+// bundleImportCmd represents the bundle import command.
+var bundleImportCmd = &cobra.Command{
+	Use:   "import <bundle>",
+	Short: "Restore the setup from an encrypted bundle",
+	Args:  cobra.ExactArgs(1),
+	Run:   runBundleImport,
+}
+
+// bundleFlags holds the command-line flags for the bundle subcommands.
+var bundleFlags struct {
+	output string
+	dir    string
+	force  bool
+}
+
+// init registers the bundle command and its subcommands.
+func init() {
+	rootCmd.AddCommand(bundleCmd)
+	bundleCmd.AddCommand(bundleExportCmd)
+	bundleCmd.AddCommand(bundleImportCmd)
+
+	bundleExportCmd.Flags().StringVarP(&bundleFlags.output, "output", "o", "tunn.bundle", "bundle file to write")
+	bundleImportCmd.Flags().StringVar(&bundleFlags.dir, "dir", ".", "directory to restore the configuration and its files into")
+	bundleImportCmd.Flags().BoolVar(&bundleFlags.force, "force", false, "overwrite existing files")
+}
+
+// runBundleExport collects the setup and writes it to an encrypted bundle.
+func runBundleExport(cmd *cobra.Command, args []string) {
+	if config.IsRemote(configFile) {
+		fmt.Println("Error: bundle export needs a local config file")
+		os.Exit(1)
+	}
+	cfg, err := loadConfig(configFile)
+	if err != nil {
+		fmt.Printf("Error: Failed to load config: %v\n", err)
+		os.Exit(1)
+	}
+
+	entries, err := collectBundleEntries(cfg)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	passphrase, err := readPassphrase(true)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	var buf bytes.Buffer
+	if err := bundle.Write(&buf, passphrase, entries); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	if err := os.WriteFile(bundleFlags.output, buf.Bytes(), 0600); err != nil {
+		fmt.Printf("Error: Failed to write bundle: %v\n", err)
+		os.Exit(1)
+	}
+
+	for _, e := range entries {
+		fmt.Printf("  %-8s %s\n", e.Role, e.Origin)
+	}
+	fmt.Printf("✓ Exported %d files to %s\n", len(entries), bundleFlags.output)
+}
+
+// collectBundleEntries reads the files making up the setup of a configuration.
+//
+// The configuration and its includes are stored relative to the directory of
+// the root file, so includes must live in or below it. Files referenced by the
+// configuration are stored relative to the working directory they are opened
+// from, or under files/external/ when given as absolute paths. The preset
+// catalog and the default state file are stored when they exist.
+func collectBundleEntries(cfg *config.Config) ([]bundle.Entry, error) {
+	sources, err := config.Sources(configFile)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []bundle.Entry
+	add := func(name, role, origin string) error {
+		data, err := os.ReadFile(origin)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", origin, err)
+		}
+		entries = append(entries, bundle.Entry{Name: name, Role: role, Origin: origin, Data: data})
+		return nil
+	}
+
+	root := filepath.Dir(sources[0])
+	for i, src := range sources {
+		rel, err := filepath.Rel(root, src)
+		if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return nil, fmt.Errorf("included file %s is outside %s; move it next to the config to bundle it", src, root)
+		}
+		role := bundle.RoleInclude
+		if i == 0 {
+			role = bundle.RoleConfig
+		}
+		if err := add("config/"+filepath.ToSlash(rel), role, src); err != nil {
+			return nil, err
+		}
+	}
+
+	external := map[string]bool{}
+	addFile := func(path, role string) error {
+		if path == "" {
+			return nil
+		}
+		clean := filepath.Clean(path)
+		name := "files/" + filepath.ToSlash(clean)
+		if filepath.IsAbs(clean) || clean == ".." || strings.HasPrefix(clean, ".."+string(filepath.Separator)) {
+			name = "files/external/" + filepath.Base(clean)
+			for i := 2; external[name]; i++ {
+				name = fmt.Sprintf("files/external/%d-%s", i, filepath.Base(clean))
+			}
+			external[name] = true
+		}
+		return add(name, role, path)
+	}
+	if err := addFile(cfg.TLS.CertFile, bundle.RoleFile); err != nil {
+		return nil, err
+	}
+	if err := addFile(cfg.TLS.KeyFile, bundle.RoleFile); err != nil {
+		return nil, err
+	}
+	if cfg.Auto.StateFile != "" {
+		if _, err := os.Stat(cfg.Auto.StateFile); err == nil {
+			if err := addFile(cfg.Auto.StateFile, bundle.RoleState); err != nil {
+				return nil, err
+			}
+		}
+	} else if path, err := state.DefaultPath(); err == nil {
+		if _, err := os.Stat(path); err == nil {
+			if err := add("state.json", bundle.RoleState, path); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if path, err := presets.UserCatalogPath(); err == nil {
+		if _, err := os.Stat(path); err == nil {
+			if err := add("presets.json", bundle.RolePresets, path); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return entries, nil
+}
+
+// runBundleImport decrypts a bundle and restores its files.
+func runBundleImport(cmd *cobra.Command, args []string) {
+	file, err := os.Open(args[0])
+	if err != nil {
+		fmt.Printf("Error: Failed to open bundle: %v\n", err)
+		os.Exit(1)
+	}
+	defer file.Close()
+
+	passphrase, err := readPassphrase(false)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	entries, created, err := bundle.Read(file, passphrase)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("→ Bundle created %s with %d files\n", created.Local().Format("2006-01-02 15:04"), len(entries))
+
+	targets := make([]string, len(entries))
+	var conflicts []string
+	for i, e := range entries {
+		if targets[i], err = importTarget(e.Name); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		if _, err := os.Stat(targets[i]); err == nil && !bundleFlags.force {
+			conflicts = append(conflicts, targets[i])
+		}
+	}
+	if len(conflicts) > 0 {
+		fmt.Println("Error: these files already exist (use --force to overwrite):")
+		for _, path := range conflicts {
+			fmt.Printf("  %s\n", path)
+		}
+		os.Exit(1)
+	}
+
+	for i, e := range entries {
+		if err := os.MkdirAll(filepath.Dir(targets[i]), 0700); err != nil {
+			fmt.Printf("Error: Failed to create directory: %v\n", err)
+			os.Exit(1)
+		}
+		if err := os.WriteFile(targets[i], e.Data, 0600); err != nil {
+			fmt.Printf("Error: Failed to write %s: %v\n", targets[i], err)
+			os.Exit(1)
+		}
+		fmt.Printf("✓ Restored %s %s\n", e.Role, targets[i])
+		if strings.HasPrefix(e.Name, "files/external/") {
+			fmt.Printf("  ✗ It was exported from %s; update the config to point at the restored file\n", e.Origin)
+		}
+	}
+}
+
+// importTarget returns where a bundle entry is restored: configuration files
+// and referenced files under the import directory, the preset catalog and the
+// default state file at their standard locations.
+func importTarget(name string) (string, error) {
+	switch {
+	case name == "presets.json":
+		return presets.UserCatalogPath()
+	case name == "state.json":
+		return state.DefaultPath()
+	case strings.HasPrefix(name, "config/"):
+		return filepath.Join(bundleFlags.dir, filepath.FromSlash(strings.TrimPrefix(name, "config/"))), nil
+	case strings.HasPrefix(name, "files/"):
+		return filepath.Join(bundleFlags.dir, filepath.FromSlash(strings.TrimPrefix(name, "files/"))), nil
+	default:
+		return "", fmt.Errorf("unknown bundle entry %s", name)
+	}
+}
+
+// readPassphrase reads the bundle passphrase from the environment or the
+// terminal, asking twice when confirm is set.
+func readPassphrase(confirm bool) ([]byte, error) {
+	if value := os.Getenv(passphraseEnv); value != "" {
+		return []byte(value), nil
+	}
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		return nil, fmt.Errorf("no terminal to read the passphrase from; set %s", passphraseEnv)
+	}
+
+	fmt.Fprint(os.Stderr, "Passphrase: ")
+	passphrase, err := term.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read passphrase: %w", err)
+	}
+	if len(passphrase) == 0 {
+		return nil, errors.New("passphrase must not be empty")
+	}
+	if confirm {
+		fmt.Fprint(os.Stderr, "Repeat passphrase: ")
+		again, err := term.ReadPassword(fd)
+		fmt.Fprintln(os.Stderr)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read passphrase: %w", err)
+		}
+		if !bytes.Equal(passphrase, again) {
+			return nil, errors.New("passphrases do not match")
+		}
+	}
+	return passphrase, nil
+}
@@ -4,8 +4,13 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"strings"
 
+	"tunn/internal/tunnel"
 	"tunn/pkg/config"
+	"tunn/pkg/connection"
+	"tunn/pkg/presets"
+	"tunn/pkg/redact"
 
 	"github.com/spf13/cobra"
 )
@@ -34,15 +39,43 @@ var validateCmd = &cobra.Command{
 	Run:   validateConfig,
 }
 
+// lintCmd represents the config lint command.
+// It reports settings that are valid but likely mistakes.
+var lintCmd = &cobra.Command{
+	Use:   "lint",
+	Short: "Check configuration file for common mistakes",
+	Run:   lintConfig,
+}
+
+// diffCmd represents the config diff command.
+// It compares two configuration files and shows what reloading a tunnel
+// running with the first one with the second one would restart.
+var diffCmd = &cobra.Command{
+	Use:   "diff <old> <new>",
+	Short: "Show the differences between two configuration files",
+	Long: `Show the settings that differ between two configuration files after includes, variables,
+the selected profile and defaults are applied, and what reloading a tunnel running with <old>
+with <new> would restart. Secrets are masked unless --show-secrets is given.`,
+	Args: cobra.ExactArgs(2),
+	Run:  diffConfig,
+}
+
 // validateFlags holds the command-line flags for the validate subcommand.
 var validateFlags struct {
 	configPath string
+	strict     bool
+}
+
+// lintFlags holds the command-line flags for the lint subcommand.
+var lintFlags struct {
+	configPath string
 }
 
 // generateFlags holds the command-line flags for the generate subcommand.
 var generateFlags struct {
 	output string
 	mode   string
+	preset string
 }
 
 // init initializes the config command and its subcommands with their respective flags.
@@ -50,21 +83,64 @@ func init() {
 	rootCmd.AddCommand(configCmd)
 	configCmd.AddCommand(generateCmd)
 	configCmd.AddCommand(validateCmd)
+	configCmd.AddCommand(lintCmd)
+	configCmd.AddCommand(diffCmd)
 
 	generateCmd.Flags().StringVarP(&generateFlags.output, "output", "o", "config.json", "output file path")
 	generateCmd.Flags().StringVarP(&generateFlags.mode, "mode", "m", "direct", "tunnel mode: direct or proxy")
+	generateCmd.Flags().StringVar(&generateFlags.preset, "preset", "", "seed the configuration from a named preset (see 'tunn preset list')")
 
 	validateCmd.Flags().StringVarP(&validateFlags.configPath, "config", "c", "", "path to configuration file to validate (required)")
+	validateCmd.Flags().BoolVar(&validateFlags.strict, "strict", false, "also check that the payload is a well-formed HTTP request")
 	validateCmd.MarkFlagRequired("config")
+
+	lintCmd.Flags().StringVarP(&lintFlags.configPath, "config", "c", "", "path to configuration file to lint (required)")
+	lintCmd.MarkFlagRequired("config")
 }
 
 // generateConfig generates a sample configuration file based on the specified mode.
 // It creates a configuration template with example values that users can customize
-// for their specific tunneling needs.
+// for their specific tunneling needs. With --preset the mode, port, payload and
+// TLS settings are taken from the named preset.
 func generateConfig(cmd *cobra.Command, args []string) {
+	var preset *presets.Preset
+	if generateFlags.preset != "" {
+		p, err := presets.Find(generateFlags.preset)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		preset = p
+		generateFlags.mode = p.Mode
+	}
+
+	sampleConfig, err := newSampleConfig(generateFlags.mode)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	if preset != nil {
+		preset.Apply(sampleConfig)
+	}
+
+	if err := writeConfigFile(generateFlags.output, sampleConfig); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	if preset != nil {
+		fmt.Printf("Success: Sample configuration from preset '%s' generated: %s\n", preset.Name, generateFlags.output)
+		return
+	}
+	fmt.Printf("Success: Sample %s mode configuration generated: %s\n", generateFlags.mode, generateFlags.output)
+}
+
+// newSampleConfig returns a configuration template with example values for the
+// given tunnel mode.
+func newSampleConfig(mode string) (*config.Config, error) {
 	var sampleConfig *config.Config
 
-	switch generateFlags.mode {
+	switch mode {
 	case "direct":
 		sampleConfig = &config.Config{
 			Mode: "direct",
@@ -100,26 +176,25 @@ func generateConfig(cmd *cobra.Command, args []string) {
 			ConnectionTimeout: 30,
 		}
 	default:
-		fmt.Printf("Error: Unsupported mode: %s (supported: direct, proxy)\n", generateFlags.mode)
-		os.Exit(1)
+		return nil, fmt.Errorf("unsupported mode: %s (supported: direct, proxy)", mode)
 	}
+	return sampleConfig, nil
+}
 
-	var data []byte
-	var err error
-
-	data, err = json.MarshalIndent(sampleConfig, "", "  ")
-
+// writeConfigFile writes a configuration as indented JSON.
+func writeConfigFile(path string, v interface{}) error {
+	// JSON is valid YAML, but not valid TOML
+	if config.Format(path) == config.FormatTOML {
+		return fmt.Errorf("configurations are written as JSON, use a .json or .yaml file name")
+	}
+	data, err := json.MarshalIndent(v, "", "  ")
 	if err != nil {
-		fmt.Printf("Error: Failed to marshal config: %v\n", err)
-		os.Exit(1)
+		return fmt.Errorf("failed to marshal config: %w", err)
 	}
-
-	if err := os.WriteFile(generateFlags.output, data, 0644); err != nil {
-		fmt.Printf("Error: Failed to write config file: %v\n", err)
-		os.Exit(1)
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write config file: %w", err)
 	}
-
-	fmt.Printf("Success: Sample %s mode configuration generated: %s\n", generateFlags.mode, generateFlags.output)
+	return nil
 }
 
 // validateConfig validates an existing configuration file for syntax and content correctness.
@@ -132,20 +207,148 @@ func validateConfig(cmd *cobra.Command, args []string) {
 		os.Exit(1)
 	}
 
-	config, err := config.LoadConfig(configPath)
+	config, err := loadConfig(configPath)
 	if err != nil {
 		fmt.Printf("Error: Configuration validation failed: %v\n", err)
 		os.Exit(1)
 	}
 
+	if validateFlags.strict && config.HTTPPayload != "" {
+		if err := connection.ValidatePayload(config.HTTPPayload); err != nil {
+			fmt.Printf("Error: Strict payload validation failed: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
 	fmt.Printf("Success: Configuration file is valid: %s\n", configPath)
 	fmt.Printf("Configuration Summary:\n")
+	if profileName != "" {
+		fmt.Printf("   - Profile: %s\n", profileName)
+	}
 	fmt.Printf("   - Mode: %s\n", config.Mode)
-	fmt.Printf("   - SSH Target: %s:%d\n", config.SSH.Host, config.SSH.Port)
+	if len(config.Servers) == 0 {
+		fmt.Printf("   - SSH Target: %s:%d\n", config.SSH.Host, config.SSH.Port)
+	} else {
+		for _, server := range config.ServersByPriority() {
+			resolved := *config
+			server.Apply(&resolved)
+			fmt.Printf("   - Server %s (priority %d): %s:%d\n", server.Name, server.Priority, resolved.SSH.Host, resolved.SSH.Port)
+		}
+	}
 	if config.ProxyHost != "" {
 		fmt.Printf("   - Proxy: %s:%s\n", config.ProxyHost, config.ProxyPort)
 	}
-	fmt.Printf("   - SSH User: %s\n", config.SSH.Username)
-	fmt.Printf("   - Local Port: %d (%s)\n", config.Listener.Port, config.Listener.ProxyType)
+	if config.Hooks.PreConnect != nil {
+		fmt.Printf("   - SSH User: (from pre-connect hook)\n")
+	} else {
+		fmt.Printf("   - SSH User: %s\n", redact.Username(config.SSH.Username))
+	}
+	for _, l := range config.ProxyListeners() {
+		fmt.Printf("   - Local Port: %d (%s)\n", l.Port, l.ProxyType)
+	}
 	fmt.Printf("   - Timeout: %d seconds\n", config.ConnectionTimeout)
 }
+
+// lintConfig loads a configuration file and reports likely mistakes with suggested fixes.
+// It exits with a non-zero status when issues are found, so it can be used in scripts.
+func lintConfig(cmd *cobra.Command, args []string) {
+	cfg, err := loadConfig(lintFlags.configPath)
+	if err != nil {
+		fmt.Printf("Error: Configuration validation failed: %v\n", err)
+		os.Exit(1)
+	}
+
+	findings := cfg.Lint()
+	if cfg.HTTPPayload != "" {
+		if err := connection.ValidatePayload(cfg.HTTPPayload); err != nil {
+			findings = append(findings, config.Finding{
+				Field:      "httpPayload",
+				Message:    err.Error(),
+				Suggestion: "see 'tunn config validate --strict' for the payload rules",
+			})
+		}
+	}
+
+	if len(findings) == 0 {
+		fmt.Printf("Success: No issues found in %s\n", lintFlags.configPath)
+		return
+	}
+
+	fmt.Printf("Found %d issue(s) in %s:\n", len(findings), lintFlags.configPath)
+	for _, f := range findings {
+		fmt.Printf("   - %s: %s\n", f.Field, f.Message)
+		fmt.Printf("     fix: %s\n", f.Suggestion)
+	}
+	os.Exit(1)
+}
+
+// diffConfig loads two configuration files and prints the settings that differ
+// and the effect of reloading from one to the other.
+func diffConfig(cmd *cobra.Command, args []string) {
+	var configs [2]*config.Config
+	for i, path := range args {
+		cfg, err := loadConfig(path)
+		if err != nil {
+			fmt.Printf("Error: Failed to load %s: %v\n", path, err)
+			os.Exit(1)
+		}
+		configs[i] = cfg
+	}
+
+	changes, err := config.Diff(configs[0], configs[1])
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	if len(changes) == 0 {
+		fmt.Println("No differences")
+		return
+	}
+	for _, c := range changes {
+		switch {
+		case c.Old == nil:
+			fmt.Printf("   + %s: %s\n", c.Path, formatSetting(c.Path, c.New))
+		case c.New == nil:
+			fmt.Printf("   - %s: %s\n", c.Path, formatSetting(c.Path, c.Old))
+		default:
+			fmt.Printf("   ~ %s: %s → %s\n", c.Path, formatSetting(c.Path, c.Old), formatSetting(c.Path, c.New))
+		}
+	}
+	fmt.Println()
+
+	plan, err := tunnel.DescribeReload(configs[0], configs[1])
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	printReloadPlan(&plan)
+}
+
+// secretSettings lists the setting names whose values are masked completely.
+var secretSettings = map[string]bool{
+	"password": true, "token": true, "passphrase": true, "answers": true,
+}
+
+// formatSetting formats a setting value for display, masking secrets.
+func formatSetting(path string, value any) string {
+	name := path[strings.LastIndexAny(path, ".")+1:]
+	name, _, _ = strings.Cut(name, "[")
+	if text, ok := value.(string); ok {
+		switch {
+		case secretSettings[name]:
+			text = redact.Secret(text)
+		case name == "username":
+			text = redact.Username(text)
+		case strings.Contains(text, "://"):
+			text = redact.URL(text)
+		default:
+			text = redact.Text(text)
+		}
+		value = text
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+	return string(data)
+}
@@ -0,0 +1,383 @@
+package cmd
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"tunn/pkg/config"
+	"tunn/pkg/presets"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+)
+
+// initCmd represents the config init command.
+// It builds a configuration file from answers to a few questions instead of
+// a sample that has to be edited by hand.
+var initCmd = &cobra.Command{
+	Use:   "init",
+	Short: "Create a configuration file by answering a few questions",
+	Long: `Create a configuration file interactively: choose the tunnel mode (direct, proxy or sni),
+enter the server and SSH credentials, pick a payload from the preset catalog and the local proxy type.
+The file is validated before it is written. Press Enter to accept the default shown in brackets.`,
+	Args: cobra.NoArgs,
+	Run:  initConfig,
+}
+
+// initFlags holds the command-line flags for the init subcommand.
+var initFlags struct {
+	output string
+	force  bool
+}
+
+// init registers the config init command and its flags.
+func init() {
+	configCmd.AddCommand(initCmd)
+
+	initCmd.Flags().StringVarP(&initFlags.output, "output", "o", "config.json", "output file path")
+	initCmd.Flags().BoolVar(&initFlags.force, "force", false, "overwrite an existing file without asking")
+}
+
+// initConfig runs the configuration wizard and writes the resulting file.
+func initConfig(cmd *cobra.Command, args []string) {
+	if config.Format(initFlags.output) == config.FormatTOML {
+		fmt.Println("Error: configurations are written as JSON, use a .json or .yaml file name")
+		os.Exit(1)
+	}
+
+	w := newWizard(os.Stdin, os.Stderr)
+	if _, err := os.Stat(initFlags.output); err == nil && !initFlags.force {
+		overwrite, err := w.confirm(fmt.Sprintf("%s already exists. Overwrite it?", initFlags.output), false)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		if !overwrite {
+			fmt.Println("Cancelled, nothing was written")
+			return
+		}
+	}
+
+	cfg, err := w.run()
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	if err := writeValidatedConfig(initFlags.output, cfg); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Success: Configuration written to %s\n", initFlags.output)
+	for _, f := range cfg.Lint() {
+		fmt.Printf("Note: %s: %s (%s)\n", f.Field, f.Message, f.Suggestion)
+	}
+	fmt.Printf("Start the tunnel with: tunn -c %s\n", initFlags.output)
+}
+
+// writeValidatedConfig writes a configuration only if it loads and validates
+// like a file written by hand would, leaving an existing file untouched
+// otherwise.
+//
+// Parameters:
+//   - path: The file to write
+//   - cfg: The configuration to write
+//
+// Returns:
+//   - error: An error if the configuration is invalid or cannot be written
+func writeValidatedConfig(path string, cfg *config.Config) error {
+	tmp := filepath.Join(filepath.Dir(path), "."+filepath.Base(path)+".tmp")
+	if err := writeConfigFile(tmp, cfg); err != nil {
+		return err
+	}
+	if _, err := config.LoadConfig(tmp); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("the answers do not make a valid configuration: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to write config file: %w", err)
+	}
+	return nil
+}
+
+// wizard asks the questions of config init.
+type wizard struct {
+	in  *bufio.Reader
+	out io.Writer
+	fd  int  // File descriptor of the input, for reading passwords without echo
+	tty bool // Whether the input is a terminal
+}
+
+// newWizard creates a wizard reading answers from in and writing questions to out.
+func newWizard(in *os.File, out io.Writer) *wizard {
+	fd := int(in.Fd())
+	return &wizard{in: bufio.NewReader(in), out: out, fd: fd, tty: term.IsTerminal(fd)}
+}
+
+// run asks for the settings of a tunnel in turn.
+//
+// Returns:
+//   - *config.Config: The configuration built from the answers
+//   - error: An error if the input ends or cannot be read
+func (w *wizard) run() (*config.Config, error) {
+	cfg := &config.Config{ConnectionTimeout: 30}
+
+	fmt.Fprintln(w.out, "Tunnel mode:")
+	modes := []string{
+		"direct - connect to the SSH server or its WebSocket front",
+		"proxy  - connect through an HTTP proxy",
+		"sni    - connect over TLS on port 443 with a custom server name (SNI)",
+	}
+	mode, err := w.choose(modes, 0)
+	if err != nil {
+		return nil, err
+	}
+	cfg.Mode = "direct"
+	defaultPort := 80
+	switch mode {
+	case 1:
+		cfg.Mode = "proxy"
+	case 2:
+		defaultPort = 443
+	}
+
+	if cfg.SSH.Host, err = w.ask("SSH server host", "", required); err != nil {
+		return nil, err
+	}
+	if cfg.SSH.Port, err = w.askPort("SSH server port", defaultPort); err != nil {
+		return nil, err
+	}
+	if cfg.Mode == "proxy" {
+		if cfg.ProxyHost, err = w.ask("HTTP proxy host", "", required); err != nil {
+			return nil, err
+		}
+		port, err := w.askPort("HTTP proxy port", 8080)
+		if err != nil {
+			return nil, err
+		}
+		cfg.ProxyPort = strconv.Itoa(port)
+	}
+	if mode == 2 {
+		if cfg.SSH.Port != 443 {
+			fmt.Fprintln(w.out, "Note: TLS and the server name are only used on port 443")
+		}
+		if cfg.TLS.ServerName, err = w.ask("TLS server name (SNI)", cfg.SSH.Host, required); err != nil {
+			return nil, err
+		}
+	}
+
+	if cfg.SSH.Username, err = w.ask("SSH username", "", required); err != nil {
+		return nil, err
+	}
+	if cfg.SSH.Password, err = w.askSecret("SSH password"); err != nil {
+		return nil, err
+	}
+
+	if err := w.choosePayload(cfg, mode == 2); err != nil {
+		return nil, err
+	}
+
+	fmt.Fprintln(w.out, "Local proxy type:")
+	proxyType, err := w.choose([]string{"socks5", "http", "mixed - SOCKS5 and HTTP on the same port"}, 0)
+	if err != nil {
+		return nil, err
+	}
+	cfg.Listener.ProxyType = []string{"socks5", "http", "mixed"}[proxyType]
+	if cfg.Listener.Port, err = w.askPort("Local proxy port", 1080); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// choosePayload offers the payloads of the presets matching the chosen mode,
+// a custom payload, or none.
+//
+// Parameters:
+//   - cfg: The configuration to set the payload and TLS settings of
+//   - sni: Whether the server name was already chosen and must be kept
+//
+// Returns:
+//   - error: An error if the catalog cannot be loaded or the input ends
+func (w *wizard) choosePayload(cfg *config.Config, sni bool) error {
+	list, err := presets.Load()
+	if err != nil {
+		return err
+	}
+	var matching []presets.Preset
+	var options []string
+	for _, p := range list {
+		if p.Mode == cfg.Mode && p.HTTPPayload != "" {
+			matching = append(matching, p)
+			options = append(options, fmt.Sprintf("%s - %s", p.Name, p.Description))
+		}
+	}
+	options = append(options, "custom - enter a payload", "none - plain SSH without a payload")
+
+	fmt.Fprintln(w.out, "Payload:")
+	choice, err := w.choose(options, 0)
+	if err != nil {
+		return err
+	}
+	switch {
+	case choice < len(matching):
+		p := matching[choice]
+		cfg.HTTPPayload = p.HTTPPayload
+		cfg.TLS.ALPN = p.ALPN
+		if !sni {
+			cfg.TLS.ServerName = p.ServerName
+		}
+	case choice == len(matching):
+		fmt.Fprintln(w.out, "Use [crlf] for line breaks and [host] for the SSH server host")
+		cfg.HTTPPayload, err = w.ask("Payload", "", required)
+	}
+	return err
+}
+
+// required rejects empty answers.
+func required(answer string) error {
+	if answer == "" {
+		return errors.New("an answer is required")
+	}
+	return nil
+}
+
+// ask asks a question, repeating it until the answer is accepted.
+//
+// Parameters:
+//   - question: The question to ask
+//   - def: The answer taken when only Enter is pressed, shown in brackets
+//   - check: Validation of the answer, or nil to accept anything
+//
+// Returns:
+//   - string: The accepted answer
+//   - error: An error if the input ends or cannot be read
+func (w *wizard) ask(question, def string, check func(string) error) (string, error) {
+	for {
+		if def != "" {
+			fmt.Fprintf(w.out, "%s [%s]: ", question, def)
+		} else {
+			fmt.Fprintf(w.out, "%s: ", question)
+		}
+		answer, err := w.readLine()
+		if err != nil {
+			return "", err
+		}
+		if answer == "" {
+			answer = def
+		}
+		if strings.Contains(answer, "$") {
+			// Configuration files expand $VAR, which would change the answer
+			fmt.Fprintln(w.out, "  '$' starts an environment variable reference in config files; edit the file to use ${VAR} instead")
+			continue
+		}
+		if check != nil {
+			if err := check(answer); err != nil {
+				fmt.Fprintf(w.out, "  %v\n", err)
+				continue
+			}
+		}
+		return answer, nil
+	}
+}
+
+// askPort asks for a port number.
+func (w *wizard) askPort(question string, def int) (int, error) {
+	answer, err := w.ask(question, strconv.Itoa(def), func(answer string) error {
+		if port, err := strconv.Atoi(answer); err != nil || port < 1 || port > 65535 {
+			return errors.New("enter a port between 1 and 65535")
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(answer)
+}
+
+// askSecret asks for a password, without echoing it on terminals.
+func (w *wizard) askSecret(question string) (string, error) {
+	if !w.tty {
+		return w.ask(question, "", required)
+	}
+	for {
+		fmt.Fprintf(w.out, "%s: ", question)
+		answer, err := term.ReadPassword(w.fd)
+		fmt.Fprintln(w.out)
+		if err != nil {
+			return "", fmt.Errorf("failed to read answer: %w", err)
+		}
+		switch {
+		case len(answer) == 0:
+			fmt.Fprintln(w.out, "  an answer is required")
+		case strings.Contains(string(answer), "$"):
+			fmt.Fprintln(w.out, "  '$' starts an environment variable reference in config files; edit the file to use ${VAR} instead")
+		default:
+			return string(answer), nil
+		}
+	}
+}
+
+// choose lists numbered options and asks for one of them.
+//
+// Parameters:
+//   - options: The options to list
+//   - def: Index of the option taken when only Enter is pressed
+//
+// Returns:
+//   - int: Index of the chosen option
+//   - error: An error if the input ends or cannot be read
+func (w *wizard) choose(options []string, def int) (int, error) {
+	for i, option := range options {
+		fmt.Fprintf(w.out, "  %d) %s\n", i+1, option)
+	}
+	answer, err := w.ask("Choice", strconv.Itoa(def+1), func(answer string) error {
+		if n, err := strconv.Atoi(answer); err != nil || n < 1 || n > len(options) {
+			return fmt.Errorf("enter a number between 1 and %d", len(options))
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	n, _ := strconv.Atoi(answer)
+	return n - 1, nil
+}
+
+// confirm asks a yes/no question.
+func (w *wizard) confirm(question string, def bool) (bool, error) {
+	hint := "y/N"
+	if def {
+		hint = "Y/n"
+	}
+	answer, err := w.ask(question+" ("+hint+")", "", nil)
+	if err != nil {
+		return false, err
+	}
+	switch strings.ToLower(answer) {
+	case "y", "yes":
+		return true, nil
+	case "n", "no":
+		return false, nil
+	default:
+		return def, nil
+	}
+}
+
+// readLine reads one answer without its line ending.
+func (w *wizard) readLine() (string, error) {
+	line, err := w.in.ReadString('\n')
+	if err != nil && (err != io.EOF || line == "") {
+		if err == io.EOF {
+			return "", errors.New("input ended before all questions were answered")
+		}
+		return "", fmt.Errorf("failed to read answer: %w", err)
+	}
+	return strings.TrimSpace(line), nil
+}
@@ -0,0 +1,83 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"tunn/pkg/config"
+	"tunn/pkg/ssh"
+
+	"golang.org/x/term"
+)
+
+// maxStdinSecret bounds the credentials read from standard input.
+const maxStdinSecret = 64 << 10
+
+var (
+	passwordStdin bool
+	keyStdin      bool
+)
+
+// init registers the flags reading SSH credentials from standard input.
+func init() {
+	rootCmd.PersistentFlags().BoolVar(&passwordStdin, "ssh-password-stdin", false, "read the SSH password from standard input instead of ssh.password")
+	rootCmd.PersistentFlags().BoolVar(&keyStdin, "ssh-key-stdin", false, "read an unencrypted SSH private key from standard input")
+}
+
+// readStdinCredentials reads the SSH password or private key from standard
+// input when asked to, and has every configuration loaded afterwards use it.
+//
+// A password is read up to the first line break, or asked for without echo
+// when standard input is a terminal. A key is read to the end of input.
+//
+// Returns:
+//   - error: An error if both are requested, reading fails or the key is invalid
+func readStdinCredentials() error {
+	if !passwordStdin && !keyStdin {
+		return nil
+	}
+	if passwordStdin && keyStdin {
+		return fmt.Errorf("--ssh-password-stdin and --ssh-key-stdin cannot be used together, standard input holds only one")
+	}
+	fd := int(os.Stdin.Fd())
+
+	if passwordStdin {
+		var password string
+		if term.IsTerminal(fd) {
+			fmt.Fprint(os.Stderr, "SSH password: ")
+			answer, err := term.ReadPassword(fd)
+			fmt.Fprintln(os.Stderr)
+			if err != nil {
+				return fmt.Errorf("failed to read the SSH password: %w", err)
+			}
+			password = string(answer)
+		} else {
+			data, err := io.ReadAll(io.LimitReader(os.Stdin, maxStdinSecret))
+			if err != nil {
+				return fmt.Errorf("failed to read the SSH password from standard input: %w", err)
+			}
+			password, _, _ = strings.Cut(string(data), "\n")
+			password = strings.TrimSuffix(password, "\r")
+		}
+		if password == "" {
+			return fmt.Errorf("no SSH password on standard input")
+		}
+		config.SetCredentials(password, "")
+		return nil
+	}
+
+	if term.IsTerminal(fd) {
+		return fmt.Errorf("--ssh-key-stdin expects the key piped or redirected to standard input")
+	}
+	data, err := io.ReadAll(io.LimitReader(os.Stdin, maxStdinSecret))
+	if err != nil {
+		return fmt.Errorf("failed to read the SSH private key from standard input: %w", err)
+	}
+	if _, err := ssh.ParsePrivateKey(data); err != nil {
+		return err
+	}
+	config.SetCredentials("", string(data))
+	return nil
+}
@@ -0,0 +1,55 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"tunn/pkg/control"
+
+	"github.com/spf13/cobra"
+)
+
+// debugCmd represents the debug command.
+// It switches debug logging of a running tunnel through its local control
+// API, for systems without SIGUSR1 or tunnels running under another user.
+var debugCmd = &cobra.Command{
+	Use:       "debug [on|off]",
+	Short:     "Switch debug logging of a running tunnel on or off",
+	Long:      "Switch debug logging of a running tunnel on or off through its control API, or toggle it without an argument.\nOn Unix, sending SIGUSR1 to the tunnel process toggles it as well.",
+	Args:      cobra.MatchAll(cobra.MaximumNArgs(1), cobra.OnlyValidArgs),
+	ValidArgs: []string{"on", "off"},
+	Run:       setDebug,
+}
+
+// debugFlags holds the command-line flags for the debug command.
+var debugFlags struct {
+	address string
+}
+
+// init registers the debug command and its flags.
+func init() {
+	rootCmd.AddCommand(debugCmd)
+
+	debugCmd.Flags().StringVar(&debugFlags.address, "address", "", "control API address (default: control.address from the config file)")
+}
+
+// setDebug switches debug logging and prints the resulting state.
+func setDebug(cmd *cobra.Command, args []string) {
+	address := controlAddress(debugFlags.address)
+
+	enabled := ""
+	if len(args) == 1 {
+		enabled = map[string]string{"on": "true", "off": "false"}[args[0]]
+	}
+	on, err := control.SetDebug(address, enabled)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	if on {
+		fmt.Println("Debug logging is on")
+	} else {
+		fmt.Println("Debug logging is off")
+	}
+}
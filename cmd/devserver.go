@@ -0,0 +1,87 @@
+package cmd
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
+
+	"tunn/pkg/devserver"
+
+	"github.com/spf13/cobra"
+)
+
+// devserverCmd represents the devserver command.
+// It runs a local WebSocket-upgrade-capable test server with configurable
+// responses so payloads can be developed without a real server.
+var devserverCmd = &cobra.Command{
+	Use:   "devserver",
+	Short: "Run a local test server for developing payloads",
+	Long: `Run a local test server for developing payloads.
+
+Every request head is printed exactly as received. The server answers with the
+configured status: 101 (WebSocket upgrade, default), a 2xx status, a 3xx
+redirect or any error status, optionally after a delay. Upgraded and 2xx
+connections are relayed to --forward (for example a local SSH server) or
+echoed back when no forward address is given.
+
+Point a config at it with ssh.host 127.0.0.1 and ssh.port set to --port.`,
+	Run: runDevserver,
+}
+
+// devserverFlags holds the command-line flags for the devserver command.
+var devserverFlags struct {
+	listen   string
+	port     int
+	status   int
+	location string
+	delay    time.Duration
+	accept   string
+	forward  string
+}
+
+// init registers the devserver command and its flags.
+func init() {
+	rootCmd.AddCommand(devserverCmd)
+
+	devserverCmd.Flags().StringVar(&devserverFlags.listen, "listen", "127.0.0.1", "address to listen on")
+	devserverCmd.Flags().IntVar(&devserverFlags.port, "port", 8880, "port to listen on")
+	devserverCmd.Flags().IntVar(&devserverFlags.status, "status", 101, "response status code, e.g. 101, 200, 302 or 403")
+	devserverCmd.Flags().StringVar(&devserverFlags.location, "location", "", "Location header for 3xx responses")
+	devserverCmd.Flags().DurationVar(&devserverFlags.delay, "delay", 0, "delay before sending the response headers, e.g. 5s")
+	devserverCmd.Flags().StringVar(&devserverFlags.accept, "accept", devserver.AcceptAuto, "Sec-WebSocket-Accept in 101 responses: auto, none or wrong")
+	devserverCmd.Flags().StringVar(&devserverFlags.forward, "forward", "", "relay upgraded connections to this address (e.g. 127.0.0.1:22) instead of echoing")
+}
+
+// runDevserver starts the test server and runs it until interrupted.
+func runDevserver(cmd *cobra.Command, args []string) {
+	address := net.JoinHostPort(devserverFlags.listen, strconv.Itoa(devserverFlags.port))
+	server, err := devserver.Start(address, devserver.Options{
+		Status:   devserverFlags.status,
+		Location: devserverFlags.location,
+		Delay:    devserverFlags.delay,
+		Accept:   devserverFlags.accept,
+		Forward:  devserverFlags.forward,
+	})
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	target := "echo"
+	if devserverFlags.forward != "" {
+		target = devserverFlags.forward
+	}
+	fmt.Printf("✓ Test server listening on %s (status %d, relay: %s)\n", server.Addr(), devserverFlags.status, target)
+
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+	<-sigChan
+
+	fmt.Println("\n→ Shutdown signal received, stopping...")
+	server.Close()
+	fmt.Println("✓ Stopped.")
+}
@@ -0,0 +1,173 @@
+package cmd
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"tunn/internal/tunnel"
+	"tunn/pkg/expose"
+	"tunn/pkg/redact"
+
+	"github.com/spf13/cobra"
+)
+
+// exposeCmd represents the expose command.
+// It publishes local services on the SSH server through a remote forward.
+var exposeCmd = &cobra.Command{
+	Use:   "expose <target>... --as [host:]port",
+	Short: "Publish local services on a port of the SSH server",
+	Long: `Publish local services on a port of the SSH server, like a self-hosted ngrok.
+
+A target is a local port ("3000"), an address ("192.168.1.5:80") or, to share
+one server port between several web services, a hostname route
+("app.example.com=3000"). With hostname routes, each connection goes to the
+target for the Host header of its first request, and to a plain target, if
+given, when no route matches.
+
+--as names the server port and, optionally, the address it is reached at.
+The port is bound on all interfaces of the server unless the host is an IP
+address or "localhost"; OpenSSH servers need "GatewayPorts clientspecified"
+(or "yes") to bind anything but loopback.`,
+	Args: cobra.MinimumNArgs(1),
+	Run:  runExpose,
+}
+
+// exposeFlags holds the command-line flags for the expose command.
+var exposeFlags struct {
+	as string
+}
+
+// init registers the expose command and its flags.
+func init() {
+	rootCmd.AddCommand(exposeCmd)
+
+	exposeCmd.Flags().StringVar(&exposeFlags.as, "as", "", "server port to publish on, as [host:]port (required)")
+	exposeCmd.MarkFlagRequired("as")
+}
+
+// runExpose connects to the SSH server and forwards connections made to the
+// published port until interrupted or the SSH connection is lost.
+func runExpose(cmd *cobra.Command, args []string) {
+	routes, err := parseExposeTargets(args)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	publicHost, bind, err := parseExposeAddress(exposeFlags.as)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	cfg, err := loadConfig(configFile)
+	if err != nil {
+		fmt.Printf("Error: Failed to load config: %v\n", err)
+		os.Exit(1)
+	}
+	forwarder, err := expose.NewForwarder(routes, time.Duration(cfg.ConnectionTimeout)*time.Second)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	client, err := tunnel.Connect(cfg)
+	if err != nil {
+		fmt.Printf("Error: %s\n", redact.Text(err.Error()))
+		os.Exit(1)
+	}
+	defer client.Close()
+
+	listener, err := client.Listen("tcp", bind)
+	if err != nil {
+		fmt.Printf("Error: Server refused to listen on %s: %v\n", bind, err)
+		os.Exit(1)
+	}
+	go forwarder.Serve(listener)
+
+	lost := make(chan error, 1)
+	go func() {
+		lost <- client.Wait()
+	}()
+
+	_, port, _ := net.SplitHostPort(listener.Addr().String())
+	fmt.Println()
+	for _, r := range routes {
+		if r.Host != "" {
+			fmt.Printf("✓ http://%s/ → %s\n", net.JoinHostPort(r.Host, port), r.Target)
+		} else {
+			fmt.Printf("✓ %s → %s\n", net.JoinHostPort(publicHost, port), r.Target)
+		}
+	}
+
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(sigChan)
+
+	select {
+	case <-sigChan:
+		fmt.Println("\n→ Shutdown signal received, stopping...")
+		listener.Close()
+		fmt.Println("✓ Stopped.")
+	case err := <-lost:
+		fmt.Printf("✗ SSH connection lost: %s\n", redact.Text(fmt.Sprint(err)))
+		client.Close()
+		os.Exit(1)
+	}
+}
+
+// parseExposeTargets parses the expose targets into routes.
+//
+// A bare port means a service on 127.0.0.1, and "name=target" routes requests
+// for a hostname.
+func parseExposeTargets(args []string) ([]expose.Route, error) {
+	routes := make([]expose.Route, 0, len(args))
+	for _, arg := range args {
+		host, target, found := strings.Cut(arg, "=")
+		if !found {
+			host, target = "", arg
+		} else if host == "" {
+			return nil, fmt.Errorf("invalid target '%s': missing hostname before '='", arg)
+		}
+		if _, err := strconv.Atoi(target); err == nil {
+			target = net.JoinHostPort("127.0.0.1", target)
+		}
+		if _, port, err := net.SplitHostPort(target); err != nil || port == "" {
+			return nil, fmt.Errorf("invalid target '%s': must be a port or host:port", arg)
+		}
+		routes = append(routes, expose.Route{Host: strings.ToLower(host), Target: target})
+	}
+	return routes, nil
+}
+
+// parseExposeAddress parses the --as address.
+//
+// Returns:
+//   - string: The host clients reach the port at, for display
+//   - string: The address to bind on the server
+//   - error: An error if the address is invalid
+func parseExposeAddress(as string) (string, string, error) {
+	host, port, err := net.SplitHostPort(as)
+	if err != nil {
+		host, port = "", as
+	}
+	if n, err := strconv.Atoi(port); err != nil || n < 0 || n > 65535 {
+		return "", "", fmt.Errorf("invalid --as '%s': must be [host:]port", as)
+	}
+
+	bind := "0.0.0.0"
+	switch {
+	case host == "localhost":
+		bind = "127.0.0.1"
+	case net.ParseIP(host) != nil:
+		bind = host
+	case host == "":
+		host = "<server>"
+	}
+	return host, net.JoinHostPort(bind, port), nil
+}
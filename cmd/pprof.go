@@ -0,0 +1,96 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"tunn/pkg/control"
+
+	"github.com/spf13/cobra"
+)
+
+// pprofProfiles maps the profile names accepted by the pprof command to the
+// names served by the control API.
+var pprofProfiles = map[string]string{
+	"cpu":          "profile",
+	"heap":         "heap",
+	"allocs":       "allocs",
+	"goroutine":    "goroutine",
+	"block":        "block",
+	"mutex":        "mutex",
+	"threadcreate": "threadcreate",
+	"trace":        "trace",
+}
+
+// pprofCmd represents the pprof command.
+// It saves a runtime profile of a running tunnel, captured through its local
+// control API, for reports of high CPU or memory use.
+var pprofCmd = &cobra.Command{
+	Use:   "pprof [cpu|heap|allocs|goroutine|block|mutex|threadcreate|trace]",
+	Short: "Save a runtime profile of a running tunnel",
+	Long: "Save a runtime profile of a running tunnel, captured through its control API, which serves profiles\n" +
+		"when control.pprof is set in its config. A CPU profile (the default) or trace is collected for --seconds;\n" +
+		"the other profiles are snapshots. Inspect the file with \"go tool pprof\" or attach it to a bug report.",
+	Args:      cobra.MatchAll(cobra.MaximumNArgs(1), cobra.OnlyValidArgs),
+	ValidArgs: []string{"cpu", "heap", "allocs", "goroutine", "block", "mutex", "threadcreate", "trace"},
+	Run:       saveProfile,
+}
+
+// pprofFlags holds the command-line flags for the pprof command.
+var pprofFlags struct {
+	address string
+	seconds int
+	output  string
+}
+
+// init registers the pprof command and its flags.
+func init() {
+	rootCmd.AddCommand(pprofCmd)
+
+	pprofCmd.Flags().StringVar(&pprofFlags.address, "address", "", "control API address (default: control.address from the config file)")
+	pprofCmd.Flags().IntVar(&pprofFlags.seconds, "seconds", 30, "how long a CPU profile or trace is collected")
+	pprofCmd.Flags().StringVarP(&pprofFlags.output, "output", "o", "", "file to write (default: tunn-<profile>-<time>.pprof)")
+}
+
+// saveProfile captures a profile of a running tunnel and writes it to a file.
+func saveProfile(cmd *cobra.Command, args []string) {
+	name := "cpu"
+	if len(args) == 1 {
+		name = args[0]
+	}
+	if pprofFlags.seconds < 1 {
+		fmt.Println("Error: --seconds must be at least 1")
+		os.Exit(1)
+	}
+	address := controlAddress(pprofFlags.address)
+
+	output := pprofFlags.output
+	if output == "" {
+		ext := ".pprof"
+		if name == "trace" {
+			ext = ".trace"
+		}
+		output = fmt.Sprintf("tunn-%s-%s%s", name, time.Now().Format("20060102-150405"), ext)
+	}
+
+	if name == "cpu" || name == "trace" {
+		fmt.Printf("→ Collecting %s for %d seconds...\n", name, pprofFlags.seconds)
+	}
+	data, err := control.FetchProfile(address, pprofProfiles[name], pprofFlags.seconds)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	if err := os.WriteFile(output, data, 0644); err != nil {
+		fmt.Printf("Error: Failed to write profile: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("✓ Saved %s profile to %s\n", name, output)
+	if name == "trace" {
+		fmt.Printf("View it with: go tool trace %s\n", output)
+	} else {
+		fmt.Printf("View it with: go tool pprof -top %s\n", output)
+	}
+}
@@ -0,0 +1,164 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"tunn/pkg/config"
+	"tunn/pkg/presets"
+
+	"github.com/spf13/cobra"
+)
+
+// presetCmd represents the preset command and its subcommands.
+// It manages the catalog of known-good payload and SNI combinations.
+var presetCmd = &cobra.Command{
+	Use:   "preset",
+	Short: "Connection presets for common network types",
+}
+
+// presetListCmd represents the preset list command.
+// It prints the built-in and user presets.
+var presetListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List available presets",
+	Run:   listPresets,
+}
+
+// presetUseCmd represents the preset use command.
+// It applies a preset to the configuration file.
+var presetUseCmd = &cobra.Command{
+	Use:   "use <name>",
+	Short: "Apply a preset to the configuration file",
+	Long: `Apply a preset to the configuration file given with -c.
+
+If the file exists only the mode, port, payload and TLS settings are replaced;
+credentials and all other settings are kept. Otherwise a sample configuration
+seeded from the preset is created.`,
+	Args: cobra.ExactArgs(1),
+	Run:  usePreset,
+}
+
+// init registers the preset command and its subcommands.
+func init() {
+	rootCmd.AddCommand(presetCmd)
+	presetCmd.AddCommand(presetListCmd)
+	presetCmd.AddCommand(presetUseCmd)
+}
+
+// listPresets prints all presets with their network type and description.
+func listPresets(cmd *cobra.Command, args []string) {
+	list, err := presets.Load()
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tNETWORK\tMODE\tPORT\tSOURCE\tDESCRIPTION")
+	for _, p := range list {
+		source := "user"
+		if p.BuiltIn {
+			source = "built-in"
+		}
+		network := p.Network
+		if network == "" {
+			network = "-"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%s\t%s\n", p.Name, network, p.Mode, p.Port, source, p.Description)
+	}
+	w.Flush()
+
+	if path, err := presets.UserCatalogPath(); err == nil {
+		fmt.Printf("\nAdd your own presets to %s\n", path)
+	}
+}
+
+// usePreset applies the named preset to the configuration file.
+func usePreset(cmd *cobra.Command, args []string) {
+	preset, err := presets.Find(args[0])
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	if config.IsRemote(configFile) {
+		fmt.Println("Error: Presets can only be applied to a local configuration file")
+		os.Exit(1)
+	}
+	if config.Format(configFile) != config.FormatJSON {
+		if _, err := os.Stat(configFile); err == nil {
+			fmt.Println("Error: Presets can only be applied to JSON configuration files, since rewriting would drop comments")
+			os.Exit(1)
+		}
+	}
+
+	data, err := os.ReadFile(configFile)
+	if errors.Is(err, os.ErrNotExist) {
+		sampleConfig, err := newSampleConfig(preset.Mode)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		preset.Apply(sampleConfig)
+		if err := writeConfigFile(configFile, sampleConfig); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Success: Sample configuration from preset '%s' generated: %s\n", preset.Name, configFile)
+		return
+	}
+	if err != nil {
+		fmt.Printf("Error: Failed to read config file: %v\n", err)
+		os.Exit(1)
+	}
+
+	// Merge into the raw document so settings unknown to this version are kept
+	var doc map[string]interface{}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		fmt.Printf("Error: Failed to parse config file: %v\n", err)
+		os.Exit(1)
+	}
+	mergeSettings(doc, preset.Settings())
+	if preset.ServerName == "" {
+		deleteSetting(doc, "tls", "serverName")
+	}
+	if len(preset.ALPN) == 0 {
+		deleteSetting(doc, "tls", "alpn")
+	}
+
+	if err := writeConfigFile(configFile, doc); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("Success: Preset '%s' applied to %s\n", preset.Name, configFile)
+	if preset.Mode == "proxy" && preset.ProxyHost == "" {
+		fmt.Println("Note: Set proxyHost to your network's HTTP proxy")
+	}
+	if strings.Contains(preset.HTTPPayload, "[host]") {
+		fmt.Println("Note: [host] in the payload is replaced with ssh.host when connecting")
+	}
+}
+
+// mergeSettings copies src into dst, merging nested objects key by key.
+func mergeSettings(dst, src map[string]interface{}) {
+	for key, value := range src {
+		if nested, ok := value.(map[string]interface{}); ok {
+			if existing, ok := dst[key].(map[string]interface{}); ok {
+				mergeSettings(existing, nested)
+				continue
+			}
+		}
+		dst[key] = value
+	}
+}
+
+// deleteSetting removes a key from a nested object, if present.
+func deleteSetting(doc map[string]interface{}, section, key string) {
+	if nested, ok := doc[section].(map[string]interface{}); ok {
+		delete(nested, key)
+	}
+}
@@ -0,0 +1,260 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"text/tabwriter"
+
+	"tunn/pkg/config"
+
+	"github.com/spf13/cobra"
+)
+
+// profileCmd represents the profile command and its subcommands.
+// It manages the profile files in the profiles directory, each a partial
+// configuration selected with --profile like the profiles of the config file.
+var profileCmd = &cobra.Command{
+	Use:   "profile",
+	Short: "Manage profiles kept as separate files",
+}
+
+// profileListCmd represents the profile list command.
+// It prints the profiles of the config file and the profiles directory.
+var profileListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List available profiles",
+	Args:  cobra.NoArgs,
+	Run:   listProfiles,
+}
+
+// profileAddCmd represents the profile add command.
+// It stores a profile document as a file in the profiles directory.
+var profileAddCmd = &cobra.Command{
+	Use:   "add <name> [file]",
+	Short: "Add a profile from a file or standard input",
+	Long: `Add a profile to the profiles directory from a JSON, YAML or TOML file, or
+from JSON on standard input when no file or "-" is given.
+
+A profile holds the settings that differ from the config file given with -c,
+which it is merged over when selected with --profile. It is only added if
+the resulting configuration is valid.`,
+	Args: cobra.RangeArgs(1, 2),
+	Run:  addProfile,
+}
+
+// profileEditCmd represents the profile edit command.
+// It opens a profile file in the user's editor and validates it afterwards.
+var profileEditCmd = &cobra.Command{
+	Use:   "edit <name>",
+	Short: "Edit a profile in $VISUAL or $EDITOR",
+	Args:  cobra.ExactArgs(1),
+	Run:   editProfile,
+}
+
+// profileRemoveCmd represents the profile remove command.
+// It deletes a profile file from the profiles directory.
+var profileRemoveCmd = &cobra.Command{
+	Use:     "remove <name>",
+	Aliases: []string{"rm"},
+	Short:   "Remove a profile from the profiles directory",
+	Args:    cobra.ExactArgs(1),
+	Run:     removeProfile,
+}
+
+// profileFlags holds the command-line flags for the profile subcommands.
+var profileFlags struct {
+	force bool
+}
+
+// init registers the profile command, its subcommands and their flags.
+func init() {
+	rootCmd.AddCommand(profileCmd)
+	profileCmd.AddCommand(profileListCmd)
+	profileCmd.AddCommand(profileAddCmd)
+	profileCmd.AddCommand(profileEditCmd)
+	profileCmd.AddCommand(profileRemoveCmd)
+
+	profileAddCmd.Flags().BoolVarP(&profileFlags.force, "force", "f", false, "replace an existing profile file")
+}
+
+// listProfiles prints the profiles of the config file and of the profiles
+// directory with where each is defined.
+func listProfiles(cmd *cobra.Command, args []string) {
+	path := configFile
+	if config.IsRemote(path) {
+		cached, err := config.FetchRemote(path, config.FetchOptions{SHA256: configSHA256, PublicKey: configPubKey})
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		path = cached
+	}
+	inline, err := config.Profiles(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	files, err := config.ProfileFiles()
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	dir, _ := config.ProfileDir()
+	if len(inline) == 0 && len(files) == 0 {
+		fmt.Println("No profiles defined")
+	} else {
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "NAME\tSOURCE")
+		for _, name := range inline {
+			fmt.Fprintf(w, "%s\t%s\n", name, configFile)
+		}
+		for _, name := range files {
+			source := filepath.Join(dir, name+".json")
+			if slices.Contains(inline, name) {
+				source += " (overridden by " + configFile + ")"
+			}
+			fmt.Fprintf(w, "%s\t%s\n", name, source)
+		}
+		w.Flush()
+	}
+	if dir != "" {
+		fmt.Printf("\nAdd profiles with \"tunn profile add\" or as files in %s\n", dir)
+	}
+}
+
+// addProfile stores a profile from a file or standard input in the profiles
+// directory, keeping it only if the configuration it selects is valid.
+func addProfile(cmd *cobra.Command, args []string) {
+	name := args[0]
+	path, err := config.ProfilePath(name)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	if _, err := os.Stat(path); err == nil && !profileFlags.force {
+		fmt.Printf("Error: Profile '%s' already exists: %s (use --force to replace it)\n", name, path)
+		os.Exit(1)
+	}
+
+	source := "-"
+	if len(args) == 2 {
+		source = args[1]
+	}
+	var data []byte
+	if source == "-" {
+		data, err = io.ReadAll(os.Stdin)
+		source = "stdin.json"
+	} else {
+		data, err = os.ReadFile(source)
+	}
+	if err != nil {
+		fmt.Printf("Error: Failed to read profile: %v\n", err)
+		os.Exit(1)
+	}
+	doc, err := config.ParseProfile(source, data)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	previous, _ := os.ReadFile(path)
+	if err := writeProfile(path, doc); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	if _, err := loadProfile(configFile, name); err != nil {
+		// Leave a replaced profile as it was
+		if previous != nil {
+			os.WriteFile(path, previous, 0600)
+		} else {
+			os.Remove(path)
+		}
+		fmt.Printf("Error: Profile not added, the configuration it selects is invalid: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("Success: Profile '%s' added: %s\n", name, path)
+	fmt.Printf("Use it with: tunn --profile %s\n", name)
+}
+
+// editProfile opens a profile file in the user's editor and validates the
+// configuration it selects once the editor is closed.
+func editProfile(cmd *cobra.Command, args []string) {
+	name := args[0]
+	path, err := config.ProfilePath(name)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	if _, err := os.Stat(path); err != nil {
+		fmt.Printf("Error: No profile file '%s' in %s; create it with \"tunn profile add %s\"\n", name, filepath.Dir(path), name)
+		os.Exit(1)
+	}
+
+	editor := strings.Fields(os.Getenv("VISUAL"))
+	if len(editor) == 0 {
+		editor = strings.Fields(os.Getenv("EDITOR"))
+	}
+	if len(editor) == 0 {
+		editor = []string{"vi"}
+		if runtime.GOOS == "windows" {
+			editor = []string{"notepad"}
+		}
+	}
+	editCmd := exec.Command(editor[0], append(editor[1:], path)...)
+	editCmd.Stdin, editCmd.Stdout, editCmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	if err := editCmd.Run(); err != nil {
+		fmt.Printf("Error: Editor failed: %v\n", err)
+		os.Exit(1)
+	}
+
+	if _, err := loadProfile(configFile, name); err != nil {
+		fmt.Printf("Error: Profile '%s' selects an invalid configuration: %v\n", name, err)
+		fmt.Printf("Run \"tunn profile edit %s\" again to fix it\n", name)
+		os.Exit(1)
+	}
+	fmt.Printf("Success: Profile '%s' saved and valid\n", name)
+}
+
+// removeProfile deletes a profile file from the profiles directory.
+func removeProfile(cmd *cobra.Command, args []string) {
+	name := args[0]
+	path, err := config.ProfilePath(name)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	if err := os.Remove(path); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			fmt.Printf("Error: No profile file '%s' in %s; profiles in the config file are removed by editing it\n", name, filepath.Dir(path))
+		} else {
+			fmt.Printf("Error: Failed to remove profile: %v\n", err)
+		}
+		os.Exit(1)
+	}
+	fmt.Printf("Success: Profile '%s' removed\n", name)
+}
+
+// writeProfile writes a profile document as indented JSON, readable only by
+// the user since profiles may hold credentials.
+func writeProfile(path string, doc map[string]interface{}) error {
+	data, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal profile: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("failed to create profiles directory: %w", err)
+	}
+	if err := os.WriteFile(path, append(data, '\n'), 0600); err != nil {
+		return fmt.Errorf("failed to write profile: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,81 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"tunn/pkg/control"
+	"tunn/pkg/redact"
+
+	"github.com/spf13/cobra"
+)
+
+// reloadCmd represents the reload command.
+// It makes a running tunnel load its configuration file again through its
+// local control API, for systems without SIGHUP or tunnels running under
+// another user.
+var reloadCmd = &cobra.Command{
+	Use:   "reload",
+	Short: "Make a running tunnel apply changes to its configuration file",
+	Long:  "Make a running tunnel load its configuration file again through its control API and apply the changes,\nrestarting only the listeners and transports whose settings changed.\nOn Unix, sending SIGHUP to the tunnel process reloads it as well.\nWith --dry-run, only print what would be changed and restarted.",
+	Args:  cobra.NoArgs,
+	Run:   reloadTunnel,
+}
+
+// reloadFlags holds the command-line flags for the reload command.
+var reloadFlags struct {
+	address string
+	dryRun  bool
+}
+
+// init registers the reload command and its flags.
+func init() {
+	rootCmd.AddCommand(reloadCmd)
+
+	reloadCmd.Flags().StringVar(&reloadFlags.address, "address", "", "control API address (default: control.address from the config file)")
+	reloadCmd.Flags().BoolVar(&reloadFlags.dryRun, "dry-run", false, "print what a reload would change and restart without applying it")
+}
+
+// reloadTunnel asks the running tunnel to reload and reports the outcome.
+func reloadTunnel(cmd *cobra.Command, args []string) {
+	address := controlAddress(reloadFlags.address)
+
+	if reloadFlags.dryRun {
+		plan, err := control.PlanReload(address)
+		if err != nil {
+			fmt.Printf("Error: %v\n", redact.Text(err.Error()))
+			os.Exit(1)
+		}
+		printReloadPlan(plan)
+		return
+	}
+
+	if err := control.Reload(address); err != nil {
+		fmt.Printf("Error: %v\n", redact.Text(err.Error()))
+		os.Exit(1)
+	}
+	fmt.Println("Configuration reloaded")
+}
+
+// printReloadPlan prints what a reload changes and restarts.
+func printReloadPlan(plan *control.ReloadPlan) {
+	if len(plan.Changed) == 0 {
+		fmt.Println("No changes; a reload would leave the tunnel as it is")
+		return
+	}
+	fmt.Printf("Changed settings: %s\n", strings.Join(plan.Changed, ", "))
+	fmt.Println("A reload would:")
+	if plan.Transports {
+		fmt.Println("   - re-establish the SSH transports, switching over once connected")
+	}
+	for _, listener := range plan.Restart {
+		fmt.Printf("   - restart the %s\n", listener)
+	}
+	if !plan.Transports && len(plan.Restart) == 0 && len(plan.Fixed) < len(plan.Changed) {
+		fmt.Println("   - apply the changes without restarting anything")
+	}
+	for _, section := range plan.Fixed {
+		fmt.Printf("   - keep the running %s settings; they take effect after a restart\n", section)
+	}
+}
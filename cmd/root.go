@@ -8,12 +8,24 @@ package cmd
 import (
 	"context"
 	"fmt"
+	"net"
 	"os"
+	"strings"
 
 	"tunn/internal/tunnel"
+	"tunn/pkg/color"
 	"tunn/pkg/config"
+	"tunn/pkg/debuglog"
+	"tunn/pkg/hostkey"
+	"tunn/pkg/i18n"
+	"tunn/pkg/preflight"
+	"tunn/pkg/privileges"
+	"tunn/pkg/progress"
+	"tunn/pkg/redact"
+	"tunn/pkg/ssh"
 
 	"github.com/spf13/cobra"
+	"golang.org/x/term"
 )
 
 // contextKey is a custom type for context keys to avoid collisions
@@ -29,11 +41,36 @@ var rootCmd = &cobra.Command{
 	Version: "v0.1.2",
 
 	PreRunE: func(cmd *cobra.Command, args []string) error {
-		cfg, err := config.LoadConfig(configFile)
+		cfg, err := loadConfig(configFile)
 		if err != nil {
 			return fmt.Errorf("failed to load config: %w", err)
 		}
 
+		// Command-line switches take precedence over the config file
+		if overTor {
+			cfg.Tor.OverTor = true
+		}
+		if toTor {
+			cfg.Tor.ToTor = true
+		}
+		if preferIPv4 {
+			cfg.Connect.Prefer = "ipv4"
+		}
+		if preferIPv6 {
+			cfg.Connect.Prefer = "ipv6"
+		}
+		if bindHost != "" {
+			// IPv6 addresses may be given in brackets, as in URLs
+			bindHost = strings.TrimSuffix(strings.TrimPrefix(bindHost, "["), "]")
+			if net.ParseIP(bindHost) == nil {
+				return fmt.Errorf("invalid --bind '%s', must be an IP address", bindHost)
+			}
+			cfg.Listener.Host = bindHost
+		}
+		if err := addForwards(cfg); err != nil {
+			return err
+		}
+
 		// Store config in context for Run
 		cmd.SetContext(context.WithValue(cmd.Context(), configKey, cfg))
 		return nil
@@ -45,10 +82,80 @@ var rootCmd = &cobra.Command{
 		if !ok {
 			return fmt.Errorf("failed to retrieve config from context")
 		}
+		switch statusDisplay {
+		case "", "line", "title":
+		default:
+			return fmt.Errorf("invalid --status '%s', must be one of: line, title", statusDisplay)
+		}
+		switch summaryFormat {
+		case "text", "json", "off":
+		default:
+			return fmt.Errorf("invalid --summary '%s', must be one of: text, json, off", summaryFormat)
+		}
 
-		fmt.Printf("Mode: %s\n\n", cfg.Mode)
+		i18n.Printf("Mode: %s\n\n", cfg.Mode)
 
-		manager := tunnel.NewManager(cfg)
+		var ports []int
+		for _, l := range cfg.ProxyListeners() {
+			ports = append(ports, l.Port)
+		}
+		for _, conflict := range preflight.Check(ports) {
+			fmt.Printf("%s %s\n  → %s\n", color.Glyph("✗"), conflict.Message, conflict.Remedy)
+		}
+		if ip := net.ParseIP(bindHost); ip != nil && !ip.IsLoopback() && len(cfg.Listener.Allow) == 0 {
+			fmt.Printf("%s The proxy listens on %s without listener.allow, so anyone who can reach the port can use the tunnel\n", color.Glyph("✗"), bindHost)
+		}
+
+		if statusDisplay != "" && !term.IsTerminal(int(os.Stderr.Fd())) {
+			statusDisplay = ""
+		}
+
+		opts := tunnel.Options{
+			StatusDisplay: statusDisplay,
+			Summary:       summaryFormat,
+			Reload: func() (*config.Config, error) {
+				cfg, err := loadConfig(configFile)
+				if err != nil {
+					return nil, err
+				}
+				cfg.Tor.OverTor = cfg.Tor.OverTor || overTor
+				cfg.Tor.ToTor = cfg.Tor.ToTor || toTor
+				if preferIPv4 {
+					cfg.Connect.Prefer = "ipv4"
+				}
+				if preferIPv6 {
+					cfg.Connect.Prefer = "ipv6"
+				}
+				if bindHost != "" {
+					cfg.Listener.Host = bindHost
+				}
+				if err := addForwards(cfg); err != nil {
+					return nil, err
+				}
+				return cfg, nil
+			},
+		}
+		if runAs != "" {
+			id, err := privileges.Lookup(runAs)
+			if err != nil {
+				return fmt.Errorf("invalid --run-as: %w", err)
+			}
+			opts.RunAs = &id
+		}
+		if sandboxMode {
+			if hook := cfg.Hooks.PreConnect; hook != nil && hook.Command != "" {
+				return fmt.Errorf("--sandbox blocks running programs and cannot be used with hooks.preConnect.command")
+			}
+			opts.Sandbox = true
+		}
+		if len(cfg.Schedule) > 0 {
+			if opts.RunAs != nil {
+				return fmt.Errorf("--run-as cannot be used with a schedule, which binds the listeners again for every window")
+			}
+			return tunnel.RunScheduled(cfg, opts)
+		}
+
+		manager := tunnel.NewManager(cfg, opts)
 		if err := manager.Start(); err != nil {
 			return fmt.Errorf("failed to start tunnel: %w", err)
 		}
@@ -56,20 +163,144 @@ var rootCmd = &cobra.Command{
 	},
 }
 
-var configFile string
+var (
+	configFile    string
+	configSHA256  string
+	configPubKey  string
+	profileName   string
+	statusDisplay string
+	summaryFormat string
+	overTor       bool
+	toTor         bool
+	bindHost      string
+	preferIPv4    bool
+	preferIPv6    bool
+	forwardSpecs  []string
+	showSecrets   bool
+	logFormat     string
+	language      string
+	runAs         string
+	sandboxMode   bool
+	insecureKey   bool
+	debugMode     bool
+)
 
 // init initializes the root command with persistent flags and configuration.
 func init() {
-	rootCmd.PersistentFlags().StringVarP(&configFile, "config", "c", "config.json", "config file path")
+	rootCmd.PersistentFlags().StringVarP(&configFile, "config", "c", "config.json", "config file path or https:// URL")
+	rootCmd.PersistentFlags().StringVar(&configSHA256, "config-sha256", "", "expected SHA-256 checksum of a remote config file")
+	rootCmd.PersistentFlags().StringVar(&configPubKey, "config-pubkey", "", "base64 ed25519 public key verifying a remote config signature (<url>.sig)")
+	rootCmd.PersistentFlags().StringVarP(&profileName, "profile", "p", "", "named profile from the config file or the profiles directory to use")
+	rootCmd.Flags().StringVar(&statusDisplay, "status", "", "live statistics display on interactive terminals: line or title")
+	rootCmd.Flags().StringVar(&summaryFormat, "summary", "text", "client settings printed once the tunnel is established: text, json or off")
+	rootCmd.Flags().BoolVar(&overTor, "over-tor", false, "dial the SSH/proxy server through the local Tor SOCKS proxy")
+	rootCmd.Flags().BoolVar(&toTor, "to-tor", false, "forward proxied connections into Tor running on the SSH server")
+	rootCmd.Flags().StringVar(&bindHost, "bind", "", "IP address the proxy listens on, overriding listener.host (e.g. 0.0.0.0 or :: to share on the LAN)")
+	rootCmd.Flags().BoolVarP(&preferIPv4, "ipv4", "4", false, "try IPv4 addresses of the SSH/proxy server first, overriding connect.prefer")
+	rootCmd.Flags().BoolVarP(&preferIPv6, "ipv6", "6", false, "try IPv6 addresses of the SSH/proxy server first, overriding connect.prefer")
+	rootCmd.MarkFlagsMutuallyExclusive("ipv4", "ipv6")
+	rootCmd.Flags().StringArrayVar(&forwardSpecs, "forward", nil, "forward a local port through the tunnel, as [L:][bind_address:]port:host:hostport (repeatable)")
+	rootCmd.Flags().StringVar(&runAs, "run-as", "", "when started as root, switch to this user[:group] once listening (Unix only)")
+	rootCmd.Flags().BoolVar(&sandboxMode, "sandbox", false, "once running, block program execution and restrict filesystem access (Linux only)")
+	rootCmd.Flags().BoolVar(&debugMode, "debug", false, "start with debug logging on (toggle it later with SIGUSR1 or \"tunn debug\")")
+	rootCmd.PersistentFlags().BoolVar(&insecureKey, "insecure-hostkey", false, "accept any SSH host key without verification (allows impersonating the server)")
+	rootCmd.PersistentFlags().BoolVar(&showSecrets, "show-secrets", false, "print usernames, passwords and tokens unmasked in output")
+	rootCmd.PersistentFlags().StringVar(&logFormat, "log-format", progress.FormatPretty, "connection output: pretty (one line per phase) or plain (detailed log lines)")
+	rootCmd.PersistentFlags().StringVar(&language, "lang", "", "output language: "+strings.Join(i18n.Languages(), ", ")+" (default from LANG)")
 	rootCmd.CompletionOptions.DisableDefaultCmd = true
 	rootCmd.SetHelpCommand(&cobra.Command{Use: "no-help", Hidden: true})
+
+	// Errors are printed by Execute so they can be redacted
+	rootCmd.SilenceErrors = true
+
+	cobra.OnInitialize(func() {
+		redact.SetShowSecrets(showSecrets)
+		hostkey.SetInsecure(insecureKey)
+		if debugMode {
+			debuglog.SetEnabled(true)
+		}
+		color.SetEnabled(color.Detect(os.Stdout))
+		if err := progress.SetFormat(logFormat); err != nil {
+			printError(err)
+			os.Exit(1)
+		}
+		if language == "" {
+			language = i18n.Detect()
+		}
+		if err := i18n.SetLanguage(language); err != nil {
+			printError(err)
+			os.Exit(1)
+		}
+		if err := readStdinCredentials(); err != nil {
+			printError(err)
+			os.Exit(1)
+		}
+	})
+}
+
+// loadConfig loads a configuration file, fetching and verifying it first when
+// the path is an HTTP(S) URL. Remote files are cached locally so later starts
+// work offline.
+func loadConfig(path string) (*config.Config, error) {
+	return loadProfile(path, profileName)
+}
+
+// loadProfile loads the configuration like loadConfig, with the given profile
+// applied instead of the one selected with --profile.
+func loadProfile(path, profile string) (*config.Config, error) {
+	if config.IsRemote(path) {
+		cached, err := config.FetchRemote(path, config.FetchOptions{
+			SHA256:    configSHA256,
+			PublicKey: configPubKey,
+		})
+		if err != nil {
+			return nil, err
+		}
+		path = cached
+	}
+	return config.LoadProfile(path, profile)
+}
+
+// addForwards appends the forwards given with --forward to those of the
+// configuration.
+func addForwards(cfg *config.Config) error {
+	for _, spec := range forwardSpecs {
+		forward, err := config.ParseForward(spec)
+		if err != nil {
+			return fmt.Errorf("invalid --forward: %w", err)
+		}
+		cfg.Forwards = append(cfg.Forwards, forward)
+	}
+	return nil
 }
 
 // Execute adds all child commands to the root command and sets flags appropriately.
 // This is called by main.main(). It only needs to happen once to the rootCmd.
 func Execute() {
 	if err := rootCmd.Execute(); err != nil {
-		fmt.Println(err)
-		os.Exit(1)
+		printError(fmt.Errorf("%s", redact.Text(err.Error())))
+		os.Exit(exitCode(err))
 	}
 }
+
+// exitCode returns the exit status for an error, telling the ways a server
+// rejects the account apart so scripts can react to them.
+func exitCode(err error) int {
+	rejection := ssh.AsRejection(err)
+	if rejection == nil {
+		return 1
+	}
+	switch rejection.Kind {
+	case ssh.RejectedTooManyLogins:
+		return 3
+	case ssh.RejectedExpired:
+		return 4
+	default:
+		return 5
+	}
+}
+
+// printError prints an error with a translated, highlighted prefix.
+func printError(err error) {
+	fmt.Printf("%s: %v\n", color.Red(i18n.T("Error")), err)
+}
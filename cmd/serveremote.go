@@ -0,0 +1,125 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
+
+	"tunn/internal/tunnel"
+	"tunn/pkg/redact"
+	"tunn/pkg/sftpfs"
+
+	"github.com/spf13/cobra"
+)
+
+// serveRemoteCmd represents the serve-remote command.
+// It exposes a directory on the SSH server as a local read-only HTTP/WebDAV
+// endpoint, reading the files over SFTP through the tunnel.
+var serveRemoteCmd = &cobra.Command{
+	Use:   "serve-remote",
+	Short: "Serve a remote directory locally over HTTP/WebDAV (read-only)",
+	Run:   serveRemote,
+}
+
+// serveRemoteFlags holds the command-line flags for the serve-remote command.
+var serveRemoteFlags struct {
+	remote    string
+	localPort int
+}
+
+// init registers the serve-remote command and its flags.
+func init() {
+	rootCmd.AddCommand(serveRemoteCmd)
+
+	serveRemoteCmd.Flags().StringVar(&serveRemoteFlags.remote, "remote", "", "directory on the SSH server to serve (required)")
+	serveRemoteCmd.Flags().IntVar(&serveRemoteFlags.localPort, "local-port", 8081, "local port for the HTTP/WebDAV endpoint (listens on 127.0.0.1)")
+	serveRemoteCmd.MarkFlagRequired("remote")
+}
+
+// serveRemote connects to the SSH server and serves the remote directory until
+// interrupted or the SSH connection is lost.
+func serveRemote(cmd *cobra.Command, args []string) {
+	cfg, err := loadConfig(configFile)
+	if err != nil {
+		fmt.Printf("Error: Failed to load config: %v\n", err)
+		os.Exit(1)
+	}
+
+	client, err := tunnel.Connect(cfg)
+	if err != nil {
+		fmt.Printf("Error: %s\n", redact.Text(err.Error()))
+		os.Exit(1)
+	}
+	defer client.Close()
+
+	sftpClient, err := client.NewSFTP()
+	if err != nil {
+		fmt.Printf("Error: Failed to start SFTP session: %v\n", err)
+		os.Exit(1)
+	}
+	defer sftpClient.Close()
+
+	fs, err := sftpfs.New(sftpClient, serveRemoteFlags.remote)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	address := net.JoinHostPort("127.0.0.1", strconv.Itoa(serveRemoteFlags.localPort))
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		fmt.Printf("Error: Failed to listen on %s: %v\n", address, err)
+		os.Exit(1)
+	}
+
+	server := &http.Server{
+		Handler: sftpfs.NewHandler(fs, func(method, path string) {
+			fmt.Printf("→ %s %s\n", method, path)
+		}),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- server.Serve(listener)
+	}()
+
+	lost := make(chan error, 1)
+	go func() {
+		lost <- client.Wait()
+	}()
+
+	fmt.Printf("\n✓ Serving %s read-only at http://%s/ (HTTP and WebDAV)\n", serveRemoteFlags.remote, address)
+
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(sigChan)
+
+	exitCode := 0
+	select {
+	case <-sigChan:
+		fmt.Println("\n→ Shutdown signal received, stopping...")
+	case err := <-lost:
+		fmt.Printf("✗ SSH connection lost: %s\n", redact.Text(fmt.Sprint(err)))
+		exitCode = 1
+	case err := <-serveErr:
+		if !errors.Is(err, http.ErrServerClosed) {
+			fmt.Printf("✗ Server error: %v\n", err)
+			exitCode = 1
+		}
+	}
+
+	server.Close()
+	fmt.Println("✓ Stopped.")
+	if exitCode != 0 {
+		sftpClient.Close()
+		client.Close()
+		os.Exit(exitCode)
+	}
+}
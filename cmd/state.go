@@ -0,0 +1,120 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"tunn/internal/tunnel"
+	"tunn/pkg/state"
+
+	"github.com/spf13/cobra"
+)
+
+// stateCmd represents the state command and its subcommands.
+// It inspects the connection history kept between runs.
+var stateCmd = &cobra.Command{
+	Use:   "state",
+	Short: "Inspect saved connection state",
+}
+
+// stateStatsCmd represents the state stats command.
+// It prints the win rate of each auto mode strategy.
+var stateStatsCmd = &cobra.Command{
+	Use:   "stats",
+	Short: "Show success rates of auto mode strategies",
+	Run:   showStateStats,
+}
+
+// init registers the state command and its subcommands.
+func init() {
+	rootCmd.AddCommand(stateCmd)
+	stateCmd.AddCommand(stateStatsCmd)
+}
+
+// stateRow is one line of the strategy statistics table.
+type stateRow struct {
+	name   string
+	record *state.Record
+}
+
+// showStateStats prints the recorded strategy outcomes. With a loadable auto
+// mode config the strategies are listed with demoted ones last, and only
+// history matching their current settings is shown.
+func showStateStats(cmd *cobra.Command, args []string) {
+	var rows []stateRow
+	budget := 0.5
+
+	cfg, err := loadConfig(configFile)
+	if err != nil || cfg.Mode != "auto" {
+		path, err := state.DefaultPath()
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		current, err := state.Load(path)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		for name, record := range current.Strategies {
+			rows = append(rows, stateRow{name: name, record: record})
+		}
+		sort.Slice(rows, func(i, j int) bool { return rows[i].name < rows[j].name })
+		fmt.Printf("State file: %s\n\n", path)
+	} else {
+		budget = cfg.Auto.ErrorBudget
+		store, err := tunnel.StateStore(cfg)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		current, err := store.Read()
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		for _, s := range cfg.Auto.Strategies {
+			resolved, err := tunnel.ResolveStrategy(cfg, s)
+			if err != nil {
+				fmt.Printf("Error: %v\n", err)
+				os.Exit(1)
+			}
+			rows = append(rows, stateRow{name: s.Name, record: current.Get(s.Name, tunnel.StrategyFingerprint(resolved))})
+		}
+		sort.SliceStable(rows, func(i, j int) bool {
+			return !rows[i].record.Demoted(budget) && rows[j].record.Demoted(budget)
+		})
+		fmt.Printf("Error budget: %.0f%% failures over the last %d attempts\n\n", budget*100, cfg.Auto.Window)
+	}
+
+	if len(rows) == 0 {
+		fmt.Println("No strategy history recorded yet.")
+		return
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "STRATEGY\tWIN RATE\tRECENT\tTOTAL\tLAST SUCCESS\tSTATUS")
+	for _, row := range rows {
+		rate, recent := row.record.WinRate()
+		winRate := "-"
+		if recent > 0 {
+			winRate = fmt.Sprintf("%.0f%%", rate*100)
+		}
+
+		lastSuccess := "never"
+		if t := row.record.LastSuccess(); !t.IsZero() {
+			lastSuccess = t.Local().Format(time.DateTime)
+		}
+
+		status := "ok"
+		if row.record.Demoted(budget) {
+			status = "demoted"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%d\t%d/%d\t%s\t%s\n", row.name, winRate, recent,
+			row.record.Successes, row.record.Successes+row.record.Failures, lastSuccess, status)
+	}
+	w.Flush()
+}
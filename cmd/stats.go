@@ -0,0 +1,112 @@
+package cmd
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"text/tabwriter"
+	"time"
+
+	"tunn/pkg/control"
+	"tunn/pkg/stats"
+
+	"github.com/spf13/cobra"
+)
+
+// statsCmd represents the stats command and its subcommands.
+// It inspects the statistics of a running tunnel through its control API.
+var statsCmd = &cobra.Command{
+	Use:   "stats",
+	Short: "Inspect statistics of a running tunnel",
+}
+
+// statsTopCmd represents the stats top command.
+// It lists the destinations with the slowest connect or first-byte times.
+var statsTopCmd = &cobra.Command{
+	Use:   "top",
+	Short: "List the slowest destinations of a running tunnel",
+	Long: "List the destinations of a running tunnel with the median (p50) and 95th percentile (p95) of their recent\n" +
+		"connect and first-byte times. Connect is how long the SSH server took to reach the destination;\n" +
+		"first byte is how long the destination then took to send data. A slow connect with a quick first byte\n" +
+		"points at the tunnel, a slow first byte at the destination itself.",
+	Args: cobra.NoArgs,
+	Run:  showStatsTop,
+}
+
+// statsTopFlags holds the command-line flags for the stats top command.
+var statsTopFlags struct {
+	address string
+	limit   int
+	sort    string
+	json    bool
+}
+
+// init registers the stats command, its subcommands and their flags.
+func init() {
+	rootCmd.AddCommand(statsCmd)
+	statsCmd.AddCommand(statsTopCmd)
+
+	statsTopCmd.Flags().StringVar(&statsTopFlags.address, "address", "", "control API address (default: control.address from the config file)")
+	statsTopCmd.Flags().IntVarP(&statsTopFlags.limit, "limit", "n", 10, "number of destinations to list, 0 for all")
+	statsTopCmd.Flags().StringVar(&statsTopFlags.sort, "sort", "connect", "order by p95 of \"connect\" or \"first-byte\"")
+	statsTopCmd.Flags().BoolVar(&statsTopFlags.json, "json", false, "print the latencies as JSON")
+}
+
+// showStatsTop fetches the per-destination latencies of a running tunnel and
+// prints the slowest destinations.
+func showStatsTop(cmd *cobra.Command, args []string) {
+	if statsTopFlags.sort != "connect" && statsTopFlags.sort != "first-byte" {
+		fmt.Printf("Error: Invalid --sort '%s', must be 'connect' or 'first-byte'\n", statsTopFlags.sort)
+		os.Exit(1)
+	}
+
+	address := controlAddress(statsTopFlags.address)
+	latency, err := control.FetchLatency(address)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	if statsTopFlags.sort == "first-byte" {
+		slices.SortStableFunc(latency, func(a, b stats.DestinationLatency) int {
+			return cmp.Compare(b.FirstByteP95, a.FirstByteP95)
+		})
+	}
+	if statsTopFlags.limit > 0 && len(latency) > statsTopFlags.limit {
+		latency = latency[:statsTopFlags.limit]
+	}
+
+	if statsTopFlags.json {
+		data, _ := json.MarshalIndent(latency, "", "  ")
+		fmt.Println(string(data))
+		return
+	}
+	if len(latency) == 0 {
+		fmt.Println("No connections through the tunnel yet")
+		return
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "DESTINATION\tCONNECT P50\tCONNECT P95\tFIRST BYTE P50\tFIRST BYTE P95\tSAMPLES")
+	for _, d := range latency {
+		destination := d.Destination
+		if d.Slow {
+			destination += " (slow)"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%d\n", destination,
+			formatLatency(d.ConnectP50, d.Connects), formatLatency(d.ConnectP95, d.Connects),
+			formatLatency(d.FirstByteP50, d.FirstBytes), formatLatency(d.FirstByteP95, d.FirstBytes),
+			d.Connects)
+	}
+	w.Flush()
+}
+
+// formatLatency formats a latency percentile, or "-" when it has no samples.
+func formatLatency(d time.Duration, samples int) string {
+	if samples == 0 {
+		return "-"
+	}
+	return d.Round(time.Millisecond).String()
+}
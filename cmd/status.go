@@ -0,0 +1,142 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"time"
+
+	"tunn/pkg/color"
+	"tunn/pkg/control"
+	"tunn/pkg/i18n"
+	"tunn/pkg/stats"
+	"tunn/pkg/utils"
+
+	"github.com/spf13/cobra"
+)
+
+// statusCmd represents the status command.
+// It queries a running tunnel through its local control API and prints the
+// traffic counters and transport details, optionally with socket statistics.
+var statusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Show the status of a running tunnel",
+	Run:   showStatus,
+}
+
+// statusFlags holds the command-line flags for the status command.
+var statusFlags struct {
+	address string
+	net     bool
+	debug   bool
+	json    bool
+}
+
+// init registers the status command and its flags.
+func init() {
+	rootCmd.AddCommand(statusCmd)
+
+	statusCmd.Flags().StringVar(&statusFlags.address, "address", "", "control API address (default: control.address from the config file)")
+	statusCmd.Flags().BoolVar(&statusFlags.net, "net", false, "include socket statistics (RTT, retransmissions, congestion window, buffers)")
+	statusCmd.Flags().BoolVar(&statusFlags.debug, "debug", false, "include goroutine, file descriptor and SSH channel counts")
+	statusCmd.Flags().BoolVar(&statusFlags.json, "json", false, "print the raw status as JSON")
+}
+
+// showStatus fetches and prints the status of a running tunnel.
+// The control API address is taken from --address or from the config file.
+func showStatus(cmd *cobra.Command, args []string) {
+	address := controlAddress(statusFlags.address)
+	status, err := control.Fetch(address, statusFlags.net)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	if statusFlags.json {
+		data, _ := json.MarshalIndent(status, "", "  ")
+		fmt.Println(string(data))
+		return
+	}
+
+	i18n.Printf("Tunnel: %s mode, %s proxy on port %d, up %s\n", status.Mode, status.ProxyType, status.ListenPort, status.Uptime)
+	i18n.Printf("Traffic: ↑ %s ↓ %s (%s today), %d active / %d total connections\n",
+		utils.FormatBytes(status.Stats.BytesUp), utils.FormatBytes(status.Stats.BytesDown),
+		utils.FormatBytes(status.Stats.BytesToday), status.Stats.ActiveConns, status.Stats.TotalConns)
+	if status.Stats.Blocked > 0 {
+		i18n.Printf("Blocked: %d connections by blocklists\n", status.Stats.Blocked)
+	}
+	if status.Debug {
+		fmt.Println(color.Yellow(i18n.T("Debug logging: on")))
+	}
+	if statusFlags.debug {
+		printResources(status.Resources)
+	}
+
+	if len(status.Transports) == 0 {
+		fmt.Println(color.Yellow(i18n.T("Transports: none (reconnecting)")))
+		return
+	}
+	fmt.Println(i18n.T("Transports:"))
+	for _, t := range status.Transports {
+		state := color.Yellow(i18n.T("standby"))
+		if t.Active {
+			state = color.Green(i18n.T("active"))
+		}
+		name := t.Name
+		if t.Server != "" {
+			name += " @ " + t.Server
+		}
+		fmt.Printf("   - %s (%s): %s → %s\n", name, state, t.LocalAddr, t.RemoteAddr)
+
+		if t.SocketError != "" {
+			fmt.Printf("       socket statistics unavailable: %s\n", t.SocketError)
+		} else if t.Socket != nil {
+			printSocketInfo(t.Socket)
+		}
+	}
+}
+
+// controlAddress returns the control API address of the running tunnel: the
+// given flag value, or control.address from the config file. It exits when
+// neither is set.
+func controlAddress(flag string) string {
+	if flag != "" {
+		return flag
+	}
+	cfg, err := loadConfig(configFile)
+	if err != nil {
+		fmt.Printf("Error: Failed to load config: %v\n", err)
+		os.Exit(1)
+	}
+	if cfg.Control.Address == "" {
+		fmt.Println("Error: Control API is not enabled. Set control.address in the config or use --address.")
+		os.Exit(1)
+	}
+	return cfg.Control.Address
+}
+
+// printSocketInfo prints the socket statistics of a transport.
+func printSocketInfo(info *stats.SocketInfo) {
+	fmt.Printf("       RTT: %s (±%s), MSS: %d bytes\n",
+		info.RTT.Round(10*time.Microsecond), info.RTTVar.Round(10*time.Microsecond), info.MSS)
+	ssthresh := fmt.Sprint(info.SSThresh)
+	if info.SSThresh >= math.MaxInt32 {
+		ssthresh = "unlimited"
+	}
+	fmt.Printf("       Congestion window: %d segments, slow start threshold: %s\n", info.Cwnd, ssthresh)
+	fmt.Printf("       Retransmissions: %d total, %d currently lost\n", info.Retransmits, info.Lost)
+	fmt.Printf("       Send queue: %s of %s buffer, receive queue: %s of %s buffer\n",
+		utils.FormatBytes(int64(info.SendQueue)), utils.FormatBytes(int64(info.SendBuffer)),
+		utils.FormatBytes(int64(info.RecvQueue)), utils.FormatBytes(int64(info.RecvBuffer)))
+}
+
+// printResources prints the resources held by the tunnel process.
+func printResources(r stats.Resources) {
+	openFiles := fmt.Sprint(r.OpenFiles)
+	if r.OpenFiles < 0 {
+		openFiles = i18n.T("unknown")
+	}
+	i18n.Printf("Resources: %d goroutines, %s open file descriptors, %d SSH channels, %d client connections\n",
+		r.Goroutines, openFiles, r.SSHChannels, r.ClientConns)
+}
@@ -0,0 +1,140 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"tunn/pkg/config"
+	"tunn/pkg/control"
+	"tunn/pkg/redact"
+	"tunn/pkg/state"
+	"tunn/pkg/support"
+
+	"github.com/spf13/cobra"
+)
+
+// supportCmd represents the support-bundle command.
+// It gathers diagnostics into one redacted archive to attach to bug reports.
+var supportCmd = &cobra.Command{
+	Use:   "support-bundle",
+	Short: "Collect redacted diagnostics into an archive for bug reports",
+	Long: `Collect version and build information, the effective configuration with
+credentials masked, configuration warnings, the auto mode history, the status
+of a running tunnel (when control.address is set) and the end of a log file
+into one zip archive to attach to a bug report.
+
+Tunn prints its log to the terminal; to include one, capture it first with
+detailed output, for example:
+
+  tunn --log-format plain --debug > tunn.log 2>&1
+  tunn support-bundle --log tunn.log`,
+	Run: runSupportBundle,
+}
+
+// supportFlags holds the command-line flags for the support-bundle command.
+var supportFlags struct {
+	output   string
+	logFile  string
+	logLines int
+}
+
+// init registers the support-bundle command and its flags.
+func init() {
+	rootCmd.AddCommand(supportCmd)
+
+	supportCmd.Flags().StringVarP(&supportFlags.output, "output", "o", "", "archive to write (default: tunn-support-<time>.zip)")
+	supportCmd.Flags().StringVar(&supportFlags.logFile, "log", "", "log file whose last lines are included")
+	supportCmd.Flags().IntVar(&supportFlags.logLines, "log-lines", 2000, "number of log lines included")
+}
+
+// runSupportBundle collects the diagnostics and writes the archive. Parts
+// that cannot be collected are noted in the archive instead of failing.
+func runSupportBundle(cmd *cobra.Command, args []string) {
+	// The archive is meant to be shared, so secrets are masked regardless of --show-secrets
+	redact.SetShowSecrets(false)
+
+	archive := &support.Archive{}
+	archive.Add("info.txt", support.SystemInfo(rootCmd.Version))
+
+	cfg, err := loadConfig(configFile)
+	if err != nil {
+		archive.Add("config-error.txt", []byte(redact.Text(err.Error())+"\n"))
+	} else {
+		if err := archive.AddJSON("config.json", cfg); err != nil {
+			fmt.Printf("✗ %v\n", err)
+		}
+		archive.Add("config-lint.txt", lintReport(cfg.Lint()))
+		addState(archive, cfg)
+		addStatus(archive, cfg)
+	}
+
+	if supportFlags.logFile != "" {
+		if data, err := support.LogTail(supportFlags.logFile, max(supportFlags.logLines, 1)); err != nil {
+			fmt.Printf("✗ Log not included: %v\n", err)
+		} else {
+			archive.Add("log.txt", data)
+		}
+	}
+
+	output := supportFlags.output
+	if output == "" {
+		output = "tunn-support-" + time.Now().Format("20060102-150405") + ".zip"
+	}
+	if err := archive.Write(output); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("✓ Wrote %s (%s)\n", output, strings.Join(archive.Names(), ", "))
+	fmt.Println("→ Credentials are masked, but host names and addresses are kept; review the archive before sharing it")
+}
+
+// lintReport formats configuration findings as text.
+func lintReport(findings []config.Finding) []byte {
+	if len(findings) == 0 {
+		return []byte("No issues found\n")
+	}
+	var b strings.Builder
+	for _, f := range findings {
+		fmt.Fprintf(&b, "%s: %s\n  fix: %s\n", f.Field, f.Message, f.Suggestion)
+	}
+	return []byte(b.String())
+}
+
+// addState adds the auto mode history, if there is one.
+func addState(archive *support.Archive, cfg *config.Config) {
+	path := cfg.Auto.StateFile
+	if path == "" {
+		var err error
+		if path, err = state.DefaultPath(); err != nil {
+			return
+		}
+	}
+	if _, err := os.Stat(path); err != nil {
+		return
+	}
+	file, err := state.Load(path)
+	if err == nil {
+		err = archive.AddJSON("state.json", file)
+	}
+	if err != nil {
+		archive.Add("state-error.txt", []byte(redact.Text(err.Error())+"\n"))
+	}
+}
+
+// addStatus adds the status of a running tunnel when its control API is
+// configured.
+func addStatus(archive *support.Archive, cfg *config.Config) {
+	if cfg.Control.Address == "" {
+		return
+	}
+	status, err := control.Fetch(cfg.Control.Address, true)
+	if err == nil {
+		err = archive.AddJSON("status.json", status)
+	}
+	if err != nil {
+		archive.Add("status-error.txt", []byte(redact.Text(err.Error())+"\n"))
+	}
+}
@@ -3,14 +3,17 @@ module tunn
 go 1.23.0
 
 require (
+	github.com/pkg/sftp v1.13.9
 	github.com/spf13/cobra v1.9.1
 	golang.org/x/crypto v0.33.0
-	golang.org/x/net v0.21.0
+	golang.org/x/net v0.25.0
+	golang.org/x/sys v0.32.0
+	golang.org/x/term v0.31.0
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
 	github.com/inconshreveable/mousetrap v1.1.0 // indirect
+	github.com/kr/fs v0.1.0 // indirect
 	github.com/spf13/pflag v1.0.6 // indirect
-	golang.org/x/sys v0.32.0 // indirect
-	golang.org/x/term v0.31.0 // indirect
 )
@@ -0,0 +1,380 @@
+// Package harness runs an in-process SSH server for integration testing.
+//
+// A Harness bundles everything a tunnel needs on the far side: an SSH server
+// with password authentication that serves direct-tcpip channels, exec
+// sessions and the SFTP subsystem; a WebSocket upgrade endpoint in front of it
+// answering payloads with 101 Switching Protocols; and an echo server to use as
+// a proxied destination. All listeners bind to random loopback ports, so a
+// Harness can be started from tests without any external setup:
+//
+//	h, err := harness.Start()
+//	if err != nil { ... }
+//	defer h.Close()
+//	cfg := h.Config(1080, "socks5")
+//	// run a tunnel.Manager with cfg and dial h.EchoAddr() through the proxy
+package harness
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os/exec"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"tunn/pkg/config"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+)
+
+// Credentials accepted by the harness SSH server.
+const (
+	Username = "tunn"
+	Password = "harness"
+)
+
+// Harness is a running set of in-process test servers.
+type Harness struct {
+	sshConfig   *ssh.ServerConfig
+	fingerprint string // SHA256 fingerprint of the random host key
+
+	sshListener  net.Listener // Raw SSH
+	wsListener   net.Listener // WebSocket upgrade, then SSH
+	echoListener net.Listener // Echo destination
+
+	mu     sync.Mutex
+	conns  map[net.Conn]struct{} // Open connections, closed by Close
+	closed bool
+	wg     sync.WaitGroup
+
+	channels atomic.Int64 // direct-tcpip channels opened so far
+	upgrades atomic.Int64 // WebSocket upgrades answered so far
+}
+
+// Start starts the SSH server, the WebSocket endpoint and the echo server on
+// random loopback ports.
+//
+// Returns:
+//   - *Harness: The running harness; Close it when done
+//   - error: An error if a host key cannot be generated or a listener fails
+func Start() (*Harness, error) {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate host key: %w", err)
+	}
+	signer, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create host key signer: %w", err)
+	}
+
+	h := &Harness{
+		conns:       make(map[net.Conn]struct{}),
+		fingerprint: ssh.FingerprintSHA256(signer.PublicKey()),
+	}
+	h.sshConfig = &ssh.ServerConfig{
+		PasswordCallback: func(meta ssh.ConnMetadata, password []byte) (*ssh.Permissions, error) {
+			if meta.User() == Username && string(password) == Password {
+				return nil, nil
+			}
+			return nil, errors.New("invalid credentials")
+		},
+	}
+	h.sshConfig.AddHostKey(signer)
+
+	listeners := make([]net.Listener, 3)
+	for i := range listeners {
+		if listeners[i], err = net.Listen("tcp", "127.0.0.1:0"); err != nil {
+			for _, l := range listeners[:i] {
+				l.Close()
+			}
+			return nil, fmt.Errorf("failed to listen: %w", err)
+		}
+	}
+	h.sshListener, h.wsListener, h.echoListener = listeners[0], listeners[1], listeners[2]
+
+	h.serve(h.sshListener, h.serveSSH)
+	h.serve(h.wsListener, h.serveWebSocket)
+	h.serve(h.echoListener, func(conn net.Conn) { io.Copy(conn, conn) })
+	return h, nil
+}
+
+// SSHAddr returns the address of the raw SSH listener.
+func (h *Harness) SSHAddr() string { return h.sshListener.Addr().String() }
+
+// WSAddr returns the address of the WebSocket upgrade endpoint.
+func (h *Harness) WSAddr() string { return h.wsListener.Addr().String() }
+
+// EchoAddr returns the address of the echo server.
+func (h *Harness) EchoAddr() string { return h.echoListener.Addr().String() }
+
+// Channels returns the number of direct-tcpip channels opened so far.
+func (h *Harness) Channels() int64 { return h.channels.Load() }
+
+// Upgrades returns the number of WebSocket upgrades answered so far.
+func (h *Harness) Upgrades() int64 { return h.upgrades.Load() }
+
+// HostKeyFingerprint returns the SHA256 fingerprint of the host key, which is
+// generated anew for every harness.
+func (h *Harness) HostKeyFingerprint() string { return h.fingerprint }
+
+// Config returns a direct-mode configuration connecting to the WebSocket
+// endpoint with the harness credentials, pinning the harness host key.
+//
+// Parameters:
+//   - listenPort: Local proxy port
+//   - proxyType: Local proxy type, "socks5" or "http"
+//
+// Returns:
+//   - *config.Config: A complete configuration, defaults applied
+func (h *Harness) Config(listenPort int, proxyType string) *config.Config {
+	host, portStr, _ := net.SplitHostPort(h.WSAddr())
+	port, _ := strconv.Atoi(portStr)
+	return &config.Config{
+		Mode: "direct",
+		SSH: config.SSHConfig{
+			Host:     host,
+			Port:     port,
+			Username: Username,
+			Password: Password,
+
+			HostKeyFingerprint: h.fingerprint,
+		},
+		Listener: config.ListenerConfig{
+			Port:      listenPort,
+			ProxyType: proxyType,
+			Host:      "127.0.0.1",
+		},
+		HTTPPayload:       "GET / HTTP/1.1[crlf]Host: [host][crlf]Upgrade: websocket[crlf][crlf]",
+		ConnectionTimeout: 5,
+		ChannelOpen:       config.ChannelOpenConfig{QueueTimeout: 5},
+		Latency: config.LatencyConfig{
+			SlowThreshold: 3,
+			MinSamples:    3,
+			Action:        "warn",
+			BlockDuration: 300,
+		},
+		Tor: config.TorConfig{
+			SocksAddress:       "127.0.0.1:9050",
+			RemoteSocksAddress: "127.0.0.1:9050",
+		},
+	}
+}
+
+// Close stops all listeners, closes open connections and waits for their
+// handlers to return.
+func (h *Harness) Close() error {
+	h.mu.Lock()
+	h.closed = true
+	for conn := range h.conns {
+		conn.Close()
+	}
+	h.mu.Unlock()
+
+	h.sshListener.Close()
+	h.wsListener.Close()
+	h.echoListener.Close()
+	h.wg.Wait()
+	return nil
+}
+
+// serve accepts connections on a listener and handles each in a goroutine.
+func (h *Harness) serve(listener net.Listener, handle func(net.Conn)) {
+	h.wg.Add(1)
+	go func() {
+		defer h.wg.Done()
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			if !h.track(conn) {
+				conn.Close()
+				return
+			}
+			h.wg.Add(1)
+			go func() {
+				defer h.wg.Done()
+				defer h.untrack(conn)
+				handle(conn)
+			}()
+		}
+	}()
+}
+
+// track registers a connection so Close can close it. It reports false once
+// the harness is closed.
+func (h *Harness) track(conn net.Conn) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.closed {
+		return false
+	}
+	h.conns[conn] = struct{}{}
+	return true
+}
+
+// untrack closes and unregisters a connection.
+func (h *Harness) untrack(conn net.Conn) {
+	conn.Close()
+	h.mu.Lock()
+	delete(h.conns, conn)
+	h.mu.Unlock()
+}
+
+// serveWebSocket answers an upgrade request with 101 and continues with SSH.
+func (h *Harness) serveWebSocket(conn net.Conn) {
+	reader := bufio.NewReader(conn)
+	var head []byte
+	for !bytes.HasSuffix(head, []byte("\r\n\r\n")) {
+		line, err := reader.ReadSlice('\n')
+		if err != nil {
+			return
+		}
+		head = append(head, line...)
+	}
+
+	if _, err := conn.Write([]byte("HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n\r\n")); err != nil {
+		return
+	}
+	h.upgrades.Add(1)
+
+	// The client may already have sent SSH bytes after the head
+	h.serveSSH(&bufferedConn{Conn: conn, r: reader})
+}
+
+// bufferedConn is a connection whose reads go through a buffered reader.
+type bufferedConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+// Read implements net.Conn.
+func (b *bufferedConn) Read(p []byte) (int, error) {
+	return b.r.Read(p)
+}
+
+// serveSSH runs the SSH server protocol on a connection.
+func (h *Harness) serveSSH(conn net.Conn) {
+	serverConn, chans, reqs, err := ssh.NewServerConn(conn, h.sshConfig)
+	if err != nil {
+		return
+	}
+	defer serverConn.Close()
+	go ssh.DiscardRequests(reqs)
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	for newChannel := range chans {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			switch newChannel.ChannelType() {
+			case "direct-tcpip":
+				h.directTCPIP(newChannel)
+			case "session":
+				h.session(newChannel)
+			default:
+				newChannel.Reject(ssh.UnknownChannelType, "unsupported channel type")
+			}
+		}()
+	}
+}
+
+// directTCPIP connects a direct-tcpip channel to its destination.
+func (h *Harness) directTCPIP(newChannel ssh.NewChannel) {
+	var target struct {
+		Host       string
+		Port       uint32
+		OriginHost string
+		OriginPort uint32
+	}
+	if err := ssh.Unmarshal(newChannel.ExtraData(), &target); err != nil {
+		newChannel.Reject(ssh.ConnectionFailed, "malformed request")
+		return
+	}
+
+	address := net.JoinHostPort(target.Host, strconv.Itoa(int(target.Port)))
+	upstream, err := net.DialTimeout("tcp", address, 5*time.Second)
+	if err != nil {
+		newChannel.Reject(ssh.ConnectionFailed, err.Error())
+		return
+	}
+	defer upstream.Close()
+
+	channel, reqs, err := newChannel.Accept()
+	if err != nil {
+		return
+	}
+	defer channel.Close()
+	go ssh.DiscardRequests(reqs)
+	h.channels.Add(1)
+
+	done := make(chan struct{})
+	go func() {
+		io.Copy(upstream, channel)
+		upstream.(*net.TCPConn).CloseWrite()
+		close(done)
+	}()
+	io.Copy(channel, upstream)
+	channel.CloseWrite()
+	<-done
+}
+
+// session serves exec requests and the SFTP subsystem on a session channel.
+func (h *Harness) session(newChannel ssh.NewChannel) {
+	channel, reqs, err := newChannel.Accept()
+	if err != nil {
+		return
+	}
+	defer channel.Close()
+
+	for req := range reqs {
+		switch req.Type {
+		case "exec":
+			var payload struct{ Command string }
+			if err := ssh.Unmarshal(req.Payload, &payload); err != nil {
+				req.Reply(false, nil)
+				continue
+			}
+			req.Reply(true, nil)
+
+			cmd := exec.Command("sh", "-c", payload.Command)
+			cmd.Stdin, cmd.Stdout, cmd.Stderr = channel, channel, channel.Stderr()
+			status := uint32(0)
+			if err := cmd.Run(); err != nil {
+				status = 1
+				var exitErr *exec.ExitError
+				if errors.As(err, &exitErr) {
+					status = uint32(exitErr.ExitCode())
+				}
+			}
+			channel.SendRequest("exit-status", false, binary.BigEndian.AppendUint32(nil, status))
+			return
+		case "subsystem":
+			var payload struct{ Name string }
+			if ssh.Unmarshal(req.Payload, &payload) != nil || payload.Name != "sftp" {
+				req.Reply(false, nil)
+				continue
+			}
+			req.Reply(true, nil)
+
+			server, err := sftp.NewServer(channel)
+			if err != nil {
+				return
+			}
+			server.Serve()
+			return
+		default:
+			req.Reply(req.Type == "env" || req.Type == "pty-req", nil)
+		}
+	}
+}
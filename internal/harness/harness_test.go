@@ -0,0 +1,181 @@
+package harness_test
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"tunn/internal/harness"
+	"tunn/internal/tunnel"
+)
+
+// startTunnel starts a harness and a tunnel manager running a local proxy of
+// the given type against it.
+func startTunnel(t *testing.T, proxyType string) (*harness.Harness, string) {
+	t.Helper()
+	h, err := harness.Start()
+	if err != nil {
+		t.Fatalf("failed to start harness: %v", err)
+	}
+	t.Cleanup(func() { h.Close() })
+
+	port := freePort(t)
+	m := tunnel.NewManager(h.Config(port, proxyType), tunnel.Options{Summary: "off"})
+	done := make(chan error, 1)
+	go func() { done <- m.Start() }()
+	t.Cleanup(func() {
+		m.Stop()
+		select {
+		case <-done:
+		case <-time.After(10 * time.Second):
+			t.Error("tunnel did not stop")
+		}
+	})
+
+	address := net.JoinHostPort("127.0.0.1", strconv.Itoa(port))
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		select {
+		case err := <-done:
+			t.Fatalf("tunnel stopped: %v", err)
+		default:
+		}
+		if conn, err := net.Dial("tcp", address); err == nil {
+			conn.Close()
+			return h, address
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("proxy on %s did not start", address)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+// freePort returns a loopback port that is not in use.
+func freePort(t *testing.T) int {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to find a free port: %v", err)
+	}
+	defer l.Close()
+	return l.Addr().(*net.TCPAddr).Port
+}
+
+// socks5Connect opens a connection to target through a SOCKS5 proxy.
+func socks5Connect(proxyAddr, target string) (net.Conn, error) {
+	host, portStr, _ := net.SplitHostPort(target)
+	port, _ := strconv.Atoi(portStr)
+	ip := net.ParseIP(host).To4()
+	if ip == nil {
+		return nil, fmt.Errorf("not an IPv4 address: %s", host)
+	}
+
+	conn, err := net.DialTimeout("tcp", proxyAddr, 5*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	conn.SetDeadline(time.Now().Add(10 * time.Second))
+
+	reply := make([]byte, 10)
+	if _, err := conn.Write([]byte{5, 1, 0}); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if _, err := io.ReadFull(conn, reply[:2]); err != nil || reply[1] != 0 {
+		conn.Close()
+		return nil, fmt.Errorf("method negotiation failed: %v %x", err, reply[:2])
+	}
+
+	request := append([]byte{5, 1, 0, 1}, ip...)
+	request = binary.BigEndian.AppendUint16(request, uint16(port))
+	if _, err := conn.Write(request); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if _, err := io.ReadFull(conn, reply); err != nil || reply[1] != 0 {
+		conn.Close()
+		return nil, fmt.Errorf("CONNECT failed: %v %x", err, reply)
+	}
+	conn.SetDeadline(time.Time{})
+	return conn, nil
+}
+
+// httpConnect opens a connection to target through an HTTP proxy.
+func httpConnect(proxyAddr, target string) (net.Conn, error) {
+	conn, err := net.DialTimeout("tcp", proxyAddr, 5*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	conn.SetDeadline(time.Now().Add(10 * time.Second))
+
+	if _, err := fmt.Fprintf(conn, "CONNECT %s HTTP/1.1\r\nHost: %s\r\n\r\n", target, target); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	reader := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(reader, &http.Request{Method: http.MethodConnect})
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		conn.Close()
+		return nil, fmt.Errorf("CONNECT failed: %s", resp.Status)
+	}
+	if reader.Buffered() > 0 {
+		conn.Close()
+		return nil, fmt.Errorf("unexpected data after the CONNECT response")
+	}
+	conn.SetDeadline(time.Time{})
+	return conn, nil
+}
+
+func TestProxyEcho(t *testing.T) {
+	tests := []struct {
+		proxyType string
+		connect   func(proxyAddr, target string) (net.Conn, error)
+	}{
+		{"socks5", socks5Connect},
+		{"http", httpConnect},
+	}
+	for _, tt := range tests {
+		t.Run(tt.proxyType, func(t *testing.T) {
+			h, proxyAddr := startTunnel(t, tt.proxyType)
+
+			conn, err := tt.connect(proxyAddr, h.EchoAddr())
+			if err != nil {
+				t.Fatalf("failed to connect through the proxy: %v", err)
+			}
+			defer conn.Close()
+
+			message := []byte("hello through the tunnel\n")
+			conn.SetDeadline(time.Now().Add(10 * time.Second))
+			if _, err := conn.Write(message); err != nil {
+				t.Fatalf("write failed: %v", err)
+			}
+			echoed := make([]byte, len(message))
+			if _, err := io.ReadFull(conn, echoed); err != nil {
+				t.Fatalf("read failed: %v", err)
+			}
+			if !bytes.Equal(echoed, message) {
+				t.Errorf("echoed %q, want %q", echoed, message)
+			}
+
+			if got := h.Channels(); got != 1 {
+				t.Errorf("Channels() = %d, want 1", got)
+			}
+			if got := h.Upgrades(); got != 1 {
+				t.Errorf("Upgrades() = %d, want 1", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,203 @@
+package tunnel
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/netip"
+
+	"tunn/pkg/acl"
+	"tunn/pkg/debuglog"
+	"tunn/pkg/geoip"
+	"tunn/pkg/proxy"
+	"tunn/pkg/ssh"
+)
+
+// maxACLSize bounds the size of a rule list fetched from the server.
+const maxACLSize = 1 << 20
+
+// updateACL fetches the destination rules from a freshly established transport
+// and puts them in force.
+//
+// When the rules cannot be fetched the previous rules stay in force. The
+// connection only fails if acl.required is set and no rules have been fetched
+// yet, so a server hiccup does not silently lift enforcement.
+//
+// Parameters:
+//   - client: The authenticated SSH client to fetch the rules over
+//
+// Returns:
+//   - error: An error if the rules are required and unavailable
+func (m *Manager) updateACL(client *ssh.SSHClient) error {
+	settings := m.cfg().ACL
+	if settings.File == "" && settings.Command == "" {
+		return nil
+	}
+
+	list, err := fetchACL(client, settings.File, settings.Command)
+	if err != nil {
+		if settings.Required && !m.acl.Active() {
+			return fmt.Errorf("failed to fetch access rules: %w", err)
+		}
+		if m.acl.Active() {
+			fmt.Printf("✗ Failed to refresh access rules, keeping previous rules: %v\n", err)
+		} else {
+			fmt.Printf("✗ Failed to fetch access rules, destinations are not restricted: %v\n", err)
+		}
+		return nil
+	}
+
+	m.acl.Set(list)
+	fmt.Printf("✓ Access rules loaded from server (%d rules)\n", len(list.Rules))
+	if list.UsesGeo() && settings.CountryDB == "" && settings.ASNDB == "" {
+		fmt.Println("✗ Country and ASN rules never match without acl.countryDb or acl.asnDb")
+	}
+	return nil
+}
+
+// aclLocator opens the GeoIP databases configured for country and ASN rules.
+//
+// Returns:
+//   - acl.Locator: The locator, or nil if no database is configured
+//   - error: An error if a database cannot be opened
+func (m *Manager) aclLocator() (acl.Locator, error) {
+	settings := m.cfg().ACL
+	if settings.CountryDB == "" && settings.ASNDB == "" {
+		return nil, nil
+	}
+
+	locator := &geoLocator{m: m}
+	for _, db := range []struct {
+		path string
+		dest **geoip.DB
+	}{{settings.CountryDB, &locator.country}, {settings.ASNDB, &locator.asn}} {
+		if db.path == "" {
+			continue
+		}
+		opened, err := geoip.Open(db.path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open GeoIP database: %w", err)
+		}
+		*db.dest = opened
+		fmt.Printf("✓ Loaded GeoIP database %s (%s)\n", db.path, opened.Type)
+	}
+	return locator, nil
+}
+
+// geoLocator locates destinations in GeoIP databases for country and ASN
+// rules.
+type geoLocator struct {
+	m       *Manager
+	country *geoip.DB // Country database, or nil
+	asn     *geoip.DB // ASN database, or nil
+}
+
+// Locate implements acl.Locator. Hostnames are resolved by the local DNS
+// resolver when it runs, so the lookup goes through the tunnel and follows
+// the resolver's rules, and by the system resolver otherwise.
+func (g *geoLocator) Locate(ctx context.Context, host string) ([]acl.Location, error) {
+	g.m.mu.Lock()
+	resolver := g.m.resolver
+	g.m.mu.Unlock()
+
+	var addrs []netip.Addr
+	var err error
+	if resolver != nil {
+		addrs, err = resolver.LookupNetIP(ctx, "ip", host)
+	} else {
+		addrs, err = net.DefaultResolver.LookupNetIP(ctx, "ip", host)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	locations := make([]acl.Location, len(addrs))
+	for i, addr := range addrs {
+		if g.country != nil {
+			locations[i].Country = g.country.Country(addr)
+		}
+		if g.asn != nil {
+			locations[i].ASN = g.asn.ASN(addr)
+		}
+	}
+	debuglog.Printf("Located %s: %v\n", host, locations)
+	return locations, nil
+}
+
+// fetchACL reads and parses the rule list from the SSH server, from a file over
+// SFTP or from the output of a command.
+func fetchACL(client *ssh.SSHClient, file, command string) (*acl.List, error) {
+	var data []byte
+	if file != "" {
+		sftpClient, err := client.NewSFTP()
+		if err != nil {
+			return nil, fmt.Errorf("failed to start SFTP session: %w", err)
+		}
+		defer sftpClient.Close()
+
+		f, err := sftpClient.Open(file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open %s: %w", file, err)
+		}
+		defer f.Close()
+
+		data, err = io.ReadAll(io.LimitReader(f, maxACLSize+1))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", file, err)
+		}
+	} else {
+		session, err := client.NewSession()
+		if err != nil {
+			return nil, fmt.Errorf("failed to open session: %w", err)
+		}
+		defer session.Close()
+
+		var stdout bytes.Buffer
+		session.Stdout = &limitedWriter{w: &stdout, n: maxACLSize + 1}
+		if err := session.Run(command); err != nil {
+			return nil, fmt.Errorf("rule command failed: %w", err)
+		}
+		data = stdout.Bytes()
+	}
+
+	if len(data) > maxACLSize {
+		return nil, fmt.Errorf("rule list exceeds %d bytes", maxACLSize)
+	}
+	return acl.Parse(bytes.NewReader(data))
+}
+
+// limitedWriter writes at most n bytes to w and silently discards the rest.
+type limitedWriter struct {
+	w io.Writer
+	n int
+}
+
+// Write implements io.Writer.
+func (l *limitedWriter) Write(p []byte) (int, error) {
+	if l.n > 0 {
+		chunk := p[:min(len(p), l.n)]
+		n, err := l.w.Write(chunk)
+		l.n -= n
+		if err != nil {
+			return n, err
+		}
+	}
+	return len(p), nil
+}
+
+// aclDialer rejects destinations denied by the access rules before opening a
+// channel for them.
+type aclDialer struct {
+	next   proxy.SSHClient // The dialer for allowed destinations
+	policy *acl.Policy     // The rules in force
+}
+
+// Dial implements proxy.SSHClient.
+func (d *aclDialer) Dial(network, address string) (net.Conn, error) {
+	if err := d.policy.Check(address); err != nil {
+		return nil, err
+	}
+	return d.next.Dial(network, address)
+}
@@ -0,0 +1,199 @@
+package tunnel
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"tunn/pkg/config"
+	"tunn/pkg/presets"
+	"tunn/pkg/redact"
+	"tunn/pkg/ssh"
+	"tunn/pkg/state"
+)
+
+// stateStores holds one store per state file so concurrent uplinks do not
+// overwrite each other's outcomes.
+var (
+	stateStoresMu sync.Mutex
+	stateStores   = make(map[string]*state.Store)
+)
+
+// autoCandidate is a strategy resolved into a complete configuration.
+type autoCandidate struct {
+	name        string
+	config      *config.Config
+	fingerprint string
+	record      *state.Record
+}
+
+// connectAuto tries the auto mode strategies until one connects.
+//
+// Strategies within the error budget are tried in configured order, followed
+// by demoted strategies ordered by win rate. Every attempt is recorded in the
+// state file.
+//
+// Parameters:
+//   - cfg: The auto mode configuration
+//
+// Returns:
+//   - *ssh.SSHClient: An authenticated SSH client from the first strategy that connected
+//   - error: An error if every strategy failed
+func connectAuto(cfg *config.Config) (*ssh.SSHClient, error) {
+	store, err := StateStore(cfg)
+	if err != nil {
+		return nil, err
+	}
+	current, err := store.Read()
+	if err != nil {
+		fmt.Printf("✗ Ignoring strategy history: %v\n", err)
+		current = &state.File{Strategies: make(map[string]*state.Record)}
+	}
+
+	candidates, err := resolveStrategies(cfg, current)
+	if err != nil {
+		return nil, err
+	}
+	orderStrategies(candidates, cfg.Auto.ErrorBudget)
+
+	var lastErr error
+	for _, c := range candidates {
+		demoted := ""
+		if c.record.Demoted(cfg.Auto.ErrorBudget) {
+			demoted = " (demoted)"
+		}
+		fmt.Printf("→ Trying strategy %s%s\n", c.name, demoted)
+
+		client, err := dial(c.config)
+		recordErr := store.Update(func(f *state.File) {
+			f.Record(c.name, c.fingerprint, err == nil, cfg.Auto.Window, time.Now())
+		})
+		if recordErr != nil {
+			fmt.Printf("✗ Failed to record strategy outcome: %v\n", recordErr)
+		}
+
+		if err == nil {
+			fmt.Printf("✓ Strategy %s connected\n", c.name)
+			return client, nil
+		}
+		fmt.Printf("✗ Strategy %s failed: %s\n", c.name, redact.Text(err.Error()))
+		lastErr = err
+	}
+	return nil, fmt.Errorf("all %d strategies failed, last error: %w", len(candidates), lastErr)
+}
+
+// StateStore returns the store for the state file of a configuration.
+//
+// Parameters:
+//   - cfg: The configuration; auto.stateFile overrides the default location
+//
+// Returns:
+//   - *state.Store: The store
+//   - error: An error if the default location cannot be determined
+func StateStore(cfg *config.Config) (*state.Store, error) {
+	path, err := statePath(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	stateStoresMu.Lock()
+	defer stateStoresMu.Unlock()
+	store, ok := stateStores[path]
+	if !ok {
+		store = state.NewStore(path)
+		stateStores[path] = store
+	}
+	return store, nil
+}
+
+// statePath returns the state file of a configuration: auto.stateFile or the
+// default location.
+func statePath(cfg *config.Config) (string, error) {
+	if cfg.Auto.StateFile != "" {
+		return cfg.Auto.StateFile, nil
+	}
+	return state.DefaultPath()
+}
+
+// resolveStrategies builds the configuration of every strategy and looks up its
+// history.
+func resolveStrategies(cfg *config.Config, current *state.File) ([]*autoCandidate, error) {
+	candidates := make([]*autoCandidate, 0, len(cfg.Auto.Strategies))
+	for _, s := range cfg.Auto.Strategies {
+		resolved, err := ResolveStrategy(cfg, s)
+		if err != nil {
+			return nil, err
+		}
+		fingerprint := StrategyFingerprint(resolved)
+		candidates = append(candidates, &autoCandidate{
+			name:        s.Name,
+			config:      resolved,
+			fingerprint: fingerprint,
+			record:      current.Get(s.Name, fingerprint),
+		})
+	}
+	return candidates, nil
+}
+
+// ResolveStrategy applies a strategy, and the preset it names, to a copy of the
+// top-level configuration.
+//
+// Parameters:
+//   - cfg: The auto mode configuration
+//   - s: The strategy to resolve
+//
+// Returns:
+//   - *config.Config: The configuration used to connect with the strategy
+//   - error: An error if the preset is unknown or required settings are missing
+func ResolveStrategy(cfg *config.Config, s config.Strategy) (*config.Config, error) {
+	resolved := *cfg
+	resolved.Auto = config.AutoConfig{}
+	if s.Preset != "" {
+		p, err := presets.Find(s.Preset)
+		if err != nil {
+			return nil, fmt.Errorf("strategy '%s': %w", s.Name, err)
+		}
+		p.Apply(&resolved)
+	}
+	s.Apply(&resolved)
+
+	if resolved.Mode == "proxy" && (resolved.ProxyHost == "" || resolved.ProxyPort == "") {
+		return nil, fmt.Errorf("strategy '%s' uses proxy mode but proxyHost or proxyPort is not set", s.Name)
+	}
+	return &resolved, nil
+}
+
+// StrategyFingerprint identifies the settings a strategy connects with, so its
+// history restarts when they change.
+//
+// Parameters:
+//   - cfg: The resolved strategy configuration
+//
+// Returns:
+//   - string: The fingerprint
+func StrategyFingerprint(cfg *config.Config) string {
+	return state.Fingerprint(struct {
+		Mode, ProxyHost, ProxyPort string
+		Port                       int
+		HTTPPayload, ServerName    string
+		ALPN                       []string
+	}{cfg.Mode, cfg.ProxyHost, cfg.ProxyPort, cfg.SSH.Port, cfg.HTTPPayload, cfg.TLS.ServerName, cfg.TLS.ALPN})
+}
+
+// orderStrategies moves demoted strategies behind the others, ordering them by
+// win rate. Strategies within the error budget keep their configured order.
+func orderStrategies(candidates []*autoCandidate, budget float64) {
+	sort.SliceStable(candidates, func(i, j int) bool {
+		di, dj := candidates[i].record.Demoted(budget), candidates[j].record.Demoted(budget)
+		if di != dj {
+			return dj
+		}
+		if !di {
+			return false
+		}
+		ri, _ := candidates[i].record.WinRate()
+		rj, _ := candidates[j].record.WinRate()
+		return ri > rj
+	})
+}
@@ -0,0 +1,28 @@
+package tunnel
+
+// balancing reports whether new connections are spread over a transport to
+// every server.
+func (m *Manager) balancing() bool {
+	return m.cfg().Balance.Strategy != ""
+}
+
+// pick returns the transport a new connection is opened on when balancing.
+// The caller must hold m.mu and make sure there is at least one transport.
+//
+// Round-robin takes the transports in turn. Least-connections takes the one
+// with the fewest open channels, favoring the earliest connected on ties, so a
+// transport that has just come back catches up with the others.
+func (m *Manager) pick() *transport {
+	if m.cfg().Balance.Strategy == "round-robin" {
+		n := m.rotation.Add(1) - 1
+		return m.transports[n%uint64(len(m.transports))]
+	}
+
+	best := m.transports[0]
+	for _, t := range m.transports[1:] {
+		if t.open.Load() < best.open.Load() {
+			best = t
+		}
+	}
+	return best
+}
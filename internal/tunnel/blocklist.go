@@ -0,0 +1,99 @@
+package tunnel
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"tunn/pkg/blocklist"
+	"tunn/pkg/proxy"
+	"tunn/pkg/redact"
+	"tunn/pkg/stats"
+)
+
+// startBlocklists loads the proxy blocklists and keeps them up to date in the
+// background until shutdown.
+//
+// Parameters:
+//   - dialer: The dialer used to fetch lists given as URLs
+func (m *Manager) startBlocklists(dialer proxy.SSHClient) {
+	lists := fetchBlocklists(m.cfg().Blocklist.Lists, dialer, nil)
+	m.blocked.Store(mergeBlocklists(lists))
+
+	interval := time.Duration(m.cfg().Blocklist.UpdateHours) * time.Hour
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-m.done:
+				return
+			case <-ticker.C:
+				lists = fetchBlocklists(m.cfg().Blocklist.Lists, dialer, lists)
+				m.blocked.Store(mergeBlocklists(lists))
+			}
+		}
+	}()
+}
+
+// fetchBlocklists loads lists from files or through the tunnel. A list that
+// fails to load is reported and keeps its domains from the previous load, if
+// there was one.
+//
+// Parameters:
+//   - sources: Files or URLs of the lists
+//   - dialer: The dialer used for URLs
+//   - previous: The lists from the previous load by source (may be nil)
+//
+// Returns:
+//   - map[string][]string: The domains of each list that is available
+func fetchBlocklists(sources []string, dialer proxy.SSHClient, previous map[string][]string) map[string][]string {
+	client := &http.Client{
+		Timeout:   time.Minute,
+		Transport: &http.Transport{Dial: dialer.Dial},
+	}
+	lists := make(map[string][]string, len(sources))
+	for _, source := range sources {
+		domains, err := blocklist.Load(source, client)
+		if err != nil {
+			if old, ok := previous[source]; ok {
+				fmt.Printf("✗ Failed to update blocklist %s, keeping previous version: %s\n", redact.URL(source), redact.Text(err.Error()))
+				lists[source] = old
+			} else {
+				fmt.Printf("✗ Skipping blocklist %s: %s\n", redact.URL(source), redact.Text(err.Error()))
+			}
+			continue
+		}
+		fmt.Printf("✓ Loaded %d domains from blocklist %s\n", len(domains), redact.URL(source))
+		lists[source] = domains
+	}
+	return lists
+}
+
+// mergeBlocklists combines loaded lists into one set.
+func mergeBlocklists(lists map[string][]string) *blocklist.Set {
+	all := make([][]string, 0, len(lists))
+	for _, domains := range lists {
+		all = append(all, domains)
+	}
+	return blocklist.NewSet(all...)
+}
+
+// blockDialer rejects destinations on the blocklists before opening a channel
+// for them, counting each rejection.
+type blockDialer struct {
+	next    proxy.SSHClient                // The dialer for other destinations
+	blocked *atomic.Pointer[blocklist.Set] // The current blocklists
+	stats   *stats.Stats                   // Receives the blocked connection counter
+}
+
+// Dial implements proxy.SSHClient.
+func (d *blockDialer) Dial(network, address string) (net.Conn, error) {
+	if host, _, err := net.SplitHostPort(address); err == nil && d.blocked.Load().Contains(host) {
+		d.stats.AddBlocked()
+		return nil, fmt.Errorf("%s: %w", host, blocklist.ErrBlocked)
+	}
+	return d.next.Dial(network, address)
+}
@@ -0,0 +1,79 @@
+package tunnel
+
+import (
+	"fmt"
+	"net/netip"
+	"strings"
+	"time"
+
+	"tunn/pkg/clientfilter"
+	"tunn/pkg/dns"
+	"tunn/pkg/preflight"
+	"tunn/pkg/proxy"
+)
+
+// startDNS starts the local DNS resolver when dns.listen is configured.
+//
+// Blocklists are fetched through the tunnel before the resolver starts. A list
+// that cannot be loaded is reported and skipped, so one unreachable list does
+// not keep the tunnel from starting.
+//
+// Parameters:
+//   - dialer: The dialer used by the local proxy, used for forwarded queries
+//
+// Returns:
+//   - error: An error if the resolver cannot be started
+func (m *Manager) startDNS(dialer proxy.SSHClient) error {
+	cfg := m.cfg().DNS
+	if cfg.Listen == "" {
+		return nil
+	}
+
+	hosts := make(map[string][]netip.Addr, len(cfg.Hosts))
+	for name, address := range cfg.Hosts {
+		addr, err := netip.ParseAddr(address)
+		if err != nil {
+			return fmt.Errorf("invalid address '%s' for dns.hosts entry '%s'", address, name)
+		}
+		name = strings.TrimSuffix(strings.ToLower(name), ".")
+		hosts[name] = append(hosts[name], addr.Unmap())
+	}
+
+	rules := make([]dns.Rule, 0, len(cfg.Rules))
+	for _, r := range cfg.Rules {
+		rules = append(rules, dns.Rule{
+			Domain:   strings.TrimSuffix(strings.ToLower(r.Domain), "."),
+			Block:    r.Action == "block",
+			Upstream: r.Upstream,
+			Direct:   r.Direct,
+		})
+	}
+
+	clients, err := clientfilter.New(cfg.Allow, cfg.Deny)
+	if err != nil {
+		return fmt.Errorf("invalid dns client filter: %w", err)
+	}
+
+	server, err := dns.Start(cfg.Listen, dns.Options{
+		Upstream: cfg.Upstream,
+		Hosts:    hosts,
+		Rules:    rules,
+		Blocked:  mergeBlocklists(fetchBlocklists(cfg.Blocklists, dialer, nil)),
+		Dialer:   dialer,
+		Timeout:  time.Duration(m.cfg().ConnectionTimeout) * time.Second,
+		Clients:  clients,
+	})
+	if err != nil {
+		return preflight.PortInUse(err, cfg.Listen, "dns.listen")
+	}
+	fmt.Printf("✓ DNS resolver listening on %s (upstream %s through the tunnel)\n", server.Addr(), cfg.Upstream)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closing {
+		server.Close()
+		return fmt.Errorf("tunnel is shutting down")
+	}
+	m.resolver = server
+	return nil
+}
@@ -0,0 +1,77 @@
+package tunnel
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+
+	"tunn/pkg/preflight"
+	"tunn/pkg/proxy"
+)
+
+// startForwards binds the configured local port forwards and starts relaying
+// their connections through the tunnel.
+//
+// Every port is bound before any forward starts, so a port in use fails the
+// start without leaving the other forwards running.
+//
+// Parameters:
+//   - dialer: The dialer used by the local proxy, used for the forwards too
+//
+// Returns:
+//   - error: An error if a port cannot be bound
+func (m *Manager) startForwards(dialer proxy.SSHClient) error {
+	cfg := m.cfg().Forwards
+	listeners := make([]net.Listener, 0, len(cfg))
+	for i, f := range cfg {
+		listener, err := net.Listen("tcp", f.Listen)
+		if err != nil {
+			for _, l := range listeners {
+				l.Close()
+			}
+			return preflight.PortInUse(err, f.Listen, fmt.Sprintf("forwards[%d].listen", i))
+		}
+		listeners = append(listeners, listener)
+	}
+
+	forwards := make([]*proxy.Forward, 0, len(cfg))
+	for i, f := range cfg {
+		host, port, _ := net.SplitHostPort(f.Remote)
+		portNum, _ := strconv.Atoi(port)
+		forward := proxy.NewForward(dialer, m.stats, host, portNum)
+		forward.Serve(listeners[i])
+		fmt.Printf("✓ Forwarding %s to %s through the tunnel\n", listeners[i].Addr(), forward.Destination())
+		forwards = append(forwards, forward)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closing {
+		for _, forward := range forwards {
+			forward.Stop()
+		}
+		return fmt.Errorf("tunnel is shutting down")
+	}
+	m.forwards = forwards
+	return nil
+}
+
+// restartForwards replaces the local port forwards with the reloaded ones,
+// closing the connections of the running forwards.
+func (m *Manager) restartForwards() error {
+	m.mu.Lock()
+	forwards := m.forwards
+	m.forwards = nil
+	m.mu.Unlock()
+
+	for _, forward := range forwards {
+		forward.Stop()
+	}
+	if err := m.startForwards(m.dialer); err != nil {
+		return fmt.Errorf("failed to restart forwards: %w", err)
+	}
+	if len(m.cfg().Forwards) == 0 && len(forwards) > 0 {
+		fmt.Println("✓ Forwards stopped")
+	}
+	return nil
+}
@@ -10,15 +10,39 @@
 package tunnel
 
 import (
+	"errors"
 	"fmt"
+	"net"
 	"os"
 	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"syscall"
+	"time"
 
+	"tunn/pkg/acl"
+	"tunn/pkg/blocklist"
+	"tunn/pkg/clientfilter"
+	"tunn/pkg/color"
 	"tunn/pkg/config"
-	"tunn/pkg/connection"
+	"tunn/pkg/control"
+	"tunn/pkg/debuglog"
+	"tunn/pkg/dns"
+	"tunn/pkg/httpcache"
+	"tunn/pkg/i18n"
+	"tunn/pkg/preflight"
+	"tunn/pkg/privileges"
+	"tunn/pkg/progress"
 	"tunn/pkg/proxy"
+	"tunn/pkg/redact"
+	"tunn/pkg/reqlog"
 	"tunn/pkg/ssh"
+	"tunn/pkg/stats"
+	"tunn/pkg/statuspage"
+	"tunn/pkg/tor"
+	"tunn/pkg/utils"
 )
 
 // Manager manages the complete tunnel lifecycle including connection establishment,
@@ -26,10 +50,51 @@ import (
 //
 // The Manager coordinates between different components to provide a seamless
 // tunneling experience, handling both direct and proxy-based connection modes.
+// Lost transports are re-established in the background, and in multipath mode
+// a standby transport over a second uplink takes over immediately.
 type Manager struct {
-	config      *config.Config // The tunnel configuration
-	sshClient   ssh.Client     // SSH client for tunneling
-	proxyServer interface{}    // Local proxy server (SOCKS5 or HTTP)
+	config       atomic.Pointer[config.Config] // The tunnel configuration, replaced on reload
+	options      Options                       // Runtime options not stored in the config file
+	proxyServers []localProxy                  // Local proxy servers, for listener and then listeners
+	stats        *stats.Stats                  // Traffic and connection statistics
+	control      *control.Server               // Local control API (nil when disabled)
+	statusPage   *statuspage.Server            // Read-only LAN status page (nil when disabled)
+	requestLog   *reqlog.Log                   // HTTP proxy request log (nil when disabled)
+	resolver     *dns.Server                   // Local DNS resolver (nil when disabled)
+	forwards     []*proxy.Forward              // Local port forwards
+	acl          acl.Policy                    // Destination rules fetched from the server
+	blocked      atomic.Pointer[blocklist.Set] // Domains rejected by the local proxy
+	rotation     atomic.Uint64                 // Connections dialed so far, for round-robin balancing
+	maintained   atomic.Int32                  // Uplinks still being kept connected
+	started      time.Time                     // When the manager was started
+	dialer       proxy.SSHClient               // Dialer of the local listeners, kept for restarting them on reload
+	reloading    sync.Mutex                    // Serializes reloads
+
+	mu         sync.RWMutex  // Protects transports, uplinks, closing and the server fields
+	transports []*transport  // Live transports; the first one is active
+	uplinks    []*uplink     // Uplinks maintained for the current configuration
+	closing    bool          // Set once shutdown has started
+	failure    error         // Why the tunnel stopped on its own, returned by Start
+	done       chan struct{} // Closed on shutdown to stop reconnect loops
+	stop       chan struct{} // Closed by Stop to end Start without a signal
+	stopOnce   sync.Once     // Guards closing stop
+}
+
+// localProxy is implemented by the local proxy servers.
+type localProxy interface {
+	Serve(listener net.Listener)
+	SetLimits(limits proxy.Limits)
+	Stop()
+}
+
+// Options holds runtime settings for the Manager that come from the command line
+// rather than from the configuration file.
+type Options struct {
+	StatusDisplay string                         // Live statistics display: "" (off), "line" or "title"
+	RunAs         *privileges.Identity           // Unprivileged identity to switch to once listening (nil to stay)
+	Sandbox       bool                           // Restrict system calls and filesystem access once running (Linux)
+	Reload        func() (*config.Config, error) // Loads the configuration again on reload (nil: reloading is unavailable)
+	Summary       string                         // Client settings printed once established: "text" (also when empty), "json" or "off"
 }
 
 // NewManager creates a new tunnel manager with the provided configuration.
@@ -39,110 +104,582 @@ type Manager struct {
 //
 // Parameters:
 //   - cfg: The tunnel configuration containing all necessary settings
+//   - opts: Runtime options such as the live statistics display
 //
 // Returns:
 //   - *Manager: A new tunnel manager instance ready for startup
-func NewManager(cfg *config.Config) *Manager {
-	return &Manager{
-		config: cfg,
+func NewManager(cfg *config.Config, opts Options) *Manager {
+	m := &Manager{
+		options: opts,
+		stats:   stats.New(),
+		done:    make(chan struct{}),
+		stop:    make(chan struct{}),
 	}
+	m.config.Store(cfg)
+	m.stats.Latency.SetPolicy(latencyPolicy(cfg))
+	return m
+}
+
+// cfg returns the current configuration. A reload replaces it as a whole, so
+// callers reading several settings that must agree keep the returned pointer.
+func (m *Manager) cfg() *config.Config {
+	return m.config.Load()
+}
+
+// latencyPolicy converts the latency settings into the statistics policy.
+func latencyPolicy(cfg *config.Config) stats.LatencyPolicy {
+	return stats.LatencyPolicy{
+		SlowThreshold: time.Duration(cfg.Latency.SlowThreshold * float64(time.Second)),
+		MinSamples:    cfg.Latency.MinSamples,
+		Block:         cfg.Latency.Action == "block",
+		BlockDuration: time.Duration(cfg.Latency.BlockDuration) * time.Second,
+	}
+}
+
+// Stop asks a running Start to shut the tunnel down and return, as if a
+// shutdown signal had been received. It is used by the scheduler to close the
+// tunnel at the end of a time window and is safe to call more than once.
+func (m *Manager) Stop() {
+	m.stopOnce.Do(func() { close(m.stop) })
+}
+
+// Stats returns the traffic and connection statistics of the tunnel.
+func (m *Manager) Stats() *stats.Stats {
+	return m.stats
 }
 
 // Start establishes the complete tunnel setup and starts all necessary services.
 //
 // This method performs the following operations in sequence:
-//  1. Establishes the base connection (direct or through proxy)
-//  2. Creates and initializes the SSH client over the connection
-//  3. Starts the SSH transport layer
-//  4. Launches the appropriate local proxy server (SOCKS5 or HTTP)
-//  5. Waits for shutdown signals to gracefully terminate
+//  1. Establishes the SSH transport over every uplink concurrently, while
+//     binding the local proxy port
+//  2. Starts background maintenance that re-establishes lost transports
+//  3. Launches the appropriate local proxy server (SOCKS5 or HTTP)
+//  4. Starts the DNS resolver, control API and status page if configured
+//  5. Waits for shutdown signals to gracefully terminate, reloading the
+//     configuration on SIGHUP
 //
-// The method blocks until a shutdown signal is received, making it suitable
-// for use in the main application loop.
+// The method blocks until a shutdown signal is received or Stop is called,
+// making it suitable for use in the main application loop.
 //
 // Returns:
-//   - error: An error if any step of the setup process fails
+//   - error: An error if no uplink can be established, proxy startup fails or
+//     reconnecting was given up
 func (m *Manager) Start() error {
-	// Establish connection
-	establisher, err := connection.GetEstablisher(m.config.Mode)
-	if err != nil {
-		return fmt.Errorf("failed to get connection establisher: %w", err)
+	m.started = time.Now()
+	debuglog.WatchSignal()
+	links := uplinks(m.cfg())
+
+	// Bind the proxy port while establishing transports over all uplinks
+	clients := make([]*ssh.SSHClient, len(links))
+	errs := make([]error, len(links))
+	var listeners []net.Listener
+	var listenErr error
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		listeners, listenErr = listen(m.cfg())
+	}()
+	for i, u := range links {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			clients[i], errs[i] = m.connect(u)
+		}()
 	}
+	wg.Wait()
 
-	conn, err := establisher.Establish(m.config)
+	if listenErr != nil {
+		for _, client := range clients {
+			if client != nil {
+				client.Close()
+			}
+		}
+		m.shutdown()
+		return fmt.Errorf("failed to start proxy: %w", listenErr)
+	}
+
+	m.mu.Lock()
+	m.uplinks = links
+	m.mu.Unlock()
+	connected := 0
+	for i, u := range links {
+		var t *transport
+		if clients[i] != nil {
+			t = m.newTransport(u, clients[i])
+			m.attach(t)
+			connected++
+		} else if m.balancing() {
+			fmt.Printf("✗ Server %s failed: %s\n", u.name, redact.Text(errs[i].Error()))
+		} else if m.multipath() {
+			fmt.Printf("✗ Uplink %s failed: %s\n", u.name, redact.Text(errs[i].Error()))
+		}
+		m.maintained.Add(1)
+		go m.maintain(u, t)
+	}
+	if connected == 0 {
+		closeListeners(listeners)
+		m.shutdown()
+		return errs[0]
+	}
+
+	// Chain proxied connections into Tor on the server
+	dialer, err := m.proxyDialer()
 	if err != nil {
-		return fmt.Errorf("failed to establish connection: %w", err)
+		closeListeners(listeners)
+		m.shutdown()
+		return err
 	}
 
-	// Create SSH client
-	m.sshClient = ssh.NewSSHClient(conn, m.config.SSH.Username, m.config.SSH.Password)
+	// Start proxy server and the other local listeners
+	m.dialer = dialer
+	if err := m.startListeners(dialer, listeners); err != nil {
+		m.shutdown()
+		return err
+	}
 
-	// Start SSH transport
-	if sshOverWS, ok := m.sshClient.(*ssh.SSHClient); ok {
-		if err := sshOverWS.StartTransport(); err != nil {
-			return fmt.Errorf("failed to start SSH transport: %w", err)
+	// Nothing after the listeners needs root
+	if m.options.RunAs != nil {
+		if err := privileges.Drop(*m.options.RunAs); err != nil {
+			m.shutdown()
+			return err
 		}
+		fmt.Printf("✓ Running as %s\n", m.options.RunAs)
 	}
-
-	// Start proxy server
-	if err := m.startProxy(); err != nil {
-		return fmt.Errorf("failed to start proxy: %w", err)
+	if m.options.Sandbox {
+		if err := m.applySandbox(); err != nil {
+			m.shutdown()
+			return err
+		}
 	}
+	go m.stats.MonitorResources(m.done)
 
-	fmt.Printf("\n✓ Tunnel established and %s proxy running on port %d\n", m.config.Listener.ProxyType, m.config.Listener.Port)
+	proxies := m.cfg().ProxyListeners()
+	if progress.Plain() {
+		fmt.Printf("\n✓ Tunnel established and %s proxy running on port %d\n", proxies[0].ProxyType, proxies[0].Port)
+		for _, l := range proxies[1:] {
+			fmt.Printf("✓ %s proxy also running on port %d\n", l.ProxyType, l.Port)
+		}
+	} else {
+		fmt.Printf("\n%s "+i18n.T("Tunnel established in %s, %s proxy running on port %d")+"\n", color.Glyph("✓"),
+			progress.Elapsed(time.Since(m.started)), proxies[0].ProxyType, proxies[0].Port)
+		for _, l := range proxies[1:] {
+			fmt.Printf("%s "+i18n.T("%s proxy also running on port %d")+"\n", color.Glyph("✓"), l.ProxyType, l.Port)
+		}
+	}
 	fmt.Printf("━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━\n")
+	m.printSummary(listeners)
+
+	// Start live statistics display if requested
+	var display *stats.Display
+	if m.options.StatusDisplay != "" {
+		display, err = stats.NewDisplay(m.stats, m.options.StatusDisplay, os.Stderr)
+		if err != nil {
+			m.shutdown()
+			return err
+		}
+		// Messages printed while the tunnel runs are written above the status line
+		if err := display.Capture(&os.Stdout, &os.Stderr); err != nil {
+			m.shutdown()
+			return err
+		}
+		display.Start()
+	}
 
 	// Wait for shutdown signal
-	m.waitForShutdown()
+	m.waitForShutdown(display)
 
-	return nil
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.failure
 }
 
-// startProxy initializes and starts the appropriate local proxy server based on configuration.
+// proxyDialer returns the dialer used by the local proxy servers.
 //
-// This method creates either a SOCKS5 or HTTP proxy server according to the ProxyType
-// setting in the listener configuration. The proxy server will listen on the configured port
-// and forward connections through the established SSH tunnel.
+// Connections are normally opened as SSH channels directly to their destination.
+// When ToTor is enabled, they are instead tunneled into the Tor SOCKS proxy on the
+// SSH server, which is health-checked first. When access rules are fetched from
+// the server, denied destinations are rejected before any channel is opened.
+// When blocklists are configured they are loaded here and kept up to date, and
+// listed destinations are rejected as well.
 //
-// Supported proxy types:
-//   - "socks5" or "socks": Creates a SOCKS5 proxy server
-//   - "http": Creates an HTTP proxy server
+// Returns:
+//   - proxy.SSHClient: The dialer for proxied connections
+//   - error: An error if the remote Tor proxy is unavailable
+func (m *Manager) proxyDialer() (proxy.SSHClient, error) {
+	dialer, err := m.destinationDialer()
+	if err != nil {
+		return nil, err
+	}
+	if m.cfg().ACL.File != "" || m.cfg().ACL.Command != "" {
+		locator, err := m.aclLocator()
+		if err != nil {
+			return nil, err
+		}
+		if locator != nil {
+			m.acl.SetLocator(locator)
+		}
+		dialer = &aclDialer{next: dialer, policy: &m.acl}
+	}
+	if len(m.cfg().Blocklist.Lists) > 0 {
+		m.startBlocklists(dialer)
+		dialer = &blockDialer{next: dialer, blocked: &m.blocked, stats: m.stats}
+	}
+	return dialer, nil
+}
+
+// destinationDialer returns the dialer reaching proxied destinations, either
+// directly over the SSH transport or through Tor on the server.
+func (m *Manager) destinationDialer() (proxy.SSHClient, error) {
+	if !m.cfg().Tor.ToTor {
+		return m, nil
+	}
+
+	if err := tor.CheckRemote(m, m.cfg().Tor.RemoteSocksAddress); err != nil {
+		return nil, err
+	}
+	dialer, err := tor.NewRemoteDialer(m, m.cfg().Tor.RemoteSocksAddress)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Tor dialer: %w", err)
+	}
+	fmt.Printf("✓ Proxied connections exit through Tor on the server (%s)\n", m.cfg().Tor.RemoteSocksAddress)
+	return dialer, nil
+}
+
+// listen binds the ports of the local proxies, listener first and then the
+// entries of listeners. If one of them cannot be bound, those already bound
+// are closed again.
+//
+// Parameters:
+//   - cfg: The configuration with the listener settings
+//
+// Returns:
+//   - []net.Listener: The bound listeners, in the order of cfg.ProxyListeners
+//   - error: An error if a proxy type is unsupported or a port cannot be bound
+func listen(cfg *config.Config) ([]net.Listener, error) {
+	settings := cfg.ProxyListeners()
+	listeners := make([]net.Listener, 0, len(settings))
+	for i, l := range settings {
+		setting := "listener.port"
+		if i > 0 {
+			setting = fmt.Sprintf("listeners[%d].port", i-1)
+		}
+		listener, err := listenProxy(l, setting)
+		if err != nil {
+			closeListeners(listeners)
+			return nil, err
+		}
+		listeners = append(listeners, listener)
+	}
+	return listeners, nil
+}
+
+// closeListeners closes bound proxy ports that will not be served.
+func closeListeners(listeners []net.Listener) {
+	for _, listener := range listeners {
+		listener.Close()
+	}
+}
+
+// listenProxy binds the port of one local proxy for its proxy type. Clients
+// refused by its allow and deny lists are disconnected as they are accepted.
+//
+// When the proxy listens on 127.0.0.1, the IPv6 loopback address ::1 is bound
+// as well, since some programs resolve "localhost" to ::1 only, and the other
+// way round for ::1. The IPv4 address alone is used where IPv6 is unavailable.
+// The unspecified addresses 0.0.0.0 and :: already accept both families.
+//
+// Parameters:
+//   - l: The listener settings
+//   - setting: The setting naming the port, for explaining a port in use
 //
 // Returns:
-//   - error: An error if the proxy type is unsupported or proxy startup fails
-func (m *Manager) startProxy() error {
-	switch m.config.Listener.ProxyType {
+//   - net.Listener: The bound listener
+//   - error: An error if the proxy type is unsupported or the port cannot be bound
+func listenProxy(l config.ListenerConfig, setting string) (net.Listener, error) {
+	var name string
+	switch l.ProxyType {
 	case "socks5", "socks":
-		socksProxy := proxy.NewSOCKS5(m.sshClient)
-		m.proxyServer = socksProxy
-		return socksProxy.Start(m.config.Listener.Port)
+		name = "SOCKS5"
 	case "http":
-		httpProxy := proxy.NewHTTP(m.sshClient)
-		m.proxyServer = httpProxy
-		return httpProxy.Start(m.config.Listener.Port)
+		name = "HTTP"
+	case "mixed":
+		name = "SOCKS5/HTTP"
+	case "transparent":
+		name = "transparent"
 	default:
-		return fmt.Errorf("unsupported proxy type: %s", m.config.Listener.ProxyType)
+		return nil, fmt.Errorf("unsupported proxy type: %s", l.ProxyType)
+	}
+	filter, err := clientfilter.New(l.Allow, l.Deny)
+	if err != nil {
+		return nil, fmt.Errorf("invalid listener client filter: %w", err)
+	}
+	bind := func(host string) (net.Listener, error) {
+		var listener net.Listener
+		var err error
+		if name == "transparent" {
+			listener, err = proxy.ListenTransparent(host, l.Port)
+		} else {
+			listener, err = proxy.Listen(name, host, l.Port)
+		}
+		if err != nil {
+			address := net.JoinHostPort(host, strconv.Itoa(l.Port))
+			return nil, preflight.PortInUse(err, address, setting)
+		}
+		return clientfilter.Listen(listener, filter, name+" proxy"), nil
+	}
+
+	loopback := map[string]string{"127.0.0.1": "::1", "::1": "127.0.0.1"}[l.Host]
+	listener, err := bind(l.Host)
+	if err != nil || loopback == "" {
+		return listener, err
+	}
+	other, err := bind(loopback)
+	if err != nil {
+		if !errors.Is(err, syscall.EADDRNOTAVAIL) && !errors.Is(err, syscall.EAFNOSUPPORT) {
+			fmt.Printf("✗ Listening on %s only: %v\n", l.Host, err)
+		}
+		return listener, nil
+	}
+	if l.Host == "::1" {
+		return proxy.JoinListeners(other, listener), nil
+	}
+	return proxy.JoinListeners(listener, other), nil
+}
+
+// startListeners starts the local proxies, the port forwards, the DNS
+// resolver, the control API and the status page, reported together as the
+// listeners phase.
+//
+// Parameters:
+//   - dialer: The dialer used by the proxies to reach destinations
+//   - listeners: The bound proxy ports, owned by the proxies from now on
+//
+// Returns:
+//   - error: An error if any of them cannot be started
+func (m *Manager) startListeners(dialer proxy.SSHClient, listeners []net.Listener) error {
+	start := time.Now()
+	err := m.startProxy(dialer, listeners)
+	if err != nil {
+		err = fmt.Errorf("failed to start proxy: %w", err)
+	} else if err = m.startForwards(dialer); err != nil {
+		err = fmt.Errorf("failed to start forwards: %w", err)
+	} else if err = m.startDNS(dialer); err == nil {
+		if err = m.startControl(); err == nil {
+			err = m.startStatusPage(dialer)
+		}
+	}
+	described := make([]string, len(listeners))
+	for i, l := range m.cfg().ProxyListeners() {
+		described[i] = fmt.Sprintf("%s on %s", l.ProxyType, proxy.ListenerAddresses(listeners[i]))
+	}
+	progress.Step(progress.Listeners, strings.Join(described, ", "), start, err)
+	return err
+}
+
+// startProxy initializes and starts the local proxy servers based on configuration.
+//
+// This method creates a SOCKS5, HTTP, mixed or transparent proxy server for
+// listener and each entry of listeners according to its ProxyType setting. Each
+// proxy server serves the listener bound for it by listen and forwards
+// connections through the established SSH tunnel. The HTTP proxies share one
+// request log and one cache.
+//
+// Supported proxy types:
+//   - "socks5" or "socks": Creates a SOCKS5 proxy server
+//   - "http": Creates an HTTP proxy server
+//   - "mixed": Creates a proxy serving SOCKS5 and HTTP clients on the same port
+//   - "transparent": Creates a proxy for firewall-redirected connections
+//
+// Parameters:
+//   - dialer: The dialer used by the proxies to reach destinations
+//   - listeners: The bound proxy ports, owned by the proxies from now on
+//
+// Returns:
+//   - error: An error if a proxy type is unsupported or the tunnel is shutting down
+func (m *Manager) startProxy(dialer proxy.SSHClient, listeners []net.Listener) error {
+	var requestLog *reqlog.Log
+	if cfg := m.cfg().RequestLog; cfg.File != "" {
+		var err error
+		if requestLog, err = reqlog.Open(cfg.File, cfg.Exclude); err != nil {
+			closeListeners(listeners)
+			return err
+		}
+		fmt.Printf("✓ Recording requests to %s\n", cfg.File)
 	}
+	var cache *httpcache.Cache
+	if cfg := m.cfg().HTTPCache; cfg.Enabled {
+		var err error
+		if cache, err = httpcache.Open(cfg.Dir, int64(cfg.MaxSize)<<20, int64(cfg.MaxEntrySize)<<20); err != nil {
+			closeListeners(listeners)
+			if requestLog != nil {
+				requestLog.Close()
+			}
+			return err
+		}
+		if cfg.Dir != "" {
+			count, size := cache.Len()
+			fmt.Printf("✓ HTTP cache in %s (%d responses, %s)\n", cfg.Dir, count, utils.FormatBytes(size))
+		} else {
+			fmt.Println("✓ HTTP cache enabled in memory")
+		}
+	}
+
+	servers := make([]localProxy, 0, len(listeners))
+	for _, l := range m.cfg().ProxyListeners() {
+		var server localProxy
+		switch l.ProxyType {
+		case "socks5", "socks":
+			server = proxy.NewSOCKS5(dialer, m.stats)
+		case "transparent":
+			server = proxy.NewTransparent(dialer, m.stats)
+		case "http", "mixed":
+			var httpProxy *proxy.HTTP
+			if l.ProxyType == "mixed" {
+				mixed := proxy.NewMixed(dialer, m.stats)
+				httpProxy, server = mixed.HTTP(), mixed
+			} else {
+				httpProxy = proxy.NewHTTP(dialer, m.stats)
+				server = httpProxy
+			}
+			if len(l.HeaderCase) > 0 {
+				httpProxy.SetHeaderCase(l.HeaderCase)
+			}
+			if requestLog != nil {
+				httpProxy.SetRequestLog(requestLog)
+			}
+			if cache != nil {
+				httpProxy.SetCache(cache)
+			}
+			if cfg := m.cfg().Preconnect; cfg.Enabled {
+				httpProxy.SetPreconnect(time.Duration(cfg.IdleTimeout) * time.Second)
+			}
+			if cfg := m.cfg().Accelerator; cfg.Enabled {
+				httpProxy.SetAccelerator(cfg.Parts, int64(cfg.MinSize)<<20)
+			}
+		default:
+			closeListeners(listeners)
+			if requestLog != nil {
+				requestLog.Close()
+			}
+			if cache != nil {
+				cache.Close()
+			}
+			return fmt.Errorf("unsupported proxy type: %s", l.ProxyType)
+		}
+
+		if limits := m.cfg().Limits; limits != (config.LimitsConfig{}) {
+			server.SetLimits(proxy.Limits{
+				MaxConnections: limits.MaxConnections,
+				IdleTimeout:    time.Duration(limits.IdleTimeout) * time.Second,
+				RateLimit:      int64(limits.RateLimit) << 10,
+				Workers:        limits.Workers,
+				Queue:          limits.Queue,
+			})
+		}
+		servers = append(servers, server)
+	}
+	for i, server := range servers {
+		server.Serve(listeners[i])
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closing {
+		for _, server := range servers {
+			server.Stop()
+		}
+		if requestLog != nil {
+			requestLog.Close()
+		}
+		return fmt.Errorf("tunnel is shutting down")
+	}
+	m.proxyServers, m.requestLog = servers, requestLog
+	return nil
 }
 
 // waitForShutdown blocks and waits for system shutdown signals to gracefully terminate the tunnel.
 //
 // This method listens for SIGINT (Ctrl+C) and SIGTERM signals, providing a clean
-// shutdown mechanism. When a signal is received, it closes the SSH client connection
-// and performs cleanup operations.
+// shutdown mechanism, and for Stop being called. When either happens, it stops
+// reconnection attempts, closes all SSH transports and performs cleanup operations.
+// SIGHUP reloads the configuration in the meantime.
 //
 // The method blocks the calling goroutine until a shutdown signal is received,
 // making it suitable for use in the main application flow.
-func (m *Manager) waitForShutdown() {
+//
+// Parameters:
+//   - display: The live statistics display to stop before printing (may be nil)
+func (m *Manager) waitForShutdown(display *stats.Display) {
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(sigChan)
+	reloadChan := make(chan os.Signal, 1)
+	signal.Notify(reloadChan, syscall.SIGHUP)
+	defer signal.Stop(reloadChan)
+
+	var reason string
+	for reason == "" {
+		select {
+		case <-sigChan:
+			reason = "Shutdown signal received"
+		case <-m.stop:
+			reason = "Stop requested"
+		case <-reloadChan:
+			go m.Reload()
+		}
+	}
+	if display != nil {
+		display.Stop()
+	}
+	fmt.Printf("\n%s "+i18n.T("%s, closing tunnel...")+"\n", color.Glyph("→"), i18n.T(reason))
 
-	<-sigChan
-	fmt.Println("\n→ Shutdown signal received, closing tunnel...")
+	m.shutdown()
+
+	fmt.Println(color.Glyph("✓"), i18n.T("Tunnel closed."))
+}
 
-	if m.sshClient != nil {
-		m.sshClient.Close()
+// shutdown stops transport maintenance, the local proxy and its request log,
+// the port forwards, the DNS resolver, the control API and the status page,
+// and closes all SSH transports.
+//
+// The proxy and the forwards are stopped first so no forwarding goroutine is
+// still using a transport when it is closed. It is safe to call shutdown more
+// than once and from any goroutine.
+func (m *Manager) shutdown() {
+	m.mu.Lock()
+	if m.closing {
+		m.mu.Unlock()
+		return
 	}
+	m.closing = true
+	close(m.done)
+	transports := m.transports
+	m.transports = nil
+	servers, requestLog, resolver, controlServer, statusPage := m.proxyServers, m.requestLog, m.resolver, m.control, m.statusPage
+	forwards := m.forwards
+	m.mu.Unlock()
 
-	fmt.Println("✓ Tunnel closed.")
+	for _, server := range servers {
+		server.Stop()
+	}
+	for _, forward := range forwards {
+		forward.Stop()
+	}
+	if requestLog != nil {
+		requestLog.Close()
+	}
+	if resolver != nil {
+		resolver.Close()
+	}
+	if controlServer != nil {
+		controlServer.Close()
+	}
+	if statusPage != nil {
+		statusPage.Close()
+	}
+	for _, t := range transports {
+		t.close()
+	}
 }
@@ -0,0 +1,530 @@
+package tunnel
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"reflect"
+	"sync"
+
+	"tunn/pkg/config"
+	"tunn/pkg/control"
+	"tunn/pkg/redact"
+	"tunn/pkg/ssh"
+)
+
+// reloadPart is what a change of a configuration section restarts.
+type reloadPart int
+
+const (
+	reloadProxy      reloadPart = iota // The local proxy server
+	reloadForwards                     // The local port forwards
+	reloadDNS                          // The local DNS resolver
+	reloadStatusPage                   // The LAN status page
+	reloadLive                         // Nothing; the setting is read as it is used
+	reloadFixed                        // Only a restart of Tunn applies the change
+)
+
+// reloadSections assigns the configuration sections that do not concern the
+// SSH transports to the part a change of them restarts. A change of any other
+// setting re-establishes the transports.
+var reloadSections = []struct {
+	name  string                   // Section name as written in the config file
+	part  reloadPart               // What a change restarts
+	field func(*config.Config) any // Pointer to the section within a configuration
+}{
+	{"listener", reloadProxy, func(c *config.Config) any { return &c.Listener }},
+	{"listeners", reloadProxy, func(c *config.Config) any { return &c.Listeners }},
+	{"limits", reloadProxy, func(c *config.Config) any { return &c.Limits }},
+	{"requestLog", reloadProxy, func(c *config.Config) any { return &c.RequestLog }},
+	{"httpCache", reloadProxy, func(c *config.Config) any { return &c.HTTPCache }},
+	{"preconnect", reloadProxy, func(c *config.Config) any { return &c.Preconnect }},
+	{"accelerator", reloadProxy, func(c *config.Config) any { return &c.Accelerator }},
+	{"forwards", reloadForwards, func(c *config.Config) any { return &c.Forwards }},
+	{"dns", reloadDNS, func(c *config.Config) any { return &c.DNS }},
+	{"statusPage", reloadStatusPage, func(c *config.Config) any { return &c.StatusPage }},
+	{"coalesce", reloadLive, func(c *config.Config) any { return &c.Coalesce }},
+	{"fairQueue", reloadLive, func(c *config.Config) any { return &c.FairQueue }},
+	{"latency", reloadLive, func(c *config.Config) any { return &c.Latency }},
+	// The control API serves reloads, and the others are built into the
+	// dialer shared by every listener
+	{"control", reloadFixed, func(c *config.Config) any { return &c.Control }},
+	{"tor", reloadFixed, func(c *config.Config) any { return &c.Tor }},
+	{"acl", reloadFixed, func(c *config.Config) any { return &c.ACL }},
+	{"blocklist", reloadFixed, func(c *config.Config) any { return &c.Blocklist }},
+	{"schedule", reloadFixed, func(c *config.Config) any { return &c.Schedule }},
+}
+
+// reloadPlan lists what a reload restarts.
+type reloadPlan struct {
+	transports bool                // The SSH transports are re-established
+	parts      map[reloadPart]bool // Parts with a changed section
+	fixed      []string            // Changed sections that only apply after a restart
+}
+
+// planReload compares the running configuration with the reloaded one.
+//
+// Sections that cannot be reloaded are reset to their running values in next,
+// so the configuration put in force describes what is actually running.
+//
+// Parameters:
+//   - current: The running configuration
+//   - next: The reloaded configuration
+//
+// Returns:
+//   - reloadPlan: What has to be restarted
+func planReload(current, next *config.Config) reloadPlan {
+	plan := reloadPlan{parts: map[reloadPart]bool{}}
+	restCurrent, restNext := *current, *next
+	for _, section := range reloadSections {
+		if !reflect.DeepEqual(section.field(current), section.field(next)) {
+			if section.part == reloadFixed {
+				plan.fixed = append(plan.fixed, section.name)
+				setField(section.field(next), section.field(current))
+			} else {
+				plan.parts[section.part] = true
+			}
+		}
+		setField(section.field(&restCurrent), nil)
+		setField(section.field(&restNext), nil)
+	}
+	plan.transports = !reflect.DeepEqual(restCurrent, restNext)
+	return plan
+}
+
+// listenerNames names the parts restarted by a reload, in the order they are
+// restarted.
+var listenerNames = []struct {
+	part reloadPart
+	name string
+}{
+	{reloadProxy, "proxy"},
+	{reloadForwards, "forwards"},
+	{reloadDNS, "DNS resolver"},
+	{reloadStatusPage, "status page"},
+}
+
+// DescribeReload reports what reloading a tunnel running with one
+// configuration with another would change, without changing either.
+//
+// Parameters:
+//   - current: The running configuration
+//   - next: The configuration that would be loaded
+//
+// Returns:
+//   - control.ReloadPlan: The changed settings and what a reload restarts
+//   - error: An error if a configuration cannot be compared
+func DescribeReload(current, next *config.Config) (control.ReloadPlan, error) {
+	changes, err := config.Diff(current, next)
+	if err != nil {
+		return control.ReloadPlan{}, err
+	}
+	compared := *next
+	plan := planReload(current, &compared)
+
+	described := control.ReloadPlan{
+		Changed:    config.Sections(changes),
+		Transports: plan.transports,
+		Fixed:      plan.fixed,
+	}
+	for _, listener := range listenerNames {
+		if plan.parts[listener.part] {
+			described.Restart = append(described.Restart, listener.name)
+		}
+	}
+	return described, nil
+}
+
+// setField sets the field dst points to to the value src points to, or to its
+// zero value when src is nil.
+func setField(dst, src any) {
+	v := reflect.ValueOf(dst).Elem()
+	if src == nil {
+		v.Set(reflect.Zero(v.Type()))
+		return
+	}
+	v.Set(reflect.ValueOf(src).Elem())
+}
+
+// Reload loads the configuration again and puts the changes in force without
+// dropping what they do not concern.
+//
+// When settings of the SSH connection changed, new transports are
+// established first and replace the running ones only once at least one of
+// them is up, so a mistake in the new settings leaves the tunnel as it was.
+// Changes to the listener and the settings of the local proxy restart the
+// proxy, which closes its connections, and changes to the port forwards, the
+// DNS resolver or the status page restart only those. The control API, Tor, access rule and
+// blocklist settings, and the schedule, are kept until Tunn is restarted.
+//
+// After dropping privileges with --run-as, changes that would bind the proxy
+// ports again, to other addresses or below 1024, are rejected before anything
+// is applied.
+//
+// Reloads are started by SIGHUP and the control API, one at a time. A failed
+// reload is reported in the tunnel's output as well as returned.
+//
+// Returns:
+//   - error: An error if the configuration cannot be loaded, needs privileges
+//     that were dropped, no transport can be established with it, or a
+//     listener fails to restart
+func (m *Manager) Reload() error {
+	err := m.reload()
+	if err != nil {
+		fmt.Printf("✗ %s\n", redact.Text(err.Error()))
+	}
+	return err
+}
+
+// reload performs a reload; see Reload.
+func (m *Manager) reload() error {
+	if err := m.reloadable(); err != nil {
+		return err
+	}
+	m.reloading.Lock()
+	defer m.reloading.Unlock()
+
+	fmt.Println("→ Reloading configuration")
+	next, err := m.options.Reload()
+	if err != nil {
+		return fmt.Errorf("failed to reload config, keeping the running settings: %w", err)
+	}
+	current := m.cfg()
+	plan := planReload(current, next)
+	if err := m.rebindable(current, next, plan); err != nil {
+		return err
+	}
+	for _, section := range plan.fixed {
+		fmt.Printf("✗ Changes to %s take effect after a restart\n", section)
+	}
+	if !plan.transports && len(plan.parts) == 0 {
+		if len(plan.fixed) == 0 {
+			fmt.Println("✓ Configuration unchanged")
+		}
+		return nil
+	}
+
+	// Bind new proxy ports first, so a port in use leaves everything as it was
+	var listeners []net.Listener
+	if plan.parts[reloadProxy] && !sharesPort(current, next) {
+		if listeners, err = listen(next); err != nil {
+			return fmt.Errorf("failed to reload, keeping the running settings: %w", err)
+		}
+	}
+
+	var links []*uplink
+	var clients []*ssh.SSHClient
+	if plan.transports {
+		fmt.Println("→ Connecting with the new settings")
+		links = uplinks(next)
+		var errs []error
+		clients, errs = m.connectAll(links)
+		if clients == nil {
+			closeListeners(listeners)
+			return fmt.Errorf("failed to connect with the new settings, keeping the running settings: %w", errs[0])
+		}
+	}
+
+	if err := m.commit(next, links, clients); err != nil {
+		closeListeners(listeners)
+		return err
+	}
+
+	var errs []error
+	if plan.parts[reloadProxy] {
+		errs = append(errs, m.restartProxy(listeners))
+	}
+	if plan.parts[reloadForwards] {
+		errs = append(errs, m.restartForwards())
+	}
+	if plan.parts[reloadDNS] {
+		errs = append(errs, m.restartDNS())
+	}
+	if plan.parts[reloadStatusPage] {
+		errs = append(errs, m.restartStatusPage())
+	}
+	if plan.parts[reloadLive] {
+		m.stats.Latency.SetPolicy(latencyPolicy(next))
+	}
+	if err := errors.Join(errs...); err != nil {
+		return err
+	}
+	fmt.Println("✓ Configuration reloaded")
+	return nil
+}
+
+// reloadable reports why the configuration of this tunnel cannot be reloaded.
+func (m *Manager) reloadable() error {
+	if m.options.Reload == nil {
+		return fmt.Errorf("this tunnel cannot be reloaded")
+	}
+	if m.options.Sandbox {
+		return fmt.Errorf("the sandbox blocks reading the config file, restart the tunnel to apply changes")
+	}
+	return nil
+}
+
+// rebindable reports why the proxy ports of a reloaded configuration cannot
+// be bound after dropping privileges with --run-as. Ports are bound again
+// when the listener addresses change or the proxy restarts, which fails for
+// ports below 1024 and, once the old proxies are stopped, would leave the
+// tunnel without them.
+//
+// Parameters:
+//   - current: The running configuration
+//   - next: The reloaded configuration
+//   - plan: What the reload restarts
+//
+// Returns:
+//   - error: An error if the reload needs privileges that were dropped
+func (m *Manager) rebindable(current, next *config.Config, plan reloadPlan) error {
+	if m.options.RunAs == nil || !plan.parts[reloadProxy] {
+		return nil
+	}
+	if !sameAddresses(current.ProxyListeners(), next.ProxyListeners()) {
+		return fmt.Errorf("listener addresses cannot be changed by a reload after switching to %s with --run-as, keeping the running settings; restart tunn to apply them", m.options.RunAs)
+	}
+	for _, l := range next.ProxyListeners() {
+		if l.Port < 1024 {
+			return fmt.Errorf("the proxy cannot be restarted on port %d after switching to %s with --run-as, keeping the running settings; restart tunn to apply the changes", l.Port, m.options.RunAs)
+		}
+	}
+	return nil
+}
+
+// sameAddresses reports whether two sets of proxy listeners listen on the
+// same addresses, in the same order.
+func sameAddresses(a, b []config.ListenerConfig) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].Host != b[i].Host || a[i].Port != b[i].Port {
+			return false
+		}
+	}
+	return true
+}
+
+// PlanReload loads the configuration again and reports what Reload would
+// change, without applying anything.
+//
+// Returns:
+//   - *control.ReloadPlan: The changed settings and what a reload restarts
+//   - error: An error if the configuration cannot be loaded or Reload would
+//     reject it for needing privileges that were dropped
+func (m *Manager) PlanReload() (*control.ReloadPlan, error) {
+	if err := m.reloadable(); err != nil {
+		return nil, err
+	}
+	next, err := m.options.Reload()
+	if err != nil {
+		return nil, fmt.Errorf("failed to reload config: %w", err)
+	}
+	current, compared := m.cfg(), *next
+	if err := m.rebindable(current, next, planReload(current, &compared)); err != nil {
+		return nil, err
+	}
+	plan, err := DescribeReload(current, next)
+	if err != nil {
+		return nil, err
+	}
+	return &plan, nil
+}
+
+// connectAll establishes a transport over every uplink concurrently.
+//
+// Parameters:
+//   - links: The uplinks to connect over
+//
+// Returns:
+//   - []*ssh.SSHClient: The client of each uplink, nil where it failed, or nil
+//     altogether if every uplink failed
+//   - []error: The error of each uplink that failed
+func (m *Manager) connectAll(links []*uplink) ([]*ssh.SSHClient, []error) {
+	clients := make([]*ssh.SSHClient, len(links))
+	errs := make([]error, len(links))
+	var wg sync.WaitGroup
+	for i, u := range links {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			clients[i], errs[i] = m.connect(u)
+		}()
+	}
+	wg.Wait()
+
+	for _, client := range clients {
+		if client != nil {
+			return clients, errs
+		}
+	}
+	return nil, errs
+}
+
+// commit puts a reloaded configuration in force. With new uplinks, their
+// transports replace the running ones and the replaced uplinks stop being
+// maintained.
+//
+// Parameters:
+//   - next: The reloaded configuration
+//   - links: The new uplinks, or nil to keep the running transports
+//   - clients: The client of each new uplink, nil where it failed
+//
+// Returns:
+//   - error: An error if the tunnel is shutting down
+func (m *Manager) commit(next *config.Config, links []*uplink, clients []*ssh.SSHClient) error {
+	fresh := make([]*transport, 0, len(clients))
+	for i, client := range clients {
+		if client != nil {
+			fresh = append(fresh, m.newTransport(links[i], client))
+		}
+	}
+	m.maintained.Add(int32(len(links)))
+
+	m.mu.Lock()
+	if m.closing {
+		m.mu.Unlock()
+		m.maintained.Add(-int32(len(links)))
+		for _, t := range fresh {
+			t.close()
+		}
+		return fmt.Errorf("tunnel is shutting down")
+	}
+	m.config.Store(next)
+	if links == nil {
+		m.mu.Unlock()
+		return nil
+	}
+	replaced := m.transports
+	for _, u := range m.uplinks {
+		close(u.retired)
+	}
+	m.transports, m.uplinks = fresh, links
+	m.mu.Unlock()
+
+	for _, t := range replaced {
+		t.close()
+	}
+	fmt.Printf("✓ Tunnel re-established with the new settings (%d of %d connected)\n", len(fresh), len(links))
+
+	// The replaced transports have released the server's reverse SOCKS5 port
+	// and remote forwards
+	for _, t := range fresh {
+		reverse, remote := m.startReverseSOCKS(t.client), m.startRemoteForwards(t.client)
+		m.mu.Lock()
+		if m.closing {
+			if reverse != nil {
+				reverse.Stop()
+			}
+			for _, listener := range remote {
+				listener.Close()
+			}
+		} else {
+			t.reverse, t.remote = reverse, remote
+		}
+		m.mu.Unlock()
+	}
+
+	started := 0
+	for i, u := range links {
+		var t *transport
+		if clients[i] != nil {
+			t = fresh[started]
+			started++
+		}
+		go m.maintain(u, t)
+	}
+	return nil
+}
+
+// restartProxy replaces the local proxies with ones using the reloaded
+// settings.
+//
+// Parameters:
+//   - listeners: The new proxy ports if they were already bound, or nil to
+//     bind the configured ports once the running proxies have released them
+//
+// Returns:
+//   - error: An error if the proxies cannot be started again
+func (m *Manager) restartProxy(listeners []net.Listener) error {
+	m.mu.Lock()
+	servers, requestLog := m.proxyServers, m.requestLog
+	m.proxyServers, m.requestLog = nil, nil
+	m.mu.Unlock()
+
+	for _, server := range servers {
+		server.Stop()
+	}
+	if requestLog != nil {
+		requestLog.Close()
+	}
+
+	cfg := m.cfg()
+	if listeners == nil {
+		var err error
+		if listeners, err = listen(cfg); err != nil {
+			return fmt.Errorf("failed to restart proxy: %w", err)
+		}
+	}
+	if err := m.startProxy(m.dialer, listeners); err != nil {
+		return fmt.Errorf("failed to restart proxy: %w", err)
+	}
+	for _, l := range cfg.ProxyListeners() {
+		fmt.Printf("✓ Restarted %s proxy on port %d\n", l.ProxyType, l.Port)
+	}
+	return nil
+}
+
+// sharesPort reports whether two configurations have a proxy port in common,
+// which the running proxy has to release before the new one can bind it.
+func sharesPort(current, next *config.Config) bool {
+	for _, a := range current.ProxyListeners() {
+		for _, b := range next.ProxyListeners() {
+			if a.Port == b.Port {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// restartDNS replaces the DNS resolver with one using the reloaded settings,
+// or stops it when dns.listen was removed.
+func (m *Manager) restartDNS() error {
+	m.mu.Lock()
+	resolver := m.resolver
+	m.resolver = nil
+	m.mu.Unlock()
+
+	if resolver != nil {
+		resolver.Close()
+	}
+	if err := m.startDNS(m.dialer); err != nil {
+		return fmt.Errorf("failed to restart DNS resolver: %w", err)
+	}
+	if m.cfg().DNS.Listen == "" && resolver != nil {
+		fmt.Println("✓ DNS resolver stopped")
+	}
+	return nil
+}
+
+// restartStatusPage replaces the status page with one using the reloaded
+// settings, or stops it when statusPage.address was removed.
+func (m *Manager) restartStatusPage() error {
+	m.mu.Lock()
+	statusPage := m.statusPage
+	m.statusPage = nil
+	m.mu.Unlock()
+
+	if statusPage != nil {
+		statusPage.Close()
+	}
+	if err := m.startStatusPage(m.dialer); err != nil {
+		return fmt.Errorf("failed to restart status page: %w", err)
+	}
+	if m.cfg().StatusPage.Address == "" {
+		fmt.Println("✓ Status page stopped")
+	}
+	return nil
+}
@@ -0,0 +1,126 @@
+package tunnel
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/netip"
+	"time"
+
+	"tunn/pkg/acl"
+	"tunn/pkg/expose"
+	"tunn/pkg/proxy"
+	"tunn/pkg/ssh"
+)
+
+// startReverseSOCKS opens the reverse SOCKS5 proxy on the server of a freshly
+// established transport when reverseSocks.listen is configured.
+//
+// A server refusing the remote forward is reported but does not fail the
+// transport, since the local proxy works without it.
+//
+// Parameters:
+//   - client: The authenticated SSH client to listen on
+//
+// Returns:
+//   - *proxy.SOCKS5: The running proxy, or nil if disabled or unavailable
+func (m *Manager) startReverseSOCKS(client *ssh.SSHClient) *proxy.SOCKS5 {
+	cfg := m.cfg().ReverseSOCKS
+	if cfg.Listen == "" {
+		return nil
+	}
+
+	listener, err := client.Listen("tcp", cfg.Listen)
+	if err != nil {
+		fmt.Printf("✗ Server refused to listen on %s for the reverse SOCKS5 proxy: %v\n", cfg.Listen, err)
+		return nil
+	}
+
+	dialer := &lanDialer{timeout: time.Duration(m.cfg().ConnectionTimeout) * time.Second}
+	for _, network := range cfg.Allow {
+		dialer.allow = append(dialer.allow, netip.MustParsePrefix(network).Masked())
+	}
+
+	server := proxy.NewSOCKS5(dialer, nil)
+	server.Serve(listener)
+	fmt.Printf("✓ Reverse SOCKS5 proxy listening on the server at %s\n", listener.Addr())
+	return server
+}
+
+// startRemoteForwards opens the configured remote forwards on the server of a
+// freshly established transport, passing their connections to the local
+// services like "tunn expose" does.
+//
+// A port the server refuses to listen on is reported and skipped, since the
+// local proxy and the other forwards work without it.
+//
+// Parameters:
+//   - client: The authenticated SSH client to listen on
+//
+// Returns:
+//   - []net.Listener: The listeners opened on the server, closed with the transport
+func (m *Manager) startRemoteForwards(client *ssh.SSHClient) []net.Listener {
+	var listeners []net.Listener
+	timeout := time.Duration(m.cfg().ConnectionTimeout) * time.Second
+	for _, f := range m.cfg().RemoteForwards {
+		forwarder, err := expose.NewForwarder([]expose.Route{{Target: f.Local}}, timeout)
+		if err != nil {
+			fmt.Printf("✗ Cannot forward %s to %s: %v\n", f.RemoteListen, f.Local, err)
+			continue
+		}
+		listener, err := client.Listen("tcp", f.RemoteListen)
+		if err != nil {
+			fmt.Printf("✗ Server refused to listen on %s for the forward to %s: %v\n", f.RemoteListen, f.Local, err)
+			continue
+		}
+		go forwarder.Serve(listener)
+		fmt.Printf("✓ Forwarding %s on the server to %s\n", listener.Addr(), f.Local)
+		listeners = append(listeners, listener)
+	}
+	return listeners
+}
+
+// lanDialer connects reverse SOCKS5 clients to destinations on the local
+// network, refusing addresses outside the allowed networks.
+type lanDialer struct {
+	allow   []netip.Prefix // Reachable networks; any address when empty
+	timeout time.Duration  // Connect timeout
+}
+
+// Dial connects to a destination directly from this machine.
+//
+// Hostnames are resolved locally, so names known only on the LAN work. With
+// an allow list, the first resolved address inside it is used.
+//
+// Parameters:
+//   - network: Network type, typically "tcp"
+//   - address: Target address in "host:port" format
+//
+// Returns:
+//   - net.Conn: The connection to the destination
+//   - error: acl.ErrDenied if no address is allowed, or an error if connecting fails
+func (d *lanDialer) Dial(network, address string) (net.Conn, error) {
+	if len(d.allow) == 0 {
+		return net.DialTimeout(network, address, d.timeout)
+	}
+
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), d.timeout)
+	defer cancel()
+	addrs, err := net.DefaultResolver.LookupNetIP(ctx, "ip", host)
+	if err != nil {
+		return nil, err
+	}
+	for _, addr := range addrs {
+		addr = addr.Unmap()
+		for _, prefix := range d.allow {
+			if prefix.Contains(addr) {
+				return net.DialTimeout(network, net.JoinHostPort(addr.String(), port), d.timeout)
+			}
+		}
+	}
+	return nil, fmt.Errorf("%w: %s is outside reverseSocks.allow", acl.ErrDenied, host)
+}
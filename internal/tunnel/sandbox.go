@@ -0,0 +1,64 @@
+package tunnel
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"tunn/pkg/sandbox"
+)
+
+// applySandbox restricts the process once the tunnel is running, as requested
+// with the sandbox option.
+//
+// Returns:
+//   - error: An error if system calls could not be filtered
+func (m *Manager) applySandbox() error {
+	policy, err := m.sandboxPolicy()
+	if err != nil {
+		return err
+	}
+	result, err := sandbox.Apply(policy)
+	if err != nil {
+		return fmt.Errorf("failed to enable sandbox: %w", err)
+	}
+	if result.Filesystem {
+		fmt.Println("✓ Sandbox enabled: program execution blocked, filesystem restricted")
+	} else {
+		fmt.Println("✓ Sandbox enabled: program execution blocked")
+		fmt.Printf("✗ Filesystem not restricted: %v\n", result.FilesystemErr)
+	}
+	return nil
+}
+
+// sandboxPolicy lists the paths the tunnel needs after startup: system
+// configuration for name resolution, its own descriptors for resource
+// statistics, local blocklist files, which are reloaded periodically, and the
+// directories of the auto mode state file and the HTTP cache.
+func (m *Manager) sandboxPolicy() (sandbox.Policy, error) {
+	policy := sandbox.Policy{Read: []string{"/etc", "/proc/self/fd"}}
+	lists := append(append([]string{}, m.cfg().Blocklist.Lists...), m.cfg().DNS.Blocklists...)
+	for _, source := range lists {
+		if !strings.HasPrefix(source, "http://") && !strings.HasPrefix(source, "https://") {
+			policy.Read = append(policy.Read, source)
+		}
+	}
+
+	if m.cfg().Mode == "auto" {
+		path, err := statePath(m.cfg())
+		if err != nil {
+			return policy, err
+		}
+		// The directory must exist before access to it can be granted
+		dir := filepath.Dir(path)
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			return policy, fmt.Errorf("failed to create state directory: %w", err)
+		}
+		policy.Write = append(policy.Write, dir)
+	}
+	if m.cfg().HTTPCache.Enabled && m.cfg().HTTPCache.Dir != "" {
+		policy.Write = append(policy.Write, m.cfg().HTTPCache.Dir)
+	}
+	return policy, nil
+}
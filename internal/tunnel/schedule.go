@@ -0,0 +1,95 @@
+package tunnel
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"tunn/pkg/config"
+	"tunn/pkg/schedule"
+)
+
+// scheduleRetryDelay is how long the scheduler waits before retrying a tunnel
+// that failed to start while its window is open.
+const scheduleRetryDelay = time.Minute
+
+// RunScheduled keeps the tunnel running only during the configured schedule windows.
+//
+// The process stays in the foreground: outside the windows it waits, and when a
+// window opens a new Manager is started, which is stopped again when the window
+// closes. If the tunnel cannot be established inside a window, it is retried
+// every minute until the window closes. The function returns when a shutdown
+// signal is received.
+//
+// Parameters:
+//   - cfg: The tunnel configuration, with at least one schedule window
+//   - opts: Runtime options passed to each Manager
+//
+// Returns:
+//   - error: An error if the schedule is invalid
+func RunScheduled(cfg *config.Config, opts Options) error {
+	windows := make([]*schedule.Window, 0, len(cfg.Schedule))
+	for i, w := range cfg.Schedule {
+		window, err := schedule.NewWindow(w.Start, w.Stop)
+		if err != nil {
+			return fmt.Errorf("invalid schedule[%d]: %w", i, err)
+		}
+		windows = append(windows, window)
+	}
+
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(sigChan)
+
+	for {
+		active, change := schedule.Evaluate(windows, time.Now())
+		if !active {
+			if change.IsZero() {
+				return fmt.Errorf("schedule never starts the tunnel")
+			}
+			fmt.Printf("→ Tunnel scheduled to start at %s\n", change.Format("2006-01-02 15:04"))
+			select {
+			case <-sigChan:
+				fmt.Println("\n✓ Scheduler stopped.")
+				return nil
+			case <-time.After(time.Until(change)):
+			}
+			continue
+		}
+
+		if change.IsZero() {
+			fmt.Println("→ Schedule window open, starting tunnel")
+		} else {
+			fmt.Printf("→ Schedule window open until %s, starting tunnel\n", change.Format("2006-01-02 15:04"))
+		}
+
+		manager := NewManager(cfg, opts)
+		var timer *time.Timer
+		if !change.IsZero() {
+			timer = time.AfterFunc(time.Until(change), manager.Stop)
+		}
+		err := manager.Start()
+		if timer != nil {
+			timer.Stop()
+		}
+
+		// The manager also receives shutdown signals; end the schedule with it
+		select {
+		case <-sigChan:
+			return nil
+		default:
+		}
+
+		if err != nil {
+			fmt.Printf("✗ Scheduled tunnel failed: %v\n", err)
+			select {
+			case <-sigChan:
+				fmt.Println("\n✓ Scheduler stopped.")
+				return nil
+			case <-time.After(scheduleRetryDelay):
+			}
+		}
+	}
+}
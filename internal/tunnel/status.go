@@ -0,0 +1,157 @@
+package tunnel
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"time"
+
+	"tunn/pkg/clientfilter"
+	"tunn/pkg/config"
+	"tunn/pkg/control"
+	"tunn/pkg/debuglog"
+	"tunn/pkg/preflight"
+	"tunn/pkg/proxy"
+	"tunn/pkg/stats"
+	"tunn/pkg/statuspage"
+	"tunn/pkg/summary"
+)
+
+// Status returns the current state of the tunnel for the control API.
+//
+// Parameters:
+//   - withNet: Whether to read kernel socket statistics for each transport
+//
+// Returns:
+//   - control.Status: The tunnel status, with the active transport first
+func (m *Manager) Status(withNet bool) control.Status {
+	m.mu.RLock()
+	transports := append([]*transport(nil), m.transports...)
+	m.mu.RUnlock()
+
+	status := control.Status{
+		Mode:       m.cfg().Mode,
+		ProxyType:  m.cfg().Listener.ProxyType,
+		ListenPort: m.cfg().Listener.Port,
+		Uptime:     time.Since(m.started).Round(time.Second),
+		Stats:      m.stats.Snapshot(),
+		Transports: make([]control.TransportStatus, 0, len(transports)),
+		Resources:  m.stats.Resources(),
+		Debug:      debuglog.Enabled(),
+	}
+
+	for i, t := range transports {
+		conn := t.client.TransportConn()
+		ts := control.TransportStatus{
+			Name:       t.uplink.name,
+			Server:     t.server,
+			Active:     i == 0 || m.balancing(),
+			Channels:   t.open.Load(),
+			LocalAddr:  conn.LocalAddr().String(),
+			RemoteAddr: conn.RemoteAddr().String(),
+		}
+		if withNet {
+			info, err := stats.ReadSocketInfo(conn)
+			if err != nil {
+				ts.SocketError = err.Error()
+			} else {
+				ts.Socket = info
+			}
+		}
+		status.Transports = append(status.Transports, ts)
+	}
+	return status
+}
+
+// Latency returns the recent connect and first-byte latencies of every
+// destination for the control API.
+func (m *Manager) Latency() []stats.DestinationLatency {
+	return m.stats.Latency.Top()
+}
+
+// startControl starts the control API when control.address is configured,
+// serving runtime profiles as well with control.pprof.
+//
+// Returns:
+//   - error: An error if the control API cannot be started
+func (m *Manager) startControl() error {
+	if m.cfg().Control.Address == "" {
+		return nil
+	}
+	server := control.NewServer(m)
+	if m.cfg().Control.Pprof {
+		server.EnableProfiling()
+	}
+	if err := server.Start(m.cfg().Control.Address); err != nil {
+		return preflight.PortInUse(err, m.cfg().Control.Address, "control.address")
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closing {
+		server.Close()
+		return fmt.Errorf("tunnel is shutting down")
+	}
+	m.control = server
+	return nil
+}
+
+// startStatusPage starts the read-only status page when statusPage.address is
+// configured. The exit country is looked up through the same dialer as proxied
+// connections, so it reflects where their traffic leaves.
+//
+// Parameters:
+//   - dialer: The dialer used by the local proxy
+//
+// Returns:
+//   - error: An error if the status page cannot be started
+func (m *Manager) startStatusPage(dialer proxy.SSHClient) error {
+	cfg := m.cfg().StatusPage
+	if cfg.Address == "" {
+		return nil
+	}
+	clients, err := clientfilter.New(cfg.Allow, cfg.Deny)
+	if err != nil {
+		return fmt.Errorf("invalid statusPage client filter: %w", err)
+	}
+	server := statuspage.NewServer(m, dialer, func() config.ListenerConfig { return m.cfg().Listener }, cfg.CountryURL, cfg.Token)
+	if err := server.Start(cfg.Address, clients); err != nil {
+		return preflight.PortInUse(err, cfg.Address, "statusPage.address")
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closing {
+		server.Close()
+		return fmt.Errorf("tunnel is shutting down")
+	}
+	m.statusPage = server
+	return nil
+}
+
+// printSummary prints the settings clients use to reach the tunnel, in the
+// format chosen with Options.Summary.
+//
+// Parameters:
+//   - listeners: The bound proxy ports, in the order of the configuration
+func (m *Manager) printSummary(listeners []net.Listener) {
+	if m.options.Summary == "off" {
+		return
+	}
+	proxies := make([]summary.Listener, len(listeners))
+	for i, l := range m.cfg().ProxyListeners() {
+		proxies[i] = summary.Listener{ProxyType: l.ProxyType, Addrs: proxy.ListenerAddrs(listeners[i])}
+	}
+	s := summary.New(proxies)
+	for _, f := range m.cfg().Forwards {
+		s.Forwards = append(s.Forwards, summary.Forward{Listen: f.Listen, Remote: f.Remote})
+	}
+	if m.options.Summary == "json" {
+		data, _ := json.MarshalIndent(s, "", "  ")
+		fmt.Println(string(data))
+	} else {
+		s.Print(os.Stdout)
+	}
+	fmt.Printf("━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━\n")
+}
@@ -0,0 +1,583 @@
+package tunnel
+
+import (
+	"cmp"
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"tunn/pkg/coalesce"
+	"tunn/pkg/config"
+	"tunn/pkg/connection"
+	"tunn/pkg/fairqueue"
+	"tunn/pkg/hooks"
+	"tunn/pkg/hostkey"
+	"tunn/pkg/proxy"
+	"tunn/pkg/redact"
+	"tunn/pkg/ssh"
+	"tunn/pkg/stats"
+	"tunn/pkg/tor"
+)
+
+// uplink describes one way of reaching the SSH server, such as a network
+// interface in multipath mode. Each uplink owns at most one live transport.
+type uplink struct {
+	name    string         // Human-readable name used in log output
+	config  *config.Config // Configuration used to establish this uplink
+	servers []*endpoint    // Failover servers in the order they are tried (nil without failover)
+	next    int            // Index of the server tried first on the next connect
+	live    *endpoint      // The server of the last established transport
+	retired chan struct{}  // Closed when a reload replaces the uplink
+}
+
+// endpoint is a failover server resolved into a complete configuration.
+type endpoint struct {
+	name   string         // Server name used in events and status
+	config *config.Config // Configuration used to connect to the server
+}
+
+// transport is an established SSH connection belonging to an uplink.
+type transport struct {
+	uplink  *uplink              // The uplink the transport was established over
+	server  string               // Name of the failover server connected to, or ""
+	client  *ssh.SSHClient       // The authenticated SSH client
+	reverse *proxy.SOCKS5        // Reverse SOCKS5 proxy on the server (nil if not running)
+	remote  []net.Listener       // Remote forwards open on the server
+	open    atomic.Int64         // Channels currently open, for least-connections balancing
+	fair    *fairqueue.Scheduler // Turns of the channels writing, used with fairQueue.enabled
+}
+
+// close stops the reverse SOCKS5 proxy and the remote forwards and closes the
+// SSH client.
+func (t *transport) close() {
+	if t.reverse != nil {
+		t.reverse.Stop()
+	}
+	for _, listener := range t.remote {
+		listener.Close()
+	}
+	t.client.Close()
+}
+
+// uplinks returns the uplinks to maintain for a configuration.
+//
+// Without multipath there is a single uplink using the top-level connect
+// settings. In multipath mode each configured uplink gets its own copy of the
+// configuration with the uplink's connect settings applied. With failover
+// servers, every uplink tries them in turn; when balancing, every server is
+// an uplink of its own instead. Uplinks never share the configuration itself,
+// since hooks write the credentials they fetch into it.
+//
+// Parameters:
+//   - cfg: The configuration to derive the uplinks from
+//
+// Returns:
+//   - []*uplink: The uplinks, not yet connected
+func uplinks(cfg *config.Config) []*uplink {
+	if cfg.Balance.Strategy != "" {
+		var list []*uplink
+		for _, server := range resolveServers(cfg) {
+			list = append(list, &uplink{name: server.name, config: server.config, retired: make(chan struct{})})
+		}
+		return list
+	}
+	if len(cfg.Multipath.Uplinks) == 0 {
+		own := *cfg
+		u := &uplink{name: "primary", config: &own, retired: make(chan struct{})}
+		u.servers = resolveServers(u.config)
+		return []*uplink{u}
+	}
+
+	list := make([]*uplink, 0, len(cfg.Multipath.Uplinks))
+	for i, connect := range cfg.Multipath.Uplinks {
+		own := *cfg
+		own.Connect = connect
+		own.Connect.Prefer = cmp.Or(connect.Prefer, cfg.Connect.Prefer)
+
+		name := connect.BindInterface
+		if name == "" {
+			name = connect.BindAddress
+		}
+		if name == "" {
+			name = fmt.Sprintf("uplink-%d", i+1)
+		}
+		list = append(list, &uplink{name: name, config: &own, servers: resolveServers(&own), retired: make(chan struct{})})
+	}
+	return list
+}
+
+// resolveServers applies each failover server to a copy of a configuration,
+// in the order the servers are tried.
+func resolveServers(cfg *config.Config) []*endpoint {
+	var servers []*endpoint
+	for _, s := range cfg.ServersByPriority() {
+		resolved := *cfg
+		resolved.Servers = nil
+		s.Apply(&resolved)
+		servers = append(servers, &endpoint{name: s.Name, config: &resolved})
+	}
+	return servers
+}
+
+// connect establishes and authenticates an SSH transport over an uplink.
+//
+// The transport is established with Connect, after which the access rules are
+// fetched from the server, the channel-open limit is applied and the liveness
+// watchdog is started if configured. With failover servers, the servers are
+// tried in turn starting from the uplink's next server, and the one that
+// connects becomes the uplink's live server.
+//
+// Parameters:
+//   - u: The uplink to connect over
+//
+// Returns:
+//   - *ssh.SSHClient: An authenticated SSH client
+//   - error: An error if any step fails
+func (m *Manager) connect(u *uplink) (*ssh.SSHClient, error) {
+	if len(u.servers) == 0 {
+		return m.connectWith(u.config)
+	}
+
+	var lastErr error
+	for i := range u.servers {
+		server := u.servers[(u.next+i)%len(u.servers)]
+		fmt.Printf("→ Trying server %s (%s)\n", server.name, net.JoinHostPort(server.config.SSH.Host, strconv.Itoa(server.config.SSH.Port)))
+		client, err := m.connectWith(server.config)
+		if err == nil {
+			if u.live != server {
+				fmt.Printf("✓ Server %s is live%s\n", server.name, m.onUplink(u))
+			}
+			u.live = server
+			return client, nil
+		}
+		fmt.Printf("✗ Server %s failed: %s\n", server.name, redact.Text(err.Error()))
+		lastErr = err
+	}
+	return nil, fmt.Errorf("all %d servers failed, last error: %w", len(u.servers), lastErr)
+}
+
+// failover moves an uplink on to the server after its live one, so a server
+// whose transport was lost is tried again last.
+func (m *Manager) failover(u *uplink) {
+	for i, server := range u.servers {
+		if server == u.live {
+			u.next = (i + 1) % len(u.servers)
+			fmt.Printf("→ Failing over from server %s to %s%s\n", server.name, u.servers[u.next].name, m.onUplink(u))
+			return
+		}
+	}
+}
+
+// onUplink names the uplink in failover events when there are several.
+func (m *Manager) onUplink(u *uplink) string {
+	if m.multipath() {
+		return " on uplink " + u.name
+	}
+	return ""
+}
+
+// connectWith establishes and authenticates an SSH transport for one
+// configuration; see connect.
+func (m *Manager) connectWith(cfg *config.Config) (*ssh.SSHClient, error) {
+	client, err := Connect(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := m.updateACL(client); err != nil {
+		client.Close()
+		return nil, err
+	}
+
+	queueTimeout := time.Duration(cfg.ChannelOpen.QueueTimeout) * time.Second
+	client.SetChannelLimit(cfg.ChannelOpen.MaxInFlight, queueTimeout)
+	client.SetDestinationLimit(cfg.ChannelOpen.PerDestination, time.Duration(cfg.ChannelOpen.FailureWindow)*time.Second, queueTimeout)
+
+	// Detect silently dropped transports so they get re-established
+	if cfg.Watchdog.Timeout > 0 {
+		client.StartWatchdog(
+			time.Duration(cfg.Watchdog.Timeout)*time.Second,
+			time.Duration(cfg.Watchdog.KeepaliveInterval)*time.Second,
+		)
+	}
+
+	return client, nil
+}
+
+// Connect establishes and authenticates a single SSH transport for a configuration.
+//
+// It is used by the Manager for every uplink and by commands that need a one-off
+// connection to the SSH server, such as "tunn bench".
+//
+// This function performs the following operations in sequence, resolving the
+// server hostname in the background from the start:
+//  1. Runs the pre-connect hook to refresh SSH credentials, if configured
+//  2. Checks the local Tor proxy when dialing over Tor, or probes for a
+//     captive portal when enabled
+//  3. Requests the wake URL and knocks the configured ports, if any
+//  4. Establishes the base connection (direct or through proxy), trying the
+//     strategies in turn in auto mode
+//  5. Creates the SSH client and starts the SSH transport layer
+//
+// Parameters:
+//   - cfg: The configuration to connect with; hook credentials are applied to it
+//
+// Returns:
+//   - *ssh.SSHClient: An authenticated SSH client
+//   - error: An error if any step fails
+func Connect(cfg *config.Config) (*ssh.SSHClient, error) {
+	// Resolve the server while the hook and probes run
+	connection.Prefetch(cfg)
+
+	// Refresh SSH credentials from the pre-connect hook
+	if hook := cfg.Hooks.PreConnect; hook != nil {
+		fmt.Println("→ Running pre-connect hook for SSH credentials")
+		creds, err := hooks.RunPreConnect(hook, cfg.SSH)
+		if err != nil {
+			return nil, err
+		}
+		creds.Apply(&cfg.SSH)
+		fmt.Printf("✓ Credentials received for user: %s\n", redact.Username(cfg.SSH.Username))
+	}
+
+	// Make sure the local Tor proxy is usable before dialing through it
+	if cfg.Tor.OverTor {
+		if err := tor.CheckLocal(cfg.Tor.SocksAddress); err != nil {
+			return nil, err
+		}
+		fmt.Printf("✓ Dialing through local Tor at %s\n", cfg.Tor.SocksAddress)
+	} else if cfg.CaptivePortal.Enabled {
+		// Report a network sign-in page instead of a confusing handshake failure
+		if err := connection.CheckCaptivePortal(cfg); err != nil {
+			return nil, err
+		}
+	}
+
+	// Open servers that keep sshd closed until knocked
+	if err := connection.Knock(cfg); err != nil {
+		return nil, err
+	}
+
+	if cfg.Mode == "auto" {
+		return connectAuto(cfg)
+	}
+	return dial(cfg)
+}
+
+// dial establishes the base connection for a direct or proxy configuration and
+// starts the SSH transport over it.
+func dial(cfg *config.Config) (*ssh.SSHClient, error) {
+	// Establish connection
+	establisher, err := connection.GetEstablisher(cfg.Mode)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get connection establisher: %w", err)
+	}
+
+	conn, err := establisher.Establish(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to establish connection: %w", err)
+	}
+
+	// Create SSH client and start SSH transport
+	client := ssh.NewSSHClient(conn, cfg.SSH.Username, cfg.SSH.Password)
+	client.SetAlgorithms(cfg.SSH.Ciphers, cfg.SSH.MACs)
+	if cfg.SSH.Agent {
+		client.UseAgent()
+	}
+	if cfg.SSH.PrivateKey != "" {
+		if err := client.UsePrivateKey([]byte(cfg.SSH.PrivateKey)); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	if cfg.SSH.KeyboardInteractive {
+		client.UseKeyboardInteractive(cfg.SSH.Answers)
+	}
+	client.SetHostKey(hostkey.Verify(hostkey.Policy{
+		Address:     net.JoinHostPort(cfg.SSH.Host, strconv.Itoa(cfg.SSH.Port)),
+		Fingerprint: cfg.SSH.HostKeyFingerprint,
+		KnownHosts:  cfg.SSH.KnownHosts,
+	}))
+	if err := client.StartTransport(); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to start SSH transport: %w", err)
+	}
+
+	return client, nil
+}
+
+// maintain keeps an uplink connected for the lifetime of the manager.
+//
+// The given transport (nil if the initial attempt failed) is watched, and
+// whenever it is lost the uplink is re-established with exponential backoff
+// until the manager shuts down, a reload replaces the uplink, or until
+// reconnect.maxAttempts attempts in a row have failed.
+//
+// Parameters:
+//   - u: The uplink to maintain
+//   - t: The initially attached transport, or nil
+func (m *Manager) maintain(u *uplink, t *transport) {
+	policy := u.config.Reconnect
+	initialDelay := time.Duration(policy.InitialDelay) * time.Second
+	maxDelay := time.Duration(policy.MaxDelay) * time.Second
+
+	delay := initialDelay
+	failures := 0
+	for {
+		if t != nil {
+			err := t.client.Wait()
+			m.detach(t, err)
+			t.close()
+			if u.isRetired() {
+				m.maintained.Add(-1)
+				return
+			}
+			delay = initialDelay
+			if len(u.servers) > 1 {
+				m.failover(u)
+				// Another server may well be up, so do not wait before trying it
+				delay = 0
+			}
+			if pause, ok := m.rejected(u, err); !ok {
+				return
+			} else if pause > 0 {
+				delay = pause
+			}
+		}
+
+		select {
+		case <-m.done:
+			return
+		case <-u.retired:
+			m.maintained.Add(-1)
+			return
+		case <-time.After(delay):
+		}
+
+		fmt.Printf("→ Reconnecting %s\n", m.describe(u))
+		client, err := m.connect(u)
+		if err != nil {
+			fmt.Printf("✗ Reconnect of %s failed: %s\n", m.describe(u), redact.Text(err.Error()))
+			if failures++; policy.MaxAttempts > 0 && failures >= policy.MaxAttempts {
+				m.giveUp(u, fmt.Errorf("gave up on %s after %d failed reconnects: %w", m.describe(u), failures, err))
+				return
+			}
+			delay = min(max(delay*2, initialDelay), maxDelay)
+			if pause, ok := m.rejected(u, err); !ok {
+				return
+			} else if pause > 0 {
+				delay = pause
+			}
+			t = nil
+			continue
+		}
+		failures = 0
+		t = m.newTransport(u, client)
+		m.attach(t)
+	}
+}
+
+// rejected applies the reconnect policy for servers rejecting the account,
+// e.g. for too many logins, which may ban clients that keep reconnecting.
+//
+// Parameters:
+//   - u: The uplink whose transport was lost or failed to connect
+//   - err: The reason
+//
+// Returns:
+//   - time.Duration: The delay before reconnecting, or 0 for the usual delay
+//   - bool: false if the uplink was given up on
+func (m *Manager) rejected(u *uplink, err error) (time.Duration, bool) {
+	rejection := ssh.AsRejection(err)
+	if rejection == nil {
+		return 0, true
+	}
+	policy := u.config.Reconnect
+	if policy.StopWhenRejected {
+		m.giveUp(u, fmt.Errorf("gave up on %s: %w", m.describe(u), rejection))
+		return 0, false
+	}
+	if policy.RejectedDelay == 0 {
+		return 0, true
+	}
+	delay := time.Duration(policy.RejectedDelay) * time.Second
+	fmt.Printf("→ Waiting %s before reconnecting %s, the server rejected the account (%s)\n", delay, m.describe(u), rejection.Kind)
+	return delay, true
+}
+
+// newTransport wraps a client freshly connected over an uplink.
+func (m *Manager) newTransport(u *uplink, client *ssh.SSHClient) *transport {
+	t := &transport{uplink: u, client: client, fair: fairqueue.NewScheduler()}
+	if u.live != nil {
+		t.server = u.live.name
+	}
+	return t
+}
+
+// giveUp stops maintaining an uplink. Once no uplink is maintained any more,
+// the tunnel is stopped and Start returns the reason.
+func (m *Manager) giveUp(u *uplink, reason error) {
+	fmt.Printf("✗ Giving up on %s\n", m.describe(u))
+	if m.maintained.Add(-1) > 0 {
+		return
+	}
+	m.mu.Lock()
+	m.failure = reason
+	m.mu.Unlock()
+	m.Stop()
+}
+
+// attach adds a transport to the list of live transports and opens the
+// reverse SOCKS5 proxy and the remote forwards on its server.
+//
+// The first transport in the list is active and serves new connections; any
+// further transports are kept as hot standbys. When balancing, all of them
+// serve new connections.
+func (m *Manager) attach(t *transport) {
+	t.reverse = m.startReverseSOCKS(t.client)
+	t.remote = m.startRemoteForwards(t.client)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.closing || t.uplink.isRetired() {
+		t.close()
+		return
+	}
+
+	m.transports = append(m.transports, t)
+	if m.balancing() {
+		fmt.Printf("✓ Server %s joined the pool (%d of %d connected)\n", t.uplink.name, len(m.transports), len(m.cfg().Servers))
+		return
+	}
+	if !m.multipath() {
+		return
+	}
+	if len(m.transports) == 1 {
+		fmt.Printf("✓ Uplink %s is active\n", t.uplink.name)
+	} else {
+		fmt.Printf("✓ Uplink %s ready as standby\n", t.uplink.name)
+	}
+}
+
+// detach removes a lost transport and promotes the next standby if the active
+// transport was lost.
+func (m *Manager) detach(t *transport, reason error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i, cur := range m.transports {
+		if cur != t {
+			continue
+		}
+		m.transports = append(m.transports[:i], m.transports[i+1:]...)
+		if m.closing {
+			return
+		}
+
+		fmt.Printf("✗ Lost %s: %s\n", m.describe(t.uplink), redact.Text(fmt.Sprint(reason)))
+		if i == 0 && len(m.transports) > 0 && !m.balancing() {
+			fmt.Printf("✓ Switched to standby uplink %s\n", m.transports[0].uplink.name)
+		}
+		return
+	}
+}
+
+// isRetired reports whether a reload has replaced the uplink.
+func (u *uplink) isRetired() bool {
+	select {
+	case <-u.retired:
+		return true
+	default:
+		return false
+	}
+}
+
+// multipath reports whether the manager maintains more than one uplink.
+func (m *Manager) multipath() bool {
+	return len(m.cfg().Multipath.Uplinks) > 0
+}
+
+// describe returns a human-readable name for an uplink in log output.
+func (m *Manager) describe(u *uplink) string {
+	if m.balancing() {
+		return "server " + u.name
+	}
+	if m.multipath() {
+		return "uplink " + u.name
+	}
+	return "tunnel connection"
+}
+
+// Dial establishes a connection through the active SSH transport, or the one
+// picked by the balancing strategy.
+//
+// The Manager implements the dialer interface used by the local proxies, so
+// transports can be replaced after reconnects or failovers without restarting
+// the proxy servers. With fairQueue.enabled, the writes of the connection take
+// turns with those of the other channels of its transport, and with
+// coalesce.delay set, small writes to the connection are batched.
+//
+// Parameters:
+//   - network: Network type, typically "tcp"
+//   - address: Target address in "host:port" format
+//
+// Returns:
+//   - net.Conn: A connection to the target through the tunnel
+//   - error: An error if no transport is available or the channel cannot be opened
+func (m *Manager) Dial(network, address string) (net.Conn, error) {
+	m.mu.RLock()
+	if len(m.transports) == 0 {
+		m.mu.RUnlock()
+		return nil, fmt.Errorf("tunnel is not connected")
+	}
+	t := m.transports[0]
+	if m.balancing() {
+		t = m.pick()
+	}
+	m.mu.RUnlock()
+
+	t.open.Add(1)
+	conn, err := t.client.Dial(network, address)
+	if err != nil {
+		t.open.Add(-1)
+		return nil, err
+	}
+	if fair := m.cfg().FairQueue; fair.Enabled {
+		conn = t.fair.Wrap(conn, fair.Quantum)
+	}
+	if delay := m.cfg().Coalesce.Delay; delay > 0 {
+		conn = coalesce.NewConn(conn, time.Duration(delay)*time.Millisecond, m.cfg().Coalesce.BufferSize)
+	}
+	m.stats.ChannelOpened()
+	return &channelConn{Conn: conn, stats: m.stats, transport: t}, nil
+}
+
+// channelConn counts an SSH channel as open until it is first closed.
+type channelConn struct {
+	net.Conn
+	stats     *stats.Stats
+	transport *transport // The transport the channel was opened on
+	closed    sync.Once
+}
+
+// Close closes the channel and records it as closed.
+func (c *channelConn) Close() error {
+	err := c.Conn.Close()
+	c.closed.Do(func() {
+		c.stats.ChannelClosed()
+		c.transport.open.Add(-1)
+	})
+	return err
+}
+
+// CloseWrite half-closes the channel, signaling EOF to the destination.
+func (c *channelConn) CloseWrite() error {
+	if cw, ok := c.Conn.(interface{ CloseWrite() error }); ok {
+		return cw.CloseWrite()
+	}
+	return c.Close()
+}
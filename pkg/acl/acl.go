@@ -0,0 +1,360 @@
+// Package acl implements destination access rules for proxied connections.
+//
+// Rules are written one per line as an action followed by a destination
+// pattern, and are evaluated in order with the first match deciding:
+//
+//	# comments and blank lines are ignored
+//	allow *.example.com:443
+//	allow 10.0.0.0/8
+//	deny  *:25
+//	deny  *
+//
+// A pattern is a host and an optional port. The host is "*", a hostname with an
+// optional "*." prefix matching any subdomain, an IP address or a CIDR range
+// (IPv6 addresses with a port are written in brackets). The port is a single
+// port, a range such as 8000-9000, or "*". Destinations matching no rule are
+// allowed, so an allowlist ends with "deny *".
+//
+// The host can also be "country:" followed by an ISO country code or "asn:"
+// followed by an autonomous system number, matching destinations whose
+// address is located in that country or announced by that network:
+//
+//	deny country:KP
+//	allow asn:13335:443
+//
+// Such rules need a Locator, which resolves hostnames and looks the addresses
+// up in GeoIP databases; without one they never match.
+//
+// Rule lists are typically fetched from the SSH server at connect time, letting
+// the server operator control what shared accounts may reach.
+package acl
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/netip"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrDenied is returned when a destination is rejected by the rules.
+var ErrDenied = errors.New("destination denied by access rules")
+
+// Rule is a single allow or deny rule.
+type Rule struct {
+	Allow   bool         // Whether matching destinations are allowed
+	Host    string       // Lowercase host pattern; "" matches any host
+	Prefix  netip.Prefix // Address range, valid when the pattern is an IP or CIDR
+	Country string       // Uppercase ISO country code of "country:" rules
+	ASN     uint32       // Autonomous system number of "asn:" rules
+	MinPort int          // Lowest matching port (0 for any)
+	MaxPort int          // Highest matching port (0 for any)
+	Line    int          // Line number in the rule source
+}
+
+// List is an ordered list of rules.
+type List struct {
+	Rules []Rule
+}
+
+// Parse reads a rule list.
+//
+// Parameters:
+//   - r: The rule source
+//
+// Returns:
+//   - *List: The parsed rules
+//   - error: An error naming the offending line if a rule is malformed
+func Parse(r io.Reader) (*List, error) {
+	list := &List{}
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := scanner.Text()
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("line %d: expected '<allow|deny> <destination>'", n)
+		}
+
+		rule, err := parseRule(fields[0], fields[1])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", n, err)
+		}
+		rule.Line = n
+		list.Rules = append(list.Rules, rule)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read rules: %w", err)
+	}
+	return list, nil
+}
+
+// parseRule parses a single action and destination pattern.
+func parseRule(action, pattern string) (Rule, error) {
+	var rule Rule
+	switch strings.ToLower(action) {
+	case "allow":
+		rule.Allow = true
+	case "deny":
+	default:
+		return rule, fmt.Errorf("unknown action '%s' (expected allow or deny)", action)
+	}
+
+	host, port := splitPattern(pattern)
+	if kind, value, ok := geoPattern(pattern); ok {
+		host, port, _ = strings.Cut(value, ":")
+		if err := rule.setGeo(kind, host); err != nil {
+			return rule, err
+		}
+		host = ""
+	}
+	if port != "" && port != "*" {
+		lo, hi, found := strings.Cut(port, "-")
+		if !found {
+			hi = lo
+		}
+		minPort, err1 := strconv.Atoi(lo)
+		maxPort, err2 := strconv.Atoi(hi)
+		if err1 != nil || err2 != nil || minPort < 1 || maxPort > 65535 || minPort > maxPort {
+			return rule, fmt.Errorf("invalid port '%s'", port)
+		}
+		rule.MinPort, rule.MaxPort = minPort, maxPort
+	}
+
+	switch {
+	case host == "" || host == "*":
+	case strings.Contains(host, "/"):
+		prefix, err := netip.ParsePrefix(host)
+		if err != nil {
+			return rule, fmt.Errorf("invalid address range '%s'", host)
+		}
+		rule.Prefix = prefix.Masked()
+	default:
+		if addr, err := netip.ParseAddr(host); err == nil {
+			rule.Prefix = netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen())
+		} else if strings.Contains(strings.TrimPrefix(host, "*."), "*") {
+			return rule, fmt.Errorf("invalid host pattern '%s' (only a leading '*.' is supported)", host)
+		} else {
+			rule.Host = strings.ToLower(host)
+		}
+	}
+	return rule, nil
+}
+
+// splitPattern splits a destination pattern into host and port.
+//
+// Bare IPv6 addresses and ranges contain colons and therefore have no port
+// unless written in brackets.
+func splitPattern(pattern string) (host, port string) {
+	if strings.HasPrefix(pattern, "[") {
+		if h, p, err := net.SplitHostPort(pattern); err == nil {
+			return h, p
+		}
+		return strings.Trim(pattern, "[]"), ""
+	}
+	if strings.Count(pattern, ":") == 1 {
+		h, p, _ := strings.Cut(pattern, ":")
+		return h, p
+	}
+	return pattern, ""
+}
+
+// geoPattern splits a "country:" or "asn:" pattern into its kind and the
+// value with an optional port.
+func geoPattern(pattern string) (kind, value string, ok bool) {
+	kind, value, ok = strings.Cut(pattern, ":")
+	kind = strings.ToLower(kind)
+	return kind, value, ok && (kind == "country" || kind == "asn")
+}
+
+// setGeo sets the country or autonomous system a geo rule matches.
+func (r *Rule) setGeo(kind, value string) error {
+	if kind == "country" {
+		if len(value) != 2 || strings.Trim(strings.ToUpper(value), "ABCDEFGHIJKLMNOPQRSTUVWXYZ") != "" {
+			return fmt.Errorf("invalid country code '%s' (expected two letters, e.g. US)", value)
+		}
+		r.Country = strings.ToUpper(value)
+		return nil
+	}
+	n, err := strconv.ParseUint(strings.TrimPrefix(strings.ToUpper(value), "AS"), 10, 32)
+	if err != nil || n == 0 {
+		return fmt.Errorf("invalid AS number '%s'", value)
+	}
+	r.ASN = uint32(n)
+	return nil
+}
+
+// geo reports whether the rule matches on the location of the destination.
+func (r *Rule) geo() bool {
+	return r.Country != "" || r.ASN != 0
+}
+
+// matches reports whether the rule matches a destination.
+func (r *Rule) matches(host string, port int, locate func() []Location) bool {
+	if r.MinPort != 0 && (port < r.MinPort || port > r.MaxPort) {
+		return false
+	}
+
+	if r.geo() {
+		for _, loc := range locate() {
+			if (r.Country != "" && loc.Country == r.Country) || (r.ASN != 0 && loc.ASN == r.ASN) {
+				return true
+			}
+		}
+		return false
+	}
+
+	if r.Prefix.IsValid() {
+		addr, err := netip.ParseAddr(host)
+		return err == nil && r.Prefix.Contains(addr.Unmap())
+	}
+	switch {
+	case r.Host == "":
+		return true
+	case strings.HasPrefix(r.Host, "*."):
+		return strings.HasSuffix(host, r.Host[1:])
+	default:
+		return host == r.Host
+	}
+}
+
+// Location is where an address of a destination is located.
+type Location struct {
+	Country string // Uppercase ISO country code, or "" if unknown
+	ASN     uint32 // Number of the autonomous system announcing it, or 0 if unknown
+}
+
+// Locator finds where a destination is located, for country and ASN rules.
+type Locator interface {
+	// Locate resolves a hostname, or takes an IP address as is, and returns
+	// the location of each address
+	Locate(ctx context.Context, host string) ([]Location, error)
+}
+
+// locateTimeout bounds the resolution of one destination.
+const locateTimeout = 5 * time.Second
+
+// Allowed reports whether a destination is allowed by the rules.
+//
+// Hostnames are matched as given; they are not resolved, so address and range
+// rules only apply to destinations requested by IP address. Country and ASN
+// rules resolve the destination through the locator, once and only when such
+// a rule is reached; they match when any of its addresses is located as the
+// rule says, and never match when the destination cannot be located.
+//
+// Parameters:
+//   - host: Destination hostname or IP address
+//   - port: Destination port
+//   - locator: Locates destinations for country and ASN rules, or nil
+//
+// Returns:
+//   - bool: Whether the destination is allowed
+//   - *Rule: The deciding rule, or nil if no rule matched
+func (l *List) Allowed(host string, port int, locator Locator) (bool, *Rule) {
+	host = strings.ToLower(strings.TrimSuffix(strings.Trim(host, "[]"), "."))
+
+	var locations []Location
+	located := false
+	locate := func() []Location {
+		if !located && locator != nil {
+			ctx, cancel := context.WithTimeout(context.Background(), locateTimeout)
+			defer cancel()
+			var err error
+			if locations, err = locator.Locate(ctx, host); err != nil {
+				fmt.Printf("✗ Failed to locate %s for access rules: %v\n", host, err)
+			}
+		}
+		located = true
+		return locations
+	}
+
+	for i := range l.Rules {
+		if l.Rules[i].matches(host, port, locate) {
+			return l.Rules[i].Allow, &l.Rules[i]
+		}
+	}
+	return true, nil
+}
+
+// UsesGeo reports whether any rule matches on country or ASN.
+func (l *List) UsesGeo() bool {
+	for i := range l.Rules {
+		if l.Rules[i].geo() {
+			return true
+		}
+	}
+	return false
+}
+
+// Policy holds the rule list currently in force and can be updated while
+// connections are being checked. The zero value allows every destination.
+type Policy struct {
+	mu      sync.RWMutex
+	list    *List
+	locator Locator
+}
+
+// Set replaces the rule list in force.
+//
+// Parameters:
+//   - list: The new rules, or nil to allow every destination
+func (p *Policy) Set(list *List) {
+	p.mu.Lock()
+	p.list = list
+	p.mu.Unlock()
+}
+
+// SetLocator sets how destinations are located for country and ASN rules.
+//
+// Parameters:
+//   - locator: The locator, or nil to leave such rules unmatched
+func (p *Policy) SetLocator(locator Locator) {
+	p.mu.Lock()
+	p.locator = locator
+	p.mu.Unlock()
+}
+
+// Active reports whether a rule list is in force.
+func (p *Policy) Active() bool {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.list != nil
+}
+
+// Check checks a destination address against the rules in force.
+//
+// Parameters:
+//   - address: Destination in "host:port" format
+//
+// Returns:
+//   - error: An error wrapping ErrDenied if the destination is rejected
+func (p *Policy) Check(address string) error {
+	p.mu.RLock()
+	list, locator := p.list, p.locator
+	p.mu.RUnlock()
+	if list == nil {
+		return nil
+	}
+
+	host, portStr, err := net.SplitHostPort(address)
+	if err != nil {
+		return fmt.Errorf("invalid destination '%s': %w", address, err)
+	}
+	port, _ := strconv.Atoi(portStr)
+
+	if ok, rule := list.Allowed(host, port, locator); !ok {
+		return fmt.Errorf("%w: %s (rule on line %d)", ErrDenied, address, rule.Line)
+	}
+	return nil
+}
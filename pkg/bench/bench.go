@@ -0,0 +1,191 @@
+// Package bench measures tunnel throughput for the "tunn bench" command.
+//
+// Two kinds of measurements are provided. Server probes stream data through an
+// SSH exec session to the server's own loopback (reading /dev/zero and writing
+// to /dev/null), which measures the capacity of the path to the SSH server alone.
+// Destination probes download a URL through a tunneled SSH channel, which also
+// includes the speed of the route from the server to the destination. Comparing
+// the two separates a slow server from a slow destination.
+package bench
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// chunkSize is the buffer size used for streaming probe data.
+const chunkSize = 32 * 1024
+
+// SessionOpener opens SSH exec sessions on the server.
+type SessionOpener interface {
+	NewSession() (*ssh.Session, error)
+}
+
+// Dialer opens tunneled connections to destinations.
+type Dialer interface {
+	Dial(network, address string) (net.Conn, error)
+}
+
+// Result holds the outcome of a single throughput measurement.
+type Result struct {
+	Bytes    int64         // Bytes transferred
+	Duration time.Duration // Time the transfer took
+}
+
+// Rate returns the measured throughput in bytes per second.
+func (r Result) Rate() float64 {
+	if r.Duration <= 0 {
+		return 0
+	}
+	return float64(r.Bytes) / r.Duration.Seconds()
+}
+
+// ServerDownload measures throughput from the SSH server to the client.
+//
+// The server streams /dev/zero through an exec session for the given duration.
+// The server must allow exec sessions and provide a POSIX shell with cat.
+//
+// Parameters:
+//   - client: The SSH client to open the session on
+//   - duration: How long to measure
+//
+// Returns:
+//   - Result: Bytes received and the measurement time
+//   - error: An error if the session cannot be started or no data arrives
+func ServerDownload(client SessionOpener, duration time.Duration) (Result, error) {
+	session, err := client.NewSession()
+	if err != nil {
+		return Result{}, fmt.Errorf("server refused exec session: %w", err)
+	}
+	defer session.Close()
+
+	stdout, err := session.StdoutPipe()
+	if err != nil {
+		return Result{}, err
+	}
+	if err := session.Start("cat /dev/zero"); err != nil {
+		return Result{}, fmt.Errorf("failed to start remote command: %w", err)
+	}
+
+	var received atomic.Int64
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		buf := make([]byte, chunkSize)
+		for {
+			n, err := stdout.Read(buf)
+			received.Add(int64(n))
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	start := time.Now()
+	select {
+	case <-done:
+	case <-time.After(duration):
+	}
+	result := Result{Bytes: received.Load(), Duration: time.Since(start)}
+
+	if result.Bytes == 0 {
+		return result, fmt.Errorf("server sent no data; it may not support streaming /dev/zero")
+	}
+	return result, nil
+}
+
+// ServerUpload measures throughput from the client to the SSH server.
+//
+// Zeros are written into an exec session that discards them to /dev/null. The
+// measurement ends once the server has consumed everything sent during the
+// given duration, so data still buffered in flight is not counted as delivered.
+//
+// Parameters:
+//   - client: The SSH client to open the session on
+//   - duration: How long to send data
+//
+// Returns:
+//   - Result: Bytes delivered and the time until the server consumed them
+//   - error: An error if the session fails
+func ServerUpload(client SessionOpener, duration time.Duration) (Result, error) {
+	session, err := client.NewSession()
+	if err != nil {
+		return Result{}, fmt.Errorf("server refused exec session: %w", err)
+	}
+	defer session.Close()
+
+	stdin, err := session.StdinPipe()
+	if err != nil {
+		return Result{}, err
+	}
+	if err := session.Start("cat > /dev/null"); err != nil {
+		return Result{}, fmt.Errorf("failed to start remote command: %w", err)
+	}
+
+	buf := make([]byte, chunkSize)
+	var sent int64
+	start := time.Now()
+	for time.Since(start) < duration {
+		n, err := stdin.Write(buf)
+		sent += int64(n)
+		if err != nil {
+			return Result{Bytes: sent, Duration: time.Since(start)}, fmt.Errorf("upload interrupted: %w", err)
+		}
+	}
+	stdin.Close()
+
+	if err := session.Wait(); err != nil {
+		return Result{}, fmt.Errorf("remote command failed: %w", err)
+	}
+	return Result{Bytes: sent, Duration: time.Since(start)}, nil
+}
+
+// Destination measures download throughput from a URL through the tunnel.
+//
+// Parameters:
+//   - dialer: The dialer opening tunneled connections
+//   - url: HTTP(S) URL of a large file to download
+//   - duration: Maximum time to measure
+//
+// Returns:
+//   - Result: Bytes received and the measurement time
+//   - error: An error if the request fails
+func Destination(dialer Dialer, url string, duration time.Duration) (Result, error) {
+	client := &http.Client{
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, network, address string) (net.Conn, error) {
+				return dialer.Dial(network, address)
+			},
+		},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), duration)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return Result{}, err
+	}
+
+	start := time.Now()
+	resp, err := client.Do(req)
+	if err != nil {
+		return Result{}, fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return Result{}, fmt.Errorf("request failed: %s", resp.Status)
+	}
+
+	// The context deadline ends the body read; that is the normal end of the measurement
+	n, _ := io.Copy(io.Discard, resp.Body)
+	return Result{Bytes: n, Duration: time.Since(start)}, nil
+}
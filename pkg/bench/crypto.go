@@ -0,0 +1,171 @@
+package bench
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"fmt"
+	"io"
+	"net"
+	"time"
+
+	tunnssh "tunn/pkg/ssh"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// benchChannelType is the channel type opened by the in-process crypto benchmark.
+const benchChannelType = "tunn-bench"
+
+// Algorithm is an SSH cipher and MAC combination.
+type Algorithm struct {
+	Cipher string // SSH cipher name
+	MAC    string // SSH MAC name, empty for AEAD ciphers
+}
+
+// String returns the combination in "cipher + mac" form.
+func (a Algorithm) String() string {
+	if a.MAC == "" {
+		return a.Cipher
+	}
+	return a.Cipher + " + " + a.MAC
+}
+
+// Algorithms returns the combinations measured by Crypto: every AEAD cipher on
+// its own, and every CTR cipher with the encrypt-then-MAC SHA-2 MACs.
+func Algorithms() []Algorithm {
+	var list []Algorithm
+	for _, cipher := range tunnssh.Ciphers {
+		if tunnssh.IsAEAD(cipher) {
+			list = append(list, Algorithm{Cipher: cipher})
+			continue
+		}
+		for _, mac := range []string{"hmac-sha2-256-etm@openssh.com", "hmac-sha2-512-etm@openssh.com"} {
+			list = append(list, Algorithm{Cipher: cipher, MAC: mac})
+		}
+	}
+	return list
+}
+
+// Crypto measures the local throughput of an SSH cipher and MAC combination.
+//
+// An in-process SSH client and server are connected over loopback TCP and
+// the server streams data to the client over a channel, so the result reflects
+// the CPU cost of encryption, decryption and authentication without any network.
+// Both sides run on the same CPU, so results are meant for comparing algorithms
+// rather than predicting absolute tunnel speed.
+//
+// Parameters:
+//   - algorithm: The cipher and MAC to negotiate
+//   - duration: How long to measure
+//
+// Returns:
+//   - Result: Bytes transferred and the measurement time
+//   - error: An error if the handshake or channel fails
+func Crypto(algorithm Algorithm, duration time.Duration) (Result, error) {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return Result{}, fmt.Errorf("failed to generate host key: %w", err)
+	}
+	signer, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		return Result{}, fmt.Errorf("failed to create host key signer: %w", err)
+	}
+
+	algorithms := ssh.Config{Ciphers: []string{algorithm.Cipher}}
+	if algorithm.MAC != "" {
+		algorithms.MACs = []string{algorithm.MAC}
+	}
+
+	serverConfig := &ssh.ServerConfig{Config: algorithms, NoClientAuth: true}
+	serverConfig.AddHostKey(signer)
+	clientConfig := &ssh.ClientConfig{
+		Config:          algorithms,
+		User:            "bench",
+		HostKeyCallback: ssh.FixedHostKey(signer.PublicKey()),
+	}
+
+	// Both SSH peers write their version line at once, which would deadlock
+	// on an unbuffered net.Pipe, so the peers talk over loopback TCP.
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return Result{}, fmt.Errorf("failed to listen on loopback: %w", err)
+	}
+	defer listener.Close()
+	go func() {
+		serverSide, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer serverSide.Close()
+		serveCrypto(serverSide, serverConfig)
+	}()
+
+	clientSide, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		return Result{}, fmt.Errorf("failed to connect on loopback: %w", err)
+	}
+	defer clientSide.Close()
+
+	conn, chans, reqs, err := ssh.NewClientConn(clientSide, listener.Addr().String(), clientConfig)
+	if err != nil {
+		return Result{}, fmt.Errorf("handshake with %s failed: %w", algorithm, err)
+	}
+	client := ssh.NewClient(conn, chans, reqs)
+	defer client.Close()
+
+	channel, channelReqs, err := client.OpenChannel(benchChannelType, nil)
+	if err != nil {
+		return Result{}, fmt.Errorf("failed to open benchmark channel: %w", err)
+	}
+	go ssh.DiscardRequests(channelReqs)
+	defer channel.Close()
+
+	buf := make([]byte, chunkSize)
+	var received int64
+	start := time.Now()
+	deadline := start.Add(duration)
+	for time.Now().Before(deadline) {
+		n, err := channel.Read(buf)
+		received += int64(n)
+		if err != nil {
+			return Result{}, fmt.Errorf("benchmark channel closed: %w", err)
+		}
+	}
+	return Result{Bytes: received, Duration: time.Since(start)}, nil
+}
+
+// serveCrypto runs the server side of the crypto benchmark, streaming zeros on
+// every benchmark channel until the connection closes.
+func serveCrypto(conn net.Conn, config *ssh.ServerConfig) {
+	serverConn, chans, reqs, err := ssh.NewServerConn(conn, config)
+	if err != nil {
+		return
+	}
+	defer serverConn.Close()
+	go ssh.DiscardRequests(reqs)
+
+	for newChannel := range chans {
+		if newChannel.ChannelType() != benchChannelType {
+			newChannel.Reject(ssh.UnknownChannelType, "unsupported channel type")
+			continue
+		}
+		channel, channelReqs, err := newChannel.Accept()
+		if err != nil {
+			continue
+		}
+		go ssh.DiscardRequests(channelReqs)
+		go func() {
+			defer channel.Close()
+			io.Copy(channel, zeroReader{})
+		}()
+	}
+}
+
+// zeroReader is an endless source of zero bytes.
+type zeroReader struct{}
+
+// Read implements io.Reader.
+func (zeroReader) Read(p []byte) (int, error) {
+	clear(p)
+	return len(p), nil
+}
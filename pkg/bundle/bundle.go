@@ -0,0 +1,258 @@
+// Package bundle reads and writes encrypted archives of a Tunn setup.
+//
+// A bundle carries the files needed to move a working setup to another
+// machine, such as a router or a second laptop, without a network connection
+// between them: the configuration and its includes, the files it references,
+// the user preset catalog and the saved connection state.
+//
+// The archive is a gzip-compressed tar file starting with a manifest, sealed
+// with XChaCha20-Poly1305 under a key derived from a passphrase with Argon2id.
+// The key derivation parameters are stored in the unencrypted header, which is
+// authenticated along with the archive, so tampering with any byte is detected.
+package bundle
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+// Roles of the files in a bundle.
+const (
+	RoleConfig  = "config"  // The root configuration file
+	RoleInclude = "include" // A file included by the configuration
+	RoleFile    = "file"    // A file referenced by the configuration, such as a TLS key
+	RolePresets = "presets" // The user preset catalog
+	RoleState   = "state"   // The saved connection state
+)
+
+// magic identifies a bundle file.
+const magic = "TUNNBNDL"
+
+// formatVersion is the version of the bundle layout.
+const formatVersion = 1
+
+// manifestName is the name of the manifest inside the archive.
+const manifestName = "manifest.json"
+
+// maxBundleSize bounds the size of a bundle accepted by Read.
+const maxBundleSize = 64 << 20
+
+// Argon2id parameters for new bundles. The memory cost is kept moderate so
+// that bundles can be imported on routers with little RAM.
+const (
+	argonTime    = 3
+	argonMemory  = 32 * 1024 // KiB
+	argonThreads = 2
+)
+
+// ErrPassphrase is returned by Read when the passphrase is wrong or the bundle
+// has been modified.
+var ErrPassphrase = errors.New("wrong passphrase or corrupted bundle")
+
+// Entry is a file in a bundle.
+type Entry struct {
+	Name   string // Slash-separated path inside the bundle
+	Role   string // What the file is, one of the Role constants
+	Origin string // Path the file was exported from
+	Data   []byte // File content
+}
+
+// manifest describes the entries of a bundle.
+type manifest struct {
+	Created time.Time       `json:"created"`
+	Entries []manifestEntry `json:"entries"`
+}
+
+// manifestEntry describes one entry in the manifest.
+type manifestEntry struct {
+	Name   string `json:"name"`
+	Role   string `json:"role"`
+	Origin string `json:"origin"`
+}
+
+// header is the unencrypted start of a bundle file.
+type header struct {
+	Magic   [8]byte
+	Version uint8
+	Time    uint32   // Argon2id passes
+	Memory  uint32   // Argon2id memory in KiB
+	Threads uint8    // Argon2id parallelism
+	Salt    [16]byte // Argon2id salt
+	Nonce   [chacha20poly1305.NonceSizeX]byte
+}
+
+// Write encrypts entries into a bundle.
+//
+// Parameters:
+//   - w: Destination of the bundle
+//   - passphrase: The passphrase protecting the bundle
+//   - entries: The files to include; names must be unique relative paths
+//
+// Returns:
+//   - error: An error if an entry name is invalid or writing fails
+func Write(w io.Writer, passphrase []byte, entries []Entry) error {
+	m := manifest{Created: time.Now().UTC()}
+	seen := map[string]bool{manifestName: true}
+	for _, e := range entries {
+		if err := checkName(e.Name); err != nil {
+			return err
+		}
+		if seen[e.Name] {
+			return fmt.Errorf("duplicate bundle entry %s", e.Name)
+		}
+		seen[e.Name] = true
+		m.Entries = append(m.Entries, manifestEntry{Name: e.Name, Role: e.Role, Origin: e.Origin})
+	}
+	manifestData, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode manifest: %w", err)
+	}
+
+	var archive bytes.Buffer
+	gz := gzip.NewWriter(&archive)
+	tw := tar.NewWriter(gz)
+	files := append([]Entry{{Name: manifestName, Data: manifestData}}, entries...)
+	for _, e := range files {
+		hdr := &tar.Header{Name: e.Name, Mode: 0600, Size: int64(len(e.Data)), ModTime: m.Created}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return fmt.Errorf("failed to write bundle: %w", err)
+		}
+		if _, err := tw.Write(e.Data); err != nil {
+			return fmt.Errorf("failed to write bundle: %w", err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return fmt.Errorf("failed to write bundle: %w", err)
+	}
+	if err := gz.Close(); err != nil {
+		return fmt.Errorf("failed to write bundle: %w", err)
+	}
+
+	h := header{Version: formatVersion, Time: argonTime, Memory: argonMemory, Threads: argonThreads}
+	copy(h.Magic[:], magic)
+	if _, err := rand.Read(h.Salt[:]); err != nil {
+		return fmt.Errorf("failed to generate salt: %w", err)
+	}
+	if _, err := rand.Read(h.Nonce[:]); err != nil {
+		return fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	var headerData bytes.Buffer
+	binary.Write(&headerData, binary.BigEndian, h)
+
+	aead, err := chacha20poly1305.NewX(deriveKey(passphrase, h))
+	if err != nil {
+		return err
+	}
+	sealed := aead.Seal(headerData.Bytes(), h.Nonce[:], archive.Bytes(), headerData.Bytes())
+	if _, err := w.Write(sealed); err != nil {
+		return fmt.Errorf("failed to write bundle: %w", err)
+	}
+	return nil
+}
+
+// Read decrypts a bundle and returns its entries.
+//
+// Parameters:
+//   - r: Source of the bundle
+//   - passphrase: The passphrase the bundle was written with
+//
+// Returns:
+//   - []Entry: The files in the bundle, in the order they were written
+//   - time.Time: When the bundle was created
+//   - error: ErrPassphrase if decryption fails, or an error if the bundle is malformed
+func Read(r io.Reader, passphrase []byte) ([]Entry, time.Time, error) {
+	data, err := io.ReadAll(io.LimitReader(r, maxBundleSize+1))
+	if err != nil {
+		return nil, time.Time{}, fmt.Errorf("failed to read bundle: %w", err)
+	}
+	if len(data) > maxBundleSize {
+		return nil, time.Time{}, fmt.Errorf("bundle exceeds %d bytes", maxBundleSize)
+	}
+
+	var h header
+	headerSize := binary.Size(h)
+	if len(data) < headerSize || string(data[:len(magic)]) != magic {
+		return nil, time.Time{}, fmt.Errorf("not a tunn bundle")
+	}
+	binary.Read(bytes.NewReader(data), binary.BigEndian, &h)
+	if h.Version != formatVersion {
+		return nil, time.Time{}, fmt.Errorf("unsupported bundle version %d", h.Version)
+	}
+	if h.Time == 0 || h.Threads == 0 || h.Memory > 1024*1024 {
+		return nil, time.Time{}, fmt.Errorf("invalid bundle key parameters")
+	}
+
+	aead, err := chacha20poly1305.NewX(deriveKey(passphrase, h))
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	archive, err := aead.Open(nil, h.Nonce[:], data[headerSize:], data[:headerSize])
+	if err != nil {
+		return nil, time.Time{}, ErrPassphrase
+	}
+
+	gz, err := gzip.NewReader(bytes.NewReader(archive))
+	if err != nil {
+		return nil, time.Time{}, fmt.Errorf("invalid bundle archive: %w", err)
+	}
+	files := map[string][]byte{}
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, time.Time{}, fmt.Errorf("invalid bundle archive: %w", err)
+		}
+		content, err := io.ReadAll(tr)
+		if err != nil {
+			return nil, time.Time{}, fmt.Errorf("invalid bundle archive: %w", err)
+		}
+		files[hdr.Name] = content
+	}
+
+	var m manifest
+	if err := json.Unmarshal(files[manifestName], &m); err != nil {
+		return nil, time.Time{}, fmt.Errorf("invalid bundle manifest: %w", err)
+	}
+	entries := make([]Entry, 0, len(m.Entries))
+	for _, me := range m.Entries {
+		if err := checkName(me.Name); err != nil {
+			return nil, time.Time{}, err
+		}
+		content, ok := files[me.Name]
+		if !ok {
+			return nil, time.Time{}, fmt.Errorf("bundle entry %s is missing", me.Name)
+		}
+		entries = append(entries, Entry{Name: me.Name, Role: me.Role, Origin: me.Origin, Data: content})
+	}
+	return entries, m.Created, nil
+}
+
+// deriveKey derives the encryption key from a passphrase with the header's parameters.
+func deriveKey(passphrase []byte, h header) []byte {
+	return argon2.IDKey(passphrase, h.Salt[:], h.Time, h.Memory, h.Threads, chacha20poly1305.KeySize)
+}
+
+// checkName rejects entry names that are absolute or leave the bundle root.
+func checkName(name string) error {
+	if name == "" || path.IsAbs(name) || strings.Contains(name, `\`) || path.Clean(name) != name ||
+		name == ".." || strings.HasPrefix(name, "../") || name == manifestName {
+		return fmt.Errorf("invalid bundle entry name %q", name)
+	}
+	return nil
+}
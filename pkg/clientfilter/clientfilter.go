@@ -0,0 +1,172 @@
+// Package clientfilter restricts which client addresses may use a listener.
+//
+// When the proxy, the DNS resolver or the status page listens on a LAN
+// address, anyone on the network can reach it. A Filter admits only clients
+// whose source address is in an allowlist and not in a denylist, and the
+// listener wrapper closes other connections as soon as they are accepted,
+// before a single byte of the protocol is read or written.
+package clientfilter
+
+import (
+	"fmt"
+	"net"
+	"net/netip"
+	"strings"
+)
+
+// Filter decides which client addresses are admitted.
+//
+// A nil Filter admits everyone.
+type Filter struct {
+	allow []netip.Prefix // Networks admitted; empty admits any address not denied
+	deny  []netip.Prefix // Networks refused, even when also allowed
+}
+
+// New creates a filter from allowed and denied networks.
+//
+// Parameters:
+//   - allow: Networks in CIDR notation or single IP addresses that are
+//     admitted; when empty, every address that is not denied is admitted
+//   - deny: Networks or addresses that are refused, taking precedence over allow
+//
+// Returns:
+//   - *Filter: The filter, or nil when both lists are empty
+//   - error: An error naming the first entry that is not a network or address
+func New(allow, deny []string) (*Filter, error) {
+	if len(allow) == 0 && len(deny) == 0 {
+		return nil, nil
+	}
+	f := &Filter{}
+	var err error
+	if f.allow, err = parse(allow); err != nil {
+		return nil, err
+	}
+	if f.deny, err = parse(deny); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// parse converts networks and single addresses into prefixes.
+func parse(entries []string) ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(entries))
+	for _, entry := range entries {
+		prefix, err := ParsePrefix(entry)
+		if err != nil {
+			return nil, err
+		}
+		prefixes = append(prefixes, prefix)
+	}
+	return prefixes, nil
+}
+
+// ParsePrefix parses a network in CIDR notation or a single IP address, which
+// stands for a network of just that address.
+//
+// Parameters:
+//   - entry: The network, e.g. "192.168.1.0/24", or address, e.g. "192.168.1.5"
+//
+// Returns:
+//   - netip.Prefix: The network
+//   - error: An error if the entry is neither
+func ParsePrefix(entry string) (netip.Prefix, error) {
+	if strings.Contains(entry, "/") {
+		prefix, err := netip.ParsePrefix(entry)
+		if err != nil {
+			return netip.Prefix{}, fmt.Errorf("invalid network '%s': %w", entry, err)
+		}
+		return prefix.Masked(), nil
+	}
+	addr, err := netip.ParseAddr(entry)
+	if err != nil {
+		return netip.Prefix{}, fmt.Errorf("invalid address '%s': %w", entry, err)
+	}
+	addr = addr.Unmap()
+	return netip.PrefixFrom(addr, addr.BitLen()), nil
+}
+
+// Permits reports whether a client address is admitted.
+//
+// Addresses that are not IP addresses, such as those of Unix sockets, are
+// refused by a non-nil filter.
+//
+// Parameters:
+//   - addr: The remote address of the client
+//
+// Returns:
+//   - bool: true if the client may use the listener
+func (f *Filter) Permits(addr net.Addr) bool {
+	if f == nil {
+		return true
+	}
+	var ip netip.Addr
+	switch a := addr.(type) {
+	case *net.TCPAddr:
+		ip, _ = netip.AddrFromSlice(a.IP)
+	case *net.UDPAddr:
+		ip, _ = netip.AddrFromSlice(a.IP)
+	default:
+		if ap, err := netip.ParseAddrPort(addr.String()); err == nil {
+			ip = ap.Addr()
+		}
+	}
+	if !ip.IsValid() {
+		return false
+	}
+	ip = ip.Unmap()
+
+	for _, prefix := range f.deny {
+		if prefix.Contains(ip) {
+			return false
+		}
+	}
+	if len(f.allow) == 0 {
+		return true
+	}
+	for _, prefix := range f.allow {
+		if prefix.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// listener closes the connections of clients a filter refuses.
+type listener struct {
+	net.Listener
+	filter *Filter
+	name   string // Listener name for log messages
+}
+
+// Listen wraps a listener so that Accept returns only admitted clients.
+// Connections of refused clients are closed right after they are accepted and
+// reported in the output.
+//
+// Parameters:
+//   - l: The listener to filter
+//   - filter: The filter to apply; nil returns l unchanged
+//   - name: Name of the listener in log messages, e.g. "HTTP proxy"
+//
+// Returns:
+//   - net.Listener: The filtered listener
+func Listen(l net.Listener, filter *Filter, name string) net.Listener {
+	if filter == nil {
+		return l
+	}
+	return &listener{Listener: l, filter: filter, name: name}
+}
+
+// Accept waits for the next admitted client.
+func (l *listener) Accept() (net.Conn, error) {
+	for {
+		conn, err := l.Listener.Accept()
+		if err != nil {
+			return nil, err
+		}
+		if l.filter.Permits(conn.RemoteAddr()) {
+			return conn, nil
+		}
+		fmt.Printf("✗ Refusing client %s: not allowed to use the %s\n", conn.RemoteAddr(), l.name)
+		conn.Close()
+	}
+}
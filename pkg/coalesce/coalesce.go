@@ -0,0 +1,128 @@
+// Package coalesce batches small writes to a connection into larger ones.
+//
+// Chatty protocols such as SSH sessions, games and chat clients send many
+// writes of a few bytes. Through the tunnel each write becomes an SSH packet
+// with its own header, MAC and, over WebSocket and TLS, further framing, so the
+// overhead can exceed the payload on high-latency uplinks. Like Nagle's
+// algorithm, a Conn holds small writes back for a short delay so that the
+// writes following them go out in the same packet.
+//
+// Writes as large as the buffer are passed through as they are, so bulk
+// transfers are not slowed down, and the memory used per connection is bounded
+// by the buffer size.
+package coalesce
+
+import (
+	"net"
+	"sync"
+	"time"
+)
+
+// Conn is a connection whose writes are coalesced.
+type Conn struct {
+	net.Conn
+	delay time.Duration // How long a small write may wait for more data
+	size  int           // Most bytes held back; larger writes pass through
+
+	mu    sync.Mutex
+	buf   []byte      // Data not yet written
+	timer *time.Timer // Pending flush (nil when idle)
+	err   error       // Error of a delayed write, returned by the next call
+}
+
+// NewConn wraps a connection so that its writes are coalesced.
+//
+// Parameters:
+//   - conn: The connection to write to
+//   - delay: How long a small write may be held back
+//   - size: The most bytes held back; a full buffer is written immediately
+//
+// Returns:
+//   - *Conn: The wrapped connection
+func NewConn(conn net.Conn, delay time.Duration, size int) *Conn {
+	return &Conn{Conn: conn, delay: delay, size: size}
+}
+
+// Write buffers p, or writes it through along with the buffered data when it
+// is large or fills the buffer. A write error is reported by this call or, for
+// data written after the delay, by the next one.
+func (c *Conn) Write(p []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err != nil {
+		return 0, c.err
+	}
+
+	if len(c.buf)+len(p) > c.size {
+		if err := c.flushLocked(); err != nil {
+			return 0, err
+		}
+	}
+	if len(p) >= c.size {
+		return c.Conn.Write(p)
+	}
+
+	if c.buf == nil {
+		c.buf = make([]byte, 0, c.size)
+	}
+	c.buf = append(c.buf, p...)
+	if len(c.buf) == c.size {
+		if err := c.flushLocked(); err != nil {
+			return 0, err
+		}
+	} else if c.timer == nil {
+		c.timer = time.AfterFunc(c.delay, c.flushDelayed)
+	}
+	return len(p), nil
+}
+
+// Flush writes the buffered data immediately.
+func (c *Conn) Flush() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.flushLocked()
+}
+
+// CloseWrite writes the buffered data and half-closes the connection, or
+// closes it when half-closing is not supported.
+func (c *Conn) CloseWrite() error {
+	c.Flush()
+	if cw, ok := c.Conn.(interface{ CloseWrite() error }); ok {
+		return cw.CloseWrite()
+	}
+	return c.Conn.Close()
+}
+
+// Close writes the buffered data and closes the connection.
+func (c *Conn) Close() error {
+	c.Flush()
+	return c.Conn.Close()
+}
+
+// flushDelayed writes the buffered data once the delay has passed.
+func (c *Conn) flushDelayed() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.timer = nil
+	c.flushLocked()
+	// Connections waiting for more data do not keep their buffer
+	c.buf = nil
+}
+
+// flushLocked writes the buffered data and cancels the pending flush. The
+// caller must hold c.mu.
+func (c *Conn) flushLocked() error {
+	if c.timer != nil {
+		c.timer.Stop()
+		c.timer = nil
+	}
+	if c.err != nil || len(c.buf) == 0 {
+		return c.err
+	}
+	_, err := c.Conn.Write(c.buf)
+	c.buf = c.buf[:0]
+	if err != nil {
+		c.err = err
+	}
+	return err
+}
@@ -0,0 +1,88 @@
+// Package color highlights status glyphs and errors in terminal output.
+//
+// Colors are off by default and enabled process-wide with SetEnabled, which
+// the command line does when standard output is a terminal. Detect honors the
+// NO_COLOR convention (https://no-color.org): when the variable is set to any
+// non-empty value, output stays uncolored.
+package color
+
+import (
+	"os"
+	"sync/atomic"
+
+	"golang.org/x/term"
+)
+
+// ANSI escape sequences.
+const (
+	reset  = "\033[0m"
+	red    = "\033[31m"
+	green  = "\033[32m"
+	yellow = "\033[33m"
+	cyan   = "\033[36m"
+)
+
+// enabled turns colors on when set.
+var enabled atomic.Bool
+
+// Detect reports whether output to a file should be colored: it must be a
+// terminal, NO_COLOR must be unset or empty and TERM must not be "dumb".
+//
+// Parameters:
+//   - f: The output file, typically os.Stdout
+//
+// Returns:
+//   - bool: Whether to use colors
+func Detect(f *os.File) bool {
+	if os.Getenv("NO_COLOR") != "" || os.Getenv("TERM") == "dumb" {
+		return false
+	}
+	return term.IsTerminal(int(f.Fd()))
+}
+
+// SetEnabled turns colors on or off for the whole process.
+func SetEnabled(on bool) {
+	enabled.Store(on)
+}
+
+// Red colors text red, as used for errors.
+func Red(s string) string {
+	return paint(red, s)
+}
+
+// Green colors text green, as used for success.
+func Green(s string) string {
+	return paint(green, s)
+}
+
+// Yellow colors text yellow, as used for warnings and standby states.
+func Yellow(s string) string {
+	return paint(yellow, s)
+}
+
+// Cyan colors text cyan, as used for steps in progress.
+func Cyan(s string) string {
+	return paint(cyan, s)
+}
+
+// Glyph colors a status glyph by its meaning: "✓" green, "✗" red and the
+// arrows "→" and "←" cyan. Other text is returned unchanged.
+func Glyph(glyph string) string {
+	switch glyph {
+	case "✓":
+		return Green(glyph)
+	case "✗":
+		return Red(glyph)
+	case "→", "←":
+		return Cyan(glyph)
+	}
+	return glyph
+}
+
+// paint wraps text in a color when colors are enabled.
+func paint(code, s string) string {
+	if !enabled.Load() || s == "" {
+		return s
+	}
+	return code + s + reset
+}
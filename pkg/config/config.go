@@ -1,11 +1,14 @@
 // Package config provides configuration management for the Tunn SSH tunneling tool.
 //
 // This package handles loading, parsing, validating, and managing configuration
-// data from JSON files. It supports both direct and proxy tunnel modes with
-// comprehensive validation to ensure all required settings are present and valid.
+// data from JSON, YAML and TOML files. It supports both direct and proxy tunnel
+// modes with comprehensive validation to ensure all required settings are
+// present and valid.
 //
-// Configuration files use JSON format and support environment variable substitution
-// using the standard $VAR or ${VAR} syntax.
+// Configuration files are JSON unless their extension says otherwise (see
+// Format), and support environment variable substitution using the standard
+// $VAR or ${VAR} syntax, named variables, includes of shared files, and named
+// profiles that override the top-level settings.
 //
 // Example usage:
 //
@@ -17,9 +20,24 @@
 package config
 
 import (
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"os"
+	"io/fs"
+	"net"
+	"net/netip"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+
+	"tunn/pkg/clientfilter"
+	"tunn/pkg/schedule"
+	"tunn/pkg/ssh"
 )
 
 // Config represents the complete tunnel configuration structure.
@@ -30,19 +48,308 @@ import (
 // HTTP proxies, with optional WebSocket upgrade capabilities.
 type Config struct {
 	// Connection settings
-	Mode      string `json:"mode"`                // Connection mode: "direct" or "proxy"
+	Mode      string `json:"mode"`                // Connection mode: "direct", "proxy" or "auto"
 	ProxyHost string `json:"proxyHost,omitempty"` // Proxy server hostname (required for proxy mode)
 	ProxyPort string `json:"proxyPort,omitempty"` // Proxy server port (required for proxy mode)
 
+	// Outbound connection settings
+	Connect ConnectConfig     `json:"connect,omitempty"` // Settings for the connection to the SSH or proxy server
+	Hosts   map[string]string `json:"hosts,omitempty"`   // Fixed addresses of server hostnames, used instead of any lookup
+
+	// TLS settings
+	TLS TLSConfig `json:"tls,omitempty"` // TLS handshake settings for port 443 connections
+
+	// Captive portal detection
+	CaptivePortal CaptivePortalConfig `json:"captivePortal,omitempty"` // Probe for a network sign-in page before connecting
+
+	// Pre-connection triggers
+	Knock KnockConfig `json:"knock,omitempty"` // Port knocks and a wake URL sent before each connection
+
+	// Multipath settings
+	Multipath MultipathConfig `json:"multipath,omitempty"` // Redundant transports over several uplinks (experimental)
+
 	// SSH connection settings
 	SSH SSHConfig `json:"ssh"` // SSH connection settings and credentials
 
+	// Alternative endpoints
+	Servers []Server      `json:"servers,omitempty"` // Endpoints tried by priority, failing over when the live one is lost
+	Balance BalanceConfig `json:"balance,omitempty"` // Spread connections over a transport to every server instead
+
 	// Local proxy server settings
-	Listener ListenerConfig `json:"listener"` // Local listener configuration
+	Listener  ListenerConfig   `json:"listener"`            // Local listener configuration
+	Listeners []ListenerConfig `json:"listeners,omitempty"` // Further proxies served alongside listener, each on its own port
 
 	// Advanced connection settings
 	HTTPPayload       string `json:"httpPayload,omitempty"`       // Custom HTTP payload for WebSocket upgrade
+	WSStrict          bool   `json:"wsStrict,omitempty"`          // Send a random Sec-WebSocket-Key and verify Sec-WebSocket-Accept
 	ConnectionTimeout int    `json:"connectionTimeout,omitempty"` // Connection timeout in seconds (default: 30)
+
+	// Channel-open pacing
+	ChannelOpen ChannelOpenConfig `json:"channelOpen,omitempty"` // Limit on concurrent SSH channel opens
+
+	// Slow destination detection
+	Latency LatencyConfig `json:"latency,omitempty"` // Per-destination channel-open latency policy
+
+	// Liveness detection
+	Watchdog WatchdogConfig `json:"watchdog,omitempty"` // Traffic-based dead transport detection
+
+	// Reconnection of lost transports
+	Reconnect ReconnectConfig `json:"reconnect,omitempty"` // Retry policy for lost transports
+
+	// Limits on proxied connections
+	Limits LimitsConfig `json:"limits,omitempty"` // Client count, idle timeout and bandwidth of the local proxy
+
+	// Upload write coalescing
+	Coalesce CoalesceConfig `json:"coalesce,omitempty"` // Batching of small writes into larger SSH packets
+
+	// Upload fairness between connections
+	FairQueue FairQueueConfig `json:"fairQueue,omitempty"` // Turns between connections writing to the transport
+
+	// Lifecycle hooks
+	Hooks HooksConfig `json:"hooks,omitempty"` // External commands run during the tunnel lifecycle
+
+	// Tor integration
+	Tor TorConfig `json:"tor,omitempty"` // Tor chaining before or after the SSH tunnel
+
+	// Strategies tried in auto mode
+	Auto AutoConfig `json:"auto,omitempty"` // Candidate strategies and error budget for auto mode
+
+	// Destination rules fetched from the SSH server
+	ACL ACLConfig `json:"acl,omitempty"` // Server-provided access rules for proxied destinations
+
+	// Time-based scheduling
+	Schedule []ScheduleWindow `json:"schedule,omitempty"` // Windows during which the tunnel runs
+
+	// Local control API
+	Control ControlConfig `json:"control,omitempty"` // Loopback API used by "tunn status"
+
+	// Read-only status page
+	StatusPage StatusPageConfig `json:"statusPage,omitempty"` // Status page that can be shared on the LAN
+
+	// Ad and tracker blocking
+	Blocklist BlocklistConfig `json:"blocklist,omitempty"` // Domain lists rejected by the local proxy
+
+	// Local DNS resolver
+	DNS DNSConfig `json:"dns,omitempty"` // Resolver answering through the tunnel with per-domain handlers
+
+	// Audit log of requests through the HTTP proxy
+	RequestLog RequestLogConfig `json:"requestLog,omitempty"` // Request metadata written to a file
+
+	// Response cache of the HTTP proxy
+	HTTPCache HTTPCacheConfig `json:"httpCache,omitempty"` // GET responses reused while Cache-Control allows
+
+	// Channels opened ahead of time from the hints in web pages
+	Preconnect PreconnectConfig `json:"preconnect,omitempty"` // Origins announced by rel=preconnect and dns-prefetch
+
+	// Large downloads split into parallel ranged requests
+	Accelerator AcceleratorConfig `json:"accelerator,omitempty"` // Ranged sub-requests over several SSH channels
+
+	// SOCKS5 proxy on the server into the local network
+	ReverseSOCKS ReverseSOCKSConfig `json:"reverseSocks,omitempty"` // Remote listener reaching devices on the client's LAN
+
+	// Local ports forwarded to fixed destinations
+	Forwards []ForwardConfig `json:"forwards,omitempty"` // Equivalents of ssh -L, reached without a proxy
+
+	// Ports of the SSH server forwarded to local services
+	RemoteForwards []RemoteForwardConfig `json:"remoteForwards,omitempty"` // Equivalents of ssh -R, like "tunn expose"
+}
+
+// ConnectConfig defines how the connection to the SSH or proxy server is dialed.
+//
+// On multi-homed hosts (for example Wi-Fi and LTE at the same time) the tunnel can
+// be pinned to one uplink by source address or by interface name.
+//
+// Servers with both IPv4 and IPv6 addresses are dialed with Happy Eyeballs
+// (RFC 8305): the addresses of the preferred family are tried first and the
+// others join the race shortly after, so a broken IPv6 path never stalls the
+// connection.
+type ConnectConfig struct {
+	BindAddress   string `json:"bindAddress,omitempty"`   // Local source IP for the outgoing connection
+	BindInterface string `json:"bindInterface,omitempty"` // Network interface for the outgoing connection (e.g., "wlan0")
+	Prefer        string `json:"prefer,omitempty"`        // Address family tried first: "ipv4" or "ipv6" (default: the resolver's order)
+}
+
+// CaptivePortalConfig defines the captive portal check run before connecting.
+//
+// On hotel, airport and similar networks all traffic is intercepted until the
+// user signs in, which makes the tunnel fail with confusing TLS or upgrade
+// errors. When enabled, a probe request detects the portal first and reports
+// its sign-in page instead.
+type CaptivePortalConfig struct {
+	Enabled  bool   `json:"enabled,omitempty"`  // Probe for a captive portal before each connection
+	ProbeURL string `json:"probeUrl,omitempty"` // HTTP URL answering 204 (default: Google's generate_204)
+}
+
+// TLSConfig defines the TLS handshake used when the SSH or proxy server is reached on port 443.
+//
+// Some fronted endpoints only route WebSocket upgrades correctly when the client
+// offers ALPN "http/1.1" (or no ALPN at all), or when a specific TLS version is
+// negotiated. By default no ALPN protocols are offered and TLS 1.2 or newer is used.
+// Networks that block handshakes by their fingerprint can be given a different
+// set of cipher suites.
+//
+// Fronts presenting a certificate that does not match the server name can be
+// accepted with Insecure. The SSH session inside the tunnel is still
+// authenticated by the server's host key. PinnedSHA256 then keeps a proxy on
+// the way from posing as the front: the handshake is only accepted when a
+// presented certificate, or its public key, has one of the pinned hashes.
+//
+// Private relays that require mTLS at the edge can be given a client certificate.
+// This is independent of SSH authentication, which still happens inside the tunnel.
+type TLSConfig struct {
+	ServerName   string   `json:"serverName,omitempty"`   // SNI and certificate name (default: the dialed host)
+	ALPN         []string `json:"alpn,omitempty"`         // ALPN protocols to offer, e.g. ["http/1.1"]
+	MinVersion   string   `json:"minVersion,omitempty"`   // Minimum TLS version: "1.0", "1.1", "1.2" (default) or "1.3"
+	MaxVersion   string   `json:"maxVersion,omitempty"`   // Maximum TLS version (default: the newest supported)
+	CipherSuites []string `json:"cipherSuites,omitempty"` // TLS 1.0-1.2 cipher suites to offer, e.g. ["TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256"]
+	Insecure     bool     `json:"insecure,omitempty"`     // Accept any server certificate without verification
+	PinnedSHA256 []string `json:"pinnedSHA256,omitempty"` // SHA-256 of an accepted certificate or public key (SPKI), hex or base64
+	CertFile     string   `json:"certFile,omitempty"`     // PEM client certificate presented to the server or proxy
+	KeyFile      string   `json:"keyFile,omitempty"`      // PEM private key for certFile
+}
+
+// tlsVersions maps configuration version strings to crypto/tls constants.
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// Versions returns the configured minimum and maximum TLS versions.
+//
+// Returns:
+//   - uint16: Minimum version (tls.VersionTLS12 when unset)
+//   - uint16: Maximum version (0 when unset, letting crypto/tls choose)
+//   - error: An error if a version string is unknown or the range is empty
+func (t TLSConfig) Versions() (uint16, uint16, error) {
+	minVersion, maxVersion := uint16(tls.VersionTLS12), uint16(0)
+	if t.MinVersion != "" {
+		v, ok := tlsVersions[t.MinVersion]
+		if !ok {
+			return 0, 0, fmt.Errorf("invalid tls.minVersion '%s', must be one of: 1.0, 1.1, 1.2, 1.3", t.MinVersion)
+		}
+		minVersion = v
+	}
+	if t.MaxVersion != "" {
+		v, ok := tlsVersions[t.MaxVersion]
+		if !ok {
+			return 0, 0, fmt.Errorf("invalid tls.maxVersion '%s', must be one of: 1.0, 1.1, 1.2, 1.3", t.MaxVersion)
+		}
+		maxVersion = v
+	}
+	if maxVersion != 0 && maxVersion < minVersion {
+		return 0, 0, fmt.Errorf("tls.maxVersion must not be lower than tls.minVersion")
+	}
+	return minVersion, maxVersion, nil
+}
+
+// CipherSuiteIDs returns the configured cipher suites.
+//
+// Names are those of crypto/tls, including the suites it considers insecure.
+// TLS 1.3 suites cannot be chosen and are always offered.
+//
+// Returns:
+//   - []uint16: The cipher suite IDs in order of preference (nil when unset)
+//   - error: An error if a name is unknown or names a TLS 1.3 suite
+func (t TLSConfig) CipherSuiteIDs() ([]uint16, error) {
+	if len(t.CipherSuites) == 0 {
+		return nil, nil
+	}
+	known := make(map[string]*tls.CipherSuite)
+	for _, suite := range append(tls.CipherSuites(), tls.InsecureCipherSuites()...) {
+		known[suite.Name] = suite
+	}
+
+	ids := make([]uint16, 0, len(t.CipherSuites))
+	for _, name := range t.CipherSuites {
+		suite, ok := known[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown cipher suite '%s' in tls.cipherSuites", name)
+		}
+		if !slices.ContainsFunc(suite.SupportedVersions, func(v uint16) bool { return v <= tls.VersionTLS12 }) {
+			return nil, fmt.Errorf("cipher suite '%s' in tls.cipherSuites is a TLS 1.3 suite, which cannot be chosen", name)
+		}
+		ids = append(ids, suite.ID)
+	}
+	return ids, nil
+}
+
+// Pins returns the configured certificate pins.
+//
+// A pin is the SHA-256 hash of a DER certificate or of its SubjectPublicKeyInfo,
+// written in hex (colons allowed, as printed by openssl) or base64, optionally
+// prefixed with "sha256/" as in HTTP public key pinning.
+//
+// Returns:
+//   - [][]byte: The 32-byte hashes (nil when unset)
+//   - error: An error if a pin is not a SHA-256 hash
+func (t TLSConfig) Pins() ([][]byte, error) {
+	var pins [][]byte
+	for _, pin := range t.PinnedSHA256 {
+		value := strings.TrimPrefix(strings.TrimSpace(pin), "sha256/")
+		hash, err := hex.DecodeString(strings.ReplaceAll(value, ":", ""))
+		if err != nil {
+			hash, err = base64.StdEncoding.DecodeString(value)
+		}
+		if err != nil || len(hash) != sha256.Size {
+			return nil, fmt.Errorf("invalid pin '%s' in tls.pinnedSHA256, must be a SHA-256 hash in hex or base64", pin)
+		}
+		pins = append(pins, hash)
+	}
+	return pins, nil
+}
+
+// KnockConfig defines the triggers sent before each connection to a server
+// that keeps sshd closed until it is knocked.
+//
+// The wake URL is requested first, then the ports of the sequence are knocked
+// in order: a TCP knock is a connection attempt, a UDP knock a single
+// datagram. Tunn then waits briefly for the server to open up and connects.
+type KnockConfig struct {
+	Host     string   `json:"host,omitempty"`     // Host knocked (default: ssh.host)
+	Sequence []string `json:"sequence,omitempty"` // Ports knocked in order, "tcp:7000", "udp:8000" or just "7000" for TCP
+	Delay    int      `json:"delay,omitempty"`    // Milliseconds between knocks (default: 200)
+	Wait     int      `json:"wait,omitempty"`     // Milliseconds to wait after knocking before connecting (default: 500)
+	WakeURL  string   `json:"wakeUrl,omitempty"`  // URL requested with GET before knocking
+}
+
+// Enabled reports whether any trigger is configured.
+func (k *KnockConfig) Enabled() bool {
+	return len(k.Sequence) > 0 || k.WakeURL != ""
+}
+
+// ParseKnock parses one entry of a knock sequence.
+//
+// Parameters:
+//   - entry: "tcp:PORT", "udp:PORT" or "PORT"
+//
+// Returns:
+//   - string: The network, "tcp" or "udp"
+//   - int: The port
+//   - error: An error if the entry is malformed
+func ParseKnock(entry string) (string, int, error) {
+	network, port, found := strings.Cut(entry, ":")
+	if !found {
+		network, port = "tcp", entry
+	}
+	network = strings.ToLower(network)
+	n, err := strconv.Atoi(port)
+	if (network != "tcp" && network != "udp") || err != nil || n < 1 || n > 65535 {
+		return "", 0, fmt.Errorf("invalid knock '%s', expected tcp:PORT, udp:PORT or PORT", entry)
+	}
+	return network, n, nil
+}
+
+// MultipathConfig defines redundant transports over multiple uplinks.
+//
+// In "standby" mode a transport is established over every uplink at the same
+// time; the first one carries traffic and the others are kept as hot standbys
+// that take over immediately when the active uplink fails. Each uplink uses its
+// own connect settings, typically a different bindInterface.
+type MultipathConfig struct {
+	Mode    string          `json:"mode,omitempty"`    // Multipath mode: "standby" (default when uplinks are set)
+	Uplinks []ConnectConfig `json:"uplinks,omitempty"` // Connect settings for each uplink
 }
 
 // SSHConfig defines SSH connection settings and credentials.
@@ -50,32 +357,504 @@ type Config struct {
 // Contains the connection information and authentication details required
 // to establish SSH connections through the tunnel.
 type SSHConfig struct {
-	Host     string `json:"host"`     // SSH server hostname or IP address
-	Port     int    `json:"port"`     // SSH server port
-	Username string `json:"username"` // SSH username for authentication
-	Password string `json:"password"` // SSH password for authentication
+	Host     string `json:"host"`            // SSH server hostname or IP address
+	Port     int    `json:"port"`            // SSH server port
+	Username string `json:"username"`        // SSH username for authentication
+	Password string `json:"password"`        // SSH password for authentication
+	Agent    bool   `json:"agent,omitempty"` // Try the keys of the running ssh-agent (SSH_AUTH_SOCK) before the password
+
+	// Private key given with --ssh-key-stdin, never read from or written to files
+	PrivateKey string `json:"-"`
+
+	KeyboardInteractive bool     `json:"keyboardInteractive,omitempty"` // Answer keyboard-interactive prompts such as OTP codes after the other methods
+	Answers             []string `json:"answers,omitempty"`             // Scripted answers to keyboard-interactive prompts, in order, before asking on the terminal
+
+	HostKeyFingerprint string `json:"hostKeyFingerprint,omitempty"` // Pinned host key, "SHA256:..." as printed by ssh-keygen -l (default: check knownHosts)
+	KnownHosts         string `json:"knownHosts,omitempty"`         // known_hosts file the host key is checked against (default: ~/.ssh/known_hosts)
+
+	Ciphers []string `json:"ciphers,omitempty"` // Ciphers to offer, in order of preference (default: library defaults)
+	MACs    []string `json:"macs,omitempty"`    // MAC algorithms to offer for non-AEAD ciphers (default: library defaults)
+}
+
+// ChannelOpenConfig limits concurrent SSH channel-open requests per transport.
+//
+// Bursts of connections cause many simultaneous channel opens that some servers
+// throttle or drop. With a limit set, further opens wait in a first-come,
+// first-served queue until a slot is free. Storms of identical connections to
+// one destination can be collapsed further with a per-destination limit and by
+// not retrying a failed destination for a while.
+type ChannelOpenConfig struct {
+	MaxInFlight    int `json:"maxInFlight,omitempty"`    // Maximum concurrent channel opens (0 for unlimited)
+	QueueTimeout   int `json:"queueTimeout,omitempty"`   // Seconds an open may wait in the queue (default: connectionTimeout)
+	PerDestination int `json:"perDestination,omitempty"` // Maximum concurrent channel opens to the same host:port (0 for unlimited)
+	FailureWindow  int `json:"failureWindow,omitempty"`  // Seconds a failed destination is not retried, its error being returned instead (0 to always retry)
+}
+
+// LatencyConfig defines how destinations with consistently slow SSH channel opens are handled.
+//
+// Slow channel opens usually mean the destination is throttled or blocked beyond
+// the SSH server. Such destinations are reported, and with the "block" action new
+// connections to them are rejected immediately for a while.
+type LatencyConfig struct {
+	SlowThreshold float64 `json:"slowThreshold,omitempty"` // Channel-open time in seconds considered slow (default: 3)
+	MinSamples    int     `json:"minSamples,omitempty"`    // Consecutive slow opens before acting (default: 3)
+	Action        string  `json:"action,omitempty"`        // "warn" (default) or "block"
+	BlockDuration int     `json:"blockDuration,omitempty"` // Seconds a slow destination stays blocked (default: 300)
+}
+
+// WatchdogConfig defines traffic-based liveness detection for the SSH transport.
+//
+// The transport is considered dead when data has been sent but nothing has been
+// received for Timeout seconds, which catches connections silently blackholed by
+// middleboxes. A dead transport is closed and re-established.
+type WatchdogConfig struct {
+	Timeout           int `json:"timeout,omitempty"`           // Seconds without received data before reconnecting (0 disables the watchdog)
+	KeepaliveInterval int `json:"keepaliveInterval,omitempty"` // Seconds of idleness before a keepalive is sent (default: timeout/3)
+}
+
+// ReconnectConfig defines the retry policy for lost transports.
+//
+// A lost transport is re-established after InitialDelay, doubling the delay
+// after every failed attempt up to MaxDelay. With MaxAttempts set, Tunn gives
+// up and exits once that many attempts in a row have failed on every uplink.
+type ReconnectConfig struct {
+	InitialDelay int `json:"initialDelay,omitempty"` // Seconds before the first attempt (default: 1)
+	MaxDelay     int `json:"maxDelay,omitempty"`     // Longest delay between attempts in seconds (default: 30)
+	MaxAttempts  int `json:"maxAttempts,omitempty"`  // Failed attempts in a row before giving up (0: retry forever)
+
+	// Servers rejecting the account, e.g. for too many logins, may ban
+	// clients that keep reconnecting
+	RejectedDelay    int  `json:"rejectedDelay,omitempty"`    // Seconds to wait before reconnecting after a rejection (0: the usual delay)
+	StopWhenRejected bool `json:"stopWhenRejected,omitempty"` // Give up instead of reconnecting after a rejection
+}
+
+// LimitsConfig defines limits on the connections of the local proxy.
+//
+// Limits are off unless set. Like every other setting they can be set per
+// profile, so a streaming profile and a conservative work profile can live in
+// one configuration file.
+type LimitsConfig struct {
+	MaxConnections int `json:"maxConnections,omitempty"` // Proxy clients served at once; further clients are refused
+	IdleTimeout    int `json:"idleTimeout,omitempty"`    // Seconds a relayed connection may carry no data before it is closed
+	RateLimit      int `json:"rateLimit,omitempty"`      // Bandwidth of all relayed connections in KB/s, per direction
+
+	// A fixed pool of workers keeps memory predictable on small devices such
+	// as routers serving many clients
+	Workers int `json:"workers,omitempty"` // Proxy clients handled at once; further clients wait for a worker
+	Queue   int `json:"queue,omitempty"`   // Clients waiting for a worker before accepting pauses (default: 256)
+}
+
+// CoalesceConfig defines batching of small writes into larger SSH packets.
+//
+// Each write from a local client becomes at least one SSH packet. With a delay
+// set, small writes are held back for up to Delay milliseconds so that the
+// writes following them share the packet, which reduces per-packet overhead
+// for chatty protocols over high-latency transports at the cost of that delay.
+type CoalesceConfig struct {
+	Delay      int `json:"delay,omitempty"`      // Milliseconds a small write may be held back (0 disables coalescing)
+	BufferSize int `json:"bufferSize,omitempty"` // Most bytes held back per connection; larger writes pass through (default: 16384)
+}
+
+// FairQueueConfig defines fair queuing of uploads on the shared transport.
+//
+// Every connection through the tunnel is a channel of the same SSH
+// connection, so a bulk upload can delay the writes of every other client.
+// When enabled, connections writing at the same time take turns of at most
+// Quantum bytes each.
+type FairQueueConfig struct {
+	Enabled bool `json:"enabled,omitempty"` // Make connections take turns writing to the transport
+	Quantum int  `json:"quantum,omitempty"` // Most bytes a connection writes per turn (default: 16384)
+}
+
+// HooksConfig defines external hooks invoked during the tunnel lifecycle.
+type HooksConfig struct {
+	PreConnect *PreConnectHook `json:"preConnect,omitempty"` // Fetches SSH credentials before each connection
+}
+
+// PreConnectHook defines how fresh SSH credentials are obtained before connecting.
+//
+// Exactly one of Command or URL must be set. The output must be either a JSON
+// object with "username" and "password" (and optionally "host" and "port"), or
+// plain text in the form "username:password".
+type PreConnectHook struct {
+	Command string `json:"command,omitempty"` // Shell command printing credentials to stdout
+	URL     string `json:"url,omitempty"`     // HTTP(S) endpoint returning credentials
+	Timeout int    `json:"timeout,omitempty"` // Hook timeout in seconds (default: 30)
+}
+
+// TorConfig defines Tor integration on either side of the SSH tunnel.
+//
+// OverTor routes the connection to the SSH or proxy server through a Tor SOCKS
+// proxy on the local machine. ToTor forwards connections accepted by the local
+// proxy into a Tor SOCKS proxy running on the SSH server.
+type TorConfig struct {
+	OverTor            bool   `json:"overTor,omitempty"`            // Dial the server through the local Tor SOCKS proxy
+	ToTor              bool   `json:"toTor,omitempty"`              // Forward proxied connections into Tor on the SSH server
+	SocksAddress       string `json:"socksAddress,omitempty"`       // Local Tor SOCKS address (default: 127.0.0.1:9050)
+	RemoteSocksAddress string `json:"remoteSocksAddress,omitempty"` // Tor SOCKS address on the SSH server (default: 127.0.0.1:9050)
+}
+
+// AutoConfig defines the strategies tried in auto mode.
+//
+// Each connection attempt tries the strategies in order until one connects.
+// The outcome of every attempt is recorded in a state file, and strategies whose
+// recent failure rate exceeds the error budget are demoted behind the others, so
+// combinations that stopped working on the current network are tried last.
+type AutoConfig struct {
+	Strategies  []Strategy `json:"strategies,omitempty"`  // Candidate strategies in order of preference
+	StateFile   string     `json:"stateFile,omitempty"`   // Outcome history (default: state.json in the tunn config directory)
+	ErrorBudget float64    `json:"errorBudget,omitempty"` // Tolerated failure rate before demotion, 0-1 (default: 0.5)
+	Window      int        `json:"window,omitempty"`      // Recent attempts per strategy considered (default: 20)
+}
+
+// Strategy is one way of reaching the SSH server in auto mode.
+//
+// A strategy starts from the top-level settings, then applies the named
+// preset, if any, and finally its own non-empty fields.
+type Strategy struct {
+	Name        string   `json:"name"`                  // Unique strategy name shown in statistics
+	Preset      string   `json:"preset,omitempty"`      // Preset to start from (see "tunn preset list")
+	Mode        string   `json:"mode,omitempty"`        // "direct" or "proxy"
+	ProxyHost   string   `json:"proxyHost,omitempty"`   // Proxy server hostname for proxy mode
+	ProxyPort   string   `json:"proxyPort,omitempty"`   // Proxy server port for proxy mode
+	Port        int      `json:"port,omitempty"`        // SSH (or front) port
+	HTTPPayload string   `json:"httpPayload,omitempty"` // WebSocket upgrade payload
+	ServerName  string   `json:"serverName,omitempty"`  // TLS server name (SNI)
+	ALPN        []string `json:"alpn,omitempty"`        // TLS ALPN protocols
+}
+
+// Apply copies the strategy's non-empty settings into a configuration.
+//
+// Parameters:
+//   - cfg: The configuration to update in place
+func (s *Strategy) Apply(cfg *Config) {
+	if s.Mode != "" {
+		cfg.Mode = s.Mode
+	}
+	if s.ProxyHost != "" {
+		cfg.ProxyHost = s.ProxyHost
+	}
+	if s.ProxyPort != "" {
+		cfg.ProxyPort = s.ProxyPort
+	}
+	if s.Port != 0 {
+		cfg.SSH.Port = s.Port
+	}
+	if s.HTTPPayload != "" {
+		cfg.HTTPPayload = s.HTTPPayload
+	}
+	if s.ServerName != "" {
+		cfg.TLS.ServerName = s.ServerName
+	}
+	if len(s.ALPN) > 0 {
+		cfg.TLS.ALPN = s.ALPN
+	}
+}
+
+// Server is one endpoint of a failover list.
+//
+// A server starts from the top-level settings and applies its own non-empty
+// fields, so servers sharing credentials or a payload only list what differs.
+// Servers are tried in order of priority, lowest first, and in configured
+// order within the same priority.
+type Server struct {
+	Name               string `json:"name"`                         // Unique server name shown in events and status
+	Priority           int    `json:"priority,omitempty"`           // Lower values are tried first (default: 0)
+	Mode               string `json:"mode,omitempty"`               // "direct" or "proxy"
+	ProxyHost          string `json:"proxyHost,omitempty"`          // Proxy server hostname for proxy mode
+	ProxyPort          string `json:"proxyPort,omitempty"`          // Proxy server port for proxy mode
+	Host               string `json:"host,omitempty"`               // SSH server hostname or IP address
+	Port               int    `json:"port,omitempty"`               // SSH (or front) port
+	Username           string `json:"username,omitempty"`           // SSH username
+	Password           string `json:"password,omitempty"`           // SSH password
+	HostKeyFingerprint string `json:"hostKeyFingerprint,omitempty"` // Pinned SHA256 host key fingerprint
+	HTTPPayload        string `json:"httpPayload,omitempty"`        // WebSocket upgrade payload
+	ServerName         string `json:"serverName,omitempty"`         // TLS server name (SNI)
+}
+
+// Apply copies the server's non-empty settings into a configuration.
+//
+// Parameters:
+//   - cfg: The configuration to update in place
+func (s *Server) Apply(cfg *Config) {
+	if s.Mode != "" {
+		cfg.Mode = s.Mode
+	}
+	if s.ProxyHost != "" {
+		cfg.ProxyHost = s.ProxyHost
+	}
+	if s.ProxyPort != "" {
+		cfg.ProxyPort = s.ProxyPort
+	}
+	if s.Host != "" {
+		cfg.SSH.Host = s.Host
+	}
+	if s.Port != 0 {
+		cfg.SSH.Port = s.Port
+	}
+	if s.Username != "" {
+		cfg.SSH.Username = s.Username
+	}
+	if s.Password != "" {
+		cfg.SSH.Password = s.Password
+	}
+	if s.HostKeyFingerprint != "" {
+		cfg.SSH.HostKeyFingerprint = s.HostKeyFingerprint
+	}
+	if s.HTTPPayload != "" {
+		cfg.HTTPPayload = s.HTTPPayload
+	}
+	if s.ServerName != "" {
+		cfg.TLS.ServerName = s.ServerName
+	}
+}
+
+// BalanceConfig defines load balancing across the failover servers.
+//
+// With a strategy set, a transport is kept to every server at the same time
+// instead of one to the live server, and new proxied connections are spread
+// over the connected ones. Each connection stays on the transport it was
+// opened on; lost transports are re-established in the background.
+type BalanceConfig struct {
+	Strategy string `json:"strategy,omitempty"` // "round-robin" or "least-connections"
+}
+
+// ACLConfig defines where destination access rules are fetched from on the SSH
+// server.
+//
+// The rules are fetched each time a transport is established, either by reading
+// a file over SFTP or by running a command and reading its output, so the server
+// operator can centrally control what shared accounts may reach. Proxied
+// connections to denied destinations are rejected locally.
+//
+// Rules matching on "country:" or "asn:" look destinations up in local
+// MaxMind DB files. Hostnames are resolved through the tunnel when the local
+// DNS resolver is enabled, and by the system resolver otherwise.
+type ACLConfig struct {
+	File      string `json:"file,omitempty"`      // Rule file on the SSH server, read over SFTP
+	Command   string `json:"command,omitempty"`   // Command on the SSH server printing the rules
+	Required  bool   `json:"required,omitempty"`  // Fail the connection when no rules could ever be fetched
+	CountryDB string `json:"countryDb,omitempty"` // Local .mmdb file with countries, e.g. GeoLite2-Country.mmdb
+	ASNDB     string `json:"asnDb,omitempty"`     // Local .mmdb file with AS numbers, e.g. GeoLite2-ASN.mmdb
+}
+
+// ScheduleWindow defines a recurring time window during which the tunnel runs.
+//
+// Start and Stop are cron expressions ("minute hour day month weekday"), for
+// example {"start": "0 1 * * *", "stop": "0 6 * * *"} for a nightly window from
+// 01:00 to 06:00. With a schedule configured, tunn keeps running and connects
+// and disconnects automatically; the tunnel is up while any window is open.
+type ScheduleWindow struct {
+	Start string `json:"start"` // Cron expression for when the tunnel is started
+	Stop  string `json:"stop"`  // Cron expression for when the tunnel is stopped
+}
+
+// ControlConfig defines the local control API of a running tunnel.
+//
+// The control API is disabled unless an address is set, and only loopback
+// addresses are accepted. Requests must carry a token the tunnel writes to a
+// file only its user can read.
+//
+// With Pprof set, the control API also serves the Go runtime profiles, so the
+// CPU, memory and goroutine use of a running tunnel can be captured.
+type ControlConfig struct {
+	Address string `json:"address,omitempty"` // Loopback listen address, e.g. "127.0.0.1:7080"
+	Pprof   bool   `json:"pprof,omitempty"`   // Serve runtime profiles under /debug/pprof/
+}
+
+// StatusPageConfig defines the read-only status page of a running tunnel.
+//
+// Unlike the control API, the status page may listen on a LAN address so that
+// other people on the network can see whether the tunnel is up. It shows only
+// the tunnel state, the exit country and the data used today, and offers no
+// controls. When a token is set, the page is only served to requests carrying
+// it as ?token=, which makes the shared link the credential.
+type StatusPageConfig struct {
+	Address    string   `json:"address,omitempty"`    // Listen address, e.g. "0.0.0.0:8090" (disabled when empty)
+	Token      string   `json:"token,omitempty"`      // Optional access token required as ?token=
+	CountryURL string   `json:"countryUrl,omitempty"` // URL reporting the exit country as "loc=XX" (default: Cloudflare trace)
+	Allow      []string `json:"allow,omitempty"`      // Client networks or addresses admitted (default: all)
+	Deny       []string `json:"deny,omitempty"`       // Client networks or addresses refused, even when allowed
+}
+
+// BlocklistConfig defines ad and tracker blocking in the local proxy.
+//
+// Connections to listed domains and their subdomains are rejected by the SOCKS5
+// and HTTP proxies before any SSH channel is opened. Lists are reloaded
+// periodically, keeping the previous version of a list that fails to update.
+type BlocklistConfig struct {
+	Lists       []string `json:"lists,omitempty"`       // Files or URLs of hosts, ABP or domain lists
+	UpdateHours int      `json:"updateHours,omitempty"` // Hours between list updates (default: 24)
+}
+
+// DNSConfig defines the local DNS resolver.
+//
+// The resolver is disabled unless a listen address is set. Queries are
+// answered from static records, handled by per-domain rules, blocked when they
+// appear on a blocklist, or otherwise forwarded to the upstream resolver
+// through the tunnel.
+//
+// Bootstrap and Servers are independent of the resolver: they name the
+// DNS-over-HTTPS resolver or the DNS servers used to look up the proxy and SSH
+// server hostnames before the tunnel exists, for networks whose DNS is
+// poisoned.
+type DNSConfig struct {
+	Bootstrap  string            `json:"bootstrap,omitempty"`  // DNS-over-HTTPS URL resolving the server hostnames, e.g. "https://1.1.1.1/dns-query"
+	Servers    []string          `json:"servers,omitempty"`    // DNS servers resolving the server hostnames, tried in order, e.g. "8.8.8.8:53"
+	Listen     string            `json:"listen,omitempty"`     // Local UDP and TCP address, e.g. "127.0.0.1:5353"
+	Upstream   string            `json:"upstream,omitempty"`   // Resolver reached through the tunnel (default: "1.1.1.1:53")
+	Hosts      map[string]string `json:"hosts,omitempty"`      // Static records: hostname to IP address
+	Rules      []DNSRule         `json:"rules,omitempty"`      // Per-domain handlers
+	Blocklists []string          `json:"blocklists,omitempty"` // Files or URLs of hosts, ABP or domain lists answered with NXDOMAIN
+	Allow      []string          `json:"allow,omitempty"`      // Client networks or addresses admitted (default: all)
+	Deny       []string          `json:"deny,omitempty"`       // Client networks or addresses refused, even when allowed
+}
+
+// DNSRule defines the handler for a domain and its subdomains.
+type DNSRule struct {
+	Domain   string `json:"domain"`             // Domain the rule applies to, including subdomains
+	Action   string `json:"action"`             // "forward" or "block"
+	Upstream string `json:"upstream,omitempty"` // Resolver for "forward" (default: dns.upstream)
+	Direct   bool   `json:"direct,omitempty"`   // Query the resolver directly instead of through the tunnel
+}
+
+// RequestLogConfig defines the request log of the HTTP proxy.
+//
+// The log is disabled unless a file is set. It records the method, host, path,
+// status and duration of each request, without bodies, headers or query
+// strings, to audit which sites applications contact through the tunnel.
+type RequestLogConfig struct {
+	File    string   `json:"file,omitempty"`    // File the JSON lines are appended to
+	Exclude []string `json:"exclude,omitempty"` // Domains never recorded, including their subdomains
+}
+
+// HTTPCacheConfig defines the response cache of the HTTP proxy.
+//
+// When enabled, GET responses are stored as far as Cache-Control, Expires and
+// their validators allow, and served again without downloading them through
+// the tunnel. HTTPS traffic is encrypted end to end and cannot be cached.
+type HTTPCacheConfig struct {
+	Enabled      bool   `json:"enabled,omitempty"`      // Cache responses of the HTTP proxy
+	Dir          string `json:"dir,omitempty"`          // Directory keeping the cache across restarts (default: memory only)
+	MaxSize      int    `json:"maxSize,omitempty"`      // Total size of the cache in MB (default: 256)
+	MaxEntrySize int    `json:"maxEntrySize,omitempty"` // Largest response stored in MB (default: 32)
+}
+
+// PreconnectConfig defines the preconnecting of the HTTP proxy.
+//
+// When enabled, the proxy looks for <link rel="preconnect"> and
+// "dns-prefetch" hints in HTML pages and Link headers passing through it and
+// opens SSH channels to the origins they name before the browser asks for
+// them, saving a round trip through the tunnel per origin.
+type PreconnectConfig struct {
+	Enabled     bool `json:"enabled,omitempty"`     // Preconnect to origins hinted by web pages
+	IdleTimeout int  `json:"idleTimeout,omitempty"` // Seconds an unused channel is kept open (default: 10)
+}
+
+// AcceleratorConfig defines the download accelerator of the HTTP proxy.
+//
+// Servers that throttle each connection cap a single download at the per
+// connection rate. When enabled, large GET responses of servers accepting
+// range requests are fetched as consecutive ranges over several SSH channels
+// at once and passed to the client in order, as one response.
+type AcceleratorConfig struct {
+	Enabled bool `json:"enabled,omitempty"` // Split large downloads into parallel ranged requests
+	Parts   int  `json:"parts,omitempty"`   // Ranged requests in flight per download (default: 4)
+	MinSize int  `json:"minSize,omitempty"` // Smallest response in MB that is split (default: 8)
+}
+
+// ReverseSOCKSConfig defines a SOCKS5 proxy on the SSH server that connects
+// back into the client's local network.
+//
+// The proxy listens on the server through an SSH remote forward, which is set
+// up again whenever a transport reconnects. Its connections are made from the
+// client machine, so programs on the server (a VPS, say) can reach devices on
+// the client's home LAN. Since that exposes the LAN to the server, the
+// reachable destinations can be limited to the networks listed in allow.
+type ReverseSOCKSConfig struct {
+	Listen string   `json:"listen,omitempty"` // Server-side listen address, e.g. "127.0.0.1:1080" (disabled when empty)
+	Allow  []string `json:"allow,omitempty"`  // Local networks that may be reached, in CIDR notation (default: any)
+}
+
+// ForwardConfig defines a local port whose connections are all relayed to
+// one destination through the tunnel, like the -L option of OpenSSH.
+//
+// The destination is resolved and connected to by the SSH server, so it may
+// be a name or address only reachable from there, such as a database on the
+// server's private network. A listen address without a host binds the
+// loopback address.
+type ForwardConfig struct {
+	Listen string `json:"listen"` // Local address, e.g. "127.0.0.1:5432"
+	Remote string `json:"remote"` // Destination as seen from the SSH server, e.g. "db.internal:5432"
+}
+
+// RemoteForwardConfig defines a port on the SSH server whose connections are
+// passed to a local service, like the -R option of OpenSSH.
+//
+// The port is requested again whenever a transport reconnects. Binding
+// anything but the server's loopback address needs "GatewayPorts
+// clientspecified" (or "yes") on OpenSSH servers.
+type RemoteForwardConfig struct {
+	RemoteListen string `json:"remoteListen"` // Server-side address, e.g. "0.0.0.0:8080"
+	Local        string `json:"local"`        // Local service connections are passed to, e.g. "127.0.0.1:3000"
 }
 
 // ListenerConfig defines local proxy server settings.
 //
 // Contains the configuration for the local proxy server that will listen
 // for client connections and forward them through the SSH tunnel.
+//
+// The proxy listens on the loopback address unless host says otherwise. When
+// it is shared on the LAN, allow and deny restrict which clients may use it;
+// connections from other addresses are closed before any protocol negotiation.
 type ListenerConfig struct {
-	Port      int    `json:"port"`      // Local listener port (default: 1080)
-	ProxyType string `json:"proxyType"` // Proxy protocol: "http", "socks5", etc. (default: "socks5")
+	Port      int      `json:"port"`            // Local listener port (default: 1080)
+	ProxyType string   `json:"proxyType"`       // Proxy protocol: "http", "socks5", "mixed" for both on one port, or "transparent" for firewall-redirected connections (default: "http")
+	Host      string   `json:"host,omitempty"`  // Listen IP address, e.g. "0.0.0.0" to share on the LAN (default: "127.0.0.1")
+	Allow     []string `json:"allow,omitempty"` // Client networks or addresses admitted (default: all)
+	Deny      []string `json:"deny,omitempty"`  // Client networks or addresses refused, even when allowed
+
+	// HeaderCase lists header names written to origin servers exactly as
+	// given, e.g. "x-api-key" or "DNT", whatever case the client used
+	HeaderCase []string `json:"headerCase,omitempty"`
+}
+
+// credentials are the SSH credentials set with SetCredentials.
+var credentials struct {
+	password   string
+	privateKey string
 }
 
-// LoadConfig loads and validates configuration from a JSON file.
+// SetCredentials sets SSH credentials used by every configuration loaded
+// afterwards, in place of ssh.password. They come from the command line
+// rather than the file, for secrets piped in from a password manager that
+// should neither be stored in the file nor passed as arguments, where other
+// users can read them from the process list.
+//
+// Parameters:
+//   - password: Password replacing ssh.password, or "" to keep it
+//   - privateKey: Unencrypted private key offered before the password, or ""
+func SetCredentials(password, privateKey string) {
+	credentials.password = password
+	credentials.privateKey = privateKey
+}
+
+// LoadConfig loads and validates configuration from a JSON, YAML or TOML file.
 //
 // This function reads the specified configuration file, performs environment
-// variable substitution, parses the JSON content, validates all settings,
+// variable substitution, parses the content in the format given by the file
+// extension, validates all settings,
 // and applies default values where appropriate.
 //
-// Environment variables in the configuration file are expanded using os.ExpandEnv,
-// allowing for dynamic configuration values using $VAR or ${VAR} syntax.
+// Environment variables in the configuration file are expanded using os.Expand,
+// allowing for dynamic configuration values using $VAR or ${VAR} syntax. They
+// are expanded in the parsed values, so quotes and backslashes in them are
+// taken literally. Named variables declared in a "vars" block take precedence
+// over environment variables, and files listed in "include" are merged
+// underneath the including file.
 //
 // Parameters:
-//   - configPath: Path to the JSON configuration file
+//   - configPath: Path to the configuration file
 //
 // Returns:
 //   - *Config: The loaded and validated configuration
@@ -88,20 +867,67 @@ type ListenerConfig struct {
 //	    return fmt.Errorf("config load failed: %w", err)
 //	}
 func LoadConfig(configPath string) (*Config, error) {
+	return LoadProfile(configPath, "")
+}
+
+// LoadProfile loads and validates configuration from a file with a named profile applied.
+//
+// Profiles are declared in the "profiles" object of the configuration file, or
+// as files in the profiles directory (see ProfileDir). Each profile is a partial
+// configuration that is merged over the top-level settings, so shared values
+// such as SSH credentials only need to be written once. A profile file is used
+// on its own when the configuration file does not exist.
+//
+// Parameters:
+//   - configPath: Path to the configuration file
+//   - profile: Name of the profile to apply, or empty for the top-level settings
+//
+// Returns:
+//   - *Config: The loaded and validated configuration
+//   - error: An error if loading fails, the profile is unknown, or validation fails
+//
+// Example:
+//
+//	cfg, err := LoadProfile("config.json", "work")
+func LoadProfile(configPath, profile string) (*Config, error) {
 	if configPath == "" {
 		return nil, fmt.Errorf("no config file specified")
 	}
 
-	data, err := os.ReadFile(configPath)
+	doc, err := loadDocument(configPath)
+	if err != nil {
+		// A profile file may hold a complete configuration on its own
+		if profile == "" || !errors.Is(err, fs.ErrNotExist) {
+			return nil, err
+		}
+		file, fileErr := loadProfileFile(profile)
+		if fileErr != nil {
+			return nil, fileErr
+		}
+		if file == nil {
+			return nil, err
+		}
+		doc = map[string]interface{}{}
+	}
+
+	doc, err = applyProfile(doc, profile)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := json.Marshal(doc)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read config file: %w", err)
+		return nil, fmt.Errorf("failed to parse config: %w", err)
 	}
 
 	config := &Config{}
-	content := os.ExpandEnv(string(data))
-	if err := json.Unmarshal([]byte(content), config); err != nil {
+	if err := json.Unmarshal(data, config); err != nil {
 		return nil, fmt.Errorf("failed to parse config: %w", err)
 	}
+	if credentials.password != "" {
+		config.SSH.Password = credentials.password
+	}
+	config.SSH.PrivateKey = credentials.privateKey
 
 	if err := config.validate(); err != nil {
 		return nil, err
@@ -119,52 +945,744 @@ func LoadConfig(configPath string) (*Config, error) {
 //
 // Validation checks include:
 //   - Mode must be either "direct" or "proxy""
-//   - Required fields (SSH host, SSH username/password) must be non-empty
+//   - Required fields (SSH host, SSH username/password) must be non-empty,
+//     unless a pre-connect hook supplies the credentials
 //   - Proxy mode requires proxyHost and proxyPort
 //   - Field values must be reasonable and properly formatted
 //
 // Returns:
 //   - error: A descriptive error if validation fails, nil if successful
 func (c *Config) validate() error {
-	validModes := map[string]bool{"direct": true, "proxy": true}
+	validModes := map[string]bool{"direct": true, "proxy": true, "auto": true}
 	if !validModes[c.Mode] {
-		return fmt.Errorf("invalid mode '%s', must be one of: direct, proxy", c.Mode)
+		return fmt.Errorf("invalid mode '%s', must be one of: direct, proxy, auto", c.Mode)
 	}
 
-	// Check required SSH fields
-	if c.SSH.Host == "" {
+	// Check required SSH fields; failover servers may each name their own host
+	if c.SSH.Host == "" && len(c.Servers) == 0 {
 		return fmt.Errorf("SSH host is required")
 	}
-	if c.SSH.Username == "" {
-		return fmt.Errorf("SSH username is required")
+	switch c.Latency.Action {
+	case "", "warn", "block":
+	default:
+		return fmt.Errorf("invalid latency.action '%s', must be one of: warn, block", c.Latency.Action)
 	}
-	if c.SSH.Password == "" {
-		return fmt.Errorf("SSH password is required")
+	if c.Latency.SlowThreshold < 0 || c.Latency.MinSamples < 0 || c.Latency.BlockDuration < 0 {
+		return fmt.Errorf("latency settings must not be negative")
 	}
 
-	// Validate proxy mode requirements
-	if c.Mode == "proxy" {
-		if c.ProxyHost == "" || c.ProxyPort == "" {
-			return fmt.Errorf("proxyHost and proxyPort are required for proxy mode")
-		}
+	if c.ChannelOpen.MaxInFlight < 0 || c.ChannelOpen.QueueTimeout < 0 || c.ChannelOpen.PerDestination < 0 || c.ChannelOpen.FailureWindow < 0 {
+		return fmt.Errorf("channelOpen settings must not be negative")
 	}
 
-	return nil
-}
+	if c.Watchdog.Timeout < 0 || c.Watchdog.KeepaliveInterval < 0 {
+		return fmt.Errorf("watchdog timeout and keepaliveInterval must not be negative")
+	}
 
-// setDefaults applies default values to optional configuration fields.
-//
-// This method sets sensible defaults for fields that were not explicitly
-// configured, ensuring the configuration is complete and ready for use.
-//
-// Default values applied:
-//   - SSH Port: 22 (standard SSH port)
-//   - Listener Port: 1080 (HTTP proxy port)
-//   - Listener ProxyType: "http" (http protocol)
-//   - ConnectionTimeout: 30 seconds
-func (c *Config) setDefaults() {
-	if c.SSH.Port == 0 {
-		c.SSH.Port = 22
+	if c.Reconnect.InitialDelay < 0 || c.Reconnect.MaxDelay < 0 || c.Reconnect.MaxAttempts < 0 || c.Reconnect.RejectedDelay < 0 {
+		return fmt.Errorf("reconnect settings must not be negative")
+	}
+	if c.Reconnect.MaxDelay > 0 && c.Reconnect.InitialDelay > c.Reconnect.MaxDelay {
+		return fmt.Errorf("reconnect.initialDelay must not exceed reconnect.maxDelay")
+	}
+	if c.Limits.MaxConnections < 0 || c.Limits.IdleTimeout < 0 || c.Limits.RateLimit < 0 || c.Limits.Workers < 0 || c.Limits.Queue < 0 {
+		return fmt.Errorf("limits must not be negative")
+	}
+	if c.Limits.Queue > 0 && c.Limits.Workers == 0 {
+		return fmt.Errorf("limits.queue requires limits.workers")
+	}
+
+	if c.Coalesce.Delay < 0 || c.Coalesce.Delay > 1000 {
+		return fmt.Errorf("coalesce.delay must be between 0 and 1000 milliseconds")
+	}
+	if c.Coalesce.BufferSize < 0 || c.Coalesce.BufferSize > 1<<20 {
+		return fmt.Errorf("coalesce.bufferSize must be between 0 and 1048576 bytes")
+	}
+	if q := c.FairQueue.Quantum; q != 0 && (q < 1024 || q > 1<<20) {
+		return fmt.Errorf("fairQueue.quantum must be between 1024 and 1048576 bytes")
+	}
+
+	// Credentials may be supplied at connect time by a pre-connect hook
+	if hook := c.Hooks.PreConnect; hook != nil {
+		if (hook.Command == "") == (hook.URL == "") {
+			return fmt.Errorf("hooks.preConnect requires exactly one of command or url")
+		}
+	} else {
+		if c.SSH.Username == "" {
+			return fmt.Errorf("SSH username is required")
+		}
+		if c.SSH.Password == "" && c.SSH.PrivateKey == "" && !c.SSH.Agent && !c.SSH.KeyboardInteractive {
+			return fmt.Errorf("SSH password is required unless a private key is given or ssh.agent or ssh.keyboardInteractive is enabled")
+		}
+	}
+
+	if len(c.SSH.Answers) > 0 && !c.SSH.KeyboardInteractive {
+		return fmt.Errorf("ssh.answers requires ssh.keyboardInteractive")
+	}
+	if fp := c.SSH.HostKeyFingerprint; fp != "" {
+		digest, err := base64.RawStdEncoding.DecodeString(strings.TrimPrefix(fp, "SHA256:"))
+		if !strings.HasPrefix(fp, "SHA256:") || err != nil || len(digest) != sha256.Size {
+			return fmt.Errorf("ssh.hostKeyFingerprint must be a SHA256 fingerprint as printed by ssh-keygen -l, e.g. SHA256:uNiVztksCsDhcc0u9e8BujQXVUpKZIDTMczCvj3tD2s")
+		}
+	}
+
+	for _, cipher := range c.SSH.Ciphers {
+		if !slices.Contains(ssh.Ciphers, cipher) {
+			return fmt.Errorf("unsupported ssh cipher '%s', must be one of: %s", cipher, strings.Join(ssh.Ciphers, ", "))
+		}
+	}
+	for _, mac := range c.SSH.MACs {
+		if !slices.Contains(ssh.MACs, mac) {
+			return fmt.Errorf("unsupported ssh MAC '%s', must be one of: %s", mac, strings.Join(ssh.MACs, ", "))
+		}
+	}
+
+	for _, entry := range c.Knock.Sequence {
+		if _, _, err := ParseKnock(entry); err != nil {
+			return fmt.Errorf("knock.sequence: %w", err)
+		}
+	}
+	if c.Knock.Delay < 0 || c.Knock.Delay > 10000 || c.Knock.Wait < 0 || c.Knock.Wait > 10000 {
+		return fmt.Errorf("knock.delay and knock.wait must be between 0 and 10000 milliseconds")
+	}
+	if u := c.Knock.WakeURL; u != "" && !strings.HasPrefix(u, "http://") && !strings.HasPrefix(u, "https://") {
+		return fmt.Errorf("knock.wakeUrl must be an http:// or https:// URL")
+	}
+
+	if c.Connect.BindAddress != "" && net.ParseIP(c.Connect.BindAddress) == nil {
+		return fmt.Errorf("invalid connect.bindAddress '%s', must be an IP address", c.Connect.BindAddress)
+	}
+	if p := c.Connect.Prefer; p != "" && p != "ipv4" && p != "ipv6" {
+		return fmt.Errorf("invalid connect.prefer '%s', must be 'ipv4' or 'ipv6'", p)
+	}
+	for name, address := range c.Hosts {
+		if net.ParseIP(address) == nil {
+			return fmt.Errorf("invalid address '%s' for hosts entry '%s'", address, name)
+		}
+	}
+
+	if _, _, err := c.TLS.Versions(); err != nil {
+		return err
+	}
+	if _, err := c.TLS.CipherSuiteIDs(); err != nil {
+		return err
+	}
+	if _, err := c.TLS.Pins(); err != nil {
+		return err
+	}
+	if (c.TLS.CertFile == "") != (c.TLS.KeyFile == "") {
+		return fmt.Errorf("tls.certFile and tls.keyFile must be set together")
+	}
+	for _, proto := range c.TLS.ALPN {
+		if proto == "" {
+			return fmt.Errorf("tls.alpn must not contain empty protocol names")
+		}
+	}
+
+	if c.Control.Address != "" {
+		host, _, err := net.SplitHostPort(c.Control.Address)
+		if err != nil {
+			return fmt.Errorf("invalid control.address '%s': %w", c.Control.Address, err)
+		}
+		if ip := net.ParseIP(host); host != "localhost" && (ip == nil || !ip.IsLoopback()) {
+			return fmt.Errorf("control.address '%s' must be a loopback address", c.Control.Address)
+		}
+	} else if c.Control.Pprof {
+		return fmt.Errorf("control.pprof requires control.address")
+	}
+
+	if c.StatusPage.Address != "" {
+		if _, _, err := net.SplitHostPort(c.StatusPage.Address); err != nil {
+			return fmt.Errorf("invalid statusPage.address '%s': %w", c.StatusPage.Address, err)
+		}
+	}
+	if err := validateClients("statusPage", c.StatusPage.Allow, c.StatusPage.Deny); err != nil {
+		return err
+	}
+
+	if err := c.Listener.validate("listener"); err != nil {
+		return err
+	}
+	for i := range c.Listeners {
+		l := &c.Listeners[i]
+		section := fmt.Sprintf("listeners[%d]", i)
+		if l.Port < 1 || l.Port > 65535 {
+			return fmt.Errorf("%s.port must be between 1 and 65535", section)
+		}
+		if err := l.validate(section); err != nil {
+			return err
+		}
+	}
+	if err := c.validateListenerPorts(); err != nil {
+		return err
+	}
+
+	if c.Blocklist.UpdateHours < 0 {
+		return fmt.Errorf("blocklist.updateHours must not be negative")
+	}
+
+	if err := c.DNS.validate(); err != nil {
+		return err
+	}
+
+	if c.RequestLog.File == "" && len(c.RequestLog.Exclude) > 0 {
+		return fmt.Errorf("requestLog.exclude requires requestLog.file")
+	}
+	if c.RequestLog.File != "" && !c.servesHTTP() {
+		return fmt.Errorf("requestLog requires a listener with proxyType 'http' or 'mixed'")
+	}
+	if c.HTTPCache.Enabled && !c.servesHTTP() {
+		return fmt.Errorf("httpCache requires a listener with proxyType 'http' or 'mixed'")
+	}
+	if c.HTTPCache.MaxSize < 0 || c.HTTPCache.MaxEntrySize < 0 {
+		return fmt.Errorf("httpCache sizes must not be negative")
+	}
+	if c.Preconnect.Enabled && !c.servesHTTP() {
+		return fmt.Errorf("preconnect requires a listener with proxyType 'http' or 'mixed'")
+	}
+	if c.Preconnect.IdleTimeout < 0 || c.Preconnect.IdleTimeout > 300 {
+		return fmt.Errorf("preconnect.idleTimeout must be between 0 and 300 seconds")
+	}
+	if c.Accelerator.Enabled && !c.servesHTTP() {
+		return fmt.Errorf("accelerator requires a listener with proxyType 'http' or 'mixed'")
+	}
+	if c.Accelerator.Parts != 0 && (c.Accelerator.Parts < 2 || c.Accelerator.Parts > 16) {
+		return fmt.Errorf("accelerator.parts must be between 2 and 16")
+	}
+	if c.Accelerator.MinSize < 0 {
+		return fmt.Errorf("accelerator.minSize must not be negative")
+	}
+
+	if err := c.ReverseSOCKS.validate(); err != nil {
+		return err
+	}
+	if err := validateForwards(c.Forwards); err != nil {
+		return err
+	}
+	if err := validateRemoteForwards(c.RemoteForwards); err != nil {
+		return err
+	}
+
+	if c.ACL.File != "" && c.ACL.Command != "" {
+		return fmt.Errorf("acl.file and acl.command cannot be used together")
+	}
+	if c.ACL.Required && c.ACL.File == "" && c.ACL.Command == "" {
+		return fmt.Errorf("acl.required requires acl.file or acl.command")
+	}
+	if (c.ACL.CountryDB != "" || c.ACL.ASNDB != "") && c.ACL.File == "" && c.ACL.Command == "" {
+		return fmt.Errorf("acl.countryDb and acl.asnDb require acl.file or acl.command")
+	}
+
+	for i, w := range c.Schedule {
+		if _, err := schedule.NewWindow(w.Start, w.Stop); err != nil {
+			return fmt.Errorf("invalid schedule[%d]: %w", i, err)
+		}
+	}
+
+	if err := c.Multipath.validate(); err != nil {
+		return err
+	}
+
+	if err := c.Auto.validate(c.Mode); err != nil {
+		return err
+	}
+
+	switch c.Balance.Strategy {
+	case "":
+	case "round-robin", "least-connections":
+		if len(c.Servers) < 2 {
+			return fmt.Errorf("balance.strategy requires at least two entries in servers")
+		}
+		if len(c.Multipath.Uplinks) > 0 {
+			return fmt.Errorf("balance.strategy cannot be used with multipath.uplinks")
+		}
+	default:
+		return fmt.Errorf("invalid balance.strategy '%s', must be one of: round-robin, least-connections", c.Balance.Strategy)
+	}
+
+	if len(c.Servers) > 0 {
+		return c.validateServers()
+	}
+
+	// Validate proxy mode requirements
+	if c.Mode == "proxy" {
+		if c.ProxyHost == "" || c.ProxyPort == "" {
+			return fmt.Errorf("proxyHost and proxyPort are required for proxy mode")
+		}
+	}
+
+	return nil
+}
+
+// validateServers checks the failover servers, each as it resolves with the
+// top-level settings.
+func (c *Config) validateServers() error {
+	names := make(map[string]bool)
+	for i, s := range c.Servers {
+		if s.Name == "" {
+			return fmt.Errorf("servers[%d] requires a name", i)
+		}
+		if names[s.Name] {
+			return fmt.Errorf("duplicate server name '%s'", s.Name)
+		}
+		names[s.Name] = true
+
+		switch s.Mode {
+		case "", "direct", "proxy":
+		default:
+			return fmt.Errorf("invalid mode '%s' in server '%s', must be one of: direct, proxy", s.Mode, s.Name)
+		}
+		if s.Priority < 0 {
+			return fmt.Errorf("priority of server '%s' must not be negative", s.Name)
+		}
+		if s.Port < 0 || s.Port > 65535 {
+			return fmt.Errorf("invalid port %d in server '%s'", s.Port, s.Name)
+		}
+
+		resolved := *c
+		s.Apply(&resolved)
+		if resolved.SSH.Host == "" {
+			return fmt.Errorf("server '%s' requires a host", s.Name)
+		}
+		if resolved.Mode == "proxy" && (resolved.ProxyHost == "" || resolved.ProxyPort == "") {
+			return fmt.Errorf("server '%s' uses proxy mode but proxyHost or proxyPort is not set", s.Name)
+		}
+		if fp := s.HostKeyFingerprint; fp != "" {
+			digest, err := base64.RawStdEncoding.DecodeString(strings.TrimPrefix(fp, "SHA256:"))
+			if !strings.HasPrefix(fp, "SHA256:") || err != nil || len(digest) != sha256.Size {
+				return fmt.Errorf("hostKeyFingerprint of server '%s' must be a SHA256 fingerprint as printed by ssh-keygen -l", s.Name)
+			}
+		}
+	}
+	return nil
+}
+
+// ServersByPriority returns the failover servers in the order they are tried:
+// by priority, lowest first, keeping the configured order within a priority.
+//
+// Returns:
+//   - []Server: The ordered servers, empty without failover
+func (c *Config) ServersByPriority() []Server {
+	servers := slices.Clone(c.Servers)
+	slices.SortStableFunc(servers, func(a, b Server) int { return a.Priority - b.Priority })
+	return servers
+}
+
+// validate checks the multipath settings.
+//
+// Only hot-standby is supported: bonding (striping one stream over several
+// uplinks) needs a server-side component to reorder the stripes, which a plain
+// SSH server does not provide.
+func (m *MultipathConfig) validate() error {
+	if len(m.Uplinks) == 0 {
+		if m.Mode != "" {
+			return fmt.Errorf("multipath.mode requires multipath.uplinks")
+		}
+		return nil
+	}
+
+	switch m.Mode {
+	case "", "standby":
+	case "bond":
+		return fmt.Errorf("multipath mode 'bond' is not supported: striping requires server-side reassembly, use 'standby'")
+	default:
+		return fmt.Errorf("invalid multipath.mode '%s', must be: standby", m.Mode)
+	}
+
+	if len(m.Uplinks) < 2 {
+		return fmt.Errorf("multipath requires at least two uplinks")
+	}
+	for i, u := range m.Uplinks {
+		if u.BindAddress == "" && u.BindInterface == "" {
+			return fmt.Errorf("multipath.uplinks[%d] requires bindAddress or bindInterface", i)
+		}
+		if u.BindAddress != "" && net.ParseIP(u.BindAddress) == nil {
+			return fmt.Errorf("invalid multipath.uplinks[%d].bindAddress '%s'", i, u.BindAddress)
+		}
+		if u.Prefer != "" && u.Prefer != "ipv4" && u.Prefer != "ipv6" {
+			return fmt.Errorf("invalid multipath.uplinks[%d].prefer '%s', must be 'ipv4' or 'ipv6'", i, u.Prefer)
+		}
+	}
+	return nil
+}
+
+// validate checks the reverse SOCKS5 proxy settings.
+func (r *ReverseSOCKSConfig) validate() error {
+	if r.Listen == "" {
+		if len(r.Allow) > 0 {
+			return fmt.Errorf("reverseSocks.allow requires reverseSocks.listen")
+		}
+		return nil
+	}
+
+	if _, _, err := net.SplitHostPort(r.Listen); err != nil {
+		return fmt.Errorf("invalid reverseSocks.listen '%s': %w", r.Listen, err)
+	}
+	for i, network := range r.Allow {
+		if _, err := netip.ParsePrefix(network); err != nil {
+			return fmt.Errorf("invalid reverseSocks.allow[%d] '%s': %w", i, network, err)
+		}
+	}
+	return nil
+}
+
+// validateForwards checks the local port forwards.
+func validateForwards(forwards []ForwardConfig) error {
+	listening := make(map[string]int, len(forwards))
+	for i, f := range forwards {
+		host, port, err := net.SplitHostPort(f.Listen)
+		if err != nil {
+			return fmt.Errorf("invalid forwards[%d].listen '%s': %w", i, f.Listen, err)
+		}
+		if host != "" && net.ParseIP(host) == nil {
+			return fmt.Errorf("invalid forwards[%d].listen '%s', the host must be an IP address", i, f.Listen)
+		}
+		if !validPort(port) {
+			return fmt.Errorf("invalid forwards[%d].listen '%s', the port must be between 1 and 65535", i, f.Listen)
+		}
+		if j, ok := listening[f.Listen]; ok {
+			return fmt.Errorf("forwards[%d] and forwards[%d] listen on the same address '%s'", j, i, f.Listen)
+		}
+		listening[f.Listen] = i
+
+		host, port, err = net.SplitHostPort(f.Remote)
+		if err != nil {
+			return fmt.Errorf("invalid forwards[%d].remote '%s': %w", i, f.Remote, err)
+		}
+		if host == "" || !validPort(port) {
+			return fmt.Errorf("invalid forwards[%d].remote '%s', must be host:port", i, f.Remote)
+		}
+	}
+	return nil
+}
+
+// validateRemoteForwards checks the remote port forwards.
+func validateRemoteForwards(forwards []RemoteForwardConfig) error {
+	listening := make(map[string]int, len(forwards))
+	for i, f := range forwards {
+		host, port, err := net.SplitHostPort(f.RemoteListen)
+		if err != nil {
+			return fmt.Errorf("invalid remoteForwards[%d].remoteListen '%s': %w", i, f.RemoteListen, err)
+		}
+		if host == "" || !validPort(port) {
+			return fmt.Errorf("invalid remoteForwards[%d].remoteListen '%s', must be host:port", i, f.RemoteListen)
+		}
+		if j, ok := listening[f.RemoteListen]; ok {
+			return fmt.Errorf("remoteForwards[%d] and remoteForwards[%d] listen on the same address '%s'", j, i, f.RemoteListen)
+		}
+		listening[f.RemoteListen] = i
+
+		host, port, err = net.SplitHostPort(f.Local)
+		if err != nil {
+			return fmt.Errorf("invalid remoteForwards[%d].local '%s': %w", i, f.Local, err)
+		}
+		if host == "" || !validPort(port) {
+			return fmt.Errorf("invalid remoteForwards[%d].local '%s', must be host:port", i, f.Local)
+		}
+	}
+	return nil
+}
+
+// validPort reports whether a string is a port number from 1 to 65535.
+func validPort(port string) bool {
+	n, err := strconv.Atoi(port)
+	return err == nil && n >= 1 && n <= 65535
+}
+
+// ParseForward parses a forward given on the command line in the form of
+// the -L option of OpenSSH, "[L:][bind_address:]port:host:hostport", where
+// IPv6 addresses are written in brackets.
+//
+// Parameters:
+//   - spec: The forward to parse
+//
+// Returns:
+//   - ForwardConfig: The forward, listening on the loopback address unless a
+//     bind address is given
+//   - error: An error if spec is not in the expected form
+func ParseForward(spec string) (ForwardConfig, error) {
+	fields := splitForward(strings.TrimPrefix(spec, "L:"))
+	if len(fields) == 3 {
+		fields = append([]string{"127.0.0.1"}, fields...)
+	}
+	if len(fields) != 4 {
+		return ForwardConfig{}, fmt.Errorf("invalid forward '%s', must be [L:][bind_address:]port:host:hostport", spec)
+	}
+	for i, field := range fields {
+		fields[i] = strings.TrimSuffix(strings.TrimPrefix(field, "["), "]")
+	}
+	if net.ParseIP(fields[0]) == nil {
+		return ForwardConfig{}, fmt.Errorf("invalid forward '%s', the bind address must be an IP address", spec)
+	}
+	if !validPort(fields[1]) || fields[2] == "" || !validPort(fields[3]) {
+		return ForwardConfig{}, fmt.Errorf("invalid forward '%s', ports must be between 1 and 65535", spec)
+	}
+	return ForwardConfig{
+		Listen: net.JoinHostPort(fields[0], fields[1]),
+		Remote: net.JoinHostPort(fields[2], fields[3]),
+	}, nil
+}
+
+// splitForward splits a forward at the colons outside brackets.
+func splitForward(spec string) []string {
+	var fields []string
+	start, depth := 0, 0
+	for i, r := range spec {
+		switch r {
+		case '[':
+			depth++
+		case ']':
+			depth--
+		case ':':
+			if depth == 0 {
+				fields = append(fields, spec[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(fields, spec[start:])
+}
+
+// servesHTTP reports whether the listener serves HTTP proxy clients, which
+// the request log, the cache, preconnecting, header casing and the
+// accelerator need.
+func (l *ListenerConfig) servesHTTP() bool {
+	return l.ProxyType == "" || l.ProxyType == "http" || l.ProxyType == "mixed"
+}
+
+// servesHTTP reports whether any of the proxies serves HTTP proxy clients.
+func (c *Config) servesHTTP() bool {
+	return slices.ContainsFunc(c.ProxyListeners(), func(l ListenerConfig) bool { return l.servesHTTP() })
+}
+
+// ProxyListeners returns the settings of every local proxy: listener first,
+// then the entries of listeners.
+func (c *Config) ProxyListeners() []ListenerConfig {
+	return append([]ListenerConfig{c.Listener}, c.Listeners...)
+}
+
+// validate checks the settings of a proxy listener.
+//
+// Parameters:
+//   - section: The name of the listener in error messages, e.g. "listeners[0]"
+//
+// Returns:
+//   - error: An error if a setting is invalid
+func (l *ListenerConfig) validate(section string) error {
+	switch l.ProxyType {
+	case "", "http", "socks5", "socks", "mixed", "transparent":
+	default:
+		return fmt.Errorf("invalid %s.proxyType '%s', must be one of: http, socks5, mixed, transparent", section, l.ProxyType)
+	}
+	if l.Host != "" && net.ParseIP(l.Host) == nil {
+		return fmt.Errorf("invalid %s.host '%s', must be an IP address", section, l.Host)
+	}
+	if err := validateClients(section, l.Allow, l.Deny); err != nil {
+		return err
+	}
+	for _, name := range l.HeaderCase {
+		if !validHeaderName(name) {
+			return fmt.Errorf("invalid header name '%s' in %s.headerCase", name, section)
+		}
+	}
+	if len(l.HeaderCase) > 0 && !l.servesHTTP() {
+		return fmt.Errorf("%s.headerCase requires %s.proxyType 'http' or 'mixed'", section, section)
+	}
+	return nil
+}
+
+// validateListenerPorts checks that no two proxies are configured on the same
+// port. Ports are compared regardless of the host, since listening on all
+// addresses and on one of them conflict as well.
+func (c *Config) validateListenerPorts() error {
+	port := c.Listener.Port
+	if port == 0 {
+		port = 1080 // The default, not yet set
+	}
+	ports := map[int]string{port: "listener"}
+	for i, l := range c.Listeners {
+		section := fmt.Sprintf("listeners[%d]", i)
+		if other, ok := ports[l.Port]; ok {
+			return fmt.Errorf("%s and %s both use port %d", other, section, l.Port)
+		}
+		ports[l.Port] = section
+	}
+	return nil
+}
+
+// validHeaderName reports whether a string is a valid HTTP header name, a
+// token as defined by RFC 9110.
+func validHeaderName(name string) bool {
+	return name != "" && !strings.ContainsFunc(name, func(r rune) bool {
+		return r > '~' || r <= ' ' || strings.ContainsRune(`"(),/:;<=>?@[\]{}`, r)
+	})
+}
+
+// validateClients checks the client allowlist and denylist of a listener.
+//
+// Parameters:
+//   - section: Name of the listener's section for error messages
+//   - allow: The allowed networks or addresses
+//   - deny: The denied networks or addresses
+//
+// Returns:
+//   - error: An error naming the first entry that is not a network or address
+func validateClients(section string, allow, deny []string) error {
+	for i, entry := range allow {
+		if _, err := clientfilter.ParsePrefix(entry); err != nil {
+			return fmt.Errorf("invalid %s.allow[%d]: %w", section, i, err)
+		}
+	}
+	for i, entry := range deny {
+		if _, err := clientfilter.ParsePrefix(entry); err != nil {
+			return fmt.Errorf("invalid %s.deny[%d]: %w", section, i, err)
+		}
+	}
+	return nil
+}
+
+// validate checks the DNS resolver settings.
+func (d *DNSConfig) validate() error {
+	if d.Bootstrap != "" {
+		u, err := url.Parse(d.Bootstrap)
+		if err != nil || u.Scheme != "https" || u.Host == "" {
+			return fmt.Errorf("invalid dns.bootstrap '%s', must be an https:// DNS-over-HTTPS URL", d.Bootstrap)
+		}
+		if len(d.Servers) > 0 {
+			return fmt.Errorf("dns.bootstrap and dns.servers cannot be used together")
+		}
+	}
+	for i, server := range d.Servers {
+		host, _, err := net.SplitHostPort(server)
+		if err != nil {
+			host = server
+		}
+		if net.ParseIP(host) == nil {
+			return fmt.Errorf("invalid dns.servers[%d] '%s', must be an IP address with an optional port", i, server)
+		}
+	}
+	if d.Listen == "" {
+		if d.Upstream != "" || len(d.Hosts) > 0 || len(d.Rules) > 0 || len(d.Blocklists) > 0 || len(d.Allow) > 0 || len(d.Deny) > 0 {
+			return fmt.Errorf("dns settings require dns.listen")
+		}
+		return nil
+	}
+
+	if _, _, err := net.SplitHostPort(d.Listen); err != nil {
+		return fmt.Errorf("invalid dns.listen '%s': %w", d.Listen, err)
+	}
+	if err := validateClients("dns", d.Allow, d.Deny); err != nil {
+		return err
+	}
+	if d.Upstream != "" {
+		if _, _, err := net.SplitHostPort(d.Upstream); err != nil {
+			return fmt.Errorf("invalid dns.upstream '%s': %w", d.Upstream, err)
+		}
+	}
+	for name, address := range d.Hosts {
+		if net.ParseIP(address) == nil {
+			return fmt.Errorf("invalid address '%s' for dns.hosts entry '%s'", address, name)
+		}
+	}
+	for i, rule := range d.Rules {
+		if rule.Domain == "" {
+			return fmt.Errorf("dns.rules[%d] requires a domain", i)
+		}
+		switch rule.Action {
+		case "forward":
+		case "block":
+			if rule.Upstream != "" || rule.Direct {
+				return fmt.Errorf("dns.rules[%d]: upstream and direct only apply to action 'forward'", i)
+			}
+		default:
+			return fmt.Errorf("invalid dns.rules[%d].action '%s', must be one of: forward, block", i, rule.Action)
+		}
+		if rule.Upstream != "" {
+			if _, _, err := net.SplitHostPort(rule.Upstream); err != nil {
+				return fmt.Errorf("invalid dns.rules[%d].upstream '%s': %w", i, rule.Upstream, err)
+			}
+		}
+		if rule.Direct && rule.Upstream == "" {
+			return fmt.Errorf("dns.rules[%d]: direct requires an upstream", i)
+		}
+	}
+	return nil
+}
+
+// validate checks the auto mode settings. Strategies using presets are
+// checked further when the presets are resolved at connect time.
+func (a *AutoConfig) validate(mode string) error {
+	if mode != "auto" {
+		if len(a.Strategies) > 0 {
+			return fmt.Errorf("auto.strategies requires mode 'auto'")
+		}
+		return nil
+	}
+
+	if len(a.Strategies) == 0 {
+		return fmt.Errorf("auto mode requires at least one entry in auto.strategies")
+	}
+	if a.ErrorBudget < 0 || a.ErrorBudget > 1 {
+		return fmt.Errorf("auto.errorBudget must be between 0 and 1")
+	}
+	if a.Window < 0 {
+		return fmt.Errorf("auto.window must not be negative")
+	}
+
+	names := make(map[string]bool)
+	for i, s := range a.Strategies {
+		if s.Name == "" {
+			return fmt.Errorf("auto.strategies[%d] requires a name", i)
+		}
+		if names[s.Name] {
+			return fmt.Errorf("duplicate strategy name '%s'", s.Name)
+		}
+		names[s.Name] = true
+
+		switch s.Mode {
+		case "direct", "proxy":
+		case "":
+			if s.Preset == "" {
+				return fmt.Errorf("strategy '%s' requires a mode or a preset", s.Name)
+			}
+		default:
+			return fmt.Errorf("invalid mode '%s' in strategy '%s', must be one of: direct, proxy", s.Mode, s.Name)
+		}
+	}
+	return nil
+}
+
+// setDefaults applies default values to optional configuration fields.
+//
+// This method sets sensible defaults for fields that were not explicitly
+// configured, ensuring the configuration is complete and ready for use.
+//
+// Default values applied:
+//   - SSH Port: 22 (standard SSH port)
+//   - Listener Port: 1080 (HTTP proxy port)
+//   - Listener ProxyType: "http" (http protocol)
+//   - Listener Host: "127.0.0.1" (loopback only)
+//   - ConnectionTimeout: 30 seconds
+//   - Reconnect delay: 1 second, doubling up to 30 seconds
+//   - Knocks: 200 milliseconds apart, followed by a 500 millisecond wait
+//   - Pre-connect hook timeout: 30 seconds
+//   - Tor SOCKS addresses: 127.0.0.1:9050 locally and on the SSH server
+//   - Latency: warn after 3 consecutive channel opens slower than 3 seconds, blocks last 300 seconds
+//   - Watchdog keepalive interval: a third of the watchdog timeout
+//   - Channel-open queue timeout: the connection timeout
+//   - Coalescing buffer size: 16384 bytes when a coalescing delay is set
+//   - Fair queue quantum: 16384 bytes when fair queuing is enabled
+//   - HTTP cache: 256 MB in total, responses up to 32 MB
+//   - Worker queue: 256 clients when limits.workers is set
+//   - Auto mode: error budget 0.5 over the last 20 attempts per strategy
+func (c *Config) setDefaults() {
+	if c.SSH.Port == 0 {
+		c.SSH.Port = 22
+	}
+	// IPv6 server addresses may be written in brackets, as in URLs
+	c.SSH.Host, c.ProxyHost = unbracket(c.SSH.Host), unbracket(c.ProxyHost)
+	for i := range c.Servers {
+		c.Servers[i].Host, c.Servers[i].ProxyHost = unbracket(c.Servers[i].Host), unbracket(c.Servers[i].ProxyHost)
 	}
 	if c.Listener.Port == 0 {
 		c.Listener.Port = 1080
@@ -172,7 +1690,126 @@ func (c *Config) setDefaults() {
 	if c.Listener.ProxyType == "" {
 		c.Listener.ProxyType = "http"
 	}
+	if c.Listener.Host == "" {
+		c.Listener.Host = "127.0.0.1"
+	}
+	for i := range c.Listeners {
+		if c.Listeners[i].ProxyType == "" {
+			c.Listeners[i].ProxyType = "http"
+		}
+		if c.Listeners[i].Host == "" {
+			c.Listeners[i].Host = "127.0.0.1"
+		}
+	}
 	if c.ConnectionTimeout == 0 {
 		c.ConnectionTimeout = 30
 	}
+	if c.Limits.Workers > 0 && c.Limits.Queue == 0 {
+		c.Limits.Queue = 256
+	}
+	if c.Reconnect.InitialDelay == 0 {
+		c.Reconnect.InitialDelay = 1
+	}
+	if c.Reconnect.MaxDelay == 0 {
+		c.Reconnect.MaxDelay = max(30, c.Reconnect.InitialDelay)
+	}
+	if len(c.Knock.Sequence) > 0 {
+		if c.Knock.Delay == 0 {
+			c.Knock.Delay = 200
+		}
+		if c.Knock.Wait == 0 {
+			c.Knock.Wait = 500
+		}
+	}
+	if c.Hooks.PreConnect != nil && c.Hooks.PreConnect.Timeout == 0 {
+		c.Hooks.PreConnect.Timeout = 30
+	}
+	if c.Tor.SocksAddress == "" {
+		c.Tor.SocksAddress = "127.0.0.1:9050"
+	}
+	if c.Tor.RemoteSocksAddress == "" {
+		c.Tor.RemoteSocksAddress = "127.0.0.1:9050"
+	}
+	if c.Latency.SlowThreshold == 0 {
+		c.Latency.SlowThreshold = 3
+	}
+	if c.Latency.MinSamples == 0 {
+		c.Latency.MinSamples = 3
+	}
+	if c.Latency.Action == "" {
+		c.Latency.Action = "warn"
+	}
+	if c.Latency.BlockDuration == 0 {
+		c.Latency.BlockDuration = 300
+	}
+	if c.Watchdog.Timeout > 0 && c.Watchdog.KeepaliveInterval == 0 {
+		c.Watchdog.KeepaliveInterval = max(c.Watchdog.Timeout/3, 1)
+	}
+	if c.ChannelOpen.QueueTimeout == 0 {
+		c.ChannelOpen.QueueTimeout = c.ConnectionTimeout
+	}
+	if c.FairQueue.Enabled && c.FairQueue.Quantum == 0 {
+		c.FairQueue.Quantum = 16384
+	}
+	if c.Coalesce.Delay > 0 && c.Coalesce.BufferSize == 0 {
+		c.Coalesce.BufferSize = 16384
+	}
+	if c.HTTPCache.MaxSize == 0 {
+		c.HTTPCache.MaxSize = 256
+	}
+	if c.HTTPCache.MaxEntrySize == 0 {
+		c.HTTPCache.MaxEntrySize = 32
+	}
+	if c.Preconnect.IdleTimeout == 0 {
+		c.Preconnect.IdleTimeout = 10
+	}
+	if c.Accelerator.Parts == 0 {
+		c.Accelerator.Parts = 4
+	}
+	if c.Accelerator.MinSize == 0 {
+		c.Accelerator.MinSize = 8
+	}
+	if c.Mode == "auto" {
+		if c.Auto.ErrorBudget == 0 {
+			c.Auto.ErrorBudget = 0.5
+		}
+		if c.Auto.Window == 0 {
+			c.Auto.Window = 20
+		}
+	}
+	if len(c.Multipath.Uplinks) > 0 && c.Multipath.Mode == "" {
+		c.Multipath.Mode = "standby"
+	}
+	if len(c.Blocklist.Lists) > 0 && c.Blocklist.UpdateHours == 0 {
+		c.Blocklist.UpdateHours = 24
+	}
+	if c.DNS.Listen != "" && c.DNS.Upstream == "" {
+		c.DNS.Upstream = "1.1.1.1:53"
+	}
+	for i, server := range c.DNS.Servers {
+		if _, _, err := net.SplitHostPort(server); err != nil {
+			c.DNS.Servers[i] = net.JoinHostPort(server, "53")
+		}
+	}
+	for i := range c.DNS.Rules {
+		if c.DNS.Rules[i].Action == "forward" && c.DNS.Rules[i].Upstream == "" {
+			c.DNS.Rules[i].Upstream = c.DNS.Upstream
+		}
+	}
+	for i := range c.Forwards {
+		if host, port, err := net.SplitHostPort(c.Forwards[i].Listen); err == nil && host == "" {
+			c.Forwards[i].Listen = net.JoinHostPort("127.0.0.1", port)
+		}
+	}
+	if c.StatusPage.Address != "" && c.StatusPage.CountryURL == "" {
+		c.StatusPage.CountryURL = "https://www.cloudflare.com/cdn-cgi/trace"
+	}
+}
+
+// unbracket removes the brackets around an IPv6 address, as in "[2001:db8::1]".
+func unbracket(host string) string {
+	if inner, ok := strings.CutPrefix(host, "["); ok && strings.HasSuffix(inner, "]") {
+		return strings.TrimSuffix(inner, "]")
+	}
+	return host
 }
@@ -0,0 +1,122 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// Change is a setting that differs between two configurations.
+type Change struct {
+	Path string // Setting in dotted notation, e.g. "listener.port" or "servers[1].host"
+	Old  any    // Value in the old configuration as decoded from JSON, nil if unset
+	New  any    // Value in the new configuration as decoded from JSON, nil if unset
+}
+
+// Diff compares two configurations setting by setting.
+//
+// Both configurations are compared as they are written to JSON, so settings
+// left at their zero value count as unset, and defaults applied while loading
+// are compared like any other value. Lists are compared entry by entry.
+//
+// Parameters:
+//   - old: The configuration before the change
+//   - new: The configuration after the change
+//
+// Returns:
+//   - []Change: The differing settings sorted by path
+//   - error: An error if a configuration cannot be encoded
+func Diff(old, new *Config) ([]Change, error) {
+	oldDoc, err := toDocument(old)
+	if err != nil {
+		return nil, err
+	}
+	newDoc, err := toDocument(new)
+	if err != nil {
+		return nil, err
+	}
+
+	var changes []Change
+	diffValues("", oldDoc, newDoc, &changes)
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Path < changes[j].Path })
+	return changes, nil
+}
+
+// Sections returns the top-level settings a list of changes concerns, in
+// order and without duplicates.
+//
+// Parameters:
+//   - changes: Changes returned by Diff
+//
+// Returns:
+//   - []string: The top-level setting names, e.g. "listener"
+func Sections(changes []Change) []string {
+	var sections []string
+	for _, c := range changes {
+		section, _, _ := strings.Cut(c.Path, ".")
+		section, _, _ = strings.Cut(section, "[")
+		if len(sections) == 0 || sections[len(sections)-1] != section {
+			sections = append(sections, section)
+		}
+	}
+	return sections
+}
+
+// toDocument converts a configuration into its generic JSON form.
+func toDocument(cfg *Config) (any, error) {
+	data, err := json.Marshal(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode config: %w", err)
+	}
+	var doc any
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("failed to encode config: %w", err)
+	}
+	return doc, nil
+}
+
+// diffValues records the differences between two decoded JSON values,
+// descending into objects and lists.
+func diffValues(path string, old, new any, changes *[]Change) {
+	oldMap, oldIsMap := old.(map[string]any)
+	newMap, newIsMap := new.(map[string]any)
+	if oldIsMap && newIsMap || oldIsMap && new == nil || old == nil && newIsMap {
+		keys := make(map[string]bool, len(oldMap)+len(newMap))
+		for k := range oldMap {
+			keys[k] = true
+		}
+		for k := range newMap {
+			keys[k] = true
+		}
+		for k := range keys {
+			child := k
+			if path != "" {
+				child = path + "." + k
+			}
+			diffValues(child, oldMap[k], newMap[k], changes)
+		}
+		return
+	}
+
+	oldList, oldIsList := old.([]any)
+	newList, newIsList := new.([]any)
+	if oldIsList && newIsList || oldIsList && new == nil || old == nil && newIsList {
+		for i := 0; i < max(len(oldList), len(newList)); i++ {
+			var o, n any
+			if i < len(oldList) {
+				o = oldList[i]
+			}
+			if i < len(newList) {
+				n = newList[i]
+			}
+			diffValues(fmt.Sprintf("%s[%d]", path, i), o, n, changes)
+		}
+		return
+	}
+
+	if !reflect.DeepEqual(old, new) {
+		*changes = append(*changes, Change{Path: path, Old: old, New: new})
+	}
+}
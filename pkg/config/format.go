@@ -0,0 +1,113 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Configuration file formats, detected from the file extension.
+const (
+	FormatJSON = "json"
+	FormatYAML = "yaml"
+	FormatTOML = "toml"
+)
+
+// Format returns the format of a configuration file from its extension:
+// .yaml and .yml files are YAML, .toml files TOML, and everything else JSON.
+//
+// Parameters:
+//   - path: Path or URL path of the configuration file
+//
+// Returns:
+//   - string: FormatJSON, FormatYAML or FormatTOML
+func Format(path string) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		return FormatYAML
+	case ".toml":
+		return FormatTOML
+	default:
+		return FormatJSON
+	}
+}
+
+// parseDocument decodes a configuration document into a generic map, in the
+// format given by the file extension.
+//
+// Whatever the format, the result holds the same types as a decoded JSON
+// document, so documents of different formats can include each other.
+func parseDocument(path string, data []byte) (map[string]interface{}, error) {
+	var doc map[string]interface{}
+	var err error
+	switch Format(path) {
+	case FormatYAML:
+		doc, err = decodeYAML(data)
+	case FormatTOML:
+		doc, err = decodeTOML(data)
+	default:
+		doc = map[string]interface{}{}
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.UseNumber()
+		err = dec.Decode(&doc)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse config %s: %w", filepath.Base(path), err)
+	}
+	return doc, nil
+}
+
+// decodeYAML decodes a YAML document. An empty document is an empty map.
+func decodeYAML(data []byte) (map[string]interface{}, error) {
+	var value interface{}
+	if err := yaml.Unmarshal(data, &value); err != nil {
+		return nil, err
+	}
+	if value == nil {
+		return map[string]interface{}{}, nil
+	}
+	doc, ok := normalizeYAML(value).(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("the document must be a mapping of settings")
+	}
+	return doc, nil
+}
+
+// normalizeYAML converts mappings with non-string keys, such as numbers, to
+// maps with string keys, which JSON can represent.
+func normalizeYAML(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, item := range v {
+			v[key] = normalizeYAML(item)
+		}
+		return v
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			m[fmt.Sprint(key)] = normalizeYAML(item)
+		}
+		return m
+	case []interface{}:
+		for i, item := range v {
+			v[i] = normalizeYAML(item)
+		}
+		return v
+	default:
+		return v
+	}
+}
+
+// placeholderValue returns the value a placeholder outside of strings is
+// replaced with before variables are known: null where the format has one,
+// and an empty string in TOML, which has none.
+func placeholderValue(path string) string {
+	if Format(path) == FormatTOML {
+		return `""`
+	}
+	return "null"
+}
@@ -0,0 +1,134 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// Finding is a likely mistake reported by Lint.
+//
+// Unlike validation errors, findings do not prevent the configuration from
+// loading; they point at settings that are valid but probably not what was meant.
+type Finding struct {
+	Field      string // Configuration field the finding refers to
+	Message    string // What looks wrong
+	Suggestion string // How to fix it
+}
+
+// Lint checks a loaded configuration for common mistakes beyond what validate enforces.
+//
+// Checks include:
+//   - TLS settings that are ignored because no connection uses port 443
+//   - Plain SSH ports combined with a WebSocket payload, or HTTP ports without one
+//   - Payload Host headers that do not match the TLS server name
+//   - Payloads without an Upgrade header
+//   - A proxy that points at the SSH server itself
+//   - Connect settings that have no effect when dialing over Tor
+//   - Watchdog keepalives that are not shorter than the timeout
+//   - A proxy shared beyond the loopback address without a client allowlist
+//
+// Returns:
+//   - []Finding: The detected issues, empty if none were found
+func (c *Config) Lint() []Finding {
+	var findings []Finding
+	add := func(field, message, suggestion string) {
+		findings = append(findings, Finding{Field: field, Message: message, Suggestion: suggestion})
+	}
+
+	// TLS is only used when the dialed port is 443
+	dialPort, dialHost := c.SSH.Port, c.SSH.Host
+	if c.Mode == "proxy" {
+		dialPort, _ = strconv.Atoi(c.ProxyPort)
+		dialHost = c.ProxyHost
+	}
+	usesTLS := dialPort == 443
+	if !usesTLS && c.TLS.hasSettings() {
+		add("tls", fmt.Sprintf("TLS settings are ignored because the connection goes to port %d", dialPort),
+			"TLS is used for port 443 only; change the port to 443 or remove the tls section")
+	}
+
+	// Port and payload combinations
+	if c.Mode == "direct" {
+		switch {
+		case c.SSH.Port == 22 && c.HTTPPayload != "":
+			add("httpPayload", "a WebSocket payload is sent to port 22, which normally runs a plain SSH daemon",
+				"remove httpPayload, or use the port of the WebSocket front (usually 80 or 443)")
+		case (c.SSH.Port == 80 || c.SSH.Port == 8080 || c.SSH.Port == 443) && c.HTTPPayload == "":
+			add("httpPayload", fmt.Sprintf("port %d is usually an HTTP front but no payload is set, so raw SSH is sent", c.SSH.Port),
+				"add an httpPayload with an Upgrade: websocket request")
+		}
+	}
+
+	if c.HTTPPayload != "" {
+		payload := strings.NewReplacer("[crlf]", "\r\n", "[cr]", "\r", "[lf]", "\n").Replace(c.HTTPPayload)
+		host := payloadHeader(payload, "Host")
+
+		serverName := c.TLS.ServerName
+		if serverName == "" {
+			serverName = dialHost
+		}
+		if usesTLS && host != "" && host != "[host]" && !strings.EqualFold(stripPort(host), serverName) {
+			add("httpPayload", fmt.Sprintf("payload Host %q does not match the TLS server name %q", host, serverName),
+				"set tls.serverName to the front domain, or make the Host header match it unless domain fronting is intended")
+		}
+		if payloadHeader(payload, "Upgrade") == "" {
+			add("httpPayload", "payload has no Upgrade header, so most fronts will not switch protocols",
+				"add Upgrade: websocket[crlf] before the final [crlf][crlf]")
+		}
+	}
+
+	// A proxy that is the SSH server itself is almost always a copy-paste mistake
+	if c.Mode == "proxy" && strings.EqualFold(c.ProxyHost, c.SSH.Host) && c.ProxyPort == strconv.Itoa(c.SSH.Port) {
+		add("proxyPort", "proxyHost/proxyPort point at the SSH server itself",
+			"set ssh.port to the SSH port behind the proxy, or use direct mode")
+	}
+
+	if c.Tor.OverTor && (c.Connect.BindAddress != "" || c.Connect.BindInterface != "" || len(c.Multipath.Uplinks) > 0) {
+		add("connect", "bind and multipath settings have no effect when dialing over Tor",
+			"remove them, or disable tor.overTor")
+	}
+
+	if c.Watchdog.Timeout > 0 && c.Watchdog.KeepaliveInterval >= c.Watchdog.Timeout {
+		add("watchdog.keepaliveInterval", "keepalives are not sent before the watchdog timeout expires, so idle transports are reconnected needlessly",
+			"use a keepaliveInterval of at most a third of the timeout")
+	}
+
+	if c.Listener.Port < 1024 {
+		add("listener.port", fmt.Sprintf("port %d is privileged and needs root on most systems", c.Listener.Port),
+			"use a port above 1023, e.g. 1080")
+	}
+
+	if ip := net.ParseIP(c.Listener.Host); ip != nil && !ip.IsLoopback() && len(c.Listener.Allow) == 0 {
+		add("listener.allow", fmt.Sprintf("the proxy listens on %s and anyone who can reach it may use the tunnel", c.Listener.Host),
+			"list the networks of your devices in listener.allow, e.g. [\"192.168.1.0/24\"]")
+	}
+
+	return findings
+}
+
+// hasSettings reports whether any TLS setting was configured.
+func (t TLSConfig) hasSettings() bool {
+	return t.ServerName != "" || len(t.ALPN) > 0 || t.MinVersion != "" || t.MaxVersion != "" || t.CertFile != ""
+}
+
+// payloadHeader returns the value of the first header with the given name in a
+// payload with line endings already expanded, or an empty string.
+func payloadHeader(payload, name string) string {
+	for _, line := range strings.Split(payload, "\r\n") {
+		key, value, ok := strings.Cut(line, ":")
+		if ok && strings.EqualFold(strings.TrimSpace(key), name) {
+			return strings.TrimSpace(value)
+		}
+	}
+	return ""
+}
+
+// stripPort removes an optional port from a host header value.
+func stripPort(host string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		return h
+	}
+	return host
+}
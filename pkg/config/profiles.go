@@ -0,0 +1,159 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// profileExt is the extension of profile files in the profiles directory.
+const profileExt = ".json"
+
+// ProfileDir returns the directory holding profile files.
+//
+// Each file in it, named after its profile, is a partial configuration merged
+// over the top-level settings of the configuration file, like an entry of its
+// "profiles" object. This keeps single profiles easy to script and share.
+//
+// Returns:
+//   - string: Path of the profiles directory in the tunn configuration directory
+//   - error: An error if the configuration directory cannot be determined
+func ProfileDir() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to locate config directory: %w", err)
+	}
+	return filepath.Join(dir, "tunn", "profiles"), nil
+}
+
+// ProfilePath returns the path of the file of a profile in the profiles directory.
+//
+// Parameters:
+//   - name: The profile name, made of letters, digits, '.', '-' and '_'
+//
+// Returns:
+//   - string: The path of the profile file, which need not exist
+//   - error: An error if the name is invalid or the directory cannot be determined
+func ProfilePath(name string) (string, error) {
+	if err := validateProfileName(name); err != nil {
+		return "", err
+	}
+	dir, err := ProfileDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, name+profileExt), nil
+}
+
+// ProfileFiles returns the names of the profiles in the profiles directory.
+// A missing directory holds no profiles.
+//
+// Returns:
+//   - []string: The profile names, sorted
+//   - error: An error if the directory cannot be read
+func ProfileFiles() ([]string, error) {
+	dir, err := ProfileDir()
+	if err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read profiles directory: %w", err)
+	}
+
+	var names []string
+	for _, entry := range entries {
+		name, ok := strings.CutSuffix(entry.Name(), profileExt)
+		if !ok || entry.IsDir() || validateProfileName(name) != nil {
+			continue
+		}
+		names = append(names, name)
+	}
+	return names, nil
+}
+
+// Profiles returns the names of the profiles a configuration file defines in
+// its "profiles" object, including those of the files it includes.
+//
+// Parameters:
+//   - configPath: Path to the configuration file
+//
+// Returns:
+//   - []string: The profile names, sorted
+//   - error: An error if the file cannot be loaded
+func Profiles(configPath string) ([]string, error) {
+	doc, err := loadDocument(configPath)
+	if err != nil {
+		return nil, err
+	}
+	profiles, _ := doc[profilesKey].(map[string]interface{})
+	names := make([]string, 0, len(profiles))
+	for name := range profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// ParseProfile decodes a profile document and checks that it holds only
+// settings, without the keys the document loader handles itself.
+//
+// Parameters:
+//   - path: Name of the document, whose extension gives its format
+//   - data: The document
+//
+// Returns:
+//   - map[string]interface{}: The decoded profile
+//   - error: An error if the document cannot be parsed or defines profiles itself
+func ParseProfile(path string, data []byte) (map[string]interface{}, error) {
+	doc, err := parseDocument(path, data)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := doc[profilesKey]; ok {
+		return nil, fmt.Errorf("a profile cannot define profiles itself")
+	}
+	return doc, nil
+}
+
+// loadProfileFile loads a profile from the profiles directory, with its
+// includes and variables resolved like those of a configuration file.
+//
+// Returns:
+//   - map[string]interface{}: The profile, or nil when it has no file
+//   - error: An error if the file exists but cannot be loaded
+func loadProfileFile(name string) (map[string]interface{}, error) {
+	path, err := ProfilePath(name)
+	if err != nil {
+		return nil, nil
+	}
+	if _, err := os.Stat(path); errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	doc, err := loadDocument(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load profile '%s': %w", name, err)
+	}
+	delete(doc, profilesKey)
+	return doc, nil
+}
+
+// validateProfileName checks that a profile name can be used as a file name.
+func validateProfileName(name string) error {
+	if name == "" || name == "." || name == ".." {
+		return fmt.Errorf("invalid profile name '%s'", name)
+	}
+	for _, r := range name {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '.' || r == '-' || r == '_') {
+			return fmt.Errorf("invalid profile name '%s', use only letters, digits, '.', '-' and '_'", name)
+		}
+	}
+	return nil
+}
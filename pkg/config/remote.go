@@ -0,0 +1,239 @@
+package config
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"tunn/pkg/redact"
+)
+
+// maxRemoteConfigSize limits the size of remotely fetched configuration files.
+const maxRemoteConfigSize = 1 << 20
+
+// FetchOptions controls how remote configuration files are fetched and verified.
+//
+// A checksum pins one exact file, while a public key allows the publisher to
+// update the file as long as every version is signed. Both may be combined.
+type FetchOptions struct {
+	SHA256    string        // Expected hex-encoded SHA-256 checksum of the file (optional)
+	PublicKey string        // Base64 ed25519 public key verifying the detached "<url>.sig" signature (optional)
+	CacheDir  string        // Directory for cached copies (default: <user cache dir>/tunn)
+	Timeout   time.Duration // HTTP timeout for each request (default: 30 seconds)
+}
+
+// IsRemote reports whether a configuration path refers to an HTTP(S) URL.
+func IsRemote(configPath string) bool {
+	return strings.HasPrefix(configPath, "https://") || strings.HasPrefix(configPath, "http://")
+}
+
+// FetchRemote downloads a configuration file, verifies it, and stores it in the local cache.
+//
+// The returned path points to the cached copy and can be passed to LoadConfig.
+// When the download itself fails (for example when the device is offline), the
+// previously cached copy is used instead so the tunnel can still start, after
+// checking it against the same checksum and signature as a fresh download.
+// Verification failures are always reported as errors and never fall back to the cache.
+// Plain http:// URLs are only accepted with a checksum or public key, since
+// anyone on the network path could otherwise replace the file.
+//
+// Parameters:
+//   - rawURL: HTTP or HTTPS URL of the configuration file
+//   - opts: Verification and caching options
+//
+// Returns:
+//   - string: Path of the verified local copy
+//   - error: An error if the file cannot be fetched or verified and no verified cache exists
+func FetchRemote(rawURL string, opts FetchOptions) (string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", fmt.Errorf("invalid config URL: %w", err)
+	}
+	if u.Scheme == "http" && opts.SHA256 == "" && opts.PublicKey == "" {
+		return "", fmt.Errorf("refusing plain http:// config URL without --config-sha256 or --config-pubkey; use https:// or verify the file")
+	}
+	if opts.Timeout == 0 {
+		opts.Timeout = 30 * time.Second
+	}
+
+	cachePath, err := remoteCachePath(u, opts.CacheDir)
+	if err != nil {
+		return "", err
+	}
+
+	client := &http.Client{Timeout: opts.Timeout}
+	data, err := download(client, rawURL)
+	if err != nil {
+		if _, statErr := os.Stat(cachePath); statErr == nil {
+			if verifyErr := verifyCached(cachePath, opts); verifyErr != nil {
+				return "", fmt.Errorf("failed to fetch remote config (%w), and the cached copy cannot be used: %v", err, verifyErr)
+			}
+			fmt.Printf("✗ Failed to fetch remote config (%s), using cached copy\n", redact.Text(err.Error()))
+			return cachePath, nil
+		}
+		return "", fmt.Errorf("failed to fetch remote config: %w", err)
+	}
+
+	if err := verifyChecksum(data, opts.SHA256); err != nil {
+		return "", err
+	}
+	var sig []byte
+	if opts.PublicKey != "" {
+		sig, err = download(client, rawURL+".sig")
+		if err != nil {
+			return "", fmt.Errorf("failed to fetch config signature: %w", err)
+		}
+		if err := verifySignature(data, sig, opts.PublicKey); err != nil {
+			return "", err
+		}
+	}
+
+	// The signature is cached too, so the copy can be verified again offline
+	if sig != nil {
+		if err := writeFileAtomic(cachePath+".sig", sig, 0600); err != nil {
+			return "", fmt.Errorf("failed to cache config signature: %w", err)
+		}
+	}
+	if err := writeFileAtomic(cachePath, data, 0600); err != nil {
+		return "", fmt.Errorf("failed to cache remote config: %w", err)
+	}
+
+	fmt.Printf("✓ Remote config fetched from %s\n", u.Host)
+	return cachePath, nil
+}
+
+// verifyCached checks a cached configuration file, and the signature cached
+// next to it, against the checksum and public key of the options.
+func verifyCached(cachePath string, opts FetchOptions) error {
+	data, err := os.ReadFile(cachePath)
+	if err != nil {
+		return err
+	}
+	if err := verifyChecksum(data, opts.SHA256); err != nil {
+		return err
+	}
+	if opts.PublicKey != "" {
+		sig, err := os.ReadFile(cachePath + ".sig")
+		if err != nil {
+			return fmt.Errorf("no cached config signature: %w", err)
+		}
+		if err := verifySignature(data, sig, opts.PublicKey); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// download performs an HTTP GET request and returns the response body.
+func download(client *http.Client, rawURL string) ([]byte, error) {
+	resp, err := client.Get(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected HTTP status: %s", resp.Status)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxRemoteConfigSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxRemoteConfigSize {
+		return nil, fmt.Errorf("remote file exceeds %d bytes", maxRemoteConfigSize)
+	}
+	return data, nil
+}
+
+// verifyChecksum compares the SHA-256 checksum of data against the expected hex value.
+func verifyChecksum(data []byte, expected string) error {
+	if expected == "" {
+		return nil
+	}
+	sum := sha256.Sum256(data)
+	if !strings.EqualFold(hex.EncodeToString(sum[:]), strings.TrimSpace(expected)) {
+		return fmt.Errorf("remote config checksum mismatch")
+	}
+	return nil
+}
+
+// verifySignature checks a detached ed25519 signature over data.
+//
+// The signature may be provided raw (64 bytes) or base64 encoded.
+func verifySignature(data, sig []byte, publicKey string) error {
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(publicKey))
+	if err != nil || len(key) != ed25519.PublicKeySize {
+		return fmt.Errorf("invalid config public key: must be a base64 ed25519 public key")
+	}
+
+	if len(sig) != ed25519.SignatureSize {
+		decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(sig)))
+		if err != nil {
+			return fmt.Errorf("invalid config signature encoding: %w", err)
+		}
+		sig = decoded
+	}
+
+	if !ed25519.Verify(ed25519.PublicKey(key), data, sig) {
+		return fmt.Errorf("remote config signature verification failed")
+	}
+	return nil
+}
+
+// remoteCachePath returns the cache file location for a remote configuration URL.
+//
+// The file name is derived from a hash of the URL so multiple remote configs can
+// be cached side by side, and keeps the original extension for format detection.
+func remoteCachePath(u *url.URL, cacheDir string) (string, error) {
+	if cacheDir == "" {
+		dir, err := os.UserCacheDir()
+		if err != nil {
+			return "", fmt.Errorf("failed to locate cache directory: %w", err)
+		}
+		cacheDir = filepath.Join(dir, "tunn")
+	}
+
+	ext := path.Ext(u.Path)
+	if ext == "" {
+		ext = ".json"
+	}
+	sum := sha256.Sum256([]byte(u.String()))
+	return filepath.Join(cacheDir, "remote-"+hex.EncodeToString(sum[:8])+ext), nil
+}
+
+// writeFileAtomic writes data to a temporary file and renames it into place,
+// so readers never observe a partially written file.
+func writeFileAtomic(name string, data []byte, perm os.FileMode) error {
+	if err := os.MkdirAll(filepath.Dir(name), 0700); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(name), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(perm); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), name)
+}
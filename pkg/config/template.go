@@ -0,0 +1,504 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// Reserved top-level keys handled by the document loader rather than the Config struct.
+const (
+	includeKey  = "include"  // List of files merged underneath the including file
+	varsKey     = "vars"     // Named variables referenced as ${name}
+	profilesKey = "profiles" // Named overlays selected with --profile
+)
+
+// maxIncludeDepth bounds nested includes as a safety net in addition to cycle detection.
+const maxIncludeDepth = 16
+
+// documentLoader assembles a configuration document from a file, its includes and variables.
+//
+// Loading happens in two passes: the first pass collects the "vars" blocks of the
+// file and all of its includes without substituting anything, and the second pass
+// expands ${name} references (variables first, then environment variables) in
+// the parsed values and merges the included documents underneath the including one.
+type documentLoader struct {
+	vars  map[string]string // Resolved variables from all documents
+	stack []string          // Absolute paths of the include chain for cycle detection
+}
+
+// loadDocument reads a configuration file with all includes and variables resolved.
+//
+// Parameters:
+//   - configPath: Path to the root configuration file
+//
+// Returns:
+//   - map[string]interface{}: The merged configuration document
+//   - error: An error if any file cannot be read, parsed or included
+func loadDocument(configPath string) (map[string]interface{}, error) {
+	l := &documentLoader{vars: map[string]string{}}
+
+	raw := map[string]string{}
+	if err := l.collectVars(configPath, raw); err != nil {
+		return nil, err
+	}
+	l.resolveVars(raw)
+
+	return l.load(configPath)
+}
+
+// Sources returns a configuration file and every file it includes, directly or
+// indirectly, as absolute paths with the root file first.
+//
+// Parameters:
+//   - configPath: Path to the root configuration file
+//
+// Returns:
+//   - []string: The files making up the configuration
+//   - error: An error if any file cannot be read or parsed
+func Sources(configPath string) ([]string, error) {
+	l := &documentLoader{vars: map[string]string{}}
+	var files []string
+	var walk func(path string) error
+	walk = func(path string) error {
+		abs, err := l.enter(path)
+		if err != nil {
+			return err
+		}
+		defer l.leave()
+
+		data, err := os.ReadFile(abs)
+		if err != nil {
+			return fmt.Errorf("failed to read config file: %w", err)
+		}
+		doc, err := parseDocument(abs, neutralizePlaceholders(abs, data))
+		if err != nil {
+			return err
+		}
+		includes, err := includeList(doc)
+		if err != nil {
+			return err
+		}
+
+		if !slices.Contains(files, abs) {
+			files = append(files, abs)
+		}
+		for _, inc := range includes {
+			if err := walk(resolveInclude(abs, inc)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if err := walk(configPath); err != nil {
+		return nil, err
+	}
+	return files, nil
+}
+
+// collectVars gathers unexpanded variables from a file and its includes.
+//
+// Variables of included files are collected first so that the including file
+// can override them, mirroring how the documents themselves are merged.
+func (l *documentLoader) collectVars(path string, vars map[string]string) error {
+	abs, err := l.enter(path)
+	if err != nil {
+		return err
+	}
+	defer l.leave()
+
+	data, err := os.ReadFile(abs)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	doc, err := parseDocument(abs, neutralizePlaceholders(abs, data))
+	if err != nil {
+		return err
+	}
+
+	includes, err := includeList(doc)
+	if err != nil {
+		return err
+	}
+	for _, inc := range includes {
+		if err := l.collectVars(resolveInclude(abs, inc), vars); err != nil {
+			return err
+		}
+	}
+
+	if block, ok := doc[varsKey]; ok {
+		m, ok := block.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("%s: \"vars\" must be an object", abs)
+		}
+		for name, value := range m {
+			vars[name] = fmt.Sprint(value)
+		}
+	}
+	return nil
+}
+
+// resolveVars expands references between variables and to environment variables.
+func (l *documentLoader) resolveVars(raw map[string]string) {
+	for name, value := range raw {
+		l.vars[name] = value
+	}
+	// Repeat expansion so variables may reference other variables, bounded to
+	// avoid looping forever on self references.
+	for i := 0; i < len(raw); i++ {
+		changed := false
+		for name, value := range l.vars {
+			expanded := os.Expand(value, l.lookup)
+			if expanded != value {
+				l.vars[name] = expanded
+				changed = true
+			}
+		}
+		if !changed {
+			break
+		}
+	}
+}
+
+// lookup resolves a ${name} reference, preferring config variables over the environment.
+func (l *documentLoader) lookup(name string) string {
+	if value, ok := l.vars[name]; ok {
+		return value
+	}
+	return os.Getenv(name)
+}
+
+// load reads a file with variables expanded and its includes merged underneath it.
+func (l *documentLoader) load(path string) (map[string]interface{}, error) {
+	abs, err := l.enter(path)
+	if err != nil {
+		return nil, err
+	}
+	defer l.leave()
+
+	data, err := os.ReadFile(abs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	// Placeholders are expanded in the parsed values rather than in the text,
+	// so quotes, backslashes and newlines in a value cannot break or extend
+	// the document
+	doc, err := parseDocument(abs, markPlaceholders(data))
+	if err != nil {
+		return nil, err
+	}
+	doc = expandValue(doc, l.lookup).(map[string]interface{})
+
+	includes, err := includeList(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	merged := map[string]interface{}{}
+	for _, inc := range includes {
+		base, err := l.load(resolveInclude(abs, inc))
+		if err != nil {
+			return nil, err
+		}
+		merged = mergeDocuments(merged, base)
+	}
+
+	delete(doc, includeKey)
+	delete(doc, varsKey)
+	return mergeDocuments(merged, doc), nil
+}
+
+// enter pushes a file onto the include stack, rejecting cycles and deep nesting.
+func (l *documentLoader) enter(path string) (string, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", fmt.Errorf("invalid config path %s: %w", path, err)
+	}
+	for _, p := range l.stack {
+		if p == abs {
+			return "", fmt.Errorf("include cycle detected: %s", strings.Join(append(l.stack, abs), " -> "))
+		}
+	}
+	if len(l.stack) >= maxIncludeDepth {
+		return "", fmt.Errorf("includes nested deeper than %d levels", maxIncludeDepth)
+	}
+	l.stack = append(l.stack, abs)
+	return abs, nil
+}
+
+// leave pops the current file from the include stack.
+func (l *documentLoader) leave() {
+	l.stack = l.stack[:len(l.stack)-1]
+}
+
+// includeList extracts the include directive, accepting a single path or a list of paths.
+func includeList(doc map[string]interface{}) ([]string, error) {
+	switch v := doc[includeKey].(type) {
+	case nil:
+		return nil, nil
+	case string:
+		return []string{v}, nil
+	case []interface{}:
+		list := make([]string, 0, len(v))
+		for _, item := range v {
+			s, ok := item.(string)
+			if !ok {
+				return nil, fmt.Errorf("\"include\" entries must be file paths")
+			}
+			list = append(list, s)
+		}
+		return list, nil
+	default:
+		return nil, fmt.Errorf("\"include\" must be a path or a list of paths")
+	}
+}
+
+// resolveInclude resolves an include path relative to the including file.
+func resolveInclude(from, include string) string {
+	if filepath.IsAbs(include) {
+		return include
+	}
+	return filepath.Join(filepath.Dir(from), include)
+}
+
+// mergeDocuments merges src into dst recursively and returns dst.
+//
+// Objects are merged key by key, while arrays and scalar values in src replace
+// the corresponding values in dst.
+func mergeDocuments(dst, src map[string]interface{}) map[string]interface{} {
+	for key, value := range src {
+		srcMap, srcIsMap := value.(map[string]interface{})
+		dstMap, dstIsMap := dst[key].(map[string]interface{})
+		if srcIsMap && dstIsMap {
+			dst[key] = mergeDocuments(dstMap, srcMap)
+			continue
+		}
+		dst[key] = value
+	}
+	return dst
+}
+
+// applyProfile overlays the named profile onto the base document.
+//
+// Profiles of the "profiles" block are looked up first, then the profile
+// files in the profiles directory. The "profiles" block is always removed from
+// the returned document. An empty profile name selects the base configuration
+// without any overlay.
+func applyProfile(doc map[string]interface{}, profile string) (map[string]interface{}, error) {
+	profiles, _ := doc[profilesKey].(map[string]interface{})
+	delete(doc, profilesKey)
+
+	if profile == "" {
+		return doc, nil
+	}
+
+	overlay, ok := profiles[profile].(map[string]interface{})
+	if !ok {
+		file, err := loadProfileFile(profile)
+		if err != nil {
+			return nil, err
+		}
+		if file != nil {
+			return mergeDocuments(doc, file), nil
+		}
+
+		names := make([]string, 0, len(profiles))
+		for name := range profiles {
+			names = append(names, name)
+		}
+		files, _ := ProfileFiles()
+		for _, name := range files {
+			if !slices.Contains(names, name) {
+				names = append(names, name)
+			}
+		}
+		sort.Strings(names)
+		if len(names) == 0 {
+			return nil, fmt.Errorf("profile '%s' not found: config defines no profiles", profile)
+		}
+		return nil, fmt.Errorf("profile '%s' not found, available: %s", profile, strings.Join(names, ", "))
+	}
+	return mergeDocuments(doc, overlay), nil
+}
+
+// neutralizePlaceholders replaces $VAR and ${VAR} references that appear outside
+// of double-quoted strings with null (an empty string in TOML), so a document
+// using placeholders for numbers or booleans can still be parsed before
+// variables are known.
+func neutralizePlaceholders(path string, data []byte) []byte {
+	value := placeholderValue(path)
+	var out bytes.Buffer
+	inString, escaped := false, false
+
+	for i := 0; i < len(data); i++ {
+		c := data[i]
+		if inString {
+			out.WriteByte(c)
+			switch {
+			case escaped:
+				escaped = false
+			case c == '\\':
+				escaped = true
+			case c == '"':
+				inString = false
+			}
+			continue
+		}
+
+		switch c {
+		case '"':
+			inString = true
+			out.WriteByte(c)
+		case '$':
+			i += placeholderLength(data[i:]) - 1
+			out.WriteString(value)
+		default:
+			out.WriteByte(c)
+		}
+	}
+	return out.Bytes()
+}
+
+// placeholderLength returns the length of the $VAR or ${VAR} reference at the start of data.
+func placeholderLength(data []byte) int {
+	if len(data) > 1 && data[1] == '{' {
+		if end := bytes.IndexByte(data, '}'); end > 0 {
+			return end + 1
+		}
+		return len(data)
+	}
+	n := 1
+	for n < len(data) && (data[n] == '_' || data[n] >= '0' && data[n] <= '9' ||
+		data[n] >= 'a' && data[n] <= 'z' || data[n] >= 'A' && data[n] <= 'Z') {
+		n++
+	}
+	return n
+}
+
+// placeholderMarker prefixes the placeholders that stand for a whole value
+// outside of strings, which markPlaceholders turns into strings so the
+// document can be parsed before they are expanded.
+const placeholderMarker = "\x00"
+
+// markPlaceholders replaces each $VAR or ${VAR} reference that stands for a
+// whole value outside of strings, such as a port written "port": ${PORT},
+// with a string holding the marked reference. References inside strings, and
+// in YAML plain text, are left to be expanded after parsing. The quoted form
+// is valid in JSON, YAML and TOML alike.
+func markPlaceholders(data []byte) []byte {
+	var out bytes.Buffer
+	closing := "" // Delimiter closing the string being copied, empty outside strings
+	escaped := false
+
+	for i := 0; i < len(data); i++ {
+		c := data[i]
+		if closing != "" {
+			switch {
+			case escaped:
+				escaped = false
+			case c == '\\' && closing[0] == '"':
+				escaped = true
+			case bytes.HasPrefix(data[i:], []byte(closing)):
+				out.WriteString(closing)
+				i += len(closing) - 1
+				closing = ""
+				continue
+			}
+			out.WriteByte(c)
+			continue
+		}
+
+		switch {
+		case c == '"' || c == '\'' && valueStart(out.Bytes()):
+			// Single quotes open YAML and TOML literal strings, and TOML
+			// multi-line strings are delimited by three quotes
+			closing = string(c)
+			if triple := strings.Repeat(closing, 3); bytes.HasPrefix(data[i:], []byte(triple)) {
+				closing = triple
+				out.WriteString(triple)
+				i += 2
+				continue
+			}
+		case c == '$':
+			n := placeholderLength(data[i:])
+			if n > 1 && valueStart(out.Bytes()) && valueEnd(data[i+n:]) {
+				marked, _ := json.Marshal(placeholderMarker + string(data[i:i+n]))
+				out.Write(marked)
+				i += n - 1
+				continue
+			}
+		}
+		out.WriteByte(c)
+	}
+	return out.Bytes()
+}
+
+// verbatimMarks matches marked placeholders taken verbatim into a string,
+// as happens inside YAML block scalars, which markPlaceholders cannot tell
+// apart from plain values.
+var verbatimMarks = regexp.MustCompile(`"\\u0000(\$\{[^"}]*\}|\$[A-Za-z0-9_]+)"`)
+
+// valueStart reports whether a value may begin after the text written so far.
+func valueStart(before []byte) bool {
+	before = bytes.TrimRight(before, " \t")
+	return len(before) == 0 || strings.IndexByte(":=[{,-\n", before[len(before)-1]) >= 0
+}
+
+// valueEnd reports whether a value may end before the remaining text.
+func valueEnd(after []byte) bool {
+	after = bytes.TrimLeft(after, " \t")
+	return len(after) == 0 || strings.IndexByte(",]}#\r\n", after[0]) >= 0
+}
+
+// expandValue expands the placeholders in the strings of a parsed document.
+//
+// A marked placeholder that stood for a whole value outside of strings becomes
+// a number, boolean or null when its expansion is one, and a string otherwise.
+// Expanded text is never parsed again, so a value cannot add settings.
+func expandValue(value interface{}, lookup func(string) string) interface{} {
+	switch v := value.(type) {
+	case string:
+		if reference, ok := strings.CutPrefix(v, placeholderMarker); ok {
+			return scalarValue(os.Expand(reference, lookup))
+		}
+		return os.Expand(verbatimMarks.ReplaceAllString(v, "$1"), lookup)
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			m[os.Expand(strings.TrimPrefix(key, placeholderMarker), lookup)] = expandValue(item, lookup)
+		}
+		return m
+	case []interface{}:
+		for i, item := range v {
+			v[i] = expandValue(item, lookup)
+		}
+		return v
+	default:
+		return v
+	}
+}
+
+// scalarValue converts the expansion of a placeholder standing for a whole
+// value to a number, boolean or null when it is one, and keeps it as a string
+// otherwise.
+func scalarValue(text string) interface{} {
+	dec := json.NewDecoder(strings.NewReader(text))
+	dec.UseNumber()
+	var value interface{}
+	if err := dec.Decode(&value); err != nil || dec.More() || strings.TrimSpace(text) != text {
+		return text
+	}
+	switch value.(type) {
+	case json.Number, bool, nil:
+		return value
+	}
+	return text
+}
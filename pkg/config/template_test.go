@@ -0,0 +1,103 @@
+package config
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeConfig writes a configuration file into a temporary directory.
+func writeConfig(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatalf("failed to write %s: %v", name, err)
+	}
+	return path
+}
+
+func TestLoadDocumentExpandsValuesLiterally(t *testing.T) {
+	password := `p"a\ss` + "\nword"
+	injection := `x", "insecureHostKey": true, "y": "`
+	t.Setenv("TUNN_TEST_PASSWORD", password)
+	t.Setenv("TUNN_TEST_USER", injection)
+	t.Setenv("TUNN_TEST_PORT", "2222")
+	t.Setenv("TUNN_TEST_HOST", "${TUNN_TEST_PORT}")
+
+	files := map[string]string{
+		"config.json": `{
+  "vars": { "base": "C:\\tunn" },
+  "ssh": { "host": "${TUNN_TEST_HOST}", "port": ${TUNN_TEST_PORT}, "username": "${TUNN_TEST_USER}", "password": "${TUNN_TEST_PASSWORD}" },
+  "path": "${base}\\x"
+}`,
+		"config.yaml": `vars:
+  base: 'C:\tunn'
+ssh:
+  host: "${TUNN_TEST_HOST}"
+  port: ${TUNN_TEST_PORT}
+  username: '${TUNN_TEST_USER}'
+  password: ${TUNN_TEST_PASSWORD}
+path: ${base}\x
+`,
+		"config.toml": `path = '${base}\x'
+
+[vars]
+base = 'C:\tunn'
+
+[ssh]
+host = "${TUNN_TEST_HOST}"
+port = ${TUNN_TEST_PORT}
+username = """${TUNN_TEST_USER}"""
+password = "${TUNN_TEST_PASSWORD}"
+`,
+	}
+
+	for name, content := range files {
+		t.Run(name, func(t *testing.T) {
+			doc, err := loadDocument(writeConfig(t, name, content))
+			if err != nil {
+				t.Fatalf("loadDocument failed: %v", err)
+			}
+
+			ssh, _ := doc["ssh"].(map[string]interface{})
+			if got := ssh["password"]; got != password {
+				t.Errorf("password = %q, want %q", got, password)
+			}
+			if got := ssh["username"]; got != injection {
+				t.Errorf("username = %q, want %q", got, injection)
+			}
+			// Expanded values are not expanded again
+			if got := ssh["host"]; got != "${TUNN_TEST_PORT}" {
+				t.Errorf("host = %q, want the value taken literally", got)
+			}
+			if got, _ := json.Marshal(ssh["port"]); string(got) != "2222" {
+				t.Errorf("port = %s, want the number 2222", got)
+			}
+			if got := doc["path"]; got != `C:\tunn\x` {
+				t.Errorf("path = %q, want %q", got, `C:\tunn\x`)
+			}
+			if len(ssh) != 4 {
+				t.Errorf("ssh has settings %v, want only host, port, username and password", ssh)
+			}
+			if _, ok := doc["insecureHostKey"]; ok {
+				t.Error("a variable value added a setting")
+			}
+		})
+	}
+}
+
+func TestLoadDocumentExpandsYAMLBlockScalars(t *testing.T) {
+	t.Setenv("TUNN_TEST_HOST", `front"end`)
+	path := writeConfig(t, "config.yaml", `httpPayload: |
+  GET / HTTP/1.1
+  Host: ${TUNN_TEST_HOST}
+`)
+	doc, err := loadDocument(path)
+	if err != nil {
+		t.Fatalf("loadDocument failed: %v", err)
+	}
+	if want := "GET / HTTP/1.1\nHost: front\"end\n"; doc["httpPayload"] != want {
+		t.Errorf("httpPayload = %q, want %q", doc["httpPayload"], want)
+	}
+}
@@ -0,0 +1,534 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// tomlParser decodes TOML configuration documents.
+//
+// It covers the parts of TOML 1.0 that configuration files use: comments,
+// bare, quoted and dotted keys, tables and arrays of tables, all four string
+// forms, integers, floats, booleans, arrays and inline tables. Dates and times
+// are kept as strings, since no setting takes one.
+type tomlParser struct {
+	data    string
+	pos     int
+	root    map[string]interface{}
+	table   map[string]interface{} // Table receiving the key/value pairs that follow
+	defined map[string]bool        // Paths of the tables declared with a [header]
+}
+
+// tomlPathSeparator joins keys into the paths of declared tables. Quoted keys
+// may contain dots, so a dot cannot be used.
+const tomlPathSeparator = "\x00"
+
+// decodeTOML decodes a TOML document into the types of a decoded JSON
+// document: maps, slices, strings, booleans, int64 and float64.
+func decodeTOML(data []byte) (map[string]interface{}, error) {
+	p := &tomlParser{data: string(data), root: map[string]interface{}{}, defined: map[string]bool{}}
+	p.table = p.root
+	if err := p.parse(); err != nil {
+		return nil, fmt.Errorf("line %d: %w", strings.Count(p.data[:p.pos], "\n")+1, err)
+	}
+	return p.root, nil
+}
+
+// parse decodes the document line by line.
+func (p *tomlParser) parse() error {
+	for {
+		p.skipSpace()
+		if p.pos >= len(p.data) {
+			return nil
+		}
+		switch p.data[p.pos] {
+		case '#', '\r', '\n':
+		case '[':
+			if err := p.header(); err != nil {
+				return err
+			}
+		default:
+			if err := p.keyValue(p.table); err != nil {
+				return err
+			}
+		}
+		if err := p.endOfLine(); err != nil {
+			return err
+		}
+	}
+}
+
+// skipSpace skips spaces and tabs.
+func (p *tomlParser) skipSpace() {
+	for p.pos < len(p.data) && (p.data[p.pos] == ' ' || p.data[p.pos] == '\t') {
+		p.pos++
+	}
+}
+
+// skipBlank skips whitespace, newlines and comments, as allowed within arrays.
+func (p *tomlParser) skipBlank() {
+	for p.pos < len(p.data) {
+		switch p.data[p.pos] {
+		case ' ', '\t', '\r', '\n':
+			p.pos++
+		case '#':
+			p.skipComment()
+		default:
+			return
+		}
+	}
+}
+
+// skipComment skips a comment up to the end of the line.
+func (p *tomlParser) skipComment() {
+	for p.pos < len(p.data) && p.data[p.pos] != '\n' {
+		p.pos++
+	}
+}
+
+// endOfLine consumes trailing whitespace, a comment and the line break,
+// rejecting anything else following a header or value.
+func (p *tomlParser) endOfLine() error {
+	p.skipSpace()
+	if p.pos < len(p.data) && p.data[p.pos] == '#' {
+		p.skipComment()
+	}
+	switch {
+	case p.pos >= len(p.data):
+		return nil
+	case p.data[p.pos] == '\n':
+		p.pos++
+		return nil
+	case strings.HasPrefix(p.data[p.pos:], "\r\n"):
+		p.pos += 2
+		return nil
+	default:
+		return fmt.Errorf("unexpected %q, expected the end of the line", p.data[p.pos])
+	}
+}
+
+// header decodes a [table] or [[array of tables]] header and makes the table
+// it names the one receiving the following key/value pairs.
+func (p *tomlParser) header() error {
+	array := strings.HasPrefix(p.data[p.pos:], "[[")
+	closing := "]"
+	if array {
+		closing = "]]"
+	}
+	p.pos += len(closing)
+	p.skipSpace()
+	keys, err := p.key()
+	if err != nil {
+		return err
+	}
+	p.skipSpace()
+	if !strings.HasPrefix(p.data[p.pos:], closing) {
+		return fmt.Errorf("table header %s is not closed with %s", strings.Join(keys, "."), closing)
+	}
+	p.pos += len(closing)
+
+	parent, err := p.descend(p.root, keys[:len(keys)-1])
+	if err != nil {
+		return err
+	}
+	name := keys[len(keys)-1]
+	path := strings.Join(keys, tomlPathSeparator)
+
+	if array {
+		var list []interface{}
+		switch v := parent[name].(type) {
+		case nil:
+		case []interface{}:
+			list = v
+		default:
+			return fmt.Errorf("%s is already defined and is not an array of tables", strings.Join(keys, "."))
+		}
+		p.table = map[string]interface{}{}
+		parent[name] = append(list, p.table)
+		// Subtables of the previous element may be declared again for this one
+		for defined := range p.defined {
+			if strings.HasPrefix(defined, path+tomlPathSeparator) {
+				delete(p.defined, defined)
+			}
+		}
+		return nil
+	}
+
+	if p.defined[path] {
+		return fmt.Errorf("table [%s] is declared twice", strings.Join(keys, "."))
+	}
+	p.defined[path] = true
+	p.table, err = p.descend(parent, keys[len(keys)-1:])
+	return err
+}
+
+// descend returns the table reached by following keys from table, creating
+// missing tables. Keys naming an array of tables continue in its last table.
+func (p *tomlParser) descend(table map[string]interface{}, keys []string) (map[string]interface{}, error) {
+	for _, key := range keys {
+		switch v := table[key].(type) {
+		case nil:
+			next := map[string]interface{}{}
+			table[key] = next
+			table = next
+		case map[string]interface{}:
+			table = v
+		case []interface{}:
+			var last map[string]interface{}
+			if len(v) > 0 {
+				last, _ = v[len(v)-1].(map[string]interface{})
+			}
+			if last == nil {
+				return nil, fmt.Errorf("%s is an array, not a table", key)
+			}
+			table = last
+		default:
+			return nil, fmt.Errorf("%s is a value, not a table", key)
+		}
+	}
+	return table, nil
+}
+
+// keyValue decodes a key = value pair into table.
+func (p *tomlParser) keyValue(table map[string]interface{}) error {
+	keys, err := p.key()
+	if err != nil {
+		return err
+	}
+	p.skipSpace()
+	if p.pos >= len(p.data) || p.data[p.pos] != '=' {
+		return fmt.Errorf("expected = after %s", strings.Join(keys, "."))
+	}
+	p.pos++
+	p.skipSpace()
+	value, err := p.value()
+	if err != nil {
+		return err
+	}
+
+	parent, err := p.descend(table, keys[:len(keys)-1])
+	if err != nil {
+		return err
+	}
+	name := keys[len(keys)-1]
+	if _, ok := parent[name]; ok {
+		return fmt.Errorf("duplicate key %s", strings.Join(keys, "."))
+	}
+	parent[name] = value
+	return nil
+}
+
+// key decodes a bare, quoted or dotted key into its parts.
+func (p *tomlParser) key() ([]string, error) {
+	var keys []string
+	for {
+		p.skipSpace()
+		if p.pos >= len(p.data) {
+			return nil, fmt.Errorf("expected a key")
+		}
+		switch p.data[p.pos] {
+		case '"':
+			key, err := p.basicString()
+			if err != nil {
+				return nil, err
+			}
+			keys = append(keys, key)
+		case '\'':
+			key, err := p.literalString()
+			if err != nil {
+				return nil, err
+			}
+			keys = append(keys, key)
+		default:
+			start := p.pos
+			for p.pos < len(p.data) && isBareKeyChar(p.data[p.pos]) {
+				p.pos++
+			}
+			if p.pos == start {
+				return nil, fmt.Errorf("unexpected %q, expected a key", p.data[p.pos])
+			}
+			keys = append(keys, p.data[start:p.pos])
+		}
+		p.skipSpace()
+		if p.pos >= len(p.data) || p.data[p.pos] != '.' {
+			return keys, nil
+		}
+		p.pos++
+	}
+}
+
+// isBareKeyChar reports whether c may appear in an unquoted key.
+func isBareKeyChar(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_' || c == '-'
+}
+
+// value decodes the value starting at the current position.
+func (p *tomlParser) value() (interface{}, error) {
+	if p.pos >= len(p.data) {
+		return nil, fmt.Errorf("expected a value")
+	}
+	rest := p.data[p.pos:]
+	switch {
+	case strings.HasPrefix(rest, `"""`):
+		return p.multilineBasicString()
+	case strings.HasPrefix(rest, "'''"):
+		return p.multilineLiteralString()
+	case rest[0] == '"':
+		return p.basicString()
+	case rest[0] == '\'':
+		return p.literalString()
+	case rest[0] == '[':
+		return p.array()
+	case rest[0] == '{':
+		return p.inlineTable()
+	}
+
+	end := strings.IndexAny(rest, " \t\r\n,]}#")
+	if end < 0 {
+		end = len(rest)
+	}
+	token := rest[:end]
+	if token == "" {
+		return nil, fmt.Errorf("unexpected %q, expected a value", rest[0])
+	}
+	p.pos += end
+	return scalar(token)
+}
+
+// scalar decodes a boolean, number, or date and time token.
+func scalar(token string) (interface{}, error) {
+	switch token {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	}
+
+	digits := strings.ReplaceAll(token, "_", "")
+	unsigned := strings.TrimLeft(digits, "+-")
+	if n, err := strconv.ParseInt(digits, 0, 64); err == nil {
+		if len(unsigned) > 1 && unsigned[0] == '0' && unsigned[1] >= '0' && unsigned[1] <= '9' {
+			return nil, fmt.Errorf("invalid number %s: leading zeros are not allowed", token)
+		}
+		return n, nil
+	}
+	if strings.ContainsAny(unsigned, ".eE") && !strings.HasPrefix(unsigned, "0x") {
+		if f, err := strconv.ParseFloat(digits, 64); err == nil {
+			return f, nil
+		}
+	}
+	if unsigned == "inf" || unsigned == "nan" {
+		return nil, fmt.Errorf("%s cannot be used in a configuration", token)
+	}
+	// Dates and times such as 1979-05-27 or 07:32:00
+	if len(token) >= 8 && token[0] >= '0' && token[0] <= '9' && strings.ContainsAny(token, "-:") {
+		return token, nil
+	}
+	return nil, fmt.Errorf("invalid value %s (strings must be quoted)", token)
+}
+
+// basicString decodes a "double-quoted" string with escapes.
+func (p *tomlParser) basicString() (string, error) {
+	p.pos++
+	var b strings.Builder
+	for {
+		if p.pos >= len(p.data) || p.data[p.pos] == '\n' {
+			return "", fmt.Errorf("string is not closed")
+		}
+		switch c := p.data[p.pos]; c {
+		case '"':
+			p.pos++
+			return b.String(), nil
+		case '\\':
+			if err := p.escape(&b); err != nil {
+				return "", err
+			}
+		default:
+			b.WriteByte(c)
+			p.pos++
+		}
+	}
+}
+
+// multilineBasicString decodes a """triple-quoted""" string with escapes.
+// A newline right after the opening quotes is dropped, and a backslash at the
+// end of a line removes the line break and the whitespace following it.
+func (p *tomlParser) multilineBasicString() (string, error) {
+	p.pos += 3
+	p.skipNewline()
+	var b strings.Builder
+	for {
+		if p.pos >= len(p.data) {
+			return "", fmt.Errorf(`string is not closed with """`)
+		}
+		if quotes := p.quoteRun('"'); quotes >= 3 {
+			// Up to two quotes may precede the closing ones
+			b.WriteString(strings.Repeat(`"`, min(quotes-3, 2)))
+			p.pos += quotes
+			return b.String(), nil
+		}
+		c := p.data[p.pos]
+		if c != '\\' {
+			b.WriteByte(c)
+			p.pos++
+			continue
+		}
+		trailing := strings.TrimLeft(p.data[p.pos+1:], " \t\r")
+		if strings.HasPrefix(trailing, "\n") {
+			p.pos = len(p.data) - len(strings.TrimLeft(trailing, " \t\r\n"))
+			continue
+		}
+		if err := p.escape(&b); err != nil {
+			return "", err
+		}
+	}
+}
+
+// literalString decodes a 'single-quoted' string, which has no escapes.
+func (p *tomlParser) literalString() (string, error) {
+	p.pos++
+	end := strings.IndexAny(p.data[p.pos:], "'\n")
+	if end < 0 || p.data[p.pos+end] == '\n' {
+		return "", fmt.Errorf("string is not closed")
+	}
+	s := p.data[p.pos : p.pos+end]
+	p.pos += end + 1
+	return s, nil
+}
+
+// multilineLiteralString decodes a string in triple single quotes, which has no
+// escapes.
+func (p *tomlParser) multilineLiteralString() (string, error) {
+	p.pos += 3
+	p.skipNewline()
+	end := strings.Index(p.data[p.pos:], "'''")
+	if end < 0 {
+		return "", fmt.Errorf("string is not closed with '''")
+	}
+	s := p.data[p.pos : p.pos+end]
+	p.pos += end
+	quotes := p.quoteRun('\'')
+	p.pos += quotes
+	return s + strings.Repeat("'", min(quotes-3, 2)), nil
+}
+
+// skipNewline skips the line break directly following an opening delimiter.
+func (p *tomlParser) skipNewline() {
+	if strings.HasPrefix(p.data[p.pos:], "\r\n") {
+		p.pos += 2
+	} else if strings.HasPrefix(p.data[p.pos:], "\n") {
+		p.pos++
+	}
+}
+
+// quoteRun returns how many quote characters follow the current position.
+func (p *tomlParser) quoteRun(quote byte) int {
+	n := 0
+	for p.pos+n < len(p.data) && p.data[p.pos+n] == quote {
+		n++
+	}
+	return n
+}
+
+// escape decodes the escape sequence at the current backslash into b.
+func (p *tomlParser) escape(b *strings.Builder) error {
+	if p.pos+1 >= len(p.data) {
+		return fmt.Errorf("incomplete escape sequence")
+	}
+	c := p.data[p.pos+1]
+	p.pos += 2
+	switch c {
+	case 'b':
+		b.WriteByte('\b')
+	case 't':
+		b.WriteByte('\t')
+	case 'n':
+		b.WriteByte('\n')
+	case 'f':
+		b.WriteByte('\f')
+	case 'r':
+		b.WriteByte('\r')
+	case '"', '\\':
+		b.WriteByte(c)
+	case 'u', 'U':
+		size := 4
+		if c == 'U' {
+			size = 8
+		}
+		if p.pos+size > len(p.data) {
+			return fmt.Errorf("incomplete escape sequence \\%c", c)
+		}
+		code, err := strconv.ParseUint(p.data[p.pos:p.pos+size], 16, 32)
+		if err != nil || !utf8.ValidRune(rune(code)) {
+			return fmt.Errorf("invalid escape sequence \\%c%s", c, p.data[p.pos:p.pos+size])
+		}
+		b.WriteRune(rune(code))
+		p.pos += size
+	default:
+		return fmt.Errorf("invalid escape sequence \\%c", c)
+	}
+	return nil
+}
+
+// array decodes an [array], which may span lines and hold comments.
+func (p *tomlParser) array() ([]interface{}, error) {
+	p.pos++
+	list := []interface{}{}
+	for {
+		p.skipBlank()
+		if p.pos < len(p.data) && p.data[p.pos] == ']' {
+			p.pos++
+			return list, nil
+		}
+		value, err := p.value()
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, value)
+
+		p.skipBlank()
+		if p.pos >= len(p.data) {
+			return nil, fmt.Errorf("array is not closed")
+		}
+		switch p.data[p.pos] {
+		case ',':
+			p.pos++
+		case ']':
+			p.pos++
+			return list, nil
+		default:
+			return nil, fmt.Errorf("unexpected %q, expected , or ] in array", p.data[p.pos])
+		}
+	}
+}
+
+// inlineTable decodes an { inline = "table" } on a single line.
+func (p *tomlParser) inlineTable() (map[string]interface{}, error) {
+	p.pos++
+	table := map[string]interface{}{}
+	p.skipSpace()
+	if p.pos < len(p.data) && p.data[p.pos] == '}' {
+		p.pos++
+		return table, nil
+	}
+	for {
+		if err := p.keyValue(table); err != nil {
+			return nil, err
+		}
+		p.skipSpace()
+		if p.pos >= len(p.data) {
+			return nil, fmt.Errorf("inline table is not closed")
+		}
+		switch p.data[p.pos] {
+		case ',':
+			p.pos++
+		case '}':
+			p.pos++
+			return table, nil
+		default:
+			return nil, fmt.Errorf("unexpected %q, expected , or } in inline table", p.data[p.pos])
+		}
+	}
+}
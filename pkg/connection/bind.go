@@ -0,0 +1,72 @@
+package connection
+
+import (
+	"fmt"
+	"net"
+
+	"tunn/pkg/config"
+)
+
+// applyBinding pins a dialer to the configured source address or network interface.
+//
+// A bind address sets the local IP of outgoing connections. A bind interface is
+// enforced with SO_BINDTODEVICE on Linux; on other platforms the first IPv4 (or
+// otherwise IPv6) address of the interface is used as the source address, which
+// selects the interface on hosts with one address per uplink.
+//
+// Parameters:
+//   - dialer: The dialer to configure in place
+//   - cfg: Connect settings containing the bind address and interface
+//
+// Returns:
+//   - error: An error if the address is invalid or the interface cannot be used
+func applyBinding(dialer *net.Dialer, cfg config.ConnectConfig) error {
+	if cfg.BindAddress != "" {
+		ip := net.ParseIP(cfg.BindAddress)
+		if ip == nil {
+			return fmt.Errorf("invalid bind address: %s", cfg.BindAddress)
+		}
+		dialer.LocalAddr = &net.TCPAddr{IP: ip}
+	}
+
+	if cfg.BindInterface != "" {
+		iface, err := net.InterfaceByName(cfg.BindInterface)
+		if err != nil {
+			return fmt.Errorf("bind interface %s: %w", cfg.BindInterface, err)
+		}
+		if iface.Flags&net.FlagUp == 0 {
+			return fmt.Errorf("bind interface %s is down", cfg.BindInterface)
+		}
+		if err := bindToInterface(dialer, iface); err != nil {
+			return fmt.Errorf("bind interface %s: %w", cfg.BindInterface, err)
+		}
+	}
+	return nil
+}
+
+// interfaceAddress returns the preferred source IP of a network interface,
+// favoring IPv4 addresses.
+func interfaceAddress(iface *net.Interface) (net.IP, error) {
+	addrs, err := iface.Addrs()
+	if err != nil {
+		return nil, err
+	}
+
+	var fallback net.IP
+	for _, addr := range addrs {
+		ipNet, ok := addr.(*net.IPNet)
+		if !ok || ipNet.IP.IsLinkLocalUnicast() {
+			continue
+		}
+		if ipNet.IP.To4() != nil {
+			return ipNet.IP, nil
+		}
+		if fallback == nil {
+			fallback = ipNet.IP
+		}
+	}
+	if fallback == nil {
+		return nil, fmt.Errorf("no usable address on interface")
+	}
+	return fallback, nil
+}
@@ -0,0 +1,28 @@
+//go:build linux
+
+package connection
+
+import (
+	"fmt"
+	"net"
+	"syscall"
+)
+
+// bindToInterface binds outgoing sockets to the interface with SO_BINDTODEVICE,
+// so traffic leaves through it regardless of the routing table.
+func bindToInterface(dialer *net.Dialer, iface *net.Interface) error {
+	dialer.Control = func(network, address string, c syscall.RawConn) error {
+		var sockErr error
+		err := c.Control(func(fd uintptr) {
+			sockErr = syscall.SetsockoptString(int(fd), syscall.SOL_SOCKET, syscall.SO_BINDTODEVICE, iface.Name)
+		})
+		if err != nil {
+			return err
+		}
+		if sockErr != nil {
+			return fmt.Errorf("SO_BINDTODEVICE failed (requires CAP_NET_RAW on older kernels, or use connect.bindAddress): %w", sockErr)
+		}
+		return nil
+	}
+	return nil
+}
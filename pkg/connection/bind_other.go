@@ -0,0 +1,18 @@
+//go:build !linux
+
+package connection
+
+import "net"
+
+// bindToInterface selects the interface by using its address as the source
+// address of outgoing connections.
+func bindToInterface(dialer *net.Dialer, iface *net.Interface) error {
+	ip, err := interfaceAddress(iface)
+	if err != nil {
+		return err
+	}
+	if dialer.LocalAddr == nil {
+		dialer.LocalAddr = &net.TCPAddr{IP: ip}
+	}
+	return nil
+}
@@ -0,0 +1,108 @@
+package connection
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"regexp"
+	"time"
+
+	"tunn/pkg/config"
+)
+
+// DefaultCaptivePortalProbeURL is the probe used when no probe URL is configured.
+// It answers with an empty 204 response on networks with working internet access.
+const DefaultCaptivePortalProbeURL = "http://connectivitycheck.gstatic.com/generate_204"
+
+// CaptivePortalError reports that the network intercepts traffic with a sign-in page.
+type CaptivePortalError struct {
+	PortalURL string // Sign-in page of the portal, if it could be determined
+}
+
+// Error implements the error interface.
+func (e *CaptivePortalError) Error() string {
+	if e.PortalURL == "" {
+		return "captive portal detected: sign in to the network first"
+	}
+	return fmt.Sprintf("captive portal detected: sign in to the network first at %s", e.PortalURL)
+}
+
+// metaRefresh extracts the target of an HTML meta refresh, which some portals
+// return instead of an HTTP redirect.
+var metaRefresh = regexp.MustCompile(`(?i)<meta[^>]+http-equiv=["']?refresh["']?[^>]+url=([^"'>\s]+)`)
+
+// CheckCaptivePortal probes for a captive portal before the tunnel is established.
+//
+// A plain HTTP request is sent to a URL known to answer with "204 No Content".
+// Any other answer means something on the network intercepted the request: a
+// redirect points at the portal's sign-in page, and a page with content is the
+// sign-in page itself. If the probe cannot be sent at all, no portal is reported
+// and the tunnel connection reports its own error.
+//
+// The probe uses the configured outbound binding, so on multi-homed hosts the
+// same uplink as the tunnel is checked.
+//
+// Parameters:
+//   - cfg: Configuration containing the probe URL, timeouts and connect settings
+//
+// Returns:
+//   - error: A *CaptivePortalError if a portal was detected, nil otherwise
+func CheckCaptivePortal(cfg *config.Config) error {
+	probeURL := cfg.CaptivePortal.ProbeURL
+	if probeURL == "" {
+		probeURL = DefaultCaptivePortalProbeURL
+	}
+	timeout := time.Duration(cfg.ConnectionTimeout) * time.Second
+
+	dialer := &net.Dialer{Timeout: timeout}
+	if err := applyBinding(dialer, cfg.Connect); err != nil {
+		return err
+	}
+
+	client := &http.Client{
+		Timeout:   timeout,
+		Transport: &http.Transport{DialContext: dialer.DialContext},
+		// Redirects are the portal's answer, not something to follow
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, probeURL, nil)
+	if err != nil {
+		return fmt.Errorf("invalid captive portal probe URL: %w", err)
+	}
+
+	fmt.Println("→ Checking for captive portal")
+	resp, err := client.Do(req)
+	if err != nil {
+		var netErr net.Error
+		if errors.As(err, &netErr) && netErr.Timeout() {
+			fmt.Println("✗ Captive portal probe timed out, continuing")
+		}
+		return nil
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNoContent:
+		return nil
+	case resp.StatusCode >= 300 && resp.StatusCode < 400:
+		location, err := resp.Location()
+		if err != nil {
+			return &CaptivePortalError{}
+		}
+		return &CaptivePortalError{PortalURL: location.String()}
+	default:
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+		if m := metaRefresh.FindSubmatch(body); m != nil {
+			return &CaptivePortalError{PortalURL: string(m[1])}
+		}
+		return &CaptivePortalError{PortalURL: probeURL}
+	}
+}
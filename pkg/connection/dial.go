@@ -0,0 +1,151 @@
+package connection
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"time"
+
+	"tunn/pkg/config"
+	"tunn/pkg/progress"
+	"tunn/pkg/tor"
+
+	"golang.org/x/net/proxy"
+)
+
+// dialTransport opens the transport connection used by the establishers.
+//
+// The connection is dialed directly, using cached server addresses when
+// available, or, when Tor is enabled, through the local Tor SOCKS proxy. When useTLS is set, a TLS handshake is performed on top of the
+// TCP connection using serverName for SNI and certificate validation, unless
+// tls.serverName overrides it. ALPN, version limits, cipher suites,
+// certificate verification and pins come from the tls section.
+//
+// Parameters:
+//   - cfg: Configuration containing timeouts and upstream proxy settings
+//   - address: Destination address in "host:port" format
+//   - serverName: TLS server name (only used when useTLS is true)
+//   - useTLS: Whether to wrap the connection in TLS
+//
+// Returns:
+//   - net.Conn: The established TCP or TLS connection
+//   - error: An error if dialing or the TLS handshake fails
+func dialTransport(cfg *config.Config, address, serverName string, useTLS bool) (net.Conn, error) {
+	timeout := time.Duration(cfg.ConnectionTimeout) * time.Second
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	dialer, err := transportDialer(cfg, timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	// Direct dials reuse addresses resolved by Prefetch or an earlier connection
+	var conn net.Conn
+	if base, ok := dialer.(*net.Dialer); ok {
+		conn, err = dialResolved(ctx, base, address, cfg)
+	} else {
+		start := time.Now()
+		conn, err = dialer.DialContext(ctx, "tcp", address)
+		progress.Step(progress.TCP, address+" via Tor", start, err)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if !useTLS {
+		return conn, nil
+	}
+
+	tlsConfig, err := newTLSConfig(cfg.TLS, serverName)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	start := time.Now()
+	tlsConn := tls.Client(conn, tlsConfig)
+	if err := tlsConn.HandshakeContext(ctx); err != nil {
+		progress.Step(progress.TLS, tlsConfig.ServerName, start, err)
+		conn.Close()
+		return nil, fmt.Errorf("TLS handshake failed: %w", err)
+	}
+	state := tlsConn.ConnectionState()
+	progress.Step(progress.TLS, fmt.Sprintf("%s, %s", tlsConfig.ServerName, tls.VersionName(state.Version)), start, nil)
+	return tlsConn, nil
+}
+
+// newTLSConfig builds the client TLS configuration for a transport connection.
+//
+// Parameters:
+//   - settings: TLS settings from the configuration
+//   - serverName: Default server name, used when settings.ServerName is empty
+//
+// When a client certificate is configured it is loaded on every call, so a
+// renewed certificate is picked up on the next reconnect.
+//
+// Returns:
+//   - *tls.Config: The client configuration
+//   - error: An error if the version settings are invalid or the certificate cannot be loaded
+func newTLSConfig(settings config.TLSConfig, serverName string) (*tls.Config, error) {
+	minVersion, maxVersion, err := settings.Versions()
+	if err != nil {
+		return nil, err
+	}
+	cipherSuites, err := settings.CipherSuiteIDs()
+	if err != nil {
+		return nil, err
+	}
+	pins, err := settings.Pins()
+	if err != nil {
+		return nil, err
+	}
+	if settings.ServerName != "" {
+		serverName = settings.ServerName
+	}
+
+	tlsConfig := &tls.Config{
+		ServerName:         serverName,
+		NextProtos:         settings.ALPN,
+		MinVersion:         minVersion,
+		MaxVersion:         maxVersion,
+		CipherSuites:       cipherSuites,
+		InsecureSkipVerify: settings.Insecure,
+	}
+	if len(pins) > 0 {
+		// Runs after the usual verification, and also when it is skipped
+		tlsConfig.VerifyConnection = func(state tls.ConnectionState) error {
+			return verifyPins(state, pins)
+		}
+	}
+
+	if settings.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(settings.CertFile, settings.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return tlsConfig, nil
+}
+
+// transportDialer returns the dialer used for transport connections, chaining
+// through the local Tor SOCKS proxy when overTor is enabled. Outbound binding
+// only applies to direct dials, since Tor selects its own uplink.
+func transportDialer(cfg *config.Config, timeout time.Duration) (proxy.ContextDialer, error) {
+	base := &net.Dialer{Timeout: timeout}
+	if !cfg.Tor.OverTor {
+		if err := applyBinding(base, cfg.Connect); err != nil {
+			return nil, err
+		}
+		return base, nil
+	}
+
+	dialer, err := tor.Dialer(cfg.Tor.SocksAddress, base)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Tor dialer: %w", err)
+	}
+	return dialer, nil
+}
@@ -13,13 +13,12 @@
 package connection
 
 import (
-	"crypto/tls"
 	"fmt"
 	"net"
 	"strconv"
-	"time"
 
 	"tunn/pkg/config"
+	"tunn/pkg/progress"
 )
 
 // Establisher defines the interface for establishing network connections.
@@ -48,7 +47,8 @@ type DirectEstablisher struct{}
 //  3. Returns the ready-to-use connection
 //
 // TLS connections use secure defaults with TLS 1.2 minimum version and proper
-// server name indication (SNI) for certificate validation.
+// server name indication (SNI) for certificate validation. When Tor is enabled,
+// the connection is dialed through the local Tor SOCKS proxy.
 //
 // Parameters:
 //   - cfg: Configuration containing connection details and optional WebSocket payload
@@ -60,32 +60,17 @@ func (d *DirectEstablisher) Establish(cfg *config.Config) (net.Conn, error) {
 	sshPort := strconv.Itoa(cfg.SSH.Port)
 	address := net.JoinHostPort(cfg.SSH.Host, sshPort)
 
-	fmt.Printf("→ Connecting to %s\n", address)
+	progress.Printf("→ Connecting to %s\n", address)
 
 	// Establish TCP or TLS connection first
-	var conn net.Conn
-	var err error
-	if cfg.SSH.Port == 443 {
-		tlsConfig := &tls.Config{
-			ServerName: cfg.SSH.Host,
-			MinVersion: tls.VersionTLS12,
-		}
-		conn, err = tls.DialWithDialer(
-			&net.Dialer{Timeout: time.Duration(cfg.ConnectionTimeout) * time.Second},
-			"tcp",
-			address,
-			tlsConfig,
-		)
-	} else {
-		conn, err = net.DialTimeout("tcp", address, time.Duration(cfg.ConnectionTimeout)*time.Second)
-	}
+	conn, err := dialTransport(cfg, address, cfg.SSH.Host, cfg.SSH.Port == 443)
 	if err != nil {
 		return nil, fmt.Errorf("failed to connect directly: %w", err)
 	}
 
 	// Perform WebSocket upgrade if payload is provided
 	if cfg.HTTPPayload != "" {
-		wsConn, err := EstablishWSTunnel(conn, cfg.HTTPPayload, cfg.SSH.Host, sshPort, cfg.SSH.Host)
+		wsConn, err := EstablishWSTunnel(conn, cfg.HTTPPayload, cfg.SSH.Host, sshPort, cfg.SSH.Host, cfg.WSStrict)
 		if err != nil {
 			return nil, fmt.Errorf("failed to establish WebSocket tunnel: %w", err)
 		}
@@ -121,36 +106,21 @@ type ProxyEstablisher struct{}
 func (p *ProxyEstablisher) Establish(cfg *config.Config) (net.Conn, error) {
 	proxyAddress := net.JoinHostPort(cfg.ProxyHost, cfg.ProxyPort)
 	sshPort := strconv.Itoa(cfg.SSH.Port)
-	fmt.Printf("→ Connecting to proxy %s for target %s\n", proxyAddress, cfg.SSH.Host)
+	progress.Printf("→ Connecting to proxy %s for target %s\n", proxyAddress, cfg.SSH.Host)
 
 	// Establish TCP or TLS connection to proxy
-	var conn net.Conn
-	var err error
-	if cfg.ProxyPort == "443" {
-		tlsConfig := &tls.Config{
-			ServerName: cfg.ProxyHost,
-			MinVersion: tls.VersionTLS12,
-		}
-		conn, err = tls.DialWithDialer(
-			&net.Dialer{Timeout: time.Duration(cfg.ConnectionTimeout) * time.Second},
-			"tcp",
-			proxyAddress,
-			tlsConfig,
-		)
-	} else {
-		conn, err = net.DialTimeout("tcp", proxyAddress, time.Duration(cfg.ConnectionTimeout)*time.Second)
-	}
+	conn, err := dialTransport(cfg, proxyAddress, cfg.ProxyHost, cfg.ProxyPort == "443")
 	if err != nil {
 		return nil, fmt.Errorf("failed to connect to proxy: %w", err)
 	}
 
 	// Perform WebSocket upgrade through proxy
-	wsConn, err := EstablishWSTunnel(conn, cfg.HTTPPayload, cfg.SSH.Host, sshPort, cfg.SSH.Host)
+	wsConn, err := EstablishWSTunnel(conn, cfg.HTTPPayload, cfg.SSH.Host, sshPort, cfg.SSH.Host, cfg.WSStrict)
 	if err != nil {
 		return nil, fmt.Errorf("failed to establish proxy WebSocket tunnel: %w", err)
 	}
 
-	fmt.Printf("✓ Proxy WebSocket connection established through %s\n", proxyAddress)
+	progress.Printf("✓ Proxy WebSocket connection established through %s\n", proxyAddress)
 	return wsConn, nil
 }
 
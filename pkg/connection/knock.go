@@ -0,0 +1,139 @@
+package connection
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"tunn/pkg/config"
+	"tunn/pkg/progress"
+	"tunn/pkg/redact"
+)
+
+// knockTimeout bounds a single TCP knock. The knocked port is normally closed
+// or filtered, so the attempt is only meant to put a SYN on the wire.
+const knockTimeout = 500 * time.Millisecond
+
+// Knock sends the configured pre-connection triggers: a GET request to the
+// wake URL, then the port knock sequence, followed by a short wait for the
+// server to open its SSH port.
+//
+// Knocks use the configured outbound binding, so on multi-homed hosts the
+// server sees them from the same address as the tunnel. Whether a knock port
+// answers is irrelevant and not reported; only local failures are errors.
+//
+// Parameters:
+//   - cfg: Configuration containing the knock settings and connect settings
+//
+// Returns:
+//   - error: An error if the wake URL fails or a knock cannot be sent
+func Knock(cfg *config.Config) error {
+	settings := cfg.Knock
+	if !settings.Enabled() {
+		return nil
+	}
+	if cfg.Tor.OverTor {
+		return fmt.Errorf("knocks are sent directly and would reveal this machine to the server, so they cannot be used over Tor")
+	}
+
+	dialer := &net.Dialer{Timeout: time.Duration(cfg.ConnectionTimeout) * time.Second}
+	if err := applyBinding(dialer, cfg.Connect); err != nil {
+		return err
+	}
+
+	if settings.WakeURL != "" {
+		if err := wake(dialer, settings.WakeURL); err != nil {
+			return err
+		}
+	}
+	if len(settings.Sequence) == 0 {
+		return nil
+	}
+
+	host := settings.Host
+	if host == "" {
+		host = cfg.SSH.Host
+	}
+	progress.Printf("→ Knocking on %s (%d ports)\n", host, len(settings.Sequence))
+
+	// Knock the address the tunnel dials first, found as it would find it
+	if ip, ok := staticHost(cfg, host); ok {
+		host = ip
+	} else if net.ParseIP(host) == nil {
+		r := lookup(host, cfg.DNS)
+		<-r.done
+		if r.err != nil {
+			forget(host)
+			return fmt.Errorf("failed to resolve %s: %w", host, r.err)
+		}
+		host = r.addrs[0]
+	}
+	for i, entry := range settings.Sequence {
+		if i > 0 {
+			time.Sleep(time.Duration(settings.Delay) * time.Millisecond)
+		}
+		network, port, err := config.ParseKnock(entry)
+		if err != nil {
+			return err
+		}
+		if err := knock(dialer, network, net.JoinHostPort(host, strconv.Itoa(port))); err != nil {
+			return fmt.Errorf("failed to knock %s: %w", entry, err)
+		}
+	}
+	time.Sleep(time.Duration(settings.Wait) * time.Millisecond)
+	return nil
+}
+
+// wake requests the wake URL and fails on error responses.
+func wake(dialer *net.Dialer, url string) error {
+	client := &http.Client{
+		Timeout:   dialer.Timeout,
+		Transport: &http.Transport{DialContext: dialer.DialContext},
+	}
+	progress.Printf("→ Requesting wake URL %s\n", redact.URL(url))
+	resp, err := client.Get(url)
+	if err != nil {
+		return fmt.Errorf("wake URL failed: %s", redact.Text(err.Error()))
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode >= 400 {
+		return fmt.Errorf("wake URL answered %s", resp.Status)
+	}
+	return nil
+}
+
+// knock sends a single knock: a TCP connection attempt or a UDP datagram.
+func knock(dialer *net.Dialer, network, address string) error {
+	if network == "udp" {
+		udpDialer := *dialer
+		if local, ok := dialer.LocalAddr.(*net.TCPAddr); ok {
+			udpDialer.LocalAddr = &net.UDPAddr{IP: local.IP}
+		}
+		conn, err := udpDialer.Dial("udp", address)
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+		_, err = conn.Write([]byte{0})
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), knockTimeout)
+	defer cancel()
+	conn, err := dialer.DialContext(ctx, "tcp", address)
+	if err == nil {
+		conn.Close()
+	}
+	// Refused and timed-out knocks have done their job, unresolvable ones have not
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return err
+	}
+	return nil
+}
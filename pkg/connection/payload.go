@@ -0,0 +1,190 @@
+package connection
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// PayloadValues holds the values substituted for payload placeholders.
+type PayloadValues struct {
+	Host string // Value of [host], usually the Host header or host:port
+	Port string // Value of [port]
+}
+
+// PayloadError describes a problem at a specific position of a payload template.
+type PayloadError struct {
+	Offset int    // Byte offset in the template (or in the generated payload for structural errors)
+	Msg    string // Description of the problem
+}
+
+// Error implements the error interface.
+func (e *PayloadError) Error() string {
+	return fmt.Sprintf("payload offset %d: %s", e.Offset, e.Msg)
+}
+
+// requestLinePattern matches an HTTP/1.x request line.
+var requestLinePattern = regexp.MustCompile(`^[A-Z]+ [^ ]+ HTTP/1\.[01]$`)
+
+// headerNamePattern matches a valid HTTP header field name (RFC 7230 token).
+var headerNamePattern = regexp.MustCompile("^[!#$%&'*+.^_`|~0-9A-Za-z-]+$")
+
+// ParsePayload expands a payload template into the bytes sent to the server.
+//
+// The template language is deliberately small:
+//   - [host]: Replaced with values.Host
+//   - [port]: Replaced with values.Port
+//   - [crlf], [cr], [lf]: Replaced with "\r\n", "\r" and "\n"
+//
+// Lenient mode substitutes exactly the placeholders above and copies every
+// other byte unchanged. Earlier versions replaced only [host] and [crlf], so a
+// payload is sent as before unless it contains [port], [cr] or [lf], which
+// used to be sent literally and are now expanded. Strict mode additionally accepts
+// placeholder names in any case and the escapes \[, \] (a literal bracket) and
+// \\ (a literal backslash); unknown placeholders, stray brackets and stray
+// backslashes are errors, and the generated payload must consist of one or more
+// complete HTTP/1.x request heads, each terminated by an empty line, with no
+// bare CR or LF and no control bytes.
+//
+// Parameters:
+//   - template: The payload template from the configuration
+//   - values: Values for the [host] and [port] placeholders
+//   - strict: Whether to reject ambiguous or malformed payloads
+//
+// Returns:
+//   - []byte: The generated payload
+//   - error: A *PayloadError describing the first problem found
+func ParsePayload(template string, values PayloadValues, strict bool) ([]byte, error) {
+	var out strings.Builder
+
+	for i := 0; i < len(template); i++ {
+		c := template[i]
+		switch c {
+		case '\\':
+			if !strict {
+				out.WriteByte(c)
+				continue
+			}
+			if i+1 < len(template) && strings.IndexByte(`[]\`, template[i+1]) >= 0 {
+				out.WriteByte(template[i+1])
+				i++
+				continue
+			}
+			return nil, &PayloadError{Offset: i, Msg: "invalid escape, use \\[, \\] or \\\\"}
+
+		case '[':
+			end := strings.IndexByte(template[i:], ']')
+			if end < 0 {
+				if strict {
+					return nil, &PayloadError{Offset: i, Msg: "unterminated placeholder, escape literal brackets as \\["}
+				}
+				out.WriteByte(c)
+				continue
+			}
+
+			name := template[i+1 : i+end]
+			if value, ok := placeholderValue(name, values, strict); ok {
+				out.WriteString(value)
+				i += end
+			} else if strict {
+				return nil, &PayloadError{Offset: i, Msg: fmt.Sprintf("unknown placeholder [%s]", name)}
+			} else {
+				// Keep the bracket and rescan after it, so a placeholder inside
+				// the unknown name, as in "[x[crlf]", is still substituted.
+				out.WriteByte(c)
+			}
+
+		default:
+			out.WriteByte(c)
+		}
+	}
+
+	payload := []byte(out.String())
+	if strict {
+		if err := validateRequestHeads(payload); err != nil {
+			return nil, err
+		}
+	}
+	return payload, nil
+}
+
+// ValidatePayload checks a payload template in strict mode without connection values.
+//
+// Parameters:
+//   - template: The payload template from the configuration
+//
+// Returns:
+//   - error: A *PayloadError describing the first problem found, or nil
+func ValidatePayload(template string) error {
+	_, err := ParsePayload(template, PayloadValues{Host: "example.com", Port: "80"}, true)
+	return err
+}
+
+// placeholderValue returns the substitution for a placeholder name, matched
+// regardless of case only when foldCase is set.
+func placeholderValue(name string, values PayloadValues, foldCase bool) (string, bool) {
+	if foldCase {
+		name = strings.ToLower(name)
+	}
+	switch name {
+	case "host":
+		return values.Host, true
+	case "port":
+		return values.Port, true
+	case "crlf":
+		return "\r\n", true
+	case "cr":
+		return "\r", true
+	case "lf":
+		return "\n", true
+	default:
+		return "", false
+	}
+}
+
+// validateRequestHeads checks that a generated payload is a sequence of complete
+// HTTP/1.x request heads.
+func validateRequestHeads(payload []byte) error {
+	if len(payload) == 0 {
+		return &PayloadError{Offset: 0, Msg: "payload is empty"}
+	}
+
+	for i, b := range payload {
+		switch {
+		case b == '\r':
+			if i+1 >= len(payload) || payload[i+1] != '\n' {
+				return &PayloadError{Offset: i, Msg: "bare CR, use [crlf]"}
+			}
+		case b == '\n':
+			if i == 0 || payload[i-1] != '\r' {
+				return &PayloadError{Offset: i, Msg: "bare LF, use [crlf]"}
+			}
+		case b == '\t':
+		case b < 0x20 || b == 0x7f:
+			return &PayloadError{Offset: i, Msg: fmt.Sprintf("control byte 0x%02x", b)}
+		}
+	}
+
+	text := string(payload)
+	if !strings.HasSuffix(text, "\r\n\r\n") {
+		return &PayloadError{Offset: len(payload), Msg: "payload must end with an empty line ([crlf][crlf])"}
+	}
+
+	offset := 0
+	for _, head := range strings.Split(strings.TrimSuffix(text, "\r\n\r\n"), "\r\n\r\n") {
+		lines := strings.Split(head, "\r\n")
+		if !requestLinePattern.MatchString(lines[0]) {
+			return &PayloadError{Offset: offset, Msg: fmt.Sprintf("invalid request line %q", lines[0])}
+		}
+		lineOffset := offset + len(lines[0]) + 2
+		for _, line := range lines[1:] {
+			name, _, ok := strings.Cut(line, ":")
+			if !ok || !headerNamePattern.MatchString(name) {
+				return &PayloadError{Offset: lineOffset, Msg: fmt.Sprintf("invalid header line %q", line)}
+			}
+			lineOffset += len(line) + 2
+		}
+		offset += len(head) + 4
+	}
+	return nil
+}
@@ -0,0 +1,108 @@
+package connection
+
+import (
+	"strings"
+	"testing"
+)
+
+// legacyReplace is the string replacement payloads were expanded with before
+// ParsePayload, which substituted only [host] and [crlf].
+func legacyReplace(template string, values PayloadValues) string {
+	payload := strings.ReplaceAll(template, "[host]", values.Host)
+	return strings.ReplaceAll(payload, "[crlf]", "\r\n")
+}
+
+// newPlaceholders are the placeholders lenient mode expands that the legacy
+// replacement sent literally.
+var newPlaceholders = []string{"[port]", "[cr]", "[lf]"}
+
+func TestParsePayloadLenient(t *testing.T) {
+	values := PayloadValues{Host: "example.com:80", Port: "80"}
+	tests := []struct {
+		template string
+		want     string
+	}{
+		{"GET / HTTP/1.1[crlf]Host: [host][crlf][crlf]", "GET / HTTP/1.1\r\nHost: example.com:80\r\n\r\n"},
+		{"GET /[x HTTP/1.1[crlf]Host: [host]", "GET /[x HTTP/1.1\r\nHost: example.com:80"},
+		{"[unknown][crlf]", "[unknown]\r\n"},
+		{"[x[crlf]]", "[x\r\n]"},
+		{"[HOST] [Crlf]", "[HOST] [Crlf]"},
+		{`\[host] \\ \x`, `\example.com:80 \\ \x`},
+		{"[", "["},
+		// Sent literally before [port], [cr] and [lf] were added
+		{"[port] [cr] [lf]", "80 \r \n"},
+		{"]", "]"},
+	}
+	for _, tt := range tests {
+		got, err := ParsePayload(tt.template, values, false)
+		if err != nil {
+			t.Errorf("ParsePayload(%q): %v", tt.template, err)
+			continue
+		}
+		if string(got) != tt.want {
+			t.Errorf("ParsePayload(%q) = %q, want %q", tt.template, got, tt.want)
+		}
+	}
+}
+
+func TestParsePayloadStrict(t *testing.T) {
+	values := PayloadValues{Host: "example.com", Port: "80"}
+	got, err := ParsePayload(`GET /\[a\]\\ HTTP/1.1[CRLF]Host: [Host][crlf][crlf]`, values, true)
+	if err != nil {
+		t.Fatalf("ParsePayload: %v", err)
+	}
+	if want := "GET /[a]\\ HTTP/1.1\r\nHost: example.com\r\n\r\n"; string(got) != want {
+		t.Errorf("ParsePayload = %q, want %q", got, want)
+	}
+
+	for _, template := range []string{
+		"GET / HTTP/1.1[crlf]Host: [x][crlf][crlf]",
+		"GET /[x HTTP/1.1[crlf][crlf]",
+		`GET /\x HTTP/1.1[crlf][crlf]`,
+		"GET / HTTP/1.1[lf][crlf]",
+		"GET / HTTP/1.1[crlf]",
+	} {
+		if _, err := ParsePayload(template, values, true); err == nil {
+			t.Errorf("ParsePayload(%q) succeeded in strict mode", template)
+		}
+	}
+}
+
+func FuzzParsePayload(f *testing.F) {
+	for _, seed := range []string{
+		"GET / HTTP/1.1[crlf]Host: [host][crlf]Upgrade: websocket[crlf][crlf]",
+		"GET /[x HTTP/1.1[crlf]Host: [host]",
+		"CONNECT [host]:[port] HTTP/1.1[cr][lf][crlf]",
+		"[[crlf]host][[host]][cr[lf]",
+		`GET /\[a\] HTTP/1.1[crlf][crlf]`,
+		"[HOST][",
+	} {
+		f.Add(seed)
+	}
+
+	values := PayloadValues{Host: "example.com:80", Port: "80"}
+	f.Fuzz(func(t *testing.T, template string) {
+		got, err := ParsePayload(template, values, false)
+		if err != nil {
+			t.Fatalf("lenient ParsePayload(%q) failed: %v", template, err)
+		}
+		if !strings.Contains(template, `\`) && !containsAny(template, newPlaceholders) {
+			if want := legacyReplace(template, values); string(got) != want {
+				t.Fatalf("lenient ParsePayload(%q) = %q, want %q", template, got, want)
+			}
+		}
+
+		// Strict mode may reject the template but must not panic
+		_, _ = ParsePayload(template, values, true)
+	})
+}
+
+// containsAny reports whether s contains any of the substrings.
+func containsAny(s string, substrings []string) bool {
+	for _, sub := range substrings {
+		if strings.Contains(s, sub) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,67 @@
+package connection
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+)
+
+// verifyPins checks that a server presented a certificate matching one of the
+// pins of tls.pinnedSHA256, by the hash of either the whole certificate or its
+// public key.
+//
+// The list of presented certificates is chosen by the peer, so only
+// certificates it has proven to hold count: with verification on, those of
+// the verified chains, where an intermediate can be pinned to survive renewals
+// of the leaf; with tls.insecure, the leaf alone, whose key signed the
+// handshake.
+//
+// Parameters:
+//   - state: The state of the handshake
+//   - pins: The SHA-256 hashes to accept
+//
+// Returns:
+//   - error: An error naming the public key hash of the leaf if nothing matches
+func verifyPins(state tls.ConnectionState, pins [][]byte) error {
+	if len(state.PeerCertificates) == 0 {
+		return fmt.Errorf("server presented no certificate to check against tls.pinnedSHA256")
+	}
+
+	candidates := state.PeerCertificates[:1]
+	if len(state.VerifiedChains) > 0 {
+		candidates = nil
+		for _, chain := range state.VerifiedChains {
+			candidates = append(candidates, chain...)
+		}
+	}
+	for _, cert := range candidates {
+		if matchesPin(cert, pins) {
+			return nil
+		}
+	}
+
+	leaf := state.PeerCertificates[0]
+	name := "the server"
+	if cn := leaf.Subject.CommonName; cn != "" {
+		name = cn
+	}
+	keyHash := sha256.Sum256(leaf.RawSubjectPublicKeyInfo)
+	return fmt.Errorf("certificate of %s matches no pin in tls.pinnedSHA256 (its public key is sha256/%s); the connection may be intercepted",
+		name, base64.StdEncoding.EncodeToString(keyHash[:]))
+}
+
+// matchesPin reports whether a certificate or its public key has one of the
+// pinned hashes.
+func matchesPin(cert *x509.Certificate, pins [][]byte) bool {
+	certHash := sha256.Sum256(cert.Raw)
+	keyHash := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	for _, pin := range pins {
+		if bytes.Equal(pin, certHash[:]) || bytes.Equal(pin, keyHash[:]) {
+			return true
+		}
+	}
+	return false
+}
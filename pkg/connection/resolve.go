@@ -0,0 +1,334 @@
+package connection
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"tunn/pkg/config"
+	"tunn/pkg/dns"
+	"tunn/pkg/progress"
+)
+
+// bootstrapTimeout bounds a lookup through the resolvers of dns.bootstrap and
+// each of dns.servers.
+const bootstrapTimeout = 15 * time.Second
+
+// happyEyeballsDelay is how long a dial runs before the next address of a
+// server is tried alongside it, as recommended by RFC 8305.
+const happyEyeballsDelay = 250 * time.Millisecond
+
+// resolveTTL is how long resolved server addresses are reused, so reconnects
+// on a good link skip DNS entirely.
+const resolveTTL = 5 * time.Minute
+
+// resolution is a pending or completed lookup of a server hostname.
+type resolution struct {
+	done    chan struct{} // Closed when the lookup has finished
+	addrs   []string      // Resolved IP addresses, valid after done
+	err     error         // Lookup error, valid after done
+	expires time.Time     // When the addresses must be looked up again, valid after done
+}
+
+// resolveCache holds server hostname lookups shared by Prefetch and dialTransport.
+var resolveCache = struct {
+	sync.Mutex
+	entries map[string]*resolution
+}{entries: make(map[string]*resolution)}
+
+// Prefetch starts resolving the servers a configuration connects to in the
+// background, so DNS overlaps with work done before dialing such as the
+// pre-connect hook or the captive portal probe.
+//
+// Nothing is resolved locally when dialing over Tor, which resolves names
+// itself; resolving them here would leak the server name to the local resolver.
+// Names listed in hosts are not resolved at all. With dns.bootstrap or
+// dns.servers, other names are resolved by those resolvers instead of the
+// system resolver.
+//
+// Parameters:
+//   - cfg: The configuration to connect with
+func Prefetch(cfg *config.Config) {
+	if cfg.Tor.OverTor {
+		return
+	}
+	for _, host := range []string{cfg.SSH.Host, cfg.ProxyHost} {
+		if _, static := staticHost(cfg, host); host != "" && net.ParseIP(host) == nil && !static {
+			lookup(host, cfg.DNS)
+		}
+	}
+}
+
+// staticHost returns the fixed address of a hostname listed in hosts.
+//
+// Parameters:
+//   - cfg: The configuration holding the hosts entries
+//   - host: The hostname, matched regardless of case
+//
+// Returns:
+//   - string: The address of the hostname
+//   - bool: True if the hostname is listed
+func staticHost(cfg *config.Config, host string) (string, bool) {
+	host = strings.TrimSuffix(host, ".")
+	for name, address := range cfg.Hosts {
+		if strings.EqualFold(strings.TrimSuffix(name, "."), host) {
+			return address, true
+		}
+	}
+	return "", false
+}
+
+// lookup returns the lookup for a hostname, starting one unless a fresh or
+// pending lookup already exists.
+//
+// Parameters:
+//   - host: The hostname to resolve
+//   - settings: The DNS settings naming the resolver to use
+//
+// Returns:
+//   - *resolution: The pending or completed lookup
+func lookup(host string, settings config.DNSConfig) *resolution {
+	resolveCache.Lock()
+	defer resolveCache.Unlock()
+
+	if r, ok := resolveCache.entries[host]; ok {
+		select {
+		case <-r.done:
+			if r.err == nil && time.Now().Before(r.expires) {
+				return r
+			}
+		default:
+			return r
+		}
+	}
+
+	r := &resolution{done: make(chan struct{})}
+	resolveCache.entries[host] = r
+	go func() {
+		r.addrs, r.err = resolveHost(host, settings)
+		r.expires = time.Now().Add(resolveTTL)
+		close(r.done)
+	}()
+	return r
+}
+
+// resolveHost looks up a hostname with the DNS-over-HTTPS resolver of
+// dns.bootstrap, the servers of dns.servers tried in order, or the system
+// resolver when neither is set.
+//
+// Parameters:
+//   - host: The hostname to resolve
+//   - settings: The DNS settings naming the resolver to use
+//
+// Returns:
+//   - []string: The addresses of the hostname
+//   - error: An error if the lookup failed
+func resolveHost(host string, settings config.DNSConfig) ([]string, error) {
+	switch {
+	case settings.Bootstrap != "":
+		ctx, cancel := context.WithTimeout(context.Background(), bootstrapTimeout)
+		defer cancel()
+		return dns.LookupDoH(ctx, settings.Bootstrap, host)
+
+	case len(settings.Servers) > 0:
+		var lastErr error
+		for _, server := range settings.Servers {
+			resolver := &net.Resolver{
+				PreferGo: true,
+				Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+					var d net.Dialer
+					return d.DialContext(ctx, network, server)
+				},
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), bootstrapTimeout)
+			addrs, err := resolver.LookupHost(ctx, host)
+			cancel()
+			if err == nil {
+				return addrs, nil
+			}
+			lastErr = err
+		}
+		return nil, lastErr
+
+	default:
+		return net.DefaultResolver.LookupHost(context.Background(), host)
+	}
+}
+
+// forget drops a hostname's cached addresses, for example after none of them
+// could be reached.
+func forget(host string) {
+	resolveCache.Lock()
+	defer resolveCache.Unlock()
+	delete(resolveCache.entries, host)
+}
+
+// dialResolved dials an address through the resolve cache.
+//
+// IP addresses are dialed directly. For hostnames the cached or pending lookup
+// is used and the addresses are raced with Happy Eyeballs, the family of
+// connect.prefer first. If none can be reached the cached addresses are
+// dropped so the next attempt resolves again.
+//
+// Parameters:
+//   - ctx: Context bounding the whole dial
+//   - dialer: The dialer for the resolved addresses
+//   - address: Destination in "host:port" format
+//   - cfg: The configuration naming the hosts entries and resolver to use
+//
+// Returns:
+//   - net.Conn: The connection
+//   - error: An error if resolution or every dial fails
+func dialResolved(ctx context.Context, dialer *net.Dialer, address string, cfg *config.Config) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil || net.ParseIP(host) != nil {
+		start := time.Now()
+		conn, err := dialer.DialContext(ctx, "tcp", address)
+		progress.Step(progress.TCP, address, start, err)
+		return conn, err
+	}
+
+	if ip, ok := staticHost(cfg, host); ok {
+		progress.Step(progress.Resolve, fmt.Sprintf("%s → %s (hosts)", host, ip), time.Now(), nil)
+		address = net.JoinHostPort(ip, port)
+		start := time.Now()
+		conn, err := dialer.DialContext(ctx, "tcp", address)
+		progress.Step(progress.TCP, address, start, err)
+		return conn, err
+	}
+
+	start := time.Now()
+	r := lookup(host, cfg.DNS)
+	select {
+	case <-r.done:
+	case <-ctx.Done():
+		err := fmt.Errorf("lookup %s: %w", host, ctx.Err())
+		progress.Step(progress.Resolve, host, start, err)
+		return nil, err
+	}
+	if r.err != nil {
+		progress.Step(progress.Resolve, host, start, r.err)
+		forget(host)
+		return nil, r.err
+	}
+	progress.Step(progress.Resolve, fmt.Sprintf("%s → %s", host, strings.Join(r.addrs, ", ")), start, nil)
+	start = time.Now()
+
+	conn, err := dialHappyEyeballs(ctx, dialer, sortAddrs(r.addrs, cfg.Connect.Prefer), port)
+	if err != nil {
+		forget(host)
+		progress.Step(progress.TCP, address, start, err)
+		return nil, err
+	}
+	progress.Step(progress.TCP, conn.RemoteAddr().String(), start, nil)
+	return conn, nil
+}
+
+// sortAddrs orders resolved addresses for Happy Eyeballs (RFC 8305): the
+// preferred family first, alternating with the other family after that, so
+// both are tried early whatever the resolver returned.
+//
+// Parameters:
+//   - addrs: The resolved IP addresses
+//   - prefer: "ipv4" or "ipv6", or empty for the family of the first address
+//
+// Returns:
+//   - []string: The addresses in the order to dial them
+func sortAddrs(addrs []string, prefer string) []string {
+	var v4, v6 []string
+	for _, addr := range addrs {
+		if ip := net.ParseIP(addr); ip != nil && ip.To4() != nil {
+			v4 = append(v4, addr)
+		} else {
+			v6 = append(v6, addr)
+		}
+	}
+	first, second := v4, v6
+	if prefer == "ipv6" || prefer == "" && len(addrs) > 0 && len(v6) > 0 && addrs[0] == v6[0] {
+		first, second = v6, v4
+	}
+
+	sorted := make([]string, 0, len(addrs))
+	for i := 0; i < len(first) || i < len(second); i++ {
+		if i < len(first) {
+			sorted = append(sorted, first[i])
+		}
+		if i < len(second) {
+			sorted = append(sorted, second[i])
+		}
+	}
+	return sorted
+}
+
+// dialHappyEyeballs dials addresses in order, starting the next attempt when
+// the previous one fails or has not connected within happyEyeballsDelay. The
+// first connection wins and the others are closed.
+//
+// Parameters:
+//   - ctx: Context bounding the whole dial
+//   - dialer: The dialer for the addresses
+//   - addrs: The IP addresses in the order to try them
+//   - port: The port to dial on each address
+//
+// Returns:
+//   - net.Conn: The first connection established
+//   - error: The last error if no address could be reached
+func dialHappyEyeballs(ctx context.Context, dialer *net.Dialer, addrs []string, port string) (net.Conn, error) {
+	if len(addrs) == 0 {
+		return nil, fmt.Errorf("no addresses to dial")
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	type result struct {
+		conn net.Conn
+		err  error
+	}
+	results := make(chan result, len(addrs))
+	timer := time.NewTimer(happyEyeballsDelay)
+	defer timer.Stop()
+
+	next, pending := 0, 0
+	dialNext := func() {
+		address := net.JoinHostPort(addrs[next], port)
+		next++
+		pending++
+		go func() {
+			conn, err := dialer.DialContext(ctx, "tcp", address)
+			results <- result{conn, err}
+		}()
+		timer.Reset(happyEyeballsDelay)
+	}
+
+	dialNext()
+	var lastErr error
+	for pending > 0 {
+		select {
+		case <-timer.C:
+			if next < len(addrs) {
+				dialNext()
+			}
+		case r := <-results:
+			pending--
+			if r.err == nil {
+				// Close the connections of attempts still racing
+				go func(pending int) {
+					for range pending {
+						if r := <-results; r.conn != nil {
+							r.conn.Close()
+						}
+					}
+				}(pending)
+				return r.conn, nil
+			}
+			lastErr = r.err
+			if next < len(addrs) && ctx.Err() == nil {
+				dialNext()
+			}
+		}
+	}
+	return nil, lastErr
+}
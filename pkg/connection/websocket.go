@@ -2,11 +2,26 @@ package connection
 
 import (
 	"bytes"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base64"
+	"errors"
 	"fmt"
 	"net"
 	"strings"
+	"time"
+
+	"tunn/pkg/progress"
+	"tunn/pkg/redact"
 )
 
+// websocketGUID is the fixed GUID from RFC 6455 used to derive Sec-WebSocket-Accept.
+const websocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// ErrInvalidWebSocketAccept is returned in strict WebSocket mode when the server's
+// 101 response does not carry the Sec-WebSocket-Accept value matching the key sent.
+var ErrInvalidWebSocketAccept = errors.New("invalid Sec-WebSocket-Accept in upgrade response")
+
 // ReplacePlaceholders performs template substitution in HTTP payload strings.
 //
 // This function replaces common placeholders in WebSocket upgrade payloads with
@@ -14,7 +29,11 @@ import (
 //
 // Supported placeholders:
 //   - [host]: Replaced with the hostHeader value, or targetHost:targetPort if hostHeader is empty
-//   - [crlf]: Replaced with HTTP line endings (\r\n)
+//   - [port]: Replaced with targetPort
+//   - [crlf], [cr], [lf]: Replaced with HTTP line endings (\r\n) or single CR/LF characters
+//
+// Placeholders are expanded by ParsePayload in lenient mode, so unknown
+// placeholders are sent unchanged.
 //
 // Parameters:
 //   - payload: The template payload string containing placeholders
@@ -36,9 +55,9 @@ func ReplacePlaceholders(payload, targetHost, targetPort, hostHeader string) []b
 		hostValue = net.JoinHostPort(targetHost, targetPort)
 	}
 
-	payload = strings.ReplaceAll(payload, "[host]", hostValue)
-	payload = strings.ReplaceAll(payload, "[crlf]", "\r\n")
-	return []byte(payload)
+	// Lenient parsing never fails
+	data, _ := ParsePayload(payload, PayloadValues{Host: hostValue, Port: targetPort}, false)
+	return data
 }
 
 // ReadHeaders reads HTTP response headers from a connection until the header section ends.
@@ -94,6 +113,8 @@ func ReadHeaders(conn net.Conn) ([]byte, error) {
 //   - targetHost: Target server hostname for placeholder replacement
 //   - targetPort: Target server port for placeholder replacement
 //   - hostHeader: Optional custom host header (uses targetHost:targetPort if empty)
+//   - strict: Whether to send a fresh random Sec-WebSocket-Key and verify the
+//     Sec-WebSocket-Accept header of the response as required by RFC 6455
 //
 // Returns:
 //   - net.Conn: The same connection, now upgraded to WebSocket
@@ -101,20 +122,39 @@ func ReadHeaders(conn net.Conn) ([]byte, error) {
 //
 // The function expects a successful WebSocket upgrade response (HTTP 101) from the server.
 // If the server responds with any other status code, the upgrade is considered failed
-// and an error is returned.
+// and an error is returned. In strict mode a missing or wrong Sec-WebSocket-Accept
+// header fails with ErrInvalidWebSocketAccept.
 //
 // Example payload:
 //
 //	payload := "GET / HTTP/1.1[crlf]Host: [host][crlf]Upgrade: websocket[crlf]Connection: Upgrade[crlf][crlf]"
-func EstablishWSTunnel(conn net.Conn, payload, targetHost, targetPort, hostHeader string) (net.Conn, error) {
+func EstablishWSTunnel(conn net.Conn, payload, targetHost, targetPort, hostHeader string, strict bool) (_ net.Conn, err error) {
 	if conn == nil {
 		return nil, fmt.Errorf("connection must be established before WebSocket upgrade")
 	}
 
 	// Send WebSocket upgrade request
 	if payload != "" {
+		start, status := time.Now(), "no response"
+		defer func() { progress.Step(progress.Upgrade, status, start, err) }()
+
 		wsPayload := ReplacePlaceholders(payload, targetHost, targetPort, hostHeader)
-		fmt.Printf("→ Sending WebSocket upgrade request\n")
+
+		var key string
+		if strict {
+			var err error
+			key, err = newWebSocketKey()
+			if err != nil {
+				conn.Close()
+				return nil, err
+			}
+			if wsPayload, err = setWebSocketKey(wsPayload, key); err != nil {
+				conn.Close()
+				return nil, err
+			}
+		}
+
+		progress.Printf("→ Sending WebSocket upgrade request\n")
 
 		if _, err := conn.Write(wsPayload); err != nil {
 			conn.Close()
@@ -129,19 +169,99 @@ func EstablishWSTunnel(conn net.Conn, payload, targetHost, targetPort, hostHeade
 		}
 
 		// Print the response received from WebSocket request
-		fmt.Printf("← WebSocket response received:\n")
-		fmt.Printf("  %s\n", strings.SplitN(strings.TrimSpace(string(headers)), "\n", 2)[0])
+		status = redact.Text(strings.TrimSpace(strings.SplitN(strings.TrimSpace(string(headers)), "\n", 2)[0]))
+		progress.Printf("← WebSocket response received:\n")
+		progress.Printf("  %s\n", status)
 
 		// Check if upgrade was successful
 		headerStr := string(headers)
 		if !strings.Contains(headerStr, "HTTP/1.1 101") &&
 			!strings.Contains(headerStr, "HTTP/1.0 101") {
 			conn.Close()
-			return nil, fmt.Errorf("WebSocket upgrade failed: %s", headerStr)
+			return nil, fmt.Errorf("WebSocket upgrade failed: %s", redact.Text(headerStr))
 		}
 
-		fmt.Printf("✓ WebSocket tunnel established\n")
+		if strict {
+			want := WebSocketAccept(key)
+			got := headerValue(headerStr, "Sec-WebSocket-Accept")
+			if got != want {
+				conn.Close()
+				return nil, fmt.Errorf("%w: got %q, want %q", ErrInvalidWebSocketAccept, got, want)
+			}
+		}
+
+		progress.Printf("✓ WebSocket tunnel established\n")
 	}
 
 	return conn, nil
 }
+
+// newWebSocketKey generates a random Sec-WebSocket-Key (16 random bytes, base64 encoded).
+// A new key is generated for every upgrade so keys are never reused across connections.
+func newWebSocketKey() (string, error) {
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("failed to generate WebSocket key: %w", err)
+	}
+	return base64.StdEncoding.EncodeToString(nonce), nil
+}
+
+// WebSocketAccept computes the Sec-WebSocket-Accept value a server must return
+// for a Sec-WebSocket-Key.
+//
+// Parameters:
+//   - key: The Sec-WebSocket-Key sent by the client
+//
+// Returns:
+//   - string: The matching Sec-WebSocket-Accept value
+func WebSocketAccept(key string) string {
+	sum := sha1.Sum([]byte(key + websocketGUID))
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// setWebSocketKey replaces any Sec-WebSocket-Key header in the last request head of
+// the payload with the given key, adding the header if the payload has none.
+//
+// Parameters:
+//   - payload: The generated upgrade payload
+//   - key: The Sec-WebSocket-Key value to send
+//
+// Returns:
+//   - []byte: The payload with the key header set
+//   - error: An error if the payload does not end with a complete request head
+func setWebSocketKey(payload []byte, key string) ([]byte, error) {
+	text := string(payload)
+	if !strings.HasSuffix(text, "\r\n\r\n") {
+		return nil, fmt.Errorf("strict WebSocket mode requires the payload to end with [crlf][crlf]")
+	}
+
+	body := strings.TrimSuffix(text, "\r\n\r\n")
+	prefix := ""
+	if i := strings.LastIndex(body, "\r\n\r\n"); i >= 0 {
+		prefix, body = body[:i+4], body[i+4:]
+	}
+
+	var lines []string
+	for _, line := range strings.Split(body, "\r\n") {
+		name, _, _ := strings.Cut(line, ":")
+		if strings.EqualFold(strings.TrimSpace(name), "Sec-WebSocket-Key") {
+			continue
+		}
+		lines = append(lines, line)
+	}
+	lines = append(lines, "Sec-WebSocket-Key: "+key)
+
+	return []byte(prefix + strings.Join(lines, "\r\n") + "\r\n\r\n"), nil
+}
+
+// headerValue returns the value of the first header with the given name in a
+// response head, or an empty string if it is missing.
+func headerValue(head, name string) string {
+	for _, line := range strings.Split(head, "\r\n")[1:] {
+		key, value, ok := strings.Cut(line, ":")
+		if ok && strings.EqualFold(strings.TrimSpace(key), name) {
+			return strings.TrimSpace(value)
+		}
+	}
+	return ""
+}
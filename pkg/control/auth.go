@@ -0,0 +1,125 @@
+package control
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// TokenHeader is the request header carrying the control API token.
+//
+// Browsers cannot add custom headers to cross-site requests without a CORS
+// preflight, which the control API never answers, so a web page can neither
+// forge requests to it nor read its answers.
+const TokenHeader = "X-Tunn-Token"
+
+// TokenPath returns the file holding the token of the control API listening
+// on an address.
+//
+// A new token is written to this file, readable only by its owner, each time
+// a tunnel starts its control API. Only programs of the same user, such as
+// "tunn status", can read it and use the API.
+//
+// Parameters:
+//   - address: The control API address
+//
+// Returns:
+//   - string: Path of the token file in the tunn configuration directory
+//   - error: An error if the configuration directory cannot be determined
+func TokenPath(address string) (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to locate config directory: %w", err)
+	}
+	name := strings.NewReplacer(":", "_", "[", "", "]", "", "/", "_", `\`, "_").Replace(address)
+	return filepath.Join(dir, "tunn", "control-"+name+".token"), nil
+}
+
+// writeToken creates a random token and stores it in the token file of an
+// address, readable only by the current user.
+func writeToken(address string) (token, path string, err error) {
+	path, err = TokenPath(address)
+	if err != nil {
+		return "", "", err
+	}
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", "", fmt.Errorf("failed to generate control API token: %w", err)
+	}
+	token = hex.EncodeToString(secret)
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return "", "", fmt.Errorf("failed to write control API token: %w", err)
+	}
+	// A file left by another user or with wider permissions is replaced
+	os.Remove(path)
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to write control API token: %w", err)
+	}
+	if _, err := io.WriteString(file, token); err != nil {
+		file.Close()
+		os.Remove(path)
+		return "", "", fmt.Errorf("failed to write control API token: %w", err)
+	}
+	if err := file.Close(); err != nil {
+		os.Remove(path)
+		return "", "", fmt.Errorf("failed to write control API token: %w", err)
+	}
+	return token, path, nil
+}
+
+// readToken reads the token of the control API listening on an address.
+func readToken(address string) (string, error) {
+	path, err := TokenPath(address)
+	if err != nil {
+		return "", err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsPermission(err) {
+			return "", fmt.Errorf("cannot read control API token %s; run as the user the tunnel was started as", path)
+		}
+		return "", fmt.Errorf("failed to read control API token (is the tunnel running?): %w", err)
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// newRequest creates a request to the control API on an address, carrying
+// its token.
+func newRequest(method, address, path string) (*http.Request, error) {
+	token, err := readToken(address)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest(method, fmt.Sprintf("http://%s%s", address, path), nil)
+	if err != nil {
+		return nil, fmt.Errorf("invalid control address '%s': %w", address, err)
+	}
+	req.Header.Set(TokenHeader, token)
+	return req, nil
+}
+
+// authorize wraps the control API handler, rejecting requests whose Host is
+// not the listen address, which DNS rebinding pages send, and requests
+// without the token.
+func (s *Server) authorize(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !s.hosts[r.Host] {
+			http.Error(w, "invalid Host header", http.StatusForbidden)
+			return
+		}
+		token := r.Header.Get(TokenHeader)
+		if subtle.ConstantTimeCompare([]byte(token), []byte(s.token)) != 1 {
+			http.Error(w, "missing or invalid "+TokenHeader+" header", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
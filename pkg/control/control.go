@@ -0,0 +1,478 @@
+// Package control provides the local control API of a running Tunn instance.
+//
+// The control API is a small HTTP server bound to a loopback address. It lets
+// other Tunn commands, such as "tunn status", inspect a tunnel that is running
+// in another process without attaching to its terminal.
+//
+// Every request must name the listen address in its Host header and carry the
+// token of the running tunnel in the X-Tunn-Token header. The token is created
+// anew at each start and stored in a file only its user can read (see
+// TokenPath), so other local users and web pages, including those using DNS
+// rebinding, cannot use the API.
+//
+// Endpoints:
+//   - GET /status: Tunnel status as JSON; add ?net=1 for socket statistics
+//   - GET /latency: Recent connect and first-byte latency percentiles per
+//     destination as JSON, the slowest to connect to first
+//   - POST /debug: Switch debug logging on (?enabled=true), off (?enabled=false)
+//     or toggle it (no parameter); answers {"debug": bool}
+//   - POST /reload: Load the configuration file again and apply the changes;
+//     answers 204 No Content, or the reason as text when the reload fails.
+//     With ?dryRun=1 nothing is applied, and the changes a reload would make
+//     are answered as JSON
+//   - GET /debug/pprof/: Runtime profiles in the format of net/http/pprof,
+//     e.g. /debug/pprof/profile?seconds=30 for CPU or /debug/pprof/heap;
+//     only served when profiling is enabled
+package control
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"tunn/pkg/debuglog"
+	"tunn/pkg/stats"
+)
+
+// Status describes the state of a running tunnel.
+type Status struct {
+	Mode       string            `json:"mode"`       // Tunnel mode: "direct" or "proxy"
+	ProxyType  string            `json:"proxyType"`  // Local proxy protocol
+	ListenPort int               `json:"listenPort"` // Local proxy port
+	Uptime     time.Duration     `json:"uptime"`     // Time since the tunnel was started
+	Stats      stats.Snapshot    `json:"stats"`      // Traffic and connection counters
+	Transports []TransportStatus `json:"transports"` // Live SSH transports, the active one first
+	Resources  stats.Resources   `json:"resources"`  // Goroutines, descriptors and channels held by the tunnel
+	Debug      bool              `json:"debug"`      // Whether debug logging is on
+}
+
+// TransportStatus describes one live SSH transport.
+type TransportStatus struct {
+	Name        string            `json:"name"`                  // Uplink name
+	Server      string            `json:"server,omitempty"`      // Failover server the transport is connected to
+	Active      bool              `json:"active"`                // Whether the transport carries new connections
+	Channels    int64             `json:"channels"`              // Channels currently open on the transport
+	LocalAddr   string            `json:"localAddr"`             // Local address of the transport connection
+	RemoteAddr  string            `json:"remoteAddr"`            // Remote address of the transport connection
+	Socket      *stats.SocketInfo `json:"socket,omitempty"`      // Kernel socket statistics (only with ?net=1)
+	SocketError string            `json:"socketError,omitempty"` // Why socket statistics are unavailable
+}
+
+// ReloadPlan describes what reloading the configuration file would change in
+// a running tunnel.
+type ReloadPlan struct {
+	Changed    []string `json:"changed"`    // Top-level settings that differ from the running configuration
+	Transports bool     `json:"transports"` // Whether the SSH transports are re-established
+	Restart    []string `json:"restart"`    // Listeners that are restarted, e.g. "proxy"
+	Fixed      []string `json:"fixed"`      // Changed settings that only apply after a restart
+}
+
+// Provider supplies the status reported by the control API.
+type Provider interface {
+	// Status returns the current tunnel status, including socket statistics
+	// for each transport when withNet is true.
+	Status(withNet bool) Status
+
+	// Latency returns the recent latencies of every destination, the
+	// slowest to connect to first.
+	Latency() []stats.DestinationLatency
+
+	// Reload loads the configuration file again and applies the changes.
+	Reload() error
+
+	// PlanReload loads the configuration file again and reports what Reload
+	// would change, without applying anything.
+	PlanReload() (*ReloadPlan, error)
+}
+
+// Server serves the control API for a Provider.
+type Server struct {
+	provider  Provider        // Source of the reported status
+	profiling bool            // Whether runtime profiles are served
+	server    *http.Server    // HTTP server, set once started
+	token     string          // Token every request must carry
+	tokenPath string          // File the token is stored in
+	hosts     map[string]bool // Host headers accepted, the listen address
+}
+
+// NewServer creates a control API server for the given provider.
+//
+// Parameters:
+//   - provider: The source of the reported status
+//
+// Returns:
+//   - *Server: A server ready to be started
+func NewServer(provider Provider) *Server {
+	return &Server{provider: provider}
+}
+
+// EnableProfiling makes the server serve the runtime profiles under
+// /debug/pprof/. It must be called before Start.
+func (s *Server) EnableProfiling() {
+	s.profiling = true
+}
+
+// Start binds the control API to a loopback address, writes a new token to
+// its token file and serves it in the background.
+//
+// Parameters:
+//   - address: Listen address in "host:port" format; the host must be a loopback address
+//
+// Returns:
+//   - error: An error if the address is not loopback, cannot be bound or the
+//     token cannot be written
+func (s *Server) Start(address string) error {
+	if err := checkLoopback(address); err != nil {
+		return err
+	}
+
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return fmt.Errorf("failed to start control API: %w", err)
+	}
+	if s.token, s.tokenPath, err = writeToken(address); err != nil {
+		listener.Close()
+		return err
+	}
+	s.hosts = map[string]bool{address: true, listener.Addr().String(): true}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /status", s.handleStatus)
+	mux.HandleFunc("GET /latency", s.handleLatency)
+	mux.HandleFunc("POST /debug", s.handleDebug)
+	mux.HandleFunc("POST /reload", s.handleReload)
+	if s.profiling {
+		// The command line is left out, it may hold a config URL with a token
+		mux.HandleFunc("GET /debug/pprof/", pprof.Index)
+		mux.HandleFunc("GET /debug/pprof/profile", pprof.Profile)
+		mux.HandleFunc("GET /debug/pprof/symbol", pprof.Symbol)
+		mux.HandleFunc("GET /debug/pprof/trace", pprof.Trace)
+	}
+	s.server = &http.Server{Handler: s.authorize(mux), ReadHeaderTimeout: 5 * time.Second}
+
+	go s.server.Serve(listener)
+	fmt.Printf("✓ Control API listening on %s\n", listener.Addr())
+	if s.profiling {
+		fmt.Printf("✓ Runtime profiles served at http://%s/debug/pprof/ (capture them with \"tunn pprof\")\n", listener.Addr())
+	}
+	return nil
+}
+
+// Close stops the control API server and removes its token file.
+//
+// Returns:
+//   - error: An error if closing the listener fails
+func (s *Server) Close() error {
+	if s.server == nil {
+		return nil
+	}
+	os.Remove(s.tokenPath)
+	return s.server.Close()
+}
+
+// handleStatus writes the current status as JSON.
+func (s *Server) handleStatus(w http.ResponseWriter, r *http.Request) {
+	withNet := r.URL.Query().Get("net") != ""
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.provider.Status(withNet))
+}
+
+// handleLatency writes the per-destination latencies as JSON.
+func (s *Server) handleLatency(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.provider.Latency())
+}
+
+// handleDebug switches debug logging and writes the resulting state as JSON.
+func (s *Server) handleDebug(w http.ResponseWriter, r *http.Request) {
+	enabled := !debuglog.Enabled()
+	if value := r.URL.Query().Get("enabled"); value != "" {
+		var err error
+		if enabled, err = strconv.ParseBool(value); err != nil {
+			http.Error(w, "invalid enabled parameter", http.StatusBadRequest)
+			return
+		}
+	}
+	debuglog.SetEnabled(enabled)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]bool{"debug": enabled})
+}
+
+// handleReload reloads the configuration and reports whether that succeeded,
+// or with ?dryRun=1 reports what a reload would change.
+func (s *Server) handleReload(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Query().Get("dryRun") != "" {
+		plan, err := s.provider.PlanReload()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(plan)
+		return
+	}
+	if err := s.provider.Reload(); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// checkLoopback verifies that a control address binds only to the local machine.
+//
+// Parameters:
+//   - address: Address in "host:port" format
+//
+// Returns:
+//   - error: An error if the address is malformed or not a loopback address
+func checkLoopback(address string) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return fmt.Errorf("invalid control address '%s': %w", address, err)
+	}
+	if host == "localhost" {
+		return nil
+	}
+	if ip := net.ParseIP(host); ip == nil || !ip.IsLoopback() {
+		return fmt.Errorf("control address '%s' must be a loopback address", address)
+	}
+	return nil
+}
+
+// Fetch queries the status of a running tunnel through its control API.
+//
+// Parameters:
+//   - address: The control API address
+//   - withNet: Whether to request socket statistics
+//
+// Returns:
+//   - *Status: The reported status
+//   - error: An error if the tunnel cannot be reached or the response is invalid
+func Fetch(address string, withNet bool) (*Status, error) {
+	path := "/status"
+	if withNet {
+		path += "?net=1"
+	}
+	req, err := newRequest(http.MethodGet, address, path)
+	if err != nil {
+		return nil, err
+	}
+
+	client := &http.Client{Timeout: 5 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to reach control API at %s: %w", address, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("control API returned %s", resp.Status)
+	}
+
+	status := &Status{}
+	if err := json.NewDecoder(resp.Body).Decode(status); err != nil {
+		return nil, fmt.Errorf("invalid control API response: %w", err)
+	}
+	return status, nil
+}
+
+// FetchLatency queries the per-destination latencies of a running tunnel
+// through its control API.
+//
+// Parameters:
+//   - address: The control API address
+//
+// Returns:
+//   - []stats.DestinationLatency: The latencies, the slowest to connect to first
+//   - error: An error if the tunnel cannot be reached or the response is invalid
+func FetchLatency(address string) ([]stats.DestinationLatency, error) {
+	req, err := newRequest(http.MethodGet, address, "/latency")
+	if err != nil {
+		return nil, err
+	}
+
+	client := &http.Client{Timeout: 5 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to reach control API at %s: %w", address, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("control API returned %s", resp.Status)
+	}
+
+	var latency []stats.DestinationLatency
+	if err := json.NewDecoder(resp.Body).Decode(&latency); err != nil {
+		return nil, fmt.Errorf("invalid control API response: %w", err)
+	}
+	return latency, nil
+}
+
+// SetDebug switches debug logging of a running tunnel through its control API.
+//
+// Parameters:
+//   - address: The control API address
+//   - enabled: "true" or "false", or "" to toggle
+//
+// Returns:
+//   - bool: Whether debug logging is now on
+//   - error: An error if the tunnel cannot be reached or refuses the request
+func SetDebug(address, enabled string) (bool, error) {
+	path := "/debug"
+	if enabled != "" {
+		path += "?enabled=" + url.QueryEscape(enabled)
+	}
+	req, err := newRequest(http.MethodPost, address, path)
+	if err != nil {
+		return false, err
+	}
+
+	client := &http.Client{Timeout: 5 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return false, fmt.Errorf("failed to reach control API at %s: %w", address, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return false, fmt.Errorf("control API returned %s", resp.Status)
+	}
+
+	var state struct {
+		Debug bool `json:"debug"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&state); err != nil {
+		return false, fmt.Errorf("invalid control API response: %w", err)
+	}
+	return state.Debug, nil
+}
+
+// Reload makes a running tunnel load its configuration file again through its
+// control API.
+//
+// Parameters:
+//   - address: The control API address
+//
+// Returns:
+//   - error: An error if the tunnel cannot be reached or the reload fails
+func Reload(address string) error {
+	req, err := newRequest(http.MethodPost, address, "/reload")
+	if err != nil {
+		return err
+	}
+
+	// Reconnecting with new settings can take a while
+	client := &http.Client{Timeout: 2 * time.Minute}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to reach control API at %s: %w", address, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNoContent {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		if text := strings.TrimSpace(string(message)); text != "" && resp.StatusCode == http.StatusInternalServerError {
+			return errors.New(text)
+		}
+		return fmt.Errorf("control API returned %s", resp.Status)
+	}
+	return nil
+}
+
+// PlanReload asks a running tunnel what reloading its configuration file would
+// change, without applying anything.
+//
+// Parameters:
+//   - address: The control API address
+//
+// Returns:
+//   - *ReloadPlan: The changes a reload would make
+//   - error: An error if the tunnel cannot be reached or the file cannot be loaded
+func PlanReload(address string) (*ReloadPlan, error) {
+	req, err := newRequest(http.MethodPost, address, "/reload?dryRun=1")
+	if err != nil {
+		return nil, err
+	}
+
+	// Remote config files are fetched again
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to reach control API at %s: %w", address, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		if text := strings.TrimSpace(string(message)); text != "" && resp.StatusCode == http.StatusInternalServerError {
+			return nil, errors.New(text)
+		}
+		return nil, fmt.Errorf("control API returned %s", resp.Status)
+	}
+
+	plan := &ReloadPlan{}
+	if err := json.NewDecoder(resp.Body).Decode(plan); err != nil {
+		return nil, fmt.Errorf("invalid control API response: %w", err)
+	}
+	return plan, nil
+}
+
+// FetchProfile captures a runtime profile of a running tunnel through its
+// control API, which must serve profiles (control.pprof).
+//
+// Parameters:
+//   - address: The control API address
+//   - name: The profile, e.g. "profile" (CPU), "heap", "goroutine" or "trace"
+//   - seconds: How long CPU profiles and traces are collected; other
+//     profiles are snapshots
+//
+// Returns:
+//   - []byte: The profile in pprof format, or a trace for "trace"
+//   - error: An error if the tunnel cannot be reached or does not serve profiles
+func FetchProfile(address, name string, seconds int) ([]byte, error) {
+	path := "/debug/pprof/" + name
+	if name == "profile" || name == "trace" {
+		path += fmt.Sprintf("?seconds=%d", seconds)
+	}
+	req, err := newRequest(http.MethodGet, address, path)
+	if err != nil {
+		return nil, err
+	}
+
+	client := &http.Client{Timeout: time.Duration(seconds)*time.Second + 30*time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to reach control API at %s: %w", address, err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return nil, fmt.Errorf("the tunnel does not serve profiles; set control.pprof in its config and restart it")
+	default:
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		if text := strings.TrimSpace(string(message)); text != "" {
+			return nil, fmt.Errorf("control API returned %s: %s", resp.Status, text)
+		}
+		return nil, fmt.Errorf("control API returned %s", resp.Status)
+	}
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read profile: %w", err)
+	}
+	return data, nil
+}
@@ -0,0 +1,70 @@
+// Package debuglog provides debug logging that can be switched on and off
+// while Tunn is running.
+//
+// Debug lines add detail to the regular output, such as the bytes carried by
+// each SSH channel, the headers of proxied HTTP requests or keepalive round
+// trips, which helps capturing intermittent problems. Since they are too
+// verbose to keep on all the time, a running instance toggles them on SIGUSR1
+// (Unix) or through the control API, without restarting. While enabled, the
+// detailed connection log of the plain format is printed as well.
+package debuglog
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"sync"
+	"sync/atomic"
+
+	"tunn/pkg/color"
+)
+
+// enabled reports whether debug lines are printed.
+var enabled atomic.Bool
+
+// SetEnabled switches debug logging on or off for the whole process.
+//
+// Parameters:
+//   - on: Whether debug lines are printed
+func SetEnabled(on bool) {
+	if enabled.Swap(on) != on {
+		state := "disabled"
+		if on {
+			state = "enabled"
+		}
+		fmt.Printf("%s Debug logging %s\n", color.Glyph("→"), state)
+	}
+}
+
+// Enabled reports whether debug logging is on.
+func Enabled() bool {
+	return enabled.Load()
+}
+
+// Printf prints a debug line when debug logging is on. Callers redact
+// secrets as for regular output.
+func Printf(format string, args ...any) {
+	if enabled.Load() {
+		fmt.Printf("  · "+format, args...)
+	}
+}
+
+// watchOnce makes WatchSignal idempotent.
+var watchOnce sync.Once
+
+// WatchSignal toggles debug logging whenever the process receives the
+// toggle signal, SIGUSR1 on Unix. It does nothing on other systems.
+func WatchSignal() {
+	if toggleSignal == nil {
+		return
+	}
+	watchOnce.Do(func() {
+		sigChan := make(chan os.Signal, 1)
+		signal.Notify(sigChan, toggleSignal)
+		go func() {
+			for range sigChan {
+				SetEnabled(!enabled.Load())
+			}
+		}()
+	})
+}
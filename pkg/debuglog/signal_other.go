@@ -0,0 +1,9 @@
+//go:build !unix
+
+package debuglog
+
+import "os"
+
+// toggleSignal is nil where SIGUSR1 does not exist; the control API still
+// toggles debug logging.
+var toggleSignal os.Signal
@@ -0,0 +1,11 @@
+//go:build unix
+
+package debuglog
+
+import (
+	"os"
+	"syscall"
+)
+
+// toggleSignal switches debug logging on and off.
+var toggleSignal os.Signal = syscall.SIGUSR1
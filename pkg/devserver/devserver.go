@@ -0,0 +1,271 @@
+// Package devserver implements a local test server for developing payloads.
+//
+// The server accepts raw TCP connections, prints each request head it receives
+// exactly as sent, and answers with a configurable response: a WebSocket
+// upgrade (101), a plain status such as 200 or 403, or a redirect, optionally
+// after a delay. Upgraded and 2xx connections are then relayed to a forward
+// address such as a local SSH server, or echoed back when none is set.
+//
+// This allows payloads and client behavior to be exercised without a real
+// server, and the Server type can be started from tests.
+package devserver
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"tunn/pkg/connection"
+)
+
+// maxHeadSize bounds the size of a request head.
+const maxHeadSize = 64 << 10
+
+// Sec-WebSocket-Accept behaviors for 101 responses.
+const (
+	AcceptAuto  = "auto"  // Correct value when the request carries a key, omitted otherwise
+	AcceptNone  = "none"  // Never send the header
+	AcceptWrong = "wrong" // Send an incorrect value
+)
+
+// Options controls how the server responds.
+type Options struct {
+	Status   int                                      // Response status code (default: 101)
+	Location string                                   // Location header for 3xx responses
+	Delay    time.Duration                            // Delay before the response headers are sent
+	Accept   string                                   // Sec-WebSocket-Accept behavior (default: AcceptAuto)
+	Forward  string                                   // Address to relay upgraded connections to; empty echoes
+	Logf     func(format string, args ...interface{}) // Log output (default: fmt.Printf)
+}
+
+// Server is a running test server.
+type Server struct {
+	opts     Options
+	listener net.Listener
+
+	mu    sync.Mutex
+	conns map[net.Conn]struct{} // Open client connections, closed by Close
+	wg    sync.WaitGroup
+}
+
+// Start listens on an address and serves connections in the background.
+//
+// Parameters:
+//   - address: The listen address, e.g. "127.0.0.1:8880" or "127.0.0.1:0"
+//   - opts: The response settings
+//
+// Returns:
+//   - *Server: The running server
+//   - error: An error if the options are invalid or listening fails
+func Start(address string, opts Options) (*Server, error) {
+	if opts.Status == 0 {
+		opts.Status = http.StatusSwitchingProtocols
+	}
+	if opts.Status < 100 || opts.Status > 599 {
+		return nil, fmt.Errorf("invalid status code %d", opts.Status)
+	}
+	switch opts.Accept {
+	case "":
+		opts.Accept = AcceptAuto
+	case AcceptAuto, AcceptNone, AcceptWrong:
+	default:
+		return nil, fmt.Errorf("invalid accept mode '%s', must be one of: auto, none, wrong", opts.Accept)
+	}
+	if opts.Logf == nil {
+		opts.Logf = func(format string, args ...interface{}) { fmt.Printf(format, args...) }
+	}
+
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on %s: %w", address, err)
+	}
+
+	s := &Server{opts: opts, listener: listener, conns: make(map[net.Conn]struct{})}
+	s.wg.Add(1)
+	go s.serve()
+	return s, nil
+}
+
+// Addr returns the address the server listens on.
+func (s *Server) Addr() net.Addr {
+	return s.listener.Addr()
+}
+
+// Close stops the server, closes all connections and waits for their handlers.
+func (s *Server) Close() error {
+	err := s.listener.Close()
+
+	s.mu.Lock()
+	for conn := range s.conns {
+		conn.Close()
+	}
+	s.mu.Unlock()
+
+	s.wg.Wait()
+	return err
+}
+
+// serve accepts connections until the listener is closed.
+func (s *Server) serve() {
+	defer s.wg.Done()
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			time.Sleep(100 * time.Millisecond)
+			continue
+		}
+
+		s.mu.Lock()
+		s.conns[conn] = struct{}{}
+		s.mu.Unlock()
+
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			defer func() {
+				s.mu.Lock()
+				delete(s.conns, conn)
+				s.mu.Unlock()
+				conn.Close()
+			}()
+			s.handle(conn)
+		}()
+	}
+}
+
+// handle reads one request head, responds and relays the connection if the
+// response keeps it open.
+func (s *Server) handle(conn net.Conn) {
+	logf := s.opts.Logf
+	reader := bufio.NewReader(conn)
+
+	conn.SetReadDeadline(time.Now().Add(30 * time.Second))
+	head, err := readHead(reader)
+	if err != nil {
+		logf("✗ %s: failed to read request: %v\n", conn.RemoteAddr(), err)
+		return
+	}
+	conn.SetReadDeadline(time.Time{})
+
+	logf("← Request from %s (%d bytes):\n", conn.RemoteAddr(), len(head))
+	for _, line := range strings.SplitAfter(string(head), "\n") {
+		if line != "" {
+			logf("  %q\n", line)
+		}
+	}
+
+	if s.opts.Delay > 0 {
+		logf("→ Delaying response by %v\n", s.opts.Delay)
+		time.Sleep(s.opts.Delay)
+	}
+
+	response := s.response(head)
+	if _, err := conn.Write([]byte(response)); err != nil {
+		logf("✗ Failed to send response: %v\n", err)
+		return
+	}
+	logf("→ Sent %s\n", strings.SplitN(response, "\r\n", 2)[0])
+
+	if s.opts.Status != http.StatusSwitchingProtocols && s.opts.Status/100 != 2 {
+		return
+	}
+
+	// Bytes the client sent after the head are already buffered in reader
+	client := struct {
+		io.Reader
+		io.Writer
+	}{reader, conn}
+
+	if s.opts.Forward == "" {
+		n, _ := io.Copy(client, client)
+		logf("→ Echoed %d bytes, connection closed\n", n)
+		return
+	}
+
+	upstream, err := net.DialTimeout("tcp", s.opts.Forward, 10*time.Second)
+	if err != nil {
+		logf("✗ Failed to connect to %s: %v\n", s.opts.Forward, err)
+		return
+	}
+	defer upstream.Close()
+
+	done := make(chan struct{})
+	go func() {
+		io.Copy(upstream, client)
+		upstream.Close()
+		close(done)
+	}()
+	io.Copy(conn, upstream)
+	conn.Close()
+	<-done
+	logf("→ Relay to %s closed\n", s.opts.Forward)
+}
+
+// response builds the response head for a request head.
+func (s *Server) response(head []byte) string {
+	status := s.opts.Status
+	var b strings.Builder
+	fmt.Fprintf(&b, "HTTP/1.1 %d %s\r\n", status, http.StatusText(status))
+
+	switch {
+	case status == http.StatusSwitchingProtocols:
+		b.WriteString("Upgrade: websocket\r\nConnection: Upgrade\r\n")
+		key := requestHeader(head, "Sec-WebSocket-Key")
+		switch {
+		case s.opts.Accept == AcceptWrong:
+			b.WriteString("Sec-WebSocket-Accept: " + connection.WebSocketAccept(key+"x") + "\r\n")
+		case s.opts.Accept == AcceptAuto && key != "":
+			b.WriteString("Sec-WebSocket-Accept: " + connection.WebSocketAccept(key) + "\r\n")
+		}
+	case status/100 == 2:
+	default:
+		if status/100 == 3 && s.opts.Location != "" {
+			b.WriteString("Location: " + s.opts.Location + "\r\n")
+		}
+		b.WriteString("Content-Length: 0\r\nConnection: close\r\n")
+	}
+
+	b.WriteString("\r\n")
+	return b.String()
+}
+
+// readHead reads up to and including the first empty line.
+func readHead(r *bufio.Reader) ([]byte, error) {
+	var head []byte
+	for {
+		line, err := r.ReadSlice('\n')
+		head = append(head, line...)
+		if err != nil && !errors.Is(err, bufio.ErrBufferFull) {
+			return nil, err
+		}
+		if len(head) > maxHeadSize {
+			return nil, fmt.Errorf("request head exceeds %d bytes", maxHeadSize)
+		}
+		if bytes.HasSuffix(head, []byte("\r\n\r\n")) {
+			return head, nil
+		}
+	}
+}
+
+// requestHeader returns the value of the last header with the given name in a
+// request head, or an empty string if it is missing.
+func requestHeader(head []byte, name string) string {
+	var value string
+	for _, line := range strings.Split(string(head), "\r\n") {
+		key, v, ok := strings.Cut(line, ":")
+		if ok && strings.EqualFold(strings.TrimSpace(key), name) {
+			value = strings.TrimSpace(v)
+		}
+	}
+	return value
+}
@@ -0,0 +1,549 @@
+// Package dns implements a local DNS resolver that answers through the tunnel.
+//
+// The resolver listens on UDP and TCP and decides for each query which handler
+// answers it, checking in order:
+//
+//  1. Static records: names configured with a fixed address are answered
+//     locally, like entries in a hosts file
+//  2. Per-domain rules: a domain and its subdomains are either blocked or
+//     forwarded to a specific resolver, through the tunnel or directly
+//  3. Blocklists: listed domains are answered with NXDOMAIN
+//  4. Everything else is forwarded to the default upstream resolver through
+//     the tunnel
+//
+// Forwarded queries are sent over DNS-over-TCP, since SSH channels only carry
+// TCP; each query opens its own connection to the upstream resolver.
+//
+// LookupDoH resolves names with a DNS-over-HTTPS resolver instead, for the
+// server hostnames that must be known before the tunnel exists.
+package dns
+
+import (
+	"cmp"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/netip"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"tunn/pkg/blocklist"
+	"tunn/pkg/clientfilter"
+	"tunn/pkg/debuglog"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// staticTTL is the TTL of answers from static records, in seconds.
+const staticTTL = 60
+
+// minUDPSize is the largest UDP response a client without EDNS accepts.
+const minUDPSize = 512
+
+// Dialer opens connections through the tunnel.
+type Dialer interface {
+	Dial(network, address string) (net.Conn, error)
+}
+
+// Rule is a handler for a domain and its subdomains.
+type Rule struct {
+	Domain   string // Lowercase domain without a trailing dot
+	Block    bool   // Answer with NXDOMAIN instead of forwarding
+	Upstream string // Resolver address for forwarded queries
+	Direct   bool   // Reach Upstream directly rather than through the tunnel
+}
+
+// Options configures a resolver.
+type Options struct {
+	Upstream string                  // Default resolver, reached through the tunnel
+	Hosts    map[string][]netip.Addr // Static records by lowercase name
+	Rules    []Rule                  // Per-domain handlers; the most specific domain wins
+	Blocked  *blocklist.Set          // Domains answered with NXDOMAIN (may be nil)
+	Dialer   Dialer                  // Tunnel dialer for forwarded queries
+	Timeout  time.Duration           // Timeout for forwarded queries (default: 10s)
+	Clients  *clientfilter.Filter    // Clients that may query the resolver (nil admits all)
+}
+
+// Server is a running resolver.
+type Server struct {
+	opts    Options
+	blocked atomic.Pointer[blocklist.Set]
+
+	udp net.PacketConn
+	tcp net.Listener
+
+	mu    sync.Mutex
+	conns map[net.Conn]struct{} // Open TCP client connections, closed by Close
+	wg    sync.WaitGroup
+}
+
+// Start listens on UDP and TCP at an address and serves queries in the background.
+//
+// Parameters:
+//   - address: The listen address, e.g. "127.0.0.1:5353"
+//   - opts: The handlers and upstream settings
+//
+// Returns:
+//   - *Server: The running resolver
+//   - error: An error if either listener cannot be bound
+func Start(address string, opts Options) (*Server, error) {
+	if opts.Timeout == 0 {
+		opts.Timeout = 10 * time.Second
+	}
+
+	udp, err := net.ListenPacket("udp", address)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start DNS resolver: %w", err)
+	}
+	tcp, err := net.Listen("tcp", udp.LocalAddr().String())
+	if err != nil {
+		udp.Close()
+		return nil, fmt.Errorf("failed to start DNS resolver: %w", err)
+	}
+	tcp = clientfilter.Listen(tcp, opts.Clients, "DNS resolver")
+
+	s := &Server{opts: opts, udp: udp, tcp: tcp, conns: make(map[net.Conn]struct{})}
+	s.blocked.Store(opts.Blocked)
+	s.wg.Add(2)
+	go s.serveUDP()
+	go s.serveTCP()
+	return s, nil
+}
+
+// Addr returns the address the resolver listens on.
+func (s *Server) Addr() net.Addr {
+	return s.udp.LocalAddr()
+}
+
+// SetBlocked replaces the blocklist, for example after the lists were updated.
+//
+// Parameters:
+//   - set: The new set of blocked domains (may be nil)
+func (s *Server) SetBlocked(set *blocklist.Set) {
+	s.blocked.Store(set)
+}
+
+// Close stops the resolver and waits for pending queries.
+func (s *Server) Close() error {
+	err := s.udp.Close()
+	s.tcp.Close()
+
+	s.mu.Lock()
+	for conn := range s.conns {
+		conn.Close()
+	}
+	s.mu.Unlock()
+
+	s.wg.Wait()
+	return err
+}
+
+// serveUDP answers UDP queries until the socket is closed.
+func (s *Server) serveUDP() {
+	defer s.wg.Done()
+	buf := make([]byte, 65535)
+	for {
+		n, addr, err := s.udp.ReadFrom(buf)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			continue
+		}
+		// Refused clients get no answer, as a reply could be used to reflect
+		// traffic at a spoofed address
+		if !s.opts.Clients.Permits(addr) {
+			continue
+		}
+		query := append([]byte(nil), buf[:n]...)
+
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			resp := s.answer(query)
+			if resp == nil {
+				return
+			}
+			if len(resp) > udpSize(query) {
+				resp = truncate(resp)
+			}
+			s.udp.WriteTo(resp, addr)
+		}()
+	}
+}
+
+// serveTCP accepts TCP clients until the listener is closed.
+func (s *Server) serveTCP() {
+	defer s.wg.Done()
+	for {
+		conn, err := s.tcp.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			time.Sleep(100 * time.Millisecond)
+			continue
+		}
+
+		s.mu.Lock()
+		s.conns[conn] = struct{}{}
+		s.mu.Unlock()
+
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			defer func() {
+				s.mu.Lock()
+				delete(s.conns, conn)
+				s.mu.Unlock()
+				conn.Close()
+			}()
+			s.handleTCP(conn)
+		}()
+	}
+}
+
+// handleTCP answers length-prefixed queries on a TCP connection in turn,
+// closing it when idle for 30 seconds.
+func (s *Server) handleTCP(conn net.Conn) {
+	for {
+		conn.SetReadDeadline(time.Now().Add(30 * time.Second))
+		query, err := readMessage(conn)
+		if err != nil {
+			return
+		}
+		resp := s.answer(query)
+		if resp == nil {
+			return
+		}
+		if err := writeMessage(conn, resp); err != nil {
+			return
+		}
+	}
+}
+
+// answer returns the response to a query, or nil if the query is too
+// malformed to answer.
+func (s *Server) answer(query []byte) []byte {
+	var p dnsmessage.Parser
+	header, err := p.Start(query)
+	if err != nil {
+		return nil
+	}
+	question, err := p.Question()
+	if err != nil {
+		resp, _ := reply(header, nil, dnsmessage.RCodeFormatError, nil)
+		return resp
+	}
+	name := strings.TrimSuffix(strings.ToLower(question.Name.String()), ".")
+
+	if addrs, ok := s.opts.Hosts[name]; ok {
+		resp, _ := reply(header, &question, dnsmessage.RCodeSuccess, addrs)
+		return resp
+	}
+
+	upstream, direct := s.opts.Upstream, false
+	if rule := s.match(name); rule != nil {
+		if rule.Block {
+			resp, _ := reply(header, &question, dnsmessage.RCodeNameError, nil)
+			return resp
+		}
+		upstream, direct = rule.Upstream, rule.Direct
+	} else if s.blocked.Load().Contains(name) {
+		resp, _ := reply(header, &question, dnsmessage.RCodeNameError, nil)
+		return resp
+	}
+
+	start := time.Now()
+	resp, err := s.forward(query, upstream, direct)
+	if err != nil {
+		fmt.Printf("✗ DNS query for %s via %s failed: %v\n", name, upstream, err)
+		resp, _ = reply(header, &question, dnsmessage.RCodeServerFailure, nil)
+	} else {
+		debuglog.Printf("DNS %s %s via %s answered in %s\n", question.Type, name, upstream, time.Since(start).Round(time.Millisecond))
+	}
+	return resp
+}
+
+// LookupNetIP resolves a hostname the way a query to the resolver would be
+// answered, applying static records, rules and blocklists, so Tunn's own
+// lookups go through the tunnel like those of its clients. Its signature
+// matches net.Resolver's.
+//
+// Parameters:
+//   - ctx: Cancels waiting for the answers
+//   - network: "ip" for both families, "ip4" or "ip6"
+//   - host: The hostname; an IP address is returned as is
+//
+// Returns:
+//   - []netip.Addr: The addresses of the host
+//   - error: An error if no address was found
+func (s *Server) LookupNetIP(ctx context.Context, network, host string) ([]netip.Addr, error) {
+	if addr, err := netip.ParseAddr(host); err == nil {
+		return []netip.Addr{addr}, nil
+	}
+	name, err := dnsmessage.NewName(strings.TrimSuffix(host, ".") + ".")
+	if err != nil {
+		return nil, fmt.Errorf("invalid hostname '%s'", host)
+	}
+
+	var types []dnsmessage.Type
+	if network != "ip6" {
+		types = append(types, dnsmessage.TypeA)
+	}
+	if network != "ip4" {
+		types = append(types, dnsmessage.TypeAAAA)
+	}
+
+	type result struct {
+		addrs []netip.Addr
+		err   error
+	}
+	results := make(chan result, len(types))
+	for i, qtype := range types {
+		go func() {
+			addrs, err := s.lookup(uint16(i+1), name, qtype)
+			results <- result{addrs, err}
+		}()
+	}
+
+	var addrs []netip.Addr
+	var lastErr error
+	for range types {
+		select {
+		case r := <-results:
+			addrs, lastErr = append(addrs, r.addrs...), cmp.Or(r.err, lastErr)
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	if len(addrs) == 0 {
+		return nil, cmp.Or(lastErr, fmt.Errorf("no addresses found for %s", host))
+	}
+	return addrs, nil
+}
+
+// lookup answers a single question through answer and extracts the addresses.
+func (s *Server) lookup(id uint16, name dnsmessage.Name, qtype dnsmessage.Type) ([]netip.Addr, error) {
+	b := dnsmessage.NewBuilder(nil, dnsmessage.Header{ID: id, RecursionDesired: true})
+	b.StartQuestions()
+	b.Question(dnsmessage.Question{Name: name, Type: qtype, Class: dnsmessage.ClassINET})
+	query, err := b.Finish()
+	if err != nil {
+		return nil, err
+	}
+
+	var p dnsmessage.Parser
+	header, err := p.Start(s.answer(query))
+	if err != nil {
+		return nil, fmt.Errorf("invalid response for %s", name)
+	}
+	if header.RCode != dnsmessage.RCodeSuccess {
+		return nil, fmt.Errorf("lookup of %s failed: %s", name, header.RCode)
+	}
+	addrs, err := answerAddrs(&p)
+	if err != nil {
+		return nil, fmt.Errorf("invalid response for %s", name)
+	}
+	return addrs, nil
+}
+
+// answerAddrs extracts the A and AAAA records from the answers of a response
+// whose header was read, skipping other records such as CNAMEs.
+//
+// Parameters:
+//   - p: The parser positioned at the questions
+//
+// Returns:
+//   - []netip.Addr: The addresses, as far as the answers could be read
+//   - error: An error if the questions cannot be skipped
+func answerAddrs(p *dnsmessage.Parser) ([]netip.Addr, error) {
+	if err := p.SkipAllQuestions(); err != nil {
+		return nil, err
+	}
+
+	var addrs []netip.Addr
+	for {
+		h, err := p.AnswerHeader()
+		if err != nil {
+			break
+		}
+		switch h.Type {
+		case dnsmessage.TypeA:
+			r, err := p.AResource()
+			if err != nil {
+				return addrs, nil
+			}
+			addrs = append(addrs, netip.AddrFrom4(r.A))
+		case dnsmessage.TypeAAAA:
+			r, err := p.AAAAResource()
+			if err != nil {
+				return addrs, nil
+			}
+			addrs = append(addrs, netip.AddrFrom16(r.AAAA))
+		default:
+			if err := p.SkipAnswer(); err != nil {
+				return addrs, nil
+			}
+		}
+	}
+	return addrs, nil
+}
+
+// match returns the rule for the most specific domain containing name, or nil.
+func (s *Server) match(name string) *Rule {
+	var best *Rule
+	for i := range s.opts.Rules {
+		rule := &s.opts.Rules[i]
+		if name == rule.Domain || strings.HasSuffix(name, "."+rule.Domain) {
+			if best == nil || len(rule.Domain) > len(best.Domain) {
+				best = rule
+			}
+		}
+	}
+	return best
+}
+
+// forward sends a query to an upstream resolver over TCP and returns its response.
+func (s *Server) forward(query []byte, upstream string, direct bool) ([]byte, error) {
+	var conn net.Conn
+	var err error
+	if direct {
+		conn, err = net.DialTimeout("tcp", upstream, s.opts.Timeout)
+	} else {
+		conn, err = s.opts.Dialer.Dial("tcp", upstream)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	// SSH channels do not support deadlines, so the timeout closes the connection
+	timer := time.AfterFunc(s.opts.Timeout, func() { conn.Close() })
+	defer timer.Stop()
+
+	if err := writeMessage(conn, query); err != nil {
+		return nil, err
+	}
+	resp, err := readMessage(conn)
+	if err != nil {
+		if !timer.Stop() {
+			return nil, fmt.Errorf("no response within %s", s.opts.Timeout)
+		}
+		return nil, err
+	}
+	return resp, nil
+}
+
+// reply builds a response to a query with the given code and, for A and AAAA
+// questions, the addresses of the matching family as answers.
+func reply(query dnsmessage.Header, question *dnsmessage.Question, rcode dnsmessage.RCode, addrs []netip.Addr) ([]byte, error) {
+	b := dnsmessage.NewBuilder(nil, dnsmessage.Header{
+		ID:                 query.ID,
+		Response:           true,
+		OpCode:             query.OpCode,
+		RecursionDesired:   query.RecursionDesired,
+		RecursionAvailable: true,
+		RCode:              rcode,
+	})
+	b.EnableCompression()
+	if err := b.StartQuestions(); err != nil {
+		return nil, err
+	}
+	if question == nil {
+		return b.Finish()
+	}
+	if err := b.Question(*question); err != nil {
+		return nil, err
+	}
+
+	if err := b.StartAnswers(); err != nil {
+		return nil, err
+	}
+	rh := dnsmessage.ResourceHeader{Name: question.Name, Class: dnsmessage.ClassINET, TTL: staticTTL}
+	for _, addr := range addrs {
+		var err error
+		switch {
+		case question.Type == dnsmessage.TypeA && addr.Is4():
+			err = b.AResource(rh, dnsmessage.AResource{A: addr.As4()})
+		case question.Type == dnsmessage.TypeAAAA && addr.Is6() && !addr.Is4In6():
+			err = b.AAAAResource(rh, dnsmessage.AAAAResource{AAAA: addr.As16()})
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return b.Finish()
+}
+
+// truncate reduces a response that does not fit a UDP reply to its header and
+// question with the TC bit set, so the client retries over TCP.
+func truncate(resp []byte) []byte {
+	var p dnsmessage.Parser
+	header, err := p.Start(resp)
+	if err != nil {
+		return nil
+	}
+	header.Truncated = true
+	b := dnsmessage.NewBuilder(nil, header)
+	b.StartQuestions()
+	if question, err := p.Question(); err == nil {
+		b.Question(question)
+	}
+	out, err := b.Finish()
+	if err != nil {
+		return nil
+	}
+	return out
+}
+
+// udpSize returns the largest UDP response a query's client accepts, from its
+// EDNS OPT record if present.
+func udpSize(query []byte) int {
+	var p dnsmessage.Parser
+	if _, err := p.Start(query); err != nil {
+		return minUDPSize
+	}
+	if p.SkipAllQuestions() != nil || p.SkipAllAnswers() != nil || p.SkipAllAuthorities() != nil {
+		return minUDPSize
+	}
+	for {
+		h, err := p.AdditionalHeader()
+		if err != nil {
+			return minUDPSize
+		}
+		if h.Type == dnsmessage.TypeOPT {
+			return max(int(h.Class), minUDPSize)
+		}
+		if err := p.SkipAdditional(); err != nil {
+			return minUDPSize
+		}
+	}
+}
+
+// readMessage reads a length-prefixed DNS message from a TCP stream.
+func readMessage(r io.Reader) ([]byte, error) {
+	var length [2]byte
+	if _, err := io.ReadFull(r, length[:]); err != nil {
+		return nil, err
+	}
+	msg := make([]byte, binary.BigEndian.Uint16(length[:]))
+	if _, err := io.ReadFull(r, msg); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+// writeMessage writes a length-prefixed DNS message to a TCP stream.
+func writeMessage(w io.Writer, msg []byte) error {
+	if len(msg) > 65535 {
+		return fmt.Errorf("DNS message too large")
+	}
+	_, err := w.Write(append(binary.BigEndian.AppendUint16(nil, uint16(len(msg))), msg...))
+	return err
+}
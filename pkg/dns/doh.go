@@ -0,0 +1,121 @@
+package dns
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/netip"
+	"strings"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// maxDoHResponse bounds the size of a DNS-over-HTTPS response.
+const maxDoHResponse = 64 << 10
+
+// LookupDoH resolves a hostname with a DNS-over-HTTPS resolver (RFC 8484),
+// bypassing the system resolver, which a poisoning network may answer with
+// wrong addresses.
+//
+// The A and AAAA queries are sent in parallel as POST requests. The resolver's
+// own hostname, if the URL does not use an IP address, is resolved by the
+// system resolver.
+//
+// Parameters:
+//   - ctx: Bounds the whole lookup
+//   - url: The resolver URL, e.g. "https://1.1.1.1/dns-query"
+//   - host: The hostname; an IP address is returned as is
+//
+// Returns:
+//   - []string: The addresses of the host, IPv4 addresses first
+//   - error: An error if the resolver cannot be reached or found no address
+func LookupDoH(ctx context.Context, url, host string) ([]string, error) {
+	if addr, err := netip.ParseAddr(host); err == nil {
+		return []string{addr.String()}, nil
+	}
+	name, err := dnsmessage.NewName(strings.TrimSuffix(host, ".") + ".")
+	if err != nil {
+		return nil, fmt.Errorf("invalid hostname '%s'", host)
+	}
+
+	types := []dnsmessage.Type{dnsmessage.TypeA, dnsmessage.TypeAAAA}
+	type result struct {
+		addrs []netip.Addr
+		err   error
+	}
+	results := make([]chan result, len(types))
+	for i, qtype := range types {
+		results[i] = make(chan result, 1)
+		go func() {
+			addrs, err := queryDoH(ctx, url, name, qtype)
+			results[i] <- result{addrs, err}
+		}()
+	}
+
+	var addrs []string
+	var lastErr error
+	for i := range types {
+		r := <-results[i]
+		lastErr = cmp.Or(r.err, lastErr)
+		for _, addr := range r.addrs {
+			addrs = append(addrs, addr.String())
+		}
+	}
+	if len(addrs) == 0 {
+		return nil, cmp.Or(lastErr, fmt.Errorf("no addresses found for %s", host))
+	}
+	return addrs, nil
+}
+
+// queryDoH sends a single question to a DNS-over-HTTPS resolver and extracts
+// the addresses from the answer.
+func queryDoH(ctx context.Context, url string, name dnsmessage.Name, qtype dnsmessage.Type) ([]netip.Addr, error) {
+	// RFC 8484 asks for ID 0 so responses are cache friendly
+	b := dnsmessage.NewBuilder(nil, dnsmessage.Header{RecursionDesired: true})
+	b.StartQuestions()
+	b.Question(dnsmessage.Question{Name: name, Type: qtype, Class: dnsmessage.ClassINET})
+	query, err := b.Finish()
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(query))
+	if err != nil {
+		return nil, fmt.Errorf("invalid DNS-over-HTTPS URL '%s': %w", url, err)
+	}
+	req.Header.Set("Content-Type", "application/dns-message")
+	req.Header.Set("Accept", "application/dns-message")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("DNS-over-HTTPS lookup of %s failed: %w", name, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("DNS-over-HTTPS resolver returned %s", resp.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxDoHResponse))
+	if err != nil {
+		return nil, fmt.Errorf("DNS-over-HTTPS lookup of %s failed: %w", name, err)
+	}
+
+	var p dnsmessage.Parser
+	header, err := p.Start(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid DNS-over-HTTPS response: %w", err)
+	}
+	if header.RCode == dnsmessage.RCodeNameError {
+		return nil, fmt.Errorf("no such host %s", strings.TrimSuffix(name.String(), "."))
+	}
+	if header.RCode != dnsmessage.RCodeSuccess {
+		return nil, fmt.Errorf("DNS-over-HTTPS resolver answered %s", header.RCode)
+	}
+	addrs, err := answerAddrs(&p)
+	if err != nil {
+		return nil, fmt.Errorf("invalid DNS-over-HTTPS response: %w", err)
+	}
+	return addrs, nil
+}
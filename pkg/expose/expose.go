@@ -0,0 +1,157 @@
+// Package expose publishes local services on the SSH server, as a lightweight
+// alternative to hosted tunneling services running on one's own server.
+//
+// Connections accepted on the server through a remote forward are passed to a
+// local target. With routes by hostname, the HTTP request head is read first
+// and the target is picked from its Host header, so several local web
+// services can share one public port the way virtual hosts share a web server.
+package expose
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// headTimeout bounds how long a client may take to send the request head when
+// routing by hostname.
+const headTimeout = 10 * time.Second
+
+// Route maps connections to a local target.
+type Route struct {
+	Host   string // Lowercase hostname matched against the Host header; empty for the default route
+	Target string // Local address in "host:port" format
+}
+
+// Forwarder passes connections to the targets of its routes.
+type Forwarder struct {
+	hosts    map[string]string // Targets by hostname
+	fallback string            // Target for connections matching no hostname, or ""
+	timeout  time.Duration     // Timeout for connecting to a target
+}
+
+// NewForwarder creates a forwarder for a set of routes.
+//
+// Parameters:
+//   - routes: The routes; at most one may have an empty Host
+//   - timeout: Timeout for connecting to a target
+//
+// Returns:
+//   - *Forwarder: A forwarder ready to serve
+//   - error: An error if there are no routes or a hostname is routed twice
+func NewForwarder(routes []Route, timeout time.Duration) (*Forwarder, error) {
+	if len(routes) == 0 {
+		return nil, fmt.Errorf("no local target given")
+	}
+	f := &Forwarder{hosts: make(map[string]string), timeout: timeout}
+	for _, r := range routes {
+		if r.Host == "" {
+			if f.fallback != "" {
+				return nil, fmt.Errorf("more than one default target: %s and %s", f.fallback, r.Target)
+			}
+			f.fallback = r.Target
+			continue
+		}
+		if _, ok := f.hosts[r.Host]; ok {
+			return nil, fmt.Errorf("host %s is routed twice", r.Host)
+		}
+		f.hosts[r.Host] = r.Target
+	}
+	return f, nil
+}
+
+// Serve accepts connections until the listener is closed and forwards each
+// to its target.
+//
+// Parameters:
+//   - listener: The listener on the server, typically an SSH remote forward
+func (f *Forwarder) Serve(listener net.Listener) {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		go f.handle(conn)
+	}
+}
+
+// handle forwards one connection, reading its request head first when
+// routing by hostname.
+func (f *Forwarder) handle(conn net.Conn) {
+	defer conn.Close()
+
+	if len(f.hosts) == 0 {
+		f.forward(conn, f.fallback, nil)
+		return
+	}
+
+	// SSH channels do not support deadlines, so the timeout closes the connection
+	timer := time.AfterFunc(headTimeout, func() { conn.Close() })
+	var head bytes.Buffer
+	req, err := http.ReadRequest(bufio.NewReader(io.TeeReader(conn, &head)))
+	if !timer.Stop() {
+		return
+	}
+	if err != nil {
+		respond(conn, http.StatusBadRequest)
+		return
+	}
+
+	host := strings.ToLower(req.Host)
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	target, ok := f.hosts[host]
+	if !ok {
+		target = f.fallback
+	}
+	if target == "" {
+		fmt.Printf("✗ No route for host %s\n", host)
+		respond(conn, http.StatusNotFound)
+		return
+	}
+	fmt.Printf("→ %s %s%s → %s\n", req.Method, host, req.URL.Path, target)
+
+	// Pass on everything read so far, which holds the request head and
+	// possibly the start of the body
+	f.forward(conn, target, head.Bytes())
+}
+
+// forward connects to a target, writes the bytes already read from the
+// client and relays data both ways until either side closes.
+func (f *Forwarder) forward(conn net.Conn, target string, head []byte) {
+	local, err := net.DialTimeout("tcp", target, f.timeout)
+	if err != nil {
+		fmt.Printf("✗ Failed to connect to %s: %v\n", target, err)
+		if head != nil {
+			respond(conn, http.StatusBadGateway)
+		}
+		return
+	}
+	defer local.Close()
+
+	if _, err := local.Write(head); err != nil {
+		return
+	}
+
+	done := make(chan struct{}, 2)
+	go func() {
+		io.Copy(local, conn)
+		done <- struct{}{}
+	}()
+	go func() {
+		io.Copy(conn, local)
+		done <- struct{}{}
+	}()
+	<-done
+}
+
+// respond writes an empty HTTP response with a status code.
+func respond(conn net.Conn, status int) {
+	fmt.Fprintf(conn, "HTTP/1.1 %d %s\r\nContent-Length: 0\r\nConnection: close\r\n\r\n", status, http.StatusText(status))
+}
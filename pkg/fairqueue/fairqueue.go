@@ -0,0 +1,135 @@
+// Package fairqueue shares the upload capacity of one transport fairly
+// between the connections writing to it.
+//
+// All proxied connections of a tunnel are channels of one SSH connection.
+// A bulk upload writes as fast as the transport accepts data, so the writes of
+// interactive connections, a few bytes each, queue behind its packets. A
+// Scheduler makes the connections writing at the same time take turns: each
+// turn writes at most a quantum of data, and a connection with more to write
+// goes to the back of the line. A connection with a single small write thus
+// waits for at most one quantum of every other busy connection.
+//
+// A turn that stalls, because the destination of its channel is not reading
+// and the channel window is exhausted, is handed on after maxTurn so one slow
+// destination cannot hold up the others.
+package fairqueue
+
+import (
+	"net"
+	"sync"
+	"time"
+)
+
+// maxTurn is how long a write may hold its turn before the next connection
+// is let through alongside it.
+const maxTurn = 50 * time.Millisecond
+
+// Scheduler hands out write turns in arrival order to the connections of one
+// transport.
+type Scheduler struct {
+	mu      sync.Mutex
+	busy    bool         // Whether a turn is in progress
+	waiting []chan *turn // Connections waiting for a turn, in order
+}
+
+// turn is the permission of one connection to write a quantum.
+type turn struct {
+	s     *Scheduler
+	once  sync.Once   // Ends the turn only once, by the write or the timer
+	timer *time.Timer // Ends a stalled turn after maxTurn
+}
+
+// NewScheduler creates a scheduler for the connections of one transport.
+//
+// Returns:
+//   - *Scheduler: A scheduler with no connections waiting
+func NewScheduler() *Scheduler {
+	return &Scheduler{}
+}
+
+// Conn is a connection whose writes take turns with the other connections of
+// its scheduler.
+type Conn struct {
+	net.Conn
+	s       *Scheduler
+	quantum int // Most bytes written per turn
+}
+
+// Wrap makes the writes to a connection take turns with the other
+// connections of the scheduler.
+//
+// Parameters:
+//   - conn: The connection, a channel of the scheduler's transport
+//   - quantum: The most bytes written per turn
+//
+// Returns:
+//   - *Conn: The wrapped connection
+func (s *Scheduler) Wrap(conn net.Conn, quantum int) *Conn {
+	return &Conn{Conn: conn, s: s, quantum: quantum}
+}
+
+// Write writes p in quanta, waiting for a turn before each.
+func (c *Conn) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		chunk := p[:min(len(p), c.quantum)]
+		t := c.s.acquire()
+		n, err := c.Conn.Write(chunk)
+		t.end()
+		written += n
+		if err != nil {
+			return written, err
+		}
+		p = p[n:]
+	}
+	return written, nil
+}
+
+// CloseWrite half-closes the connection, or closes it when half-closing is
+// not supported.
+func (c *Conn) CloseWrite() error {
+	if cw, ok := c.Conn.(interface{ CloseWrite() error }); ok {
+		return cw.CloseWrite()
+	}
+	return c.Conn.Close()
+}
+
+// acquire waits for the next turn.
+func (s *Scheduler) acquire() *turn {
+	s.mu.Lock()
+	if !s.busy {
+		s.busy = true
+		s.mu.Unlock()
+		return s.start()
+	}
+	ready := make(chan *turn, 1)
+	s.waiting = append(s.waiting, ready)
+	s.mu.Unlock()
+	return <-ready
+}
+
+// start begins a turn, ending it after maxTurn unless the write finishes
+// first.
+func (s *Scheduler) start() *turn {
+	t := &turn{s: s}
+	t.timer = time.AfterFunc(maxTurn, t.end)
+	return t
+}
+
+// end passes the turn to the next waiting connection, if any.
+func (t *turn) end() {
+	t.once.Do(func() {
+		t.timer.Stop()
+		s := t.s
+		s.mu.Lock()
+		if len(s.waiting) == 0 {
+			s.busy = false
+			s.mu.Unlock()
+			return
+		}
+		ready := s.waiting[0]
+		s.waiting = s.waiting[1:]
+		s.mu.Unlock()
+		ready <- s.start()
+	})
+}
@@ -0,0 +1,182 @@
+package geoip
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"math/big"
+)
+
+// Data section field types.
+const (
+	typeExtended = 0
+	typePointer  = 1
+	typeString   = 2
+	typeDouble   = 3
+	typeBytes    = 4
+	typeUint16   = 5
+	typeUint32   = 6
+	typeMap      = 7
+	typeInt32    = 8
+	typeUint64   = 9
+	typeUint128  = 10
+	typeArray    = 11
+	typeBool     = 14
+	typeFloat    = 15
+)
+
+// maxDepth bounds the nesting of maps and arrays, so a malformed file cannot
+// recurse without end.
+const maxDepth = 32
+
+// decoder decodes fields of a data section into Go values: maps become
+// map[string]any, arrays []any, unsigned integers uint64 (uint128 *big.Int),
+// int32 int64, and floats float64.
+type decoder struct {
+	buf []byte
+}
+
+// decode decodes the field at offset and returns it with the offset of the
+// following field.
+func (d *decoder) decode(offset, depth int) (any, int, error) {
+	if depth > maxDepth {
+		return nil, 0, fmt.Errorf("data nested too deeply")
+	}
+	if offset >= len(d.buf) {
+		return nil, 0, fmt.Errorf("field at %d out of range", offset)
+	}
+	ctrl := d.buf[offset]
+	offset++
+	kind := int(ctrl >> 5)
+
+	if kind == typePointer {
+		target, next, err := d.pointer(ctrl, offset)
+		if err != nil {
+			return nil, 0, err
+		}
+		// Pointers never point to pointers, so following one cannot loop
+		if target < len(d.buf) && d.buf[target]>>5 == typePointer {
+			return nil, 0, fmt.Errorf("pointer at %d points to a pointer", offset-1)
+		}
+		value, _, err := d.decode(target, depth+1)
+		return value, next, err
+	}
+
+	if kind == typeExtended {
+		if offset >= len(d.buf) {
+			return nil, 0, fmt.Errorf("truncated field at %d", offset)
+		}
+		kind = 7 + int(d.buf[offset])
+		offset++
+	}
+
+	size := int(ctrl & 0x1f)
+	if size >= 29 {
+		n := size - 28
+		if offset+n > len(d.buf) {
+			return nil, 0, fmt.Errorf("truncated field at %d", offset)
+		}
+		extra := 0
+		for _, b := range d.buf[offset : offset+n] {
+			extra = extra<<8 | int(b)
+		}
+		size = []int{29, 285, 65821}[n-1] + extra
+		offset += n
+	}
+
+	switch kind {
+	case typeMap:
+		m := make(map[string]any, min(size, 64))
+		for range size {
+			key, next, err := d.decode(offset, depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			name, ok := key.(string)
+			if !ok {
+				return nil, 0, fmt.Errorf("map key at %d is not a string", offset)
+			}
+			value, next, err := d.decode(next, depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			m[name], offset = value, next
+		}
+		return m, offset, nil
+	case typeArray:
+		a := make([]any, 0, min(size, 64))
+		for range size {
+			value, next, err := d.decode(offset, depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			a, offset = append(a, value), next
+		}
+		return a, offset, nil
+	case typeBool:
+		return size != 0, offset, nil
+	}
+
+	if offset+size > len(d.buf) {
+		return nil, 0, fmt.Errorf("field at %d exceeds the data", offset)
+	}
+	b := d.buf[offset : offset+size]
+	next := offset + size
+	switch kind {
+	case typeString:
+		return string(b), next, nil
+	case typeBytes:
+		return append([]byte(nil), b...), next, nil
+	case typeDouble:
+		if size != 8 {
+			return nil, 0, fmt.Errorf("double at %d has size %d", offset, size)
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(b)), next, nil
+	case typeFloat:
+		if size != 4 {
+			return nil, 0, fmt.Errorf("float at %d has size %d", offset, size)
+		}
+		return float64(math.Float32frombits(binary.BigEndian.Uint32(b))), next, nil
+	case typeUint16, typeUint32, typeUint64:
+		if size > 8 {
+			return nil, 0, fmt.Errorf("integer at %d has size %d", offset, size)
+		}
+		var n uint64
+		for _, c := range b {
+			n = n<<8 | uint64(c)
+		}
+		return n, next, nil
+	case typeInt32:
+		if size > 4 {
+			return nil, 0, fmt.Errorf("integer at %d has size %d", offset, size)
+		}
+		var n uint32
+		for _, c := range b {
+			n = n<<8 | uint32(c)
+		}
+		return int64(int32(n)), next, nil
+	case typeUint128:
+		return new(big.Int).SetBytes(b), next, nil
+	default:
+		return nil, 0, fmt.Errorf("unsupported field type %d at %d", kind, offset)
+	}
+}
+
+// pointer decodes the pointer whose control byte is ctrl, returning the
+// offset it points to and the offset following it.
+func (d *decoder) pointer(ctrl byte, offset int) (int, int, error) {
+	n := int(ctrl>>3&0x3) + 1
+	if offset+n > len(d.buf) {
+		return 0, 0, fmt.Errorf("truncated pointer at %d", offset)
+	}
+	b := d.buf[offset : offset+n]
+	value := 0
+	if n < 4 {
+		value = int(ctrl & 0x7)
+	}
+	for _, c := range b {
+		value = value<<8 | int(c)
+	}
+	value += []int{0, 2048, 526336, 0}[n-1]
+	return value, offset + n, nil
+}
@@ -0,0 +1,219 @@
+// Package geoip looks up the country and autonomous system of IP addresses in
+// MaxMind DB (.mmdb) files, such as the GeoLite2 Country, City and ASN
+// databases or compatible files from other providers.
+//
+// Only the parts of the format needed for lookups are implemented: the binary
+// search tree with 24, 28 and 32 bit records, and the data section types.
+// Files are read into memory once, so lookups do no I/O.
+package geoip
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"net/netip"
+	"os"
+	"strings"
+)
+
+// metadataMarker precedes the metadata map at the end of every database.
+var metadataMarker = []byte("\xab\xcd\xefMaxMind.com")
+
+// errInvalid is wrapped by every error caused by a malformed file.
+var errInvalid = errors.New("invalid MaxMind database")
+
+// DB is an opened MaxMind database.
+type DB struct {
+	Type       string // Database type from the metadata, e.g. "GeoLite2-Country"
+	tree       []byte // Binary search tree
+	data       []byte // Data section
+	nodeCount  uint32
+	recordSize int    // Bits per record: 24, 28 or 32
+	ipv4Start  uint32 // Node where IPv4 lookups start in an IPv6 tree
+	ipVersion  int
+}
+
+// Open reads a database file.
+//
+// Parameters:
+//   - path: The .mmdb file
+//
+// Returns:
+//   - *DB: The database
+//   - error: An error if the file cannot be read or is not a valid database
+func Open(path string) (*DB, error) {
+	file, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	db, err := parse(file)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return db, nil
+}
+
+// parse splits a database into its sections using the metadata.
+func parse(file []byte) (*DB, error) {
+	i := bytes.LastIndex(file, metadataMarker)
+	if i < 0 {
+		return nil, fmt.Errorf("%w: metadata not found", errInvalid)
+	}
+	meta := file[i+len(metadataMarker):]
+	value, _, err := (&decoder{buf: meta}).decode(0, 0)
+	if err != nil {
+		return nil, fmt.Errorf("%w: metadata: %v", errInvalid, err)
+	}
+	fields, ok := value.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("%w: metadata is not a map", errInvalid)
+	}
+
+	db := &DB{}
+	db.Type, _ = fields["database_type"].(string)
+	nodeCount, _ := fields["node_count"].(uint64)
+	recordSize, _ := fields["record_size"].(uint64)
+	ipVersion, _ := fields["ip_version"].(uint64)
+	if recordSize != 24 && recordSize != 28 && recordSize != 32 {
+		return nil, fmt.Errorf("%w: unsupported record size %d", errInvalid, recordSize)
+	}
+	if ipVersion != 4 && ipVersion != 6 {
+		return nil, fmt.Errorf("%w: unsupported IP version %d", errInvalid, ipVersion)
+	}
+	db.nodeCount, db.recordSize, db.ipVersion = uint32(nodeCount), int(recordSize), int(ipVersion)
+
+	// The tree is followed by 16 zero bytes separating it from the data section
+	treeSize := uint64(nodeCount) * recordSize / 4
+	if nodeCount > math.MaxUint32 || treeSize+16 > uint64(i) {
+		return nil, fmt.Errorf("%w: search tree exceeds the file", errInvalid)
+	}
+	db.tree = file[:treeSize]
+	db.data = file[treeSize+16 : i]
+
+	// IPv4 addresses live under ::/96 in IPv6 trees
+	if db.ipVersion == 6 {
+		node := uint32(0)
+		for range 96 {
+			if node >= db.nodeCount {
+				break
+			}
+			node = db.record(node, 0)
+		}
+		db.ipv4Start = node
+	}
+	return db, nil
+}
+
+// record returns the left (bit 0) or right (bit 1) record of a node.
+func (db *DB) record(node uint32, bit int) uint32 {
+	switch db.recordSize {
+	case 24:
+		b := db.tree[node*6+uint32(bit)*3:]
+		return uint32(b[0])<<16 | uint32(b[1])<<8 | uint32(b[2])
+	case 28:
+		b := db.tree[node*7:]
+		if bit == 0 {
+			return uint32(b[3]&0xf0)<<20 | uint32(b[0])<<16 | uint32(b[1])<<8 | uint32(b[2])
+		}
+		return uint32(b[3]&0x0f)<<24 | uint32(b[4])<<16 | uint32(b[5])<<8 | uint32(b[6])
+	default:
+		return binary.BigEndian.Uint32(db.tree[node*8+uint32(bit)*4:])
+	}
+}
+
+// Lookup returns the record of the network containing an address.
+//
+// Parameters:
+//   - addr: The address to look up
+//
+// Returns:
+//   - map[string]any: The record, or nil if the address is not in the database
+//   - error: An error if the database is malformed
+func (db *DB) Lookup(addr netip.Addr) (map[string]any, error) {
+	addr = addr.Unmap()
+	node := uint32(0)
+	if addr.Is4() && db.ipVersion == 6 {
+		node = db.ipv4Start
+	} else if addr.Is6() && db.ipVersion == 4 {
+		return nil, nil
+	}
+
+	ip := addr.AsSlice()
+	for i := 0; i < len(ip)*8 && node < db.nodeCount; i++ {
+		node = db.record(node, int(ip[i/8]>>(7-i%8))&1)
+	}
+	switch {
+	case node == db.nodeCount:
+		return nil, nil
+	case node < db.nodeCount:
+		return nil, fmt.Errorf("%w: search tree deeper than the address", errInvalid)
+	}
+
+	offset := uint64(node-db.nodeCount) - 16
+	if offset >= uint64(len(db.data)) {
+		return nil, fmt.Errorf("%w: record pointer out of range", errInvalid)
+	}
+	value, _, err := (&decoder{buf: db.data}).decode(int(offset), 0)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errInvalid, err)
+	}
+	record, _ := value.(map[string]any)
+	return record, nil
+}
+
+// Country returns the ISO 3166-1 country code of an address, using the
+// country where it is located and falling back to the country where its
+// network is registered.
+//
+// Parameters:
+//   - addr: The address to look up
+//
+// Returns:
+//   - string: The uppercase country code, or "" if unknown
+func (db *DB) Country(addr netip.Addr) string {
+	record, err := db.Lookup(addr)
+	if err != nil || record == nil {
+		return ""
+	}
+	for _, key := range []string{"country", "registered_country"} {
+		switch v := record[key].(type) {
+		case map[string]any:
+			if code, ok := v["iso_code"].(string); ok && code != "" {
+				return strings.ToUpper(code)
+			}
+		case string:
+			// Flat layouts store the code directly
+			if v != "" {
+				return strings.ToUpper(v)
+			}
+		}
+	}
+	return ""
+}
+
+// ASN returns the number of the autonomous system announcing an address.
+//
+// Parameters:
+//   - addr: The address to look up
+//
+// Returns:
+//   - uint32: The AS number, or 0 if unknown
+func (db *DB) ASN(addr netip.Addr) uint32 {
+	record, err := db.Lookup(addr)
+	if err != nil || record == nil {
+		return 0
+	}
+	if n, ok := record["autonomous_system_number"].(uint64); ok && n <= math.MaxUint32 {
+		return uint32(n)
+	}
+	// Flat layouts store "AS13335"
+	if s, ok := record["asn"].(string); ok {
+		var n uint32
+		if _, err := fmt.Sscanf(strings.ToUpper(s), "AS%d", &n); err == nil {
+			return n
+		}
+	}
+	return 0
+}
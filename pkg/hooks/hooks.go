@@ -0,0 +1,162 @@
+// Package hooks provides external lifecycle hooks for the Tunn SSH tunneling tool.
+//
+// Hooks allow SSH credentials to be obtained from outside the configuration file
+// right before a connection is made. This supports providers that rotate SSH
+// accounts regularly: a command or HTTP endpoint returns the current account and
+// Tunn injects it into the session without the config file being edited.
+package hooks
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"tunn/pkg/config"
+)
+
+// maxHookOutput limits how much output is read from a hook.
+const maxHookOutput = 64 << 10
+
+// Credentials holds SSH account details returned by a pre-connect hook.
+//
+// Host and Port are optional and only override the configured values when set.
+type Credentials struct {
+	Host     string `json:"host,omitempty"`
+	Port     int    `json:"port,omitempty"`
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// RunPreConnect executes the pre-connect hook and parses the returned credentials.
+//
+// Commands run through the system shell ("sh -c" or "cmd /C") with the current
+// SSH host and username exported as TUNN_SSH_HOST and TUNN_SSH_USERNAME, so a
+// script can decide whether the account needs refreshing. URLs are fetched with
+// a plain GET request.
+//
+// Parameters:
+//   - hook: The pre-connect hook configuration
+//   - ssh: The currently configured SSH settings, passed to the hook as context
+//
+// Returns:
+//   - *Credentials: The credentials returned by the hook
+//   - error: An error if the hook fails, times out, or returns invalid output
+func RunPreConnect(hook *config.PreConnectHook, ssh config.SSHConfig) (*Credentials, error) {
+	timeout := time.Duration(hook.Timeout) * time.Second
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	var output []byte
+	var err error
+	if hook.Command != "" {
+		output, err = runCommand(ctx, hook.Command, ssh)
+	} else {
+		output, err = fetchURL(ctx, hook.URL)
+	}
+	if err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			return nil, fmt.Errorf("pre-connect hook timed out after %v", timeout)
+		}
+		return nil, fmt.Errorf("pre-connect hook failed: %w", err)
+	}
+
+	return parseCredentials(output)
+}
+
+// Apply copies the returned credentials into the SSH configuration.
+//
+// Parameters:
+//   - ssh: The SSH configuration to update in place
+func (c *Credentials) Apply(ssh *config.SSHConfig) {
+	if c.Host != "" {
+		ssh.Host = c.Host
+	}
+	if c.Port != 0 {
+		ssh.Port = c.Port
+	}
+	ssh.Username = c.Username
+	ssh.Password = c.Password
+}
+
+// runCommand runs a hook command through the system shell and returns its stdout.
+func runCommand(ctx context.Context, command string, ssh config.SSHConfig) ([]byte, error) {
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.CommandContext(ctx, "cmd", "/C", command)
+	} else {
+		cmd = exec.CommandContext(ctx, "sh", "-c", command)
+	}
+	cmd.Env = append(os.Environ(),
+		"TUNN_SSH_HOST="+ssh.Host,
+		"TUNN_SSH_PORT="+strconv.Itoa(ssh.Port),
+		"TUNN_SSH_USERNAME="+ssh.Username,
+	)
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("%v: %s", err, msg)
+		}
+		return nil, err
+	}
+	if stdout.Len() > maxHookOutput {
+		return nil, fmt.Errorf("output exceeds %d bytes", maxHookOutput)
+	}
+	return stdout.Bytes(), nil
+}
+
+// fetchURL performs an HTTP GET request and returns the response body.
+func fetchURL(ctx context.Context, url string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected HTTP status: %s", resp.Status)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, maxHookOutput))
+}
+
+// parseCredentials parses hook output as a JSON object or "username:password" text.
+func parseCredentials(output []byte) (*Credentials, error) {
+	text := strings.TrimSpace(string(output))
+	if text == "" {
+		return nil, fmt.Errorf("pre-connect hook returned no credentials")
+	}
+
+	creds := &Credentials{}
+	if strings.HasPrefix(text, "{") {
+		if err := json.Unmarshal([]byte(text), creds); err != nil {
+			return nil, fmt.Errorf("invalid pre-connect hook output: %w", err)
+		}
+	} else {
+		line := strings.SplitN(text, "\n", 2)[0]
+		user, pass, ok := strings.Cut(strings.TrimSpace(line), ":")
+		if !ok {
+			return nil, fmt.Errorf("invalid pre-connect hook output: expected JSON or username:password")
+		}
+		creds.Username, creds.Password = user, pass
+	}
+
+	if creds.Username == "" || creds.Password == "" {
+		return nil, fmt.Errorf("pre-connect hook returned an empty username or password")
+	}
+	return creds, nil
+}
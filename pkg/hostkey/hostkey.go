@@ -0,0 +1,234 @@
+// Package hostkey verifies the host keys of SSH servers.
+//
+// Without verification anyone able to intercept the connection to the server,
+// which for a tunnel through proxies and CDNs is a long list, could pose as
+// the server and read all tunneled traffic. A server's key is accepted when it
+// matches the fingerprint pinned in the configuration or, without a pin, the
+// key recorded for the server in a known_hosts file. Unknown servers are
+// trusted on first use after asking on the terminal, and their key is added
+// to the file; a key differing from the recorded one is always rejected.
+package hostkey
+
+import (
+	"bufio"
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+	"golang.org/x/term"
+)
+
+// insecure disables verification, set by --insecure-hostkey.
+var insecure atomic.Bool
+
+// SetInsecure turns host key verification off for the whole process, for
+// servers whose key changes on every connection.
+func SetInsecure(skip bool) {
+	insecure.Store(skip)
+}
+
+// Policy describes how the key of one server is verified.
+type Policy struct {
+	Address     string // The server's "host:port" as configured, which identifies it in known_hosts
+	Fingerprint string // Pinned SHA256 fingerprint as printed by ssh-keygen -l, or "" to use known_hosts
+	KnownHosts  string // known_hosts file, or "" for ~/.ssh/known_hosts
+}
+
+// knownFile is a loaded known_hosts file.
+type knownFile struct {
+	path    string
+	check   ssh.HostKeyCallback      // Checks keys against the file as it was loaded
+	learned map[string]ssh.PublicKey // Keys trusted on first use since, by address
+}
+
+var (
+	mu    sync.Mutex            // Serializes loading files and prompting
+	files map[string]*knownFile // Loaded files by path
+)
+
+// Verify returns the host key callback enforcing a policy, and the host key
+// algorithms to ask the server for.
+//
+// The algorithms are those of the keys recorded for the server, so a server
+// with several keys presents one that can be checked; nil leaves the library
+// defaults. Files are read once and kept in memory, so reconnecting works
+// after privileges are dropped or the filesystem is restricted.
+//
+// Parameters:
+//   - p: The verification policy of the server
+//
+// Returns:
+//   - ssh.HostKeyCallback: Accepts or rejects the server's key
+//   - []string: Host key algorithms to negotiate, or nil
+func Verify(p Policy) (ssh.HostKeyCallback, []string) {
+	callback := func(_ string, _ net.Addr, key ssh.PublicKey) error {
+		if insecure.Load() {
+			return nil
+		}
+		if p.Fingerprint != "" {
+			if fingerprint := ssh.FingerprintSHA256(key); fingerprint != p.Fingerprint {
+				return fmt.Errorf("host key of %s is %s, not the pinned %s; the server may be impersonated", p.Address, fingerprint, p.Fingerprint)
+			}
+			return nil
+		}
+		return verifyKnown(p, key)
+	}
+
+	if insecure.Load() || p.Fingerprint != "" {
+		return callback, nil
+	}
+	return callback, knownAlgorithms(p)
+}
+
+// verifyKnown checks a key against the known_hosts file, asking whether to
+// trust the server when it is not in the file.
+func verifyKnown(p Policy, key ssh.PublicKey) error {
+	mu.Lock()
+	defer mu.Unlock()
+
+	file, err := load(p.KnownHosts)
+	if err != nil {
+		return err
+	}
+	if learned := file.learned[p.Address]; learned != nil {
+		if string(learned.Marshal()) == string(key.Marshal()) {
+			return nil
+		}
+		return changedError(p.Address, key, file.path)
+	}
+
+	var keyErr *knownhosts.KeyError
+	err = file.check(p.Address, &net.TCPAddr{}, key)
+	switch {
+	case err == nil:
+		return nil
+	case !errors.As(err, &keyErr):
+		return fmt.Errorf("host key of %s rejected: %w", p.Address, err)
+	case len(keyErr.Want) > 0:
+		return changedError(p.Address, key, file.path)
+	}
+
+	fingerprint := ssh.FingerprintSHA256(key)
+	if !term.IsTerminal(int(os.Stdin.Fd())) {
+		return fmt.Errorf("host key of %s is unknown (%s %s); pin it with ssh.hostKeyFingerprint, add it to %s or connect once from a terminal to trust it",
+			p.Address, key.Type(), fingerprint, file.path)
+	}
+
+	fmt.Fprintf(os.Stderr, "The authenticity of %s can't be established.\n%s key fingerprint is %s.\nTrust it and remember it in %s? [y/N] ",
+		p.Address, key.Type(), fingerprint, file.path)
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	if answer = strings.ToLower(strings.TrimSpace(answer)); answer != "y" && answer != "yes" {
+		return fmt.Errorf("host key of %s not trusted", p.Address)
+	}
+
+	file.learned[p.Address] = key
+	if err := appendKey(file.path, p.Address, key); err != nil {
+		fmt.Printf("✗ Host key trusted for this run only: %v\n", err)
+	} else {
+		fmt.Printf("✓ Added host key of %s to %s\n", p.Address, file.path)
+	}
+	return nil
+}
+
+// changedError describes a key that differs from the recorded one.
+func changedError(address string, key ssh.PublicKey, path string) error {
+	return fmt.Errorf("host key of %s has changed (%s %s), someone may be impersonating the server; if the key was changed on purpose, remove the old entry from %s",
+		address, key.Type(), ssh.FingerprintSHA256(key), path)
+}
+
+// knownAlgorithms returns the host key algorithms of the keys recorded for a
+// server, or nil if none is.
+func knownAlgorithms(p Policy) []string {
+	mu.Lock()
+	defer mu.Unlock()
+
+	file, err := load(p.KnownHosts)
+	if err != nil {
+		return nil
+	}
+	if learned := file.learned[p.Address]; learned != nil {
+		return algorithmsFor(learned.Type())
+	}
+
+	// Checking a key no server has lists the recorded keys in the error
+	_, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil
+	}
+	probe, err := ssh.NewSignerFromKey(private)
+	if err != nil {
+		return nil
+	}
+	var keyErr *knownhosts.KeyError
+	if err := file.check(p.Address, &net.TCPAddr{}, probe.PublicKey()); !errors.As(err, &keyErr) {
+		return nil
+	}
+	var algorithms []string
+	for _, known := range keyErr.Want {
+		algorithms = append(algorithms, algorithmsFor(known.Key.Type())...)
+	}
+	return algorithms
+}
+
+// algorithmsFor returns the signature algorithms usable with a key type.
+func algorithmsFor(keyType string) []string {
+	if keyType == ssh.KeyAlgoRSA {
+		return []string{ssh.KeyAlgoRSASHA512, ssh.KeyAlgoRSASHA256, ssh.KeyAlgoRSA}
+	}
+	return []string{keyType}
+}
+
+// load returns a known_hosts file, reading it on first use. A missing file is
+// treated as empty. The caller must hold mu.
+func load(path string) (*knownFile, error) {
+	if path == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil, fmt.Errorf("failed to locate known_hosts: %w", err)
+		}
+		path = filepath.Join(home, ".ssh", "known_hosts")
+	}
+	if file := files[path]; file != nil {
+		return file, nil
+	}
+
+	check, err := knownhosts.New(path)
+	if errors.Is(err, os.ErrNotExist) {
+		check, err = knownhosts.New(os.DevNull)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	file := &knownFile{path: path, check: check, learned: make(map[string]ssh.PublicKey)}
+	if files == nil {
+		files = make(map[string]*knownFile)
+	}
+	files[path] = file
+	return file, nil
+}
+
+// appendKey records a trusted key in a known_hosts file, creating the file
+// and its directory as needed.
+func appendKey(path, address string, key ssh.PublicKey) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("failed to create %s: %w", filepath.Dir(path), err)
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	defer f.Close()
+	if _, err := fmt.Fprintln(f, knownhosts.Line([]string{knownhosts.Normalize(address)}, key)); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,438 @@
+// Package httpcache caches HTTP responses in the local HTTP proxy.
+//
+// Repeated downloads are expensive over a slow tunnel: package updates fetch
+// the same indexes again and again, and heavy sites reload the same scripts and
+// images. The cache keeps GET responses that Cache-Control, Expires or their
+// validators allow to be reused, in memory or in a directory that survives
+// restarts, and serves them while fresh. Stale responses with an ETag or
+// Last-Modified date are revalidated with a conditional request, so unchanged
+// content is not transferred again.
+//
+// The cache behaves as a shared cache (RFC 9111): responses marked private,
+// setting cookies or answering requests with credentials are not stored. HTTPS
+// traffic passes the proxy encrypted and is never cached.
+package httpcache
+
+import (
+	"bufio"
+	"bytes"
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Cache stores HTTP responses, evicting the least recently used ones beyond
+// its size limit.
+type Cache struct {
+	dir      string // Directory of the cache files ("" to keep responses in memory)
+	maxSize  int64  // Total size of the stored responses
+	maxEntry int64  // Size of the largest response stored
+
+	mu      sync.Mutex
+	size    int64                    // Current total size
+	entries map[string]*list.Element // Entries by key, elements of lru
+	lru     *list.List               // *entry values, most recently used first
+}
+
+// meta describes a stored response. In a cache directory it is the first line
+// of each file, followed by the response.
+type meta struct {
+	Key          string            `json:"key"`                    // Method and URL
+	Stored       time.Time         `json:"stored"`                 // When the response was generated or last validated
+	Lifetime     time.Duration     `json:"lifetime"`               // How long after Stored the response is fresh
+	ETag         string            `json:"etag,omitempty"`         // Validator for If-None-Match
+	LastModified string            `json:"lastModified,omitempty"` // Validator for If-Modified-Since
+	Vary         map[string]string `json:"vary,omitempty"`         // Request header values the response was selected by
+}
+
+// entry is a stored response.
+type entry struct {
+	meta
+	size int64  // Size of the stored response
+	data []byte // The response, when kept in memory
+}
+
+// Open creates a cache, loading the responses stored in its directory.
+//
+// Parameters:
+//   - dir: Directory for the cache files, created if needed; empty to keep
+//     responses in memory
+//   - maxSize: Total size of the stored responses in bytes
+//   - maxEntrySize: Size of the largest response stored in bytes
+//
+// Returns:
+//   - *Cache: The cache
+//   - error: An error if the directory cannot be created or read
+func Open(dir string, maxSize, maxEntrySize int64) (*Cache, error) {
+	c := &Cache{
+		dir:      dir,
+		maxSize:  maxSize,
+		maxEntry: maxEntrySize,
+		entries:  make(map[string]*list.Element),
+		lru:      list.New(),
+	}
+	if dir == "" {
+		return c, nil
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create cache directory: %w", err)
+	}
+	if err := c.load(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Len returns the number of stored responses and their total size in bytes.
+func (c *Cache) Len() (int, int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.lru.Len(), c.size
+}
+
+// Close releases the responses held in memory. Files in the cache directory
+// are kept for the next time it is opened.
+func (c *Cache) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries = make(map[string]*list.Element)
+	c.lru.Init()
+	c.size = 0
+	return nil
+}
+
+// Key returns the cache key of a request to a destination.
+func Key(req *http.Request, host string, port int, path string) string {
+	return req.Method + " http://" + host + ":" + strconv.Itoa(port) + path
+}
+
+// Lookup returns the stored response for a request, or nil.
+//
+// Parameters:
+//   - key: The request's key, see Key
+//   - req: The request, to match the headers the response varies on
+//
+// Returns:
+//   - *Hit: The stored response, or nil if there is none
+func (c *Cache) Lookup(key string, req *http.Request) *Hit {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	elem, ok := c.entries[key]
+	if !ok {
+		return nil
+	}
+	e := elem.Value.(*entry)
+	for name, value := range e.Vary {
+		if req.Header.Get(name) != value {
+			return nil
+		}
+	}
+	c.lru.MoveToFront(elem)
+	return &Hit{cache: c, entry: *e}
+}
+
+// Record stores a response as it is read, returning the body to read it
+// through. Responses that may not be stored or are too large are passed on
+// unchanged. The response is stored once its body has been read completely
+// and closed.
+//
+// Parameters:
+//   - key: The request's key, see Key
+//   - req: The request the response answers
+//   - resp: The response from the origin server
+//
+// Returns:
+//   - io.ReadCloser: The body to use in place of resp.Body
+func (c *Cache) Record(key string, req *http.Request, resp *http.Response) io.ReadCloser {
+	lifetime, ok := lifetime(req, resp)
+	if !ok || resp.ContentLength > c.maxEntry {
+		return resp.Body
+	}
+	m := meta{
+		Key:          key,
+		Stored:       responseTime(resp),
+		Lifetime:     lifetime,
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+		Vary:         varyValues(req, resp),
+	}
+	return &recorder{cache: c, meta: m, resp: resp, body: resp.Body}
+}
+
+// Hit is a stored response found by Lookup.
+type Hit struct {
+	cache *Cache
+	entry entry
+}
+
+// Fresh reports whether the response may be served without validation.
+func (h *Hit) Fresh(req *http.Request) bool {
+	return !wantsRevalidation(req) && time.Since(h.entry.Stored) < h.entry.Lifetime
+}
+
+// AddValidators makes a request conditional on the stored response having
+// changed, unless the client made it conditional itself.
+//
+// Returns:
+//   - bool: Whether validators were added, so a 304 response refers to the
+//     stored response
+func (h *Hit) AddValidators(req *http.Request) bool {
+	if req.Header.Get("If-None-Match") != "" || req.Header.Get("If-Modified-Since") != "" {
+		return false
+	}
+	if h.entry.ETag != "" {
+		req.Header.Set("If-None-Match", h.entry.ETag)
+	}
+	if h.entry.LastModified != "" {
+		req.Header.Set("If-Modified-Since", h.entry.LastModified)
+	}
+	return h.entry.ETag != "" || h.entry.LastModified != ""
+}
+
+// Refresh marks the stored response as validated by a 304 response.
+func (h *Hit) Refresh(req *http.Request, notModified *http.Response) {
+	lifetime, _ := lifetime(req, notModified)
+	c := h.cache
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if elem, ok := c.entries[h.entry.Key]; ok {
+		e := elem.Value.(*entry)
+		e.Stored, e.Lifetime = responseTime(notModified), lifetime
+		h.entry = *e
+	}
+}
+
+// Response opens the stored response with an Age header added. Its body must
+// be closed.
+func (h *Hit) Response(req *http.Request) (*http.Response, error) {
+	var reader *bufio.Reader
+	var file *os.File
+	if h.entry.data != nil {
+		reader = bufio.NewReader(bytes.NewReader(h.entry.data))
+	} else {
+		var err error
+		if file, err = os.Open(h.cache.path(h.entry.Key)); err != nil {
+			return nil, err
+		}
+		reader = bufio.NewReader(file)
+		if _, err := reader.ReadBytes('\n'); err != nil {
+			file.Close()
+			return nil, err
+		}
+	}
+
+	resp, err := http.ReadResponse(reader, req)
+	if err != nil {
+		if file != nil {
+			file.Close()
+		}
+		return nil, err
+	}
+	if file != nil {
+		resp.Body = struct {
+			io.Reader
+			io.Closer
+		}{resp.Body, file}
+	}
+	resp.Header.Set("Age", strconv.Itoa(int(max(time.Since(h.entry.Stored), 0).Seconds())))
+	return resp, nil
+}
+
+// recorder buffers a response body as it is read and stores the response
+// once the body is complete.
+type recorder struct {
+	cache    *Cache
+	meta     meta
+	resp     *http.Response
+	body     io.ReadCloser
+	buf      bytes.Buffer
+	eof      bool // Whether the body was read to the end
+	overflow bool // Whether the body exceeded the entry size limit
+}
+
+// Read reads from the body, keeping a copy.
+func (r *recorder) Read(p []byte) (int, error) {
+	n, err := r.body.Read(p)
+	if !r.overflow {
+		if int64(r.buf.Len()+n) > r.cache.maxEntry {
+			r.overflow = true
+			r.buf = bytes.Buffer{}
+		} else {
+			r.buf.Write(p[:n])
+		}
+	}
+	if err == io.EOF {
+		r.eof = true
+	}
+	return n, err
+}
+
+// Close closes the body and stores the response if it was read completely.
+func (r *recorder) Close() error {
+	err := r.body.Close()
+	complete := r.eof || (r.resp.ContentLength >= 0 && int64(r.buf.Len()) == r.resp.ContentLength)
+	if complete && !r.overflow {
+		r.cache.store(r.meta, r.resp, r.buf.Bytes())
+	}
+	return err
+}
+
+// store adds a response to the cache, replacing any stored for its key.
+func (c *Cache) store(m meta, resp *http.Response, body []byte) {
+	stored := &http.Response{
+		Status:        resp.Status,
+		StatusCode:    resp.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        resp.Header.Clone(),
+		ContentLength: int64(len(body)),
+		Body:          io.NopCloser(bytes.NewReader(body)),
+	}
+	for _, name := range hopHeaders {
+		stored.Header.Del(name)
+	}
+	stored.Header.Del("Age")
+
+	var data bytes.Buffer
+	if err := stored.Write(&data); err != nil {
+		return
+	}
+	e := &entry{meta: m, size: int64(data.Len())}
+	if c.dir == "" {
+		e.data = data.Bytes()
+	} else if err := c.writeFile(m, data.Bytes()); err != nil {
+		fmt.Printf("✗ Failed to write HTTP cache: %v\n", err)
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.removeLocked(m.Key, false)
+	c.entries[m.Key] = c.lru.PushFront(e)
+	c.size += e.size
+	c.evictLocked()
+}
+
+// removeLocked drops an entry, deleting its file if asked to. The caller must
+// hold c.mu.
+func (c *Cache) removeLocked(key string, deleteFile bool) {
+	elem, ok := c.entries[key]
+	if !ok {
+		return
+	}
+	c.lru.Remove(elem)
+	delete(c.entries, key)
+	c.size -= elem.Value.(*entry).size
+	if deleteFile && c.dir != "" {
+		os.Remove(c.path(key))
+	}
+}
+
+// evictLocked drops the least recently used entries beyond the size limit.
+// The caller must hold c.mu.
+func (c *Cache) evictLocked() {
+	for c.size > c.maxSize && c.lru.Len() > 0 {
+		c.removeLocked(c.lru.Back().Value.(*entry).Key, true)
+	}
+}
+
+// path returns the file of a key in the cache directory.
+func (c *Cache) path(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(c.dir, hex.EncodeToString(sum[:]))
+}
+
+// writeFile writes a response with its metadata line to the cache directory.
+func (c *Cache) writeFile(m meta, data []byte) error {
+	line, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(c.dir, ".tmp-*")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(append(line, '\n'))
+	if err == nil {
+		_, err = tmp.Write(data)
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), c.path(m.Key))
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+	}
+	return err
+}
+
+// load indexes the responses stored in the cache directory, oldest first so
+// they are evicted first. Unreadable files are removed.
+func (c *Cache) load() error {
+	files, err := os.ReadDir(c.dir)
+	if err != nil {
+		return fmt.Errorf("failed to read cache directory: %w", err)
+	}
+	var loaded []*entry
+	for _, f := range files {
+		if !f.Type().IsRegular() {
+			continue
+		}
+		path := filepath.Join(c.dir, f.Name())
+		e, err := readMeta(path)
+		if err != nil || c.path(e.Key) != path {
+			os.Remove(path)
+			continue
+		}
+		loaded = append(loaded, e)
+	}
+	sort.Slice(loaded, func(i, j int) bool { return loaded[i].Stored.Before(loaded[j].Stored) })
+	for _, e := range loaded {
+		c.entries[e.Key] = c.lru.PushFront(e)
+		c.size += e.size
+	}
+	c.evictLocked()
+	return nil
+}
+
+// readMeta reads the metadata line of a cache file.
+func readMeta(path string) (*entry, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	line, err := bufio.NewReader(file).ReadBytes('\n')
+	if err != nil {
+		return nil, err
+	}
+	e := &entry{size: info.Size() - int64(len(line))}
+	if err := json.Unmarshal(line, &e.meta); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// responseTime returns when a response was generated: now, less the time it
+// already spent in other caches according to its Age header.
+func responseTime(resp *http.Response) time.Time {
+	age, _ := strconv.Atoi(resp.Header.Get("Age"))
+	return time.Now().Add(-time.Duration(max(age, 0)) * time.Second)
+}
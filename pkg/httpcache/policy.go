@@ -0,0 +1,146 @@
+package httpcache
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Heuristic freshness for responses with a Last-Modified date but no explicit
+// lifetime: a tenth of their age, as suggested by RFC 9111, up to a day.
+const (
+	heuristicFraction = 10
+	heuristicMax      = 24 * time.Hour
+)
+
+// cacheableStatus lists the status codes stored, those RFC 9110 defines as
+// heuristically cacheable.
+var cacheableStatus = map[int]bool{
+	200: true, 203: true, 204: true, 300: true, 301: true, 308: true,
+	404: true, 405: true, 410: true, 414: true, 501: true,
+}
+
+// hopHeaders are connection-specific headers never stored.
+var hopHeaders = []string{
+	"Connection", "Keep-Alive", "Proxy-Connection", "Proxy-Authenticate",
+	"Proxy-Authorization", "Te", "Trailer", "Transfer-Encoding", "Upgrade",
+}
+
+// Cacheable reports whether the response to a request may come from the
+// cache: only plain GET requests qualify, and "Cache-Control: no-store" in
+// the request bypasses the cache.
+func Cacheable(req *http.Request) bool {
+	if req.Method != http.MethodGet || req.Header.Get("Range") != "" {
+		return false
+	}
+	_, noStore := cacheControl(req.Header)["no-store"]
+	return !noStore
+}
+
+// wantsRevalidation reports whether a request asks for a response validated
+// with the origin server, as reloading a page does.
+func wantsRevalidation(req *http.Request) bool {
+	directives := cacheControl(req.Header)
+	if _, ok := directives["no-cache"]; ok {
+		return true
+	}
+	if maxAge, ok := directives["max-age"]; ok && maxAge == "0" {
+		return true
+	}
+	return req.Header.Get("Pragma") == "no-cache" && req.Header.Get("Cache-Control") == ""
+}
+
+// lifetime returns how long a response may be stored and served without
+// validation, and whether it may be stored at all.
+//
+// Responses are stored when their status is cacheable and they carry an
+// explicit lifetime or a validator to revalidate them with. Responses marked
+// no-store or private, setting cookies, varying on every header or answering
+// requests with credentials (unless marked public) are never stored, since
+// the cache may be shared by every device using the proxy.
+func lifetime(req *http.Request, resp *http.Response) (time.Duration, bool) {
+	if !cacheableStatus[resp.StatusCode] || resp.Header.Get("Set-Cookie") != "" || resp.Header.Get("Vary") == "*" {
+		return 0, false
+	}
+	directives := cacheControl(resp.Header)
+	for _, d := range []string{"no-store", "private"} {
+		if _, ok := directives[d]; ok {
+			return 0, false
+		}
+	}
+	_, public := directives["public"]
+	_, sMaxAge := directives["s-maxage"]
+	if req.Header.Get("Authorization") != "" && !public && !sMaxAge {
+		return 0, false
+	}
+	validator := resp.Header.Get("ETag") != "" || resp.Header.Get("Last-Modified") != ""
+
+	if _, ok := directives["no-cache"]; ok {
+		return 0, validator
+	}
+	for _, d := range []string{"s-maxage", "max-age"} {
+		if value, ok := directives[d]; ok {
+			seconds, err := strconv.Atoi(value)
+			if err != nil || seconds < 0 {
+				return 0, validator
+			}
+			return time.Duration(seconds) * time.Second, seconds > 0 || validator
+		}
+	}
+
+	date := headerTime(resp.Header, "Date", time.Now())
+	if expires := resp.Header.Get("Expires"); expires != "" {
+		t, err := http.ParseTime(expires)
+		if err != nil || !t.After(date) {
+			return 0, validator
+		}
+		return t.Sub(date), true
+	}
+	if modified := headerTime(resp.Header, "Last-Modified", time.Time{}); !modified.IsZero() && modified.Before(date) {
+		return min(date.Sub(modified)/heuristicFraction, heuristicMax), true
+	}
+	return 0, validator
+}
+
+// cacheControl parses the Cache-Control directives of a header, lowercasing
+// their names. Directives without a value map to "".
+func cacheControl(h http.Header) map[string]string {
+	directives := make(map[string]string)
+	for _, line := range h.Values("Cache-Control") {
+		for _, part := range strings.Split(line, ",") {
+			name, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+			if name != "" {
+				directives[strings.ToLower(name)] = strings.Trim(value, `"`)
+			}
+		}
+	}
+	return directives
+}
+
+// headerTime parses a date header, returning fallback if it is missing or
+// invalid.
+func headerTime(h http.Header, name string, fallback time.Time) time.Time {
+	if t, err := http.ParseTime(h.Get(name)); err == nil {
+		return t
+	}
+	return fallback
+}
+
+// varyValues returns the request header values a response varies on.
+func varyValues(req *http.Request, resp *http.Response) map[string]string {
+	var values map[string]string
+	for _, line := range resp.Header.Values("Vary") {
+		for _, name := range strings.Split(line, ",") {
+			name = http.CanonicalHeaderKey(strings.TrimSpace(name))
+			if name == "" {
+				continue
+			}
+			if values == nil {
+				values = make(map[string]string)
+			}
+			values[name] = strings.Join(req.Header.Values(name), ", ")
+		}
+	}
+	return values
+}
@@ -0,0 +1,26 @@
+package i18n
+
+// catalogES holds the Spanish translations.
+var catalogES = map[string]string{
+	"Mode: %s":  "Modo: %s",
+	"Resolving": "Resolviendo",
+	"Upgrade":   "Actualización",
+	"SSH auth":  "Autenticación SSH",
+	"Listeners": "Puertos locales",
+	"Tunnel established in %s, %s proxy running on port %d":           "Túnel establecido en %s, proxy %s activo en el puerto %d",
+	"%s proxy also running on port %d":                                "proxy %s también activo en el puerto %d",
+	"Shutdown signal received":                                        "Señal de apagado recibida",
+	"Stop requested":                                                  "Detención solicitada",
+	"%s, closing tunnel...":                                           "%s, cerrando el túnel...",
+	"Tunnel closed.":                                                  "Túnel cerrado.",
+	"Tunnel: %s mode, %s proxy on port %d, up %s":                     "Túnel: modo %s, proxy %s en el puerto %d, activo desde hace %s",
+	"Traffic: ↑ %s ↓ %s (%s today), %d active / %d total connections": "Tráfico: ↑ %s ↓ %s (%s hoy), %d conexiones activas / %d en total",
+	"Blocked: %d connections by blocklists":                           "Bloqueadas: %d conexiones por listas de bloqueo",
+	"Debug logging: on":                                               "Registro de depuración: activado",
+	"Transports: none (reconnecting)":                                 "Transportes: ninguno (reconectando)",
+	"Transports:":                                                     "Transportes:",
+	"active":                                                          "activo",
+	"standby":                                                         "en espera",
+	"Resources: %d goroutines, %s open file descriptors, %d SSH channels, %d client connections": "Recursos: %d goroutines, %s descriptores de archivo abiertos, %d canales SSH, %d conexiones de clientes",
+	"unknown": "desconocido",
+}
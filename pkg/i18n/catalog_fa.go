@@ -0,0 +1,27 @@
+package i18n
+
+// catalogFA holds the Persian translations.
+var catalogFA = map[string]string{
+	"Mode: %s":  "حالت: %s",
+	"Resolving": "تفکیک نام",
+	"Upgrade":   "ارتقای اتصال",
+	"SSH auth":  "احراز هویت SSH",
+	"Listeners": "پورت‌های محلی",
+	"Tunnel established in %s, %s proxy running on port %d": "تونل در %s برقرار شد، پروکسی %s روی پورت %d فعال است",
+	"%s proxy also running on port %d":                      "پروکسی %s نیز روی پورت %d فعال است",
+	"Shutdown signal received":                              "سیگنال خاموشی دریافت شد",
+	"Stop requested":                                        "توقف درخواست شد",
+	"%s, closing tunnel...":                                 "%s، در حال بستن تونل...",
+	"Tunnel closed.":                                        "تونل بسته شد.",
+	"Error":                                                 "خطا",
+	"Tunnel: %s mode, %s proxy on port %d, up %s":           "تونل: حالت %s، پروکسی %s روی پورت %d، فعال به مدت %s",
+	"Traffic: ↑ %s ↓ %s (%s today), %d active / %d total connections": "ترافیک: ↑ %s ↓ %s (%s امروز)، %d اتصال فعال / %d در کل",
+	"Blocked: %d connections by blocklists":                           "مسدود شده: %d اتصال توسط فهرست‌های مسدودسازی",
+	"Debug logging: on":                                               "گزارش اشکال‌زدایی: روشن",
+	"Transports: none (reconnecting)":                                 "انتقال‌ها: هیچ (در حال اتصال مجدد)",
+	"Transports:":                                                     "انتقال‌ها:",
+	"active":                                                          "فعال",
+	"standby":                                                         "آماده به کار",
+	"Resources: %d goroutines, %s open file descriptors, %d SSH channels, %d client connections": "منابع: %d گوروتین، %s توصیف‌گر فایل باز، %d کانال SSH، %d اتصال کلاینت",
+	"unknown": "نامعلوم",
+}
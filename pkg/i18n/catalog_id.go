@@ -0,0 +1,25 @@
+package i18n
+
+// catalogID holds the Indonesian translations.
+var catalogID = map[string]string{
+	"Resolving": "Resolusi nama",
+	"SSH auth":  "Autentikasi SSH",
+	"Listeners": "Port lokal",
+	"Tunnel established in %s, %s proxy running on port %d": "Tunnel tersambung dalam %s, proxy %s berjalan di port %d",
+	"%s proxy also running on port %d":                      "proxy %s juga berjalan di port %d",
+	"Shutdown signal received":                              "Sinyal penghentian diterima",
+	"Stop requested":                                        "Penghentian diminta",
+	"%s, closing tunnel...":                                 "%s, menutup tunnel...",
+	"Tunnel closed.":                                        "Tunnel ditutup.",
+	"Error":                                                 "Galat",
+	"Tunnel: %s mode, %s proxy on port %d, up %s":           "Tunnel: mode %s, proxy %s di port %d, aktif selama %s",
+	"Traffic: ↑ %s ↓ %s (%s today), %d active / %d total connections": "Lalu lintas: ↑ %s ↓ %s (%s hari ini), %d koneksi aktif / %d total",
+	"Blocked: %d connections by blocklists":                           "Diblokir: %d koneksi oleh daftar blokir",
+	"Debug logging: on":                                               "Log debug: aktif",
+	"Transports: none (reconnecting)":                                 "Transport: tidak ada (menyambung ulang)",
+	"Transports:":                                                     "Transport:",
+	"active":                                                          "aktif",
+	"standby":                                                         "cadangan",
+	"Resources: %d goroutines, %s open file descriptors, %d SSH channels, %d client connections": "Sumber daya: %d goroutine, %s deskriptor berkas terbuka, %d kanal SSH, %d koneksi klien",
+	"unknown": "tidak diketahui",
+}
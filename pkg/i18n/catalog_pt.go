@@ -0,0 +1,27 @@
+package i18n
+
+// catalogPT holds the Portuguese translations.
+var catalogPT = map[string]string{
+	"Mode: %s":  "Modo: %s",
+	"Resolving": "Resolvendo",
+	"Upgrade":   "Atualização",
+	"SSH auth":  "Autenticação SSH",
+	"Listeners": "Portas locais",
+	"Tunnel established in %s, %s proxy running on port %d": "Túnel estabelecido em %s, proxy %s ativo na porta %d",
+	"%s proxy also running on port %d":                      "proxy %s também ativo na porta %d",
+	"Shutdown signal received":                              "Sinal de encerramento recebido",
+	"Stop requested":                                        "Parada solicitada",
+	"%s, closing tunnel...":                                 "%s, fechando o túnel...",
+	"Tunnel closed.":                                        "Túnel fechado.",
+	"Error":                                                 "Erro",
+	"Tunnel: %s mode, %s proxy on port %d, up %s":           "Túnel: modo %s, proxy %s na porta %d, ativo há %s",
+	"Traffic: ↑ %s ↓ %s (%s today), %d active / %d total connections": "Tráfego: ↑ %s ↓ %s (%s hoje), %d conexões ativas / %d no total",
+	"Blocked: %d connections by blocklists":                           "Bloqueadas: %d conexões por listas de bloqueio",
+	"Debug logging: on":                                               "Registro de depuração: ativado",
+	"Transports: none (reconnecting)":                                 "Transportes: nenhum (reconectando)",
+	"Transports:":                                                     "Transportes:",
+	"active":                                                          "ativo",
+	"standby":                                                         "em espera",
+	"Resources: %d goroutines, %s open file descriptors, %d SSH channels, %d client connections": "Recursos: %d goroutines, %s descritores de arquivo abertos, %d canais SSH, %d conexões de clientes",
+	"unknown": "desconhecido",
+}
@@ -0,0 +1,122 @@
+// Package i18n translates the messages Tunn prints for people.
+//
+// Messages are looked up by their English text, as with gettext, so any
+// message without a translation is printed in English. A translation is a
+// fmt format string and may reorder the arguments of the English message with
+// explicit indexes such as %[2]s.
+//
+// Only the summary output meant for people is translated: the connection
+// phases and summary, shutdown messages, error prefixes and "tunn status".
+// Detailed log lines (--log-format plain), JSON output and configuration keys
+// stay in English so logs and bug reports remain comparable.
+//
+// The language is selected process-wide with SetLanguage, by default from the
+// usual locale variables (see Detect).
+package i18n
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+	"sync/atomic"
+)
+
+// catalogs holds the translations by language code. English needs no catalog.
+var catalogs = map[string]map[string]string{
+	"es": catalogES,
+	"pt": catalogPT,
+	"id": catalogID,
+	"fa": catalogFA,
+}
+
+// current is the catalog in use, nil for English.
+var current atomic.Pointer[map[string]string]
+
+// Languages returns the supported language codes, English first.
+func Languages() []string {
+	langs := make([]string, 0, len(catalogs)+1)
+	for lang := range catalogs {
+		langs = append(langs, lang)
+	}
+	sort.Strings(langs)
+	return append([]string{"en"}, langs...)
+}
+
+// SetLanguage selects the language for the whole process.
+//
+// Parameters:
+//   - lang: A language code such as "es", or a locale such as "pt_BR.UTF-8";
+//     empty, "C" and "POSIX" select English
+//
+// Returns:
+//   - error: An error if the language is not supported; English stays selected
+func SetLanguage(lang string) error {
+	code := baseLanguage(lang)
+	if code == "en" {
+		current.Store(nil)
+		return nil
+	}
+	catalog, ok := catalogs[code]
+	if !ok {
+		current.Store(nil)
+		return fmt.Errorf("unsupported language '%s', must be one of: %s", lang, strings.Join(Languages(), ", "))
+	}
+	current.Store(&catalog)
+	return nil
+}
+
+// Detect returns the language of the user's locale from LC_ALL, LC_MESSAGES
+// or LANG, the first one set taking precedence as in the C library. Locales
+// without a catalog fall back to English.
+//
+// Returns:
+//   - string: A supported language code
+func Detect() string {
+	for _, name := range []string{"LC_ALL", "LC_MESSAGES", "LANG"} {
+		if value := os.Getenv(name); value != "" {
+			code := baseLanguage(value)
+			if slices.Contains(Languages(), code) {
+				return code
+			}
+			return "en"
+		}
+	}
+	return "en"
+}
+
+// T returns the translation of an English message, or the message itself.
+//
+// Parameters:
+//   - message: The English message or format string
+//
+// Returns:
+//   - string: The message in the selected language
+func T(message string) string {
+	if catalog := current.Load(); catalog != nil {
+		if translated, ok := (*catalog)[message]; ok {
+			return translated
+		}
+	}
+	return message
+}
+
+// Printf prints a message translated with T. Trailing newlines are not part of
+// the message looked up.
+func Printf(format string, args ...any) {
+	message := strings.TrimRight(format, "\n")
+	fmt.Printf(T(message)+format[len(message):], args...)
+}
+
+// baseLanguage reduces a locale such as "pt_BR.UTF-8" to its language code.
+func baseLanguage(locale string) string {
+	locale, _, _ = strings.Cut(locale, ".")
+	locale, _, _ = strings.Cut(locale, "@")
+	code, _, _ := strings.Cut(strings.ReplaceAll(locale, "-", "_"), "_")
+	code = strings.ToLower(code)
+	if code == "" || code == "c" || code == "posix" {
+		return "en"
+	}
+	return code
+}
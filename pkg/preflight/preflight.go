@@ -0,0 +1,197 @@
+// Package preflight detects conflicts with other software before and while
+// the tunnel starts.
+//
+// Low-level errors such as "bind: address already in use" do not say what is
+// wrong or what to do about it. The checks in this package look for the usual
+// causes — another proxy holding the port, a VPN that already routes all
+// traffic, proxy environment variables pointing elsewhere or back at the
+// tunnel — and describe them with a suggested remedy.
+package preflight
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Conflict is a problem with other software found before starting.
+type Conflict struct {
+	Message string // What was found
+	Remedy  string // How to resolve it
+}
+
+// proxyVariables lists the environment variables programs read their proxy from.
+var proxyVariables = []string{"ALL_PROXY", "HTTPS_PROXY", "HTTP_PROXY", "all_proxy", "https_proxy", "http_proxy"}
+
+// Check looks for software that conflicts with a tunnel whose proxies listen
+// on the given ports.
+//
+// Conflicts found:
+//   - A VPN interface that already routes all traffic (Linux only)
+//   - Proxy environment variables that point at one of the tunnel's own ports,
+//     which makes the requests Tunn sends while not connected loop back into it
+//   - Proxy environment variables that point at another proxy, so programs
+//     honoring them bypass the tunnel
+//
+// Parameters:
+//   - ports: The local proxy ports of the tunnel, the main listener first
+//
+// Returns:
+//   - []Conflict: The conflicts found, empty if none
+func Check(ports []int) []Conflict {
+	var conflicts []Conflict
+	if iface := vpnDefaultRoute(); iface != "" {
+		conflicts = append(conflicts, Conflict{
+			Message: fmt.Sprintf("a VPN on %s already routes all traffic, so the SSH connection goes through it", iface),
+			Remedy:  "disconnect the VPN, or exclude the SSH server from it, if connecting fails or is slow",
+		})
+	}
+
+	for _, name := range proxyVariables {
+		value := os.Getenv(name)
+		if value == "" {
+			continue
+		}
+		if port, ok := pointsAtPorts(value, ports); ok {
+			conflicts = append(conflicts, Conflict{
+				Message: fmt.Sprintf("%s points at the tunnel's own port %d, so requests Tunn makes while not connected (hook URLs, remote config files) would loop back into it", name, port),
+				Remedy:  fmt.Sprintf("unset %s when starting tunn, and set it only for the programs that should use the tunnel", name),
+			})
+		} else {
+			conflicts = append(conflicts, Conflict{
+				Message: fmt.Sprintf("%s is set to %s, so programs honoring it use that proxy instead of the tunnel", name, redactProxy(value)),
+				Remedy:  fmt.Sprintf("point %s at 127.0.0.1:%d, or unset it", name, ports[0]),
+			})
+		}
+		// The first variable found is the one most programs use
+		break
+	}
+	return conflicts
+}
+
+// pointsAtPorts returns the port among ports that a proxy URL points at on a
+// loopback address, if any.
+func pointsAtPorts(value string, ports []int) (int, bool) {
+	for _, port := range ports {
+		if pointsAtPort(value, port) {
+			return port, true
+		}
+	}
+	return 0, false
+}
+
+// pointsAtPort reports whether a proxy URL names a loopback address and the
+// given port.
+func pointsAtPort(value string, port int) bool {
+	if !strings.Contains(value, "://") {
+		value = "http://" + value
+	}
+	u, err := url.Parse(value)
+	if err != nil || u.Port() != strconv.Itoa(port) {
+		return false
+	}
+	host := u.Hostname()
+	ip := net.ParseIP(host)
+	return host == "localhost" || ip != nil && (ip.IsLoopback() || ip.IsUnspecified())
+}
+
+// redactProxy drops credentials from a proxy URL.
+func redactProxy(value string) string {
+	if u, err := url.Parse(value); err == nil && u.User != nil {
+		u.User = nil
+		return u.String()
+	}
+	return value
+}
+
+// PortInUse explains an error binding a listen address when the address is
+// already in use, naming what holds it when that can be found out.
+//
+// Parameters:
+//   - err: The error returned by net.Listen or net.ListenPacket
+//   - address: The address that was bound, e.g. "127.0.0.1:1080"
+//   - setting: The configuration setting choosing the port, e.g. "listener.port"
+//
+// Returns:
+//   - error: A descriptive error wrapping err, or err itself when the address
+//     was not in use
+func PortInUse(err error, address, setting string) error {
+	if !addressInUse(err) {
+		return err
+	}
+	_, portText, _ := net.SplitHostPort(address)
+	port, _ := strconv.Atoi(portText)
+
+	holder := "another program (another tunn still running?)"
+	if owner := portOwner(port); owner != "" {
+		holder = owner
+	}
+	if protocol := probe(address); protocol != "" {
+		holder += ", which answers as " + protocol
+	}
+	return fmt.Errorf("port %d is already in use by %s; stop it or set %s to a free port: %w",
+		port, holder, setting, err)
+}
+
+// addressInUse reports whether an error is EADDRINUSE, including its Windows
+// form.
+func addressInUse(err error) bool {
+	if errors.Is(err, syscall.EADDRINUSE) {
+		return true
+	}
+	text := err.Error()
+	return strings.Contains(text, "address already in use") || strings.Contains(text, "Only one usage of each socket address")
+}
+
+// probe connects to a listening address and tells from its answers to a
+// SOCKS5 greeting and an HTTP request whether a proxy is listening there.
+//
+// Returns:
+//   - string: "a SOCKS5 proxy", "an HTTP server or proxy", or "" when unknown
+func probe(address string) string {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return ""
+	}
+	if ip := net.ParseIP(host); ip == nil || ip.IsUnspecified() {
+		host = "127.0.0.1"
+	}
+	address = net.JoinHostPort(host, port)
+
+	// A SOCKS5 greeting offering no authentication
+	if reply := exchange(address, []byte{5, 1, 0}, 2); len(reply) == 2 && reply[0] == 5 {
+		return "a SOCKS5 proxy"
+	}
+	if reply := exchange(address, []byte("OPTIONS * HTTP/1.0\r\n\r\n"), 5); string(reply) == "HTTP/" {
+		return "an HTTP server or proxy"
+	}
+	return ""
+}
+
+// exchange sends a message to an address and reads the first bytes of the
+// answer, giving up after a second.
+//
+// Returns:
+//   - []byte: The first n bytes of the answer, or fewer if it ended early
+func exchange(address string, message []byte, n int) []byte {
+	conn, err := net.DialTimeout("tcp", address, time.Second)
+	if err != nil {
+		return nil
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(time.Second))
+
+	if _, err := conn.Write(message); err != nil {
+		return nil
+	}
+	reply := make([]byte, n)
+	read, _ := io.ReadFull(conn, reply)
+	return reply[:read]
+}
@@ -0,0 +1,110 @@
+//go:build linux
+
+package preflight
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// vpnPrefixes lists name prefixes of network interfaces created by VPNs.
+var vpnPrefixes = []string{"tun", "tap", "wg", "ppp", "ipsec", "vpn", "nordlynx", "utun"}
+
+// vpnDefaultRoute returns the VPN interface routing all IPv4 traffic, either
+// through the default route or the pair of /1 routes OpenVPN installs, or an
+// empty string.
+func vpnDefaultRoute() string {
+	f, err := os.Open("/proc/net/route")
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Scan() // Header
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 8 {
+			continue
+		}
+		iface, dest, mask := fields[0], fields[1], fields[7]
+		allTraffic := dest == "00000000" && mask == "00000000" ||
+			(dest == "00000000" || dest == "00000080") && mask == "00000080"
+		if !allTraffic {
+			continue
+		}
+		for _, prefix := range vpnPrefixes {
+			if strings.HasPrefix(iface, prefix) {
+				return iface
+			}
+		}
+	}
+	return ""
+}
+
+// portOwner names the process listening on a TCP or UDP port, e.g.
+// "ssh (pid 1234)". Processes of other users are only found when running as
+// root.
+//
+// Returns:
+//   - string: The process, or "" if it cannot be found
+func portOwner(port int) string {
+	inodes := make(map[string]bool)
+	for _, table := range []struct{ path, state string }{
+		{"/proc/net/tcp", "0A"}, {"/proc/net/tcp6", "0A"}, // LISTEN
+		{"/proc/net/udp", "07"}, {"/proc/net/udp6", "07"}, // Unconnected
+	} {
+		socketInodes(table.path, table.state, port, inodes)
+	}
+	if len(inodes) == 0 {
+		return ""
+	}
+
+	fds, _ := filepath.Glob("/proc/[0-9]*/fd/*")
+	for _, fd := range fds {
+		link, err := os.Readlink(fd)
+		if err != nil || !strings.HasPrefix(link, "socket:[") {
+			continue
+		}
+		if !inodes[strings.TrimSuffix(strings.TrimPrefix(link, "socket:["), "]")] {
+			continue
+		}
+		pidDir := filepath.Dir(filepath.Dir(fd))
+		comm, err := os.ReadFile(filepath.Join(pidDir, "comm"))
+		if err != nil {
+			continue
+		}
+		return fmt.Sprintf("%s (pid %s)", strings.TrimSpace(string(comm)), filepath.Base(pidDir))
+	}
+	return ""
+}
+
+// socketInodes adds the inodes of the sockets in a /proc/net table that are
+// bound to a local port and in the given state.
+func socketInodes(path, state string, port int, inodes map[string]bool) {
+	f, err := os.Open(path)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Scan() // Header
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 10 || fields[3] != state {
+			continue
+		}
+		_, hexPort, ok := strings.Cut(fields[1], ":")
+		if !ok {
+			continue
+		}
+		if p, err := strconv.ParseUint(hexPort, 16, 16); err == nil && int(p) == port {
+			inodes[fields[9]] = true
+		}
+	}
+}
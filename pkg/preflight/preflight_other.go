@@ -0,0 +1,13 @@
+//go:build !linux
+
+package preflight
+
+// vpnDefaultRoute is not implemented on this platform.
+func vpnDefaultRoute() string {
+	return ""
+}
+
+// portOwner is not implemented on this platform.
+func portOwner(port int) string {
+	return ""
+}
@@ -0,0 +1,185 @@
+// Package presets provides a catalog of known-good connection settings.
+//
+// A preset bundles the settings that depend on the network rather than on the
+// account: tunnel mode, port, HTTP payload, TLS server name (SNI) and ALPN.
+// A small set of generic presets is built in; users extend or override it with
+// their own catalog file, typically collecting combinations that work on their
+// ISP or network type.
+//
+// The user catalog is a JSON array of presets stored in presets.json in the
+// tunn configuration directory (for example ~/.config/tunn/presets.json).
+package presets
+
+import (
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"tunn/pkg/config"
+)
+
+//go:embed catalog.json
+var builtinCatalog []byte
+
+// Preset is a named set of network-specific connection settings.
+type Preset struct {
+	Name        string   `json:"name"`                  // Unique preset name
+	Description string   `json:"description,omitempty"` // Human-readable summary
+	Network     string   `json:"network,omitempty"`     // Network type the preset is meant for, e.g. "mobile"
+	Mode        string   `json:"mode"`                  // Tunnel mode: "direct" or "proxy"
+	Port        int      `json:"port,omitempty"`        // SSH (or front) port
+	ProxyHost   string   `json:"proxyHost,omitempty"`   // Proxy host for proxy mode
+	ProxyPort   string   `json:"proxyPort,omitempty"`   // Proxy port for proxy mode
+	HTTPPayload string   `json:"httpPayload,omitempty"` // WebSocket upgrade payload
+	ServerName  string   `json:"serverName,omitempty"`  // TLS server name (SNI)
+	ALPN        []string `json:"alpn,omitempty"`        // TLS ALPN protocols
+
+	BuiltIn bool `json:"-"` // Whether the preset comes from the built-in catalog
+}
+
+// UserCatalogPath returns the path of the user preset catalog.
+//
+// Returns:
+//   - string: Path of presets.json in the tunn configuration directory
+//   - error: An error if the configuration directory cannot be determined
+func UserCatalogPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to locate config directory: %w", err)
+	}
+	return filepath.Join(dir, "tunn", "presets.json"), nil
+}
+
+// Load returns the built-in presets merged with the user catalog.
+//
+// User presets with the same name as a built-in preset replace it. A missing
+// user catalog is not an error.
+//
+// Returns:
+//   - []Preset: All presets sorted by name
+//   - error: An error if a catalog cannot be read or parsed
+func Load() ([]Preset, error) {
+	var builtin []Preset
+	if err := json.Unmarshal(builtinCatalog, &builtin); err != nil {
+		return nil, fmt.Errorf("invalid built-in preset catalog: %w", err)
+	}
+
+	byName := make(map[string]Preset, len(builtin))
+	for _, p := range builtin {
+		p.BuiltIn = true
+		byName[p.Name] = p
+	}
+
+	path, err := UserCatalogPath()
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("failed to read preset catalog: %w", err)
+	}
+	if err == nil {
+		var user []Preset
+		if err := json.Unmarshal(data, &user); err != nil {
+			return nil, fmt.Errorf("failed to parse preset catalog %s: %w", path, err)
+		}
+		for i, p := range user {
+			if p.Name == "" {
+				return nil, fmt.Errorf("preset %d in %s has no name", i+1, path)
+			}
+			byName[p.Name] = p
+		}
+	}
+
+	list := make([]Preset, 0, len(byName))
+	for _, p := range byName {
+		list = append(list, p)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list, nil
+}
+
+// Find returns the preset with the given name.
+//
+// Parameters:
+//   - name: The preset name
+//
+// Returns:
+//   - *Preset: The preset
+//   - error: An error if the catalogs cannot be loaded or the preset does not exist
+func Find(name string) (*Preset, error) {
+	list, err := Load()
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range list {
+		if p.Name == name {
+			return &p, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown preset '%s' (see 'tunn preset list')", name)
+}
+
+// Apply copies the preset settings into a configuration.
+//
+// Only network-specific settings are changed; credentials, listener and other
+// settings are left as they are.
+//
+// Parameters:
+//   - cfg: The configuration to update in place
+func (p *Preset) Apply(cfg *config.Config) {
+	cfg.Mode = p.Mode
+	if p.Port != 0 {
+		cfg.SSH.Port = p.Port
+	}
+	if p.Mode == "proxy" {
+		if p.ProxyHost != "" {
+			cfg.ProxyHost = p.ProxyHost
+		}
+		if p.ProxyPort != "" {
+			cfg.ProxyPort = p.ProxyPort
+		}
+	}
+	cfg.HTTPPayload = p.HTTPPayload
+	cfg.TLS.ServerName = p.ServerName
+	cfg.TLS.ALPN = p.ALPN
+}
+
+// Settings returns the preset as a partial configuration document, suitable for
+// merging into an existing configuration file without touching other keys.
+//
+// Returns:
+//   - map[string]interface{}: The configuration keys set by the preset
+func (p *Preset) Settings() map[string]interface{} {
+	settings := map[string]interface{}{
+		"mode":        p.Mode,
+		"httpPayload": p.HTTPPayload,
+	}
+	if p.Port != 0 {
+		settings["ssh"] = map[string]interface{}{"port": p.Port}
+	}
+	if p.Mode == "proxy" {
+		if p.ProxyHost != "" {
+			settings["proxyHost"] = p.ProxyHost
+		}
+		if p.ProxyPort != "" {
+			settings["proxyPort"] = p.ProxyPort
+		}
+	}
+
+	tls := map[string]interface{}{}
+	if p.ServerName != "" {
+		tls["serverName"] = p.ServerName
+	}
+	if len(p.ALPN) > 0 {
+		tls["alpn"] = p.ALPN
+	}
+	if len(tls) > 0 {
+		settings["tls"] = tls
+	}
+	return settings
+}
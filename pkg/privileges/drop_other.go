@@ -0,0 +1,10 @@
+//go:build !unix
+
+package privileges
+
+import "fmt"
+
+// Drop is not supported on this platform.
+func Drop(id Identity) error {
+	return fmt.Errorf("switching users is only supported on Unix systems")
+}
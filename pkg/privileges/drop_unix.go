@@ -0,0 +1,41 @@
+//go:build unix
+
+package privileges
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// Drop switches the whole process to an unprivileged identity for good: the
+// supplementary groups are cleared and the group and user IDs, real, effective
+// and saved, are set to the identity's, so root cannot be regained.
+//
+// Parameters:
+//   - id: The identity to run as
+//
+// Returns:
+//   - error: An error if the process is not running as root or the switch fails
+func Drop(id Identity) error {
+	if os.Geteuid() != 0 {
+		return fmt.Errorf("cannot switch to %s: not running as root", id)
+	}
+
+	// Groups first, since changing them requires root
+	if err := syscall.Setgroups([]int{id.GID}); err != nil {
+		return fmt.Errorf("failed to set supplementary groups: %w", err)
+	}
+	if err := syscall.Setgid(id.GID); err != nil {
+		return fmt.Errorf("failed to set group ID %d: %w", id.GID, err)
+	}
+	if err := syscall.Setuid(id.UID); err != nil {
+		return fmt.Errorf("failed to set user ID %d: %w", id.UID, err)
+	}
+
+	// Refuse to go on if root could be regained
+	if syscall.Setuid(0) == nil {
+		return fmt.Errorf("privileges were not dropped: user ID 0 can still be restored")
+	}
+	return nil
+}
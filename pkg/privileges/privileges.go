@@ -0,0 +1,76 @@
+// Package privileges drops root privileges once the resources that need them
+// are set up.
+//
+// Binding ports below 1024 requires root on most Unix systems, but nothing the
+// tunnel does afterwards does. Switching to an unprivileged user once the
+// listeners are bound limits what a bug in the long-running proxy code could
+// be used for.
+package privileges
+
+import (
+	"fmt"
+	"os/user"
+	"strconv"
+	"strings"
+)
+
+// Identity is the user and group to run as.
+type Identity struct {
+	User  string // User name or numeric ID, for messages
+	Group string // Group name or numeric ID, for messages
+	UID   int    // User ID
+	GID   int    // Group ID
+}
+
+// Lookup resolves a "user" or "user:group" specification. Names and numeric
+// IDs are both accepted; without a group, the user's primary group is used.
+//
+// Parameters:
+//   - spec: The user and optional group
+//
+// Returns:
+//   - Identity: The resolved user and group
+//   - error: An error if the user or group does not exist, or the user is root
+func Lookup(spec string) (Identity, error) {
+	name, group, hasGroup := strings.Cut(spec, ":")
+	if name == "" || (hasGroup && group == "") {
+		return Identity{}, fmt.Errorf("invalid user '%s', must be user or user:group", spec)
+	}
+
+	u, err := user.Lookup(name)
+	if err != nil {
+		if u, err = user.LookupId(name); err != nil {
+			return Identity{}, fmt.Errorf("unknown user '%s'", name)
+		}
+	}
+	id := Identity{User: u.Username}
+	if id.UID, err = strconv.Atoi(u.Uid); err != nil {
+		return Identity{}, fmt.Errorf("user '%s' has a non-numeric ID %s", name, u.Uid)
+	}
+	if id.UID == 0 {
+		return Identity{}, fmt.Errorf("user '%s' is root", name)
+	}
+
+	gid := u.Gid
+	id.Group = gid
+	if hasGroup {
+		g, err := user.LookupGroup(group)
+		if err != nil {
+			if g, err = user.LookupGroupId(group); err != nil {
+				return Identity{}, fmt.Errorf("unknown group '%s'", group)
+			}
+		}
+		gid, id.Group = g.Gid, g.Name
+	} else if g, err := user.LookupGroupId(gid); err == nil {
+		id.Group = g.Name
+	}
+	if id.GID, err = strconv.Atoi(gid); err != nil {
+		return Identity{}, fmt.Errorf("group '%s' has a non-numeric ID %s", id.Group, gid)
+	}
+	return id, nil
+}
+
+// String returns the identity as "user:group".
+func (id Identity) String() string {
+	return id.User + ":" + id.Group
+}
@@ -0,0 +1,133 @@
+// Package progress reports the phases of establishing a tunnel.
+//
+// Two output formats are supported, selected process-wide with SetFormat:
+//   - "pretty" (the default): one line per phase of a connection attempt
+//     (resolving, TCP, TLS, upgrade, SSH auth and listeners) with the time it
+//     took, followed by a summary once the tunnel is up
+//   - "plain": the detailed log line of every step instead, which suits log
+//     files and bug reports
+//
+// Each phase is reported by the code performing it together with its own start
+// time, so attempts running in parallel, as over multipath uplinks, do not
+// need to share any state.
+package progress
+
+import (
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
+
+	"tunn/pkg/color"
+	"tunn/pkg/debuglog"
+	"tunn/pkg/i18n"
+)
+
+// Phases of establishing a tunnel, in order.
+const (
+	Resolve   = "Resolving"
+	TCP       = "TCP"
+	TLS       = "TLS"
+	Upgrade   = "Upgrade"
+	Auth      = "SSH auth"
+	Listeners = "Listeners"
+)
+
+// Formats accepted by SetFormat.
+const (
+	FormatPretty = "pretty"
+	FormatPlain  = "plain"
+)
+
+// plain selects the plain format when set.
+var plain atomic.Bool
+
+// SetFormat selects the output format for the whole process.
+//
+// Parameters:
+//   - format: FormatPretty or FormatPlain
+//
+// Returns:
+//   - error: An error if the format is unknown
+func SetFormat(format string) error {
+	switch format {
+	case FormatPretty:
+		plain.Store(false)
+	case FormatPlain:
+		plain.Store(true)
+	default:
+		return fmt.Errorf("invalid log format '%s', must be one of: %s, %s", format, FormatPretty, FormatPlain)
+	}
+	return nil
+}
+
+// Plain reports whether the plain format is selected.
+func Plain() bool {
+	return plain.Load()
+}
+
+// Printf prints a detailed log line in the plain format only; in the pretty
+// format the phase lines stand in for it unless debug logging is on.
+func Printf(format string, args ...any) {
+	if plain.Load() || debuglog.Enabled() {
+		fmt.Printf(format, args...)
+	}
+}
+
+// Println prints a detailed log line in the plain format only, or with debug
+// logging on.
+func Println(args ...any) {
+	if plain.Load() || debuglog.Enabled() {
+		fmt.Println(args...)
+	}
+}
+
+// Step reports a completed phase in the pretty format.
+//
+// Parameters:
+//   - phase: The phase, one of the phase constants
+//   - detail: What the phase dealt with, such as the address connected to
+//   - start: When the phase started
+//   - err: The error the phase failed with, or nil
+func Step(phase, detail string, start time.Time, err error) {
+	if plain.Load() {
+		return
+	}
+	glyph := "✓"
+	if err != nil {
+		glyph = "✗"
+	}
+	fmt.Printf("  %s %s %-44s %7s\n", color.Glyph(glyph), pad(i18n.T(phase), phaseWidth()), detail, Elapsed(time.Since(start)))
+}
+
+// phases lists the phase constants for aligning the phase column.
+var phases = []string{Resolve, TCP, TLS, Upgrade, Auth, Listeners}
+
+// phaseWidth returns the width of the phase column: the longest phase name in
+// the selected language, at least ten characters.
+func phaseWidth() int {
+	width := 10
+	for _, phase := range phases {
+		width = max(width, utf8.RuneCountInString(i18n.T(phase)))
+	}
+	return width
+}
+
+// pad pads text with spaces to a width in characters, unlike the %-10s verb
+// which counts bytes and misaligns translated phase names.
+func pad(s string, width int) string {
+	if n := utf8.RuneCountInString(s); n < width {
+		return s + strings.Repeat(" ", width-n)
+	}
+	return s
+}
+
+// Elapsed formats a duration for progress output, in milliseconds below ten
+// seconds and in tenths of a second above.
+func Elapsed(d time.Duration) string {
+	if d < 10*time.Second {
+		return fmt.Sprintf("%dms", d.Milliseconds())
+	}
+	return d.Round(100 * time.Millisecond).String()
+}
@@ -0,0 +1,260 @@
+package proxy
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+
+	"tunn/pkg/redact"
+	"tunn/pkg/stats"
+	"tunn/pkg/utils"
+)
+
+// rangeChunk is the size of each ranged sub-request of an accelerated download.
+const rangeChunk = 1 << 20
+
+// accelerator holds the settings of the download accelerator.
+type accelerator struct {
+	parts   int   // Ranged requests in flight per download
+	minSize int64 // Smallest response in bytes that is split
+}
+
+// SetAccelerator splits large GET responses into ranged sub-requests fetched
+// over several SSH channels at once, for servers that throttle each
+// connection. It must be called before the proxy is started.
+//
+// Parameters:
+//   - parts: Ranged requests in flight per download
+//   - minSize: Smallest response in bytes that is split
+func (h *HTTP) SetAccelerator(parts int, minSize int64) {
+	h.accel = &accelerator{parts: parts, minSize: minSize}
+}
+
+// accelerable reports whether a request may be answered with an accelerated
+// download: a GET without a body that does not ask for a range itself.
+func accelerable(req *http.Request) bool {
+	return req.Method == http.MethodGet && req.Header.Get("Range") == "" && req.ContentLength <= 0
+}
+
+// forwardAccelerated streams the response to a forwarded GET request back to
+// the client, fetching the body as parallel ranges when the response allows.
+//
+// The response qualifies when it is a 200 with a known length of at least the
+// minimum size, the server announces "Accept-Ranges: bytes" and a validator
+// (a strong ETag or Last-Modified) identifies the content. The headers are
+// passed on unchanged and the first chunk is read from the original response,
+// whose channel is then closed. The remaining chunks are requested with Range
+// and If-Range by parts workers, each over its own SSH channel kept alive
+// between chunks, and written to the client in order. Other responses are
+// passed through like forwardResponse does.
+//
+// When a chunk cannot be fetched twice, for example because the content
+// changed and the server answers If-Range with the full response, the client
+// connection is closed and the client sees a truncated download.
+//
+// Parameters:
+//   - clientConn: The client connection to send the response to
+//   - sshConn: The SSH channel the request was forwarded over
+//   - req: The forwarded request
+//   - names: The header names of the request as the client wrote them
+//   - host, port, path: The parsed target of the request
+//
+// Returns:
+//   - int: The status code of the response, 0 if none was received
+func (h *HTTP) forwardAccelerated(clientConn, sshConn net.Conn, req *http.Request, names []string, host string, port int, path string) int {
+	out := &statusWriter{w: h.preconnectHints(&stats.CountingWriter{W: clientConn, Count: h.server.stats.AddDown})}
+
+	raw := &headerRecorder{}
+	reader := bufio.NewReader(io.TeeReader(sshConn, raw))
+	resp, err := http.ReadResponse(reader, req)
+	if err != nil || !raw.done {
+		fmt.Printf("✗ Error reading HTTP response: %v\n", err)
+		h.sendError(clientConn, 502, "Bad Gateway")
+		return 502
+	}
+
+	validator := rangeValidator(resp)
+	if resp.StatusCode != http.StatusOK || resp.ContentLength < max(h.accel.minSize, 2*rangeChunk) ||
+		resp.Header.Get("Accept-Ranges") != "bytes" || validator == "" || len(resp.TransferEncoding) > 0 {
+		// Pass the response through as received
+		out.Write(raw.block)
+		if _, err := io.Copy(out, reader); err != nil && err != io.EOF {
+			fmt.Printf("✗ Error forwarding HTTP response: %v\n", err)
+		}
+		return out.code
+	}
+
+	fmt.Printf("→ Accelerating download of %s from %s:%d%s in %d parts\n",
+		utils.FormatBytes(resp.ContentLength), host, port, redact.URL(path), h.accel.parts)
+	if _, err := out.Write(raw.block); err != nil {
+		return out.code
+	}
+	if _, err := io.CopyN(out, reader, rangeChunk); err != nil {
+		fmt.Printf("✗ Error forwarding HTTP response: %v\n", err)
+		return out.code
+	}
+	sshConn.Close()
+
+	if err := h.fetchRanges(out, req, names, host, port, path, validator, rangeChunk, resp.ContentLength); err != nil {
+		fmt.Printf("✗ Accelerated download of %s:%d%s failed: %v\n", host, port, redact.URL(path), err)
+		clientConn.Close()
+		return out.code
+	}
+	fmt.Printf("✓ Accelerated download of %s:%d%s complete\n", host, port, redact.URL(path))
+	return out.code
+}
+
+// rangeValidator returns the value for an If-Range header identifying the
+// content of a response: its ETag when strong, otherwise its Last-Modified
+// date, or an empty string when it has neither.
+func rangeValidator(resp *http.Response) string {
+	if etag := resp.Header.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+		return etag
+	}
+	return resp.Header.Get("Last-Modified")
+}
+
+// rangeResult is a fetched chunk of an accelerated download.
+type rangeResult struct {
+	data []byte
+	err  error
+}
+
+// fetchRanges fetches bytes start to total-1 of a response as consecutive
+// chunks over parallel SSH channels and writes them to out in order.
+//
+// At most twice as many chunks as there are workers are fetched ahead of the
+// one being written, which bounds the memory a download uses.
+//
+// Parameters:
+//   - out: The writer the chunks are written to in order
+//   - req, names, host, port, path: The original request and its target
+//   - validator: The If-Range value identifying the content
+//   - start, total: The first byte to fetch and the length of the content
+//
+// Returns:
+//   - error: An error if a chunk could not be fetched or written
+func (h *HTTP) fetchRanges(out io.Writer, req *http.Request, names []string, host string, port int, path, validator string, start, total int64) error {
+	count := int((total - start + rangeChunk - 1) / rangeChunk)
+	results := make([]chan rangeResult, count)
+	for i := range results {
+		results[i] = make(chan rangeResult, 1)
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+	window := make(chan struct{}, 2*h.accel.parts)
+	jobs := make(chan int)
+	go func() {
+		defer close(jobs)
+		for i := 0; i < count; i++ {
+			select {
+			case window <- struct{}{}:
+			case <-done:
+				return
+			}
+			select {
+			case jobs <- i:
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	for w := 0; w < h.accel.parts; w++ {
+		go func() {
+			var conn *rangeConn
+			defer func() { conn.close() }()
+			for i := range jobs {
+				from := start + int64(i)*rangeChunk
+				to := min(from+rangeChunk, total) - 1
+				data, err := h.fetchRange(&conn, req, names, host, port, path, validator, from, to)
+				if err != nil {
+					// Retry once over a fresh channel
+					conn.close()
+					conn = nil
+					data, err = h.fetchRange(&conn, req, names, host, port, path, validator, from, to)
+				}
+				results[i] <- rangeResult{data: data, err: err}
+			}
+		}()
+	}
+
+	for i := 0; i < count; i++ {
+		result := <-results[i]
+		if result.err != nil {
+			return result.err
+		}
+		if _, err := out.Write(result.data); err != nil {
+			return err
+		}
+		<-window
+	}
+	return nil
+}
+
+// rangeConn is an SSH channel kept alive between the ranged requests of a
+// worker.
+type rangeConn struct {
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+// close closes the channel, if any.
+func (c *rangeConn) close() {
+	if c != nil {
+		c.conn.Close()
+	}
+}
+
+// fetchRange requests bytes from to to of the content of a request, opening
+// a channel first when conn holds none.
+//
+// Returns:
+//   - []byte: The requested bytes
+//   - error: An error if the channel fails or the server does not answer
+//     with exactly the requested range of the same content
+func (h *HTTP) fetchRange(conn **rangeConn, req *http.Request, names []string, host string, port int, path, validator string, from, to int64) ([]byte, error) {
+	if *conn == nil {
+		sshConn, err := h.server.DialSSH(host, port)
+		if err != nil {
+			return nil, err
+		}
+		*conn = &rangeConn{conn: sshConn, reader: bufio.NewReader(sshConn)}
+	}
+
+	sub := req.Clone(req.Context())
+	sub.Proto, sub.ProtoMajor, sub.ProtoMinor = "HTTP/1.1", 1, 1
+	sub.Body, sub.ContentLength = nil, 0
+	sub.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", from, to))
+	sub.Header.Set("If-Range", validator)
+	sub.Header.Set("Connection", "keep-alive")
+	if err := h.forwardRequest((*conn).conn, sub, names, path); err != nil {
+		return nil, err
+	}
+
+	resp, err := http.ReadResponse((*conn).reader, sub)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusPartialContent {
+		return nil, fmt.Errorf("server answered range %d-%d with status %d, the content may have changed", from, to, resp.StatusCode)
+	}
+	if !strings.HasPrefix(resp.Header.Get("Content-Range"), fmt.Sprintf("bytes %d-%d/", from, to)) {
+		return nil, fmt.Errorf("server answered range %d-%d with %q", from, to, resp.Header.Get("Content-Range"))
+	}
+
+	data := make([]byte, to-from+1)
+	if _, err := io.ReadFull(resp.Body, data); err != nil {
+		return nil, err
+	}
+	if resp.Close {
+		(*conn).close()
+		*conn = nil
+	}
+	return data, nil
+}
@@ -0,0 +1,65 @@
+package proxy
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+
+	"tunn/pkg/acl"
+	"tunn/pkg/blocklist"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// Failure diagnostics.
+//
+// SOCKS5 replies carry only a one-byte code and the HTTP error responses of
+// the proxy have no body, so a client sees "connection refused" or "502" with
+// nothing to tell a refusing destination from a failed name lookup on the
+// server. While debug logging is on, each failed request gets a short
+// correlation ID printed with the specific error, and HTTP error responses
+// carry the same ID and error in their body, so a failure seen in a browser
+// or curl can be matched to its log line.
+
+// newFailureID returns a short random ID for correlating a failure seen by a
+// client with the debug line describing it.
+func newFailureID() string {
+	b := make([]byte, 4)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// describeDialError explains why an SSH channel to a destination could not
+// be opened, in terms of what happened on which side of the tunnel.
+//
+// Parameters:
+//   - err: The error returned by DialSSH
+//
+// Returns:
+//   - string: A one-line explanation
+func describeDialError(err error) string {
+	switch {
+	case errors.Is(err, ErrDestinationBlocked):
+		return "blocked locally: channel opens to this destination have been consistently slow"
+	case errors.Is(err, acl.ErrDenied), errors.Is(err, blocklist.ErrBlocked):
+		return fmt.Sprintf("blocked locally: %v", err)
+	case errors.Is(err, ErrServerStopped):
+		return "the proxy is shutting down"
+	}
+
+	var openErr *ssh.OpenChannelError
+	if errors.As(err, &openErr) {
+		switch openErr.Reason {
+		case ssh.ConnectionFailed:
+			// The server's message tells refused connections, timeouts and
+			// failed name lookups apart
+			return fmt.Sprintf("the SSH server could not connect to the destination: %s", openErr.Message)
+		case ssh.Prohibited:
+			return fmt.Sprintf("the SSH server refused the channel (administratively prohibited): %s", openErr.Message)
+		default:
+			return fmt.Sprintf("the SSH server refused the channel: %v", openErr)
+		}
+	}
+	return fmt.Sprintf("the channel could not be opened, the tunnel may be down: %v", err)
+}
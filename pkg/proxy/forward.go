@@ -0,0 +1,79 @@
+package proxy
+
+import (
+	"net"
+	"strconv"
+	"time"
+
+	"tunn/pkg/stats"
+)
+
+// Forward relays every connection to a local port to one fixed destination
+// through the SSH tunnel, like the -L option of OpenSSH.
+//
+// Clients connect to the port as if it were the destination itself, without
+// any proxy handshake, which suits programs that cannot use a proxy such as
+// database clients.
+type Forward struct {
+	server *Server // Embedded server for common proxy functionality
+	host   string  // Destination host, resolved by the SSH server
+	port   int     // Destination port
+}
+
+// NewForward creates a forward to the specified destination with the
+// specified SSH client.
+//
+// Parameters:
+//   - ssh: An initialized SSH client for tunnel connections
+//   - st: Statistics collector for traffic accounting (may be nil)
+//   - host: Destination host, resolved by the SSH server
+//   - port: Destination port
+//
+// Returns:
+//   - *Forward: A new forward instance
+func NewForward(ssh SSHClient, st *stats.Stats, host string, port int) *Forward {
+	return &Forward{
+		server: NewServer(ssh, st),
+		host:   host,
+		port:   port,
+	}
+}
+
+// Destination returns the destination of the forward as host:port.
+func (f *Forward) Destination() string {
+	return net.JoinHostPort(f.host, strconv.Itoa(f.port))
+}
+
+// SetLimits applies limits to the connections served; see Server.SetLimits.
+func (f *Forward) SetLimits(limits Limits) {
+	f.server.SetLimits(limits)
+}
+
+// Serve starts forwarding the connections accepted on a listener.
+//
+// Parameters:
+//   - listener: The bound local listener, owned by the forward from now on
+func (f *Forward) Serve(listener net.Listener) {
+	f.server.ServeProxy("Forward "+listener.Addr().String(), listener, f.handleClient)
+}
+
+// Stop stops accepting connections and closes all open ones.
+func (f *Forward) Stop() {
+	f.server.Stop(stopTimeout)
+}
+
+// handleClient opens an SSH channel to the destination and relays the
+// connection over it. A client whose channel cannot be opened is
+// disconnected, the only way to tell it without a proxy protocol.
+//
+// Parameters:
+//   - clientConn: The incoming client connection
+func (f *Forward) handleClient(clientConn net.Conn) {
+	f.server.HandleClientWithTimeout(clientConn, "forward", 30*time.Second, func() {
+		sshConn, err := f.server.DialSSH(f.host, f.port)
+		if err != nil {
+			return
+		}
+		f.server.Relay(clientConn, sshConn, f.host, f.port)
+	})
+}
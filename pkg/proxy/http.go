@@ -2,15 +2,26 @@ package proxy
 
 import (
 	"bufio"
+	"bytes"
+	"errors"
 	"fmt"
 	"io"
+	"maps"
 	"net"
 	"net/http"
 	"net/url"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
 
+	"tunn/pkg/acl"
+	"tunn/pkg/blocklist"
+	"tunn/pkg/debuglog"
+	"tunn/pkg/httpcache"
+	"tunn/pkg/redact"
+	"tunn/pkg/reqlog"
+	"tunn/pkg/stats"
 	"tunn/pkg/utils"
 )
 
@@ -25,7 +36,12 @@ import (
 // The HTTP proxy handles both transparent HTTP requests and HTTPS tunneling
 // via the CONNECT method, making it suitable for web browser proxy configuration.
 type HTTP struct {
-	server *Server // Embedded server for common proxy functionality
+	server *Server          // Embedded server for common proxy functionality
+	log    *reqlog.Log      // Request metadata log (nil when disabled)
+	cache  *httpcache.Cache // GET response cache (nil when disabled)
+
+	headerCase map[string]string // Forced header name spellings by canonical name
+	accel      *accelerator      // Download accelerator (nil when disabled)
 }
 
 // NewHTTP creates a new HTTP proxy instance with the specified SSH client.
@@ -35,12 +51,35 @@ type HTTP struct {
 //
 // Parameters:
 //   - ssh: An initialized SSH client for tunnel connections
+//   - st: Statistics collector for traffic accounting (may be nil)
 //
 // Returns:
 //   - *HTTP: A new HTTP proxy server instance
-func NewHTTP(ssh SSHClient) *HTTP {
+func NewHTTP(ssh SSHClient, st *stats.Stats) *HTTP {
 	return &HTTP{
-		server: NewServer(ssh),
+		server: NewServer(ssh, st),
+	}
+}
+
+// SetRequestLog records the metadata of each request in a log. It must be
+// called before the proxy is started.
+//
+// Parameters:
+//   - log: The request log, or nil to disable logging
+func (h *HTTP) SetRequestLog(log *reqlog.Log) {
+	h.log = log
+}
+
+// SetHeaderCase writes the given header names to origin servers exactly as
+// spelled here, whatever case the client used. It must be called before the
+// proxy is started.
+//
+// Parameters:
+//   - names: The header names, e.g. "x-api-key" or "DNT"
+func (h *HTTP) SetHeaderCase(names []string) {
+	h.headerCase = make(map[string]string, len(names))
+	for _, name := range names {
+		h.headerCase[http.CanonicalHeaderKey(name)] = name
 	}
 }
 
@@ -63,6 +102,22 @@ func (h *HTTP) Start(localPort int) error {
 	return h.server.StartProxy("HTTP", localPort, h.handleClient)
 }
 
+// Serve starts serving HTTP clients on a listener bound with Listen.
+//
+// Parameters:
+//   - listener: The bound local listener, owned by the proxy from now on
+func (h *HTTP) Serve(listener net.Listener) {
+	h.server.ServeProxy("HTTP", listener, h.handleClient)
+}
+
+// Stop stops accepting HTTP clients and closes all open connections.
+//
+// It waits briefly for the connection handlers to finish so that shutdown does
+// not race with active forwards.
+func (h *HTTP) Stop() {
+	h.server.Stop(stopTimeout)
+}
+
 // handleClient processes a single HTTP proxy client connection.
 //
 // This method manages the complete HTTP client session including timeout handling,
@@ -80,22 +135,37 @@ func (h *HTTP) Start(localPort int) error {
 //   - clientConn: The incoming HTTP client connection to handle
 func (h *HTTP) handleClient(clientConn net.Conn) {
 	h.server.HandleClientWithTimeout(clientConn, "HTTP", 30*time.Second, func() {
-		reader := bufio.NewReader(clientConn)
-		req, err := http.ReadRequest(reader)
-		if err != nil {
-			fmt.Printf("✗ Error reading HTTP request: %v\n", err)
-			h.sendError(clientConn, 400, "Bad Request")
-			return
-		}
-
-		if req.Method == "CONNECT" {
-			h.handleConnect(clientConn, req)
-		} else {
-			h.handleRequest(clientConn, req)
-		}
+		h.serveClient(clientConn, clientConn)
 	})
 }
 
+// serveClient reads the request of a client and routes it to the CONNECT or
+// the regular request handler.
+//
+// Parameters:
+//   - clientConn: The HTTP client connection
+//   - src: Source of the request: clientConn, or a reader that returns bytes
+//     already read from clientConn first
+func (h *HTTP) serveClient(clientConn net.Conn, src io.Reader) {
+	// Keep the header block as written, since ReadRequest canonicalizes names.
+	// The recorder sees the bytes as they are buffered, so a single reader
+	// serves the whole connection.
+	raw := &headerRecorder{}
+	reader := bufio.NewReader(io.TeeReader(src, raw))
+	req, err := http.ReadRequest(reader)
+	if err != nil {
+		fmt.Printf("✗ Error reading HTTP request: %v\n", err)
+		h.sendError(clientConn, 400, "Bad Request")
+		return
+	}
+
+	if req.Method == "CONNECT" {
+		h.handleConnect(clientConn, reader, req)
+	} else {
+		h.handleRequest(clientConn, req, raw.names())
+	}
+}
+
 // handleConnect processes HTTP CONNECT requests for HTTPS tunneling.
 //
 // This method implements the HTTP CONNECT method as defined in RFC 7231,
@@ -105,14 +175,16 @@ func (h *HTTP) handleClient(clientConn net.Conn) {
 //
 // The process:
 //  1. Parses the target host and port from the CONNECT request
-//  2. Sends "200 Connection established" response to the client
-//  3. Establishes SSH tunnel to the target destination
+//  2. Establishes SSH tunnel to the target destination
+//  3. Sends "200 Connection established" response to the client
 //  4. Begins transparent data forwarding in both directions
 //
 // Parameters:
 //   - clientConn: The HTTP client connection requesting the tunnel
+//   - reader: The reader the request was read from, which may hold data the
+//     client sent right after it, such as a TLS ClientHello
 //   - req: The parsed HTTP CONNECT request containing target information
-func (h *HTTP) handleConnect(clientConn net.Conn, req *http.Request) {
+func (h *HTTP) handleConnect(clientConn net.Conn, reader *bufio.Reader, req *http.Request) {
 	host, portInt, err := utils.ParseHostPort(req.Host, 443)
 	if err != nil {
 		fmt.Printf("✗ Invalid host in CONNECT request: %v\n", err)
@@ -121,16 +193,40 @@ func (h *HTTP) handleConnect(clientConn net.Conn, req *http.Request) {
 	}
 
 	fmt.Printf("→ HTTP CONNECT request to %s:%d\n", host, portInt)
+	debugHeaders(req)
+	start, status := time.Now(), 0
+	defer func() { h.record(req.Method, host, portInt, "", status, start) }()
+
+	// Open SSH channel before replying so the client learns the real outcome,
+	// without the request timeout, which does not cover the wait for the channel
+	clientConn.SetDeadline(time.Time{})
+	sshConn, err := h.server.DialSSH(host, portInt)
+	if err != nil {
+		status = h.sendDialError(clientConn, host, portInt, err)
+		return
+	}
 
 	// Send success response
 	response := "HTTP/1.1 200 Connection established\r\n\r\n"
 	if _, err := clientConn.Write([]byte(response)); err != nil {
 		fmt.Printf("✗ Error sending CONNECT response: %v\n", err)
+		sshConn.Close()
 		return
 	}
 
+	// Pass on what the client sent without waiting for the response
+	if buffered := reader.Buffered(); buffered > 0 {
+		data, _ := reader.Peek(buffered)
+		if _, err := sshConn.Write(data); err != nil {
+			fmt.Printf("✗ Error forwarding CONNECT data: %v\n", err)
+			sshConn.Close()
+			return
+		}
+	}
+
 	fmt.Printf("✓ HTTP CONNECT tunnel established to %s:%d\n", host, portInt)
-	h.server.OpenSSHChannel(clientConn, host, portInt)
+	status = 200
+	h.server.Relay(clientConn, sshConn, host, portInt)
 }
 
 // handleRequest processes regular HTTP requests (GET, POST, etc.) through the proxy.
@@ -151,7 +247,8 @@ func (h *HTTP) handleConnect(clientConn net.Conn, req *http.Request) {
 // Parameters:
 //   - clientConn: The HTTP client connection making the request
 //   - req: The parsed HTTP request to forward through the tunnel
-func (h *HTTP) handleRequest(clientConn net.Conn, req *http.Request) {
+//   - names: The header names of the request as the client wrote them, in order
+func (h *HTTP) handleRequest(clientConn net.Conn, req *http.Request, names []string) {
 	targetHost, targetPort, targetPath, err := h.parseTarget(req)
 	if err != nil {
 		fmt.Printf("✗ Error parsing HTTP target: %v\n", err)
@@ -159,26 +256,45 @@ func (h *HTTP) handleRequest(clientConn net.Conn, req *http.Request) {
 		return
 	}
 
-	fmt.Printf("→ HTTP %s request to %s:%d%s\n", req.Method, targetHost, targetPort, targetPath)
+	fmt.Printf("→ HTTP %s request to %s:%d%s\n", req.Method, targetHost, targetPort, redact.URL(targetPath))
+	debugHeaders(req)
+	start, status := time.Now(), 0
+	defer func() { h.record(req.Method, targetHost, targetPort, targetPath, status, start) }()
+
+	if h.cache != nil && httpcache.Cacheable(req) {
+		status = h.serveCached(clientConn, req, names, targetHost, targetPort, targetPath)
+		return
+	}
 
 	// Open SSH channel to target
-	address := net.JoinHostPort(targetHost, strconv.Itoa(targetPort))
-	sshConn, err := h.server.ssh.Dial("tcp", address)
+	sshConn, err := h.server.DialSSH(targetHost, targetPort)
 	if err != nil {
-		fmt.Printf("✗ Failed to open SSH channel for HTTP request: %v\n", err)
-		h.sendError(clientConn, 502, "Bad Gateway")
+		status = h.sendDialError(clientConn, targetHost, targetPort, err)
 		return
 	}
 	defer sshConn.Close()
 
 	// Forward the HTTP request and response
-	if err := h.forwardRequest(sshConn, req, targetPath); err != nil {
+	if err := h.forwardRequest(sshConn, req, names, targetPath); err != nil {
 		fmt.Printf("✗ Error forwarding HTTP request: %v\n", err)
-		h.sendError(clientConn, 502, "Bad Gateway")
+		h.sendFailure(clientConn, 502, "Bad Gateway", targetHost, targetPort, fmt.Sprintf("sending the request failed: %v", err))
+		status = 502
 		return
 	}
 
-	h.forwardResponse(clientConn, sshConn)
+	// Close the channel when the client goes away, so an upstream keeping the
+	// connection alive cannot hold this handler and its channel open forever
+	clientConn.SetDeadline(time.Time{})
+	go func() {
+		io.Copy(io.Discard, clientConn)
+		sshConn.Close()
+	}()
+
+	if h.accel != nil && accelerable(req) {
+		status = h.forwardAccelerated(clientConn, sshConn, req, names, targetHost, targetPort, targetPath)
+		return
+	}
+	status = h.forwardResponse(clientConn, sshConn)
 }
 
 // parseTarget extracts the target host, port, and path from an HTTP request.
@@ -245,49 +361,75 @@ func (h *HTTP) parseTarget(req *http.Request) (host string, port int, path strin
 //
 // The reconstruction process:
 //  1. Builds the HTTP request line with method, path, and protocol version
-//  2. Copies headers (excluding proxy-specific ones like "Proxy-Connection")
+//  2. Copies headers in the order and case the client wrote them, with the
+//     spellings of listener.headerCase taking precedence
 //  3. Adds request body if present
 //
+// Some origin servers and CDN firewall rules match header names case
+// sensitively or expect the order browsers send, which Go's canonical names
+// and unordered header map would break. Headers added by the proxy itself,
+// such as cache validators, follow those of the client.
+//
 // Headers filtered out:
 //   - "Proxy-Connection": Proxy-specific header not relevant to origin servers
 //
 // Parameters:
 //   - sshConn: The SSH tunnel connection to the target server
 //   - req: The original HTTP request to reconstruct and forward
+//   - names: The header names as the client wrote them, in order
 //   - targetPath: The path to use in the reconstructed request
 //
 // Returns:
 //   - error: An error if request forwarding fails
-func (h *HTTP) forwardRequest(sshConn net.Conn, req *http.Request, targetPath string) error {
+func (h *HTTP) forwardRequest(sshConn net.Conn, req *http.Request, names []string, targetPath string) error {
 	// Reconstruct the request
 	var requestBuilder strings.Builder
 
 	// Request line
 	requestBuilder.WriteString(fmt.Sprintf("%s %s %s\r\n", req.Method, targetPath, req.Proto))
 
-	// Headers (excluding proxy-specific headers)
-	for name, values := range req.Header {
-		// Skip proxy-specific headers
-		if strings.ToLower(name) == "proxy-connection" {
-			continue
+	// ReadRequest moves the Host header out of the header map
+	written := map[string]bool{"Proxy-Connection": true}
+	writeHeader := func(name string) {
+		key := http.CanonicalHeaderKey(name)
+		if written[key] {
+			return
 		}
-		for _, value := range values {
+		written[key] = true
+		if forced, ok := h.headerCase[key]; ok {
+			name = forced
+		}
+		if key == "Host" {
+			requestBuilder.WriteString(fmt.Sprintf("%s: %s\r\n", name, req.Host))
+			return
+		}
+		for _, value := range req.Header[key] {
 			requestBuilder.WriteString(fmt.Sprintf("%s: %s\r\n", name, value))
 		}
 	}
+	if req.Host != "" && !slices.ContainsFunc(names, func(name string) bool { return http.CanonicalHeaderKey(name) == "Host" }) {
+		writeHeader("Host")
+	}
+	for _, name := range names {
+		writeHeader(name)
+	}
+	for _, name := range slices.Sorted(maps.Keys(req.Header)) {
+		writeHeader(name)
+	}
 
 	// End of headers
 	requestBuilder.WriteString("\r\n")
 
 	// Send request headers
-	_, err := sshConn.Write([]byte(requestBuilder.String()))
+	upstream := &stats.CountingWriter{W: sshConn, Count: h.server.stats.AddUp}
+	_, err := upstream.Write([]byte(requestBuilder.String()))
 	if err != nil {
 		return err
 	}
 
 	// Forward request body if present
 	if req.Body != nil {
-		_, err = io.Copy(sshConn, req.Body)
+		_, err = io.Copy(upstream, req.Body)
 		req.Body.Close()
 		if err != nil {
 			return err
@@ -297,6 +439,48 @@ func (h *HTTP) forwardRequest(sshConn net.Conn, req *http.Request, targetPath st
 	return nil
 }
 
+// maxHeaderBlock bounds the header block a headerRecorder keeps.
+const maxHeaderBlock = 1 << 20
+
+// headerRecorder keeps the bytes written to it up to the end of an HTTP
+// header block, so the header names can be read as the client wrote them,
+// or the headers of a response passed on unchanged. It is the write side of a
+// TeeReader in front of http.ReadRequest or http.ReadResponse; bytes of the
+// body passing through are not kept.
+type headerRecorder struct {
+	block []byte // First line and headers including the empty line ending them
+	done  bool   // Whether the end of the header block was seen
+}
+
+// Write collects p until the empty line ending the header block.
+func (r *headerRecorder) Write(p []byte) (int, error) {
+	if r.done {
+		return len(p), nil
+	}
+	r.block = append(r.block, p...)
+	if end := bytes.Index(r.block, []byte("\n\r\n")); end >= 0 {
+		r.block, r.done = r.block[:end+3], true
+	} else if end := bytes.Index(r.block, []byte("\n\n")); end >= 0 {
+		r.block, r.done = r.block[:end+2], true
+	} else if len(r.block) > maxHeaderBlock {
+		r.block, r.done = nil, true
+	}
+	return len(p), nil
+}
+
+// names returns the header names of the recorded block in order, as written.
+func (r *headerRecorder) names() []string {
+	lines := strings.Split(string(r.block), "\n")
+	var names []string
+	for _, line := range lines[min(1, len(lines)):] { // After the first line
+		// Continuation lines of folded headers start with whitespace
+		if name, _, ok := strings.Cut(line, ":"); ok && name != "" && name[0] != ' ' && name[0] != '\t' {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
 // forwardResponse streams the HTTP response from the SSH tunnel back to the client.
 //
 // This method performs transparent forwarding of the complete HTTP response
@@ -310,12 +494,112 @@ func (h *HTTP) forwardRequest(sshConn net.Conn, req *http.Request, targetPath st
 // Parameters:
 //   - clientConn: The original client connection to send the response to
 //   - sshConn: The SSH tunnel connection receiving the response from target
-func (h *HTTP) forwardResponse(clientConn net.Conn, sshConn net.Conn) {
+//
+// Returns:
+//   - int: The status code of the response, 0 if none was received
+func (h *HTTP) forwardResponse(clientConn net.Conn, sshConn net.Conn) int {
 	// Simply forward all data from SSH connection back to client
-	_, err := io.Copy(clientConn, sshConn)
+	status := &statusWriter{w: h.preconnectHints(&stats.CountingWriter{W: clientConn, Count: h.server.stats.AddDown})}
+	_, err := io.Copy(status, sshConn)
 	if err != nil && err != io.EOF {
 		fmt.Printf("✗ Error forwarding HTTP response: %v\n", err)
 	}
+	return status.code
+}
+
+// debugHeaders prints the headers of a request as debug lines, with
+// credentials and cookies masked.
+func debugHeaders(req *http.Request) {
+	if !debuglog.Enabled() {
+		return
+	}
+	for _, name := range slices.Sorted(maps.Keys(req.Header)) {
+		for _, value := range req.Header[name] {
+			debuglog.Printf("%s\n", redact.Text(name+": "+value))
+		}
+	}
+}
+
+// sendDialError answers a request whose SSH channel could not be opened,
+// with 403 for destinations refused by policy and 502 otherwise. While debug
+// logging is on, the body of the response names the specific error.
+//
+// Parameters:
+//   - clientConn: The client connection to answer
+//   - host, port: The destination of the request
+//   - err: The error returned by DialSSH
+//
+// Returns:
+//   - int: The status code sent
+func (h *HTTP) sendDialError(clientConn net.Conn, host string, port int, err error) int {
+	code, text := 502, "Bad Gateway"
+	if errors.Is(err, ErrDestinationBlocked) || errors.Is(err, acl.ErrDenied) || errors.Is(err, blocklist.ErrBlocked) {
+		code, text = 403, "Forbidden"
+	}
+	h.sendFailure(clientConn, code, text, host, port, describeDialError(err))
+	return code
+}
+
+// sendFailure sends an HTTP error response for a request that failed beyond
+// the proxy. While debug logging is on, the failure is logged with a
+// correlation ID and the response body carries the ID and the detail;
+// otherwise the response has no body, as for sendError.
+//
+// Parameters:
+//   - clientConn: The client connection to answer
+//   - statusCode, statusText: The status to send, e.g. 502 and "Bad Gateway"
+//   - host, port: The destination of the request
+//   - detail: What failed, e.g. the explanation of describeDialError
+func (h *HTTP) sendFailure(clientConn net.Conn, statusCode int, statusText, host string, port int, detail string) {
+	if !debuglog.Enabled() {
+		h.sendError(clientConn, statusCode, statusText)
+		return
+	}
+	id := newFailureID()
+	debuglog.Printf("HTTP request to %s:%d failed with %d [%s]: %s\n", host, port, statusCode, id, detail)
+
+	body := fmt.Sprintf("%d %s\n\nTunn could not complete the request to %s.\nError: %s\nID: %s (search the Tunn output for it)\n",
+		statusCode, statusText, net.JoinHostPort(host, strconv.Itoa(port)), detail, id)
+	response := fmt.Sprintf("HTTP/1.1 %d %s\r\nContent-Type: text/plain; charset=utf-8\r\nContent-Length: %d\r\nConnection: close\r\n\r\n%s",
+		statusCode, statusText, len(body), body)
+	clientConn.Write([]byte(response))
+}
+
+// record writes a request to the request log, if enabled.
+func (h *HTTP) record(method, host string, port int, path string, status int, start time.Time) {
+	h.log.Record(reqlog.Entry{
+		Time:     start,
+		Method:   method,
+		Host:     host,
+		Port:     port,
+		Path:     path,
+		Status:   status,
+		Duration: time.Since(start).Milliseconds(),
+	})
+}
+
+// statusWriter passes a response through and parses the status code from its
+// status line.
+type statusWriter struct {
+	w    io.Writer
+	line []byte // Start of the status line, until it is complete
+	code int    // Parsed status code
+	done bool   // Whether the status line has been seen
+}
+
+// Write writes p and collects the status line from the first bytes.
+func (s *statusWriter) Write(p []byte) (int, error) {
+	if !s.done {
+		s.line = append(s.line, p[:min(len(p), 64)]...)
+		if i := bytes.IndexByte(s.line, '\n'); i >= 0 || len(s.line) >= 64 {
+			s.done = true
+			if fields := strings.Fields(string(s.line[:max(i, 0)])); len(fields) >= 2 {
+				s.code, _ = strconv.Atoi(fields[1])
+			}
+			s.line = nil
+		}
+	}
+	return s.w.Write(p)
 }
 
 // sendError sends an HTTP error response to the client.
@@ -0,0 +1,74 @@
+package proxy
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// directDialer opens connections directly instead of through SSH.
+type directDialer struct{}
+
+// Dial implements SSHClient.
+func (directDialer) Dial(network, address string) (net.Conn, error) {
+	return net.DialTimeout(network, address, 5*time.Second)
+}
+
+// startEcho starts a TCP server echoing what it receives.
+func startEcho(t *testing.T) string {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen failed: %v", err)
+	}
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				io.Copy(conn, conn)
+			}()
+		}
+	}()
+	return l.Addr().String()
+}
+
+func TestConnectForwardsPipelinedData(t *testing.T) {
+	echo := startEcho(t)
+	client, conn := tcpPair(t)
+
+	h := NewHTTP(directDialer{}, nil)
+	go h.handleClient(conn)
+
+	// The first bytes of the tunnel arrive together with the request, as
+	// clients sending the TLS ClientHello without waiting do
+	request := "CONNECT " + echo + " HTTP/1.1\r\nHost: " + echo + "\r\n\r\nhello"
+	if _, err := client.Write([]byte(request)); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+
+	client.SetReadDeadline(time.Now().Add(5 * time.Second))
+	reader := bufio.NewReader(client)
+	resp, err := http.ReadResponse(reader, &http.Request{Method: http.MethodConnect})
+	if err != nil {
+		t.Fatalf("reading the CONNECT response failed: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("CONNECT answered %s", resp.Status)
+	}
+
+	echoed := make([]byte, len("hello"))
+	if _, err := io.ReadFull(reader, echoed); err != nil {
+		t.Fatalf("the pipelined data was not forwarded: %v", err)
+	}
+	if string(echoed) != "hello" {
+		t.Errorf("echoed %q, want %q", echoed, "hello")
+	}
+}
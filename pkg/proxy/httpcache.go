@@ -0,0 +1,116 @@
+package proxy
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"time"
+
+	"tunn/pkg/httpcache"
+	"tunn/pkg/redact"
+	"tunn/pkg/stats"
+)
+
+// SetCache serves GET requests from a response cache where allowed. It must
+// be called before the proxy is started.
+//
+// Parameters:
+//   - cache: The response cache, or nil to disable caching
+func (h *HTTP) SetCache(cache *httpcache.Cache) {
+	h.cache = cache
+}
+
+// serveCached answers a cacheable request from the cache when it holds a
+// fresh response. Otherwise the request is forwarded through the tunnel,
+// conditional on a stale stored response having changed, and the response is
+// stored when allowed.
+//
+// Unlike other requests, the response is parsed rather than copied as it is,
+// so it is sent to the client with "Connection: close" and, when its length
+// is unknown, delimited by closing the connection.
+//
+// Parameters:
+//   - clientConn: The HTTP client connection making the request
+//   - req: The GET request
+//   - names: The header names as the client wrote them, in order
+//   - host, port, path: The parsed target of the request
+//
+// Returns:
+//   - int: The status code sent to the client, 0 if none
+func (h *HTTP) serveCached(clientConn net.Conn, req *http.Request, names []string, host string, port int, path string) int {
+	key := httpcache.Key(req, host, port, path)
+	hit := h.cache.Lookup(key, req)
+	if hit != nil && hit.Fresh(req) {
+		if status, ok := h.sendCached(clientConn, req, hit); ok {
+			fmt.Printf("✓ HTTP cache hit for %s:%d%s\n", host, port, redact.URL(path))
+			return status
+		}
+	}
+	revalidating := hit != nil && hit.AddValidators(req)
+
+	sshConn, err := h.server.DialSSH(host, port)
+	if err != nil {
+		return h.sendDialError(clientConn, host, port, err)
+	}
+	defer sshConn.Close()
+
+	if err := h.forwardRequest(sshConn, req, names, path); err != nil {
+		fmt.Printf("✗ Error forwarding HTTP request: %v\n", err)
+		h.sendFailure(clientConn, 502, "Bad Gateway", host, port, fmt.Sprintf("sending the request failed: %v", err))
+		return 502
+	}
+
+	// As for other requests, close the channel when the client goes away
+	clientConn.SetDeadline(time.Time{})
+	go func() {
+		io.Copy(io.Discard, clientConn)
+		sshConn.Close()
+	}()
+
+	resp, err := http.ReadResponse(bufio.NewReader(sshConn), req)
+	if err != nil {
+		fmt.Printf("✗ Error reading HTTP response: %v\n", err)
+		h.sendFailure(clientConn, 502, "Bad Gateway", host, port, fmt.Sprintf("reading the response failed: %v", err))
+		return 502
+	}
+	defer resp.Body.Close()
+
+	if revalidating && resp.StatusCode == http.StatusNotModified {
+		hit.Refresh(req, resp)
+		if status, ok := h.sendCached(clientConn, req, hit); ok {
+			fmt.Printf("✓ HTTP cache revalidated for %s:%d%s\n", host, port, redact.URL(path))
+			return status
+		}
+		h.sendError(clientConn, 502, "Bad Gateway")
+		return 502
+	}
+
+	resp.Body = h.cache.Record(key, req, resp)
+	resp.TransferEncoding = nil
+	resp.Close = true
+	if err := resp.Write(h.preconnectHints(&stats.CountingWriter{W: clientConn, Count: h.server.stats.AddDown})); err != nil {
+		fmt.Printf("✗ Error forwarding HTTP response: %v\n", err)
+	}
+	return resp.StatusCode
+}
+
+// sendCached sends a stored response to the client.
+//
+// Returns:
+//   - int: The status code sent
+//   - bool: Whether the stored response could be read
+func (h *HTTP) sendCached(clientConn net.Conn, req *http.Request, hit *httpcache.Hit) (int, bool) {
+	resp, err := hit.Response(req)
+	if err != nil {
+		return 0, false
+	}
+	defer resp.Body.Close()
+
+	resp.Close = true
+	if err := resp.Write(h.preconnectHints(clientConn)); err != nil {
+		fmt.Printf("✗ Error sending cached HTTP response: %v\n", err)
+	}
+	return resp.StatusCode, true
+}
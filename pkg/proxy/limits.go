@@ -0,0 +1,223 @@
+package proxy
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Limits bounds the connections served by a proxy. The zero value imposes no
+// limit.
+type Limits struct {
+	MaxConnections int           // Clients served at once; further clients are refused (0: unlimited)
+	IdleTimeout    time.Duration // Relayed connections carrying no data for this long are closed (0: never)
+	RateLimit      int64         // Bytes per second shared by all relayed connections, per direction (0: unlimited)
+	Workers        int           // Clients handled at once by a fixed pool of goroutines (0: a goroutine per client)
+	Queue          int           // Clients waiting for a worker before accepting pauses (with Workers)
+}
+
+// SetLimits applies limits to the connections served from now on. It must be
+// called before the proxy starts serving.
+//
+// Parameters:
+//   - limits: The limits to apply
+func (s *Server) SetLimits(limits Limits) {
+	s.limits = limits
+	if limits.RateLimit > 0 {
+		s.upRate = newRateLimiter(limits.RateLimit)
+		s.downRate = newRateLimiter(limits.RateLimit)
+	}
+}
+
+// SetLimits applies limits to the connections served; see Server.SetLimits.
+func (s *SOCKS5) SetLimits(limits Limits) {
+	s.server.SetLimits(limits)
+}
+
+// SetLimits applies limits to the connections served; see Server.SetLimits.
+func (h *HTTP) SetLimits(limits Limits) {
+	h.server.SetLimits(limits)
+}
+
+// admit reserves a client slot, reporting false when the connection limit is
+// reached. Admitted clients must be released with release.
+func (s *Server) admit() bool {
+	if s.limits.MaxConnections <= 0 {
+		return true
+	}
+	if s.active.Add(1) > int64(s.limits.MaxConnections) {
+		s.active.Add(-1)
+		return false
+	}
+	return true
+}
+
+// release frees the slot of a client admitted by admit.
+func (s *Server) release() {
+	if s.limits.MaxConnections > 0 {
+		s.active.Add(-1)
+	}
+}
+
+// workerPool hands accepted clients to a fixed number of goroutines, so the
+// memory of a busy proxy stays bounded however many clients connect.
+//
+// Clients wait in a bounded queue for a free worker. Once the queue is full
+// the accept loop blocks, leaving further clients in the listen backlog of
+// the operating system instead of in memory.
+type workerPool struct {
+	queue    chan net.Conn
+	name     string    // Proxy type, for the saturation warning
+	workers  int       // Number of worker goroutines
+	lastWarn time.Time // When saturation was last reported, used by the accept loop only
+}
+
+// saturationWarnInterval limits how often a saturated worker pool is reported.
+const saturationWarnInterval = time.Minute
+
+// newWorkerPool starts the workers of a proxy, each serving clients in turn
+// until the pool is closed.
+//
+// Parameters:
+//   - name: Proxy type for log messages
+//   - workers: Number of clients handled at once
+//   - queue: Number of clients waiting for a worker
+//   - serve: Handles one client
+//
+// Returns:
+//   - *workerPool: The running pool
+func newWorkerPool(name string, workers, queue int, serve func(net.Conn)) *workerPool {
+	p := &workerPool{queue: make(chan net.Conn, queue), name: name, workers: workers}
+	for range workers {
+		go func() {
+			for conn := range p.queue {
+				serve(conn)
+			}
+		}()
+	}
+	return p
+}
+
+// submit queues a client for the next free worker, blocking while the queue
+// is full.
+func (p *workerPool) submit(conn net.Conn) {
+	select {
+	case p.queue <- conn:
+		return
+	default:
+	}
+	if time.Since(p.lastWarn) >= saturationWarnInterval {
+		p.lastWarn = time.Now()
+		fmt.Printf("✗ %s proxy is saturated: %d clients served and %d waiting, accepting paused\n", p.name, p.workers, cap(p.queue))
+	}
+	p.queue <- conn
+}
+
+// close stops the workers once the clients already queued are served.
+func (p *workerPool) close() {
+	close(p.queue)
+}
+
+// watchIdle closes both connections of a relay once no data has been written
+// for the idle timeout. It returns a function stopping the watch.
+func (s *Server) watchIdle(lastActive *atomic.Int64, conn1, conn2 net.Conn) func() {
+	idle := s.limits.IdleTimeout
+	if idle <= 0 {
+		return func() {}
+	}
+
+	var timer *time.Timer
+	timer = time.AfterFunc(idle, func() {
+		quiet := time.Since(time.Unix(0, lastActive.Load()))
+		if quiet < idle {
+			timer.Reset(idle - quiet)
+			return
+		}
+		conn1.Close()
+		conn2.Close()
+	})
+	return func() { timer.Stop() }
+}
+
+// relayWriter records activity and applies the rate limit to one direction
+// of a relay.
+type relayWriter struct {
+	w          io.Writer
+	limiter    *rateLimiter  // Rate limit of the direction (nil for none)
+	lastActive *atomic.Int64 // Unix nanoseconds of the last write in either direction
+	active     *atomic.Int64 // Unix nanoseconds of the last write in this direction
+}
+
+// touch records activity of the direction.
+func (r *relayWriter) touch() {
+	now := time.Now().UnixNano()
+	r.lastActive.Store(now)
+	r.active.Store(now)
+}
+
+// Write implements io.Writer.
+func (r *relayWriter) Write(p []byte) (int, error) {
+	r.touch()
+	if r.limiter == nil {
+		n, err := r.w.Write(p)
+		if n > 0 {
+			r.touch()
+		}
+		return n, err
+	}
+
+	// Small chunks keep a low limit from stalling a direction for seconds
+	written := 0
+	for len(p) > 0 {
+		chunk := p[:min(len(p), r.limiter.burst())]
+		r.limiter.wait(len(chunk))
+		n, err := r.w.Write(chunk)
+		written += n
+		if err != nil {
+			return written, err
+		}
+		p = p[n:]
+		r.touch()
+	}
+	return written, nil
+}
+
+// rateLimiter is a token bucket shared by the connections of one direction.
+// Waiting callers reserve their tokens up front, so they are served in turn.
+type rateLimiter struct {
+	mu     sync.Mutex
+	rate   float64 // Bytes per second
+	tokens float64 // Available bytes; negative while reserved ahead
+	last   time.Time
+}
+
+// newRateLimiter creates a limiter allowing rate bytes per second, with a
+// full bucket of a tenth of a second.
+func newRateLimiter(rate int64) *rateLimiter {
+	l := &rateLimiter{rate: float64(rate), last: time.Now()}
+	l.tokens = float64(l.burst())
+	return l
+}
+
+// burst returns the largest number of bytes written at once.
+func (l *rateLimiter) burst() int {
+	return max(int(l.rate/10), 1024)
+}
+
+// wait blocks until n bytes may be written.
+func (l *rateLimiter) wait(n int) {
+	l.mu.Lock()
+	now := time.Now()
+	l.tokens = min(l.tokens+now.Sub(l.last).Seconds()*l.rate, float64(l.burst()))
+	l.last = now
+	l.tokens -= float64(n)
+	var delay time.Duration
+	if l.tokens < 0 {
+		delay = time.Duration(-l.tokens / l.rate * float64(time.Second))
+	}
+	l.mu.Unlock()
+	time.Sleep(delay)
+}
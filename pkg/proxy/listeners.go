@@ -0,0 +1,129 @@
+package proxy
+
+import (
+	"net"
+	"strings"
+	"sync"
+)
+
+// joinedListener accepts the connections of several listeners as one, such
+// as the IPv4 and IPv6 loopback addresses of the proxy port.
+type joinedListener struct {
+	listeners []net.Listener
+	accepted  chan acceptResult
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+// acceptResult is the outcome of an Accept call of a joined listener.
+type acceptResult struct {
+	conn net.Conn
+	err  error
+}
+
+// JoinListeners combines listeners into one accepting the connections of
+// all of them. Closing it closes them all.
+//
+// Parameters:
+//   - listeners: The listeners to combine, the first of which gives the address
+//
+// Returns:
+//   - net.Listener: The combined listener
+func JoinListeners(listeners ...net.Listener) net.Listener {
+	if len(listeners) == 1 {
+		return listeners[0]
+	}
+	j := &joinedListener{
+		listeners: listeners,
+		accepted:  make(chan acceptResult),
+		closed:    make(chan struct{}),
+	}
+	for _, l := range listeners {
+		go j.acceptFrom(l)
+	}
+	return j
+}
+
+// acceptFrom passes the connections of one listener on until it fails.
+func (j *joinedListener) acceptFrom(l net.Listener) {
+	for {
+		conn, err := l.Accept()
+		select {
+		case j.accepted <- acceptResult{conn, err}:
+		case <-j.closed:
+			if conn != nil {
+				conn.Close()
+			}
+			return
+		}
+		if netErr, ok := err.(net.Error); err != nil && (!ok || !netErr.Temporary()) {
+			return
+		}
+	}
+}
+
+// Accept waits for the next connection on any of the listeners.
+func (j *joinedListener) Accept() (net.Conn, error) {
+	select {
+	case r := <-j.accepted:
+		return r.conn, r.err
+	case <-j.closed:
+		return nil, net.ErrClosed
+	}
+}
+
+// Close closes all listeners.
+func (j *joinedListener) Close() error {
+	var err error
+	j.closeOnce.Do(func() {
+		close(j.closed)
+		for _, l := range j.listeners {
+			if closeErr := l.Close(); err == nil {
+				err = closeErr
+			}
+		}
+	})
+	return err
+}
+
+// Addr returns the address of the first listener.
+func (j *joinedListener) Addr() net.Addr {
+	return j.listeners[0].Addr()
+}
+
+// ListenerAddrs returns the addresses a listener accepts connections on, the
+// first of which is its Addr.
+//
+// Parameters:
+//   - l: A listener, possibly returned by JoinListeners
+//
+// Returns:
+//   - []net.Addr: The addresses
+func ListenerAddrs(l net.Listener) []net.Addr {
+	j, ok := l.(*joinedListener)
+	if !ok {
+		return []net.Addr{l.Addr()}
+	}
+	addrs := make([]net.Addr, len(j.listeners))
+	for i, listener := range j.listeners {
+		addrs[i] = listener.Addr()
+	}
+	return addrs
+}
+
+// ListenerAddresses describes the addresses a listener accepts connections
+// on, e.g. "127.0.0.1:1080 and [::1]:1080" for joined listeners.
+//
+// Parameters:
+//   - l: A listener, possibly returned by JoinListeners
+//
+// Returns:
+//   - string: The addresses
+func ListenerAddresses(l net.Listener) string {
+	addrs := ListenerAddrs(l)
+	addresses := make([]string, len(addrs))
+	for i, addr := range addrs {
+		addresses[i] = addr.String()
+	}
+	return strings.Join(addresses, " and ")
+}
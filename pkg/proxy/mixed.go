@@ -0,0 +1,94 @@
+package proxy
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"time"
+
+	"tunn/pkg/stats"
+)
+
+// Mixed serves SOCKS5 and HTTP proxy clients on the same port.
+//
+// Applications differ in which proxy protocols they support, so a single port
+// speaking both saves configuring two. The protocol is told apart by the first
+// byte a client sends: SOCKS5 clients open with their version number 5, while
+// HTTP requests start with a method name. Nothing is sent to the client before
+// the protocol is known, so both kinds of client work unchanged.
+type Mixed struct {
+	server *Server // Server shared by both protocols
+	socks  *SOCKS5 // Handler of SOCKS5 clients
+	http   *HTTP   // Handler of HTTP clients
+}
+
+// NewMixed creates a proxy serving both SOCKS5 and HTTP clients.
+//
+// Parameters:
+//   - ssh: An initialized SSH client for tunnel connections
+//   - st: Statistics collector for traffic accounting (may be nil)
+//
+// Returns:
+//   - *Mixed: A new proxy server instance
+func NewMixed(ssh SSHClient, st *stats.Stats) *Mixed {
+	server := NewServer(ssh, st)
+	return &Mixed{
+		server: server,
+		socks:  &SOCKS5{server: server},
+		http:   &HTTP{server: server},
+	}
+}
+
+// HTTP returns the handler of HTTP clients, so that the request log, the cache
+// and preconnecting can be set up on it before the proxy is started.
+//
+// Returns:
+//   - *HTTP: The HTTP proxy sharing this proxy's server
+func (m *Mixed) HTTP() *HTTP {
+	return m.http
+}
+
+// SetLimits applies limits to the connections served; see Server.SetLimits.
+// The limits are shared by SOCKS5 and HTTP clients.
+func (m *Mixed) SetLimits(limits Limits) {
+	m.server.SetLimits(limits)
+}
+
+// Serve starts serving SOCKS5 and HTTP clients on a listener bound with Listen.
+//
+// Parameters:
+//   - listener: The bound local listener, owned by the proxy from now on
+func (m *Mixed) Serve(listener net.Listener) {
+	m.server.ServeProxy("SOCKS5/HTTP", listener, m.handleClient)
+}
+
+// Stop stops accepting clients and closes all open connections.
+func (m *Mixed) Stop() {
+	m.server.Stop(stopTimeout)
+}
+
+// handleClient reads the first byte of a client connection and passes the
+// connection on to the SOCKS5 or the HTTP handler.
+//
+// Parameters:
+//   - clientConn: The incoming client connection to handle
+func (m *Mixed) handleClient(clientConn net.Conn) {
+	m.server.HandleClientWithTimeout(clientConn, "SOCKS5/HTTP", 30*time.Second, func() {
+		first := make([]byte, 1)
+		if _, err := io.ReadFull(clientConn, first); err != nil {
+			fmt.Printf("✗ Error reading proxy request: %v\n", err)
+			return
+		}
+
+		switch first[0] {
+		case 5:
+			clientConn.SetDeadline(time.Now().Add(10 * time.Second))
+			m.socks.handleSOCKS5(clientConn)
+		case 4:
+			fmt.Println("✗ Unsupported SOCKS version: 4 (only SOCKS5 supported)")
+		default:
+			m.http.serveClient(clientConn, io.MultiReader(bytes.NewReader(first), clientConn))
+		}
+	})
+}
@@ -0,0 +1,327 @@
+package proxy
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Limits of preconnecting.
+const (
+	hintScanLimit  = 64 << 10 // Bytes of each response searched for hints
+	hintsPerPage   = 6        // Origins preconnected for one response
+	maxWarmPerPool = 16       // Pre-opened channels waiting at once
+)
+
+// Patterns finding resource hints in HTML and Link headers.
+var (
+	linkTagPattern  = regexp.MustCompile(`(?is)<link\b[^>]*>`)
+	relAttrPattern  = regexp.MustCompile(`(?is)\brel\s*=\s*(?:"([^"]*)"|'([^']*)'|([^\s>]+))`)
+	hrefAttrPattern = regexp.MustCompile(`(?is)\bhref\s*=\s*(?:"([^"]*)"|'([^']*)'|([^\s>]+))`)
+	linkHeaderPart  = regexp.MustCompile(`<([^>]*)>([^,]*)`)
+)
+
+// warmPool holds SSH channels opened ahead of time to origins a page is about
+// to use, announced by <link rel="preconnect"> and "dns-prefetch" hints.
+//
+// Over a high-latency tunnel opening a channel takes a full round trip to the
+// server plus the server's own DNS lookup and TCP handshake. A channel opened
+// while the browser is still parsing the page is ready when the browser
+// connects, typically with a CONNECT request for HTTPS. The SSH server resolves
+// names when a channel is opened, so dns-prefetch hints are honored the same
+// way. Channels not used within the idle timeout are closed.
+type warmPool struct {
+	ssh     SSHClient
+	idle    time.Duration             // How long a channel waits to be used
+	allowed func(address string) bool // Whether a destination is not blocked for being slow
+
+	mu      sync.Mutex
+	conns   map[string]net.Conn // Pre-opened channels by destination address
+	pending map[string]bool     // Destinations being opened
+	closed  bool
+}
+
+// newWarmPool creates a pool opening channels with an SSH client.
+func newWarmPool(ssh SSHClient, idle time.Duration, allowed func(string) bool) *warmPool {
+	return &warmPool{ssh: ssh, idle: idle, allowed: allowed, conns: make(map[string]net.Conn), pending: make(map[string]bool)}
+}
+
+// warm opens a channel to an address in the background, unless one is
+// already open or being opened, the pool is full or the destination is
+// blocked. Failures are not reported: the browser's own connection will be.
+func (p *warmPool) warm(address string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed || p.conns[address] != nil || p.pending[address] || len(p.conns)+len(p.pending) >= maxWarmPerPool {
+		return
+	}
+	if !p.allowed(address) {
+		return
+	}
+	p.pending[address] = true
+
+	go func() {
+		conn, err := p.ssh.Dial("tcp", address)
+
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		delete(p.pending, address)
+		if err != nil {
+			return
+		}
+		if p.closed || p.conns[address] != nil {
+			conn.Close()
+			return
+		}
+		p.conns[address] = conn
+		fmt.Printf("✓ Preconnected SSH channel to %s\n", address)
+
+		time.AfterFunc(p.idle, func() {
+			p.mu.Lock()
+			defer p.mu.Unlock()
+			if p.conns[address] == conn {
+				delete(p.conns, address)
+				conn.Close()
+			}
+		})
+	}()
+}
+
+// take removes and returns the pre-opened channel to an address, or nil.
+func (p *warmPool) take(address string) net.Conn {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	conn := p.conns[address]
+	delete(p.conns, address)
+	return conn
+}
+
+// close closes the waiting channels and stops opening new ones.
+func (p *warmPool) close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.closed = true
+	for address, conn := range p.conns {
+		conn.Close()
+		delete(p.conns, address)
+	}
+}
+
+// hintScanner passes a response through and preconnects to the origins its
+// resource hints name. It looks at the Link headers and, for HTML, at the
+// first hintScanLimit bytes of the body, where hints belong.
+//
+// The response is always passed on exactly as received. Chunked and gzip or
+// deflate encoded bodies are decoded on the side for scanning only; bodies in
+// other encodings, such as Brotli, are not scanned.
+type hintScanner struct {
+	w    io.Writer
+	pool *warmPool
+
+	buf       []byte          // Start of the response
+	headerEnd int             // Offset of the body in buf, 0 until the headers are complete
+	html      bool            // Whether the body is HTML in an encoding that can be decoded
+	encoding  string          // Content-Encoding of the body, empty for none
+	chunked   bool            // Whether the body has chunked transfer encoding
+	seen      map[string]bool // Origins already handled
+	done      bool            // Whether scanning has finished
+}
+
+// Write writes p and scans it for hints.
+func (s *hintScanner) Write(p []byte) (int, error) {
+	if !s.done {
+		s.scan(p)
+	}
+	return s.w.Write(p)
+}
+
+// scan adds data to the buffer and preconnects to newly found origins.
+func (s *hintScanner) scan(p []byte) {
+	s.buf = append(s.buf, p[:min(len(p), hintScanLimit-len(s.buf))]...)
+	if s.headerEnd == 0 {
+		end := bytes.Index(s.buf, []byte("\r\n\r\n"))
+		if end < 0 {
+			s.done = len(s.buf) >= hintScanLimit
+			return
+		}
+		s.headerEnd = end + 4
+		s.scanHeaders(string(s.buf[:end]))
+		if !s.html {
+			s.finish()
+			return
+		}
+	}
+
+	body := s.buf[s.headerEnd:]
+	if s.chunked {
+		body = dechunk(body)
+	}
+	if s.encoding != "" {
+		body = decodeBody(s.encoding, body)
+	}
+	for _, tag := range linkTagPattern.FindAll(body, -1) {
+		rel, href := attribute(relAttrPattern, tag), attribute(hrefAttrPattern, tag)
+		s.hint(rel, href)
+	}
+	if len(s.buf) >= hintScanLimit || len(s.seen) >= hintsPerPage {
+		s.finish()
+	}
+}
+
+// scanHeaders handles the Link headers and decides whether to scan the body.
+func (s *hintScanner) scanHeaders(header string) {
+	contentType := ""
+	for _, line := range strings.Split(header, "\r\n")[1:] {
+		name, value, _ := strings.Cut(line, ":")
+		value = strings.TrimSpace(value)
+		switch strings.ToLower(name) {
+		case "content-type":
+			contentType = strings.ToLower(value)
+		case "content-encoding":
+			if !strings.EqualFold(value, "identity") {
+				s.encoding = strings.ToLower(value)
+			}
+		case "transfer-encoding":
+			s.chunked = strings.Contains(strings.ToLower(value), "chunked")
+		case "link":
+			for _, part := range linkHeaderPart.FindAllStringSubmatch(value, -1) {
+				if m := relAttrPattern.FindStringSubmatch(part[2]); m != nil {
+					s.hint(m[1]+m[2]+m[3], part[1])
+				}
+			}
+		}
+	}
+	decodable := s.encoding == "" || s.encoding == "gzip" || s.encoding == "x-gzip" || s.encoding == "deflate"
+	s.html = strings.HasPrefix(contentType, "text/html") && decodable
+}
+
+// dechunk returns the data of the complete chunks at the start of a chunked
+// body, without the chunk framing.
+func dechunk(body []byte) []byte {
+	var data []byte
+	for {
+		line, rest, ok := bytes.Cut(body, []byte("\r\n"))
+		if !ok {
+			return data
+		}
+		sizeText, _, _ := bytes.Cut(line, []byte(";")) // Chunk extensions
+		size, err := strconv.ParseInt(string(bytes.TrimSpace(sizeText)), 16, 64)
+		if err != nil || size <= 0 || int64(len(rest)) < size {
+			// Malformed, last or incomplete chunk; a partial chunk still helps
+			if err == nil && size > 0 {
+				data = append(data, rest...)
+			}
+			return data
+		}
+		data = append(data, rest[:size]...)
+		body = bytes.TrimPrefix(rest[size:], []byte("\r\n"))
+	}
+}
+
+// decodeBody decodes the start of a gzip or deflate encoded body, returning
+// as much as the data received so far decodes to, up to hintScanLimit bytes.
+func decodeBody(encoding string, body []byte) []byte {
+	var reader io.Reader
+	var err error
+	switch encoding {
+	case "gzip", "x-gzip":
+		reader, err = gzip.NewReader(bytes.NewReader(body))
+	case "deflate":
+		reader, err = zlib.NewReader(bytes.NewReader(body))
+	default:
+		return nil
+	}
+	if err != nil {
+		return nil
+	}
+	// The body is usually incomplete, which ends reading with an error
+	data, _ := io.ReadAll(io.LimitReader(reader, hintScanLimit))
+	return data
+}
+
+// hint preconnects to the origin of a preconnect or dns-prefetch hint.
+func (s *hintScanner) hint(rel, href string) {
+	wanted := false
+	for _, token := range strings.Fields(strings.ToLower(rel)) {
+		wanted = wanted || token == "preconnect" || token == "dns-prefetch"
+	}
+	address := hintAddress(href)
+	if !wanted || address == "" || s.seen[address] || len(s.seen) >= hintsPerPage {
+		return
+	}
+	if s.seen == nil {
+		s.seen = make(map[string]bool)
+	}
+	s.seen[address] = true
+	s.pool.warm(address)
+}
+
+// finish stops scanning and releases the buffer.
+func (s *hintScanner) finish() {
+	s.done = true
+	s.buf = nil
+}
+
+// attribute returns the value of an HTML attribute matched by a pattern.
+func attribute(pattern *regexp.Regexp, tag []byte) string {
+	m := pattern.FindSubmatch(tag)
+	if m == nil {
+		return ""
+	}
+	return string(m[1]) + string(m[2]) + string(m[3])
+}
+
+// hintAddress returns the host:port of the origin a hint refers to, or "" for
+// relative references, which are the page's own origin.
+func hintAddress(href string) string {
+	href = strings.TrimSpace(href)
+	if strings.HasPrefix(href, "//") {
+		href = "https:" + href
+	}
+	u, err := url.Parse(href)
+	if err != nil || u.Hostname() == "" {
+		return ""
+	}
+	port := u.Port()
+	switch {
+	case port != "":
+	case u.Scheme == "https":
+		port = "443"
+	case u.Scheme == "http":
+		port = "80"
+	default:
+		return ""
+	}
+	if _, err := strconv.Atoi(port); err != nil {
+		return ""
+	}
+	return net.JoinHostPort(u.Hostname(), port)
+}
+
+// SetPreconnect opens SSH channels ahead of time to the origins that web
+// pages passing through the proxy announce with resource hints. It must be
+// called before the proxy is started.
+//
+// Parameters:
+//   - idle: How long an unused channel is kept open before it is closed
+func (h *HTTP) SetPreconnect(idle time.Duration) {
+	h.server.warm = newWarmPool(h.server.ssh, idle, h.server.stats.Latency.Allowed)
+}
+
+// preconnectHints returns a writer passing responses to w and preconnecting
+// to the origins they hint at, or w itself when preconnecting is disabled.
+func (h *HTTP) preconnectHints(w io.Writer) io.Writer {
+	if h.server.warm == nil {
+		return w
+	}
+	return &hintScanner{w: w, pool: h.server.warm}
+}
@@ -0,0 +1,133 @@
+package proxy
+
+import (
+	"net"
+	"sync"
+	"time"
+)
+
+// Registry tracks the open connections of a proxy server so they can be closed
+// together on shutdown.
+//
+// Both the accepted client connections and the SSH channels they are relayed to
+// are registered. Closing every registered connection unblocks all forwarding
+// goroutines, including those waiting on an idle destination, so shutdown does
+// not race with active forwards. All methods are safe for concurrent use.
+type Registry struct {
+	mu     sync.Mutex            // Protects conns and closed
+	conns  map[net.Conn]struct{} // Currently registered connections
+	closed bool                  // Set once CloseAll has been called
+	wg     sync.WaitGroup        // Counts registered connections not yet removed
+}
+
+// NewRegistry creates an empty connection registry.
+//
+// Returns:
+//   - *Registry: A registry ready to track connections
+func NewRegistry() *Registry {
+	return &Registry{conns: make(map[net.Conn]struct{})}
+}
+
+// Add registers a connection.
+//
+// Once the registry has been closed no new connections are accepted; the caller
+// must then close the connection itself.
+//
+// Parameters:
+//   - conn: The connection to track
+//
+// Returns:
+//   - bool: True if the connection was registered, false if the registry is closed
+func (r *Registry) Add(conn net.Conn) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.closed {
+		return false
+	}
+	r.conns[conn] = struct{}{}
+	r.wg.Add(1)
+	return true
+}
+
+// Remove unregisters a connection previously added with Add.
+//
+// Parameters:
+//   - conn: The connection to stop tracking
+func (r *Registry) Remove(conn net.Conn) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.conns[conn]; ok {
+		delete(r.conns, conn)
+		r.wg.Done()
+	}
+}
+
+// Len returns the number of registered connections.
+func (r *Registry) Len() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.conns)
+}
+
+// CloseAll closes every registered connection and rejects further registrations.
+//
+// Connections stay registered until their owners call Remove, so Wait can be
+// used to block until all handlers have finished.
+func (r *Registry) CloseAll() {
+	r.mu.Lock()
+	r.closed = true
+	conns := make([]net.Conn, 0, len(r.conns))
+	for conn := range r.conns {
+		conns = append(conns, conn)
+	}
+	r.mu.Unlock()
+
+	for _, conn := range conns {
+		conn.Close()
+	}
+}
+
+// Wait blocks until every registered connection has been removed or the timeout expires.
+//
+// Parameters:
+//   - timeout: Maximum time to wait
+//
+// Returns:
+//   - bool: True if all connections were removed in time
+func (r *Registry) Wait(timeout time.Duration) bool {
+	done := make(chan struct{})
+	go func() {
+		r.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
+
+// registeredConn removes a connection from its registry when it is closed.
+type registeredConn struct {
+	net.Conn
+	registry *Registry
+}
+
+// Close closes the connection and unregisters it.
+func (c *registeredConn) Close() error {
+	err := c.Conn.Close()
+	c.registry.Remove(c.Conn)
+	return err
+}
+
+// CloseWrite half-closes the connection if it supports it, or closes it.
+func (c *registeredConn) CloseWrite() error {
+	if cw, ok := c.Conn.(closeWriter); ok {
+		return cw.CloseWrite()
+	}
+	return c.Close()
+}
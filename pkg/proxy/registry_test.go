@@ -0,0 +1,121 @@
+package proxy
+
+import (
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fakeConn is a connection that only records whether it was closed.
+type fakeConn struct {
+	net.Conn
+	closed atomic.Bool
+}
+
+// Close implements net.Conn.
+func (c *fakeConn) Close() error {
+	c.closed.Store(true)
+	return nil
+}
+
+func TestRegistryConcurrentAddRemove(t *testing.T) {
+	r := NewRegistry()
+
+	var wg sync.WaitGroup
+	for range 32 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range 200 {
+				conn := &fakeConn{}
+				if !r.Add(conn) {
+					t.Error("Add rejected a connection before CloseAll")
+					return
+				}
+				if n := r.Len(); n < 1 {
+					t.Errorf("Len() = %d with a connection registered", n)
+				}
+				wrapped := &registeredConn{Conn: conn, registry: r}
+				wrapped.Close()
+				// A second Remove must not release the wait group again
+				r.Remove(conn)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if n := r.Len(); n != 0 {
+		t.Errorf("Len() = %d after all connections were removed, want 0", n)
+	}
+	if !r.Wait(time.Second) {
+		t.Error("Wait timed out with no connections registered")
+	}
+}
+
+func TestRegistryConcurrentCloseAll(t *testing.T) {
+	r := NewRegistry()
+
+	var (
+		wg         sync.WaitGroup
+		mu         sync.Mutex
+		registered []*fakeConn
+		start      = make(chan struct{})
+	)
+	// Some connections are open before shutdown starts
+	for range 100 {
+		conn := &fakeConn{}
+		r.Add(conn)
+		registered = append(registered, conn)
+	}
+	for range 16 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			for range 200 {
+				conn := &fakeConn{}
+				if !r.Add(conn) {
+					// The registry is closed; the owner closes the connection
+					conn.Close()
+					continue
+				}
+				mu.Lock()
+				registered = append(registered, conn)
+				mu.Unlock()
+				r.Len()
+			}
+		}()
+	}
+	for range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			r.CloseAll()
+		}()
+	}
+	close(start)
+	wg.Wait()
+
+	if r.Add(&fakeConn{}) {
+		t.Error("Add accepted a connection after CloseAll")
+	}
+	r.CloseAll()
+	for _, conn := range registered {
+		if !conn.closed.Load() {
+			t.Fatal("a registered connection was not closed by CloseAll")
+		}
+	}
+
+	if r.Wait(10 * time.Millisecond) {
+		t.Error("Wait returned before the owners removed their connections")
+	}
+	for _, conn := range registered {
+		go r.Remove(conn)
+	}
+	if !r.Wait(5 * time.Second) {
+		t.Errorf("Wait timed out with %d connections registered", r.Len())
+	}
+}
@@ -15,14 +15,35 @@
 package proxy
 
 import (
+	"errors"
 	"fmt"
 	"io"
 	"net"
 	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
+
+	"tunn/pkg/debuglog"
+	"tunn/pkg/progress"
+	"tunn/pkg/stats"
+	"tunn/pkg/utils"
 )
 
+// stopTimeout bounds how long Stop waits for connection handlers to finish.
+const stopTimeout = 5 * time.Second
+
+// halfCloseTimeout bounds how long a relay stays open after one side has
+// finished sending while the other side sends nothing. A variable so tests
+// can shorten it.
+var halfCloseTimeout = time.Minute
+
+// closeWriter is implemented by connections that support half-closing, such as
+// TCP connections and SSH channels.
+type closeWriter interface {
+	CloseWrite() error
+}
+
 // SSHClient defines the interface for SSH client operations required by proxy servers.
 //
 // This interface abstracts the SSH client functionality needed for establishing
@@ -40,7 +61,18 @@ type SSHClient interface {
 // connection handling with timeouts, panic recovery, and SSH channel establishment.
 // It serves as the foundation for both SOCKS5 and HTTP proxy servers.
 type Server struct {
-	ssh SSHClient // SSH client for establishing tunneled connections
+	ssh   SSHClient    // SSH client for establishing tunneled connections
+	stats *stats.Stats // Traffic statistics (optional)
+	conns *Registry    // Open client connections and SSH channels
+	warm  *warmPool    // Channels opened ahead of time (nil when disabled)
+
+	limits   Limits       // Connection limits (zero: none)
+	active   atomic.Int64 // Clients being served, counted with a connection limit
+	upRate   *rateLimiter // Upload rate limit (nil when unlimited)
+	downRate *rateLimiter // Download rate limit (nil when unlimited)
+
+	mu       sync.Mutex   // Protects listener
+	listener net.Listener // Listener accepting clients, set once started
 }
 
 // NewServer creates a new proxy server instance with the specified SSH client.
@@ -51,22 +83,44 @@ type Server struct {
 //
 // Parameters:
 //   - ssh: An initialized SSH client for tunnel connections
+//   - st: Statistics collector for traffic accounting (may be nil)
 //
 // Returns:
 //   - *Server: A new server instance ready for proxy operations
-func NewServer(ssh SSHClient) *Server {
-	return &Server{ssh: ssh}
+func NewServer(ssh SSHClient, st *stats.Stats) *Server {
+	if st == nil {
+		st = stats.New()
+	}
+	return &Server{ssh: ssh, stats: st, conns: NewRegistry()}
 }
 
-// StartProxy starts a generic proxy server with the specified handler function.
+// Listen binds the local proxy port.
 //
-// This method creates a TCP listener on the local interface and starts accepting
-// client connections. Each client connection is handled in a separate goroutine
-// using the provided handler function, enabling concurrent connection processing.
+// Binding is separate from serving so the port can be claimed while the tunnel
+// is still connecting; clients connecting early wait in the listen backlog
+// until ServeProxy starts accepting.
 //
-// The server binds to 127.0.0.1 (localhost) for security, preventing external
-// access to the proxy server. Connection errors are logged but don't terminate
-// the server unless they are permanent network errors.
+// Parameters:
+//   - proxyType: Description of the proxy type for error messages (e.g., "SOCKS5", "HTTP")
+//   - host: IP address to listen on, normally 127.0.0.1 so that only local
+//     programs can use the proxy
+//   - localPort: Local port number to listen on
+//
+// Returns:
+//   - net.Listener: The bound listener
+//   - error: An error if the port cannot be bound
+func Listen(proxyType, host string, localPort int) (net.Listener, error) {
+	listener, err := net.Listen("tcp", net.JoinHostPort(host, strconv.Itoa(localPort)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to start %s proxy: %w", proxyType, err)
+	}
+	return listener, nil
+}
+
+// StartProxy starts a generic proxy server with the specified handler function.
+//
+// This method binds the local port on 127.0.0.1 with Listen and starts serving
+// it with ServeProxy.
 //
 // Parameters:
 //   - proxyType: Description of the proxy type for logging (e.g., "SOCKS5", "HTTP")
@@ -79,17 +133,54 @@ func NewServer(ssh SSHClient) *Server {
 // The method returns immediately after starting the server goroutine, allowing
 // the caller to continue with other operations.
 func (s *Server) StartProxy(proxyType string, localPort int, handler func(net.Conn)) error {
-	listener, err := net.Listen("tcp", fmt.Sprintf("127.0.0.1:%d", localPort))
+	listener, err := Listen(proxyType, "127.0.0.1", localPort)
 	if err != nil {
-		return fmt.Errorf("failed to start %s proxy: %v", proxyType, err)
+		return err
+	}
+	s.ServeProxy(proxyType, listener, handler)
+	return nil
+}
+
+// ServeProxy starts accepting client connections on a bound listener.
+//
+// Each client connection is handled in a separate goroutine using the provided
+// handler function, enabling concurrent connection processing. With a worker
+// limit set, a fixed pool of goroutines handles them instead and accepting
+// pauses while the clients waiting for a worker fill its queue. Connection errors
+// are logged but don't terminate the server unless they are permanent network
+// errors. The listener is owned by the server from now on and closed by Stop.
+//
+// Parameters:
+//   - proxyType: Description of the proxy type for logging (e.g., "SOCKS5", "HTTP")
+//   - listener: The listener returned by Listen
+//   - handler: Function to handle each client connection
+func (s *Server) ServeProxy(proxyType string, listener net.Listener, handler func(net.Conn)) {
+	s.mu.Lock()
+	s.listener = listener
+	s.mu.Unlock()
+
+	serve := func(clientConn net.Conn) {
+		s.stats.ConnOpened()
+		defer s.stats.ConnClosed()
+		defer s.release()
+		defer s.conns.Remove(clientConn)
+		handler(clientConn)
+	}
+	var pool *workerPool
+	if s.limits.Workers > 0 {
+		pool = newWorkerPool(proxyType, s.limits.Workers, s.limits.Queue, serve)
 	}
 
 	go func() {
 		defer listener.Close()
+		if pool != nil {
+			defer pool.close()
+		}
 		for {
 			clientConn, err := listener.Accept()
 			if err != nil {
-				if netErr, ok := err.(net.Error); ok && !netErr.Temporary() {
+				// Listeners on the SSH server report closing as a plain io.EOF
+				if netErr, ok := err.(net.Error); !ok || !netErr.Temporary() {
 					fmt.Printf("→ %s proxy listener closed\n", proxyType)
 					return
 				}
@@ -98,12 +189,51 @@ func (s *Server) StartProxy(proxyType string, localPort int, handler func(net.Co
 				continue
 			}
 
-			go handler(clientConn)
+			if !s.admit() {
+				fmt.Printf("✗ Refusing client %s: %d connections already open\n", clientConn.RemoteAddr(), s.limits.MaxConnections)
+				clientConn.Close()
+				continue
+			}
+			if !s.conns.Add(clientConn) {
+				s.release()
+				clientConn.Close()
+				return
+			}
+			if pool != nil {
+				pool.submit(clientConn)
+			} else {
+				go serve(clientConn)
+			}
 		}
 	}()
 
-	fmt.Printf("✓ %s proxy started.\n", proxyType)
-	return nil
+	progress.Printf("✓ %s proxy started.\n", proxyType)
+}
+
+// Stop closes the listener and all open client connections and SSH channels.
+//
+// It waits up to the given timeout for the connection handlers to finish, so
+// no forwarding goroutine is left touching a transport that is being closed.
+//
+// Parameters:
+//   - timeout: Maximum time to wait for the handlers
+func (s *Server) Stop(timeout time.Duration) {
+	s.mu.Lock()
+	listener := s.listener
+	s.listener = nil
+	s.mu.Unlock()
+
+	if listener != nil {
+		listener.Close()
+	}
+	if s.warm != nil {
+		s.warm.close()
+	}
+	s.conns.CloseAll()
+
+	if !s.conns.Wait(timeout) {
+		fmt.Printf("✗ %d proxy connection(s) did not close in time\n", s.conns.Len())
+	}
 }
 
 // HandleClientWithTimeout provides standardized client connection handling with timeout and panic recovery.
@@ -139,6 +269,13 @@ func (s *Server) HandleClientWithTimeout(clientConn net.Conn, clientType string,
 	handler()
 }
 
+// ErrDestinationBlocked is returned by DialSSH when a destination is temporarily
+// rejected because its channel opens have been consistently slow.
+var ErrDestinationBlocked = errors.New("destination temporarily blocked: channel opens consistently slow")
+
+// ErrServerStopped is returned by DialSSH when the proxy server is shutting down.
+var ErrServerStopped = errors.New("proxy server stopped")
+
 // OpenSSHChannel establishes an SSH tunnel connection to the specified destination.
 //
 // This method creates a new SSH channel through the tunnel to the target host and port,
@@ -161,54 +298,211 @@ func (s *Server) HandleClientWithTimeout(clientConn net.Conn, clientType string,
 // This method blocks until the connection is closed by either the client or
 // the remote server, making it suitable for use in connection handler goroutines.
 func (s *Server) OpenSSHChannel(clientConn net.Conn, host string, port int) {
-	fmt.Printf("→ Opening SSH channel to %s:%d\n", host, port)
+	sshConn, err := s.DialSSH(host, port)
+	if err != nil {
+		return
+	}
+	s.Relay(clientConn, sshConn, host, port)
+}
 
+// DialSSH opens an SSH channel to the specified destination and records how long it took.
+//
+// Channel-open latency is tracked per destination. When the opens to a destination
+// are consistently slower than the configured threshold a warning is printed, and
+// if blocking is enabled new connections to it are rejected for a while with
+// ErrDestinationBlocked.
+//
+// A channel opened ahead of time for the destination is used when there is
+// one, without opening another.
+//
+// Parameters:
+//   - host: Target destination hostname or IP address
+//   - port: Target destination port number
+//
+// Returns:
+//   - net.Conn: The SSH channel connected to the destination, registered until closed
+//   - error: An error if the destination is blocked, the server is stopped, or the channel cannot be opened
+func (s *Server) DialSSH(host string, port int) (net.Conn, error) {
 	address := net.JoinHostPort(host, strconv.Itoa(port))
+	latency := s.stats.Latency
+
+	if !latency.Allowed(address) {
+		fmt.Printf("✗ Rejected connection to slow destination %s\n", address)
+		return nil, ErrDestinationBlocked
+	}
+
+	if s.warm != nil {
+		if sshConn := s.warm.take(address); sshConn != nil {
+			if !s.conns.Add(sshConn) {
+				sshConn.Close()
+				return nil, ErrServerStopped
+			}
+			fmt.Printf("✓ Using preconnected SSH channel to %s\n", address)
+			return &registeredConn{Conn: sshConn, registry: s.conns}, nil
+		}
+	}
+
+	fmt.Printf("→ Opening SSH channel to %s\n", address)
+
+	start := time.Now()
 	sshConn, err := s.ssh.Dial("tcp", address)
+	elapsed := time.Since(start)
 	if err != nil {
 		fmt.Printf("✗ Failed to open SSH channel: %v\n", err)
-		return
+		return nil, err
 	}
+
+	if latency.Record(address, elapsed) {
+		policy := latency.Policy()
+		if policy.Block {
+			fmt.Printf("✗ Destination %s is consistently slow (channel open took %v), blocking it for %v\n",
+				address, elapsed.Round(time.Millisecond), policy.BlockDuration)
+		} else {
+			fmt.Printf("✗ Destination %s is consistently slow (channel open took %v), it may be throttled or blocked\n",
+				address, elapsed.Round(time.Millisecond))
+		}
+	}
+
+	// Track the channel so shutdown can unblock the forwarding goroutines
+	if !s.conns.Add(sshConn) {
+		sshConn.Close()
+		return nil, ErrServerStopped
+	}
+
+	fmt.Printf("✓ SSH channel established to %s (%v)\n", address, elapsed.Round(time.Millisecond))
+	return &registeredConn{Conn: sshConn, registry: s.conns}, nil
+}
+
+// Relay forwards data between a client connection and an open SSH channel until
+// either side closes, then closes the SSH channel.
+//
+// The time until the destination sends its first data is recorded as its
+// first-byte latency.
+//
+// Parameters:
+//   - clientConn: The local client connection
+//   - sshConn: The SSH channel returned by DialSSH
+//   - host: Target destination hostname, used for logging
+//   - port: Target destination port, used for logging
+func (s *Server) Relay(clientConn, sshConn net.Conn, host string, port int) {
 	defer sshConn.Close()
 
-	fmt.Printf("✓ SSH channel established to %s:%d\n", host, port)
+	// The negotiation timeout no longer applies once data is relayed
+	clientConn.SetDeadline(time.Time{})
 
 	// Forward data bidirectionally
-	s.forwardData(clientConn, sshConn)
+	start := time.Now()
+	address := net.JoinHostPort(host, strconv.Itoa(port))
+	firstByte := &firstByteConn{Conn: sshConn, start: start, record: func(d time.Duration) {
+		s.stats.Latency.RecordFirstByte(address, d)
+	}}
+	up, down := s.forwardData(clientConn, firstByte)
 	fmt.Printf("→ SSH channel to %s:%d closed\n", host, port)
+	debuglog.Printf("%s:%d carried ↑ %s ↓ %s in %s\n", host, port,
+		utils.FormatBytes(up), utils.FormatBytes(down), time.Since(start).Round(time.Millisecond))
+}
+
+// firstByteConn reports how long a connection took to deliver its first data.
+type firstByteConn struct {
+	net.Conn
+	start  time.Time           // Time the wait for data started
+	record func(time.Duration) // Called with the wait on the first read returning data
+	seen   bool                // Whether data was read; only one goroutine reads
+}
+
+// Read reads from the connection and records the first data.
+func (c *firstByteConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	if n > 0 && !c.seen {
+		c.seen = true
+		c.record(time.Since(c.start))
+	}
+	return n, err
+}
+
+// CloseWrite half-closes the connection if it supports it, or closes it.
+func (c *firstByteConn) CloseWrite() error {
+	closeWrite(c.Conn)
+	return nil
 }
 
 // forwardData manages bidirectional data forwarding between two network connections.
 //
-// This method creates two goroutines to handle concurrent data forwarding in both
-// directions between the connections. It uses a WaitGroup to ensure both forwarding
-// operations complete before returning.
+// Data is copied from conn1 to conn2 and from conn2 to conn1 simultaneously,
+// enabling full-duplex communication between the endpoints. Bytes written to
+// conn2 are accounted as upload and bytes written to conn1 as download.
+//
+// When one direction ends, the end of data is passed on by half-closing the
+// connection it was writing to, so protocols that rely on half-close keep
+// working. The other direction stays open as long as it carries data, and both
+// connections are closed once it has been quiet for halfCloseTimeout; without
+// this bound a peer that never closes its side would keep the forwarding
+// goroutines and the SSH channel open forever.
 //
-// The forwarding continues until one of the connections is closed or encounters
-// an error, at which point both forwarding goroutines will terminate naturally
-// due to the io.Copy operations completing.
+// Both directions share the proxy's rate limits, and with an idle timeout the
+// connections are closed once neither direction has carried data for that long.
 //
 // Parameters:
 //   - conn1: First network connection
 //   - conn2: Second network connection
 //
-// Data is copied from conn1 to conn2 and from conn2 to conn1 simultaneously,
-// enabling full-duplex communication between the endpoints.
-func (s *Server) forwardData(conn1, conn2 net.Conn) {
-	var wg sync.WaitGroup
-	wg.Add(2)
+// Returns:
+//   - up: Bytes written to conn2
+//   - down: Bytes written to conn1
+func (s *Server) forwardData(conn1, conn2 net.Conn) (up, down int64) {
+	// Each direction reports its activity record when it ends
+	done := make(chan *atomic.Int64, 2)
+	var lastActive, upActive, downActive atomic.Int64
+	lastActive.Store(time.Now().UnixNano())
+	defer s.watchIdle(&lastActive, conn1, conn2)()
 
-	// Forward conn1 -> conn2
+	// Forward conn2 -> conn1
 	go func() {
-		defer wg.Done()
-		io.Copy(conn1, conn2)
+		w := &relayWriter{w: conn1, limiter: s.downRate, lastActive: &lastActive, active: &downActive}
+		down, _ = io.Copy(&stats.CountingWriter{W: w, Count: s.stats.AddDown}, conn2)
+		closeWrite(conn1)
+		done <- &downActive
 	}()
 
-	// Forward conn2 -> conn1
+	// Forward conn1 -> conn2
 	go func() {
-		defer wg.Done()
-		io.Copy(conn2, conn1)
+		w := &relayWriter{w: conn2, limiter: s.upRate, lastActive: &lastActive, active: &upActive}
+		up, _ = io.Copy(&stats.CountingWriter{W: w, Count: s.stats.AddUp}, conn1)
+		closeWrite(conn2)
+		done <- &upActive
 	}()
 
-	wg.Wait()
+	// The remaining direction is closed once quiet for halfCloseTimeout
+	remaining := &upActive
+	if <-done == &upActive {
+		remaining = &downActive
+	}
+	remaining.Store(time.Now().UnixNano())
+	timer := time.NewTimer(halfCloseTimeout)
+	defer timer.Stop()
+	for {
+		select {
+		case <-done:
+			return up, down
+		case <-timer.C:
+		}
+		quiet := time.Since(time.Unix(0, remaining.Load()))
+		if quiet < halfCloseTimeout {
+			timer.Reset(halfCloseTimeout - quiet)
+			continue
+		}
+		conn1.Close()
+		conn2.Close()
+		<-done
+		return up, down
+	}
+}
+
+// closeWrite half-closes a connection if it supports it, or closes it.
+func closeWrite(conn net.Conn) {
+	if cw, ok := conn.(closeWriter); ok {
+		cw.CloseWrite()
+		return
+	}
+	conn.Close()
 }
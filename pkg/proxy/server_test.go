@@ -0,0 +1,117 @@
+package proxy
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+// tcpPair returns the two ends of a loopback TCP connection.
+func tcpPair(t *testing.T) (net.Conn, net.Conn) {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen failed: %v", err)
+	}
+	defer l.Close()
+
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		conn, _ := l.Accept()
+		accepted <- conn
+	}()
+	dialed, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatalf("dial failed: %v", err)
+	}
+	conn := <-accepted
+	if conn == nil {
+		t.Fatal("accept failed")
+	}
+	t.Cleanup(func() {
+		dialed.Close()
+		conn.Close()
+	})
+	return dialed, conn
+}
+
+// shortHalfClose shortens halfCloseTimeout for the duration of a test.
+func shortHalfClose(t *testing.T, timeout time.Duration) {
+	previous := halfCloseTimeout
+	halfCloseTimeout = timeout
+	t.Cleanup(func() { halfCloseTimeout = previous })
+}
+
+func TestForwardDataKeepsStreamingAfterHalfClose(t *testing.T) {
+	shortHalfClose(t, 100*time.Millisecond)
+	client, conn1 := tcpPair(t)
+	conn2, destination := tcpPair(t)
+
+	s := NewServer(nil, nil)
+	forwarded := make(chan int64, 1)
+	go func() {
+		_, down := s.forwardData(conn1, conn2)
+		forwarded <- down
+	}()
+
+	// The client sends its request and half-closes, as nc -N does
+	if _, err := client.Write([]byte("request")); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+	client.(*net.TCPConn).CloseWrite()
+
+	// The destination answers for several times the timeout
+	chunk := bytes.Repeat([]byte("x"), 1024)
+	sent := make(chan int, 1)
+	go func() {
+		total := 0
+		defer func() { sent <- total }()
+		io.Copy(io.Discard, destination)
+		deadline := time.Now().Add(5 * halfCloseTimeout)
+		for time.Now().Before(deadline) {
+			if _, err := destination.Write(chunk); err != nil {
+				return
+			}
+			total += len(chunk)
+			time.Sleep(halfCloseTimeout / 5)
+		}
+		destination.(*net.TCPConn).CloseWrite()
+	}()
+
+	client.SetReadDeadline(time.Now().Add(10 * time.Second))
+	received, err := io.ReadAll(client)
+	if err != nil {
+		t.Fatalf("read failed after %d bytes: %v", len(received), err)
+	}
+	if total := <-sent; len(received) != total || total < 10*len(chunk) {
+		t.Errorf("received %d bytes, destination sent %d", len(received), total)
+	}
+	if down := <-forwarded; down != int64(len(received)) {
+		t.Errorf("forwardData counted %d bytes down, want %d", down, len(received))
+	}
+}
+
+func TestForwardDataClosesQuietHalfClosedRelay(t *testing.T) {
+	shortHalfClose(t, 100*time.Millisecond)
+	client, conn1 := tcpPair(t)
+	conn2, destination := tcpPair(t)
+
+	s := NewServer(nil, nil)
+	finished := make(chan struct{})
+	go func() {
+		s.forwardData(conn1, conn2)
+		close(finished)
+	}()
+
+	// The destination reads the request but never answers or closes
+	go io.Copy(io.Discard, destination)
+	client.(*net.TCPConn).CloseWrite()
+
+	select {
+	case <-finished:
+	case <-time.After(5 * time.Second):
+		t.Fatal("relay stayed open after the remaining direction was quiet")
+	}
+}
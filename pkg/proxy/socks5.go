@@ -2,10 +2,18 @@ package proxy
 
 import (
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"io"
 	"net"
 	"time"
+
+	"tunn/pkg/acl"
+	"tunn/pkg/blocklist"
+	"tunn/pkg/debuglog"
+	"tunn/pkg/stats"
+
+	"golang.org/x/crypto/ssh"
 )
 
 // SOCKS5 implements a SOCKS5 proxy server that forwards connections through SSH tunnels.
@@ -30,12 +38,13 @@ type SOCKS5 struct {
 //
 // Parameters:
 //   - ssh: An initialized SSH client for tunnel connections
+//   - st: Statistics collector for traffic accounting (may be nil)
 //
 // Returns:
 //   - *SOCKS5: A new SOCKS5 proxy server instance
-func NewSOCKS5(ssh SSHClient) *SOCKS5 {
+func NewSOCKS5(ssh SSHClient, st *stats.Stats) *SOCKS5 {
 	return &SOCKS5{
-		server: NewServer(ssh),
+		server: NewServer(ssh, st),
 	}
 }
 
@@ -57,6 +66,22 @@ func (s *SOCKS5) Start(localPort int) error {
 	return s.server.StartProxy("SOCKS5", localPort, s.handleClient)
 }
 
+// Serve starts serving SOCKS5 clients on a listener bound with Listen.
+//
+// Parameters:
+//   - listener: The bound local listener, owned by the proxy from now on
+func (s *SOCKS5) Serve(listener net.Listener) {
+	s.server.ServeProxy("SOCKS5", listener, s.handleClient)
+}
+
+// Stop stops accepting SOCKS5 clients and closes all open connections.
+//
+// It waits briefly for the connection handlers to finish so that shutdown does
+// not race with active forwards.
+func (s *SOCKS5) Stop() {
+	s.server.Stop(stopTimeout)
+}
+
 // handleClient processes a single SOCKS5 client connection.
 //
 // This method manages the complete SOCKS5 client session including timeout
@@ -91,7 +116,7 @@ func (s *SOCKS5) handleClient(clientConn net.Conn) {
 //  1. Method selection negotiation (supporting no authentication - method 0x00)
 //  2. Connection request processing (supporting CONNECT command only)
 //  3. Address parsing for IPv4, IPv6, and domain names
-//  4. SSH tunnel establishment and data forwarding
+//  4. SSH tunnel establishment, reply with the outcome, and data forwarding
 //
 // The implementation supports all standard SOCKS5 address types:
 //   - Type 1: IPv4 address (4 bytes)
@@ -200,12 +225,52 @@ func (s *SOCKS5) handleSOCKS5(clientConn net.Conn) {
 		return
 	}
 	port = int(binary.BigEndian.Uint16(portBytes))
+	debuglog.Printf("SOCKS5 CONNECT to %s:%d from %s, %d auth method(s) offered\n", host, port, clientConn.RemoteAddr(), nmethods)
+
+	// Open SSH channel before replying so the client learns the real outcome.
+	// The negotiation timeout does not cover the wait for the channel, which
+	// may queue behind the limits for longer, or the reply could not be sent.
+	clientConn.SetDeadline(time.Time{})
+	sshConn, err := s.server.DialSSH(host, port)
+	if err != nil {
+		code := replyCode(err)
+		if debuglog.Enabled() {
+			debuglog.Printf("SOCKS5 CONNECT to %s:%d failed with reply %d [%s]: %s\n", host, port, code, newFailureID(), describeDialError(err))
+		}
+		s.sendError(clientConn, code)
+		return
+	}
 
 	// Send success response
-	s.sendSuccess(clientConn)
+	if err := s.sendSuccess(clientConn); err != nil {
+		fmt.Printf("✗ Error sending SOCKS5 reply: %v\n", err)
+		sshConn.Close()
+		return
+	}
 
-	// Open SSH channel
-	s.server.OpenSSHChannel(clientConn, host, port)
+	s.server.Relay(clientConn, sshConn, host, port)
+}
+
+// replyCode maps a channel-open error to the closest SOCKS5 reply code.
+//
+// Reply codes used:
+//   - 0x02: Connection not allowed by ruleset (blocked, denied by access rules or a blocklist, or prohibited by the server)
+//   - 0x05: Connection refused (the SSH server could not connect to the destination)
+//   - 0x01: General SOCKS server failure (anything else, e.g. tunnel down)
+func replyCode(err error) byte {
+	if errors.Is(err, ErrDestinationBlocked) || errors.Is(err, acl.ErrDenied) || errors.Is(err, blocklist.ErrBlocked) {
+		return 2
+	}
+	var openErr *ssh.OpenChannelError
+	if errors.As(err, &openErr) {
+		switch openErr.Reason {
+		case ssh.Prohibited:
+			return 2
+		case ssh.ConnectionFailed:
+			return 5
+		}
+	}
+	return 1
 }
 
 // sendError sends a SOCKS5 error response to the client.
@@ -216,6 +281,8 @@ func (s *SOCKS5) handleSOCKS5(clientConn net.Conn) {
 //
 // SOCKS5 error codes:
 //   - 0x01: General SOCKS server failure
+//   - 0x02: Connection not allowed by ruleset
+//   - 0x05: Connection refused
 //   - 0x07: Command not supported
 //   - 0x08: Address type not supported
 //   - (other codes as defined in RFC 1928)
@@ -223,9 +290,13 @@ func (s *SOCKS5) handleSOCKS5(clientConn net.Conn) {
 // Parameters:
 //   - clientConn: The client connection to send the error response to
 //   - errCode: The SOCKS5 error code to send (as defined in RFC 1928)
-func (s *SOCKS5) sendError(clientConn net.Conn, errCode byte) {
+//
+// Returns:
+//   - error: An error if the response cannot be written
+func (s *SOCKS5) sendError(clientConn net.Conn, errCode byte) error {
 	response := []byte{5, errCode, 0, 1, 0, 0, 0, 0, 0, 0}
-	clientConn.Write(response)
+	_, err := clientConn.Write(response)
+	return err
 }
 
 // sendSuccess sends a SOCKS5 success response to the client.
@@ -244,7 +315,11 @@ func (s *SOCKS5) sendError(clientConn net.Conn, errCode byte) {
 //
 // Parameters:
 //   - clientConn: The client connection to send the success response to
-func (s *SOCKS5) sendSuccess(clientConn net.Conn) {
+//
+// Returns:
+//   - error: An error if the response cannot be written
+func (s *SOCKS5) sendSuccess(clientConn net.Conn) error {
 	response := []byte{5, 0, 0, 1, 0, 0, 0, 0, 0, 0}
-	clientConn.Write(response)
+	_, err := clientConn.Write(response)
+	return err
 }
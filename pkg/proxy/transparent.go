@@ -0,0 +1,116 @@
+package proxy
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"time"
+
+	"tunn/pkg/stats"
+)
+
+// Transparent forwards connections redirected to it by the firewall through
+// the SSH tunnel, for gateways and routers whose clients are not configured
+// to use a proxy.
+//
+// Connections reach the listener through an iptables REDIRECT rule, which
+// keeps their original destination readable with SO_ORIGINAL_DST, or through
+// a TPROXY rule, which leaves it as the local address of the connection. The
+// client sends no proxy handshake; its bytes are relayed to the original
+// destination as they are. Transparent proxying is only available on Linux.
+type Transparent struct {
+	server *Server         // Embedded server for common proxy functionality
+	port   int             // Port of the listener
+	local  map[string]bool // Addresses of this host, set when serving starts
+}
+
+// NewTransparent creates a transparent proxy with the specified SSH client.
+//
+// Parameters:
+//   - ssh: An initialized SSH client for tunnel connections
+//   - st: Statistics collector for traffic accounting (may be nil)
+//
+// Returns:
+//   - *Transparent: A new transparent proxy instance
+func NewTransparent(ssh SSHClient, st *stats.Stats) *Transparent {
+	return &Transparent{
+		server: NewServer(ssh, st),
+	}
+}
+
+// ListenTransparent binds the port of a transparent proxy. The socket is
+// marked IP_TRANSPARENT where permitted (CAP_NET_ADMIN), so that TPROXY rules
+// can deliver connections to it; REDIRECT rules work either way.
+//
+// Parameters:
+//   - host: IP address to listen on
+//   - localPort: Local port number to listen on
+//
+// Returns:
+//   - net.Listener: The bound listener
+//   - error: An error if the port cannot be bound or the platform is unsupported
+func ListenTransparent(host string, localPort int) (net.Listener, error) {
+	listener, err := listenTransparent(net.JoinHostPort(host, strconv.Itoa(localPort)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to start transparent proxy: %w", err)
+	}
+	return listener, nil
+}
+
+// SetLimits applies limits to the connections served; see Server.SetLimits.
+func (t *Transparent) SetLimits(limits Limits) {
+	t.server.SetLimits(limits)
+}
+
+// Serve starts serving redirected connections on a listener bound with
+// ListenTransparent.
+//
+// Parameters:
+//   - listener: The bound local listener, owned by the proxy from now on
+func (t *Transparent) Serve(listener net.Listener) {
+	if addr, ok := listener.Addr().(*net.TCPAddr); ok {
+		t.port = addr.Port
+	}
+	t.local = make(map[string]bool)
+	addrs, _ := net.InterfaceAddrs()
+	for _, addr := range addrs {
+		if ipNet, ok := addr.(*net.IPNet); ok {
+			t.local[ipNet.IP.String()] = true
+		}
+	}
+	t.server.ServeProxy("transparent", listener, t.handleClient)
+}
+
+// Stop stops accepting connections and closes all open ones.
+func (t *Transparent) Stop() {
+	t.server.Stop(stopTimeout)
+}
+
+// handleClient forwards a redirected connection to its original destination.
+//
+// Connections made to the proxy port of this host directly rather than
+// redirected to it are refused, as relaying them would connect the proxy to
+// itself.
+//
+// Parameters:
+//   - clientConn: The incoming redirected connection
+func (t *Transparent) handleClient(clientConn net.Conn) {
+	t.server.HandleClientWithTimeout(clientConn, "transparent", 30*time.Second, func() {
+		destination, err := originalDestination(clientConn)
+		if err != nil {
+			fmt.Printf("✗ Cannot tell the original destination of %s: %v\n", clientConn.RemoteAddr(), err)
+			return
+		}
+		if destination.Port == t.port && (destination.IP.IsLoopback() || t.local[destination.IP.String()]) {
+			fmt.Printf("✗ Refusing %s: connected to the transparent proxy directly, not through a firewall redirect\n", clientConn.RemoteAddr())
+			return
+		}
+
+		host, port := destination.IP.String(), destination.Port
+		sshConn, err := t.server.DialSSH(host, port)
+		if err != nil {
+			return
+		}
+		t.server.Relay(clientConn, sshConn, host, port)
+	})
+}
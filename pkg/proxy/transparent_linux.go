@@ -0,0 +1,78 @@
+//go:build linux
+
+package proxy
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"net"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// ip6tSOOriginalDst is IP6T_SO_ORIGINAL_DST, the IPv6 counterpart of
+// SO_ORIGINAL_DST, which x/sys/unix does not define.
+const ip6tSOOriginalDst = 80
+
+// listenTransparent binds a TCP address with IP_TRANSPARENT set when the
+// process is permitted to set it.
+func listenTransparent(address string) (net.Listener, error) {
+	config := net.ListenConfig{
+		Control: func(network, address string, c syscall.RawConn) error {
+			return c.Control(func(fd uintptr) {
+				// Needs CAP_NET_ADMIN and only matters for TPROXY rules
+				unix.SetsockoptInt(int(fd), unix.SOL_IP, unix.IP_TRANSPARENT, 1)
+				unix.SetsockoptInt(int(fd), unix.SOL_IPV6, unix.IPV6_TRANSPARENT, 1)
+			})
+		},
+	}
+	return config.Listen(context.Background(), "tcp", address)
+}
+
+// originalDestination returns the address a redirected connection was made
+// to: the destination recorded by connection tracking for REDIRECT rules, or
+// the local address of the connection for TPROXY rules.
+func originalDestination(conn net.Conn) (*net.TCPAddr, error) {
+	tcpConn, ok := conn.(*net.TCPConn)
+	if !ok {
+		return nil, errors.New("not a TCP connection")
+	}
+	raw, err := tcpConn.SyscallConn()
+	if err != nil {
+		return nil, err
+	}
+
+	var destination *net.TCPAddr
+	var sockErr error
+	err = raw.Control(func(fd uintptr) {
+		// The getsockopt wrappers below are used for their buffer sizes: 16
+		// bytes hold a sockaddr_in and 32 bytes a sockaddr_in6
+		if mreq, err := unix.GetsockoptIPv6Mreq(int(fd), unix.SOL_IP, unix.SO_ORIGINAL_DST); err == nil {
+			b := mreq.Multiaddr
+			destination = &net.TCPAddr{IP: net.IPv4(b[4], b[5], b[6], b[7]), Port: int(binary.BigEndian.Uint16(b[2:4]))}
+			return
+		}
+		info, err := unix.GetsockoptIPv6MTUInfo(int(fd), unix.SOL_IPV6, ip6tSOOriginalDst)
+		if err != nil {
+			sockErr = err
+			return
+		}
+		// The port is in network byte order in memory
+		port := binary.NativeEndian.AppendUint16(nil, info.Addr.Port)
+		destination = &net.TCPAddr{IP: net.IP(info.Addr.Addr[:]), Port: int(binary.BigEndian.Uint16(port))}
+	})
+	if err != nil {
+		return nil, err
+	}
+	if destination != nil {
+		return destination, nil
+	}
+
+	// Without connection tracking, TPROXY keeps the destination as the local address
+	if local, ok := conn.LocalAddr().(*net.TCPAddr); ok && sockErr != nil {
+		return local, nil
+	}
+	return nil, sockErr
+}
@@ -0,0 +1,22 @@
+//go:build !linux
+
+package proxy
+
+import (
+	"errors"
+	"net"
+)
+
+// errTransparentUnsupported is returned where the original destination of a
+// redirected connection cannot be recovered.
+var errTransparentUnsupported = errors.New("transparent proxying is only supported on Linux")
+
+// listenTransparent is not supported on this platform.
+func listenTransparent(address string) (net.Listener, error) {
+	return nil, errTransparentUnsupported
+}
+
+// originalDestination is not supported on this platform.
+func originalDestination(conn net.Conn) (*net.TCPAddr, error) {
+	return nil, errTransparentUnsupported
+}
@@ -0,0 +1,108 @@
+// Package redact masks secrets in output printed by Tunn.
+//
+// Console output of a tunnel often ends up in shared logs, bug reports and
+// screenshots. Every place that prints configuration or connection details runs
+// the values through this package, so usernames, passwords, tokens and keys are
+// masked unless secrets are explicitly shown with --show-secrets.
+//
+// Redaction is enabled by default and controlled process-wide with SetShowSecrets.
+package redact
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+	"sync/atomic"
+)
+
+// mask replaces redacted values.
+const mask = "****"
+
+// showSecrets disables redaction when set.
+var showSecrets atomic.Bool
+
+// secretParam matches URL query parameters and key=value pairs with secret-looking names.
+var secretParam = regexp.MustCompile(`(?i)((?:^|[?&\s;,])(?:[a-z0-9_-]*(?:token|secret|password|passwd|pass|pwd|key|sig|signature|auth|session)[a-z0-9_-]*)=)[^&\s;,"']+`)
+
+// secretHeader matches HTTP header lines carrying credentials.
+var secretHeader = regexp.MustCompile(`(?im)^((?:authorization|proxy-authorization|cookie|set-cookie|x-api-key|x-auth-token|sec-websocket-key|sec-websocket-accept)\s*:\s*)[^\r\n]+`)
+
+// urlUserinfo matches the password part of credentials embedded in URLs.
+var urlUserinfo = regexp.MustCompile(`(://[^/\s:@]+:)[^/\s@]+@`)
+
+// SetShowSecrets enables or disables redaction for the whole process.
+//
+// Parameters:
+//   - show: True to print secrets unmasked, false to redact them (the default)
+func SetShowSecrets(show bool) {
+	showSecrets.Store(show)
+}
+
+// Secret masks a secret value completely.
+//
+// Parameters:
+//   - value: The secret, such as a password or key
+//
+// Returns:
+//   - string: The masked value, or the value itself when secrets are shown
+func Secret(value string) string {
+	if showSecrets.Load() || value == "" {
+		return value
+	}
+	return mask
+}
+
+// Username masks an account name while keeping its first character, so
+// different accounts can still be told apart in logs.
+//
+// Parameters:
+//   - name: The username
+//
+// Returns:
+//   - string: The masked username, or the name itself when secrets are shown
+func Username(name string) string {
+	if showSecrets.Load() || name == "" {
+		return name
+	}
+	return name[:1] + mask
+}
+
+// URL masks the password and secret-looking query parameters of a URL.
+//
+// Parameters:
+//   - raw: An absolute URL or a request path with an optional query
+//
+// Returns:
+//   - string: The URL with secrets masked
+func URL(raw string) string {
+	if showSecrets.Load() {
+		return raw
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return Text(raw)
+	}
+	if u.RawQuery != "" {
+		u.RawQuery = strings.TrimPrefix(secretParam.ReplaceAllString("?"+u.RawQuery, "${1}"+mask), "?")
+	}
+	return urlUserinfo.ReplaceAllString(u.String(), "${1}"+mask+"@")
+}
+
+// Text masks secrets in free-form text such as error messages and HTTP headers.
+//
+// Masked are credential headers (Authorization, Cookie and similar), passwords
+// embedded in URLs, and key=value pairs whose name looks like a secret.
+//
+// Parameters:
+//   - text: The text to scrub
+//
+// Returns:
+//   - string: The text with secrets masked
+func Text(text string) string {
+	if showSecrets.Load() {
+		return text
+	}
+	text = secretHeader.ReplaceAllString(text, "${1}"+mask)
+	text = urlUserinfo.ReplaceAllString(text, "${1}"+mask+"@")
+	return secretParam.ReplaceAllString(text, "${1}"+mask)
+}
@@ -0,0 +1,100 @@
+// Package reqlog records which sites are contacted through the HTTP proxy.
+//
+// The log helps auditing what an application talks to through the tunnel. It
+// holds request metadata only, one JSON object per line: time, method, host,
+// port, path, response status and duration. Request and response bodies and
+// headers are never recorded, and query strings are dropped from paths since
+// they routinely carry tokens and session identifiers. HTTPS traffic passes
+// the proxy as CONNECT tunnels, so for it only the host is known.
+//
+// Domains can be excluded from the log, together with their subdomains, for
+// sites whose visits should not be written down at all.
+package reqlog
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Entry is one recorded request.
+type Entry struct {
+	Time     time.Time `json:"time"`             // When the request was received
+	Method   string    `json:"method"`           // Request method, CONNECT for tunnels
+	Host     string    `json:"host"`             // Destination hostname or IP address
+	Port     int       `json:"port"`             // Destination port
+	Path     string    `json:"path,omitempty"`   // Request path without the query (empty for CONNECT)
+	Status   int       `json:"status,omitempty"` // Response status, 0 if none was received
+	Duration int64     `json:"durationMs"`       // Time until the response or tunnel completed, in milliseconds
+}
+
+// Log appends entries to a file.
+type Log struct {
+	mu      sync.Mutex
+	file    *os.File
+	exclude []string // Lowercase domains not recorded, including their subdomains
+}
+
+// Open opens a request log for appending, creating it if needed.
+//
+// Parameters:
+//   - path: The log file
+//   - exclude: Domains whose requests are not recorded
+//
+// Returns:
+//   - *Log: The open log
+//   - error: An error if the file cannot be opened
+func Open(path string, exclude []string) (*Log, error) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open request log: %w", err)
+	}
+	l := &Log{file: file}
+	for _, domain := range exclude {
+		l.exclude = append(l.exclude, strings.TrimSuffix(strings.ToLower(domain), "."))
+	}
+	return l, nil
+}
+
+// Record writes an entry unless its host is excluded. A nil log records
+// nothing.
+//
+// Parameters:
+//   - e: The request metadata; the query is removed from its path
+func (l *Log) Record(e Entry) {
+	if l == nil || l.excluded(e.Host) {
+		return
+	}
+	e.Path, _, _ = strings.Cut(e.Path, "?")
+	data, err := json.Marshal(e)
+	if err != nil {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, err := l.file.Write(append(data, '\n')); err != nil {
+		fmt.Printf("✗ Failed to write request log: %v\n", err)
+	}
+}
+
+// Close closes the log file.
+func (l *Log) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.file.Close()
+}
+
+// excluded reports whether a host or one of its parent domains is excluded.
+func (l *Log) excluded(host string) bool {
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	for _, domain := range l.exclude {
+		if host == domain || strings.HasSuffix(host, "."+domain) {
+			return true
+		}
+	}
+	return false
+}
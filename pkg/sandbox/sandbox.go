@@ -0,0 +1,27 @@
+// Package sandbox restricts what the tunnel process can do once it is running.
+//
+// On Linux, two kernel mechanisms are combined:
+//   - seccomp: system calls the tunnel never needs, above all running other
+//     programs, loading kernel modules, mounting and debugging other processes,
+//     fail with EPERM
+//   - Landlock (Linux 5.13+): the filesystem is limited to the paths of a
+//     Policy, so a compromised process cannot read keys or write files
+//     elsewhere
+//
+// Both restrictions are permanent and inherited by every thread. Landlock must
+// be applied to each thread separately, which Go supports only in binaries
+// built without cgo (CGO_ENABLED=0, as for release builds); otherwise the
+// filesystem stays unrestricted.
+package sandbox
+
+// Policy lists the paths the process may still access.
+type Policy struct {
+	Read  []string // Files and directories that may be read
+	Write []string // Directories where files may be created, written and removed
+}
+
+// Result describes the restrictions in effect after Apply.
+type Result struct {
+	Filesystem    bool  // Whether the filesystem is restricted
+	FilesystemErr error // Why the filesystem could not be restricted
+}
@@ -0,0 +1,47 @@
+//go:build linux
+
+package sandbox
+
+import (
+	"crypto/x509"
+	"fmt"
+	"runtime"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// Apply restricts the process. System calls are always filtered; the
+// filesystem is restricted when the kernel and the build support it, see
+// Result.
+//
+// Parameters:
+//   - policy: The paths the process may still access
+//
+// Returns:
+//   - Result: The restrictions in effect
+//   - error: An error if system calls could not be filtered
+func Apply(policy Policy) (Result, error) {
+	// Load what the standard library reads lazily from disk while it still can
+	x509.SystemCertPool()
+	_ = time.Local.String()
+
+	// The filter is installed on the locked thread and synchronized to the
+	// others, which inherit no_new_privs from it
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	if err := unix.Prctl(unix.PR_SET_NO_NEW_PRIVS, 1, 0, 0, 0); err != nil {
+		return Result{}, fmt.Errorf("failed to set no_new_privs: %w", err)
+	}
+	if err := installSeccomp(); err != nil {
+		return Result{}, err
+	}
+
+	var result Result
+	if err := restrictFilesystem(policy); err != nil {
+		result.FilesystemErr = err
+	} else {
+		result.Filesystem = true
+	}
+	return result, nil
+}
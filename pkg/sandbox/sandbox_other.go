@@ -0,0 +1,10 @@
+//go:build !linux
+
+package sandbox
+
+import "fmt"
+
+// Apply is not supported on this platform.
+func Apply(policy Policy) (Result, error) {
+	return Result{}, fmt.Errorf("sandboxing is only supported on Linux")
+}
@@ -0,0 +1,135 @@
+//go:build linux
+
+package sandbox
+
+import (
+	"fmt"
+	"runtime"
+	"unsafe"
+
+	"golang.org/x/net/bpf"
+	"golang.org/x/sys/unix"
+)
+
+// deniedSyscalls are the system calls that fail with EPERM in the sandbox.
+// Everything else stays allowed, as the Go runtime and the standard library
+// use many system calls that differ between releases and architectures.
+var deniedSyscalls = []uintptr{
+	// Running other programs
+	unix.SYS_EXECVE,
+	unix.SYS_EXECVEAT,
+	// Inspecting and modifying other processes
+	unix.SYS_PTRACE,
+	unix.SYS_PROCESS_VM_READV,
+	unix.SYS_PROCESS_VM_WRITEV,
+	// Changing the filesystem and namespaces
+	unix.SYS_MOUNT,
+	unix.SYS_UMOUNT2,
+	unix.SYS_PIVOT_ROOT,
+	unix.SYS_CHROOT,
+	unix.SYS_SETNS,
+	unix.SYS_UNSHARE,
+	// Changing the kernel
+	unix.SYS_INIT_MODULE,
+	unix.SYS_FINIT_MODULE,
+	unix.SYS_DELETE_MODULE,
+	unix.SYS_KEXEC_LOAD,
+	unix.SYS_BPF,
+	unix.SYS_REBOOT,
+	unix.SYS_SWAPON,
+	unix.SYS_SWAPOFF,
+	// Kernel keyrings
+	unix.SYS_ADD_KEY,
+	unix.SYS_REQUEST_KEY,
+	unix.SYS_KEYCTL,
+}
+
+// auditArch returns the seccomp architecture identifier of the running
+// binary, so system calls made through another ABI are not mistaken for ours.
+func auditArch() (uint32, bool) {
+	switch runtime.GOARCH {
+	case "amd64":
+		return unix.AUDIT_ARCH_X86_64, true
+	case "386":
+		return unix.AUDIT_ARCH_I386, true
+	case "arm64":
+		return unix.AUDIT_ARCH_AARCH64, true
+	case "arm":
+		return unix.AUDIT_ARCH_ARM, true
+	case "mips":
+		return unix.AUDIT_ARCH_MIPS, true
+	case "mipsle":
+		return unix.AUDIT_ARCH_MIPSEL, true
+	case "mips64":
+		return unix.AUDIT_ARCH_MIPS64, true
+	case "mips64le":
+		return unix.AUDIT_ARCH_MIPSEL64, true
+	case "ppc64":
+		return unix.AUDIT_ARCH_PPC64, true
+	case "ppc64le":
+		return unix.AUDIT_ARCH_PPC64LE, true
+	case "riscv64":
+		return unix.AUDIT_ARCH_RISCV64, true
+	case "s390x":
+		return unix.AUDIT_ARCH_S390X, true
+	case "loong64":
+		return unix.AUDIT_ARCH_LOONGARCH64, true
+	}
+	return 0, false
+}
+
+// seccompFilter builds the BPF program: the process is killed for system
+// calls of a foreign architecture, denied system calls return EPERM and all
+// others are allowed.
+func seccompFilter(arch uint32) ([]bpf.RawInstruction, error) {
+	const (
+		offsetNr   = 0 // seccomp_data.nr
+		offsetArch = 4 // seccomp_data.arch
+	)
+	deny := bpf.RetConstant{Val: unix.SECCOMP_RET_ERRNO | uint32(unix.EPERM)}
+	allow := bpf.RetConstant{Val: unix.SECCOMP_RET_ALLOW}
+
+	program := []bpf.Instruction{
+		bpf.LoadAbsolute{Off: offsetArch, Size: 4},
+		bpf.JumpIf{Cond: bpf.JumpEqual, Val: arch, SkipTrue: 1},
+		bpf.RetConstant{Val: unix.SECCOMP_RET_KILL_PROCESS},
+		bpf.LoadAbsolute{Off: offsetNr, Size: 4},
+	}
+	if runtime.GOARCH == "amd64" {
+		// x32 system calls share the architecture but have this bit set
+		program = append(program, bpf.JumpIf{Cond: bpf.JumpGreaterOrEqual, Val: 0x40000000, SkipFalse: 1}, deny)
+	}
+	for _, nr := range deniedSyscalls {
+		program = append(program, bpf.JumpIf{Cond: bpf.JumpEqual, Val: uint32(nr), SkipFalse: 1}, deny)
+	}
+	program = append(program, allow)
+	return bpf.Assemble(program)
+}
+
+// installSeccomp installs the system call filter on every thread of the
+// process. The calling thread must have no_new_privs set.
+func installSeccomp() error {
+	arch, ok := auditArch()
+	if !ok {
+		return fmt.Errorf("system call filtering is not supported on %s", runtime.GOARCH)
+	}
+	raw, err := seccompFilter(arch)
+	if err != nil {
+		return fmt.Errorf("failed to build system call filter: %w", err)
+	}
+	filter := make([]unix.SockFilter, len(raw))
+	for i, ins := range raw {
+		filter[i] = unix.SockFilter{Code: ins.Op, Jt: ins.Jt, Jf: ins.Jf, K: ins.K}
+	}
+	prog := unix.SockFprog{Len: uint16(len(filter)), Filter: &filter[0]}
+
+	tid, _, errno := unix.Syscall(unix.SYS_SECCOMP, unix.SECCOMP_SET_MODE_FILTER, unix.SECCOMP_FILTER_FLAG_TSYNC, uintptr(unsafe.Pointer(&prog)))
+	runtime.KeepAlive(filter)
+	if errno != 0 {
+		return fmt.Errorf("failed to install system call filter: %w", errno)
+	}
+	if tid != 0 {
+		return fmt.Errorf("failed to install system call filter: thread %d has a conflicting filter", tid)
+	}
+	return nil
+}
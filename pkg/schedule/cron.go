@@ -0,0 +1,235 @@
+// Package schedule implements cron expressions for time-based tunnel scheduling.
+//
+// Expressions use the standard five fields:
+//
+//	minute hour day-of-month month day-of-week
+//
+// Each field accepts "*", single values, ranges ("1-5"), lists ("1,15") and
+// steps ("*/10", "0-30/5"). Months and weekdays may also be written as names
+// ("jan", "mon"), and Sunday is 0 or 7. The macros @hourly, @daily (@midnight),
+// @weekly, @monthly and @yearly (@annually) are supported. As in classic cron,
+// when both day-of-month and day-of-week are restricted, a day matches if
+// either field matches.
+//
+// Times are evaluated in the local time zone.
+package schedule
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxSearch bounds how far Next looks ahead; expressions that never match
+// (such as February 30th) give up after this period.
+const maxSearch = 5 * 366 * 24 * time.Hour
+
+// Expression is a parsed cron expression.
+type Expression struct {
+	minute, hour, dom, month, dow uint64 // Bit sets of matching values
+	domAny, dowAny                bool   // Whether the day fields were "*"
+	source                        string // Original expression text
+}
+
+// field describes the valid range and names of a cron field.
+type field struct {
+	name     string
+	min, max int
+	names    map[string]int
+}
+
+var (
+	minuteField = field{name: "minute", min: 0, max: 59}
+	hourField   = field{name: "hour", min: 0, max: 23}
+	domField    = field{name: "day of month", min: 1, max: 31}
+	monthField  = field{name: "month", min: 1, max: 12, names: map[string]int{
+		"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+		"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12,
+	}}
+	dowField = field{name: "day of week", min: 0, max: 7, names: map[string]int{
+		"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6,
+	}}
+)
+
+// macros maps the supported @-shortcuts to their five-field form.
+var macros = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// Parse parses a cron expression.
+//
+// Parameters:
+//   - expr: A five-field cron expression or an @-macro
+//
+// Returns:
+//   - *Expression: The parsed expression
+//   - error: An error describing the first invalid field
+//
+// Example:
+//
+//	expr, err := schedule.Parse("0 1 * * mon-fri") // 01:00 on weekdays
+func Parse(expr string) (*Expression, error) {
+	text := strings.TrimSpace(expr)
+	if macro, ok := macros[strings.ToLower(text)]; ok {
+		text = macro
+	}
+
+	fields := strings.Fields(text)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("invalid cron expression %q: expected 5 fields, got %d", expr, len(fields))
+	}
+
+	e := &Expression{source: expr}
+	var err error
+	if e.minute, err = parseField(fields[0], minuteField); err != nil {
+		return nil, fmt.Errorf("invalid cron expression %q: %w", expr, err)
+	}
+	if e.hour, err = parseField(fields[1], hourField); err != nil {
+		return nil, fmt.Errorf("invalid cron expression %q: %w", expr, err)
+	}
+	if e.dom, err = parseField(fields[2], domField); err != nil {
+		return nil, fmt.Errorf("invalid cron expression %q: %w", expr, err)
+	}
+	if e.month, err = parseField(fields[3], monthField); err != nil {
+		return nil, fmt.Errorf("invalid cron expression %q: %w", expr, err)
+	}
+	if e.dow, err = parseField(fields[4], dowField); err != nil {
+		return nil, fmt.Errorf("invalid cron expression %q: %w", expr, err)
+	}
+
+	// Sunday may be written as 7
+	if e.dow&(1<<7) != 0 {
+		e.dow |= 1
+	}
+	e.domAny = fields[2] == "*"
+	e.dowAny = fields[4] == "*"
+	return e, nil
+}
+
+// String returns the expression as it was written.
+func (e *Expression) String() string {
+	return e.source
+}
+
+// Next returns the first time after t that matches the expression.
+//
+// Parameters:
+//   - t: The reference time; the result is strictly after it
+//
+// Returns:
+//   - time.Time: The next matching minute, or the zero time if none is found
+//     within five years
+func (e *Expression) Next(t time.Time) time.Time {
+	next := t.Truncate(time.Minute).Add(time.Minute)
+	limit := t.Add(maxSearch)
+
+	for next.Before(limit) {
+		if e.month&(1<<uint(next.Month())) == 0 {
+			next = time.Date(next.Year(), next.Month()+1, 1, 0, 0, 0, 0, next.Location())
+			continue
+		}
+		if !e.matchDay(next) {
+			next = time.Date(next.Year(), next.Month(), next.Day()+1, 0, 0, 0, 0, next.Location())
+			continue
+		}
+		if e.hour&(1<<uint(next.Hour())) == 0 {
+			next = time.Date(next.Year(), next.Month(), next.Day(), next.Hour()+1, 0, 0, 0, next.Location())
+			continue
+		}
+		if e.minute&(1<<uint(next.Minute())) == 0 {
+			next = next.Add(time.Minute)
+			continue
+		}
+		return next
+	}
+	return time.Time{}
+}
+
+// matchDay reports whether the day of t matches the day-of-month and
+// day-of-week fields, using the classic cron OR rule when both are restricted.
+func (e *Expression) matchDay(t time.Time) bool {
+	domMatch := e.dom&(1<<uint(t.Day())) != 0
+	dowMatch := e.dow&(1<<uint(t.Weekday())) != 0
+
+	switch {
+	case e.domAny && e.dowAny:
+		return true
+	case e.domAny:
+		return dowMatch
+	case e.dowAny:
+		return domMatch
+	default:
+		return domMatch || dowMatch
+	}
+}
+
+// parseField parses one comma-separated cron field into a bit set.
+func parseField(text string, f field) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(text, ",") {
+		rangeText, stepText, hasStep := strings.Cut(part, "/")
+
+		step := 1
+		if hasStep {
+			var err error
+			step, err = strconv.Atoi(stepText)
+			if err != nil || step <= 0 {
+				return 0, fmt.Errorf("invalid step %q in %s field", stepText, f.name)
+			}
+		}
+
+		var lo, hi int
+		switch {
+		case rangeText == "*":
+			lo, hi = f.min, f.max
+		case strings.Contains(rangeText, "-"):
+			loText, hiText, _ := strings.Cut(rangeText, "-")
+			var err error
+			if lo, err = f.value(loText); err != nil {
+				return 0, err
+			}
+			if hi, err = f.value(hiText); err != nil {
+				return 0, err
+			}
+			if lo > hi {
+				return 0, fmt.Errorf("invalid range %q in %s field", rangeText, f.name)
+			}
+		default:
+			v, err := f.value(rangeText)
+			if err != nil {
+				return 0, err
+			}
+			lo, hi = v, v
+			if hasStep {
+				hi = f.max
+			}
+		}
+
+		for v := lo; v <= hi; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+	return bits, nil
+}
+
+// value parses a single number or name and checks it against the field range.
+func (f field) value(text string) (int, error) {
+	if v, ok := f.names[strings.ToLower(text)]; ok {
+		return v, nil
+	}
+	v, err := strconv.Atoi(text)
+	if err != nil {
+		return 0, fmt.Errorf("invalid value %q in %s field", text, f.name)
+	}
+	if v < f.min || v > f.max {
+		return 0, fmt.Errorf("%s value %d out of range %d-%d", f.name, v, f.min, f.max)
+	}
+	return v, nil
+}
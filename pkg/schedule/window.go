@@ -0,0 +1,83 @@
+package schedule
+
+import (
+	"fmt"
+	"time"
+)
+
+// Window is a recurring period between a start and a stop expression, such as
+// a nightly unlimited-data window offered by an ISP.
+type Window struct {
+	Start *Expression // When the window opens
+	Stop  *Expression // When the window closes
+}
+
+// NewWindow parses the start and stop expressions of a window.
+//
+// Parameters:
+//   - start: Cron expression for when the window opens
+//   - stop: Cron expression for when the window closes
+//
+// Returns:
+//   - *Window: The parsed window
+//   - error: An error if either expression is invalid
+func NewWindow(start, stop string) (*Window, error) {
+	startExpr, err := Parse(start)
+	if err != nil {
+		return nil, fmt.Errorf("start: %w", err)
+	}
+	stopExpr, err := Parse(stop)
+	if err != nil {
+		return nil, fmt.Errorf("stop: %w", err)
+	}
+	return &Window{Start: startExpr, Stop: stopExpr}, nil
+}
+
+// Active reports whether the window is open at t.
+//
+// The window is open when the next stop comes before the next start, that is,
+// when the most recent event was a start.
+//
+// Parameters:
+//   - t: The time to check
+//
+// Returns:
+//   - bool: True if the window is open
+//   - time.Time: When the window next changes state (zero if never)
+func (w *Window) Active(t time.Time) (bool, time.Time) {
+	nextStart := w.Start.Next(t)
+	nextStop := w.Stop.Next(t)
+
+	switch {
+	case nextStop.IsZero():
+		return false, nextStart
+	case nextStart.IsZero():
+		return true, nextStop
+	case nextStop.Before(nextStart):
+		return true, nextStop
+	default:
+		return false, nextStart
+	}
+}
+
+// Evaluate combines several windows: the schedule is active while any window is open.
+//
+// Parameters:
+//   - windows: The windows to combine
+//   - t: The time to check
+//
+// Returns:
+//   - bool: True if at least one window is open
+//   - time.Time: The earliest time any window changes state (zero if never)
+func Evaluate(windows []*Window, t time.Time) (bool, time.Time) {
+	active := false
+	var change time.Time
+	for _, w := range windows {
+		open, next := w.Active(t)
+		active = active || open
+		if !next.IsZero() && (change.IsZero() || next.Before(change)) {
+			change = next
+		}
+	}
+	return active, change
+}
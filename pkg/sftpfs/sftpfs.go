@@ -0,0 +1,220 @@
+// Package sftpfs exposes a directory on the SSH server as a local read-only
+// HTTP and WebDAV endpoint.
+//
+// Files are read over SFTP through the tunnel's SSH connection, so no extra
+// software is needed on either side. Plain GET requests are served like a
+// static file server, with directory listings and range requests, and WebDAV
+// clients can browse the tree with PROPFIND. Every method that would modify
+// the remote directory is rejected.
+package sftpfs
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/net/webdav"
+)
+
+// FS is a read-only webdav.FileSystem backed by a directory on an SFTP server.
+//
+// Names are resolved below the root and cannot climb out of it with "..";
+// symbolic links on the server are followed as the server resolves them.
+type FS struct {
+	client *sftp.Client // SFTP session used for all file access
+	root   string       // Absolute remote directory served as "/"
+}
+
+// New creates a file system serving a remote directory.
+//
+// Parameters:
+//   - client: An open SFTP client
+//   - root: The remote directory to serve
+//
+// Returns:
+//   - *FS: The file system
+//   - error: An error if root does not exist or is not a directory
+func New(client *sftp.Client, root string) (*FS, error) {
+	if !path.IsAbs(root) {
+		cwd, err := client.Getwd()
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve %s: %w", root, err)
+		}
+		root = path.Join(cwd, root)
+	}
+
+	info, err := client.Stat(root)
+	if err != nil {
+		return nil, fmt.Errorf("failed to access remote directory %s: %w", root, err)
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("remote path %s is not a directory", root)
+	}
+	return &FS{client: client, root: path.Clean(root)}, nil
+}
+
+// resolve maps a request name to its remote path below the root.
+func (f *FS) resolve(name string) string {
+	return path.Join(f.root, path.Clean("/"+name))
+}
+
+// Mkdir implements webdav.FileSystem; the file system is read-only.
+func (f *FS) Mkdir(ctx context.Context, name string, perm os.FileMode) error {
+	return os.ErrPermission
+}
+
+// RemoveAll implements webdav.FileSystem; the file system is read-only.
+func (f *FS) RemoveAll(ctx context.Context, name string) error {
+	return os.ErrPermission
+}
+
+// Rename implements webdav.FileSystem; the file system is read-only.
+func (f *FS) Rename(ctx context.Context, oldName, newName string) error {
+	return os.ErrPermission
+}
+
+// Stat implements webdav.FileSystem.
+func (f *FS) Stat(ctx context.Context, name string) (os.FileInfo, error) {
+	return f.client.Stat(f.resolve(name))
+}
+
+// OpenFile implements webdav.FileSystem. Only read-only opens are allowed.
+func (f *FS) OpenFile(ctx context.Context, name string, flag int, perm os.FileMode) (webdav.File, error) {
+	if flag&(os.O_WRONLY|os.O_RDWR|os.O_CREATE|os.O_TRUNC|os.O_APPEND) != 0 {
+		return nil, os.ErrPermission
+	}
+
+	remotePath := f.resolve(name)
+	info, err := f.client.Stat(remotePath)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		return &dir{client: f.client, path: remotePath, info: info}, nil
+	}
+
+	file, err := f.client.Open(remotePath)
+	if err != nil {
+		return nil, err
+	}
+	return &readOnlyFile{File: file}, nil
+}
+
+// Open implements http.FileSystem so the same tree can be served by
+// http.FileServer.
+func (f *FS) Open(name string) (http.File, error) {
+	return f.OpenFile(context.Background(), name, os.O_RDONLY, 0)
+}
+
+// readOnlyFile is a remote regular file.
+type readOnlyFile struct {
+	*sftp.File
+}
+
+// Readdir implements http.File; regular files have no entries.
+func (r *readOnlyFile) Readdir(count int) ([]os.FileInfo, error) {
+	return nil, fmt.Errorf("%s is not a directory", r.Name())
+}
+
+// Write implements webdav.File; the file system is read-only.
+func (r *readOnlyFile) Write(p []byte) (int, error) {
+	return 0, os.ErrPermission
+}
+
+// dir is a remote directory. Its entries are listed on the first Readdir.
+type dir struct {
+	client  *sftp.Client
+	path    string
+	info    os.FileInfo
+	entries []os.FileInfo // Entries not yet returned, nil until listed
+	listed  bool
+}
+
+// Readdir implements http.File.
+func (d *dir) Readdir(count int) ([]os.FileInfo, error) {
+	if !d.listed {
+		entries, err := d.client.ReadDir(d.path)
+		if err != nil {
+			return nil, err
+		}
+		d.entries, d.listed = entries, true
+	}
+
+	if count <= 0 {
+		entries := d.entries
+		d.entries = nil
+		return entries, nil
+	}
+	if len(d.entries) == 0 {
+		return nil, io.EOF
+	}
+	n := min(count, len(d.entries))
+	entries := d.entries[:n]
+	d.entries = d.entries[n:]
+	return entries, nil
+}
+
+// Stat implements http.File.
+func (d *dir) Stat() (os.FileInfo, error) {
+	return d.info, nil
+}
+
+// Read implements http.File; directories have no content.
+func (d *dir) Read(p []byte) (int, error) {
+	return 0, fmt.Errorf("%s is a directory", d.path)
+}
+
+// Seek implements http.File; directories have no content.
+func (d *dir) Seek(offset int64, whence int) (int64, error) {
+	return 0, fmt.Errorf("%s is a directory", d.path)
+}
+
+// Write implements webdav.File; the file system is read-only.
+func (d *dir) Write(p []byte) (int, error) {
+	return 0, os.ErrPermission
+}
+
+// Close implements http.File.
+func (d *dir) Close() error {
+	return nil
+}
+
+// NewHandler returns an HTTP handler serving the file system read-only.
+//
+// GET and HEAD are answered by a static file server with directory listings;
+// OPTIONS, PROPFIND, LOCK and UNLOCK are answered by a WebDAV handler so the
+// endpoint can be mounted by WebDAV clients. All other methods are rejected
+// with 405 Method Not Allowed.
+//
+// Parameters:
+//   - fs: The file system to serve
+//   - logf: Called with each request's method and path (may be nil)
+//
+// Returns:
+//   - http.Handler: The handler
+func NewHandler(fs *FS, logf func(method, path string)) http.Handler {
+	files := http.FileServer(fs)
+	dav := &webdav.Handler{
+		FileSystem: fs,
+		LockSystem: webdav.NewMemLS(),
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if logf != nil {
+			logf(r.Method, r.URL.Path)
+		}
+		switch r.Method {
+		case http.MethodGet, http.MethodHead:
+			files.ServeHTTP(w, r)
+		case http.MethodOptions, "PROPFIND", "LOCK", "UNLOCK":
+			dav.ServeHTTP(w, r)
+		default:
+			w.Header().Set("Allow", "OPTIONS, GET, HEAD, PROPFIND, LOCK, UNLOCK")
+			http.Error(w, "read-only endpoint", http.StatusMethodNotAllowed)
+		}
+	})
+}
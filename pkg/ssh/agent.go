@@ -0,0 +1,118 @@
+package ssh
+
+import (
+	"fmt"
+	"net"
+	"os"
+
+	"tunn/pkg/progress"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+// UseAgent authenticates with the keys held by the running ssh-agent, found
+// through the SSH_AUTH_SOCK environment variable, before the password. It
+// must be called before StartTransport.
+//
+// The agent signs the authentication challenge itself, so private keys never
+// have to be stored in the configuration. If the agent is unreachable, holds
+// no keys or none of them is accepted, the password is tried as usual.
+func (s *SSHClient) UseAgent() {
+	s.agent = true
+}
+
+// UsePrivateKey authenticates with a private key, after the keys of the
+// agent and before the password. It must be called before StartTransport.
+//
+// Parameters:
+//   - pemBytes: The unencrypted private key in PEM or OpenSSH format
+//
+// Returns:
+//   - error: An error if the key cannot be parsed
+func (s *SSHClient) UsePrivateKey(pemBytes []byte) error {
+	signer, err := ParsePrivateKey(pemBytes)
+	if err != nil {
+		return err
+	}
+	s.key = signer
+	return nil
+}
+
+// ParsePrivateKey parses an unencrypted private key.
+//
+// Parameters:
+//   - pemBytes: The private key in PEM or OpenSSH format
+//
+// Returns:
+//   - ssh.Signer: The signer for the key
+//   - error: An error if the key cannot be parsed or is protected by a passphrase
+func ParsePrivateKey(pemBytes []byte) (ssh.Signer, error) {
+	signer, err := ssh.ParsePrivateKey(pemBytes)
+	if _, ok := err.(*ssh.PassphraseMissingError); ok {
+		return nil, fmt.Errorf("the private key is protected by a passphrase, load it into ssh-agent and use ssh.agent instead")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid private key: %w", err)
+	}
+	return signer, nil
+}
+
+// authMethods returns the authentication methods offered to the server in
+// order: the agent's keys when enabled, the private key if one is set, the
+// password if one is set, then keyboard-interactive when enabled.
+//
+// Returns:
+//   - []ssh.AuthMethod: The methods to offer
+//   - func(): Releases the agent connection once the handshake is over
+func (s *SSHClient) authMethods() ([]ssh.AuthMethod, func()) {
+	var methods []ssh.AuthMethod
+	release := func() {}
+
+	if s.agent {
+		if conn, signers, err := agentSigners(); err != nil {
+			fmt.Printf("✗ ssh-agent unavailable, skipping key authentication: %v\n", err)
+		} else if len(signers) == 0 {
+			conn.Close()
+			fmt.Println("✗ ssh-agent holds no keys, skipping key authentication")
+		} else {
+			progress.Printf("→ Offering %d key(s) from ssh-agent\n", len(signers))
+			methods = append(methods, ssh.PublicKeys(signers...))
+			release = func() { conn.Close() }
+		}
+	}
+
+	if s.key != nil {
+		methods = append(methods, ssh.PublicKeys(s.key))
+	}
+	if s.password != "" {
+		methods = append(methods, ssh.Password(s.password))
+	}
+	if s.kbdInt {
+		methods = append(methods, ssh.KeyboardInteractive(s.challenge()))
+	}
+	return methods, release
+}
+
+// agentSigners connects to the ssh-agent at SSH_AUTH_SOCK and lists its keys.
+//
+// Returns:
+//   - net.Conn: The agent connection, which must stay open while signing
+//   - []ssh.Signer: Signers for the keys held by the agent
+//   - error: An error if SSH_AUTH_SOCK is unset or the agent cannot be queried
+func agentSigners() (net.Conn, []ssh.Signer, error) {
+	socket := os.Getenv("SSH_AUTH_SOCK")
+	if socket == "" {
+		return nil, nil, fmt.Errorf("SSH_AUTH_SOCK is not set")
+	}
+	conn, err := net.Dial("unix", socket)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to connect to %s: %w", socket, err)
+	}
+	signers, err := agent.NewClient(conn).Signers()
+	if err != nil {
+		conn.Close()
+		return nil, nil, fmt.Errorf("failed to list keys: %w", err)
+	}
+	return conn, signers, nil
+}
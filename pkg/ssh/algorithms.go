@@ -0,0 +1,44 @@
+package ssh
+
+// Ciphers lists the SSH ciphers that can be configured, fastest first on CPUs
+// with AES instructions.
+var Ciphers = []string{
+	"aes128-gcm@openssh.com",
+	"aes256-gcm@openssh.com",
+	"chacha20-poly1305@openssh.com",
+	"aes128-ctr",
+	"aes192-ctr",
+	"aes256-ctr",
+}
+
+// MACs lists the SSH MAC algorithms that can be configured. MACs are only used
+// with the CTR ciphers; the GCM and ChaCha20-Poly1305 ciphers authenticate
+// data themselves.
+var MACs = []string{
+	"hmac-sha2-256-etm@openssh.com",
+	"hmac-sha2-512-etm@openssh.com",
+	"hmac-sha2-256",
+	"hmac-sha2-512",
+	"hmac-sha1",
+}
+
+// IsAEAD reports whether a cipher authenticates data itself, making the MAC
+// setting irrelevant.
+func IsAEAD(cipher string) bool {
+	switch cipher {
+	case "aes128-gcm@openssh.com", "aes256-gcm@openssh.com", "chacha20-poly1305@openssh.com":
+		return true
+	}
+	return false
+}
+
+// SetAlgorithms restricts the ciphers and MACs offered during the handshake.
+// It must be called before StartTransport; empty lists keep the defaults.
+//
+// Parameters:
+//   - ciphers: Ciphers in order of preference
+//   - macs: MAC algorithms in order of preference
+func (s *SSHClient) SetAlgorithms(ciphers, macs []string) {
+	s.ciphers = ciphers
+	s.macs = macs
+}
@@ -7,6 +7,8 @@
 //
 // The package supports:
 //   - Password authentication
+//   - Public key authentication with the keys of a running ssh-agent
+//   - Keyboard-interactive authentication (OTP codes and challenge prompts)
 //   - SSH over custom network connections (including WebSocket)
 //   - TCP keepalive for connection stability
 //   - Banner message handling and HTML stripping
@@ -23,10 +25,18 @@ import (
 	"strings"
 	"time"
 
+	"tunn/pkg/progress"
+	"tunn/pkg/redact"
+
+	"github.com/pkg/sftp"
 	"golang.org/x/crypto/ssh"
 	"golang.org/x/net/html"
 )
 
+// handshakeTimeout bounds the SSH handshake, not counting time spent waiting
+// for the user to answer prompts.
+const handshakeTimeout = 15 * time.Second
+
 // Client defines the interface for SSH client operations required by tunnel components.
 //
 // This interface abstracts SSH client functionality to allow different implementations
@@ -47,10 +57,22 @@ type Client interface {
 // transport layers including direct TCP, TLS, and WebSocket connections.
 // It handles SSH authentication, keepalive, and connection management.
 type SSHClient struct {
-	conn      net.Conn    // The underlying network connection
-	sshClient *ssh.Client // The SSH client instance
-	username  string      // SSH username for authentication
-	password  string      // SSH password for authentication
+	conn      net.Conn            // The underlying network connection
+	activity  *activityConn       // Activity-tracking wrapper around conn used by the watchdog
+	limiter   *channelLimiter     // Channel-open concurrency cap (nil for unlimited)
+	gate      *destinationGate    // Per-destination open collapsing (nil when disabled)
+	queueWait time.Duration       // Maximum time a channel open waits for a slot
+	sshClient *ssh.Client         // The SSH client instance
+	ciphers   []string            // Ciphers offered in the handshake (nil for defaults)
+	macs      []string            // MAC algorithms offered in the handshake (nil for defaults)
+	username  string              // SSH username for authentication
+	password  string              // SSH password for authentication (empty to skip)
+	agent     bool                // Whether the keys of the running ssh-agent are offered first
+	key       ssh.Signer          // Private key offered after the agent's keys (nil to skip)
+	kbdInt    bool                // Whether keyboard-interactive authentication is offered
+	answers   []string            // Scripted keyboard-interactive answers, used before asking on the terminal
+	hostKey   ssh.HostKeyCallback // Verifies the server's host key
+	hostAlgos []string            // Host key algorithms to negotiate (nil for defaults)
 }
 
 // NewSSHClient creates a new SSH client instance over the provided network connection.
@@ -116,19 +138,19 @@ func stripHTMLTags(htmlStr string) string {
 // The method performs several important operations:
 //  1. Configures TCP keepalive if the underlying connection supports it
 //  2. Sets handshake timeout to prevent hanging connections
-//  3. Configures SSH client with password authentication and security settings
+//  3. Configures SSH client with agent, key and password authentication and security settings
 //  4. Handles server banners with HTML tag stripping
 //  5. Establishes the SSH client connection with proper error handling
 //
 // Security considerations:
-//   - Uses InsecureIgnoreHostKey for host key verification (suitable for tunneling)
+//   - Verifies the server's host key with the callback set by SetHostKey
 //   - Implements connection timeouts to prevent resource exhaustion
 //   - Handles authentication failures with descriptive error messages
 //
 // Returns:
 //   - error: An error if SSH transport initialization fails
 func (s *SSHClient) StartTransport() error {
-	fmt.Println("→ Starting SSH transport over connection...")
+	progress.Println("→ Starting SSH transport over connection...")
 
 	// Set keepalive on the underlying connection if it's TCP
 	if tcpConn, ok := s.conn.(*net.TCPConn); ok {
@@ -137,31 +159,51 @@ func (s *SSHClient) StartTransport() error {
 	}
 
 	// Set a deadline for the SSH handshake to avoid hanging
-	handshakeTimeout := 15 * time.Second
 	s.conn.SetDeadline(time.Now().Add(handshakeTimeout))
 
+	if s.hostKey == nil {
+		return fmt.Errorf("no host key verification configured")
+	}
+
+	auth, releaseAgent := s.authMethods()
+	defer releaseAgent()
+
 	config := &ssh.ClientConfig{
 		User: s.username,
-		Auth: []ssh.AuthMethod{
-			ssh.Password(s.password),
+		Auth: auth,
+		HostKeyCallback: func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+			// Verifying may wait for an answer on the terminal
+			defer s.pauseDeadline()()
+			return s.hostKey(hostname, remote, key)
 		},
-		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
-		Timeout:         handshakeTimeout,
+		HostKeyAlgorithms: s.hostAlgos,
+		Timeout:           handshakeTimeout,
 		BannerCallback: func(message string) error {
-			plain := stripHTMLTags(message)
-			fmt.Fprintln(os.Stderr, plain)
+			// Parse the banner off the handshake path
+			go func() {
+				fmt.Fprintln(os.Stderr, stripHTMLTags(message))
+			}()
 			return nil
 		},
 	}
 
-	fmt.Printf("→ Attempting SSH connection with user: %s\n", s.username)
+	config.Ciphers = s.ciphers
+	config.MACs = s.macs
+
+	progress.Printf("→ Attempting SSH connection with user: %s\n", redact.Username(s.username))
 
 	// Create SSH client using the connection
-	sshConn, chans, reqs, err := ssh.NewClientConn(s.conn, "tcp", config)
+	start := time.Now()
+	s.activity = newActivityConn(s.conn)
+	sshConn, chans, reqs, err := ssh.NewClientConn(s.activity, "tcp", config)
+	progress.Step(progress.Auth, "user "+redact.Username(s.username), start, err)
 	if err != nil {
 		if nErr, ok := err.(net.Error); ok && nErr.Timeout() {
 			return fmt.Errorf("SSH handshake timed out after %v", handshakeTimeout)
 		}
+		if disconnect, ok := disconnectError(err).(*DisconnectError); ok {
+			return disconnect
+		}
 		return fmt.Errorf("failed to create SSH connection: %v", err)
 	}
 
@@ -169,10 +211,28 @@ func (s *SSHClient) StartTransport() error {
 	s.conn.SetDeadline(time.Time{})
 
 	s.sshClient = ssh.NewClient(sshConn, chans, reqs)
-	fmt.Println("✓ SSH transport established and authenticated.")
+	progress.Println("✓ SSH transport established and authenticated.")
 	return nil
 }
 
+// pauseDeadline lifts the handshake deadline while waiting for the user, and
+// returns the function setting it again.
+func (s *SSHClient) pauseDeadline() func() {
+	s.conn.SetDeadline(time.Time{})
+	return func() { s.conn.SetDeadline(time.Now().Add(handshakeTimeout)) }
+}
+
+// SetHostKey sets how the server's host key is verified. It must be called
+// before StartTransport, which refuses to connect without verification.
+//
+// Parameters:
+//   - callback: Accepts or rejects the server's key
+//   - algorithms: Host key algorithms to negotiate, or nil for the defaults
+func (s *SSHClient) SetHostKey(callback ssh.HostKeyCallback, algorithms []string) {
+	s.hostKey = callback
+	s.hostAlgos = algorithms
+}
+
 // Dial establishes a new connection through the SSH tunnel to the specified destination.
 //
 // This method creates a new SSH channel to the target address, enabling tunneled
@@ -199,9 +259,137 @@ func (s *SSHClient) StartTransport() error {
 //	}
 //	defer conn.Close()
 func (s *SSHClient) Dial(network, address string) (net.Conn, error) {
+	if s.gate != nil {
+		return s.gate.dial(address, s.queueWait, func() (net.Conn, error) {
+			return s.dial(network, address)
+		})
+	}
+	return s.dial(network, address)
+}
+
+// dial opens a channel once a slot under the channel limit is free.
+func (s *SSHClient) dial(network, address string) (net.Conn, error) {
+	if s.limiter != nil {
+		if err := s.limiter.acquire(s.queueWait); err != nil {
+			return nil, err
+		}
+		defer s.limiter.release()
+	}
 	return s.sshClient.Dial(network, address)
 }
 
+// SetChannelLimit caps the number of channel-open requests in flight at once.
+//
+// Bursts of client connections (for example a browser loading a page) would
+// otherwise send dozens of simultaneous channel opens, which some servers
+// throttle or drop. Opens beyond the limit are queued and admitted in arrival
+// order. It must be called before the client is used for dialing.
+//
+// Parameters:
+//   - limit: Maximum concurrent channel opens; 0 or less disables the cap
+//   - queueTimeout: Maximum time an open waits in the queue before failing
+func (s *SSHClient) SetChannelLimit(limit int, queueTimeout time.Duration) {
+	if limit <= 0 {
+		s.limiter = nil
+		return
+	}
+	s.limiter = newChannelLimiter(limit)
+	s.queueWait = queueTimeout
+}
+
+// SetDestinationLimit collapses simultaneous channel opens to the same
+// destination, protecting weak servers from connection storms of misbehaving
+// applications. Opens beyond the limit wait for one to finish, and a failed
+// open is not repeated for the failure window: further connections to the
+// destination get its error. It must be called before the client is used for
+// dialing.
+//
+// Parameters:
+//   - limit: Maximum concurrent opens per destination; 0 or less for unlimited
+//   - failureWindow: How long a failure is returned instead of opening again
+//   - queueTimeout: Maximum time an open waits for a slot
+func (s *SSHClient) SetDestinationLimit(limit int, failureWindow, queueTimeout time.Duration) {
+	if limit <= 0 && failureWindow <= 0 {
+		s.gate = nil
+		return
+	}
+	s.gate = newDestinationGate(max(limit, 0), failureWindow)
+	s.queueWait = queueTimeout
+}
+
+// Listen asks the server to listen on an address and forward the connections
+// it accepts back through the tunnel, like an SSH remote forward ("ssh -R").
+//
+// Servers typically only bind non-loopback addresses when configured to allow
+// it (GatewayPorts in OpenSSH). The listener is closed with the transport.
+//
+// Parameters:
+//   - network: Network type, "tcp"
+//   - address: Server-side address in "host:port" format
+//
+// Returns:
+//   - net.Listener: A listener accepting connections made to the server
+//   - error: An error if the transport is not started or the server refuses to listen
+func (s *SSHClient) Listen(network, address string) (net.Listener, error) {
+	if s.sshClient == nil {
+		return nil, fmt.Errorf("SSH transport not started")
+	}
+	return s.sshClient.Listen(network, address)
+}
+
+// NewSession opens an SSH session channel for running a command on the server.
+//
+// Sessions are only used by diagnostics such as the bandwidth probe; regular
+// tunneled traffic uses Dial.
+//
+// Returns:
+//   - *ssh.Session: A new session ready to run a single command
+//   - error: An error if the transport is not started or the server refuses the session
+func (s *SSHClient) NewSession() (*ssh.Session, error) {
+	if s.sshClient == nil {
+		return nil, fmt.Errorf("SSH transport not started")
+	}
+	return s.sshClient.NewSession()
+}
+
+// NewSFTP starts an SFTP session on the server for reading remote files.
+//
+// Returns:
+//   - *sftp.Client: A new SFTP client; close it when done
+//   - error: An error if the transport is not started or the server has no SFTP subsystem
+func (s *SSHClient) NewSFTP() (*sftp.Client, error) {
+	if s.sshClient == nil {
+		return nil, fmt.Errorf("SSH transport not started")
+	}
+	return sftp.NewClient(s.sshClient)
+}
+
+// Wait blocks until the SSH connection has shut down and returns the error
+// that caused it to close.
+//
+// It is used to detect lost transports so they can be re-established.
+//
+// Returns:
+//   - error: The reason the connection was closed, a *DisconnectError when
+//     the server sent a disconnect message
+func (s *SSHClient) Wait() error {
+	if s.sshClient == nil {
+		return fmt.Errorf("SSH transport not started")
+	}
+	return disconnectError(s.sshClient.Wait())
+}
+
+// TransportConn returns the network connection the SSH transport runs over.
+//
+// It is used for diagnostics such as reading socket statistics and must not be
+// read from or written to directly.
+//
+// Returns:
+//   - net.Conn: The underlying transport connection
+func (s *SSHClient) TransportConn() net.Conn {
+	return s.conn
+}
+
 // Close closes the SSH client connection and releases all associated resources.
 //
 // This method properly terminates the SSH client connection, ensuring all
@@ -0,0 +1,131 @@
+package ssh
+
+import (
+	"fmt"
+	"net"
+	"sync"
+	"time"
+)
+
+// destinationGate collapses simultaneous channel opens to the same destination.
+//
+// Misbehaving applications sometimes open dozens of identical connections at
+// once, and retry them all when the destination is unreachable. A byte stream
+// cannot be shared between clients, so each connection still gets its own
+// channel, but at most limit opens to a destination are in flight at a time
+// and a failed open is not repeated: its error is returned to the opens
+// waiting for the same destination and to new ones for the failure window.
+//
+// Destinations are reference counted by the opens using them and forgotten
+// once none does and no failure is remembered.
+type destinationGate struct {
+	mu     sync.Mutex
+	limit  int                     // Maximum concurrent opens per destination (0 for unlimited)
+	window time.Duration           // How long a failure is returned instead of opening again
+	dests  map[string]*destination // Destinations in use or with a remembered failure
+}
+
+// destination is the state of one destination address.
+type destination struct {
+	refs     int           // Opens in flight or waiting for a slot
+	slots    chan struct{} // Semaphore of opens in flight (nil for unlimited)
+	err      error         // Error of the last failed open, or nil
+	failedAt time.Time     // When err was recorded
+}
+
+// newDestinationGate creates a gate; see SSHClient.SetDestinationLimit.
+func newDestinationGate(limit int, window time.Duration) *destinationGate {
+	return &destinationGate{limit: limit, window: window, dests: make(map[string]*destination)}
+}
+
+// dial opens a channel to an address with open, unless the destination failed
+// recently or no slot becomes free in time.
+//
+// Parameters:
+//   - address: The destination in "host:port" format
+//   - timeout: Maximum time to wait for a slot
+//   - open: Opens the channel
+//
+// Returns:
+//   - net.Conn: The channel returned by open
+//   - error: The recent failure, ErrChannelQueueTimeout or the error of open
+func (g *destinationGate) dial(address string, timeout time.Duration, open func() (net.Conn, error)) (net.Conn, error) {
+	g.mu.Lock()
+	d := g.dests[address]
+	if d == nil {
+		d = &destination{}
+		if g.limit > 0 {
+			d.slots = make(chan struct{}, g.limit)
+		}
+		g.dests[address] = d
+	}
+	if err := g.recentFailure(d); err != nil {
+		g.mu.Unlock()
+		return nil, err
+	}
+	d.refs++
+	g.mu.Unlock()
+	defer g.release(address, d)
+
+	if d.slots != nil {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		select {
+		case d.slots <- struct{}{}:
+			defer func() { <-d.slots }()
+		case <-timer.C:
+			return nil, ErrChannelQueueTimeout
+		}
+
+		// The open ahead of this one may have failed in the meantime
+		g.mu.Lock()
+		err := g.recentFailure(d)
+		g.mu.Unlock()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	conn, err := open()
+	g.mu.Lock()
+	if err != nil {
+		d.err, d.failedAt = err, time.Now()
+	} else {
+		d.err = nil
+	}
+	g.mu.Unlock()
+	return conn, err
+}
+
+// recentFailure returns the failure of a destination if it is within the
+// failure window. The caller must hold g.mu.
+func (g *destinationGate) recentFailure(d *destination) error {
+	if d.err == nil || time.Since(d.failedAt) >= g.window {
+		return nil
+	}
+	return fmt.Errorf("%w (recent failure, not retried for %s)", d.err, g.window)
+}
+
+// release drops a reference to a destination, forgetting it when unused, or
+// once its failure expires.
+func (g *destinationGate) release(address string, d *destination) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	d.refs--
+	if d.refs > 0 {
+		return
+	}
+	remaining := g.window - time.Since(d.failedAt)
+	if d.err == nil || remaining <= 0 {
+		delete(g.dests, address)
+		return
+	}
+	time.AfterFunc(remaining, func() {
+		g.mu.Lock()
+		defer g.mu.Unlock()
+		if d.refs == 0 && g.dests[address] == d {
+			delete(g.dests, address)
+		}
+	})
+}
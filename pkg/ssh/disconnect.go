@@ -0,0 +1,107 @@
+package ssh
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Ways a server rejects an account, told apart by its disconnect message.
+const (
+	RejectedTooManyLogins = "too many logins" // The account is logged in too often already
+	RejectedExpired       = "account expired" // The account or its subscription has run out
+	RejectedBanned        = "banned"          // The account or this client is banned or blocked
+)
+
+// disconnectTooManyConnections is the SSH disconnect reason sent by servers
+// limiting connections (RFC 4253, section 11.1).
+const disconnectTooManyConnections = 12
+
+// disconnectPattern matches the error the SSH library returns for a
+// disconnect message, whose type it does not export.
+var disconnectPattern = regexp.MustCompile(`(?s)ssh: disconnect, reason (\d+): (.*)`)
+
+// rejectionKeywords tells rejections apart by words in the disconnect
+// message, checked in order, as servers and account panels word them.
+var rejectionKeywords = []struct {
+	kind  string
+	words []string
+}{
+	{RejectedTooManyLogins, []string{"too many login", "too many session", "too many connection", "max login", "maximum login",
+		"maxlogins", "login limit", "session limit", "connection limit", "already logged in", "simultaneous", "multi login"}},
+	{RejectedExpired, []string{"expired", "expiry", "subscription"}},
+	{RejectedBanned, []string{"banned", "blocked", "blacklist", "suspended", "disabled"}},
+}
+
+// DisconnectError is a disconnect message sent by the SSH server, during the
+// handshake or once the transport is established.
+//
+// Servers sharing accounts commonly disconnect with a message telling why,
+// such as "Max login exceeded" or "Account expired". Kind classifies those
+// rejections of the account, so they can be reported plainly and reconnecting
+// can back off instead of hammering a server that is banning the client.
+type DisconnectError struct {
+	Reason  uint32 // Disconnect reason code (RFC 4253, section 11.1)
+	Message string // Description sent by the server
+	Kind    string // One of the Rejected* kinds, or empty for other disconnects
+}
+
+// Error describes the disconnect, naming the rejection if it is one.
+func (e *DisconnectError) Error() string {
+	if e.Kind != "" {
+		return fmt.Sprintf("server rejected the account (%s): %s", e.Kind, e.Message)
+	}
+	return fmt.Sprintf("server disconnected: %s (reason %d)", e.Message, e.Reason)
+}
+
+// Rejected reports whether the server disconnected because of the account
+// rather than for a technical reason.
+func (e *DisconnectError) Rejected() bool {
+	return e.Kind != ""
+}
+
+// AsRejection returns the rejection of the account found in an error chain.
+//
+// Parameters:
+//   - err: The error a connection failed or was lost with
+//
+// Returns:
+//   - *DisconnectError: The rejection, or nil if the server did not reject the account
+func AsRejection(err error) *DisconnectError {
+	var disconnect *DisconnectError
+	if errors.As(err, &disconnect) && disconnect.Rejected() {
+		return disconnect
+	}
+	return nil
+}
+
+// disconnectError converts the error of a disconnect message into a
+// DisconnectError, classifying it by its reason and message. Other errors are
+// returned unchanged.
+func disconnectError(err error) error {
+	if err == nil {
+		return nil
+	}
+	match := disconnectPattern.FindStringSubmatch(err.Error())
+	if match == nil {
+		return err
+	}
+	reason, _ := strconv.ParseUint(match[1], 10, 32)
+	e := &DisconnectError{Reason: uint32(reason), Message: strings.TrimSpace(match[2])}
+
+	message := strings.ToLower(e.Message)
+	for _, rejection := range rejectionKeywords {
+		for _, word := range rejection.words {
+			if strings.Contains(message, word) {
+				e.Kind = rejection.kind
+				return e
+			}
+		}
+	}
+	if e.Reason == disconnectTooManyConnections {
+		e.Kind = RejectedTooManyLogins
+	}
+	return e
+}
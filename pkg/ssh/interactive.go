@@ -0,0 +1,91 @@
+package ssh
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/term"
+)
+
+// promptMu keeps prompts of transports connecting in parallel, as over
+// multipath uplinks, from interleaving on the terminal.
+var promptMu sync.Mutex
+
+// UseKeyboardInteractive offers keyboard-interactive authentication after the
+// other methods, for servers asking for one-time codes or answers to
+// challenges. It must be called before StartTransport.
+//
+// Prompts asking for a password are answered with the configured password.
+// Other prompts take the scripted answers in order, starting over on every
+// connection, and are asked on the terminal once those run out.
+//
+// Parameters:
+//   - answers: Scripted answers, or nil to ask every question on the terminal
+func (s *SSHClient) UseKeyboardInteractive(answers []string) {
+	s.kbdInt = true
+	s.answers = answers
+}
+
+// challenge returns the keyboard-interactive callback of one handshake.
+func (s *SSHClient) challenge() ssh.KeyboardInteractiveChallenge {
+	next := 0
+	passwordUsed := false
+
+	return func(name, instruction string, questions []string, echos []bool) ([]string, error) {
+		answers := make([]string, len(questions))
+		var ask []int
+		for i, question := range questions {
+			switch {
+			case s.password != "" && !passwordUsed && strings.Contains(strings.ToLower(question), "password"):
+				// A second password prompt means the first answer was wrong
+				answers[i], passwordUsed = s.password, true
+			case next < len(s.answers):
+				answers[i] = s.answers[next]
+				next++
+			default:
+				ask = append(ask, i)
+			}
+		}
+		if len(ask) == 0 {
+			return answers, nil
+		}
+
+		fd := int(os.Stdin.Fd())
+		if !term.IsTerminal(fd) {
+			return nil, fmt.Errorf("server asks %q, but no terminal is available; add the answer to ssh.answers", strings.TrimSpace(questions[ask[0]]))
+		}
+
+		promptMu.Lock()
+		defer promptMu.Unlock()
+		defer s.pauseDeadline()()
+
+		for _, text := range []string{name, instruction} {
+			if text = strings.TrimSpace(text); text != "" {
+				fmt.Fprintln(os.Stderr, text)
+			}
+		}
+		reader := bufio.NewReader(os.Stdin)
+		for _, i := range ask {
+			fmt.Fprint(os.Stderr, questions[i])
+			if echos[i] {
+				line, err := reader.ReadString('\n')
+				if err != nil {
+					return nil, fmt.Errorf("failed to read answer: %w", err)
+				}
+				answers[i] = strings.TrimRight(line, "\r\n")
+			} else {
+				answer, err := term.ReadPassword(fd)
+				fmt.Fprintln(os.Stderr)
+				if err != nil {
+					return nil, fmt.Errorf("failed to read answer: %w", err)
+				}
+				answers[i] = string(answer)
+			}
+		}
+		return answers, nil
+	}
+}
@@ -0,0 +1,83 @@
+package ssh
+
+import (
+	"container/list"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrChannelQueueTimeout is returned by Dial when a channel open waited in the
+// queue longer than the configured timeout.
+var ErrChannelQueueTimeout = errors.New("timed out waiting for a free channel-open slot")
+
+// channelLimiter caps the number of channel-open requests in flight on one SSH
+// transport.
+//
+// Requests beyond the limit wait in a FIFO queue and are admitted strictly in
+// arrival order: a released slot is handed directly to the oldest waiter, so a
+// burst of new requests cannot overtake connections that are already queued.
+type channelLimiter struct {
+	mu      sync.Mutex
+	limit   int        // Maximum concurrent channel opens
+	active  int        // Channel opens currently in flight
+	waiters *list.List // Queued requests, each a chan struct{} closed when admitted
+}
+
+// newChannelLimiter creates a limiter admitting up to limit concurrent opens.
+func newChannelLimiter(limit int) *channelLimiter {
+	return &channelLimiter{limit: limit, waiters: list.New()}
+}
+
+// acquire waits for a free slot.
+//
+// Parameters:
+//   - timeout: Maximum time to wait in the queue
+//
+// Returns:
+//   - error: ErrChannelQueueTimeout if no slot became free in time
+func (l *channelLimiter) acquire(timeout time.Duration) error {
+	l.mu.Lock()
+	if l.active < l.limit && l.waiters.Len() == 0 {
+		l.active++
+		l.mu.Unlock()
+		return nil
+	}
+	admitted := make(chan struct{})
+	elem := l.waiters.PushBack(admitted)
+	l.mu.Unlock()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case <-admitted:
+		return nil
+	case <-timer.C:
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	// A slot may have been handed over while the timer fired
+	select {
+	case <-admitted:
+		return nil
+	default:
+	}
+	l.waiters.Remove(elem)
+	return ErrChannelQueueTimeout
+}
+
+// release frees a slot, handing it to the oldest waiter if there is one.
+func (l *channelLimiter) release() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if front := l.waiters.Front(); front != nil {
+		l.waiters.Remove(front)
+		close(front.Value.(chan struct{}))
+		return
+	}
+	l.active--
+}
@@ -0,0 +1,105 @@
+package ssh
+
+import (
+	"fmt"
+	"net"
+	"sync/atomic"
+	"time"
+
+	"tunn/pkg/debuglog"
+)
+
+// activityConn wraps the transport connection and records when data was last
+// read from and written to it.
+type activityConn struct {
+	net.Conn
+	lastRead  atomic.Int64 // Unix nanoseconds of the last successful read
+	lastWrite atomic.Int64 // Unix nanoseconds of the last successful write
+}
+
+// newActivityConn wraps conn, treating the current time as the last activity.
+func newActivityConn(conn net.Conn) *activityConn {
+	a := &activityConn{Conn: conn}
+	now := time.Now().UnixNano()
+	a.lastRead.Store(now)
+	a.lastWrite.Store(now)
+	return a
+}
+
+// Read reads from the underlying connection and records the activity.
+func (a *activityConn) Read(p []byte) (int, error) {
+	n, err := a.Conn.Read(p)
+	if n > 0 {
+		a.lastRead.Store(time.Now().UnixNano())
+	}
+	return n, err
+}
+
+// Write writes to the underlying connection and records the activity.
+func (a *activityConn) Write(p []byte) (int, error) {
+	n, err := a.Conn.Write(p)
+	if n > 0 {
+		a.lastWrite.Store(time.Now().UnixNano())
+	}
+	return n, err
+}
+
+// StartWatchdog monitors the transport for silent failures and closes it when
+// the peer appears dead.
+//
+// Middleboxes sometimes blackhole a connection without resetting it, so writes
+// keep succeeding locally while nothing ever comes back. The watchdog considers
+// the transport dead when data has been written since the last received byte
+// and nothing has been received for the given timeout. To make sure there is
+// always something awaiting an answer, an SSH keepalive request is sent whenever
+// the transport has been idle for the keepalive interval.
+//
+// Closing the transport makes Wait return, so the caller's reconnection logic
+// takes over. The watchdog stops by itself when the transport is closed.
+//
+// Parameters:
+//   - timeout: Time without received data, despite pending writes, before the transport is closed
+//   - keepalive: Idle time after which a keepalive request is sent
+func (s *SSHClient) StartWatchdog(timeout, keepalive time.Duration) {
+	if s.activity == nil || s.sshClient == nil {
+		return
+	}
+
+	stopped := make(chan struct{})
+	go func() {
+		s.sshClient.Wait()
+		close(stopped)
+	}()
+
+	go func() {
+		ticker := time.NewTicker(time.Second)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-stopped:
+				return
+			case now := <-ticker.C:
+				lastRead := time.Unix(0, s.activity.lastRead.Load())
+				lastWrite := time.Unix(0, s.activity.lastWrite.Load())
+
+				if lastWrite.After(lastRead) && now.Sub(lastRead) > timeout {
+					fmt.Printf("✗ No data received for %v despite pending writes, closing transport\n", now.Sub(lastRead).Round(time.Second))
+					s.Close()
+					return
+				}
+
+				if now.Sub(lastRead) > keepalive && now.Sub(lastWrite) > keepalive {
+					// The reply is detected through read activity, so the
+					// request must not block the watchdog loop.
+					go func() {
+						start := time.Now()
+						if _, _, err := s.sshClient.SendRequest("keepalive@openssh.com", true, nil); err == nil {
+							debuglog.Printf("Keepalive answered in %s\n", time.Since(start).Round(time.Millisecond))
+						}
+					}()
+				}
+			}
+		}
+	}()
+}
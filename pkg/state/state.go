@@ -0,0 +1,250 @@
+// Package state persists connection outcomes between runs.
+//
+// In auto mode every connection attempt records whether a strategy connected.
+// The recent history of each strategy gives its win rate, which is used to
+// demote strategies that keep failing on the current network and is shown by
+// "tunn state stats".
+package state
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// minSamples is the number of recent attempts needed before a strategy can be
+// demoted, so a single early failure does not reorder strategies.
+const minSamples = 3
+
+// Outcome is the result of one connection attempt.
+type Outcome struct {
+	Time time.Time `json:"time"` // When the attempt finished
+	OK   bool      `json:"ok"`   // Whether the strategy connected
+}
+
+// Record is the history of one strategy.
+type Record struct {
+	Fingerprint string    `json:"fingerprint"`       // Hash of the strategy settings the history belongs to
+	History     []Outcome `json:"history,omitempty"` // Most recent attempts, oldest first
+	Successes   int       `json:"successes"`         // Successful attempts since the settings last changed
+	Failures    int       `json:"failures"`          // Failed attempts since the settings last changed
+}
+
+// WinRate returns the success rate over the recent history.
+//
+// Returns:
+//   - float64: The fraction of recent attempts that succeeded (0 if none)
+//   - int: The number of recent attempts
+func (r *Record) WinRate() (float64, int) {
+	if len(r.History) == 0 {
+		return 0, 0
+	}
+	wins := 0
+	for _, o := range r.History {
+		if o.OK {
+			wins++
+		}
+	}
+	return float64(wins) / float64(len(r.History)), len(r.History)
+}
+
+// Demoted reports whether the recent failure rate exceeds the error budget.
+//
+// Parameters:
+//   - budget: The tolerated failure rate, between 0 and 1
+//
+// Returns:
+//   - bool: Whether the strategy should be tried after the others
+func (r *Record) Demoted(budget float64) bool {
+	rate, n := r.WinRate()
+	return n >= minSamples && 1-rate > budget
+}
+
+// LastSuccess returns the time of the most recent successful attempt in the
+// history, or the zero time if there is none.
+func (r *Record) LastSuccess() time.Time {
+	for i := len(r.History) - 1; i >= 0; i-- {
+		if r.History[i].OK {
+			return r.History[i].Time
+		}
+	}
+	return time.Time{}
+}
+
+// File is the content of a state file.
+type File struct {
+	Strategies map[string]*Record `json:"strategies"` // Strategy histories by name
+}
+
+// DefaultPath returns the default state file location.
+//
+// Returns:
+//   - string: Path of state.json in the tunn configuration directory
+//   - error: An error if the configuration directory cannot be determined
+func DefaultPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to locate config directory: %w", err)
+	}
+	return filepath.Join(dir, "tunn", "state.json"), nil
+}
+
+// Fingerprint returns a short hash identifying a set of strategy settings, so
+// history is discarded when a strategy is changed under the same name.
+//
+// Parameters:
+//   - v: The settings, encoded as JSON
+//
+// Returns:
+//   - string: The fingerprint
+func Fingerprint(v interface{}) string {
+	data, _ := json.Marshal(v)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:8])
+}
+
+// Load reads a state file. A missing file yields empty state.
+//
+// Parameters:
+//   - path: The state file path
+//
+// Returns:
+//   - *File: The state
+//   - error: An error if the file exists but cannot be read or parsed
+func Load(path string) (*File, error) {
+	f := &File{Strategies: make(map[string]*Record)}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return f, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read state file: %w", err)
+	}
+	if err := json.Unmarshal(data, f); err != nil {
+		return nil, fmt.Errorf("failed to parse state file %s: %w", path, err)
+	}
+	if f.Strategies == nil {
+		f.Strategies = make(map[string]*Record)
+	}
+	return f, nil
+}
+
+// Save writes the state file, replacing it atomically.
+//
+// Parameters:
+//   - path: The state file path; its directory is created if needed
+//
+// Returns:
+//   - error: An error if the file cannot be written
+func (f *File) Save(path string) error {
+	data, err := json.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode state: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("failed to create state directory: %w", err)
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("failed to write state file: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to write state file: %w", err)
+	}
+	return nil
+}
+
+// Get returns the record of a strategy, or an empty record if there is no
+// history for these settings.
+//
+// Parameters:
+//   - name: The strategy name
+//   - fingerprint: The fingerprint of the current strategy settings
+//
+// Returns:
+//   - *Record: The record
+func (f *File) Get(name, fingerprint string) *Record {
+	if r, ok := f.Strategies[name]; ok && r.Fingerprint == fingerprint {
+		return r
+	}
+	return &Record{Fingerprint: fingerprint}
+}
+
+// Record adds the outcome of an attempt to a strategy's history, keeping only
+// the most recent window attempts.
+//
+// Parameters:
+//   - name: The strategy name
+//   - fingerprint: The fingerprint of the strategy settings used
+//   - ok: Whether the attempt succeeded
+//   - window: The number of recent attempts to keep
+//   - t: When the attempt finished
+func (f *File) Record(name, fingerprint string, ok bool, window int, t time.Time) {
+	r := f.Get(name, fingerprint)
+	f.Strategies[name] = r
+
+	r.History = append(r.History, Outcome{Time: t, OK: ok})
+	if len(r.History) > window {
+		r.History = append([]Outcome(nil), r.History[len(r.History)-window:]...)
+	}
+	if ok {
+		r.Successes++
+	} else {
+		r.Failures++
+	}
+}
+
+// Store serializes updates to a state file from concurrent connection attempts.
+type Store struct {
+	path string
+	mu   sync.Mutex
+}
+
+// NewStore creates a store for a state file.
+//
+// Parameters:
+//   - path: The state file path
+//
+// Returns:
+//   - *Store: The store
+func NewStore(path string) *Store {
+	return &Store{path: path}
+}
+
+// Read loads the current state.
+//
+// Returns:
+//   - *File: The state
+//   - error: An error if the file cannot be read
+func (s *Store) Read() (*File, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return Load(s.path)
+}
+
+// Update loads the state, applies fn and saves the result.
+//
+// Parameters:
+//   - fn: The modification to apply
+//
+// Returns:
+//   - error: An error if the file cannot be read or written
+func (s *Store) Update(fn func(*File)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	f, err := Load(s.path)
+	if err != nil {
+		return err
+	}
+	fn(f)
+	return f.Save(s.path)
+}
@@ -0,0 +1,218 @@
+package stats
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"golang.org/x/term"
+
+	"tunn/pkg/utils"
+)
+
+// Display modes supported by Display.
+const (
+	DisplayLine  = "line"  // Redraw a single status line on the terminal
+	DisplayTitle = "title" // Update the terminal window title
+)
+
+// Display periodically renders live tunnel statistics to a terminal.
+//
+// In line mode it redraws a single status line using carriage returns, and in
+// title mode it updates the terminal window title using the OSC 0 escape sequence,
+// leaving the regular log output untouched. Output printed to the terminal
+// while the status line is shown goes through Capture, which clears the line
+// before each write and draws it again below.
+type Display struct {
+	stats    *Stats        // Statistics source
+	mode     string        // Display mode (DisplayLine or DisplayTitle)
+	out      io.Writer     // Terminal output
+	interval time.Duration // Refresh interval
+	done     chan struct{} // Closed to stop the display loop
+	stopped  chan struct{} // Closed when the display loop has exited
+
+	mu      sync.Mutex     // Serializes the status line with captured output
+	text    string         // Last status line ("" before the first)
+	drawn   bool           // The status line is on the terminal
+	partial bool           // Captured output ended without a newline
+	restore []func()       // Put back the captured files
+	copied  sync.WaitGroup // Running copies of captured output
+}
+
+// NewDisplay creates a new statistics display for the given mode.
+//
+// Parameters:
+//   - s: Statistics to render
+//   - mode: DisplayLine or DisplayTitle
+//   - out: Terminal output, typically os.Stderr
+//
+// Returns:
+//   - *Display: A display ready to be started
+//   - error: An error if the mode is not supported
+func NewDisplay(s *Stats, mode string, out io.Writer) (*Display, error) {
+	if mode != DisplayLine && mode != DisplayTitle {
+		return nil, fmt.Errorf("unsupported status display mode: %s (supported: line, title)", mode)
+	}
+	return &Display{
+		stats:    s,
+		mode:     mode,
+		out:      out,
+		interval: time.Second,
+		done:     make(chan struct{}),
+		stopped:  make(chan struct{}),
+	}, nil
+}
+
+// Start begins rendering statistics in a background goroutine.
+func (d *Display) Start() {
+	go d.run()
+}
+
+// Capture routes what is printed to terminal files, such as os.Stdout and
+// os.Stderr, through the display, so in line mode each write clears the status
+// line first and the status line is drawn again after every complete line.
+// Files that are not terminals, and every file in title mode, are left alone.
+// Stop puts the files back.
+//
+// Parameters:
+//   - files: Pointers to the files to capture, e.g. &os.Stdout
+//
+// Returns:
+//   - error: An error if a pipe for the output cannot be created
+func (d *Display) Capture(files ...**os.File) error {
+	if d.mode != DisplayLine {
+		return nil
+	}
+	for _, file := range files {
+		original := *file
+		if !term.IsTerminal(int(original.Fd())) {
+			continue
+		}
+		r, w, err := os.Pipe()
+		if err != nil {
+			return fmt.Errorf("failed to capture output: %w", err)
+		}
+		*file = w
+		d.restore = append(d.restore, func() {
+			*file = original
+			w.Close()
+		})
+		d.copied.Add(1)
+		go func() {
+			defer d.copied.Done()
+			io.Copy(&captured{display: d, out: original}, r)
+			r.Close()
+		}()
+	}
+	return nil
+}
+
+// Stop stops rendering, puts back the captured files once their output is
+// printed, and clears the status line or window title.
+func (d *Display) Stop() {
+	close(d.done)
+	<-d.stopped
+	for _, restore := range d.restore {
+		restore()
+	}
+	d.copied.Wait()
+	d.clear()
+}
+
+// run is the display loop computing transfer rates from counter deltas.
+func (d *Display) run() {
+	defer close(d.stopped)
+
+	ticker := time.NewTicker(d.interval)
+	defer ticker.Stop()
+
+	prev := d.stats.Snapshot()
+	prevTime := time.Now()
+
+	for {
+		select {
+		case <-d.done:
+			return
+		case now := <-ticker.C:
+			cur := d.stats.Snapshot()
+			elapsed := now.Sub(prevTime).Seconds()
+			if elapsed <= 0 {
+				continue
+			}
+			upRate := float64(cur.BytesUp-prev.BytesUp) / elapsed
+			downRate := float64(cur.BytesDown-prev.BytesDown) / elapsed
+			d.render(cur, upRate, downRate)
+			prev, prevTime = cur, now
+		}
+	}
+}
+
+// render writes a single status update in the configured mode.
+func (d *Display) render(cur Snapshot, upRate, downRate float64) {
+	text := fmt.Sprintf("↑ %s/s  ↓ %s/s  │ %d active  │ total ↑ %s ↓ %s",
+		utils.FormatBytes(int64(upRate)),
+		utils.FormatBytes(int64(downRate)),
+		cur.ActiveConns,
+		utils.FormatBytes(cur.BytesUp),
+		utils.FormatBytes(cur.BytesDown),
+	)
+
+	switch d.mode {
+	case DisplayLine:
+		d.mu.Lock()
+		defer d.mu.Unlock()
+		d.text = text
+		// A partial line is the rest of a prompt or message still being printed
+		if !d.partial {
+			fmt.Fprintf(d.out, "\r\033[K%s", text)
+			d.drawn = true
+		}
+	case DisplayTitle:
+		fmt.Fprintf(d.out, "\033]0;tunn %s\007", text)
+	}
+}
+
+// clear removes the status line or resets the window title.
+func (d *Display) clear() {
+	switch d.mode {
+	case DisplayLine:
+		d.mu.Lock()
+		defer d.mu.Unlock()
+		d.text = ""
+		if d.drawn {
+			fmt.Fprint(d.out, "\r\033[K")
+			d.drawn = false
+		}
+	case DisplayTitle:
+		fmt.Fprint(d.out, "\033]0;tunn\007")
+	}
+}
+
+// captured writes output captured by Display.Capture to its original file,
+// around the status line.
+type captured struct {
+	display *Display  // The display drawing the status line
+	out     io.Writer // The original file
+}
+
+// Write implements io.Writer.
+func (c *captured) Write(p []byte) (int, error) {
+	d := c.display
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.drawn {
+		fmt.Fprint(d.out, "\r\033[K")
+		d.drawn = false
+	}
+	n, err := c.out.Write(p)
+	if len(p) > 0 {
+		d.partial = p[len(p)-1] != '\n'
+	}
+	if !d.partial && d.text != "" {
+		fmt.Fprint(d.out, d.text)
+		d.drawn = true
+	}
+	return n, err
+}
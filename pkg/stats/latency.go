@@ -0,0 +1,239 @@
+package stats
+
+import (
+	"cmp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// latencySamples is the number of recent channel-open and first-byte samples
+// kept per destination.
+const latencySamples = 32
+
+// LatencyPolicy controls when a destination is flagged as slow and what happens then.
+type LatencyPolicy struct {
+	SlowThreshold time.Duration // Channel-open time considered slow
+	MinSamples    int           // Consecutive slow opens before a destination is flagged
+	Block         bool          // Reject new connections to flagged destinations
+	BlockDuration time.Duration // How long a flagged destination stays blocked
+}
+
+// DefaultLatencyPolicy warns after three consecutive channel opens slower than three seconds.
+var DefaultLatencyPolicy = LatencyPolicy{
+	SlowThreshold: 3 * time.Second,
+	MinSamples:    3,
+	BlockDuration: 5 * time.Minute,
+}
+
+// Latency tracks SSH channel-open and first-byte latency per destination.
+//
+// Destinations whose channel opens are consistently slow are often throttled or
+// blocked beyond the SSH server. Latency flags such destinations so the user can
+// be warned, and optionally rejects new connections to them for a while instead
+// of letting every client wait for the slow open.
+type Latency struct {
+	mu           sync.Mutex
+	policy       LatencyPolicy
+	destinations map[string]*destinationLatency
+}
+
+// DestinationLatency summarizes the recent latencies of one destination.
+//
+// Connect is the time the SSH server took to open a channel to the destination,
+// which includes its own connection to it; first byte is the time from then
+// until the destination sent its first data. A destination slow to connect to
+// but quick to answer points at the tunnel, one slow to answer at the
+// destination itself.
+type DestinationLatency struct {
+	Destination  string        `json:"destination"`  // Destination address in "host:port" format
+	Connects     int           `json:"connects"`     // Channel opens sampled, at most latencySamples
+	ConnectP50   time.Duration `json:"connectP50"`   // Median channel-open time
+	ConnectP95   time.Duration `json:"connectP95"`   // 95th percentile channel-open time
+	FirstBytes   int           `json:"firstBytes"`   // Connections sampled for first-byte time
+	FirstByteP50 time.Duration `json:"firstByteP50"` // Median time to the first byte from the destination
+	FirstByteP95 time.Duration `json:"firstByteP95"` // 95th percentile time to the first byte
+	Slow         bool          `json:"slow"`         // Whether the destination is flagged as slow
+}
+
+// destinationLatency holds the recent samples of a single destination.
+type destinationLatency struct {
+	samples      []time.Duration // Ring buffer of recent channel-open times
+	next         int             // Next write position in samples
+	firstBytes   []time.Duration // Ring buffer of recent first-byte times
+	nextFirst    int             // Next write position in firstBytes
+	slowStreak   int             // Consecutive slow opens
+	flagged      bool            // Whether the destination is currently flagged as slow
+	blockedUntil time.Time       // End of the block period when blocking is enabled
+}
+
+// NewLatency creates a latency tracker with the given policy.
+func NewLatency(policy LatencyPolicy) *Latency {
+	return &Latency{
+		policy:       policy,
+		destinations: make(map[string]*destinationLatency),
+	}
+}
+
+// SetPolicy replaces the slow-destination policy.
+func (l *Latency) SetPolicy(policy LatencyPolicy) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.policy = policy
+}
+
+// Record adds a channel-open sample for a destination.
+//
+// Parameters:
+//   - destination: The destination address in "host:port" format
+//   - d: Time taken to open the SSH channel
+//
+// Returns:
+//   - bool: True if this sample caused the destination to become flagged as slow
+func (l *Latency) Record(destination string, d time.Duration) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	dest := l.destination(destination)
+	dest.samples = addSample(dest.samples, &dest.next, d)
+
+	if d < l.policy.SlowThreshold {
+		dest.slowStreak = 0
+		dest.flagged = false
+		return false
+	}
+
+	dest.slowStreak++
+	if dest.flagged || dest.slowStreak < l.policy.MinSamples {
+		return false
+	}
+
+	dest.flagged = true
+	if l.policy.Block {
+		dest.blockedUntil = time.Now().Add(l.policy.BlockDuration)
+	}
+	return true
+}
+
+// RecordFirstByte adds a first-byte sample for a destination: the time from the
+// channel being opened until the destination sent its first data.
+//
+// Parameters:
+//   - destination: The destination address in "host:port" format
+//   - d: Time taken for the first byte to arrive
+func (l *Latency) RecordFirstByte(destination string, d time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	dest := l.destination(destination)
+	dest.firstBytes = addSample(dest.firstBytes, &dest.nextFirst, d)
+}
+
+// destination returns the samples of a destination, creating them on first use.
+// The caller must hold l.mu.
+func (l *Latency) destination(destination string) *destinationLatency {
+	dest := l.destinations[destination]
+	if dest == nil {
+		dest = &destinationLatency{samples: make([]time.Duration, 0, latencySamples)}
+		l.destinations[destination] = dest
+	}
+	return dest
+}
+
+// addSample writes a sample into a ring buffer of latencySamples entries.
+//
+// Parameters:
+//   - samples: The ring buffer, growing until it is full
+//   - next: The next write position, advanced past the sample
+//   - d: The sample to add
+//
+// Returns:
+//   - []time.Duration: The ring buffer holding the sample
+func addSample(samples []time.Duration, next *int, d time.Duration) []time.Duration {
+	if len(samples) < latencySamples {
+		samples = append(samples, d)
+	} else {
+		samples[*next] = d
+	}
+	*next = (*next + 1) % latencySamples
+	return samples
+}
+
+// Top summarizes the recent latencies of every destination, the slowest to
+// connect to first.
+//
+// Returns:
+//   - []DestinationLatency: One summary per destination, sorted by ConnectP95 descending
+func (l *Latency) Top() []DestinationLatency {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	top := make([]DestinationLatency, 0, len(l.destinations))
+	for destination, dest := range l.destinations {
+		top = append(top, DestinationLatency{
+			Destination:  destination,
+			Connects:     len(dest.samples),
+			ConnectP50:   percentile(dest.samples, 50),
+			ConnectP95:   percentile(dest.samples, 95),
+			FirstBytes:   len(dest.firstBytes),
+			FirstByteP50: percentile(dest.firstBytes, 50),
+			FirstByteP95: percentile(dest.firstBytes, 95),
+			Slow:         dest.flagged,
+		})
+	}
+	slices.SortFunc(top, func(a, b DestinationLatency) int {
+		if a.ConnectP95 != b.ConnectP95 {
+			return cmp.Compare(b.ConnectP95, a.ConnectP95)
+		}
+		return strings.Compare(a.Destination, b.Destination)
+	})
+	return top
+}
+
+// percentile returns the nearest-rank percentile of samples, or 0 without any.
+//
+// Parameters:
+//   - samples: The samples, left unchanged
+//   - p: The percentile, between 1 and 100
+//
+// Returns:
+//   - time.Duration: The smallest sample that p percent of the samples do not exceed
+func percentile(samples []time.Duration, p int) time.Duration {
+	if len(samples) == 0 {
+		return 0
+	}
+	sorted := slices.Clone(samples)
+	slices.Sort(sorted)
+	rank := (p*len(sorted) + 99) / 100
+	return sorted[max(rank, 1)-1]
+}
+
+// Allowed reports whether new connections to a destination may be attempted.
+//
+// Destinations are only rejected when blocking is enabled and the destination
+// was flagged as slow within the block duration.
+func (l *Latency) Allowed(destination string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	dest := l.destinations[destination]
+	if dest == nil || dest.blockedUntil.IsZero() {
+		return true
+	}
+	if time.Now().After(dest.blockedUntil) {
+		// Give the destination a fresh chance after the block period
+		dest.blockedUntil = time.Time{}
+		dest.flagged = false
+		dest.slowStreak = 0
+		return true
+	}
+	return false
+}
+
+// Policy returns the current slow-destination policy.
+func (l *Latency) Policy() LatencyPolicy {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.policy
+}
@@ -0,0 +1,104 @@
+package stats
+
+import (
+	"fmt"
+	"runtime"
+	"time"
+)
+
+// Resource growth is sampled every resourceInterval. A count that rose at each
+// of the last growthSamples samples (five minutes) is reported as a possible
+// leak, and reported again only once it has doubled since the last report.
+const (
+	resourceInterval = 30 * time.Second
+	growthSamples    = 10
+)
+
+// Resources is a point-in-time count of the resources held by the process.
+type Resources struct {
+	Goroutines  int   `json:"goroutines"`  // Running goroutines
+	OpenFiles   int   `json:"openFiles"`   // Open file descriptors, including sockets (-1 if unknown)
+	SSHChannels int64 `json:"sshChannels"` // Open SSH channels
+	ClientConns int64 `json:"clientConns"` // Open local proxy client connections
+}
+
+// ChannelOpened records a newly opened SSH channel.
+func (s *Stats) ChannelOpened() {
+	s.channels.Add(1)
+}
+
+// ChannelClosed records that an SSH channel has been closed.
+func (s *Stats) ChannelClosed() {
+	s.channels.Add(-1)
+}
+
+// Resources returns the current resource counts.
+//
+// Returns:
+//   - Resources: Goroutines, file descriptors, SSH channels and client connections
+func (s *Stats) Resources() Resources {
+	return Resources{
+		Goroutines:  runtime.NumGoroutine(),
+		OpenFiles:   openFiles(),
+		SSHChannels: s.channels.Load(),
+		ClientConns: s.activeConns.Load(),
+	}
+}
+
+// MonitorResources samples the resource counts until done is closed and warns
+// when one keeps growing, which usually means a forwarding path is leaking.
+//
+// Parameters:
+//   - done: Closed to stop monitoring
+func (s *Stats) MonitorResources(done <-chan struct{}) {
+	ticker := time.NewTicker(resourceInterval)
+	defer ticker.Stop()
+
+	watches := []*growthWatch{
+		{name: "goroutines"},
+		{name: "open file descriptors"},
+		{name: "SSH channels"},
+	}
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			r := s.Resources()
+			for i, value := range []int64{int64(r.Goroutines), int64(r.OpenFiles), r.SSHChannels} {
+				if value >= 0 && watches[i].add(value) {
+					fmt.Printf("✗ %s keep growing (%d, up from %d five minutes ago with %d client connections open); this may be a leak, check \"tunn status --debug\"\n",
+						watches[i].name, value, watches[i].samples[0], r.ClientConns)
+				}
+			}
+		}
+	}
+}
+
+// growthWatch detects a count that rises at every sample.
+type growthWatch struct {
+	name     string  // Name used in warnings
+	samples  []int64 // The most recent samples, oldest first
+	reported int64   // Value at the last warning, 0 if none
+}
+
+// add records a sample and reports whether a warning is due.
+func (g *growthWatch) add(value int64) bool {
+	g.samples = append(g.samples, value)
+	if len(g.samples) > growthSamples+1 {
+		g.samples = g.samples[1:]
+	}
+	if len(g.samples) <= growthSamples {
+		return false
+	}
+	for i := 1; i < len(g.samples); i++ {
+		if g.samples[i] <= g.samples[i-1] {
+			return false
+		}
+	}
+	if g.reported > 0 && value < 2*g.reported {
+		return false
+	}
+	g.reported = value
+	return true
+}
@@ -0,0 +1,8 @@
+//go:build !linux
+
+package stats
+
+// openFiles is not implemented on this platform.
+func openFiles() int {
+	return -1
+}
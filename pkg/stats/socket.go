@@ -0,0 +1,53 @@
+package stats
+
+import (
+	"errors"
+	"net"
+	"time"
+)
+
+// ErrSocketInfoUnsupported is returned when socket statistics are not available
+// for a connection, either because the platform does not expose them or because
+// the connection is not backed by a TCP socket.
+var ErrSocketInfoUnsupported = errors.New("socket statistics not supported")
+
+// SocketInfo holds kernel statistics for a TCP socket.
+//
+// Values the platform does not expose are left at zero.
+type SocketInfo struct {
+	RTT         time.Duration `json:"rtt"`         // Smoothed round-trip time estimate
+	RTTVar      time.Duration `json:"rttVar"`      // Round-trip time variance
+	Retransmits uint32        `json:"retransmits"` // Segments retransmitted over the socket's lifetime
+	Lost        uint32        `json:"lost"`        // Segments currently considered lost
+	Cwnd        uint32        `json:"cwnd"`        // Congestion window in segments
+	SSThresh    uint32        `json:"ssthresh"`    // Slow start threshold in segments
+	MSS         uint32        `json:"mss"`         // Sender maximum segment size in bytes
+	SendQueue   int           `json:"sendQueue"`   // Bytes in the send buffer not yet acknowledged
+	RecvQueue   int           `json:"recvQueue"`   // Bytes in the receive buffer not yet read
+	SendBuffer  int           `json:"sendBuffer"`  // Send buffer size in bytes
+	RecvBuffer  int           `json:"recvBuffer"`  // Receive buffer size in bytes
+}
+
+// ReadSocketInfo reads kernel statistics for the TCP socket behind conn.
+//
+// Wrapping connections such as TLS are unwrapped through their NetConn method
+// until a TCP connection is found.
+//
+// Parameters:
+//   - conn: The connection to inspect
+//
+// Returns:
+//   - *SocketInfo: The socket statistics
+//   - error: ErrSocketInfoUnsupported, or an error if the kernel query fails
+func ReadSocketInfo(conn net.Conn) (*SocketInfo, error) {
+	for {
+		if tcpConn, ok := conn.(*net.TCPConn); ok {
+			return readTCPInfo(tcpConn)
+		}
+		wrapper, ok := conn.(interface{ NetConn() net.Conn })
+		if !ok {
+			return nil, ErrSocketInfoUnsupported
+		}
+		conn = wrapper.NetConn()
+	}
+}
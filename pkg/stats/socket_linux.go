@@ -0,0 +1,49 @@
+//go:build linux
+
+package stats
+
+import (
+	"fmt"
+	"net"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// readTCPInfo queries TCP_INFO and the socket queue and buffer sizes.
+func readTCPInfo(conn *net.TCPConn) (*SocketInfo, error) {
+	raw, err := conn.SyscallConn()
+	if err != nil {
+		return nil, err
+	}
+
+	info := &SocketInfo{}
+	var sockErr error
+	err = raw.Control(func(fd uintptr) {
+		tcpInfo, err := unix.GetsockoptTCPInfo(int(fd), unix.IPPROTO_TCP, unix.TCP_INFO)
+		if err != nil {
+			sockErr = fmt.Errorf("TCP_INFO: %w", err)
+			return
+		}
+		info.RTT = time.Duration(tcpInfo.Rtt) * time.Microsecond
+		info.RTTVar = time.Duration(tcpInfo.Rttvar) * time.Microsecond
+		info.Retransmits = tcpInfo.Total_retrans
+		info.Lost = tcpInfo.Lost
+		info.Cwnd = tcpInfo.Snd_cwnd
+		info.SSThresh = tcpInfo.Snd_ssthresh
+		info.MSS = tcpInfo.Snd_mss
+
+		// Queue and buffer sizes are best effort
+		info.SendQueue, _ = unix.IoctlGetInt(int(fd), unix.SIOCOUTQ)
+		info.RecvQueue, _ = unix.IoctlGetInt(int(fd), unix.SIOCINQ)
+		info.SendBuffer, _ = unix.GetsockoptInt(int(fd), unix.SOL_SOCKET, unix.SO_SNDBUF)
+		info.RecvBuffer, _ = unix.GetsockoptInt(int(fd), unix.SOL_SOCKET, unix.SO_RCVBUF)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if sockErr != nil {
+		return nil, sockErr
+	}
+	return info, nil
+}
@@ -0,0 +1,10 @@
+//go:build !linux
+
+package stats
+
+import "net"
+
+// readTCPInfo is not implemented on this platform.
+func readTCPInfo(conn *net.TCPConn) (*SocketInfo, error) {
+	return nil, ErrSocketInfoUnsupported
+}
@@ -0,0 +1,137 @@
+// Package stats provides traffic and connection statistics for the Tunn SSH tunneling tool.
+//
+// This package implements lock-free counters that are shared between the proxy
+// servers and the tunnel manager, tracking bytes transferred through the tunnel
+// and the number of active and total client connections, as well as per-destination
+// SSH channel-open and first-byte latency.
+//
+// All counters are safe for concurrent use and can be read at any time through
+// a Snapshot without blocking the forwarding paths.
+package stats
+
+import (
+	"io"
+	"sync/atomic"
+	"time"
+)
+
+// Stats holds the live traffic and connection counters for a tunnel.
+//
+// Upload counts bytes sent from local clients into the tunnel, download counts
+// bytes received from the tunnel and written back to local clients.
+type Stats struct {
+	bytesUp     atomic.Int64 // Bytes sent from local clients through the tunnel
+	bytesDown   atomic.Int64 // Bytes received through the tunnel for local clients
+	activeConns atomic.Int64 // Currently open client connections
+	totalConns  atomic.Int64 // Client connections accepted since startup
+	bytesToday  atomic.Int64 // Bytes in either direction since local midnight
+	blocked     atomic.Int64 // Connections rejected by a blocklist since startup
+	channels    atomic.Int64 // Open SSH channels
+	today       atomic.Int64 // Local day bytesToday belongs to, as YYYYMMDD
+
+	Latency *Latency // Per-destination SSH channel-open and first-byte latency
+}
+
+// Snapshot is a point-in-time copy of the statistics counters.
+type Snapshot struct {
+	BytesUp     int64 `json:"bytesUp"`     // Total bytes uploaded
+	BytesDown   int64 `json:"bytesDown"`   // Total bytes downloaded
+	ActiveConns int64 `json:"activeConns"` // Currently open connections
+	TotalConns  int64 `json:"totalConns"`  // Connections accepted since startup
+	BytesToday  int64 `json:"bytesToday"`  // Bytes in either direction since local midnight
+	Blocked     int64 `json:"blocked"`     // Connections rejected by a blocklist since startup
+}
+
+// New creates a new zeroed statistics instance.
+//
+// Returns:
+//   - *Stats: A statistics instance ready to be shared between components
+func New() *Stats {
+	return &Stats{Latency: NewLatency(DefaultLatencyPolicy)}
+}
+
+// AddUp records n bytes sent from a local client into the tunnel.
+func (s *Stats) AddUp(n int64) {
+	s.bytesUp.Add(n)
+	s.addToday(n)
+}
+
+// AddDown records n bytes received from the tunnel for a local client.
+func (s *Stats) AddDown(n int64) {
+	s.bytesDown.Add(n)
+	s.addToday(n)
+}
+
+// addToday adds n bytes to the daily counter, restarting it on a new day.
+//
+// A few bytes racing with the day change may be counted on either day, which
+// is acceptable for a usage figure.
+func (s *Stats) addToday(n int64) {
+	day := dayNumber(time.Now())
+	if old := s.today.Load(); old != day && s.today.CompareAndSwap(old, day) {
+		s.bytesToday.Store(0)
+	}
+	s.bytesToday.Add(n)
+}
+
+// dayNumber returns the local calendar day of t as YYYYMMDD.
+func dayNumber(t time.Time) int64 {
+	y, m, d := t.Date()
+	return int64(y*10000 + int(m)*100 + d)
+}
+
+// AddBlocked records a connection rejected by a blocklist.
+func (s *Stats) AddBlocked() {
+	s.blocked.Add(1)
+}
+
+// ConnOpened records a newly accepted client connection.
+func (s *Stats) ConnOpened() {
+	s.activeConns.Add(1)
+	s.totalConns.Add(1)
+}
+
+// ConnClosed records that a client connection has been closed.
+func (s *Stats) ConnClosed() {
+	s.activeConns.Add(-1)
+}
+
+// Snapshot returns a consistent-enough copy of all counters for display.
+//
+// Individual counters are read atomically, but the snapshot as a whole is not
+// taken under a single lock, which is acceptable for status reporting.
+//
+// Returns:
+//   - Snapshot: The current counter values
+func (s *Stats) Snapshot() Snapshot {
+	snapshot := Snapshot{
+		BytesUp:     s.bytesUp.Load(),
+		BytesDown:   s.bytesDown.Load(),
+		ActiveConns: s.activeConns.Load(),
+		TotalConns:  s.totalConns.Load(),
+		Blocked:     s.blocked.Load(),
+	}
+	// The daily counter only restarts on traffic, so it is stale after an idle midnight
+	if s.today.Load() == dayNumber(time.Now()) {
+		snapshot.BytesToday = s.bytesToday.Load()
+	}
+	return snapshot
+}
+
+// CountingWriter wraps an io.Writer and reports every successful write to a callback.
+//
+// It is used by the forwarding paths to account traffic without changing the
+// io.Copy based data flow.
+type CountingWriter struct {
+	W     io.Writer   // Underlying writer
+	Count func(int64) // Callback receiving the number of bytes written
+}
+
+// Write writes p to the underlying writer and reports the number of bytes written.
+func (c *CountingWriter) Write(p []byte) (int, error) {
+	n, err := c.W.Write(p)
+	if n > 0 && c.Count != nil {
+		c.Count(int64(n))
+	}
+	return n, err
+}
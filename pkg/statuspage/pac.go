@@ -0,0 +1,67 @@
+package statuspage
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// handlePAC writes a proxy auto-config file pointing browsers at the local
+// proxy, so they can be configured with the URL of the file instead of the
+// proxy address and type.
+func (s *Server) handlePAC(w http.ResponseWriter, r *http.Request) {
+	if !s.authorized(w, r) {
+		return
+	}
+	w.Header().Set("Content-Type", "application/x-ns-proxy-autoconfig")
+	w.Header().Set("Cache-Control", "no-store")
+	fmt.Fprint(w, pacScript(s.proxies(r)))
+}
+
+// proxies returns the PAC proxy list for the local proxy as seen by the
+// client of a request.
+//
+// A proxy listening on all addresses is announced under the address the
+// client reached the status page at, since both run on this machine; one
+// listening on a single address is announced under that address.
+//
+// Returns:
+//   - string: The proxies, e.g. "SOCKS5 192.168.1.2:1080; SOCKS 192.168.1.2:1080"
+func (s *Server) proxies(r *http.Request) string {
+	listener := s.listener()
+	host := listener.Host
+	if ip := net.ParseIP(host); ip == nil || ip.IsUnspecified() {
+		host = r.Host
+		if h, _, err := net.SplitHostPort(r.Host); err == nil {
+			host = h
+		}
+	}
+	address := net.JoinHostPort(host, strconv.Itoa(listener.Port))
+
+	switch listener.ProxyType {
+	case "socks5", "socks":
+		// SOCKS5 is understood by Firefox and Chromium, SOCKS by older browsers
+		return fmt.Sprintf("SOCKS5 %s; SOCKS %s", address, address)
+	case "mixed":
+		return fmt.Sprintf("SOCKS5 %s; PROXY %s", address, address)
+	default:
+		return "PROXY " + address
+	}
+}
+
+// pacScript returns a PAC file sending everything but local destinations to
+// the given proxies. There is deliberately no DIRECT fallback, so traffic
+// does not leave outside the tunnel while it is down.
+func pacScript(proxies string) string {
+	var b strings.Builder
+	b.WriteString("function FindProxyForURL(url, host) {\n")
+	b.WriteString("  if (isPlainHostName(host) || host === \"localhost\" ||\n")
+	b.WriteString("      shExpMatch(host, \"127.*\") || host === \"::1\" || host === \"[::1]\") {\n")
+	b.WriteString("    return \"DIRECT\";\n")
+	b.WriteString("  }\n")
+	fmt.Fprintf(&b, "  return %q;\n", proxies)
+	b.WriteString("}\n")
+	return b.String()
+}
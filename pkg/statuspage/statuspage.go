@@ -0,0 +1,264 @@
+// Package statuspage serves a read-only status page for a running tunnel.
+//
+// The page is meant to be shared with other people on the local network, for
+// example housemates using the tunnel through a router, so they can see whether
+// it is working without being given any control over it. It shows only whether
+// the tunnel is up, the country traffic exits in and the data used today.
+//
+// Endpoints:
+//   - GET /: The status page as HTML, refreshing itself every 30 seconds
+//   - GET /status.json: The same information as JSON
+//   - GET /proxy.pac: A proxy auto-config file pointing at the local proxy
+package statuspage
+
+import (
+	"bufio"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"tunn/pkg/clientfilter"
+	"tunn/pkg/config"
+	"tunn/pkg/control"
+	"tunn/pkg/utils"
+)
+
+// Exit country lookups are cached for countryTTL, or for countryRetry after a
+// failure, and repeated at once when the active transport changes.
+const (
+	countryTTL   = 30 * time.Minute
+	countryRetry = time.Minute
+)
+
+// Dialer opens tunneled connections, used to look up the exit country.
+type Dialer interface {
+	Dial(network, address string) (net.Conn, error)
+}
+
+// Status is the information shown on the status page.
+type Status struct {
+	Up          bool   `json:"up"`          // Whether an SSH transport is connected
+	Country     string `json:"country"`     // Exit country code, empty if unknown
+	BytesToday  int64  `json:"bytesToday"`  // Bytes transferred since local midnight
+	UsedToday   string `json:"usedToday"`   // BytesToday formatted for display
+	LastUpdated string `json:"lastUpdated"` // Local time the status was taken
+}
+
+// Server serves the status page.
+type Server struct {
+	provider   control.Provider             // Source of the tunnel state
+	dialer     Dialer                       // Tunneled dialer for the exit country lookup
+	listener   func() config.ListenerConfig // Settings of the local proxy, for the PAC file
+	countryURL string                       // URL answering with "loc=XX" lines
+	token      string                       // Required ?token= value, empty for none
+	server     *http.Server                 // HTTP server, set once started
+
+	mu        sync.Mutex // Serializes country lookups and guards the cache below
+	country   string     // Cached exit country code
+	countryOf string     // Remote address of the transport the country was looked up over
+	expires   time.Time  // When the cached country must be looked up again
+}
+
+// NewServer creates a status page server.
+//
+// Parameters:
+//   - provider: The source of the tunnel state
+//   - dialer: The tunneled dialer used to look up the exit country
+//   - listener: Returns the current settings of the local proxy
+//   - countryURL: A URL answering with a "loc=XX" line, such as Cloudflare's trace endpoint
+//   - token: The access token required as ?token=, or empty to serve anyone
+//
+// Returns:
+//   - *Server: A server ready to be started
+func NewServer(provider control.Provider, dialer Dialer, listener func() config.ListenerConfig, countryURL, token string) *Server {
+	return &Server{provider: provider, dialer: dialer, listener: listener, countryURL: countryURL, token: token}
+}
+
+// Start binds the status page and serves it in the background.
+//
+// Parameters:
+//   - address: Listen address in "host:port" format, which may be a LAN address
+//   - clients: The clients that may view the page, or nil to admit all
+//
+// Returns:
+//   - error: An error if the address cannot be bound
+func (s *Server) Start(address string, clients *clientfilter.Filter) error {
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return fmt.Errorf("failed to start status page: %w", err)
+	}
+	listener = clientfilter.Listen(listener, clients, "status page")
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /{$}", s.handlePage)
+	mux.HandleFunc("GET /status.json", s.handleJSON)
+	mux.HandleFunc("GET /proxy.pac", s.handlePAC)
+	s.server = &http.Server{Handler: mux, ReadHeaderTimeout: 5 * time.Second}
+
+	go s.server.Serve(listener)
+	fmt.Printf("✓ Status page available at http://%s/\n", listener.Addr())
+	return nil
+}
+
+// Close stops the status page server.
+//
+// Returns:
+//   - error: An error if closing the listener fails
+func (s *Server) Close() error {
+	if s.server == nil {
+		return nil
+	}
+	return s.server.Close()
+}
+
+// Status returns the information shown on the page, looking up the exit
+// country if the cached value is stale.
+//
+// Returns:
+//   - Status: The current status
+func (s *Server) Status() Status {
+	status := s.provider.Status(false)
+	now := time.Now()
+	page := Status{
+		Up:          len(status.Transports) > 0,
+		BytesToday:  status.Stats.BytesToday,
+		UsedToday:   utils.FormatBytes(status.Stats.BytesToday),
+		LastUpdated: now.Format("15:04:05"),
+	}
+	if page.Up {
+		page.Country = s.exitCountry(status.Transports[0].RemoteAddr)
+	}
+	return page
+}
+
+// exitCountry returns the exit country, looking it up through the tunnel when
+// the cache has expired or belongs to a different transport.
+func (s *Server) exitCountry(transport string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if transport == s.countryOf && time.Now().Before(s.expires) {
+		return s.country
+	}
+
+	country, err := s.lookupCountry()
+	s.country, s.countryOf = country, transport
+	if err != nil {
+		s.expires = time.Now().Add(countryRetry)
+	} else {
+		s.expires = time.Now().Add(countryTTL)
+	}
+	return s.country
+}
+
+// lookupCountry requests the country URL through the tunnel and returns the
+// value of its "loc=" line.
+func (s *Server) lookupCountry() (string, error) {
+	client := &http.Client{
+		Timeout: 10 * time.Second,
+		Transport: &http.Transport{
+			Dial:              s.dialer.Dial,
+			DisableKeepAlives: true,
+		},
+	}
+	resp, err := client.Get(s.countryURL)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("country lookup returned %s", resp.Status)
+	}
+
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		if loc, ok := strings.CutPrefix(scanner.Text(), "loc="); ok {
+			return strings.ToUpper(strings.TrimSpace(loc)), nil
+		}
+	}
+	return "", fmt.Errorf("country lookup response has no loc= line")
+}
+
+// authorized reports whether a request carries the access token, if one is set.
+func (s *Server) authorized(w http.ResponseWriter, r *http.Request) bool {
+	if s.token == "" || subtle.ConstantTimeCompare([]byte(r.URL.Query().Get("token")), []byte(s.token)) == 1 {
+		return true
+	}
+	http.Error(w, "Forbidden", http.StatusForbidden)
+	return false
+}
+
+// handleJSON writes the status as JSON.
+func (s *Server) handleJSON(w http.ResponseWriter, r *http.Request) {
+	if !s.authorized(w, r) {
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(s.Status())
+}
+
+// handlePage renders the status page.
+func (s *Server) handlePage(w http.ResponseWriter, r *http.Request) {
+	if !s.authorized(w, r) {
+		return
+	}
+	status := s.Status()
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	pageTemplate.Execute(w, struct {
+		Status
+		Flag string
+	}{status, flag(status.Country)})
+}
+
+// flag returns the flag emoji for a two-letter country code, or an empty
+// string if the code is not two letters.
+func flag(country string) string {
+	if len(country) != 2 || country[0] < 'A' || country[0] > 'Z' || country[1] < 'A' || country[1] > 'Z' {
+		return ""
+	}
+	const regionalIndicatorA = 0x1F1E6
+	return string([]rune{
+		rune(regionalIndicatorA + int(country[0]-'A')),
+		rune(regionalIndicatorA + int(country[1]-'A')),
+	})
+}
+
+// pageTemplate is the status page. The token stays in the URL across the
+// automatic refreshes because the page reloads itself.
+var pageTemplate = template.Must(template.New("status").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<meta http-equiv="refresh" content="30">
+<title>Tunnel {{if .Up}}up{{else}}down{{end}}</title>
+<style>
+body { font-family: sans-serif; max-width: 24em; margin: 3em auto; padding: 0 1em; color: #222; }
+.state { font-size: 2em; font-weight: bold; margin-bottom: 0.5em; }
+.up { color: #1a7f37; }
+.down { color: #cf222e; }
+dt { color: #666; margin-top: 0.8em; }
+dd { margin: 0; font-size: 1.3em; }
+footer { margin-top: 2em; color: #888; font-size: 0.8em; }
+</style>
+</head>
+<body>
+{{if .Up}}<div class="state up">● Tunnel up</div>{{else}}<div class="state down">● Tunnel down</div>{{end}}
+<dl>
+<dt>Exit country</dt>
+<dd>{{if .Country}}{{.Flag}} {{.Country}}{{else}}unknown{{end}}</dd>
+<dt>Data used today</dt>
+<dd>{{.UsedToday}}</dd>
+</dl>
+<footer>Updated {{.LastUpdated}}</footer>
+</body>
+</html>
+`))
@@ -0,0 +1,182 @@
+// Package summary describes how to point clients at a running tunnel: the
+// URLs of the local proxy, environment variables for command-line tools and
+// browser settings, derived from the addresses the listeners are bound to.
+package summary
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+)
+
+// Summary is the client settings for a running tunnel, printed once it is
+// established.
+type Summary struct {
+	Proxies     []Proxy   `json:"proxies"`               // Proxy URLs, one per protocol and bound address
+	Transparent []string  `json:"transparent,omitempty"` // Addresses of transparent proxies, which take no client settings
+	Env         []string  `json:"env,omitempty"`         // Shell lines setting the proxy variables
+	Browsers    []Hint    `json:"browsers,omitempty"`    // How to configure common browsers
+	Forwards    []Forward `json:"forwards,omitempty"`    // Local ports forwarded to fixed destinations
+}
+
+// Proxy is a URL clients can use as their proxy.
+type Proxy struct {
+	Protocol string `json:"protocol"` // "socks5" or "http"
+	URL      string `json:"url"`      // e.g. "socks5://127.0.0.1:1080"
+}
+
+// Hint tells how to configure one browser for the proxy.
+type Hint struct {
+	Browser string `json:"browser"` // Browser name
+	Setting string `json:"setting"` // Setting or command line to use
+}
+
+// Forward is a local port whose connections are relayed to a destination.
+type Forward struct {
+	Listen string `json:"listen"` // Local address
+	Remote string `json:"remote"` // Destination as seen from the SSH server
+}
+
+// Listener is a local proxy the summary is built from.
+type Listener struct {
+	ProxyType string     // The listener's proxy type, e.g. "socks5" or "mixed"
+	Addrs     []net.Addr // The addresses the proxy is bound to, the preferred one first
+}
+
+// New builds the client settings for the local proxies.
+//
+// A proxy bound to all addresses is described under the loopback address,
+// which is what clients on this machine should use. The HTTP proxy variables
+// name the first proxy serving HTTP and ALL_PROXY the first serving SOCKS5,
+// each at its preferred address; the browser hints name the first proxy.
+//
+// Parameters:
+//   - listeners: The local proxies, the main one first
+//
+// Returns:
+//   - Summary: The client settings, without forwards
+func New(listeners []Listener) Summary {
+	s := Summary{Proxies: []Proxy{}}
+	var httpAddress, socksAddress string
+	for _, l := range listeners {
+		var protocols []string
+		switch l.ProxyType {
+		case "socks5", "socks":
+			protocols = []string{"socks5"}
+		case "http":
+			protocols = []string{"http"}
+		case "mixed":
+			protocols = []string{"socks5", "http"}
+		}
+
+		for i, addr := range l.Addrs {
+			address := clientAddress(addr)
+			if address == "" {
+				continue
+			}
+			if l.ProxyType == "transparent" {
+				s.Transparent = append(s.Transparent, address)
+			}
+			for _, protocol := range protocols {
+				s.Proxies = append(s.Proxies, Proxy{Protocol: protocol, URL: protocol + "://" + address})
+				if i > 0 {
+					continue
+				}
+				if protocol == "http" && httpAddress == "" {
+					httpAddress = address
+				}
+				if protocol == "socks5" && socksAddress == "" {
+					socksAddress = address
+				}
+				if s.Browsers == nil {
+					s.Browsers = browserHints(protocol, address)
+				}
+			}
+		}
+	}
+
+	if httpAddress != "" {
+		url := "http://" + httpAddress
+		s.Env = append(s.Env,
+			"export http_proxy="+url+" https_proxy="+url,
+			"export HTTP_PROXY="+url+" HTTPS_PROXY="+url)
+	}
+	if socksAddress != "" {
+		// socks5h has names resolved through the tunnel rather than locally
+		s.Env = append(s.Env, "export ALL_PROXY=socks5h://"+socksAddress)
+	}
+	if s.Env != nil {
+		s.Env = append(s.Env, "export no_proxy=localhost,127.0.0.1,::1 NO_PROXY=localhost,127.0.0.1,::1")
+	}
+	return s
+}
+
+// browserHints tells how to configure Firefox and Chrome for a proxy.
+//
+// Parameters:
+//   - protocol: "socks5" or "http"
+//   - address: The host:port of the proxy
+//
+// Returns:
+//   - []Hint: The hints, one per browser
+func browserHints(protocol, address string) []Hint {
+	host, port, _ := net.SplitHostPort(address)
+	if protocol == "socks5" {
+		return []Hint{
+			{"Firefox", fmt.Sprintf("Settings → Network Settings → Manual proxy configuration: SOCKS Host %s, Port %s, SOCKS v5, Proxy DNS when using SOCKS v5", host, port)},
+			{"Chrome", fmt.Sprintf("google-chrome --proxy-server=\"socks5://%s\"", address)},
+		}
+	}
+	return []Hint{
+		{"Firefox", fmt.Sprintf("Settings → Network Settings → Manual proxy configuration: HTTP Proxy %s, Port %s, Also use this proxy for HTTPS", host, port)},
+		{"Chrome", fmt.Sprintf("google-chrome --proxy-server=\"http://%s\"", address)},
+	}
+}
+
+// clientAddress returns the address clients on this machine reach a bound
+// address at, or an empty string for addresses other than TCP ones.
+func clientAddress(addr net.Addr) string {
+	tcp, ok := addr.(*net.TCPAddr)
+	if !ok {
+		return ""
+	}
+	ip := tcp.IP
+	if ip.IsUnspecified() {
+		// Go listens on both IPv4 and IPv6 for unspecified addresses
+		ip = net.IPv4(127, 0, 0, 1)
+	}
+	return net.JoinHostPort(ip.String(), strconv.Itoa(tcp.Port))
+}
+
+// Print writes the client settings as an indented block.
+//
+// Parameters:
+//   - w: The writer to print to
+func (s Summary) Print(w io.Writer) {
+	fmt.Fprintln(w, "Client settings:")
+	if len(s.Proxies) > 0 {
+		fmt.Fprintln(w, "   Proxy URLs:")
+		for _, p := range s.Proxies {
+			fmt.Fprintf(w, "      %s\n", p.URL)
+		}
+	}
+	for _, address := range s.Transparent {
+		fmt.Fprintf(w, "   Transparent proxy on %s: redirect connections to it with the firewall\n", address)
+	}
+	if len(s.Env) > 0 {
+		fmt.Fprintln(w, "   Environment:")
+		for _, line := range s.Env {
+			fmt.Fprintf(w, "      %s\n", line)
+		}
+	}
+	for _, hint := range s.Browsers {
+		fmt.Fprintf(w, "   %s: %s\n", hint.Browser, hint.Setting)
+	}
+	if len(s.Forwards) > 0 {
+		fmt.Fprintln(w, "   Forwards:")
+		for _, f := range s.Forwards {
+			fmt.Fprintf(w, "      %s → %s\n", f.Listen, f.Remote)
+		}
+	}
+}
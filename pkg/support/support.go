@@ -0,0 +1,205 @@
+// Package support assembles the diagnostics archive attached to bug reports.
+//
+// The archive is a zip file of plain text and JSON files, so users can look
+// inside before sharing it. Everything added to it is redacted: credentials
+// in the configuration are masked by key name, and URLs, payloads and log
+// lines go through the redact package like console output does.
+package support
+
+import (
+	"archive/zip"
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"runtime"
+	"runtime/debug"
+	"strings"
+	"time"
+
+	"tunn/pkg/redact"
+)
+
+// secretKeys lists the JSON keys whose values are masked completely.
+var secretKeys = map[string]bool{
+	"password": true, "token": true, "passphrase": true, "answers": true,
+}
+
+// entry is one file of the archive.
+type entry struct {
+	name string
+	data []byte
+}
+
+// Archive collects the files of a support archive.
+type Archive struct {
+	entries []entry
+}
+
+// Add adds a file to the archive as it is. Callers redact the content.
+//
+// Parameters:
+//   - name: File name inside the archive
+//   - data: File content
+func (a *Archive) Add(name string, data []byte) {
+	a.entries = append(a.entries, entry{name: name, data: data})
+}
+
+// AddJSON adds a value encoded as indented JSON, with its secrets masked.
+//
+// Parameters:
+//   - name: File name inside the archive
+//   - v: The value to encode
+//
+// Returns:
+//   - error: An error if the value cannot be encoded
+func (a *Archive) AddJSON(name string, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("failed to encode %s: %w", name, err)
+	}
+	var doc any
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return fmt.Errorf("failed to encode %s: %w", name, err)
+	}
+	data, err = json.MarshalIndent(redactValue("", doc), "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode %s: %w", name, err)
+	}
+	a.Add(name, append(data, '\n'))
+	return nil
+}
+
+// Names returns the names of the files added so far.
+func (a *Archive) Names() []string {
+	names := make([]string, len(a.entries))
+	for i, e := range a.entries {
+		names[i] = e.name
+	}
+	return names
+}
+
+// Write writes the archive to a zip file, readable only by its owner.
+//
+// Parameters:
+//   - path: The zip file to create; an existing file is replaced
+//
+// Returns:
+//   - error: An error if the file cannot be written
+func (a *Archive) Write(path string) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", path, err)
+	}
+	zw := zip.NewWriter(f)
+	now := time.Now()
+	for _, e := range a.entries {
+		w, err := zw.CreateHeader(&zip.FileHeader{Name: e.name, Method: zip.Deflate, Modified: now})
+		if err == nil {
+			_, err = w.Write(e.data)
+		}
+		if err != nil {
+			f.Close()
+			return fmt.Errorf("failed to write %s: %w", path, err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return f.Close()
+}
+
+// SystemInfo describes the build and platform of the running binary.
+//
+// Parameters:
+//   - version: The Tunn version
+//
+// Returns:
+//   - []byte: One "name: value" line per detail
+func SystemInfo(version string) []byte {
+	var b strings.Builder
+	fmt.Fprintf(&b, "tunn: %s\n", version)
+	fmt.Fprintf(&b, "go: %s\n", runtime.Version())
+	fmt.Fprintf(&b, "platform: %s/%s, %d CPUs\n", runtime.GOOS, runtime.GOARCH, runtime.NumCPU())
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, setting := range info.Settings {
+			switch setting.Key {
+			case "vcs.revision", "vcs.time", "vcs.modified", "CGO_ENABLED", "-tags":
+				fmt.Fprintf(&b, "build %s: %s\n", setting.Key, setting.Value)
+			}
+		}
+	}
+	fmt.Fprintf(&b, "created: %s\n", time.Now().Format(time.RFC3339))
+	return []byte(b.String())
+}
+
+// LogTail returns the last lines of a log file, redacted.
+//
+// Parameters:
+//   - path: The log file, typically Tunn's output redirected to a file
+//   - lines: Maximum number of lines returned
+//
+// Returns:
+//   - []byte: The redacted lines
+//   - error: An error if the file cannot be read
+func LogTail(path string, lines int) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open log: %w", err)
+	}
+	defer f.Close()
+
+	tail := make([]string, 0, lines)
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		if len(tail) == lines {
+			tail = tail[1:]
+		}
+		tail = append(tail, redact.Text(scanner.Text()))
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read log: %w", err)
+	}
+	return []byte(strings.Join(tail, "\n") + "\n"), nil
+}
+
+// redactValue masks the secrets in a decoded JSON document: values of
+// secret keys completely, usernames partially, and credentials within URLs,
+// payloads and other strings.
+func redactValue(key string, v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		for k, item := range v {
+			v[k] = redactValue(k, item)
+		}
+		return v
+	case []any:
+		for i, item := range v {
+			v[i] = redactValue(key, item)
+		}
+		return v
+	case string:
+		switch {
+		case v == "":
+			return v
+		case secretKeys[key]:
+			return "****"
+		case key == "username":
+			return redact.Username(v)
+		case key == "httpPayload":
+			// Payload lines are separated by [crlf] placeholders
+			lines := strings.Split(v, "[crlf]")
+			for i, line := range lines {
+				lines[i] = redact.Text(line)
+			}
+			return strings.Join(lines, "[crlf]")
+		case strings.Contains(v, "://"):
+			return redact.URL(v)
+		default:
+			return redact.Text(v)
+		}
+	}
+	return v
+}
@@ -0,0 +1,138 @@
+// Package tor provides Tor integration for the Tunn SSH tunneling tool.
+//
+// Tor can be used on either side of the SSH tunnel:
+//   - Over Tor: the connection to the SSH or proxy server is dialed through a
+//     Tor SOCKS proxy running on the local machine
+//   - To Tor: connections accepted by the local proxies are forwarded into a Tor
+//     SOCKS proxy running on the SSH server, so traffic exits through Tor
+//
+// The package provides the SOCKS5 dialers for both directions and health checks
+// that report a missing or misconfigured Tor instance before it causes obscure
+// connection failures.
+package tor
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"time"
+
+	"golang.org/x/net/proxy"
+)
+
+// DefaultSocksAddress is the default Tor SOCKS listener address.
+const DefaultSocksAddress = "127.0.0.1:9050"
+
+// healthCheckTimeout bounds each Tor health check.
+const healthCheckTimeout = 10 * time.Second
+
+// Dialer returns a SOCKS5 dialer that connects through the Tor proxy at socksAddress.
+//
+// Hostnames are passed to Tor unresolved, so DNS resolution also happens inside Tor.
+//
+// Parameters:
+//   - socksAddress: Address of the Tor SOCKS listener
+//   - forward: Dialer used to reach the Tor SOCKS listener itself
+//
+// Returns:
+//   - proxy.ContextDialer: A dialer routing connections through Tor
+//   - error: An error if the dialer cannot be created
+func Dialer(socksAddress string, forward proxy.Dialer) (proxy.ContextDialer, error) {
+	dialer, err := proxy.SOCKS5("tcp", socksAddress, nil, forward)
+	if err != nil {
+		return nil, err
+	}
+	contextDialer, ok := dialer.(proxy.ContextDialer)
+	if !ok {
+		return nil, fmt.Errorf("SOCKS5 dialer does not support contexts")
+	}
+	return contextDialer, nil
+}
+
+// RemoteDialer adapts a Tor SOCKS proxy reachable through the SSH tunnel to the
+// Dial interface used by the local proxy servers.
+type RemoteDialer struct {
+	dialer proxy.Dialer // SOCKS5 dialer chained over the SSH tunnel
+}
+
+// NewRemoteDialer creates a dialer that forwards connections into the Tor SOCKS
+// proxy running on the SSH server.
+//
+// Parameters:
+//   - ssh: The SSH tunnel used to reach the remote Tor SOCKS listener
+//   - socksAddress: Address of the Tor SOCKS listener as seen from the SSH server
+//
+// Returns:
+//   - *RemoteDialer: A dialer whose connections exit through Tor on the server
+//   - error: An error if the dialer cannot be created
+func NewRemoteDialer(ssh proxy.Dialer, socksAddress string) (*RemoteDialer, error) {
+	dialer, err := proxy.SOCKS5("tcp", socksAddress, nil, ssh)
+	if err != nil {
+		return nil, err
+	}
+	return &RemoteDialer{dialer: dialer}, nil
+}
+
+// Dial establishes a connection to address through Tor on the SSH server.
+func (r *RemoteDialer) Dial(network, address string) (net.Conn, error) {
+	return r.dialer.Dial(network, address)
+}
+
+// CheckLocal verifies that a SOCKS5 server, normally Tor, is listening at socksAddress.
+//
+// Parameters:
+//   - socksAddress: Address of the local Tor SOCKS listener
+//
+// Returns:
+//   - error: A descriptive error if Tor is not reachable or not speaking SOCKS5
+func CheckLocal(socksAddress string) error {
+	conn, err := net.DialTimeout("tcp", socksAddress, healthCheckTimeout)
+	if err != nil {
+		return fmt.Errorf("Tor SOCKS proxy not reachable at %s (is Tor running?): %w", socksAddress, err)
+	}
+	defer conn.Close()
+
+	if err := socksGreeting(conn); err != nil {
+		return fmt.Errorf("Tor SOCKS proxy at %s: %w", socksAddress, err)
+	}
+	return nil
+}
+
+// CheckRemote verifies that a SOCKS5 server, normally Tor, is listening at
+// socksAddress on the SSH server.
+//
+// Parameters:
+//   - ssh: The SSH tunnel used to reach the remote Tor SOCKS listener
+//   - socksAddress: Address of the Tor SOCKS listener as seen from the SSH server
+//
+// Returns:
+//   - error: A descriptive error if Tor is not reachable or not speaking SOCKS5
+func CheckRemote(ssh proxy.Dialer, socksAddress string) error {
+	conn, err := ssh.Dial("tcp", socksAddress)
+	if err != nil {
+		return fmt.Errorf("Tor SOCKS proxy not reachable at %s on the SSH server (is Tor running there?): %w", socksAddress, err)
+	}
+	defer conn.Close()
+
+	if err := socksGreeting(conn); err != nil {
+		return fmt.Errorf("Tor SOCKS proxy at %s on the SSH server: %w", socksAddress, err)
+	}
+	return nil
+}
+
+// socksGreeting performs a SOCKS5 method negotiation to confirm the peer is a SOCKS5 server.
+func socksGreeting(conn net.Conn) error {
+	conn.SetDeadline(time.Now().Add(healthCheckTimeout))
+
+	if _, err := conn.Write([]byte{5, 1, 0}); err != nil {
+		return fmt.Errorf("failed to send SOCKS5 greeting: %w", err)
+	}
+	reply := make([]byte, 2)
+	if _, err := io.ReadFull(conn, reply); err != nil {
+		return fmt.Errorf("no SOCKS5 reply: %w", err)
+	}
+	if reply[0] != 5 || reply[1] != 0 {
+		return fmt.Errorf("unexpected SOCKS5 reply %v", reply)
+	}
+	return nil
+}
@@ -0,0 +1,27 @@
+package utils
+
+import "fmt"
+
+// FormatBytes formats a byte count as a human-readable string using binary units.
+//
+// Parameters:
+//   - n: Number of bytes
+//
+// Returns:
+//   - string: The formatted size (e.g., "512 B", "1.5 KB", "3.2 MB")
+//
+// Example:
+//
+//	FormatBytes(1536) // Returns: "1.5 KB"
+func FormatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(n)/float64(div), "KMGTPE"[exp])
+}
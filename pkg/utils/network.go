@@ -12,6 +12,7 @@ import (
 	"fmt"
 	"net"
 	"strconv"
+	"strings"
 )
 
 // ParseHostPort parses a host:port string with intelligent default port handling.
@@ -32,6 +33,8 @@ import (
 //   - "hostname:port" - Standard format
 //   - "hostname:http" - Named port
 //   - "hostname" - Host only (uses default port)
+//   - "[2001:db8::1]:port", "[2001:db8::1]" or "2001:db8::1" - IPv6 literals,
+//     returned without brackets
 //   - defaultPort: Port to use when not specified in hostPort
 //
 // Returns:
@@ -49,9 +52,16 @@ import (
 //
 //	host, port, err := ParseHostPort("example.com", 80)
 //	// Returns: "example.com", 80, nil
+//
+//	host, port, err := ParseHostPort("[2001:db8::1]:8080", 80)
+//	// Returns: "2001:db8::1", 8080, nil
 func ParseHostPort(hostPort string, defaultPort int) (string, int, error) {
 	host, portStr, err := net.SplitHostPort(hostPort)
 	if err != nil {
+		// A bracketed IPv6 literal without a port, as in "Host: [::1]"
+		if literal, ok := strings.CutPrefix(hostPort, "["); ok && strings.HasSuffix(literal, "]") {
+			return strings.TrimSuffix(literal, "]"), defaultPort, nil
+		}
 		return hostPort, defaultPort, nil
 	}
 